@@ -0,0 +1,57 @@
+// Package codegen runs goahead code generation from another program, such as
+// an IDE plugin or a build dashboard, and reports its progress through hooks.
+//
+// Run processes a directory the way the goahead command does:
+//
+//	report, err := codegen.Run(codegen.Config{
+//		Dir: dir,
+//		Hooks: &codegen.Hooks{
+//			MarkerEvaluated: func(e codegen.MarkerEvent) { progress <- e },
+//			Warning:         func(d codegen.Diagnostic) { log.Println(d.Message) },
+//		},
+//	})
+//
+// The types are those of the code generator, so values returned here are
+// the ones the command line reports.
+package codegen
+
+import "github.com/AeonDave/goahead/internal"
+
+// Config configures a run; Dir is the directory to process and every other
+// field is optional
+type Config = internal.Config
+
+// Hooks are the optional progress callbacks of a run. They are called
+// synchronously, one at a time, so they must return quickly and must not
+// block.
+type Hooks = internal.Hooks
+
+// FileEvent names a source file, as found by the directory walk
+type FileEvent = internal.FileEvent
+
+// MarkerEvent describes the value a marker wrote to one target
+type MarkerEvent = internal.MarkerEvent
+
+// InjectionEvent describes one injected function, interface method or
+// variable
+type InjectionEvent = internal.InjectionEvent
+
+// SkippedMarker is a marker that could not fire, with the reason
+type SkippedMarker = internal.SkippedMarker
+
+// SkipReport lists the skipped markers of a run
+type SkipReport = internal.SkipReport
+
+// Diagnostic is a warning of a run
+type Diagnostic = internal.Diagnostic
+
+// UserFunction is a helper found in a helper file, as given by
+// MarkerEvent.Func
+type UserFunction = internal.UserFunction
+
+// Run processes config.Dir and returns the markers that were skipped. The
+// report is printed to stderr when non-empty, and in strict mode a
+// non-empty report is returned alongside an error.
+func Run(config Config) (*SkipReport, error) {
+	return internal.RunCodegenWithReport(config)
+}
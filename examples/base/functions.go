@@ -1,7 +1,7 @@
 //go:ahead functions
 //go:build ignore
 
-package base
+package main
 
 import (
 	"crypto/sha256"
@@ -9,11 +9,11 @@ import (
 	"encoding/hex"
 )
 
-func getString() string {
+func GetString() string {
 	return "Hello World"
 }
 
-func getInt() int {
+func GetInt() int {
 	return 42
 }
 
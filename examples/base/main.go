@@ -1,12 +1,12 @@
-package base
+package main
 
 import "fmt"
 
 func main() {
-	//:getString
+	//:GetString
 	msg := "Hello World"
 
-	//:getInt
+	//:GetInt
 	num := 42
 
 	//:ShadowStr:pippo
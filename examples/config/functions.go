@@ -2,30 +2,33 @@
 
 //go:ahead functions
 
-package config
+package main
 
 import (
 	"os"
 	"strings"
 )
 
-func serviceName() string {
+func ServiceName() string {
 	return "billing-api"
 }
 
-func servicePort() int {
+func ServicePort() int {
 	return 8080
 }
 
-func enableTLS() bool {
+func EnableTLS() bool {
 	return true
 }
 
-func env(key string) string {
-	return os.Getenv(key)
+func EnvOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
 }
 
-func sanitizeCSV(input string) string {
+func SanitizeCSV(input string) string {
 	parts := strings.Split(input, ",")
 	for i, p := range parts {
 		parts[i] = strings.TrimSpace(p)
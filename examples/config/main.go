@@ -1,4 +1,4 @@
-package config
+package main
 
 import (
 	"fmt"
@@ -14,17 +14,17 @@ type Config struct {
 }
 
 var (
-	//:serviceName
-	name = ""
+	//:ServiceName
+	name = "billing-api"
 
-	//:servicePort
-	port = 0
+	//:ServicePort
+	port = 8080
 
-	//:enableTLS
-	tlsEnabled = false
+	//:EnableTLS
+	tlsEnabled = true
 
-	//:sanitizeCSV:"https://app.example.com , https://admin.example.com "
-	origins = ""
+	//:SanitizeCSV:"https://app.example.com , https://admin.example.com "
+	origins = "https://app.example.com,https://admin.example.com"
 )
 
 func main() {
@@ -36,8 +36,8 @@ func main() {
 		Timeout:        30 * time.Second,
 	}
 
-	//:env:"ADMIN_EMAIL"
-	adminEmail := ""
+	//:EnvOr:"ADMIN_EMAIL":"admin@example.com"
+	adminEmail := "admin@example.com"
 
 	fmt.Printf("Config: %#v\n", cfg)
 	fmt.Printf("Admin email: %s\n", adminEmail)
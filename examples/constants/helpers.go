@@ -2,7 +2,7 @@
 
 //go:ahead functions
 
-package constants
+package main
 
 import "fmt"
 
@@ -27,23 +27,23 @@ const (
 var defaultTimeout = 30
 
 // Functions using package-level constants and types
-func prefixed(key string) string {
+func Prefixed(key string) string {
 	return Prefix + key
 }
 
-func formatted(key, value string) string {
+func Formatted(key, value string) string {
 	return key + Separator + value
 }
 
-func getVersion() string {
+func GetVersion() string {
 	return Version
 }
 
-func getDefaultLevel() Level {
+func GetDefaultLevel() Level {
 	return LevelInfo
 }
 
-func levelName(l Level) string {
+func LevelName(l Level) string {
 	switch l {
 	case LevelDebug:
 		return "DEBUG"
@@ -58,6 +58,6 @@ func levelName(l Level) string {
 	}
 }
 
-func getTimeout() int {
+func GetTimeout() int {
 	return defaultTimeout
 }
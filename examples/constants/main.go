@@ -1,30 +1,30 @@
-package constants
+package main
 
 import "fmt"
 
 var (
 	// Using helper that references package constants
-	//:prefixed:"DATABASE_URL"
+	//:Prefixed:"DATABASE_URL"
 	envKey = "APP_DATABASE_URL"
 
 	// Formatted key-value
-	//:formatted:"config":"production"
+	//:Formatted:"config":"production"
 	configEntry = "config::production"
 
 	// Get version constant
-	//:getVersion
+	//:GetVersion
 	appVersion = "1.0.0"
 
 	// Using custom type
-	//:getDefaultLevel
+	//:GetDefaultLevel
 	logLevel = 1
 
 	// Level name from custom type
-	//:levelName:2
+	//:LevelName:2
 	levelStr = "WARN"
 
 	// Package variable
-	//:getTimeout
+	//:GetTimeout
 	timeout = 30
 )
 
@@ -2,20 +2,20 @@
 
 //go:ahead functions
 
-package directives
+package main
 
 // This file demonstrates that GoAhead helpers work alongside
 // other Go directives without interfering with them.
 
-func getBuildMode() string {
+func GetBuildMode() string {
 	return "release"
 }
 
-func getOptimizationLevel() int {
+func GetOptimizationLevel() int {
 	return 3
 }
 
-func getFeatureFlag() bool {
+func GetFeatureFlag() bool {
 	return true
 }
 
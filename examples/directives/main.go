@@ -3,7 +3,7 @@
 // This example demonstrates GoAhead working alongside Go directives.
 // All //go: directives are preserved while //: placeholders are replaced.
 
-package directives
+package main
 
 import (
 	_ "embed"
@@ -14,13 +14,13 @@ import (
 
 // Build-time configuration via GoAhead
 var (
-	//:getBuildMode
+	//:GetBuildMode
 	buildMode = "release"
 
-	//:getOptimizationLevel
+	//:GetOptimizationLevel
 	optLevel = 3
 
-	//:getFeatureFlag
+	//:GetFeatureFlag
 	newUIEnabled = true
 )
 
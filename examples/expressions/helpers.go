@@ -5,16 +5,16 @@
 //go:ahead import filepath=path/filepath
 //go:ahead import base64=encoding/base64
 
-package expressions
+package main
 
 // Helper function using map literals with colons inside
-func getMapLen() int {
+func GetMapLen() int {
 	m := map[string]int{"a": 1, "b": 2, "c": 3}
 	return len(m)
 }
 
 // Helper using struct literals with colons inside
-func getPointSum() int {
+func GetPointSum() int {
 	type Point struct{ X, Y int }
 	p := Point{X: 10, Y: 20}
 	return p.X + p.Y
@@ -28,6 +28,6 @@ func getURLs() []string {
 	}
 }
 
-func countURLs() int {
+func CountURLs() int {
 	return len(getURLs())
 }
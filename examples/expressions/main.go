@@ -1,18 +1,18 @@
-package expressions
+package main
 
 import "fmt"
 
 var (
 	// Map literal - colons inside {} are preserved
-	//:getMapLen
+	//:GetMapLen
 	mapSize = 3
 
 	// Struct literal - colons inside {} are preserved
-	//:getPointSum
+	//:GetPointSum
 	pointSum = 30
 
 	// Count URLs (with colons in strings)
-	//:countURLs
+	//:CountURLs
 	urlCount = 2
 
 	// Raw expression with slice literal
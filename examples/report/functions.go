@@ -2,30 +2,38 @@
 
 //go:ahead functions
 
-package report
+package main
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
-func incidentSummary(team string, resolved, total int) string {
+func IncidentSummary(team string, resolved, total int) string {
 	return fmt.Sprintf("%s team resolved %d of %d incidents", strings.ToUpper(team), resolved, total)
 }
 
-func resolutionRate(resolved, total int) string {
+func ResolutionRate(resolved, total int) string {
 	if total == 0 {
 		return "0%"
 	}
 	return fmt.Sprintf("%.1f%%", float64(resolved)/float64(total)*100)
 }
 
-func generatedAt(layout string) string {
-	return time.Now().Format(layout)
+// GeneratedAt honours SOURCE_DATE_EPOCH so that reproducible builds get a
+// stable timestamp
+func GeneratedAt(layout string) string {
+	now := time.Now()
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		now = time.Unix(epoch, 0)
+	}
+	return now.UTC().Format(layout)
 }
 
-func slugify(input string) string {
+func Slugify(input string) string {
 	sanitized := strings.ToLower(strings.TrimSpace(input))
 	return strings.ReplaceAll(sanitized, " ", "-")
 }
@@ -1,18 +1,18 @@
-package report
+package main
 
 import "fmt"
 
 func main() {
-	//:incidentSummary:"Platform":29:37
+	//:IncidentSummary:"Platform":29:37
 	summary := "PLATFORM team resolved 29 of 37 incidents"
 
-	//:resolutionRate:29:37
+	//:ResolutionRate:29:37
 	rate := "78.4%"
 
-	//:generatedAt:"2006-01-02 15:04"
+	//:GeneratedAt:"2006-01-02 15:04"
 	generatedAt := "2026-01-22 17:49"
 
-	//:slugify:"Weekly Platform Update"
+	//:Slugify:"Weekly Platform Update"
 	slug := "weekly-platform-update"
 
 	fmt.Println(summary)
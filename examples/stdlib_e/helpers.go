@@ -3,4 +3,4 @@
 //go:ahead functions
 //go:ahead import http=net/http
 
-package stdlib_e
+package main
@@ -1,10 +1,10 @@
-package stdlib_e
+package main
 
 import "fmt"
 
 var (
-	//:os.Getenv:"HOME"
-	homeDir = "C:\\Users\\novad\\"
+	//:strings.Repeat:"ab":3
+	pattern = "ababab"
 
 	//:http.DetectContentType:=[]byte("plain text payload")
 	mime = "text/plain; charset=utf-8"
@@ -14,7 +14,7 @@ func main() {
 	//:strings.ToUpper:"detected"
 	status := "DETECTED"
 
-	fmt.Printf("HOME: %s\n", homeDir)
+	fmt.Printf("Pattern: %s\n", pattern)
 	fmt.Printf("MIME: %s\n", mime)
 	fmt.Printf("Status: %s\n", status)
 }
@@ -2,7 +2,7 @@
 
 //go:ahead functions
 
-package types
+package main
 
 import (
 	"fmt"
@@ -28,12 +28,12 @@ type Config struct {
 type StringList = []string
 
 // Function returning custom type
-func getDefaultStatus() Status {
+func GetDefaultStatus() Status {
 	return StatusActive
 }
 
 // Function using custom struct
-func getDefaultConfig() string {
+func GetDefaultConfig() string {
 	cfg := Config{Host: "localhost", Port: 8080}
 	return fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
 }
@@ -44,7 +44,7 @@ func joinList(items StringList, sep string) string {
 }
 
 // Function accepting custom type
-func statusName(s Status) string {
+func StatusName(s Status) string {
 	names := []string{"Pending", "Active", "Completed", "Failed"}
 	if int(s) < len(names) {
 		return names[s]
@@ -56,7 +56,7 @@ func statusName(s Status) string {
 type Point struct{ X, Y int }
 type Rectangle struct{ TopLeft, BottomRight Point }
 
-func getRectArea() int {
+func GetRectArea() int {
 	r := Rectangle{
 		TopLeft:     Point{X: 0, Y: 0},
 		BottomRight: Point{X: 10, Y: 5},
@@ -1,22 +1,22 @@
-package types
+package main
 
 import "fmt"
 
 var (
 	// Custom type as return
-	//:getDefaultStatus
+	//:GetDefaultStatus
 	status = 1
 
 	// Status name from custom type value
-	//:statusName:2
+	//:StatusName:2
 	statusStr = "Completed"
 
 	// Using struct internally
-	//:getDefaultConfig
+	//:GetDefaultConfig
 	serverAddr = "localhost:8080"
 
 	// Nested struct calculation
-	//:getRectArea
+	//:GetRectArea
 	area = 50
 )
 
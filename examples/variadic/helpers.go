@@ -2,22 +2,22 @@
 
 //go:ahead functions
 
-package variadic
+package main
 
 import "strings"
 
-// joinAll demonstrates variadic function support - can accept any number of arguments
-func joinAll(sep string, parts ...string) string {
+// JoinAll demonstrates variadic function support - can accept any number of arguments
+func JoinAll(sep string, parts ...string) string {
 	return strings.Join(parts, sep)
 }
 
-// concat joins strings without separator
-func concat(parts ...string) string {
+// Concat joins strings without separator
+func Concat(parts ...string) string {
 	return strings.Join(parts, "")
 }
 
-// sum adds all numbers together
-func sum(nums ...int) int {
+// Sum adds all numbers together
+func Sum(nums ...int) int {
 	total := 0
 	for _, n := range nums {
 		total += n
@@ -25,8 +25,8 @@ func sum(nums ...int) int {
 	return total
 }
 
-// maxOf returns the maximum value
-func maxOf(nums ...int) int {
+// MaxOf returns the maximum value
+func MaxOf(nums ...int) int {
 	if len(nums) == 0 {
 		return 0
 	}
@@ -1,22 +1,22 @@
-package variadic
+package main
 
 import "fmt"
 
 var (
 	// Variadic string function with separator
-	//:joinAll:"-":"a":"b":"c":"d"
+	//:JoinAll:"-":"a":"b":"c":"d"
 	dashed = "a-b-c-d"
 
 	// Variadic without separator
-	//:concat:"Hello":" ":"World":"!"
+	//:Concat:"Hello":" ":"World":"!"
 	message = "Hello World!"
 
 	// Variadic numbers
-	//:sum:1:2:3:4:5
+	//:Sum:1:2:3:4:5
 	total = 15
 
 	// Find maximum
-	//:maxOf:42:17:99:8:73
+	//:MaxOf:42:17:99:8:73
 	maximum = 99
 )
 
@@ -0,0 +1,208 @@
+// Package goaheadtest tests goahead helper files against golden output.
+//
+// A fixture is a directory tree holding a module (a go.mod is added when
+// missing), its helper files and the sources with markers. RunGolden copies
+// it to a temporary directory, runs code generation there and compares every
+// resulting file with the golden tree of the same layout:
+//
+//	func TestHelpers(t *testing.T) {
+//		goaheadtest.RunGolden(t, "testdata/fixture", "testdata/golden", goaheadtest.Options{Compile: true})
+//	}
+//
+// Golden trees are written, or rewritten, by running the tests with
+// GOAHEAD_UPDATE_GOLDEN=1 or with the -goahead.update flag.
+package goaheadtest
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// UpdateEnv is the environment variable that, set to 1, makes RunGolden
+// write the golden trees instead of comparing with them
+const UpdateEnv = "GOAHEAD_UPDATE_GOLDEN"
+
+var update = flag.Bool("goahead.update", os.Getenv(UpdateEnv) == "1", "rewrite goaheadtest golden trees")
+
+// fixtureModule is written as go.mod to fixtures that have none
+const fixtureModule = "module goaheadtest\n\ngo 1.22\n"
+
+// Options tunes RunGolden
+type Options struct {
+	// Dir is the directory, relative to the fixture root, that code
+	// generation runs from; empty means the root
+	Dir string
+	// Compile runs go build ./... on the generated tree
+	Compile bool
+	// AllowSkipped accepts markers that did not fire; without it any
+	// skipped marker fails the test
+	AllowSkipped bool
+}
+
+// RunGolden copies fixtureDir to a temporary directory, runs code generation
+// in it and compares the resulting tree with goldenDir, file by file
+func RunGolden(t *testing.T, fixtureDir, goldenDir string, opts Options) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := copyTree(fixtureDir, dir); err != nil {
+		t.Fatalf("goaheadtest: copy fixture: %v", err)
+	}
+	addedModule := false
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); os.IsNotExist(err) {
+		if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(fixtureModule), 0o644); err != nil {
+			t.Fatalf("goaheadtest: write go.mod: %v", err)
+		}
+		addedModule = true
+	}
+
+	runDir := filepath.Join(dir, filepath.FromSlash(opts.Dir))
+	report, err := internal.RunCodegenWithReport(internal.Config{Dir: runDir})
+	if err != nil {
+		t.Fatalf("goaheadtest: code generation failed: %v", err)
+	}
+	if report.Len() > 0 && !opts.AllowSkipped {
+		t.Errorf("goaheadtest: markers were skipped:\n%s", report.Format(runDir))
+	}
+
+	if opts.Compile {
+		build := exec.Command("go", "build", "-o", t.TempDir()+string(filepath.Separator), "./...")
+		build.Dir = dir
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Errorf("goaheadtest: generated code does not compile: %v\n%s", err, out)
+		}
+	}
+
+	got, err := readTree(dir)
+	if err != nil {
+		t.Fatalf("goaheadtest: read output: %v", err)
+	}
+	if addedModule {
+		delete(got, "go.mod")
+	}
+	if *update {
+		if err := writeTree(goldenDir, got); err != nil {
+			t.Fatalf("goaheadtest: update golden: %v", err)
+		}
+		return
+	}
+
+	want, err := readTree(goldenDir)
+	if err != nil {
+		t.Fatalf("goaheadtest: read golden: %v (run with %s=1 to create it)", err, UpdateEnv)
+	}
+	for _, name := range sortedKeys(want) {
+		content, ok := got[name]
+		if !ok {
+			t.Errorf("goaheadtest: %s is in the golden tree but was not produced", name)
+			continue
+		}
+		if content != want[name] {
+			t.Errorf("goaheadtest: %s differs from %s:\n%s", name, filepath.Join(goldenDir, filepath.FromSlash(name)), diff(want[name], content))
+		}
+	}
+	for _, name := range sortedKeys(got) {
+		if _, ok := want[name]; !ok {
+			t.Errorf("goaheadtest: %s was produced but is not in the golden tree", name)
+		}
+	}
+}
+
+// readTree returns the files under root by slash-separated relative path
+func readTree(root string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	return files, err
+}
+
+// writeTree makes root hold exactly files
+func writeTree(root string, files map[string]string) error {
+	existing, err := readTree(root)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for name := range existing {
+		if _, ok := files[name]; !ok {
+			if err := os.Remove(filepath.Join(root, filepath.FromSlash(name))); err != nil {
+				return err
+			}
+		}
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyTree(src, dst string) error {
+	files, err := readTree(src)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files in %s", src)
+	}
+	return writeTree(dst, files)
+}
+
+func sortedKeys(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// diff shows the first differing line of want and got with two lines of
+// context on each side
+func diff(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	first := 0
+	for first < len(wantLines) && first < len(gotLines) && wantLines[first] == gotLines[first] {
+		first++
+	}
+	var b strings.Builder
+	excerpt := func(label string, lines []string) {
+		fmt.Fprintf(&b, "%s (from line %d):\n", label, max(first-2, 0)+1)
+		for i := max(first-2, 0); i < min(first+3, len(lines)); i++ {
+			marker := " "
+			if i == first {
+				marker = ">"
+			}
+			fmt.Fprintf(&b, "%s %4d | %s\n", marker, i+1, lines[i])
+		}
+	}
+	excerpt("want", wantLines)
+	excerpt("got", gotLines)
+	return b.String()
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/AeonDave/goahead/internal/artifact"
+)
+
+// Annotation links one generated literal back to the helper that produced it
+type Annotation = artifact.Annotation
+
+// AnnotationFile is the on-disk layout of the -annotations output
+type AnnotationFile = artifact.Annotations
+
+// AnnotationSet collects annotations for a whole run, including submodules
+type AnnotationSet struct {
+	mu      sync.Mutex
+	baseDir string
+	entries map[string]Annotation
+}
+
+// NewAnnotationSet creates a collector whose keys are relative to baseDir
+func NewAnnotationSet(baseDir string) *AnnotationSet {
+	return &AnnotationSet{baseDir: baseDir, entries: make(map[string]Annotation)}
+}
+
+// Record stores the annotation for a generated literal at line (1-based) of
+// filePath. Callers record lines after every edit to the file is applied.
+func (a *AnnotationSet) Record(filePath string, line int, helper string, userFunc *UserFunction, argsStr, traceID string) {
+	if a == nil {
+		return
+	}
+	entry := Annotation{
+		Helper:         helper,
+		ArgsHash:       hashArgs(argsStr),
+		GoaheadVersion: Version,
+		Trace:          traceID,
+	}
+	if userFunc != nil {
+		entry.HelperFile = a.relative(userFunc.FilePath)
+		entry.NotReproducible = userFunc.NoCache
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries[fmt.Sprintf("%s:%d", a.relative(filePath), line)] = entry
+}
+
+// shift moves the annotations of filePath from line from on delta lines
+// down, after lines were inserted above them or removed
+func (a *AnnotationSet) shift(filePath string, from, delta int) {
+	if a == nil {
+		return
+	}
+	prefix := a.relative(filePath) + ":"
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	shifted := make(map[string]Annotation)
+	for key, entry := range a.entries {
+		line, err := strconv.Atoi(strings.TrimPrefix(key, prefix))
+		if !strings.HasPrefix(key, prefix) || err != nil || line < from {
+			continue
+		}
+		delete(a.entries, key)
+		shifted[fmt.Sprintf("%s%d", prefix, line+delta)] = entry
+	}
+	for key, entry := range shifted {
+		a.entries[key] = entry
+	}
+}
+
+// keepFrom copies the entries of the annotations file at path whose source
+// file was left alone by the run, as reported by skipped; a missing or
+// unreadable file keeps nothing
+func (a *AnnotationSet) keepFrom(path string, skipped func(string) bool) {
+	if a == nil {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	var previous AnnotationFile
+	if err := artifact.Read(path, &previous); err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, entry := range previous.Entries {
+		colon := strings.LastIndex(key, ":")
+		if colon < 0 || !skipped(filepath.Join(a.baseDir, filepath.FromSlash(key[:colon]))) {
+			continue
+		}
+		if _, ok := a.entries[key]; !ok {
+			a.entries[key] = entry
+		}
+	}
+}
+
+// Len returns the number of recorded annotations
+func (a *AnnotationSet) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.entries)
+}
+
+// WriteFile writes the collected annotations as indented JSON
+func (a *AnnotationSet) WriteFile(path string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return artifact.Write(path, &AnnotationFile{Entries: a.entries})
+}
+
+func (a *AnnotationSet) relative(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	rel, err := filepath.Rel(a.baseDir, absPath)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func hashArgs(argsStr string) string {
+	sum := sha256.Sum256([]byte(argsStr))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,134 @@
+// Package artifact defines the on-disk JSON formats goahead writes next to
+// the sources it processes, such as the -annotations map and the trace.json
+// of -trace-dir. Every format carries a schema version in its "version" key.
+//
+// Readers accept files of any older version, migrating them step by step to
+// the current layout, and refuse files written by a newer goahead with an
+// error wrapping ErrNewerVersion. Unknown fields are ignored with a warning
+// on stderr, so that a file hand-edited or written by a patched build still
+// loads.
+package artifact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNewerVersion is wrapped by read errors for files whose schema version
+// is newer than this goahead understands
+var ErrNewerVersion = errors.New("produced by a newer goahead")
+
+// Document is implemented by every artifact format of this package
+type Document interface {
+	// schema returns the name of the format, its current version and the
+	// field holding the version of the value
+	schema() (kind string, current int, version *int)
+}
+
+// migration upgrades the raw fields of a document from one version to the
+// next; the "version" key is updated by the caller
+type migration func(fields map[string]json.RawMessage) error
+
+// migrations holds, per format, the step from each older version, e.g.
+// migrations["trace"][0] turns a version 0 trace into a version 1 trace
+var migrations = map[string]map[int]migration{
+	traceKind: {
+		// Traces written before versioning carry no "version" key and
+		// already have the version 1 layout
+		0: func(map[string]json.RawMessage) error { return nil },
+	},
+}
+
+// Encode returns doc as indented JSON with a trailing newline, stamped with
+// the current schema version of its format
+func Encode(doc Document) ([]byte, error) {
+	kind, current, version := doc.schema()
+	*version = current
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %v", kind, err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Write encodes doc to path, creating its directory when needed
+func Write(path string, doc Document) error {
+	data, err := Encode(doc)
+	if err != nil {
+		return err
+	}
+	kind, _, _ := doc.schema()
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create %s directory: %v", kind, err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s %s: %v", kind, path, err)
+	}
+	return nil
+}
+
+// Decode reads data into doc, migrating older versions to the current one.
+// name identifies the file in errors and warnings.
+func Decode(name string, data []byte, doc Document) error {
+	kind, current, _ := doc.schema()
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("invalid %s %s: %v", kind, name, err)
+	}
+	found := 0
+	if raw, ok := fields["version"]; ok {
+		if err := json.Unmarshal(raw, &found); err != nil {
+			return fmt.Errorf("invalid %s %s: version: %v", kind, name, err)
+		}
+	}
+	if found > current {
+		return fmt.Errorf("%s %s was %w (schema version %d, this goahead reads up to %d); upgrade goahead to read it", kind, name, ErrNewerVersion, found, current)
+	}
+	for v := found; v < current; v++ {
+		step, ok := migrations[kind][v]
+		if !ok {
+			return fmt.Errorf("%s %s has schema version %d, which this goahead cannot migrate", kind, name, v)
+		}
+		if err := step(fields); err != nil {
+			return fmt.Errorf("failed to migrate %s %s from version %d: %v", kind, name, v, err)
+		}
+	}
+	fields["version"] = json.RawMessage(fmt.Sprint(current))
+
+	migrated, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s %s: %v", kind, name, err)
+	}
+	strict := json.NewDecoder(bytes.NewReader(migrated))
+	strict.DisallowUnknownFields()
+	err = strict.Decode(doc)
+	if err == nil {
+		return nil
+	}
+	if !strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return fmt.Errorf("invalid %s %s: %v", kind, name, err)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Warning: %s %s: ignoring %s\n", kind, name, strings.TrimPrefix(err.Error(), "json: "))
+	if err := json.Unmarshal(migrated, doc); err != nil {
+		return fmt.Errorf("invalid %s %s: %v", kind, name, err)
+	}
+	return nil
+}
+
+// Read decodes the file at path into doc; see Decode
+func Read(path string, doc Document) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		kind, _, _ := doc.schema()
+		return fmt.Errorf("failed to read %s %s: %v", kind, path, err)
+	}
+	return Decode(path, data, doc)
+}
@@ -0,0 +1,120 @@
+package artifact
+
+const (
+	annotationsKind = "annotations"
+	traceKind       = "trace"
+	indexKind       = "index"
+	backupKind      = "backup"
+	cacheKind       = "result cache entry"
+)
+
+// Current schema versions; bump one together with a new entry in migrations
+const (
+	AnnotationsVersion = 1
+	TraceVersion       = 1
+	IndexVersion       = 1
+	BackupVersion      = 1
+	CacheEntryVersion  = 1
+)
+
+// Annotation links one generated literal back to the helper that produced it
+type Annotation struct {
+	Helper         string `json:"helper"`
+	HelperFile     string `json:"helper_file,omitempty"`
+	ArgsHash       string `json:"args_hash"`
+	GoaheadVersion string `json:"goahead_version"`
+	// Trace is the -trace-dir ID of the evaluation program that produced
+	// the literal
+	Trace string `json:"trace,omitempty"`
+	// NotReproducible marks literals of //goahead:nocache helpers, which
+	// may change on every run
+	NotReproducible bool `json:"not_reproducible,omitempty"`
+}
+
+// Annotations is the -annotations output. Entries are keyed by
+// "<module-relative file>:<line>" of the final, post-edit content.
+type Annotations struct {
+	SchemaVersion int                   `json:"version"`
+	Entries       map[string]Annotation `json:"entries"`
+}
+
+func (a *Annotations) schema() (string, int, *int) {
+	return annotationsKind, AnnotationsVersion, &a.SchemaVersion
+}
+
+// Trace is the trace.json of one evaluation program saved by -trace-dir
+type Trace struct {
+	SchemaVersion int    `json:"version"`
+	ID            string `json:"id"`
+	// Markers lists the module-relative file:line of the markers served by
+	// the program; empty for calls made outside a source file
+	Markers []string `json:"markers,omitempty"`
+	Calls   []string `json:"calls"`
+	Dir     string   `json:"dir"`
+	Command []string `json:"command"`
+	Env     []string `json:"env"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func (t *Trace) schema() (string, int, *int) {
+	return traceKind, TraceVersion, &t.SchemaVersion
+}
+
+// IndexFile is what -incremental remembers of one processed file
+type IndexFile struct {
+	// Hash is the content hash of the file after it was processed
+	Hash string `json:"hash"`
+	// Helpers maps the helpers its markers and injections used to their
+	// content hashes
+	Helpers map[string]string `json:"helpers,omitempty"`
+	// Project hashes the .goahead.toml variables the file was processed with
+	Project string `json:"project,omitempty"`
+	// Unresolved marks files with skipped markers or warnings, which are
+	// processed again by the next run
+	Unresolved bool `json:"unresolved,omitempty"`
+}
+
+// Index is the .goahead-index.json of -incremental. Files are keyed by
+// their path relative to the directory of the run.
+type Index struct {
+	SchemaVersion  int                  `json:"version"`
+	GoaheadVersion string               `json:"goahead_version"`
+	Files          map[string]IndexFile `json:"files"`
+}
+
+func (ix *Index) schema() (string, int, *int) {
+	return indexKind, IndexVersion, &ix.SchemaVersion
+}
+
+// BackupEdit is one change a run made to a file: the lines starting at Line
+// (1-based, in the content the run wrote) were Original before the run and
+// became Generated. Lines keep their "\n".
+type BackupEdit struct {
+	Line      int      `json:"line"`
+	Original  []string `json:"original"`
+	Generated []string `json:"generated"`
+}
+
+// Backup is the .goahead/backup.json of -backup. Files are keyed by their
+// path relative to the directory of the run; each holds the edits of every
+// run that changed it, oldest run first.
+type Backup struct {
+	SchemaVersion int                       `json:"version"`
+	Files         map[string][][]BackupEdit `json:"files"`
+}
+
+func (b *Backup) schema() (string, int, *int) {
+	return backupKind, BackupVersion, &b.SchemaVersion
+}
+
+// CacheEntry is one result of the persistent result cache, stored in a file
+// named after the hash of its key
+type CacheEntry struct {
+	SchemaVersion int `json:"version"`
+	// Result is the marker's value as Go source text
+	Result string `json:"result"`
+}
+
+func (e *CacheEntry) schema() (string, int, *int) {
+	return cacheKind, CacheEntryVersion, &e.SchemaVersion
+}
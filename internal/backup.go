@@ -0,0 +1,241 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AeonDave/goahead/internal/artifact"
+)
+
+// BackupDirName and BackupFileName locate, in the directory of the run, the
+// file where -backup records the lines each run changed, so that goahead
+// restore can put them back
+const (
+	BackupDirName  = ".goahead"
+	BackupFileName = "backup.json"
+)
+
+// BackupEdit is one change of a file recorded by -backup
+type BackupEdit = artifact.BackupEdit
+
+// backupSet records the edits of a -backup run on top of those of earlier
+// runs
+type backupSet struct {
+	mu      sync.Mutex
+	path    string
+	baseDir string
+	files   map[string][][]BackupEdit
+	changed bool
+}
+
+// backupPath returns the backup file of the run in dir
+func backupPath(dir string) string {
+	return filepath.Join(dir, BackupDirName, BackupFileName)
+}
+
+// loadBackups returns nil unless config.Backup is set. An existing backup
+// that cannot be read fails the run: recording on top of it would lose the
+// original lines it holds.
+func loadBackups(config Config) (*backupSet, error) {
+	if !config.Backup {
+		return nil, nil
+	}
+	baseDir := runBaseDir(config)
+	b := &backupSet{path: backupPath(baseDir), baseDir: baseDir, files: make(map[string][][]BackupEdit)}
+	doc, err := readBackup(b.path)
+	if err != nil || doc == nil {
+		return b, err
+	}
+	for rel, runs := range doc.Files {
+		b.files[rel] = runs
+	}
+	return b, nil
+}
+
+// readBackup reads the backup file at path; nil when there is none
+func readBackup(path string) (*artifact.Backup, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	var doc artifact.Backup
+	if err := artifact.Read(path, &doc); err != nil {
+		return nil, fmt.Errorf("%v; restore or remove it before recording another backup", err)
+	}
+	return &doc, nil
+}
+
+// record adds the edits that turned before into after, the content of
+// filePath before and after the run; nothing when they are equal
+func (b *backupSet) record(filePath string, before, after []byte) {
+	if b == nil {
+		return
+	}
+	edits := backupEdits(string(before), string(after))
+	if len(edits) == 0 {
+		return
+	}
+	rel := b.relative(filePath)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files[rel] = append(b.files[rel], edits)
+	b.changed = true
+}
+
+// Write saves the backup when the run recorded edits
+func (b *backupSet) Write() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.changed {
+		return nil
+	}
+	return artifact.Write(b.path, &artifact.Backup{Files: b.files})
+}
+
+func (b *backupSet) relative(path string) string {
+	rel, err := filepath.Rel(b.baseDir, absPath(path))
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// backupEdits returns the edits that turn before into after, positioned in
+// after
+func backupEdits(before, after string) []BackupEdit {
+	if before == after {
+		return nil
+	}
+	var edits []BackupEdit
+	line := 1
+	var current *BackupEdit
+	for _, op := range diffLines(splitLinesKeepEnds(before), splitLinesKeepEnds(after)) {
+		if op.kind == ' ' {
+			if current != nil {
+				edits = append(edits, *current)
+				current = nil
+			}
+			line++
+			continue
+		}
+		if current == nil {
+			current = &BackupEdit{Line: line, Original: []string{}, Generated: []string{}}
+		}
+		if op.kind == '-' {
+			current.Original = append(current.Original, op.line)
+			continue
+		}
+		current.Generated = append(current.Generated, op.line)
+		line++
+	}
+	if current != nil {
+		edits = append(edits, *current)
+	}
+	return edits
+}
+
+// revertEdits undoes runs, the recorded edits of content, newest first. It
+// fails with the line of the first edit whose generated lines are no longer
+// in content.
+func revertEdits(content string, runs [][]BackupEdit) (string, error) {
+	lines := splitLinesKeepEnds(content)
+	for r := len(runs) - 1; r >= 0; r-- {
+		edits := runs[r]
+		for i := len(edits) - 1; i >= 0; i-- {
+			edit := edits[i]
+			start, end := edit.Line-1, edit.Line-1+len(edit.Generated)
+			if start < 0 || end > len(lines) || !slices.Equal(lines[start:end], edit.Generated) {
+				return "", fmt.Errorf("line %d is no longer what goahead wrote", edit.Line)
+			}
+			lines = slices.Concat(lines[:start], edit.Original, lines[end:])
+		}
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// RestoreReport lists the files goahead restore put back and those it left
+// alone, relative to the directory of the run
+type RestoreReport struct {
+	Restored []string
+	// Conflicts holds "<file>: <reason>" for files edited since goahead
+	// wrote them, which keep their backup
+	Conflicts []string
+}
+
+// RestoreBackups puts the files recorded in the backup of dir back to their
+// content before the -backup runs that changed them, generated values and
+// injected blocks included. A file is only rewritten when every line goahead
+// wrote is still there, so manual edits around them are kept and a file
+// whose generated lines were edited is left alone.
+func RestoreBackups(dir string) (*RestoreReport, error) {
+	baseDir, err := filepath.Abs(StripLongPathPrefix(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", dir, err)
+	}
+	path := backupPath(baseDir)
+	doc, err := readBackup(path)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, environmentErrorf("no backup in %s: run goahead with -backup first", baseDir)
+	}
+
+	rels := make([]string, 0, len(doc.Files))
+	for rel := range doc.Files {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	report := &RestoreReport{}
+	for _, rel := range rels {
+		if err := restoreFile(filepath.Join(baseDir, filepath.FromSlash(rel)), doc.Files[rel]); err != nil {
+			if errors.Is(err, ErrEnvironment) {
+				return report, err
+			}
+			report.Conflicts = append(report.Conflicts, rel+": "+err.Error())
+			continue
+		}
+		delete(doc.Files, rel)
+		report.Restored = append(report.Restored, rel)
+	}
+
+	if len(doc.Files) == 0 {
+		if err := os.Remove(path); err != nil {
+			return report, environmentErrorf("failed to remove %s: %v", path, err)
+		}
+		_ = os.Remove(filepath.Dir(path))
+	} else if err := artifact.Write(path, doc); err != nil {
+		return report, classify(err, ErrEnvironment)
+	}
+	if len(report.Conflicts) > 0 {
+		return report, fmt.Errorf("%d file(s) were edited where goahead wrote them and were left unchanged:\n    %s",
+			len(report.Conflicts), strings.Join(report.Conflicts, "\n    "))
+	}
+	return report, nil
+}
+
+// restoreFile reverts the recorded runs of filePath under its lock
+func restoreFile(filePath string, runs [][]BackupEdit) error {
+	unlock, err := lockFile(filePath, DefaultLockTTL)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read it: %v", err)
+	}
+	restored, err := revertEdits(string(content), runs)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filePath, []byte(restored))
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"go/build"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// buildMatcher decides, under -respect-build-tags, whether a consumer file
+// belongs to the target build: its //go:build lines and _GOOS/_GOARCH file
+// name suffixes must match GOOS, GOARCH and the build tags
+type buildMatcher struct {
+	context build.Context
+	// files are the files the compiler was given in toolexec mode; they
+	// match whatever their constraints say
+	files map[string]bool
+}
+
+// newBuildMatcher returns nil unless config.RespectBuildTags is set
+func newBuildMatcher(config Config) *buildMatcher {
+	if !config.RespectBuildTags {
+		return nil
+	}
+	context := build.Default
+	// The go command sets GOOS and GOARCH for the compiler it runs, so
+	// toolexec runs see the target here
+	if goos := os.Getenv("GOOS"); goos != "" {
+		context.GOOS = goos
+	}
+	if goarch := os.Getenv("GOARCH"); goarch != "" {
+		context.GOARCH = goarch
+	}
+	context.BuildTags = append(goflagsTags(os.Getenv("GOFLAGS")), config.BuildTags...)
+	m := &buildMatcher{context: context, files: make(map[string]bool)}
+	for _, file := range config.BuildFiles {
+		if abs, err := filepath.Abs(file); err == nil {
+			m.files[abs] = true
+		}
+	}
+	return m
+}
+
+// matches reports whether path is part of the target build. Files whose
+// constraints cannot be read are kept, so that their errors are reported.
+func (m *buildMatcher) matches(path string) bool {
+	if m == nil {
+		return true
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	if m.files[abs] {
+		return true
+	}
+	ok, err := m.context.MatchFile(filepath.Dir(abs), filepath.Base(abs))
+	return ok || err != nil
+}
+
+// target describes the build matched against, e.g. "linux/amd64 tags=integration"
+func (m *buildMatcher) target() string {
+	target := m.context.GOOS + "/" + m.context.GOARCH
+	if len(m.context.BuildTags) > 0 {
+		target += " tags=" + strings.Join(m.context.BuildTags, ",")
+	}
+	return target
+}
+
+// goflagsTags returns the -tags of a GOFLAGS value
+func goflagsTags(goflags string) []string {
+	var tags []string
+	for _, field := range strings.Fields(goflags) {
+		for _, prefix := range []string{"-tags=", "--tags="} {
+			if strings.HasPrefix(field, prefix) {
+				tags = append(tags, SplitBuildTags(strings.TrimPrefix(field, prefix))...)
+			}
+		}
+	}
+	return tags
+}
+
+// SplitBuildTags splits a -tags value: comma-separated, or space-separated
+// in the older form
+func SplitBuildTags(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+}
@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// majorVersionPattern matches the last element of a major-version import
+// path such as example.com/mod/v2, and the .vN suffix of gopkg.in paths
+var majorVersionPattern = regexp.MustCompile(`^v[0-9]+$|\.v[0-9]+$`)
+
+// CleanReport lists the files goahead clean removed the injected block of,
+// relative to the directory of the run
+type CleanReport struct {
+	Cleaned []string
+}
+
+// CleanInjected removes the injected blocks from the Go files under dir,
+// nested modules included, together with the imports that only the block
+// used. Markers and interfaces stay, so the next run injects the same code
+// again; files without a block are left alone, which makes a second clean a
+// no-op. Directories the go command ignores (hidden, _-prefixed, testdata)
+// and vendor are not entered.
+func CleanInjected(dir string) (*CleanReport, error) {
+	baseDir, err := filepath.Abs(StripLongPathPrefix(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", dir, err)
+	}
+	if info, err := os.Stat(baseDir); err != nil || !info.IsDir() {
+		return nil, environmentErrorf("%s is not a directory", baseDir)
+	}
+	report := &CleanReport{}
+	err = filepath.WalkDir(baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != baseDir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		rel, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			rel = path
+		}
+		cleaned, err := cleanFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot clean %s: %v", filepath.ToSlash(rel), err)
+		}
+		if cleaned {
+			report.Cleaned = append(report.Cleaned, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return report, err
+}
+
+// cleanFile removes the injected block of filePath under its lock and reports
+// whether the file had one
+func cleanFile(filePath string) (bool, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read it: %v", err)
+	}
+	if !strings.Contains(string(content), "goahead") {
+		return false, nil
+	}
+	unlock, err := lockFile(filePath, DefaultLockTTL)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	// Read again now that no run can be writing it
+	content, err = os.ReadFile(filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read it: %v", err)
+	}
+	bom, text := splitBOM(string(content))
+	cleaned, found, err := removeInjectedCode(strings.ReplaceAll(text, "\r\n", "\n"))
+	if err != nil || !found {
+		return false, err
+	}
+	return true, writeFileAtomic(filePath, []byte(bom+cleaned))
+}
+
+// removeInjectedCode returns content without its injected block and without
+// the imports that only the block referred to. found is false, and content
+// returned unchanged, when there is no block.
+func removeInjectedCode(content string) (string, bool, error) {
+	start, end, found, err := findInjectedBlock(content)
+	if err != nil || !found {
+		return content, false, err
+	}
+	block := content[start:end]
+	cleaned, err := removeInjectedBlock(content)
+	if err != nil {
+		return content, false, err
+	}
+	cleaned = strings.TrimRight(cleaned, "\n") + "\n"
+	return pruneBlockImports(cleaned, block), true, nil
+}
+
+// pruneBlockImports drops from content the imports that block, the injected
+// code removed from it, referred to and the rest of the file does not. Blank,
+// dot and cgo imports are kept, as is everything when either does not parse.
+func pruneBlockImports(content, block string) string {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if err != nil {
+		return content
+	}
+	injected, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+block, parser.SkipObjectResolution)
+	if err != nil {
+		return content
+	}
+	usedByBlock, usedByFile := qualifiers(injected), qualifiers(file)
+
+	lines := strings.Split(content, "\n")
+	drop := make(map[int]bool)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		kept := 0
+		for _, spec := range gen.Specs {
+			imp := spec.(*ast.ImportSpec)
+			line := fset.Position(imp.Pos()).Line - 1
+			if imp.Path.Value == `"C"` || !injectedImport(imp, usedByBlock, usedByFile) || fset.Position(imp.End()).Line-1 != line || line == fset.Position(gen.Pos()).Line-1 {
+				kept++
+				continue
+			}
+			drop[line] = true
+		}
+		if kept > 0 || !gen.Lparen.IsValid() {
+			continue
+		}
+		// A declaration left empty goes with the blank line above it, which
+		// a run adding it writes after the package clause
+		first, last := fset.Position(gen.Pos()).Line-1, fset.Position(gen.Rparen).Line-1
+		for i := first; i <= last; i++ {
+			drop[i] = true
+		}
+		if first > 0 && strings.TrimSpace(lines[first-1]) == "" {
+			drop[first-1] = true
+		}
+	}
+	if len(drop) == 0 {
+		return content
+	}
+	kept := lines[:0]
+	for i, line := range lines {
+		if !drop[i] {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// injectedImport reports whether imp is referred to by the injected code and
+// by nothing else of the file
+func injectedImport(imp *ast.ImportSpec, usedByBlock, usedByFile map[string]bool) bool {
+	path, err := strconv.Unquote(imp.Path.Value)
+	if err != nil {
+		return false
+	}
+	names := importCandidates(path)
+	if imp.Name != nil {
+		if imp.Name.Name == "_" || imp.Name.Name == "." {
+			return false
+		}
+		names = []string{imp.Name.Name}
+	}
+	inBlock := false
+	for _, name := range names {
+		if usedByFile[name] {
+			return false
+		}
+		inBlock = inBlock || usedByBlock[name]
+	}
+	return inBlock
+}
+
+// importCandidates returns the names a package imported from path without a
+// name may have: its last element, without a major version or go- prefix
+// and -go suffix
+func importCandidates(path string) []string {
+	elems := strings.Split(path, "/")
+	last := elems[len(elems)-1]
+	if len(elems) > 1 && majorVersionPattern.MatchString(last) && !strings.Contains(last, ".") {
+		last = elems[len(elems)-2]
+	}
+	last = majorVersionPattern.ReplaceAllString(last, "")
+	names := []string{last}
+	trimmed := strings.TrimSuffix(strings.TrimPrefix(last, "go-"), "-go")
+	if trimmed != last {
+		names = append(names, trimmed)
+	}
+	return names
+}
+
+// qualifiers returns the identifiers file uses as the X of selectors, which
+// include the package names it refers to
+func qualifiers(file *ast.File) map[string]bool {
+	used := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+	return used
+}
@@ -4,32 +4,78 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
+
+	"github.com/AeonDave/goahead/marker"
 )
 
 type CodeProcessor struct {
 	ctx      *ProcessorContext
 	executor *FunctionExecutor
+	// window maps the lines processLines reads to those of the file while a
+	// large file is streamed; nil when the file is read whole
+	window *lineWindow
+	// collected receives the calls of the markers read instead of
+	// evaluating them, see evaluateAhead; nothing is reported meanwhile
+	collected *[]BatchCall
 }
 
 type placeholder struct {
-	lineIndex int
-	funcName  string
-	argsStr   string
+	lineIndex    int
+	funcName     string
+	argsStr      string
+	inVarBlock   bool
+	marker       string
+	markerLine   int
+	markerColumn int
+	outputs      []marker.Output
+	traceID      string
+	// stacked is set for markers sharing their target line with others
+	stacked bool
+	// taken are the indexes of the literals of the target line that markers
+	// stacked above this one replace
+	taken []int
+	// pipeline are the calls after "|", each fed the result of the one before
+	pipeline []marker.Stage
+	// element is the composite literal element on the target line, filled
+	// field by field by helpers returning one value per field or a struct
+	element *compositeElement
+	// target is the variable named by a "> name" marker, whose declaration
+	// is the target line instead of the line below the marker
+	target string
 }
 
+// declaredTypePattern matches the type of a declaration, including generic
+// instantiations with several type arguments such as Pair[string, int]
+const declaredTypePattern = `[\w.\[\]*]+(?:,\s*[\w.\[\]*]+)*`
+
 var (
-	assignmentPattern      = regexp.MustCompile(`^\s*(var\s+\w+(\s+[\w.\[\]]+)?\s*=|[\w.,\s]+\s*:=|[\w.]+\s*=)\s*`)
-	assignmentSplitPattern = regexp.MustCompile(`^(\s*(?:var\s+\w+(?:\s+[\w.\[\]]+)?\s*=|[\w.,\s]+\s*:=|[\w.]+\s*=)\s*)(.*)$`)
-	stringLiteralPattern   = regexp.MustCompile(`"[^"]*"` + "|`[^`]*`")
-	numericZeroPattern     = regexp.MustCompile(`\b\d+\b`)
-	floatZeroPattern       = regexp.MustCompile(`\b\d+\.\d+\b`)
-	boolFalsePattern       = regexp.MustCompile(`\b(?:true|false)\b`)
-	errNoReplacement       = errors.New("no replacement performed")
+	// Declarations without an initializer: "var name Type" or "name Type" inside a var block
+	uninitializedVarPattern   = regexp.MustCompile(`^(\s*)var\s+(\w+)(\s+)(` + declaredTypePattern + `)\s*(//.*)?$`)
+	uninitializedBlockPattern = regexp.MustCompile(`^(\s*)(\w+)(\s+)(` + declaredTypePattern + `)\s*(//.*)?$`)
+	// Declarations of several names without an initializer: "var x, y Type"
+	uninitializedNamesPattern = regexp.MustCompile(`^\s*(var\s+)?(\w+(?:\s*,\s*\w+)+)\s+` + declaredTypePattern + `\s*(//.*)?$`)
+	errNoReplacement          = errors.New("no replacement performed")
+	varBlockEntryPattern      = regexp.MustCompile(`^\s*(\w+)\b`)
+	// errFunctionNotFound is wrapped by errors for markers naming an unknown helper
+	errFunctionNotFound = errors.New("not found")
+	// errNotInlinable is wrapped by errors for helpers whose result cannot be
+	// written as a literal
+	errNotInlinable = errors.New("which cannot be inlined")
+	// errOverlappingMarkers is wrapped by errors for stacked markers that
+	// would replace the same literal
+	errOverlappingMarkers = errors.New("overlapping markers")
+	// errNoTarget is wrapped by errors for "> name" markers whose variable
+	// has no declaration
+	errNoTarget = errors.New("no target")
 )
 
 func NewCodeProcessor(ctx *ProcessorContext, executor *FunctionExecutor) *CodeProcessor {
@@ -39,34 +85,45 @@ func NewCodeProcessor(ctx *ProcessorContext, executor *FunctionExecutor) *CodePr
 	}
 }
 
+// ProcessFile replaces the literals below the placeholder markers of
+// filePath; files that SkipReason names are left alone
 func (cp *CodeProcessor) ProcessFile(filePath string, verbose bool) error {
-	file, err := os.Open(filePath)
+	if reason := cp.ctx.SkipReason(filePath); reason != "" {
+		cp.ctx.Logger().Logf(LogFilter, "[goahead] Not replacing values in %s: %s", cp.ctx.relToRoot(filePath), reason)
+		return nil
+	}
+	content, err := cp.ctx.readSource(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to open file %s: %v", filePath, err)
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-		}
-	}(file)
+	// Lines are matched without a byte order mark; it is put back on write
+	bom, text := splitBOM(string(content))
 
-	lines, modified, err := cp.processLines(file, filePath, verbose)
+	lines, modified, err := cp.processLines(strings.NewReader(text), filePath, verbose)
 	if err != nil {
 		return err
 	}
 
+	if cp.ctx.Config.Companion {
+		if cp.collected != nil {
+			return nil
+		}
+		return cp.writeCompanion(filePath, text, lines)
+	}
 	if modified {
-		return cp.writeFile(filePath, lines)
+		return cp.writeFile(filePath, bom, lines)
 	}
 	return nil
 }
 
 // processLines elabora tutte le righe di un file
-func (cp *CodeProcessor) processLines(file *os.File, filePath string, verbose bool) ([]string, bool, error) {
+func (cp *CodeProcessor) processLines(file io.Reader, filePath string, verbose bool) ([]string, bool, error) {
 	var lines []string
 	scanner := bufio.NewScanner(file)
 	modified := false
 	var placeholders []placeholder
+	// targeted are the "> name" markers, resolved once every line is read
+	var targeted []placeholder
 
 	sourceDir := filepath.Dir(filePath)
 	absSourceDir, err := filepath.Abs(sourceDir)
@@ -74,29 +131,65 @@ func (cp *CodeProcessor) processLines(file *os.File, filePath string, verbose bo
 		absSourceDir = sourceDir
 	}
 
-	commentPattern := regexp.MustCompile(CommentPattern)
-	injectPattern := regexp.MustCompile(InjectPattern)
+	inVarBlock := false
 
 Outer:
 	for scanner.Scan() {
 		line := scanner.Text()
+		if state, ok := cp.window.varBlockAt(len(lines)); ok {
+			inVarBlock = state
+		}
+		inVarBlock = trackVarBlock(line, inVarBlock)
 
-		if injectPattern.MatchString(line) {
+		// Other argument errors are reported by the executor, which parses
+		// RawArgs again; malformed expressions never reach a program
+		m, parseErr := cp.ctx.MarkerSyntax().Parse(line)
+		if m != nil && m.NewerLevel > 0 {
+			cp.warnNewerSyntax(filePath, cp.fileLine(len(lines)), m)
+		}
+		if m != nil && m.Kind != marker.KindPlaceholder {
+			lines = append(lines, line)
+			continue
+		}
+		var argErr *marker.ArgumentError
+		if errors.As(parseErr, &argErr) {
 			lines = append(lines, line)
+			cp.recordSkipped(filePath, placeholder{
+				funcName:     m.Func,
+				marker:       strings.TrimSpace(line),
+				markerLine:   cp.fileLine(len(lines) - 1),
+				markerColumn: strings.Index(line, "//") + 1,
+			}, parseErr, fmt.Sprintf("%s:%d: %v", cp.ctx.relToRoot(filePath), cp.fileLine(len(lines)-1), parseErr))
 			continue
 		}
 
-		if commentMatch := commentPattern.FindStringSubmatch(line); commentMatch != nil {
-			funcName := strings.TrimSpace(commentMatch[1])
-			argsStr := ""
-			if len(commentMatch) > 2 && commentMatch[2] != "" {
-				argsStr = strings.TrimSpace(commentMatch[2])
+		if m != nil && m.Target != "" {
+			lines = append(lines, line)
+			if ph, ok := cp.targetedMarker(filePath, m, parseErr, line, len(lines)-1); ok {
+				targeted = append(targeted, ph)
 			}
+			continue
+		}
 
+		if m != nil {
 			lines = append(lines, line)
+			current := placeholder{
+				funcName:     m.Func,
+				argsStr:      m.RawArgs,
+				marker:       strings.TrimSpace(line),
+				markerLine:   cp.fileLine(len(lines) - 1),
+				markerColumn: strings.Index(line, "//") + 1,
+				outputs:      m.Outputs,
+				pipeline:     m.Pipeline,
+			}
+			below := marker.UsesBelow(current.argsStr)
+			// Markers stacked directly above one another share the target
+			// line below the last of them
+			var stacked []placeholder
 
 			for {
 				if !scanner.Scan() {
+					cp.skipNoTarget(filePath, append(stacked, current))
 					break Outer
 				}
 				nextLine := scanner.Text()
@@ -104,12 +197,68 @@ Outer:
 					lines = append(lines, nextLine)
 					continue
 				}
+				if below {
+					// The block comment stays in the source; the literal
+					// follows it
+					below = false
+					body, err := readBlockArgument(scanner, &lines, nextLine)
+					if err == nil {
+						current.argsStr, err = marker.SubstituteBelow(current.argsStr, body)
+					}
+					if err != nil {
+						// Markers stacked above this one keep the line as
+						// their target, the block comment they lack being
+						// this marker's
+						if errors.Is(err, errNoBlockArgument) {
+							lines = append(lines, nextLine)
+							placeholders = append(placeholders, targetLine(stacked, len(lines)-1, inVarBlock)...)
+							inVarBlock = trackVarBlock(nextLine, inVarBlock)
+						} else {
+							cp.skipNoTarget(filePath, stacked)
+						}
+						cp.recordSkipped(filePath, current, err, fmt.Sprintf("%s:%d: %v", cp.ctx.relToRoot(filePath), current.markerLine, err))
+						continue Outer
+					}
+					continue
+				}
+				if next, err := cp.ctx.MarkerSyntax().Parse(nextLine); next != nil && next.Kind == marker.KindPlaceholder {
+					lines = append(lines, nextLine)
+					if next.NewerLevel > 0 {
+						cp.warnNewerSyntax(filePath, cp.fileLine(len(lines)-1), next)
+					}
+					// A "> name" marker does not take the line below it,
+					// which stays the target of the markers above
+					if next.Target != "" {
+						if ph, ok := cp.targetedMarker(filePath, next, err, nextLine, len(lines)-1); ok {
+							targeted = append(targeted, ph)
+						}
+						continue
+					}
+					if errors.As(err, &argErr) {
+						cp.recordSkipped(filePath, placeholder{
+							funcName:     next.Func,
+							marker:       strings.TrimSpace(nextLine),
+							markerLine:   cp.fileLine(len(lines) - 1),
+							markerColumn: strings.Index(nextLine, "//") + 1,
+						}, err, fmt.Sprintf("%s:%d: %v", cp.ctx.relToRoot(filePath), cp.fileLine(len(lines)-1), err))
+						continue
+					}
+					stacked = append(stacked, current)
+					current = placeholder{
+						funcName:     next.Func,
+						argsStr:      next.RawArgs,
+						marker:       strings.TrimSpace(nextLine),
+						markerLine:   cp.fileLine(len(lines) - 1),
+						markerColumn: strings.Index(nextLine, "//") + 1,
+						outputs:      next.Outputs,
+						pipeline:     next.Pipeline,
+					}
+					below = marker.UsesBelow(current.argsStr)
+					continue
+				}
 				lines = append(lines, nextLine)
-				placeholders = append(placeholders, placeholder{
-					lineIndex: len(lines) - 1,
-					funcName:  funcName,
-					argsStr:   argsStr,
-				})
+				placeholders = append(placeholders, targetLine(append(stacked, current), len(lines)-1, inVarBlock)...)
+				inVarBlock = trackVarBlock(nextLine, inVarBlock)
 				break
 			}
 			continue
@@ -122,59 +271,797 @@ Outer:
 		return nil, false, fmt.Errorf("error reading file %s: %v", filePath, err)
 	}
 
+	placeholders = cp.resolveTargets(filePath, lines, placeholders, targeted)
+	placeholders = cp.interpolateVariables(filePath, placeholders)
+	if cp.ctx.Config.Companion {
+		placeholders = cp.companionTargets(filePath, lines, placeholders)
+	}
 	if len(placeholders) == 0 {
 		return lines, modified, nil
 	}
 
+	tags := newLineTags(cp.ctx.Tags(), cp.ctx.Config.TagReplacements)
 	calls := make([]BatchCall, len(placeholders))
 	for i, ph := range placeholders {
-		calls[i] = BatchCall{FuncName: ph.funcName, ArgsStr: ph.argsStr}
+		calls[i] = BatchCall{FuncName: ph.funcName, ArgsStr: ph.argsStr, Location: cp.markerLocation(filePath, ph), Outputs: ph.outputs}
+		if !ph.stacked && len(ph.outputs) == 0 {
+			line := tags.strip(lines[ph.lineIndex])
+			element := parseMultiAssignment(line)
+			if element == nil {
+				element = parseElement(line)
+			}
+			if element != nil {
+				placeholders[i].element = element
+				calls[i].Fields, calls[i].Assignment = element.keys(), element.assignment
+			}
+		}
 	}
-	results := cp.executor.ExecuteBatch(calls, absSourceDir)
+	if cp.collected != nil {
+		*cp.collected = append(*cp.collected, firstCalls(placeholders, calls)...)
+		return lines, false, nil
+	}
+	cp.ctx.Stats.add(func(s *RunStats) { s.Markers += len(placeholders) })
+	results := cp.evaluatePipelines(placeholders, calls, absSourceDir)
+	// Results of killed programs are not skipped markers; leave the file as is
+	if cp.ctx.interrupted() {
+		return nil, false, ErrInterrupted
+	}
+	// No marker of the run can be evaluated without the go toolchain
+	for _, result := range results {
+		if errors.Is(result.Err, ErrEnvironment) {
+			return nil, false, result.Err
+		}
+	}
+	overlaps := cp.checkStackedMarkers(filePath, lines, placeholders, results)
+	sinkImports := make(map[string]bool)
+	var syntax targetSyntax
 
 	for i, ph := range placeholders {
 		result := results[i]
+		ph.traceID = result.TraceID
 		originalLine := lines[ph.lineIndex]
+		if result.Err != nil && isOutputMismatch(result.Err) {
+			result.Err = fmt.Errorf("%s: %w", cp.markerLocation(filePath, ph), result.Err)
+		}
 		if result.Err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Warning: Could not execute function '%s' in %s: %v\n", ph.funcName, filePath, result.Err)
+			cp.recordSkipped(filePath, ph, result.Err,
+				fmt.Sprintf("Could not execute function '%s' in %s: %v", ph.funcName, cp.ctx.Config.shownPath(filePath), result.Err))
+			continue
+		}
+		if result.Result == SkipResult && len(ph.outputs) == 0 {
+			// The helper declined: the target keeps whatever it holds,
+			// including a sink reference written by an earlier run
+			if cp.ctx.ConstSink != nil {
+				cp.ctx.ConstSink.keep(sinkReferencePattern.FindString(tags.strip(originalLine)))
+			}
+			cp.ctx.events().markerEvaluated(MarkerEvent{
+				File: filePath, Line: cp.fileLine(ph.lineIndex), Helper: ph.funcName, Args: ph.argsStr,
+				Duration: result.Duration, Cached: result.Cached, Declined: true, Func: result.UserFunc,
+			})
+			continue
+		}
+
+		if err := cp.checkValueSizes(ph, result); err != nil {
+			cp.recordSkipped(filePath, ph, err,
+				fmt.Sprintf("Could not use the result of '%s' in %s: %v", ph.funcName, filePath, err))
+			continue
+		}
+		if err := overlaps[i]; err != nil {
+			cp.recordSkipped(filePath, ph, err, fmt.Sprintf("%s: %v", cp.markerLocation(filePath, ph), err))
+			continue
+		}
+
+		if len(ph.outputs) > 0 {
+			replaced, err := cp.replaceOutputs(lines, tags, filePath, ph, result)
+			if err != nil {
+				cp.recordSkipped(filePath, ph, err,
+					fmt.Sprintf("Could not assign results of '%s': %v", ph.funcName, err))
+				continue
+			}
+			if replaced {
+				modified = true
+			}
+			continue
+		}
+		if ph.element != nil && len(result.Values) > 0 {
+			replaced, err := cp.replaceElement(lines, tags, filePath, ph, result)
+			if err != nil {
+				cp.recordSkipped(filePath, ph, err,
+					fmt.Sprintf("Could not fill the %s for '%s': %v", ph.element.noun(), ph.funcName, err))
+				continue
+			}
+			if replaced {
+				modified = true
+			}
 			continue
 		}
 
 		typeHint := cp.typeHintForFunc(result.UserFunc, result.Result)
 		formattedResult := formatResultForReplacement(result.Result, typeHint)
-		leadingWhitespace, _ := splitLeadingWhitespace(originalLine)
-		newLine, replaced, buildErr := cp.buildReplacementLine(originalLine, leadingWhitespace, ph.funcName, ph.argsStr, formattedResult, typeHint)
-		if buildErr != nil {
-			if errors.Is(buildErr, errNoReplacement) {
-				_, _ = fmt.Fprintf(os.Stderr, "Warning: Could not replace function call for '%s' in line: %s\n", ph.funcName, strings.TrimSpace(originalLine))
+		code := tags.strip(originalLine)
+		importSpec := ""
+		if cp.ctx.ConstSink != nil && !ph.stacked && sinkKind(typeHint) {
+			ref, spec, err := cp.ctx.ConstSink.Reference(filePath, formattedResult)
+			if err != nil {
+				cp.recordSkipped(filePath, ph, err, fmt.Sprintf("%s: %v", cp.markerLocation(filePath, ph), err))
+				continue
 			}
+			formattedResult, importSpec = ref, spec
+		}
+		leadingWhitespace, _ := splitLeadingWhitespace(code)
+		var (
+			newLine  string
+			replaced bool
+			buildErr error
+			// value holds the lines replacing the span lines of a value
+			// that continues below the target line
+			value []string
+			span  int
+		)
+		// A sink reference written by an earlier run is the literal to update
+		sinkRef := sinkReferencePattern.FindStringIndex(code)
+		if cp.ctx.ConstSink != nil && sinkRef != nil {
+			newLine, replaced = code[:sinkRef[0]]+formattedResult+code[sinkRef[1]:], true
+		} else if initialized, ok, err := completeDeclaration(code, ph.inVarBlock, formattedResult, result.UserFunc); ok || err != nil {
+			newLine, replaced, buildErr = initialized, true, err
+		} else if value, span, buildErr = cp.replaceContinuedValue(&syntax, lines, ph.lineIndex, code, formattedResult, typeHint, ph.taken); value != nil || buildErr != nil {
+			newLine = strings.Join(value, "\n")
+			replaced = newLine != strings.Join(append([]string{code}, lines[ph.lineIndex+1:ph.lineIndex+span]...), "\n")
+		} else {
+			newLine, replaced, buildErr = cp.buildReplacementLine(code, leadingWhitespace, ph.funcName, ph.argsStr, formattedResult, typeHint, ph.taken)
+		}
+		if errors.Is(buildErr, errNoTarget) {
+			cp.recordSkipped(filePath, ph, buildErr, fmt.Sprintf("%s: %s", cp.markerLocation(filePath, ph),
+				strings.TrimPrefix(buildErr.Error(), errNoTarget.Error()+": ")))
+			continue
+		}
+		if buildErr != nil {
+			cp.recordSkipped(filePath, ph, buildErr,
+				fmt.Sprintf("Could not replace function call for '%s' in line: %s", ph.funcName, strings.TrimSpace(originalLine)))
+			continue
+		}
+		if err := checkTargetRange(newLine, formattedResult); err != nil {
+			cp.recordSkipped(filePath, ph, err, fmt.Sprintf("%s: %v", cp.markerLocation(filePath, ph), err))
 			continue
 		}
+		// Some paths report a replacement even when the literal already
+		// holds the value; an identical line is not a change
+		if value == nil && newLine == code {
+			replaced = false
+		}
 
-		lines[ph.lineIndex] = newLine
+		tags.take(lines, ph.lineIndex)
+		if value != nil {
+			lines = cp.spliceValue(filePath, lines, tags, placeholders[i+1:], ph.lineIndex, span, value)
+		} else {
+			lines[ph.lineIndex] = newLine
+		}
+		if importSpec != "" {
+			sinkImports[importSpec] = true
+		}
+		tags.add(ph.lineIndex, tags.format.Tag(ph.funcName, ph.argsStr, cp.ctx.Config.Redact))
 		if replaced {
 			modified = true
 		}
+		cp.checkConversion(filePath, ph, newLine, formattedResult, result.UserFunc)
+		// Value replacement runs after injection and moves only the lines
+		// below a value it rewrites, so this index is already the final
+		// line of the literal
+		cp.ctx.Annotations.Record(filePath, cp.fileLine(ph.lineIndex), ph.funcName, result.UserFunc, ph.argsStr, result.TraceID)
 
 		if replaced {
-			helperInfo := ""
-			if result.UserFunc != nil {
-				relPath, _ := filepath.Rel(cp.ctx.RootDir, result.UserFunc.FilePath)
-				if relPath == "" {
-					relPath = result.UserFunc.FilePath
+			cp.ctx.Stats.add(func(s *RunStats) { s.Replaced++ })
+		}
+		cp.ctx.events().markerEvaluated(MarkerEvent{
+			File: filePath, Line: cp.fileLine(ph.lineIndex), Helper: ph.funcName, Args: ph.argsStr, Result: result.Result,
+			Duration: result.Duration, Cached: result.Cached, Replaced: replaced, Func: result.UserFunc,
+		})
+	}
+	// A line whose literal is current may still gain, lose or update its tag
+	if tags.apply(lines) {
+		modified = true
+	}
+	if len(sinkImports) > 0 {
+		specs := make([]string, 0, len(sinkImports))
+		for spec := range sinkImports {
+			specs = append(specs, spec)
+		}
+		sort.Strings(specs)
+		updated := sortImportBlocks(strings.Split(NewInjector(cp.ctx).insertImportsAndDeps(lines, specs, nil), "\n"))
+		// Imports go above every marker target, moving them all down
+		if delta := len(updated) - len(lines); delta != 0 {
+			cp.ctx.Annotations.shift(filePath, 0, delta)
+			lines, modified = updated, true
+		}
+	}
+
+	return lines, modified, nil
+}
+
+// replaceContinuedValue replaces the value assigned on lines[index], code
+// once its tags are removed, when that value continues on the lines below,
+// as a composite literal or a call written over several lines does. The
+// literal is found in the syntax of the whole file rather than in the line.
+// It returns the lines replacing the span lines of the value, the first of
+// them the new target line, or nil for a value on one line.
+func (cp *CodeProcessor) replaceContinuedValue(syntax *targetSyntax, lines []string, index int, code, formattedResult, typeHint string, taken []int) ([]string, int, error) {
+	if cp.window != nil || !continuesBelow(code) {
+		return nil, 0, nil
+	}
+	source := lines
+	if code != lines[index] {
+		source = slices.Clone(lines)
+		source[index] = code
+	}
+	if !syntax.parse(source) {
+		return nil, 0, nil
+	}
+	expr := syntax.valueAt(index + 1)
+	if expr == nil {
+		return nil, 0, nil
+	}
+	last := syntax.fset.Position(expr.End()).Line
+	if last == index+1 {
+		return nil, 0, nil
+	}
+	start, end, text, err := continuedReplacement(syntax.src, expr, formattedResult, typeHint, taken)
+	if err != nil {
+		return nil, 0, err
+	}
+	first, through := syntax.lineRange(index+1, last)
+	rewritten := syntax.src[first:start] + text + syntax.src[end:through]
+	return strings.Split(rewritten, "\n"), last - index, nil
+}
+
+// spliceValue writes value over the span lines of lines from index and
+// moves down what refers to the lines below: the placeholders still to be
+// replaced, the tags and the annotations of filePath
+func (cp *CodeProcessor) spliceValue(filePath string, lines []string, tags *lineTags, pending []placeholder, index, span int, value []string) []string {
+	lines = slices.Replace(lines, index, index+span, value...)
+	delta := len(value) - span
+	if delta == 0 {
+		return lines
+	}
+	for j := range pending {
+		if pending[j].lineIndex >= index+span {
+			pending[j].lineIndex += delta
+		}
+	}
+	tags.splice(index, span, len(value))
+	cp.ctx.Annotations.shift(filePath, cp.fileLine(index+span), delta)
+	return lines
+}
+
+// redact hides s under -redact
+func (cp *CodeProcessor) redact(s string) string {
+	if cp.ctx.Config.Redact && s != "" {
+		return Redacted
+	}
+	return s
+}
+
+// interpolateVariables substitutes the ${name} references of every
+// placeholder's arguments; placeholders naming undefined variables are skipped
+func (cp *CodeProcessor) interpolateVariables(filePath string, placeholders []placeholder) []placeholder {
+	kept := placeholders[:0]
+Placeholders:
+	for _, ph := range placeholders {
+		args, err := cp.ctx.Variables.Interpolate(ph.argsStr)
+		if err != nil {
+			cp.recordSkipped(filePath, ph, err, fmt.Sprintf("%s: %v", cp.markerLocation(filePath, ph), err))
+			continue
+		}
+		ph.argsStr = args
+		if len(ph.pipeline) > 0 {
+			ph.pipeline = append([]marker.Stage(nil), ph.pipeline...)
+			for i := range ph.pipeline {
+				args, err := cp.ctx.Variables.Interpolate(ph.pipeline[i].RawArgs)
+				if err != nil {
+					cp.recordSkipped(filePath, ph, err, fmt.Sprintf("%s: %v", cp.markerLocation(filePath, ph), err))
+					continue Placeholders
 				}
-				helperInfo = fmt.Sprintf(" (from %s, depth %d)", relPath, result.UserFunc.Depth)
+				ph.pipeline[i].RawArgs = args
 			}
-			_, _ = fmt.Fprintf(os.Stderr, "[goahead] Replaced in %s: %s(%s) -> %s%s\n", filePath, ph.funcName, ph.argsStr, result.Result, helperInfo)
-		} else if verbose {
-			_, _ = fmt.Fprintf(os.Stderr, "[goahead] Unchanged in %s: %s(%s) = %s\n", filePath, ph.funcName, ph.argsStr, result.Result)
 		}
+		kept = append(kept, ph)
 	}
+	return kept
+}
 
-	return lines, modified, nil
+// evaluatePipelines evaluates calls, one per placeholder, and then the later
+// calls of pipeline markers, each with the result of the call before as its
+// first argument. Only the last call of a pipeline feeds several variables
+// or an element's fields.
+func (cp *CodeProcessor) evaluatePipelines(placeholders []placeholder, calls []BatchCall, sourceDir string) []BatchResult {
+	results := cp.execute(firstCalls(placeholders, calls), sourceDir)
+	for stage := 0; ; stage++ {
+		var next []BatchCall
+		var index []int
+		for i, ph := range placeholders {
+			if stage >= len(ph.pipeline) || results[i].Err != nil || results[i].Result == SkipResult {
+				continue
+			}
+			s := ph.pipeline[stage]
+			call := BatchCall{FuncName: s.Func, ArgsStr: results[i].Result, Location: calls[i].Location}
+			if s.RawArgs != "" {
+				call.ArgsStr += ":" + s.RawArgs
+			}
+			if stage == len(ph.pipeline)-1 {
+				call.Outputs, call.Fields = calls[i].Outputs, calls[i].Fields
+			}
+			next, index = append(next, call), append(index, i)
+		}
+		if len(next) == 0 || cp.ctx.interrupted() {
+			return results
+		}
+		for j, result := range cp.execute(next, sourceDir) {
+			result.Duration += results[index[j]].Duration
+			result.Cached = result.Cached && results[index[j]].Cached
+			results[index[j]] = result
+		}
+	}
+}
+
+// firstCalls returns the calls evaluated first for placeholders: those of
+// pipeline markers feed the next call a single value
+func firstCalls(placeholders []placeholder, calls []BatchCall) []BatchCall {
+	first := make([]BatchCall, len(calls))
+	for i, call := range calls {
+		if len(placeholders[i].pipeline) > 0 {
+			call.Outputs, call.Fields = nil, nil
+		}
+		first[i] = call
+	}
+	return first
+}
+
+// execute evaluates calls, in parallel under -jobs
+func (cp *CodeProcessor) execute(calls []BatchCall, sourceDir string) []BatchResult {
+	if jobs := cp.ctx.Config.Jobs; jobs > 0 {
+		return cp.executor.ExecuteAll(calls, sourceDir, jobs)
+	}
+	return cp.executor.ExecuteBatch(calls, sourceDir)
+}
+
+// checkConversion warns when the replaced literal sits in a conversion such
+// as int32(8080) to a type other than the helper's result type. The
+// conversion is kept; only the literal inside it is ever replaced.
+func (cp *CodeProcessor) checkConversion(filePath string, ph placeholder, line, value string, userFunc *UserFunction) {
+	if userFunc == nil || userFunc.OutputType == "" {
+		return
+	}
+	target := conversionTarget(line, value)
+	if target == "" || target == userFunc.OutputType {
+		return
+	}
+	cp.ctx.Warn(Diagnostic{
+		Rule:    RuleConversionMismatch,
+		File:    filePath,
+		Line:    cp.fileLine(ph.lineIndex),
+		Message: fmt.Sprintf("%s:%d: %s returns %s but its value is converted to %s", cp.ctx.relToRoot(filePath), cp.fileLine(ph.lineIndex), userFunc.Name, userFunc.OutputType, target),
+	})
+}
+
+// conversionPattern captures the type and the operand of a conversion; the
+// operand may hold quoted literals but no parentheses outside them
+var conversionPattern = regexp.MustCompile(`(?:^|[^\w.])(u?int(?:8|16|32|64)?|uintptr|float(?:32|64)|complex(?:64|128)|byte|rune|string|bool|time\.Duration)\(\s*((?:"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|` + "`[^`]*`" + `|[^()"'` + "`" + `])*?)\s*\)`)
+
+// conversionTarget returns T when value is the whole operand of a conversion
+// T(value) in line. Only predeclared types and time.Duration are recognized,
+// since other names followed by parentheses may be function calls.
+func conversionTarget(line, value string) string {
+	for _, m := range conversionPattern.FindAllStringSubmatch(line, -1) {
+		if m[2] == value {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// checkValueSizes enforces Config.MaxLiteralSize on every value of result
+func (cp *CodeProcessor) checkValueSizes(ph placeholder, result BatchResult) error {
+	if len(result.Values) == 0 {
+		return checkSize("value of "+ph.funcName, result.Result, cp.ctx.Config.MaxLiteralSize, DefaultMaxLiteralSize, "-max-literal-size")
+	}
+	for i, value := range result.Values {
+		name := fmt.Sprintf("field %d", i+1)
+		if i < len(ph.outputs) {
+			name = ph.outputs[i].Var
+		} else if ph.element != nil && i < len(ph.element.fields) {
+			name = ph.element.fields[i].name(i)
+		}
+		if err := checkSize(fmt.Sprintf("value of %s for %s", ph.funcName, name), value,
+			cp.ctx.Config.MaxLiteralSize, DefaultMaxLiteralSize, "-max-literal-size"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceOutputs assigns the values of a multi-output marker to the named
+// variables of the var block that follows it. Nothing is changed unless
+// every variable can be assigned.
+func (cp *CodeProcessor) replaceOutputs(lines []string, tags *lineTags, filePath string, ph placeholder, result BatchResult) (bool, error) {
+	location := cp.markerLocation(filePath, ph)
+	trimmed := strings.TrimSpace(lines[ph.lineIndex])
+	if !strings.HasPrefix(trimmed, "var (") && trimmed != "var(" {
+		return false, outputMismatchf("%s: marker with outputs must be followed by a var ( block", location)
+	}
+
+	// Index the block's entries by variable name
+	entries := make(map[string]int)
+	for i := ph.lineIndex + 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == ")" {
+			break
+		}
+		if m := varBlockEntryPattern.FindStringSubmatch(lines[i]); m != nil {
+			if _, seen := entries[m[1]]; !seen {
+				entries[m[1]] = i
+			}
+		}
+	}
+
+	results := resultTypes(result.UserFunc)
+	newLines := make(map[int]string, len(ph.outputs))
+	for i, out := range ph.outputs {
+		index, ok := entries[out.Var]
+		if !ok {
+			return false, outputMismatchf("%s: variable %s not found in the var block", location, out.Var)
+		}
+
+		value := result.Values[i]
+		typeHint := inferResultKind(value)
+		if len(results) == len(ph.outputs) {
+			if hint := mapOutputType(results[i]); hint != "other" {
+				typeHint = hint
+			}
+		}
+		line := tags.strip(lines[index])
+		if literal := literalKind(line); !kindsCompatible(literal, typeHint) {
+			return false, outputMismatchf("%s: variable %s holds a %s literal but %s returns %s %s",
+				location, out.Var, literal, ph.funcName, typeHint, value)
+		}
+
+		formatted := formatResultForReplacement(value, typeHint)
+		newLine, ok, err := completeDeclaration(line, true, formatted, nil)
+		if err != nil {
+			return false, fmt.Errorf("%s: variable %s: %w", location, out.Var, err)
+		}
+		if !ok {
+			leadingWhitespace, _ := splitLeadingWhitespace(line)
+			var err error
+			if newLine, _, err = cp.buildReplacementLine(line, leadingWhitespace, ph.funcName, ph.argsStr, formatted, typeHint, nil); err != nil {
+				return false, fmt.Errorf("%s: variable %s: %w", location, out.Var, err)
+			}
+		}
+		if err := checkTargetRange(newLine, formatted); err != nil {
+			return false, fmt.Errorf("%s: variable %s: %w", location, out.Var, err)
+		}
+		newLines[index] = newLine
+	}
+
+	replaced := false
+	for i, out := range ph.outputs {
+		index := entries[out.Var]
+		cp.ctx.Annotations.Record(filePath, cp.fileLine(index), ph.funcName, result.UserFunc, ph.argsStr, result.TraceID)
+		tags.add(index, tags.format.Tag(ph.funcName, ph.argsStr, cp.ctx.Config.Redact))
+		event := MarkerEvent{
+			File: filePath, Line: cp.fileLine(index), Helper: ph.funcName, Args: ph.argsStr, Output: out.Var, Result: result.Values[i],
+			Duration: result.Duration, Cached: result.Cached, Func: result.UserFunc,
+		}
+		if newLines[index] != tags.take(lines, index) {
+			lines[index] = newLines[index]
+			replaced, event.Replaced = true, true
+			cp.ctx.Stats.add(func(s *RunStats) { s.Replaced++ })
+		}
+		cp.ctx.events().markerEvaluated(event)
+	}
+	return replaced, nil
+}
+
+// replaceElement writes the values of a marker filling a composite literal
+// element into its fields, keeping keys, braces and the trailing comma.
+// Nothing is changed unless every field can be assigned.
+func (cp *CodeProcessor) replaceElement(lines []string, tags *lineTags, filePath string, ph placeholder, result BatchResult) (bool, error) {
+	location := cp.markerLocation(filePath, ph)
+	fields := ph.element.fields
+	results := resultTypes(result.UserFunc)
+	line := tags.strip(lines[ph.lineIndex])
+	// Right to left, so that the offsets of the fields before stay valid
+	for i := len(fields) - 1; i >= 0; i-- {
+		field, value := fields[i], result.Values[i]
+		typeHint := inferResultKind(value)
+		if len(results) == len(fields) {
+			if hint := mapOutputType(results[i]); hint != "other" {
+				typeHint = hint
+			}
+		}
+		if field.kind == "" {
+			return false, outputMismatchf("%s: %s of the %s holds no literal", location, field.describe(i), ph.element.noun())
+		}
+		if !kindsCompatible(field.kind, typeHint) {
+			return false, outputMismatchf("%s: %s holds a %s literal but %s returns %s %s",
+				location, field.describe(i), field.kind, ph.funcName, typeHint, value)
+		}
+		line = line[:field.start] + formatResultForReplacement(value, typeHint) + line[field.end:]
+	}
+
+	replaced := line != tags.take(lines, ph.lineIndex)
+	lines[ph.lineIndex] = line
+	tags.add(ph.lineIndex, tags.format.Tag(ph.funcName, ph.argsStr, cp.ctx.Config.Redact))
+	cp.ctx.Annotations.Record(filePath, cp.fileLine(ph.lineIndex), ph.funcName, result.UserFunc, ph.argsStr, result.TraceID)
+	if replaced {
+		cp.ctx.Stats.add(func(s *RunStats) { s.Replaced++ })
+	}
+	for i, field := range fields {
+		cp.ctx.events().markerEvaluated(MarkerEvent{
+			File: filePath, Line: cp.fileLine(ph.lineIndex), Helper: ph.funcName, Args: ph.argsStr, Output: field.name(i), Result: result.Values[i],
+			Duration: result.Duration, Cached: result.Cached, Replaced: replaced, Func: result.UserFunc,
+		})
+	}
+	return replaced, nil
+}
+
+// outputMismatchError reports multi-output marker variables that do not match
+// the var block or the helper's results
+type outputMismatchError struct {
+	msg string
+}
+
+func (e *outputMismatchError) Error() string { return e.msg }
+
+func outputMismatchf(format string, args ...any) error {
+	return &outputMismatchError{msg: fmt.Sprintf(format, args...)}
+}
+
+func isOutputMismatch(err error) bool {
+	var target *outputMismatchError
+	return errors.As(err, &target)
+}
+
+// fileLine returns the line number in the file of lines[index]
+func (cp *CodeProcessor) fileLine(index int) int {
+	if cp.window != nil && index < len(cp.window.lines) {
+		return cp.window.lines[index]
+	}
+	return index + 1
+}
+
+func (cp *CodeProcessor) markerLocation(filePath string, ph placeholder) string {
+	return fmt.Sprintf("%s:%d", cp.ctx.relToRoot(filePath), ph.markerLine)
+}
+
+// literalKind classifies the literal currently assigned on a var block line;
+// declarations without an initializer and non-literal expressions are "other"
+func literalKind(line string) string {
+	_, value, _, ok := splitAssignment(line)
+	if !ok {
+		return "other"
+	}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "`") && strings.HasSuffix(value, "`") {
+		return "string"
+	}
+	return inferResultKind(value)
+}
+
+// kindsCompatible reports whether a value of kind value may replace a
+// literal of kind literal; numeric kinds are interchangeable
+func kindsCompatible(literal, value string) bool {
+	numeric := func(kind string) bool { return kind == "int" || kind == "uint" || kind == "float" }
+	switch {
+	case literal == "other" || value == "other" || literal == value:
+		return true
+	default:
+		return numeric(literal) && numeric(value)
+	}
+}
+
+// checkStackedMarkers returns, by placeholder index, the errors of stacked
+// markers that cannot share their target line. Stacked markers are applied
+// in order, each to the first literal of its kind that the markers above it
+// left, so the Nth string marker of a stack replaces the Nth string literal;
+// the taken literals are recorded on the placeholders. A marker whose helper
+// failed keeps its literal when the type of its helper is known.
+func (cp *CodeProcessor) checkStackedMarkers(filePath string, lines []string, placeholders []placeholder, results []BatchResult) map[int]error {
+	overlaps := make(map[int]error)
+	for start := 0; start < len(placeholders); {
+		end := start + 1
+		for end < len(placeholders) && placeholders[end].stacked && placeholders[end].lineIndex == placeholders[start].lineIndex {
+			end++
+		}
+		if !placeholders[start].stacked {
+			start = end
+			continue
+		}
+
+		// The literals are counted where buildReplacementLine looks for them
+		expression := strings.TrimSpace(cp.ctx.Tags().Strip(lines[placeholders[start].lineIndex]))
+		if _, value, _, ok := splitValue(expression); ok {
+			expression = value
+		}
+		targetLine := cp.fileLine(placeholders[start].lineIndex)
+		var (
+			taken    []int
+			conflict error
+		)
+		for i := start; i < end && conflict == nil; i++ {
+			ph, result := placeholders[i], results[i]
+			if result.Err != nil {
+				if result.UserFunc != nil {
+					if _, index, ok := firstLiteral(expression, mapOutputType(result.UserFunc.OutputType), taken); ok {
+						taken = append(taken, index)
+					}
+				}
+				continue
+			}
+			typeHint := cp.typeHintForFunc(result.UserFunc, result.Result)
+			if len(ph.outputs) > 0 || literalClass(typeHint) == "" {
+				conflict = fmt.Errorf("%w: %s cannot share line %d with other markers; only markers producing one string, number or bool can be stacked",
+					errOverlappingMarkers, cp.markerLocation(filePath, ph), targetLine)
+				continue
+			}
+			_, index, ok := firstLiteral(expression, typeHint, taken)
+			if !ok {
+				overlaps[i] = errNoReplacement
+				continue
+			}
+			placeholders[i].taken = append([]int(nil), taken...)
+			taken = append(taken, index)
+		}
+		if conflict != nil {
+			for i := start; i < end; i++ {
+				if results[i].Err == nil {
+					overlaps[i] = conflict
+				}
+			}
+		}
+		start = end
+	}
+	return overlaps
+}
+
+// literalClass groups type hints by the literals they replace; "" for
+// results that have no single literal form
+func literalClass(typeHint string) string {
+	switch typeHint {
+	case "string", "bool":
+		return typeHint
+	case "int", "uint", "float":
+		return "number"
+	default:
+		return ""
+	}
+}
+
+// targetLine points the markers of one stack at the line at lineIndex
+func targetLine(group []placeholder, lineIndex int, inVarBlock bool) []placeholder {
+	for i := range group {
+		group[i].lineIndex = lineIndex
+		group[i].inVarBlock = inVarBlock
+		group[i].stacked = len(group) > 1
+	}
+	return group
+}
+
+// skipNoTarget reports markers that reached the end of the file
+func (cp *CodeProcessor) skipNoTarget(filePath string, group []placeholder) {
+	if cp.collected != nil {
+		return
+	}
+	for _, ph := range group {
+		cp.ctx.skip(SkippedMarker{
+			File: filePath, Line: ph.markerLine, Column: ph.markerColumn, Marker: ph.marker, Reason: SkipNoTarget,
+			Suggestion: "place the marker directly above the line holding the literal",
+		})
+	}
+}
+
+// recordSkipped prints warning and adds the marker that failed with err to
+// the run's skip report
+func (cp *CodeProcessor) recordSkipped(filePath string, ph placeholder, err error, warning string) {
+	if cp.collected != nil {
+		return
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	skipped := SkippedMarker{File: filePath, Line: ph.markerLine, Column: ph.markerColumn, Marker: ph.marker, Trace: ph.traceID}
+	switch {
+	case errors.Is(err, errFunctionNotFound):
+		skipped.Reason, skipped.Suggestion = cp.ctx.explainUnresolved(ph.funcName)
+	case isOutputMismatch(err):
+		skipped.Reason = SkipOutputMismatch
+		skipped.Suggestion, _, _ = strings.Cut(err.Error(), "\n")
+	case errors.As(err, new(*marker.ArgumentError)), errors.Is(err, errBlockArgument):
+		skipped.Reason = SkipInvalidArgument
+		skipped.Suggestion = err.Error()
+	case errors.Is(err, errTooLarge):
+		skipped.Reason = SkipTooLarge
+		skipped.Suggestion = err.Error()
+	case errors.Is(err, errNotInlinable):
+		skipped.Reason = SkipUnsupportedType
+		skipped.Suggestion = err.Error()
+	case errors.Is(err, errOverlappingMarkers):
+		skipped.Reason = SkipOverlapping
+		skipped.Suggestion = strings.TrimPrefix(err.Error(), errOverlappingMarkers.Error()+": ")
+	case errors.Is(err, errUndefinedVariable):
+		skipped.Reason = SkipUndefinedVariable
+		skipped.Suggestion = err.Error()
+	case errors.Is(err, errConstSink):
+		skipped.Reason = SkipConstSink
+		skipped.Suggestion = strings.TrimPrefix(err.Error(), errConstSink.Error()+": ")
+	case errors.Is(err, errCompanion):
+		skipped.Reason = SkipCompanion
+		skipped.Suggestion = strings.TrimPrefix(err.Error(), errCompanion.Error()+": ")
+	case errors.Is(err, errConstantOverflow):
+		skipped.Reason = SkipConstantOverflow
+		skipped.Suggestion = strings.Replace(err.Error(), errConstantOverflow.Error()+": ", "", 1)
+	case errors.Is(err, errByteArrayLength):
+		skipped.Reason = SkipLengthMismatch
+		skipped.Suggestion = strings.Replace(err.Error(), errByteArrayLength.Error()+": ", "", 1)
+	case errors.Is(err, errNoTarget):
+		skipped.Reason = SkipNoTarget
+		skipped.Suggestion = strings.TrimPrefix(err.Error(), errNoTarget.Error()+": ")
+	case errors.Is(err, errNoReplacement):
+		skipped.Reason = SkipNoLiteral
+		skipped.Suggestion = "the line after the marker has no literal matching the helper's return type"
+	default:
+		skipped.Reason = SkipExecFailed
+		skipped.Suggestion, _, _ = strings.Cut(err.Error(), "\n")
+	}
+	cp.ctx.skip(skipped)
+}
+
+var (
+	errBlockArgument   = errors.New(marker.BelowArgument + " argument")
+	errNoBlockArgument = fmt.Errorf("%w: no %s ... %s block comment below the marker",
+		errBlockArgument, marker.BlockArgumentStart, marker.BlockArgumentEnd)
+	errOpenBlockArgument = fmt.Errorf("%w: %s block comment is not closed by a %s line",
+		errBlockArgument, marker.BlockArgumentStart, marker.BlockArgumentEnd)
+)
+
+// readBlockArgument reads the "/* goahead:arg" block comment that starts at
+// first, appending its lines to lines, and returns the lines between its
+// opening and closing line
+func readBlockArgument(scanner *bufio.Scanner, lines *[]string, first string) (string, error) {
+	if strings.TrimSpace(first) != marker.BlockArgumentStart {
+		return "", errNoBlockArgument
+	}
+	*lines = append(*lines, first)
+	var body []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		*lines = append(*lines, line)
+		if strings.TrimSpace(line) == marker.BlockArgumentEnd {
+			return strings.Join(body, "\n"), nil
+		}
+		body = append(body, line)
+	}
+	return "", errOpenBlockArgument
+}
+
+// ReportUnservicedMarkers records every placeholder marker in filePath as
+// skipped; used for modules that have no helper files at all
+func (cp *CodeProcessor) ReportUnservicedMarkers(filePath string) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %v", filePath, err)
+	}
+	for i, line := range strings.Split(string(content), "\n") {
+		m, _ := cp.ctx.MarkerSyntax().Parse(line)
+		if m == nil || m.Kind != marker.KindPlaceholder {
+			continue
+		}
+		reason, suggestion := cp.ctx.explainUnresolved(m.Func)
+		cp.ctx.skip(SkippedMarker{
+			File: filePath, Line: i + 1, Column: strings.Index(line, "//") + 1,
+			Marker: strings.TrimSpace(line), Reason: reason, Suggestion: suggestion,
+		})
+	}
+	return nil
 }
 
-func (cp *CodeProcessor) processCodeLine(line, funcName, argsStr, filePath string, verbose bool) (string, bool) {
+func (cp *CodeProcessor) processCodeLine(line, funcName, argsStr, filePath string, lineNumber int, verbose bool) (string, bool) {
+	logger := cp.ctx.Logger().OrAll(verbose)
 	// Get directory of the source file for hierarchical resolution
 	sourceDir := filepath.Dir(filePath)
 	absSourceDir, err := filepath.Abs(sourceDir)
@@ -182,9 +1069,17 @@ func (cp *CodeProcessor) processCodeLine(line, funcName, argsStr, filePath strin
 		absSourceDir = sourceDir
 	}
 
-	result, userFunc, err := cp.executor.ExecuteFunction(funcName, argsStr, absSourceDir)
-	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Warning: Could not execute function '%s' in %s: %v\n", funcName, filePath, err)
+	evaluated := cp.execute([]BatchCall{{FuncName: funcName, ArgsStr: argsStr}}, absSourceDir)[0]
+	if evaluated.Err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: Could not execute function '%s' in %s: %v\n", funcName, cp.ctx.Config.shownPath(filePath), evaluated.Err)
+		return line, false
+	}
+	result, userFunc := evaluated.Result, evaluated.UserFunc
+	if result == SkipResult {
+		cp.ctx.events().markerEvaluated(MarkerEvent{
+			File: filePath, Line: lineNumber, Helper: funcName, Args: argsStr,
+			Duration: evaluated.Duration, Cached: evaluated.Cached, Declined: true, Func: userFunc,
+		})
 		return line, false
 	}
 
@@ -192,32 +1087,96 @@ func (cp *CodeProcessor) processCodeLine(line, funcName, argsStr, filePath strin
 	formattedResult := formatResultForReplacement(result, typeHint)
 
 	leadingWhitespace, _ := splitLeadingWhitespace(line)
-	newLine, replaced, buildErr := cp.buildReplacementLine(line, leadingWhitespace, funcName, argsStr, formattedResult, typeHint)
+	newLine, replaced, buildErr := cp.buildReplacementLine(line, leadingWhitespace, funcName, argsStr, formattedResult, typeHint, nil)
 	if buildErr != nil {
 		if errors.Is(buildErr, errNoReplacement) {
 			_, _ = fmt.Fprintf(os.Stderr, "Warning: Could not replace function call for '%s' in line: %s\n", funcName, strings.TrimSpace(line))
 		}
 		return line, false
 	}
+	if newLine == line {
+		replaced = false
+	}
 
+	cp.ctx.events().markerEvaluated(MarkerEvent{
+		File: filePath, Line: lineNumber, Helper: funcName, Args: argsStr, Result: result,
+		Duration: evaluated.Duration, Cached: evaluated.Cached, Replaced: replaced, Func: userFunc,
+	})
 	if replaced {
-		helperInfo := ""
-		if userFunc != nil {
-			relPath, _ := filepath.Rel(cp.ctx.RootDir, userFunc.FilePath)
-			if relPath == "" {
-				relPath = userFunc.FilePath
-			}
-			helperInfo = fmt.Sprintf(" (from %s, depth %d)", relPath, userFunc.Depth)
+		logger.Logf(LogReplace, "  Original: '%s'\n  New: '%s'", cp.redact(strings.TrimSpace(line)), cp.redact(strings.TrimSpace(newLine)))
+	}
+
+	return newLine, replaced
+}
+
+// trackVarBlock reports whether the scanner is inside a grouped "var (" block after line
+func trackVarBlock(line string, inVarBlock bool) bool {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "var (") || trimmed == "var(" {
+		return !strings.HasSuffix(trimmed, ")")
+	}
+	if inVarBlock && trimmed == ")" {
+		return false
+	}
+	return inVarBlock
+}
+
+// completeDeclaration adds an initializer to a declaration that has none, e.g.
+// "var timeout int" becomes "var timeout int = 30". A standalone declaration
+// drops the type when the helper returns exactly that default literal type;
+// inside grouped blocks the type is kept so the block's alignment is preserved.
+// Once initialized, later runs update the value through the assignment path.
+// Byte results take the declared byte type (see fitByteLiteral). A
+// declaration of several names, "var x, y string", has no single variable
+// to initialize and is an errNoTarget error.
+func completeDeclaration(line string, inVarBlock bool, formattedResult string, userFunc *UserFunction) (string, bool, error) {
+	if m := uninitializedNamesPattern.FindStringSubmatch(line); m != nil && (m[1] != "" || inVarBlock) {
+		names := strings.Join(strings.Fields(m[2]), " ")
+		return "", false, fmt.Errorf("%w: %s declares %d variables without a value; declare the marker's variable on a line of its own, or give them all values to fill by position",
+			errNoTarget, names, strings.Count(names, ",")+1)
+	}
+	if m := uninitializedVarPattern.FindStringSubmatch(line); m != nil {
+		indent, name, gap, typ, comment := m[1], m[2], m[3], m[4], m[5]
+		value, _, err := fitByteLiteral(typ, formattedResult)
+		if err != nil {
+			return "", false, err
 		}
-		_, _ = fmt.Fprintf(os.Stderr, "[goahead] Replaced in %s: %s(%s) -> %s%s\n", filePath, funcName, argsStr, result, helperInfo)
-		if verbose {
-			_, _ = fmt.Fprintf(os.Stderr, "  Original: '%s'\n  New: '%s'\n", strings.TrimSpace(line), strings.TrimSpace(newLine))
+		decl := indent + "var " + name + gap + typ + " = " + value
+		if userFunc != nil && userFunc.OutputType == typ && isDefaultLiteralType(typ) {
+			decl = indent + "var " + name + " = " + value
 		}
-	} else if verbose {
-		_, _ = fmt.Fprintf(os.Stderr, "[goahead] Unchanged in %s: %s(%s) = %s\n", filePath, funcName, argsStr, result)
+		return appendTrailingComment(decl, comment), true, nil
 	}
+	if !inVarBlock {
+		return "", false, nil
+	}
+	if m := uninitializedBlockPattern.FindStringSubmatch(line); m != nil {
+		indent, name, gap, typ, comment := m[1], m[2], m[3], m[4], m[5]
+		value, _, err := fitByteLiteral(typ, formattedResult)
+		if err != nil {
+			return "", false, err
+		}
+		return appendTrailingComment(indent+name+gap+typ+" = "+value, comment), true, nil
+	}
+	return "", false, nil
+}
 
-	return newLine, replaced
+// isDefaultLiteralType reports whether an untyped literal of this type's kind
+// defaults to exactly this type, so spelling the type out is redundant
+func isDefaultLiteralType(typ string) bool {
+	switch typ {
+	case "string", "bool", "int", "float64":
+		return true
+	default:
+		return false
+	}
+}
+
+func appendTrailingComment(line, comment string) string {
+	if comment == "" {
+		return line
+	}
+	return line + " " + comment
 }
 
 func splitLeadingWhitespace(line string) (string, string) {
@@ -228,9 +1187,12 @@ func splitLeadingWhitespace(line string) (string, string) {
 	return line[:len(line)-len(trimmed)], trimmed
 }
 
-func (cp *CodeProcessor) buildReplacementLine(originalLine, leadingWhitespace, funcName, argsStr, formattedResult, typeHint string) (string, bool, error) {
-	if assignmentPattern.MatchString(originalLine) {
-		return cp.replaceInAssignment(originalLine, funcName, argsStr, formattedResult, typeHint)
+func (cp *CodeProcessor) buildReplacementLine(originalLine, leadingWhitespace, funcName, argsStr, formattedResult, typeHint string, taken []int) (string, bool, error) {
+	if head, value, rest, ok := splitValue(originalLine); ok {
+		return cp.replaceInAssignment(originalLine, head, value, rest, formattedResult, typeHint, taken)
+	}
+	if newLine, ok := replaceComposite(originalLine, formattedResult, typeHint); ok {
+		return newLine, newLine != originalLine, nil
 	}
 
 	if replacedLine, ok := cp.replaceFunctionCall(originalLine, funcName, argsStr, formattedResult); ok {
@@ -239,7 +1201,7 @@ func (cp *CodeProcessor) buildReplacementLine(originalLine, leadingWhitespace, f
 
 	// Try to replace literal placeholder in-place (e.g., in array: `"",` → `"newval",`)
 	trimmed := strings.TrimSpace(originalLine)
-	if replaced, ok := cp.replaceFirstPlaceholder(trimmed, formattedResult, typeHint); ok {
+	if replaced, ok := cp.replaceFirstPlaceholder(trimmed, formattedResult, typeHint, taken); ok {
 		newLine := leadingWhitespace + replaced
 		return newLine, newLine != originalLine, nil
 	}
@@ -249,29 +1211,49 @@ func (cp *CodeProcessor) buildReplacementLine(originalLine, leadingWhitespace, f
 	return newLine, newLine != originalLine, nil
 }
 
-func (cp *CodeProcessor) replaceInAssignment(originalLine, funcName, argsStr, formattedResult, typeHint string) (string, bool, error) {
-	matches := assignmentSplitPattern.FindStringSubmatch(originalLine)
-	if len(matches) < 3 {
-		replacedLine, ok := cp.replaceFunctionCall(originalLine, funcName, argsStr, formattedResult)
-		if !ok {
-			return "", false, errNoReplacement
+// replaceInAssignment replaces the first literal of the assigned value that
+// is not taken, or the whole value when it has none; the trailing comment is
+// kept either way.
+// A []byte{} or [N]byte{} value is replaced by the byte result written with
+// its own type.
+func (cp *CodeProcessor) replaceInAssignment(originalLine, head, value, rest, formattedResult, typeHint string, taken []int) (string, bool, error) {
+	if typ := valueByteType(value); typ != "" {
+		fitted, ok, err := fitByteLiteral(typ, formattedResult)
+		if err != nil {
+			return originalLine, false, err
+		}
+		if ok {
+			src := strings.TrimSuffix(strings.TrimRight(value, " \t"), ",")
+			newLine := head + fitted + value[len(src):] + rest
+			return newLine, newLine != originalLine, nil
 		}
-		return replacedLine, true, nil
 	}
-
-	varAssignPart := matches[1]
-	expressionPart := matches[2]
-
-	replacedExpression, replaced := cp.replaceFirstPlaceholder(expressionPart, formattedResult, typeHint)
-	if replaced {
-		newLine := varAssignPart + replacedExpression
+	if newValue, ok := replaceComposite(value, formattedResult, typeHint); ok {
+		newLine := head + newValue + rest
 		return newLine, newLine != originalLine, nil
 	}
-
-	newLine := varAssignPart + formattedResult
+	replacedValue, replaced := cp.replaceFirstPlaceholder(value, formattedResult, typeHint, taken)
+	if !replaced {
+		replacedValue = formattedResult
+	}
+	newLine := head + replacedValue + rest
 	return newLine, newLine != originalLine, nil
 }
 
+// replaceComposite replaces the first composite literal of code with the
+// type of a composite result, such as the map[string]string{} of
+// "Routes: map[string]string{},"
+func replaceComposite(code, formattedResult, typeHint string) (string, bool) {
+	if typeHint != "composite" {
+		return code, false
+	}
+	start, end, ok := compositeSpan(code, compositeType(formattedResult))
+	if !ok {
+		return code, false
+	}
+	return code[:start] + formattedResult + code[end:], true
+}
+
 func (cp *CodeProcessor) typeHintForFunc(userFunc *UserFunction, result string) string {
 	if userFunc != nil {
 		hint := mapOutputType(userFunc.OutputType)
@@ -282,30 +1264,18 @@ func (cp *CodeProcessor) typeHintForFunc(userFunc *UserFunction, result string)
 	return inferResultKind(result)
 }
 
-func (cp *CodeProcessor) writeFile(filePath string, lines []string) error {
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file %s: %v", filePath, err)
-	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-		}
-	}(file)
-
-	writer := bufio.NewWriter(file)
-	defer func(writer *bufio.Writer) {
-		err := writer.Flush()
-		if err != nil {
-		}
-	}(writer)
-
+func (cp *CodeProcessor) writeFile(filePath, bom string, lines []string) error {
+	var b strings.Builder
+	b.WriteString(bom)
 	for _, line := range lines {
-		if _, err := writer.WriteString(line + "\n"); err != nil {
-			return fmt.Errorf("failed to write to file %s: %v", filePath, err)
-		}
+		b.WriteString(line)
+		b.WriteString("\n")
 	}
-	return nil
+	// Leave the file and its mtime alone when nothing changed
+	if existing, err := cp.ctx.readSource(filePath); err == nil && string(existing) == b.String() {
+		return nil
+	}
+	return cp.ctx.writeSource(filePath, []byte(b.String()))
 }
 
 func escapeString(s string) string {
@@ -320,34 +1290,61 @@ func escapeString(s string) string {
 	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
 }
 
-func (cp *CodeProcessor) replaceFirstPlaceholder(expression, replacement, typeHint string) (string, bool) {
-	switch typeHint {
-	case "string":
-		return replaceFirstMatch(stringLiteralPattern, expression, replacement)
-	case "int", "uint":
-		return replaceFirstMatch(numericZeroPattern, expression, replacement)
-	case "float":
-		if updated, ok := replaceFirstMatch(floatZeroPattern, expression, replacement); ok {
-			return updated, true
-		}
-		return replaceFirstMatch(numericZeroPattern, expression, replacement)
-	case "bool":
-		return replaceFirstMatch(boolFalsePattern, expression, replacement)
-	default:
+// replaceFirstPlaceholder replaces the first literal of expression that a
+// value of typeHint stands for, leaving out the literals at the indexes in
+// taken, which stacked markers above replace. Literals are found in the
+// syntax of the expression, so that neither its trailing comment nor the
+// inside of its string literals, such as the "true" of `s == "true" || false`,
+// is touched.
+func (cp *CodeProcessor) replaceFirstPlaceholder(expression, replacement, typeHint string, taken []int) (string, bool) {
+	span, _, ok := firstLiteral(expression, typeHint, taken)
+	if !ok {
 		return expression, false
 	}
+	return expression[:span.start] + replacement + expression[span.end:], true
 }
 
-func replaceFirstMatch(re *regexp.Regexp, expression, replacement string) (string, bool) {
-	replaced := false
-	updated := re.ReplaceAllStringFunc(expression, func(match string) string {
-		if replaced {
-			return match
-		}
-		replaced = true
-		return replacement
-	})
-	return updated, replaced
+// isUnaryMinus reports whether the number at start has a sign of its own,
+// as in int32(-1), rather than being the right operand of a subtraction
+func isUnaryMinus(expression string, start int) bool {
+	if start == 0 || expression[start-1] != '-' {
+		return false
+	}
+	before := strings.TrimRight(expression[:start-1], " \t")
+	if before == "" {
+		return true
+	}
+	prev := rune(before[len(before)-1])
+	return prev != '_' && prev != ')' && prev != ']' && prev != '}' && !unicode.IsLetter(prev) && !unicode.IsDigit(prev)
+}
+
+// isArrayLength reports whether expression[start:end] is the length of an
+// array type "[N]T" rather than an index "xs[N]". An array type is followed
+// by its element type; after an identifier, ")" or "]" a bracket is an index
+// unless an identifier follows it, which an index expression cannot have.
+func isArrayLength(expression string, start, end int) bool {
+	open := strings.TrimRight(expression[:start], " \t")
+	rest := strings.TrimLeft(expression[end:], " \t")
+	if !strings.HasSuffix(open, "[") || !strings.HasPrefix(rest, "]") {
+		return false
+	}
+	open = strings.TrimRight(open[:len(open)-1], " \t")
+	rest = strings.TrimLeft(rest[1:], " \t")
+	if rest == "" {
+		return false
+	}
+	next := rune(rest[0])
+	if next == '_' || unicode.IsLetter(next) {
+		return true
+	}
+	if next != '[' && next != '(' {
+		return false
+	}
+	if open == "" {
+		return true
+	}
+	prev := rune(open[len(open)-1])
+	return prev != '_' && prev != ')' && prev != ']' && !unicode.IsLetter(prev) && !unicode.IsDigit(prev)
 }
 
 func (cp *CodeProcessor) replaceFunctionCall(line, funcName, argsStr, replacement string) (string, bool) {
@@ -377,9 +1374,11 @@ func mapOutputType(outputType string) string {
 		return "uint"
 	case "int", "int8", "int16", "int32", "int64":
 		return "int"
-	default:
-		return "other"
 	}
+	if strings.HasPrefix(outputType, "[") || strings.HasPrefix(outputType, "map[") {
+		return "composite"
+	}
+	return "other"
 }
 
 func inferResultKind(result string) string {
@@ -397,6 +1396,9 @@ func inferResultKind(result string) string {
 	if _, err := strconv.ParseFloat(trimmed, 64); err == nil {
 		return "float"
 	}
+	if compositeType(trimmed) != "" {
+		return "composite"
+	}
 	return "other"
 }
 
@@ -1,21 +1,317 @@
 package internal
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"go/format"
 	"go/token"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
+// RunCodegen processes dir with default options
 func RunCodegen(dir string, verbose bool) error {
+	return RunCodegenWithConfig(Config{Dir: dir, Verbose: verbose})
+}
+
+// runState carries artifacts shared by a top-level run and its submodules
+type runState struct {
+	annotations *AnnotationSet
+	skipped     *SkipReport
+	diagnostics *Diagnostics
+	tracer      *Tracer
+	sink        *ConstSink
+	index       *incrementalIndex
+	backups     *backupSet
+	results     *resultCache
+	dry         *dryRun
+	stats       *RunStats
+	interrupt   context.Context
+}
+
+// RunCodegenWithConfig processes config.Dir (and any nested submodules) using
+// the options in config
+func RunCodegenWithConfig(config Config) error {
+	_, err := RunCodegenWithReport(config)
+	return err
+}
+
+// RunCodegenWithReport is RunCodegenWithConfig that also returns the markers
+// that were skipped. The report is printed to stderr when non-empty, and in
+// strict mode a non-empty report is returned alongside an error.
+func RunCodegenWithReport(config Config) (*SkipReport, error) {
+	state, err := runWithState(config)
+	if state == nil {
+		return nil, err
+	}
+	return state.skipped, err
+}
+
+// RunCodegenWithStats is RunCodegenWithConfig that also returns the counters
+// of the run
+func RunCodegenWithStats(config Config) (*RunStats, error) {
+	state, err := runWithState(config)
+	if state == nil {
+		return nil, err
+	}
+	return state.stats, err
+}
+
+// runWithState runs codegen for config; the state is nil when the run could
+// not start
+func runWithState(config Config) (*runState, error) {
+	if err := config.applyProjectSettings(); err != nil {
+		return nil, classify(err, ErrEnvironment)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, classify(err, ErrEnvironment)
+	}
+	config.compileMarkerSyntax()
+	config.Dir = StripLongPathPrefix(config.Dir)
+	if info, err := os.Stat(config.Dir); err != nil || !info.IsDir() {
+		return nil, environmentErrorf("directory %s not found", config.Dir)
+	}
+	if config.Check {
+		// The diff is only printed when -dry-run asks for it too
+		if !config.DryRun && config.DiffOutput == nil {
+			config.DiffOutput = io.Discard
+		}
+		config.DryRun, config.Strict = true, true
+	}
+	if config.RequireTrust {
+		absDir := runBaseDir(config)
+		root := findModuleRoot(absDir)
+		if root == "" {
+			root = absDir
+		}
+		if !IsTrusted(root) {
+			warnUntrusted(root)
+			return &runState{skipped: NewSkipReport(), stats: &RunStats{}}, nil
+		}
+	}
+	var dry *dryRun
+	if config.DryRun {
+		started, err := startDryRun(config.Dir)
+		if err != nil {
+			return nil, classify(err, ErrEnvironment)
+		}
+		dry = started
+	}
+	if config.Out != "" {
+		dir, err := mirrorTree(config.Dir, config.Out, config.OutLink)
+		if err != nil {
+			return nil, classify(err, ErrEnvironment)
+		}
+		NewLogger(config.LogCategories).OrAll(config.Verbose).Logf(LogScan, "[goahead] Mirrored %s into %s", config.Dir, dir)
+		// The compiled files of a toolexec run are processed as their copies
+		buildFiles := make([]string, len(config.BuildFiles))
+		for i, file := range config.BuildFiles {
+			buildFiles[i] = mirroredPath(runBaseDir(config), dir, file)
+		}
+		config.Dir, config.BuildFiles = dir, buildFiles
+	}
+	for _, helperDir := range config.HelperDirs {
+		path := helperDir
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(config.Dir, path)
+		}
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			return nil, environmentErrorf("helper directory %s not found in %s", helperDir, config.Dir)
+		}
+	}
+
+	if len(config.Patterns) > 0 {
+		dirs, err := ExpandPackagePatterns(nil, config.Dir, config.Patterns)
+		if err != nil {
+			return nil, err
+		}
+		if len(dirs) == 0 {
+			return nil, fmt.Errorf("package patterns %s matched no packages in %s", strings.Join(config.Patterns, " "), config.Dir)
+		}
+		config.packageDirs = make(map[string]bool, len(dirs))
+		for _, dir := range dirs {
+			config.packageDirs[dir] = true
+		}
+	}
+
+	start := time.Now()
+	interrupt, stopSignals := notifyInterrupt()
+	defer stopSignals()
+	state := &runState{skipped: NewSkipReport(), diagnostics: NewDiagnostics(), stats: &RunStats{}, interrupt: interrupt, dry: dry}
+	if config.Annotations != "" {
+		absDir, err := filepath.Abs(config.Dir)
+		if err != nil {
+			absDir = config.Dir
+		}
+		baseDir := findModuleRoot(absDir)
+		if baseDir == "" {
+			baseDir = absDir
+		}
+		state.annotations = NewAnnotationSet(baseDir)
+	}
+	if config.ConstSink != "" {
+		sink, err := NewConstSink(runBaseDir(config), config.ConstSink)
+		if err != nil {
+			return nil, err
+		}
+		sink.dry = dry
+		state.sink = sink
+	}
+	state.index = loadIndex(config)
+	backups, err := loadBackups(config)
+	if err != nil {
+		return nil, err
+	}
+	state.backups = backups
+	state.results = newResultCache(config)
+	if config.TraceDir != "" {
+		tracer, err := NewTracer(config.TraceDir, config.TraceLimit)
+		if err != nil {
+			return nil, err
+		}
+		state.tracer = tracer
+	}
+
+	err = finishRun(config, state, runCodegen(config, state, nil))
+	// Files rewritten before a failure or an interruption keep their backup
+	if writeErr := state.backups.Write(); writeErr != nil && err == nil {
+		err = writeErr
+	}
+	if dry != nil && err == nil {
+		output := config.DiffOutput
+		if output == nil {
+			output = os.Stdout
+		}
+		pending, reportErr := dry.report(output)
+		state.stats.add(func(s *RunStats) { s.Pending = pending })
+		err = reportErr
+	}
+	if config.Diagnostics != "" {
+		if writeErr := writeRunDiagnostics(config, state, err); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+	state.stats.add(func(s *RunStats) {
+		s.Skipped = state.skipped.Len()
+		s.Duration = time.Since(start)
+		if state.results != nil && config.Verbose {
+			fmt.Printf("[goahead] Result cache: %d hit(s), %d miss(es)\n", s.ResultCacheHits, s.ResultCacheMisses)
+		}
+		if s.SharedEvaluations > 0 && config.Verbose {
+			fmt.Printf("[goahead] Shared evaluations: %d program run(s) avoided\n", s.SharedEvaluations)
+		}
+	})
+	return state, err
+}
+
+// finishRun writes the annotations file and reports skipped markers once the
+// whole tree has been processed
+func finishRun(config Config, state *runState, runErr error) error {
+	if errors.Is(runErr, ErrInterrupted) {
+		// Partial report: what was skipped before the signal arrived
+		if state.skipped.Len() > 0 {
+			_, _ = fmt.Fprint(os.Stderr, state.skipped.Format(runBaseDir(config)))
+		}
+		_, _ = fmt.Fprintln(os.Stderr, "[goahead] Interrupted: files not processed yet were left unchanged")
+		return runErr
+	}
+	if runErr != nil {
+		return runErr
+	}
+
+	// A run limited to some packages or files keeps the constants other
+	// packages use
+	if state.sink != nil {
+		if err := state.sink.Write(len(config.Patterns) > 0 || state.index.partial()); err != nil {
+			return err
+		}
+	}
+
+	if state.annotations != nil {
+		if state.index.partial() {
+			state.annotations.keepFrom(config.Annotations, state.index.wasSkipped)
+		}
+		if err := state.annotations.WriteFile(config.Annotations); err != nil {
+			return err
+		}
+	}
+	// A dry run leaves the sources as they are, so the index stays current
+	if state.dry == nil {
+		if err := state.index.Write(); err != nil {
+			return err
+		}
+	}
+
+	if state.skipped.Len() > 0 {
+		_, _ = fmt.Fprint(os.Stderr, state.skipped.Format(runBaseDir(config)))
+		if config.Strict {
+			kinds := []error{ErrUnresolvedMarker}
+			for _, m := range state.skipped.Markers() {
+				if m.Reason == SkipExecFailed {
+					kinds = append(kinds, ErrExecution)
+					break
+				}
+			}
+			mode := "strict mode"
+			if config.Check {
+				mode = "-check"
+			}
+			return classify(fmt.Errorf("%d marker(s) were skipped (%s)", state.skipped.Len(), mode), kinds...)
+		}
+	}
+	return nil
+}
+
+// writeRunDiagnostics writes the -diagnostics file: collected warnings,
+// skipped markers (errors in strict mode) and the run error, if any. It is
+// written even when the run fails so editors can show why.
+func writeRunDiagnostics(config Config, state *runState, runErr error) error {
+	format, path, err := ParseDiagnosticsSpec(config.Diagnostics)
+	if err != nil {
+		return err
+	}
+
+	severity := SeverityWarning
+	if config.Strict {
+		severity = SeverityError
+	}
+	diags := state.diagnostics.Items()
+	for _, m := range state.skipped.Markers() {
+		diags = append(diags, m.Diagnostic(severity))
+	}
+	if runErr != nil {
+		diags = append(diags, Diagnostic{Severity: SeverityError, Rule: RuleRunFailed, Message: runErr.Error()})
+	}
+	return WriteDiagnostics(format, path, runBaseDir(config), diags)
+}
+
+func runBaseDir(config Config) string {
+	baseDir, err := filepath.Abs(config.Dir)
+	if err != nil {
+		return config.Dir
+	}
+	return baseDir
+}
+
+// runCodegen processes one module; parentHelpers lists helpers of enclosing
+// modules, which are never used but help explain skipped markers
+func runCodegen(config Config, state *runState, parentHelpers map[string]*UserFunction) error {
 	startTotal := time.Now()
+	dir := config.Dir
+	logger := NewLogger(config.LogCategories).OrAll(config.Verbose)
+	verbose := logger.Enabled(LogScan)
 
 	if verbose {
 		fmt.Printf("Parsed flags:\n")
 		fmt.Printf("  dir: '%s'\n", dir)
-		fmt.Printf("  verbose: %t\n", verbose)
+		fmt.Printf("  verbose: %t\n", config.Verbose)
 	}
 
 	// Get absolute path for RootDir
@@ -28,21 +324,37 @@ func RunCodegen(dir string, verbose bool) error {
 		FunctionsByDir:   make(map[string]map[string]*UserFunction),
 		FunctionsByDepth: make(map[int]map[string]*UserFunction),
 		RootDir:          absDir,
-		Verbose:          verbose,
+		Verbose:          logger.All(),
+		Log:              logger,
 		FileSet:          token.NewFileSet(),
+		Config:           config,
+		Annotations:      state.annotations,
+		Skipped:          state.skipped,
+		Diagnostics:      state.diagnostics,
+		Tracer:           state.tracer,
+		ConstSink:        state.sink,
+		index:            state.index,
+		backups:          state.backups,
+		dry:              state.dry,
+		results:          state.results,
+		Stats:            state.stats,
+		Interrupt:        state.interrupt,
+		ParentHelpers:    parentHelpers,
 	}
 	tempDir, err := os.MkdirTemp("", "codegen-*")
 	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %v", err)
+		return environmentErrorf("failed to create temp directory: %v", err)
 	}
 	defer func(path string) {
 		_ = os.RemoveAll(path)
 	}(tempDir)
 	ctx.TempDir = tempDir
+	ctx.hooks = newHookSet(ctx)
 	fileProcessor := NewFileProcessor(ctx)
 	executor := NewFunctionExecutor(ctx)
 	codeProcessor := NewCodeProcessor(ctx, executor)
 	injector := NewInjector(ctx)
+	injector.values = codeProcessor
 
 	// Single walk: collect all .go files and categorize them
 	// This also detects and records submodules (directories with their own go.mod)
@@ -51,6 +363,10 @@ func RunCodegen(dir string, verbose bool) error {
 	if err != nil {
 		return fmt.Errorf("failed to collect files: %v", err)
 	}
+	ctx.Stats.add(func(s *RunStats) { s.Files += len(allFiles) })
+	if ctx.Variables, err = ctx.loadVariables(ctx.DepthRoot, config.ActiveProfile()); err != nil {
+		return err
+	}
 	if verbose {
 		fmt.Printf("[goahead] Walk completed in %v\n", time.Since(startWalk))
 	}
@@ -67,22 +383,41 @@ func RunCodegen(dir string, verbose bool) error {
 	}
 
 	// Track if we have work to do in this project
-	hasLocalWork := len(ctx.FuncFiles) > 0
+	hasLocalWork := len(ctx.FuncFiles) > 0 || len(ctx.BrokenHelpers) > 0
 
+	// Without helpers, only files that declare their own imports can use
+	// standard library and external functions
+	var selfServed []string
 	if !hasLocalWork {
 		if verbose {
 			log.Printf("No function files found in this project (looking for files with '%s' marker)", FunctionMarker)
 		}
+		// Markers here cannot fire; record them so the summary explains why
+		for _, filePath := range fileProcessor.FilterFilesWithMarkers(allFiles) {
+			src, err := os.ReadFile(filePath)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %v", filePath, err)
+			}
+			if imports, err := ctx.fileImports(filePath, src); err != nil {
+				return err
+			} else if len(imports) > 0 {
+				selfServed = append(selfServed, filePath)
+				continue
+			}
+			if err := codeProcessor.ReportUnservicedMarkers(filePath); err != nil {
+				return err
+			}
+		}
 		// Don't return - we still need to process submodules below
 	}
 
-	if hasLocalWork {
+	if hasLocalWork || len(selfServed) > 0 {
 		startLoad := time.Now()
 		if err := fileProcessor.LoadUserFunctions(); err != nil {
 			return fmt.Errorf("failed to load user functions: %v", err)
 		}
 		if err := executor.Prepare(); err != nil {
-			return fmt.Errorf("failed to prepare executor: %v", err)
+			return err
 		}
 		if verbose {
 			fmt.Printf("[goahead] Load functions completed in %v\n", time.Since(startLoad))
@@ -91,22 +426,68 @@ func RunCodegen(dir string, verbose bool) error {
 
 		// Fast-check: identify which files need processing (have markers)
 		startFilter := time.Now()
-		filesToProcess := fileProcessor.FilterFilesWithMarkers(allFiles)
+		filesToProcess := selfServed
+		if hasLocalWork {
+			filesToProcess = fileProcessor.FilterFilesWithMarkers(allFiles)
+		}
+		// The filter returns files as its scans finish; sorting keeps the
+		// processing order, and so which duplicates win, the same every run
+		sort.Strings(filesToProcess)
 		if verbose {
 			fmt.Printf("[goahead] Filter completed in %v\n", time.Since(startFilter))
 			fmt.Printf("[goahead] Found %d files with markers out of %d total .go files\n", len(filesToProcess), len(allFiles))
 		}
+		if err := ctx.resolveSyntax(filesToProcess); err != nil {
+			return err
+		}
 
-		// Process files sequentially to avoid race conditions on caches
+		var helpers map[string]string
+		var project string
+		if ctx.index != nil {
+			helpers, project = ctx.helperHashes(), ctx.projectHash()
+		}
+
+		if jobs := config.fileJobs(); config.SingleProgram || jobs > 1 {
+			var ahead []string
+			for _, filePath := range filesToProcess {
+				if ok, _ := ctx.index.needs(filePath, helpers, project); ok {
+					ahead = append(ahead, filePath)
+				}
+			}
+			if config.SingleProgram {
+				codeProcessor.evaluateAhead(ahead)
+			} else {
+				codeProcessor.prefetchFiles(ahead, jobs)
+			}
+		}
+
+		// Files are rewritten sequentially, in order; only their evaluation
+		// runs ahead in parallel
 		startProcess := time.Now()
 		for _, filePath := range filesToProcess {
-			// Process injections first
-			if err := injector.ProcessFileInjections(filePath, verbose); err != nil {
-				return fmt.Errorf("error processing injections in %s: %v", filePath, err)
+			if ok, reason := ctx.index.needs(filePath, helpers, project); !ok {
+				ctx.index.skip(filePath)
+				ctx.Logger().Logf(LogFilter, "[goahead] Incremental: %s is up to date", ctx.relToRoot(filePath))
+				continue
+			} else if reason != "" {
+				ctx.Logger().Logf(LogFilter, "[goahead] Incremental: processing %s (%s)", ctx.relToRoot(filePath), reason)
+			}
+			if BeforeFileHook != nil {
+				BeforeFileHook(filePath)
+			}
+			if ctx.interrupted() {
+				return ErrInterrupted
+			}
+			ctx.events().fileStarted(FileEvent{File: filePath})
+			ctx.index.begin(filePath, helpers, project)
+			if err := processLockedFile(ctx, injector, codeProcessor, filePath); err != nil {
+				if ctx.interrupted() {
+					return ErrInterrupted
+				}
+				return err
 			}
-			// Then process placeholders
-			if err := codeProcessor.ProcessFile(filePath, verbose); err != nil {
-				return fmt.Errorf("error processing %s: %v", filePath, err)
+			if err := ctx.index.finish(filePath); err != nil {
+				return err
 			}
 		}
 		if verbose {
@@ -122,20 +503,154 @@ func RunCodegen(dir string, verbose bool) error {
 	// Process submodules recursively (each submodule is treated as an independent project)
 	// This happens AFTER the main project is done, so submodules are completely isolated
 	submodules := ctx.Submodules // Copy before ctx is garbage collected
+	var visibleHelpers map[string]*UserFunction
+	if len(submodules) > 0 {
+		visibleHelpers = ctx.outerHelpers()
+	}
 	for _, submodule := range submodules {
+		if ctx.interrupted() {
+			return ErrInterrupted
+		}
+		if enter, _ := ctx.patternScope(submodule); !enter {
+			continue
+		}
 		relPath, _ := filepath.Rel(ctx.RootDir, submodule)
 		if relPath == "" {
 			relPath = submodule
 		}
 		fmt.Printf("\n[goahead] Processing submodule: %s\n", relPath)
-		if err := RunCodegen(submodule, verbose); err != nil {
-			return fmt.Errorf("error processing submodule %s: %v", submodule, err)
+		subConfig := config
+		subConfig.Dir = submodule
+		if err := runCodegen(subConfig, state, visibleHelpers); err != nil {
+			if errors.Is(err, ErrInterrupted) {
+				return err
+			}
+			return fmt.Errorf("error processing submodule %s: %w", submodule, err)
 		}
 	}
 
 	return nil
 }
 
+// processLockedFile rewrites one source file under its advisory lock. Both
+// passes read the file after the lock is taken, so edits saved before that
+// are never overwritten; a file locked by someone else is skipped.
+func processLockedFile(ctx *ProcessorContext, injector *Injector, codeProcessor *CodeProcessor, filePath string) error {
+	if reason := ctx.SkipReason(filePath); reason != "" {
+		ctx.Logger().Logf(LogFilter, "[goahead] Skipping %s: %s", ctx.relToRoot(filePath), reason)
+		return nil
+	}
+	unlock, err := lockFile(filePath, ctx.Config.LockTTL)
+	if errors.Is(err, errFileLocked) {
+		ctx.Warn(Diagnostic{
+			Rule:    RuleFileLocked,
+			File:    filePath,
+			Message: fmt.Sprintf("skipping %s: %v", ctx.relToRoot(filePath), err),
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if streamed, err := streamLockedFile(ctx, codeProcessor, filePath); streamed || err != nil {
+		return err
+	}
+	original, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", filePath, err)
+	}
+	// Lines are rewritten as text; a file whose code is not UTF-8 could not
+	// be matched reliably and is left alone
+	if offset := invalidUTF8Offset(string(original)); offset >= 0 {
+		ctx.Warn(Diagnostic{
+			Rule:    RuleInvalidEncoding,
+			File:    filePath,
+			Line:    bytes.Count(original[:offset], []byte("\n")) + 1,
+			Message: fmt.Sprintf("skipping %s: invalid UTF-8 at byte offset %d", ctx.relToRoot(filePath), offset),
+		})
+		return nil
+	}
+
+	if ctx.FileImports, err = ctx.fileImports(filePath, original); err != nil {
+		return err
+	}
+	defer func() { ctx.FileImports = nil }()
+
+	// Under -paranoid the passes rewrite the file in memory; it is written
+	// once the rewrite has passed the check
+	if ctx.Config.Paranoid {
+		ctx.staged.stage(filePath, original)
+		defer ctx.staged.drop(filePath)
+	}
+
+	// Process injections first
+	if err := injector.ProcessFileInjections(filePath, ctx.Verbose); err != nil {
+		return fmt.Errorf("error processing injections in %s: %w", filePath, err)
+	}
+	// Then process placeholders
+	if err := codeProcessor.ProcessFile(filePath, ctx.Verbose); err != nil {
+		return fmt.Errorf("error processing %s: %w", filePath, err)
+	}
+	if ctx.Config.Format {
+		if err := ctx.formatModifiedFile(filePath, original); err != nil {
+			return err
+		}
+	}
+	content, err := ctx.readSource(filePath)
+	if err != nil {
+		return nil
+	}
+	if AfterRewriteHook != nil {
+		content = AfterRewriteHook(filePath, content)
+		if err := ctx.writeSource(filePath, content); err != nil {
+			return err
+		}
+	}
+	if bytes.Equal(content, original) {
+		return nil
+	}
+	if ctx.Config.Paranoid {
+		if found := ctx.verifyRewrite(original, content); len(found) > 0 {
+			ctx.Warn(Diagnostic{
+				Rule:    RuleParanoid,
+				File:    filePath,
+				Message: fmt.Sprintf("left %s unchanged: the rewrite changed code outside markers and injected blocks:\n    %s", ctx.relToRoot(filePath), strings.Join(found, "\n    ")),
+			})
+			return nil
+		}
+		if err := ctx.dry.writeFile(filePath, content); err != nil {
+			return fmt.Errorf("failed to write %s: %v", filePath, err)
+		}
+	}
+	ctx.backups.record(filePath, original, content)
+	ctx.events().fileWritten(FileEvent{File: filePath})
+	return nil
+}
+
+// formatModifiedFile runs go/format on filePath when its content is no
+// longer original (-format)
+func (ctx *ProcessorContext) formatModifiedFile(filePath string, original []byte) error {
+	content, err := ctx.readSource(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", filePath, err)
+	}
+	if bytes.Equal(content, original) {
+		return nil
+	}
+	bom, text := splitBOM(string(content))
+	formatted, err := format.Source([]byte(text))
+	if err != nil {
+		return fmt.Errorf("failed to format %s: %v", filePath, err)
+	}
+	formatted = append([]byte(bom), formatted...)
+	if bytes.Equal(formatted, content) {
+		return nil
+	}
+	return ctx.writeSource(filePath, formatted)
+}
+
 func printLoadedInfo(ctx *ProcessorContext) {
 	fmt.Printf("Found %d function file(s):\n", len(ctx.FuncFiles))
 	for _, file := range ctx.FuncFiles {
@@ -158,4 +673,15 @@ func printLoadedInfo(ctx *ProcessorContext) {
 	}
 	fmt.Printf("Loaded %d exported function(s) across %d %s:\n", totalFuncs, maxDepth+1, depthWord)
 	fmt.Print(ctx.FormatDepthInfo())
+
+	if len(ctx.DuplicateResolutions) > 0 {
+		fmt.Printf("Duplicate resolutions (-on-duplicate=%s):\n", ctx.Config.DuplicatePolicy())
+		for _, res := range ctx.DuplicateResolutions {
+			kept := "none (all skipped)"
+			if res.Kept != nil {
+				kept, _ = filepath.Rel(ctx.RootDir, res.Kept.FilePath)
+			}
+			fmt.Printf("  - %s at depth %d: %d definitions, kept %s\n", res.Name, res.Depth, len(res.Definitions), kept)
+		}
+	}
 }
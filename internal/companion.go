@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CompanionSuffix follows the stem of a source file in the name of the file
+// -companion writes next to it: main.go gets main_goahead.go, main_test.go
+// main_goahead_test.go and conf_linux.go conf_goahead_linux.go
+const CompanionSuffix = "_goahead"
+
+// companionHeader starts every -companion file
+const companionHeader = "// Code generated by goahead; DO NOT EDIT.\n"
+
+// errCompanion is wrapped by errors for markers whose target an init
+// function cannot assign, such as a local variable or a constant
+var errCompanion = errors.New("cannot write to -companion")
+
+// companionPath returns the -companion file of filePath. File name suffixes
+// such as _test, _linux or _linux_amd64 stay at the end, so the companion is
+// built exactly when its source is.
+func companionPath(filePath string) string {
+	dir, name := filepath.Split(filePath)
+	stem, test := strings.CutSuffix(strings.TrimSuffix(name, ".go"), "_test")
+	suffix := ""
+	for i := 0; i < 2 && platformSuffixed(stem+".go"); i++ {
+		cut := strings.LastIndexByte(stem, '_')
+		stem, suffix = stem[:cut], stem[cut:]+suffix
+	}
+	name = stem + CompanionSuffix + suffix
+	if test {
+		name += "_test"
+	}
+	return filepath.Join(dir, name+".go")
+}
+
+// platformSuffixed reports whether the _GOOS or _GOARCH suffix of name
+// constrains the file: no build of an unknown platform includes it
+func platformSuffixed(name string) bool {
+	ctx := build.Context{GOOS: "goahead", GOARCH: "goahead", Compiler: "gc"}
+	ctx.OpenFile = func(string) (io.ReadCloser, error) { return io.NopCloser(strings.NewReader("package p\n")), nil }
+	match, err := ctx.MatchFile("", name)
+	return err == nil && !match
+}
+
+// companionTargets leaves out the markers whose target -companion cannot
+// assign: anything but a package-level variable. lines are the whole file,
+// as -companion never streams.
+func (cp *CodeProcessor) companionTargets(filePath string, lines []string, placeholders []placeholder) []placeholder {
+	fset := token.NewFileSet()
+	file, parseErr := parser.ParseFile(fset, filePath, strings.Join(lines, "\n"), parser.SkipObjectResolution)
+	kept := placeholders[:0]
+	for _, ph := range placeholders {
+		what := "in a file that does not parse"
+		if parseErr == nil {
+			what = companionTarget(fset, file, ph.lineIndex+1)
+		}
+		if what == "" {
+			kept = append(kept, ph)
+			continue
+		}
+		err := fmt.Errorf("%w: the target is %s; only package-level variables can be assigned from %s",
+			errCompanion, what, filepath.Base(companionPath(filePath)))
+		cp.recordSkipped(filePath, ph, err, fmt.Sprintf("%s: %v", cp.markerLocation(filePath, ph), err))
+	}
+	return kept
+}
+
+// companionTarget describes the declaration holding line when it is not a
+// package-level variable; "" when it is
+func companionTarget(fset *token.FileSet, file *ast.File, line int) string {
+	for _, decl := range file.Decls {
+		if fset.Position(decl.Pos()).Line > line || fset.Position(decl.End()).Line < line {
+			continue
+		}
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			return "a local declaration of func " + decl.Name.Name
+		case *ast.GenDecl:
+			switch decl.Tok {
+			case token.VAR:
+				return ""
+			case token.CONST:
+				return "a constant"
+			}
+		}
+	}
+	return "not a package-level variable"
+}
+
+// companionSource returns the companion of a file whose content a run turned
+// from original into processed: an init function assigning every
+// package-level variable whose declaration changed its value, under the build
+// constraint of the file and with the imports the values use. "" when no
+// value changed.
+func companionSource(original, processed string) (string, error) {
+	fset := token.NewFileSet()
+	before, err := parser.ParseFile(fset, "", original, parser.SkipObjectResolution)
+	if err != nil {
+		return "", err
+	}
+	after, err := parser.ParseFile(fset, "", processed, parser.SkipObjectResolution|parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("the processed file does not parse: %v", err)
+	}
+	// Values are printed from the file without its comment lines, so that
+	// neither the markers of nested values nor the blank lines they would
+	// leave are copied
+	printed, err := parser.ParseFile(fset, "", commentLinesRemoved(processed, fset, after), parser.SkipObjectResolution)
+	if err != nil {
+		return "", fmt.Errorf("the processed file does not parse: %v", err)
+	}
+	if len(before.Decls) != len(after.Decls) {
+		return "", errors.New("the processed file declares other things than its source")
+	}
+	afterSpecs, printedSpecs := varSpecs(after), varSpecs(printed)
+	if len(afterSpecs) != len(printedSpecs) {
+		return "", errors.New("the processed file declares variables inside comments")
+	}
+	originalLines, processedLines := strings.Split(original, "\n"), strings.Split(processed, "\n")
+	changed := func(node ast.Node) bool {
+		for line := fset.Position(node.Pos()).Line; line <= fset.Position(node.End()).Line; line++ {
+			if line > len(originalLines) || line > len(processedLines) || originalLines[line-1] != processedLines[line-1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var body bytes.Buffer
+	var values []ast.Expr
+	for i, spec := range afterSpecs {
+		if !changed(spec) {
+			continue
+		}
+		spec = printedSpecs[i]
+		if len(spec.Values) == 0 {
+			return "", fmt.Errorf("line %d declares no value", fset.Position(afterSpecs[i].Pos()).Line)
+		}
+		names := make([]string, len(spec.Names))
+		for i, name := range spec.Names {
+			names[i] = name.Name
+		}
+		body.WriteString("\t" + strings.Join(names, ", ") + " = ")
+		for i, value := range spec.Values {
+			if i > 0 {
+				body.WriteString(", ")
+			}
+			if err := printer.Fprint(&body, fset, value); err != nil {
+				return "", err
+			}
+			values = append(values, value)
+		}
+		body.WriteString("\n")
+	}
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	var src strings.Builder
+	src.WriteString(companionHeader + "\n")
+	for _, line := range originalLines {
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		if strings.HasPrefix(line, "//go:build ") {
+			src.WriteString(line + "\n\n")
+		}
+	}
+	src.WriteString("package " + after.Name.Name + "\n\n")
+	switch imports := companionImports(after, values); len(imports) {
+	case 0:
+	case 1:
+		src.WriteString("import " + imports[0] + "\n\n")
+	default:
+		src.WriteString("import (\n\t" + strings.Join(imports, "\n\t") + "\n)\n\n")
+	}
+	src.WriteString("func init() {\n" + body.String() + "}\n")
+	formatted, err := format.Source([]byte(src.String()))
+	if err != nil {
+		return "", err
+	}
+	return string(formatted), nil
+}
+
+// varSpecs lists the specs of the package-level var declarations of file
+func varSpecs(file *ast.File) []*ast.ValueSpec {
+	var specs []*ast.ValueSpec
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.VAR {
+			for _, spec := range gen.Specs {
+				specs = append(specs, spec.(*ast.ValueSpec))
+			}
+		}
+	}
+	return specs
+}
+
+// commentLinesRemoved returns src, parsed as file, without the lines that
+// hold only a // comment
+func commentLinesRemoved(src string, fset *token.FileSet, file *ast.File) string {
+	comments := make(map[int]bool)
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "//") {
+				comments[fset.Position(c.Pos()).Line] = true
+			}
+		}
+	}
+	lines := strings.Split(src, "\n")
+	kept := lines[:0]
+	for i, line := range lines {
+		if !comments[i+1] || !strings.HasPrefix(strings.TrimSpace(line), "//") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// companionImports returns the import specs of file that values refer to
+func companionImports(file *ast.File, values []ast.Expr) []string {
+	used := make(map[string]bool)
+	for _, value := range values {
+		ast.Inspect(value, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok {
+					used[id.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	var specs []string
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if !used[name] {
+			continue
+		}
+		if spec.Name != nil {
+			specs = append(specs, name+" "+spec.Path.Value)
+		} else {
+			specs = append(specs, spec.Path.Value)
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
+
+// writeCompanion writes the -companion file of filePath from its original
+// text and the lines the run produced, leaving filePath alone. A companion
+// whose values all went back to those of the source is removed.
+func (cp *CodeProcessor) writeCompanion(filePath, original string, lines []string) error {
+	target := companionPath(filePath)
+	source, err := companionSource(strings.ReplaceAll(original, "\r\n", "\n"), strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		return fmt.Errorf("cannot write %s: %v", cp.ctx.relToRoot(target), err)
+	}
+	existing, readErr := cp.ctx.dry.readFile(target)
+	if readErr == nil && !strings.HasPrefix(string(existing), companionHeader) {
+		return fmt.Errorf("cannot write %s: the file exists and was not generated by goahead", cp.ctx.relToRoot(target))
+	}
+	if source == "" {
+		if readErr == nil {
+			return cp.ctx.dry.removeFile(target)
+		}
+		return nil
+	}
+	if readErr == nil && string(existing) == source {
+		return nil
+	}
+	return cp.ctx.dry.writeFile(target, []byte(source))
+}
@@ -0,0 +1,316 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SinkConstPrefix starts the names of the constants written to -const-sink.
+// The names are exported so that every package of the module can use them.
+const SinkConstPrefix = "GoaheadVal_"
+
+// sinkHeader starts every -const-sink file
+const sinkHeader = "// Code generated by goahead; DO NOT EDIT.\n"
+
+// sinkReferencePattern matches a reference to a sink constant, qualified by
+// the sink's package name outside its package
+var sinkReferencePattern = regexp.MustCompile(`\b(?:[A-Za-z_]\w*\.)?` + SinkConstPrefix + `[0-9a-f]{16}\b`)
+
+// sinkEntryPattern matches a constant of an existing sink file
+var sinkEntryPattern = regexp.MustCompile(`^\s*(` + SinkConstPrefix + `[0-9a-f]{16})\s*=\s*(.+)$`)
+
+// errConstSink is wrapped by errors for markers whose package cannot refer
+// to the sink, such as one the sink package imports
+var errConstSink = errors.New("cannot refer to -const-sink")
+
+// ConstSink collects the values of a -const-sink run and writes them as
+// constants of one generated file
+type ConstSink struct {
+	mu sync.Mutex
+	// path is the absolute path of the sink file
+	path       string
+	dir        string
+	pkgName    string
+	moduleRoot string
+	modulePath string
+	// importPath is "" when the sink is not inside a module
+	importPath string
+	values     map[string]string
+	// kept are constants of the current file still referred to by targets
+	// whose helper declined to replace them
+	kept map[string]bool
+	// imports caches the module-local imports of the packages reached from
+	// the sink package, by directory
+	imports map[string][]string
+	// dry holds the file instead of the disk during a -dry-run
+	dry *dryRun
+}
+
+// NewConstSink prepares the sink at path, relative to baseDir unless absolute
+func NewConstSink(baseDir, path string) (*ConstSink, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -const-sink %s: %v", path, err)
+	}
+	sink := &ConstSink{
+		path:    absPath,
+		dir:     filepath.Dir(absPath),
+		values:  make(map[string]string),
+		kept:    make(map[string]bool),
+		imports: make(map[string][]string),
+	}
+	sink.pkgName = sink.packageName()
+	if root := findModuleRoot(sink.dir); root != "" {
+		sink.moduleRoot = root
+		sink.modulePath = readModulePath(filepath.Join(root, "go.mod"))
+		if rel, err := filepath.Rel(root, sink.dir); err == nil && sink.modulePath != "" {
+			sink.importPath = sink.modulePath
+			if rel != "." {
+				sink.importPath += "/" + filepath.ToSlash(rel)
+			}
+		}
+	}
+	return sink, nil
+}
+
+// packageName returns the package of the other files in the sink's
+// directory, or a name derived from the directory
+func (s *ConstSink) packageName() string {
+	entries, _ := os.ReadDir(s.dir)
+	for _, entry := range entries {
+		path := filepath.Join(s.dir, entry.Name())
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") || path == s.path || hasExcludeConstraint(path) {
+			continue
+		}
+		if file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly); err == nil {
+			return file.Name.Name
+		}
+	}
+	return packageNameForPath(filepath.ToSlash(s.dir))
+}
+
+// Reference records literal in the sink and returns the expression that
+// refers to it from filePath, with the import spec the file then needs ("" in
+// the sink's own package)
+func (s *ConstSink) Reference(filePath, literal string) (string, string, error) {
+	sum := sha256.Sum256([]byte(literal))
+	name := SinkConstPrefix + hex.EncodeToString(sum[:8])
+
+	absFile, err := filepath.Abs(filePath)
+	if err != nil {
+		absFile = filePath
+	}
+	targetDir := filepath.Dir(absFile)
+	ref, spec := name, ""
+	if targetDir != s.dir {
+		switch {
+		case s.importPath == "":
+			return "", "", fmt.Errorf("%w: %s is not inside a module, so %s cannot import it", errConstSink, s.path, filepath.Base(filePath))
+		case s.pkgName == "main":
+			return "", "", fmt.Errorf("%w: %s is in package main, which %s cannot import", errConstSink, s.path, filepath.Base(filePath))
+		case findModuleRoot(targetDir) != s.moduleRoot:
+			return "", "", fmt.Errorf("%w: %s belongs to module %s, which %s is not part of", errConstSink, s.path, s.modulePath, filepath.Base(filePath))
+		}
+		if via := s.importChain(targetDir); via != nil {
+			return "", "", fmt.Errorf("%w: import cycle: the sink package %s imports %s, so %s cannot import it",
+				errConstSink, s.importPath, strings.Join(via, " -> "), filepath.Base(filePath))
+		}
+		ref, spec = s.pkgName+"."+name, strconv.Quote(s.importPath)
+	}
+
+	s.mu.Lock()
+	s.values[name] = literal
+	s.mu.Unlock()
+	return ref, spec, nil
+}
+
+// keep carries the constant named by ref over from the current file; ref
+// may be qualified by the sink's package, or empty
+func (s *ConstSink) keep(ref string) {
+	if ref == "" {
+		return
+	}
+	if _, name, ok := strings.Cut(ref, "."); ok {
+		ref = name
+	}
+	s.mu.Lock()
+	s.kept[ref] = true
+	s.mu.Unlock()
+}
+
+// importChain returns the import paths leading from the sink package to the
+// package in targetDir, or nil when the sink package does not depend on it
+func (s *ConstSink) importChain(targetDir string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	type step struct {
+		dir   string
+		chain []string
+	}
+	visited := map[string]bool{s.dir: true}
+	queue := []step{{dir: s.dir}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, path := range s.moduleImports(current.dir) {
+			dir, ok := modulePackageDir(s.moduleRoot, s.modulePath, path)
+			if !ok || visited[dir] {
+				continue
+			}
+			chain := append(append([]string(nil), current.chain...), path)
+			if dir == targetDir {
+				return chain
+			}
+			visited[dir] = true
+			queue = append(queue, step{dir: dir, chain: chain})
+		}
+	}
+	return nil
+}
+
+// moduleImports returns the imports of the package in dir that belong to
+// the sink's module, ignoring the sink file, tests and excluded files
+func (s *ConstSink) moduleImports(dir string) []string {
+	if imports, ok := s.imports[dir]; ok {
+		return imports
+	}
+	seen := make(map[string]bool)
+	var imports []string
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") || path == s.path || hasExcludeConstraint(path) {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, spec := range file.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || seen[importPath] {
+				continue
+			}
+			if _, ok := modulePackageDir(s.moduleRoot, s.modulePath, importPath); ok {
+				seen[importPath] = true
+				imports = append(imports, importPath)
+			}
+		}
+	}
+	sort.Strings(imports)
+	s.imports[dir] = imports
+	return imports
+}
+
+// Write regenerates the sink file from the recorded values, sorted by name.
+// With keepExisting, the constants of the current file are kept as well, for
+// runs that did not visit every file using them. Constants passed to keep
+// are always kept.
+func (s *ConstSink) Write(keepExisting bool) error {
+	s.mu.Lock()
+	values := make(map[string]string, len(s.values))
+	for name, literal := range s.values {
+		values[name] = literal
+	}
+	kept := s.kept
+	s.mu.Unlock()
+
+	existing, err := s.dry.readFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read -const-sink %s: %v", s.path, err)
+	}
+	if keepExisting || len(kept) > 0 {
+		for _, line := range strings.Split(string(existing), "\n") {
+			if m := sinkEntryPattern.FindStringSubmatch(line); m != nil && (keepExisting || kept[m[1]]) {
+				if _, ok := values[m[1]]; !ok {
+					values[m[1]] = strings.TrimSpace(m[2])
+				}
+			}
+		}
+	}
+	if len(values) == 0 && existing == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(sinkHeader)
+	b.WriteString("\npackage " + s.pkgName + "\n")
+	if len(names) > 0 {
+		b.WriteString("\nconst (\n")
+		for _, name := range names {
+			fmt.Fprintf(&b, "\t%s = %s\n", name, values[name])
+		}
+		b.WriteString(")\n")
+	}
+	if string(existing) == b.String() {
+		return nil
+	}
+	if s.dry == nil {
+		if err := os.MkdirAll(s.dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create -const-sink directory %s: %v", s.dir, err)
+		}
+	}
+	return s.dry.writeFile(s.path, []byte(b.String()))
+}
+
+// sinkKind reports whether a value of typeHint can be a constant
+func sinkKind(typeHint string) bool {
+	switch typeHint {
+	case "string", "int", "uint", "float", "bool":
+		return true
+	}
+	return false
+}
+
+// sortImportBlocks sorts the import blocks of a file that was given sink
+// imports the way gofmt does, within each group of specs; a file that does
+// not parse is returned as it is
+func sortImportBlocks(lines []string) []string {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", strings.Join(lines, "\n"), parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return lines
+	}
+	ast.SortImports(fset, file)
+	for i := len(file.Decls) - 1; i >= 0; i-- {
+		decl, ok := file.Decls[i].(*ast.GenDecl)
+		if !ok || decl.Tok != token.IMPORT || !decl.Lparen.IsValid() {
+			continue
+		}
+		start, end := fset.Position(decl.Pos()), fset.Position(decl.End())
+		if start.Column != 1 || strings.TrimSpace(lines[end.Line-1][end.Column-1:]) != "" {
+			continue
+		}
+		var b bytes.Buffer
+		if err := format.Node(&b, fset, &printer.CommentedNode{Node: decl, Comments: file.Comments}); err != nil {
+			return lines
+		}
+		lines = slices.Replace(lines, start.Line-1, end.Line, strings.Split(b.String(), "\n")...)
+	}
+	return lines
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"math"
+	"regexp"
+)
+
+// errConstantOverflow is wrapped by errors for numeric values the type of
+// their target cannot hold; the compiler would reject them far from the marker
+var errConstantOverflow = errors.New("constant overflow")
+
+// numericTypes are the types whose range is checked; int, uint and uintptr
+// are taken to be 64 bits wide
+const numericTypes = `u?int(?:8|16|32|64)?|uintptr|byte|rune|float32|float64`
+
+// numericConversionPattern finds the predeclared numeric type of a
+// conversion returned by conversionTarget
+var numericConversionPattern = regexp.MustCompile(`^(?:` + numericTypes + `)$`)
+
+// numericDeclarationPattern captures the numeric type and the initializer
+// of a single declaration such as var port uint16 = 8080
+var numericDeclarationPattern = regexp.MustCompile(`^\s*(?:(?:var|const)\s+)?\w+\s+(` + numericTypes + `)\s*=\s*(.*?)\s*,?\s*(?://.*)?$`)
+
+// checkTargetRange checks value, written on line, against the numeric type
+// of its target: the type of a conversion wrapping it, or the declared type
+// of a declaration it is the whole initializer of. Targets of another or an
+// unknown type are not checked.
+func checkTargetRange(line, value string) error {
+	typ := conversionTarget(line, value)
+	if !numericConversionPattern.MatchString(typ) {
+		m := numericDeclarationPattern.FindStringSubmatch(line)
+		if m == nil || m[2] != value {
+			return nil
+		}
+		typ = m[1]
+	}
+	return checkConstantRange(typ, value)
+}
+
+// checkConstantRange reports whether the numeric literal value is a
+// constant of type typ under the go/constant rules the compiler applies
+func checkConstantRange(typ, value string) error {
+	v := numericConstant(value)
+	if v.Kind() == constant.Unknown {
+		return nil
+	}
+	if typ == "float32" || typ == "float64" {
+		limit := math.MaxFloat64
+		if typ == "float32" {
+			limit = math.MaxFloat32
+		}
+		if f, _ := constant.Float64Val(v); math.Abs(f) > limit {
+			return fmt.Errorf("%w: %s overflows %s (range ±%g)", errConstantOverflow, value, typ, limit)
+		}
+		return nil
+	}
+	if v = constant.ToInt(v); v.Kind() != constant.Int {
+		return fmt.Errorf("%w: %s is not an integer and is truncated as %s", errConstantOverflow, value, typ)
+	}
+	lo, hi := integerRange(typ)
+	if constant.Compare(v, token.LSS, lo) || constant.Compare(v, token.GTR, hi) {
+		return fmt.Errorf("%w: %s overflows %s (range %s to %s)", errConstantOverflow, value, typ, lo, hi)
+	}
+	return nil
+}
+
+// numericConstant returns the value of a numeric or rune literal with an
+// optional sign, an unknown value for anything else
+func numericConstant(value string) constant.Value {
+	expr, err := parser.ParseExpr(value)
+	if err != nil {
+		return constant.MakeUnknown()
+	}
+	negate := false
+	if unary, ok := expr.(*ast.UnaryExpr); ok && (unary.Op == token.SUB || unary.Op == token.ADD) {
+		negate, expr = unary.Op == token.SUB, unary.X
+	}
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.INT && lit.Kind != token.FLOAT && lit.Kind != token.CHAR {
+		return constant.MakeUnknown()
+	}
+	v := constant.MakeFromLiteral(lit.Value, lit.Kind, 0)
+	if negate {
+		v = constant.UnaryOp(token.SUB, v, 0)
+	}
+	return v
+}
+
+// integerRange returns the smallest and largest values of the integer type typ
+func integerRange(typ string) (constant.Value, constant.Value) {
+	bits, signed := 64, true
+	switch typ {
+	case "int8":
+		bits = 8
+	case "int16":
+		bits = 16
+	case "int32", "rune":
+		bits = 32
+	case "uint8", "byte":
+		bits, signed = 8, false
+	case "uint16":
+		bits, signed = 16, false
+	case "uint32":
+		bits, signed = 32, false
+	case "uint", "uint64", "uintptr":
+		signed = false
+	}
+	one := constant.MakeInt64(1)
+	if !signed {
+		return constant.MakeInt64(0), constant.BinaryOp(constant.Shift(one, token.SHL, uint(bits)), token.SUB, one)
+	}
+	limit := constant.Shift(one, token.SHL, uint(bits-1))
+	return constant.UnaryOp(token.SUB, limit, 0), constant.BinaryOp(limit, token.SUB, one)
+}
@@ -1,6 +1,10 @@
 package internal
 
-import "runtime/debug"
+import (
+	"runtime/debug"
+
+	"github.com/AeonDave/goahead/marker"
+)
 
 var Version = getVersion()
 
@@ -13,13 +17,254 @@ func getVersion() string {
 	return "dev"
 }
 
+// Policies for same-depth duplicate helper definitions
+const (
+	DuplicatePolicyError = "error"
+	DuplicatePolicyFirst = "first"
+	DuplicatePolicySkip  = "skip"
+)
+
+// ProjectRootEnv names the environment variable exposing the module root of
+// the file whose marker is being evaluated to helper code
+const ProjectRootEnv = "GOAHEAD_PROJECT_ROOT"
+
+// NoCacheDirective in a helper's doc comment marks it non-deterministic
+const NoCacheDirective = "goahead:nocache"
+
+// TimeoutDirective and MaxMemDirective in a helper's doc comment limit each
+// of its calls, e.g. //goahead:timeout 5s and //goahead:maxmem 256MiB
+const (
+	TimeoutDirective = "goahead:timeout"
+	MaxMemDirective  = "goahead:maxmem"
+)
+
+// EvalLimitPrefix starts the stderr line of an evaluation program stopped
+// because a helper exceeded one of its limits
+const EvalLimitPrefix = "goahead-limit:"
+
+// EvalAddressLimitPrefix starts the stderr lines an evaluation program
+// writes when it caps its address space for a call with a maxmem, "name
+// bytes", and when it lifts the cap again, "-"; they name the helper when
+// the runtime runs out of memory, which the program cannot report itself
+const EvalAddressLimitPrefix = "goahead-address-limit:"
+
+// MissingFieldPrefix marks a struct field that a multi-output marker names
+// but the helper's result does not have
+const MissingFieldPrefix = "!goahead-missing-field:"
+
+// ElementFieldsPrefix starts the result of a marker that fills a composite
+// literal element field by field; the values follow, tab-separated
+const ElementFieldsPrefix = "!goahead-fields:"
+
+// EvalFailedPrefix starts the result of a call that panicked in a
+// -single-program evaluation; the panic value follows
+const EvalFailedPrefix = "!goahead-failed:"
+
+// SkipResult is the value a helper returns to leave its marker's target as
+// it is. Helpers returning (value, apply bool) produce it when apply is
+// false. Keep in sync with evalResultCode.
+const SkipResult = "\x00goahead:skip"
+
+// EvalResultPrefix starts the final stdout line of an evaluation program,
+// which holds its results as JSON; anything helpers print before it is not
+// part of the results
+const EvalResultPrefix = "goahead-result:"
+
+// evalResultCode encodes the results of an evaluation program. Strings are
+// sent verbatim (base64 when not valid UTF-8), []byte as base64 and other
+// values as their %#v Go syntax; values implementing goaheadEncoder, such as
+// the tuples of multi-output markers, encode themselves. SkipResult is sent
+// as a result of its own type. The run time of each call, measured by
+// goaheadTimed, is sent alongside its result.
+const evalResultCode = `
+type goaheadResult struct {
+	Type     string ` + "`json:\"type\"`" + `
+	Encoding string ` + "`json:\"encoding,omitempty\"`" + `
+	Value    any    ` + "`json:\"value\"`" + `
+}
+
+type goaheadEncoder interface {
+	goaheadEncode() goaheadResult
+}
+
+func goaheadEncode(v any) goaheadResult {
+	switch v := v.(type) {
+	case goaheadEncoder:
+		return v.goaheadEncode()
+	case string:
+		if v == "\x00goahead:skip" {
+			return goaheadResult{Type: "skip"}
+		}
+		if !goaheadutf8.ValidString(v) {
+			return goaheadResult{Type: "string", Encoding: "base64", Value: goaheadbase64.StdEncoding.EncodeToString([]byte(v))}
+		}
+		return goaheadResult{Type: "string", Value: v}
+	case []byte:
+		return goaheadResult{Type: "bytes", Encoding: "base64", Value: goaheadbase64.StdEncoding.EncodeToString(v)}
+	}
+	return goaheadResult{Type: {{.FmtAlias}}.Sprintf("%T", v), Value: {{.FmtAlias}}.Sprintf("%#v", v)}
+}
+
+// goaheadApply turns the (value, apply bool) results of a helper into the
+// value, or the skip result when apply is false
+func goaheadApply[T any](v T, apply bool) any {
+	if !apply {
+		return "\x00goahead:skip"
+	}
+	return v
+}
+
+// goaheadDurations are the run times of the calls in nanoseconds, in the
+// order goaheadTimed ran them
+var goaheadDurations []int64
+
+func goaheadTimed(call func() any) any {
+	defer func(start goaheadtime.Time) {
+		goaheadDurations = append(goaheadDurations, int64(goaheadtime.Since(start)))
+	}(goaheadtime.Now())
+	return call()
+}
+
+// goaheadEmit writes the results on a line of their own, after whatever
+// the helpers printed
+func goaheadEmit(results ...any) {
+	encoded := make([]goaheadResult, len(results))
+	for i, result := range results {
+		encoded[i] = goaheadEncode(result)
+	}
+	data, err := goaheadjson.Marshal(struct {
+		Results   []goaheadResult ` + "`json:\"results\"`" + `
+		Durations []int64         ` + "`json:\"durations\"`" + `
+	}{encoded, goaheadDurations})
+	if err != nil {
+		{{.FmtAlias}}.Fprintln(goaheados.Stderr, "goahead: cannot encode results:", err)
+		goaheados.Exit(1)
+	}
+	{{.FmtAlias}}.Printf("\n` + EvalResultPrefix + `%s\n", data)
+}
+`
+
+// evalResultImports are the imports of evalResultCode
+const evalResultImports = `	goaheadbase64 "encoding/base64"
+	goaheadjson "encoding/json"
+	goaheados "os"
+	goaheadtime "time"
+	goaheadutf8 "unicode/utf8"`
+
+// evalHarnessCode is the clock and environment helpers see. Helpers that
+// call goaheadNow() instead of time.Now get the -freeze-time instant when it
+// is set; goaheadSetEnv applies -env and, with -env-isolate, first clears
+// every variable but ProjectRootEnv.
+const evalHarnessCode = `
+var goaheadNow = {{.Harness.Clock}}
+{{- if .Harness.SetEnv}}
+
+func goaheadSetEnv() {
+{{- if .Harness.EnvIsolate}}
+	root := goaheados.Getenv("` + ProjectRootEnv + `")
+	goaheados.Clearenv()
+	goaheados.Setenv("` + ProjectRootEnv + `", root)
+{{- end}}
+{{- range .Harness.Env}}
+	goaheados.Setenv({{.}})
+{{- end}}
+}
+{{- end}}
+`
+
+// evalLimitCode runs the calls of helpers with a //goahead:timeout or
+// //goahead:maxmem directive. The memory limit is the soft limit of the
+// garbage collector during the call (what GOMEMLIMIT sets), and the heap is
+// sampled so that a helper going past it stops the program. On Linux the
+// address space is also capped at what the program uses plus the limit,
+// which the runtime cannot go past even between samples.
+const evalLimitCode = `
+func goaheadLimit(name string, timeout goaheadtime.Duration, maxmem uint64, call func() any) any {
+	if maxmem > 0 {
+		previous := goaheaddebug.SetMemoryLimit(int64(maxmem))
+		defer goaheaddebug.SetMemoryLimit(previous)
+{{- if .AddressLimit}}
+		defer goaheadLimitAddressSpace(name, maxmem)()
+{{- end}}
+	}
+	done := make(chan any, 1)
+	go func() { done <- call() }()
+	var expired, sample <-chan goaheadtime.Time
+	if timeout > 0 {
+		timer := goaheadtime.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	if maxmem > 0 {
+		ticker := goaheadtime.NewTicker(5 * goaheadtime.Millisecond)
+		defer ticker.Stop()
+		sample = ticker.C
+	}
+	heap := make([]goaheadmetrics.Sample, 1)
+	heap[0].Name = "/memory/classes/heap/objects:bytes"
+	for {
+		select {
+		case result := <-done:
+			return result
+		case <-expired:
+			goaheadExceeded("helper %s exceeded its //` + TimeoutDirective + ` of %v", name, timeout)
+		case <-sample:
+			goaheadmetrics.Read(heap)
+			if used := heap[0].Value.Uint64(); used > maxmem {
+				goaheadExceeded("helper %s exceeded its //` + MaxMemDirective + ` of %d bytes (heap reached %d bytes)", name, maxmem, used)
+			}
+		}
+	}
+}
+
+func goaheadExceeded(format string, args ...any) {
+	{{.FmtAlias}}.Fprintf(goaheados.Stderr, "\n` + EvalLimitPrefix + `"+format+"\n", args...)
+	goaheados.Exit(1)
+}
+{{- if .AddressLimit}}
+
+func goaheadLimitAddressSpace(name string, maxmem uint64) func() {
+	var previous goaheadsyscall.Rlimit
+	statm, err := goaheados.ReadFile("/proc/self/statm")
+	if err != nil || goaheadsyscall.Getrlimit(goaheadsyscall.RLIMIT_AS, &previous) != nil {
+		return func() {}
+	}
+	var pages uint64
+	if _, err := {{.FmtAlias}}.Sscan(string(statm), &pages); err != nil {
+		return func() {}
+	}
+	limit := previous
+	limit.Cur = min(pages*uint64(goaheados.Getpagesize())+maxmem, previous.Max)
+	if goaheadsyscall.Setrlimit(goaheadsyscall.RLIMIT_AS, &limit) != nil {
+		return func() {}
+	}
+	{{.FmtAlias}}.Fprintf(goaheados.Stderr, "\n` + EvalAddressLimitPrefix + `%s %d\n", name, maxmem)
+	return func() {
+		_ = goaheadsyscall.Setrlimit(goaheadsyscall.RLIMIT_AS, &previous)
+		{{.FmtAlias}}.Fprintln(goaheados.Stderr, "` + EvalAddressLimitPrefix + `-")
+	}
+}
+{{- end}}
+`
+
+// evalLimitImports are the imports of evalLimitCode
+const evalLimitImports = `	goaheaddebug "runtime/debug"
+	goaheadmetrics "runtime/metrics"
+{{- if .AddressLimit}}
+	goaheadsyscall "syscall"
+{{- end}}`
+
 const (
 	FunctionMarker    = "//go:ahead functions"
-	CommentPattern    = `^\s*//\s*:([^:]+)(?::(.*))?`
+	CommentPattern    = marker.PlaceholderPattern
 	ExecutionTemplate = `package main
 
 import (
 	{{.FmtAlias}} "fmt"
+` + evalResultImports + `
+{{- if .Limits}}
+` + evalLimitImports + `
+{{- end}}
 {{- range .Imports}}
 	{{.}}
 {{- end}}
@@ -32,16 +277,26 @@ import (
 func goaheadFirst[T any](v T, _ ...any) T {
 	return v
 }
-
+` + evalHarnessCode + evalResultCode + `
+{{- if .Limits}}
+` + evalLimitCode + `
+{{- end}}
 func main() {
-	result := goaheadFirst({{.CallExpr}})
-	{{.FmtAlias}}.Printf("%#v", result)
+{{- if .Harness.SetEnv}}
+	goaheadSetEnv()
+{{- end}}
+	goaheadEmit(goaheadTimed(func() any { return goaheadFirst({{.CallExpr}}) }))
 }
 `
 	ExecutionBatchTemplate = `package main
 
 import (
 	{{.FmtAlias}} "fmt"
+	goaheadreflect "reflect"
+` + evalResultImports + `
+{{- if .Limits}}
+` + evalLimitImports + `
+{{- end}}
 {{- range .Imports}}
 	{{.}}
 {{- end}}
@@ -54,16 +309,119 @@ import (
 func goaheadFirst[T any](v T, _ ...any) T {
 	return v
 }
+` + evalHarnessCode + evalResultCode + `
+{{- if .Limits}}
+` + evalLimitCode + `
+{{- end}}
+// goaheadValues holds the values of a multi-output marker
+type goaheadValues []any
+
+func (v goaheadValues) goaheadEncode() goaheadResult {
+	values := make([]goaheadResult, len(v))
+	for i, value := range v {
+		values[i] = goaheadEncode(value)
+	}
+	return goaheadResult{Type: "tuple", Value: values}
+}
+
+func goaheadTuple(v ...any) goaheadValues {
+	return v
+}
+
+type goaheadMissingField string
+
+func (f goaheadMissingField) goaheadEncode() goaheadResult {
+	return goaheadResult{Type: "missing-field", Value: string(f)}
+}
+
+// goaheadElementValues are the values of a composite literal element
+type goaheadElementValues goaheadValues
+
+func (v goaheadElementValues) goaheadEncode() goaheadResult {
+	result := goaheadValues(v).goaheadEncode()
+	result.Type = "fields"
+	return result
+}
+
+// goaheadElement returns the fields of a struct for a composite literal
+// element, by name or, for unkeyed elements, by position; other values are
+// returned as they are
+func goaheadElement(v any, names ...string) any {
+	rv := goaheadreflect.ValueOf(v)
+	for rv.Kind() == goaheadreflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != goaheadreflect.Struct {
+		return v
+	}
+	values := make(goaheadElementValues, len(names))
+	for i, name := range names {
+		field := rv.FieldByName(name)
+		if name == "" {
+			name = {{.FmtAlias}}.Sprint("#", i+1)
+			if i < rv.NumField() {
+				field = rv.Field(i)
+			}
+		}
+		values[i] = goaheadMissingField(name)
+		if field.IsValid() && field.CanInterface() {
+			values[i] = field.Interface()
+		}
+	}
+	return values
+}
+
+func goaheadFields(v any, names ...string) goaheadValues {
+	rv := goaheadreflect.ValueOf(v)
+	for rv.Kind() == goaheadreflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	values := make(goaheadValues, len(names))
+	for i, name := range names {
+		values[i] = goaheadMissingField(name)
+		if rv.Kind() != goaheadreflect.Struct {
+			continue
+		}
+		if field := rv.FieldByName(name); field.IsValid() && field.CanInterface() {
+			values[i] = field.Interface()
+		}
+	}
+	return values
+}
+
+{{- if .Isolate}}
+
+// goaheadFailed is the panic of one call, which leaves the others their
+// results
+type goaheadFailed string
+
+func (f goaheadFailed) goaheadEncode() goaheadResult {
+	return goaheadResult{Type: "failed", Value: string(f)}
+}
+
+func goaheadTry(call func() any) (result any) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = goaheadFailed({{.FmtAlias}}.Sprint(r))
+		}
+	}()
+	return goaheadTimed(call)
+}
+{{- end}}
 
 func main() {
-	results := []any{
+{{- if .Harness.SetEnv}}
+	goaheadSetEnv()
+{{- end}}
+	goaheadEmit(
 {{- range .Calls}}
-		goaheadFirst({{.}}),
+{{- if $.Isolate}}
+		goaheadTry(func() any { return goaheadFirst({{.}}) }),
+{{- else}}
+		goaheadTimed(func() any { return goaheadFirst({{.}}) }),
 {{- end}}
-	}
-	for _, result := range results {
-		{{.FmtAlias}}.Printf("%#v\n", result)
-	}
+{{- end}}
+	)
 }
 `
 )
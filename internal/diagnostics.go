@@ -0,0 +1,370 @@
+package internal
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Severity of a diagnostic
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Rule IDs for diagnostics that are not skipped markers; skipped markers use
+// their SkipReason as rule ID
+const (
+	RuleDuplicateHelper  = "duplicate-helper"
+	RuleShadowedHelper   = "shadowed-helper"
+	RuleBrokenHelper     = "broken-helper"
+	RuleUnknownDirective = "unknown-directive"
+	RuleFileLocked       = "file-locked"
+	RuleTrace            = "trace"
+	RuleRunFailed        = "run-failed"
+	// RuleConversionMismatch flags a literal kept inside a conversion to a
+	// type other than the helper's result type, e.g. int32(0) for an int
+	RuleConversionMismatch = "conversion-mismatch"
+	// RuleProjectFile flags parts of .goahead.toml that goahead does not use
+	RuleProjectFile = "project-file"
+	// RuleInvalidEncoding flags source files skipped because their code,
+	// outside string literals, is not valid UTF-8
+	RuleInvalidEncoding = "invalid-encoding"
+	// RuleParanoid flags files whose rewrite -paranoid rejected
+	RuleParanoid = "paranoid-check"
+	// RuleNewerSyntax flags markers that a newer marker syntax level than
+	// the module's would read differently
+	RuleNewerSyntax = "newer-syntax"
+)
+
+// Diagnostic formats accepted by -diagnostics
+const (
+	DiagnosticsSARIF      = "sarif"
+	DiagnosticsCheckstyle = "checkstyle"
+)
+
+// ruleDescriptions documents every rule ID written to diagnostics files
+var ruleDescriptions = map[string]string{
+	string(SkipUnresolved):         "Marker names a helper that is not defined",
+	string(SkipSubmoduleIsolation): "Marker names a helper hidden by a go.mod boundary",
+	string(SkipUnexported):         "Marker names an unexported helper",
+	string(SkipNoTarget):           "Marker is not followed by a code line",
+	string(SkipNoLiteral):          "Marker target line has no literal to replace",
+	string(SkipExecFailed):         "Helper evaluation failed",
+	string(SkipOutputMismatch):     "Multi-output marker variables do not match the var block or helper results",
+	string(SkipInvalidArgument):    "Marker expression argument is not a valid Go expression",
+	string(SkipTooLarge):           "Helper value is larger than the literal size limit",
+	string(SkipUnsupportedType):    "Helper returns a type that cannot be written as a literal",
+	string(SkipOverlapping):        "Markers stacked above one line would replace the same literal",
+	RuleDuplicateHelper:            "Helper is defined more than once at the same depth",
+	RuleShadowedHelper:             "Helper shadows a helper from a shallower depth",
+	RuleBrokenHelper:               "Helper file could not be read or parsed",
+	RuleUnknownDirective:           "Unknown //go:ahead directive name",
+	RuleFileLocked:                 "Source file was skipped because another process holds its lock",
+	RuleTrace:                      "Evaluation program could not be saved to the trace directory",
+	RuleRunFailed:                  "Code generation failed",
+	RuleConversionMismatch:         "Replaced literal is converted to a type other than the helper's result type",
+	RuleProjectFile:                ".goahead.toml has a section goahead does not use",
+	string(SkipUndefinedVariable):  "Marker argument references an undefined ${variable}",
+	string(SkipConstSink):          "Marker package cannot import the -const-sink package",
+	string(SkipCompanion):          "Marker target is not a package-level variable -companion can assign",
+	string(SkipConstantOverflow):   "Numeric helper value does not fit the type of its target",
+	RuleInvalidEncoding:            "Source file was skipped because it is not valid UTF-8 outside string literals",
+	RuleParanoid:                   "Rewrite changed code outside markers and injected blocks and was undone (-paranoid)",
+}
+
+// Diagnostic is a structured warning or error produced during a run.
+// Line and Column are 1-based; zero means unknown.
+type Diagnostic struct {
+	Severity Severity
+	Rule     string
+	File     string
+	Line     int
+	Column   int
+	Message  string
+}
+
+// Diagnostics collects diagnostics for a whole run, including submodules.
+// A nil *Diagnostics is valid and records nothing.
+type Diagnostics struct {
+	mu    sync.Mutex
+	items []Diagnostic
+}
+
+// NewDiagnostics creates an empty collector
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{}
+}
+
+// Add records a diagnostic
+func (d *Diagnostics) Add(diag Diagnostic) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.items = append(d.items, diag)
+}
+
+// Items returns the recorded diagnostics
+func (d *Diagnostics) Items() []Diagnostic {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Diagnostic(nil), d.items...)
+}
+
+// Warn prints a warning to stderr and records it as a diagnostic
+func (ctx *ProcessorContext) Warn(diag Diagnostic) {
+	diag.Severity = SeverityWarning
+	ctx.events().warning(diag)
+	ctx.Diagnostics.Add(diag)
+	ctx.Stats.add(func(s *RunStats) { s.Warnings++ })
+}
+
+// Diagnostic converts a skipped marker into a diagnostic with the given severity
+func (m SkippedMarker) Diagnostic(severity Severity) Diagnostic {
+	message := fmt.Sprintf("marker %s skipped (%s)", m.Marker, m.Reason)
+	if m.Suggestion != "" {
+		message += ": " + m.Suggestion
+	}
+	if m.Trace != "" {
+		message += " (trace " + m.Trace + ")"
+	}
+	return Diagnostic{
+		Severity: severity,
+		Rule:     string(m.Reason),
+		File:     m.File,
+		Line:     m.Line,
+		Column:   m.Column,
+		Message:  message,
+	}
+}
+
+// ParseDiagnosticsSpec splits a -diagnostics value of the form format:path
+func ParseDiagnosticsSpec(spec string) (string, string, error) {
+	format, path, ok := strings.Cut(spec, ":")
+	if !ok || path == "" {
+		return "", "", fmt.Errorf("invalid -diagnostics value %q (expected %s:<path> or %s:<path>)",
+			spec, DiagnosticsSARIF, DiagnosticsCheckstyle)
+	}
+	switch format {
+	case DiagnosticsSARIF, DiagnosticsCheckstyle:
+		return format, path, nil
+	}
+	return "", "", fmt.Errorf("invalid -diagnostics format %q (expected %s or %s)", format, DiagnosticsSARIF, DiagnosticsCheckstyle)
+}
+
+// WriteDiagnostics writes diags in format to path, with file paths made
+// relative to baseDir
+func WriteDiagnostics(format, path, baseDir string, diags []Diagnostic) error {
+	diags = append([]Diagnostic(nil), diags...)
+	for i := range diags {
+		diags[i].File = diagnosticPath(baseDir, diags[i].File)
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].File != diags[j].File {
+			return diags[i].File < diags[j].File
+		}
+		return diags[i].Line < diags[j].Line
+	})
+
+	var (
+		data []byte
+		err  error
+	)
+	switch format {
+	case DiagnosticsSARIF:
+		data, err = encodeSARIF(diags)
+	case DiagnosticsCheckstyle:
+		data, err = encodeCheckstyle(diags)
+	default:
+		err = fmt.Errorf("unknown diagnostics format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode diagnostics: %v", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create diagnostics directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write diagnostics %s: %v", path, err)
+	}
+	return nil
+}
+
+func diagnosticPath(baseDir, file string) string {
+	if file == "" {
+		return ""
+	}
+	file = StripLongPathPrefix(file)
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	rel, err := filepath.Rel(baseDir, absFile)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(absFile)
+	}
+	return filepath.ToSlash(rel)
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+func encodeSARIF(diags []Diagnostic) ([]byte, error) {
+	ruleIDs := make([]string, 0, len(ruleDescriptions))
+	for id := range ruleDescriptions {
+		ruleIDs = append(ruleIDs, id)
+	}
+	sort.Strings(ruleIDs)
+	rules := make([]sarifRule, len(ruleIDs))
+	for i, id := range ruleIDs {
+		rules[i] = sarifRule{ID: id, ShortDescription: sarifMessage{Text: ruleDescriptions[id]}}
+	}
+
+	results := make([]sarifResult, 0, len(diags))
+	for _, diag := range diags {
+		result := sarifResult{
+			RuleID:  diag.Rule,
+			Level:   string(diag.Severity),
+			Message: sarifMessage{Text: diag.Message},
+		}
+		if diag.File != "" {
+			location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifact{URI: diag.File}}}
+			if diag.Line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: diag.Line, StartColumn: diag.Column}
+			}
+			result.Locations = []sarifLocation{location}
+		}
+		results = append(results, result)
+	}
+
+	log := sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "goahead",
+				Version:        Version,
+				InformationURI: "https://github.com/AeonDave/goahead",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+type checkstyleReport struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+func encodeCheckstyle(diags []Diagnostic) ([]byte, error) {
+	report := checkstyleReport{Version: "4.3"}
+	index := make(map[string]int)
+	for _, diag := range diags {
+		i, ok := index[diag.File]
+		if !ok {
+			i = len(report.Files)
+			index[diag.File] = i
+			report.Files = append(report.Files, checkstyleFile{Name: diag.File})
+		}
+		report.Files[i].Errors = append(report.Files[i].Errors, checkstyleError{
+			Line:     diag.Line,
+			Column:   diag.Column,
+			Severity: string(diag.Severity),
+			Message:  diag.Message,
+			Source:   "goahead." + diag.Rule,
+		})
+	}
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
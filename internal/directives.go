@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// DirectivePrefix starts every goahead directive line
+const DirectivePrefix = "//go:ahead"
+
+// Directive names recognized after DirectivePrefix
+const (
+	DirectiveFunctions = "functions"
+	DirectiveImport    = "import"
+	DirectiveSyntax    = "syntax"
+	DirectiveSkip      = "skip"
+	DirectiveNamespace = "namespace"
+)
+
+var knownDirectives = []string{DirectiveFunctions, DirectiveImport, DirectiveSyntax, DirectiveSkip, DirectiveNamespace}
+
+var errUnknownDirective = errors.New("unknown //go:ahead directive")
+
+// Directive is a parsed //go:ahead line
+type Directive struct {
+	Name string
+
+	// Alias and Path are set for //go:ahead import alias=path, and Version
+	// for alias=path@version
+	Alias   string
+	Path    string
+	Version string
+
+	// Level is set for //go:ahead syntax N
+	Level int
+
+	// Namespace is set for //go:ahead namespace name
+	Namespace string
+}
+
+// ImportAlias is an import override declared in a helper file, or in the
+// header of the consumer file it applies to. Version is set when the
+// directive pins the module providing Path, as in uuid=github.com/google/uuid@v1.6.0.
+type ImportAlias struct {
+	Path    string
+	Version string
+	File    string
+	Line    int
+}
+
+// String returns the path of the alias, with its version when pinned
+func (a ImportAlias) String() string {
+	if a.Version == "" {
+		return a.Path
+	}
+	return a.Path + "@" + a.Version
+}
+
+// ParseDirective parses one source line. ok is false when the line is not a
+// //go:ahead directive; err is set for malformed payloads and wraps
+// errUnknownDirective for names that are not recognized. This is the only
+// place directive syntax is interpreted.
+func ParseDirective(line string) (d Directive, ok bool, err error) {
+	rest, found := strings.CutPrefix(strings.TrimSpace(line), DirectivePrefix)
+	if !found || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return Directive{}, false, nil
+	}
+	name, payload, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	payload = strings.TrimSpace(payload)
+	d.Name = name
+
+	switch name {
+	case "":
+		return d, true, fmt.Errorf("missing directive name after %s; valid directives: %s", DirectivePrefix, strings.Join(knownDirectives, ", "))
+	case DirectiveFunctions, DirectiveSkip:
+		if payload != "" {
+			return d, true, fmt.Errorf("%s %s takes no arguments, got %q", DirectivePrefix, name, payload)
+		}
+	case DirectiveImport:
+		alias, path, hasEq := strings.Cut(payload, "=")
+		alias, path = strings.TrimSpace(alias), strings.TrimSpace(path)
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			path = unquoted
+		}
+		path, version, pinned := strings.Cut(path, "@")
+		if !hasEq || !token.IsIdentifier(alias) || path == "" || strings.ContainsAny(path, " \t\"") ||
+			(pinned && (version == "" || strings.ContainsAny(version, " \t\"@"))) {
+			return d, true, fmt.Errorf("malformed %s %s %q: expected alias=path or alias=path@version (e.g. %s %s enc=encoding/base64)",
+				DirectivePrefix, name, payload, DirectivePrefix, name)
+		}
+		d.Alias, d.Path, d.Version = alias, path, version
+	case DirectiveSyntax:
+		level, err := parseSyntaxLevel(payload)
+		if err != nil {
+			return d, true, fmt.Errorf("malformed %s %s %q: %v", DirectivePrefix, name, payload, err)
+		}
+		d.Level = level
+	case DirectiveNamespace:
+		if !token.IsIdentifier(payload) || payload == "main" || strings.HasPrefix(payload, "goahead") {
+			return d, true, fmt.Errorf("malformed %s %s %q: expected an identifier (e.g. %s %s net)",
+				DirectivePrefix, name, payload, DirectivePrefix, name)
+		}
+		d.Namespace = payload
+	default:
+		return d, true, fmt.Errorf("%w %q; valid directives: %s", errUnknownDirective, name, strings.Join(knownDirectives, ", "))
+	}
+	return d, true, nil
+}
+
+// checkDirective validates line lineNo of path. Malformed directives are
+// errors; unknown names are warnings unless -strict-directives is set, in
+// which case ok is false.
+func (fp *FileProcessor) checkDirective(path string, lineNo int, line string) (Directive, bool, error) {
+	d, ok, err := ParseDirective(line)
+	if err == nil {
+		return d, ok, nil
+	}
+	location := fmt.Sprintf("%s:%d", fp.ctx.relToRoot(path), lineNo)
+	if errors.Is(err, errUnknownDirective) && !fp.ctx.Config.StrictDirectives {
+		fp.ctx.Warn(Diagnostic{
+			Rule:    RuleUnknownDirective,
+			File:    path,
+			Line:    lineNo,
+			Message: fmt.Sprintf("%s: %v (use -strict-directives to make this an error)", location, err),
+		})
+		return d, false, nil
+	}
+	return d, false, fmt.Errorf("%s: %v", location, err)
+}
+
+// loadDirectives validates every directive of a helper file and registers
+// its import overrides, which are visible to all markers of the module, and
+// its namespace
+func (fp *FileProcessor) loadDirectives(path string, src []byte) error {
+	type pendingImport struct {
+		alias string
+		ImportAlias
+	}
+	var imports []pendingImport
+	namespaceLine := 0
+	for i, line := range strings.Split(string(src), "\n") {
+		d, ok, err := fp.checkDirective(path, i+1, line)
+		if err != nil {
+			return err
+		}
+		if ok && d.Name == DirectiveImport {
+			imports = append(imports, pendingImport{d.Alias, ImportAlias{Path: d.Path, Version: d.Version, File: path, Line: i + 1}})
+		}
+		if ok && d.Name == DirectiveSyntax {
+			if err := fp.ctx.declareSyntax(d.Level, path, i+1); err != nil {
+				return err
+			}
+		}
+		if ok && d.Name == DirectiveNamespace {
+			if namespaceLine != 0 {
+				return fmt.Errorf("%s:%d: the namespace of this file is already declared at line %d",
+					fp.ctx.relToRoot(path), i+1, namespaceLine)
+			}
+			namespaceLine = i + 1
+			if fp.ctx.HelperNamespaces == nil {
+				fp.ctx.HelperNamespaces = make(map[string]string)
+			}
+			fp.ctx.HelperNamespaces[path] = d.Namespace
+		}
+	}
+
+	if fp.ctx.ImportAliases == nil {
+		fp.ctx.ImportAliases = make(map[string]ImportAlias)
+	}
+	for _, imp := range imports {
+		if existing, seen := fp.ctx.ImportAliases[imp.alias]; seen && existing.String() != imp.String() {
+			return fmt.Errorf("%s:%d: import alias %q is already declared as %s at %s:%d",
+				fp.ctx.relToRoot(path), imp.Line, imp.alias, existing, fp.ctx.relToRoot(existing.File), existing.Line)
+		}
+	}
+	for _, imp := range imports {
+		if _, seen := fp.ctx.ImportAliases[imp.alias]; !seen {
+			fp.ctx.ImportAliases[imp.alias] = imp.ImportAlias
+		}
+	}
+	return nil
+}
+
+// fileImports returns the //go:ahead import directives of a consumer file,
+// found in its header before the package clause. They apply to the markers
+// of that file only and take precedence over the aliases of helper files.
+func (ctx *ProcessorContext) fileImports(path string, src []byte) (map[string]ImportAlias, error) {
+	var imports map[string]ImportAlias
+	for i, line := range strings.Split(string(src), "\n") {
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		d, ok, err := ParseDirective(line)
+		if errors.Is(err, errUnknownDirective) {
+			// Reported when the tree was walked
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", ctx.relToRoot(path), i+1, err)
+		}
+		if !ok || d.Name != DirectiveImport {
+			continue
+		}
+		imp := ImportAlias{Path: d.Path, Version: d.Version, File: path, Line: i + 1}
+		if existing, seen := imports[d.Alias]; seen && existing.String() != imp.String() {
+			return nil, fmt.Errorf("%s:%d: import alias %q is already declared as %s at line %d",
+				ctx.relToRoot(path), i+1, d.Alias, existing, existing.Line)
+		}
+		if shadowed, ok := ctx.ImportAliases[d.Alias]; ok && shadowed.String() != imp.String() {
+			ctx.Logger().Logf(LogScan, "[goahead] %s:%d: import alias %q uses %s instead of %s from %s:%d",
+				ctx.relToRoot(path), i+1, d.Alias, imp, shadowed, ctx.relToRoot(shadowed.File), shadowed.Line)
+		}
+		if imports == nil {
+			imports = make(map[string]ImportAlias)
+		}
+		imports[d.Alias] = imp
+	}
+	return imports, nil
+}
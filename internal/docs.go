@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// helperDocFile is the documentation of one helper file
+type helperDocFile struct {
+	Path    string // relative to the documented root, slash-separated
+	Depth   int
+	Funcs   []helperDocFunc
+	Imports []helperDocImport
+}
+
+type helperDocFunc struct {
+	Name      string
+	Signature string
+	Doc       string
+	Example   string
+}
+
+type helperDocImport struct {
+	Alias string
+	Path  string
+	Line  int
+}
+
+// GenerateHelperDocs renders Markdown documentation for the helper files of
+// config.Dir: every exported helper with its signature, doc comment, depth
+// and an example marker, followed by the import overrides declared with
+// //go:ahead import. Submodules are not included; document them separately.
+func GenerateHelperDocs(config Config) (string, error) {
+	if err := config.applyProjectSettings(); err != nil {
+		return "", err
+	}
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+	config.compileMarkerSyntax()
+	absDir, err := filepath.Abs(config.Dir)
+	if err != nil {
+		absDir = config.Dir
+	}
+	ctx := &ProcessorContext{
+		FunctionsByDir:   make(map[string]map[string]*UserFunction),
+		FunctionsByDepth: make(map[int]map[string]*UserFunction),
+		RootDir:          absDir,
+		Log:              NewLogger(config.LogCategories),
+		FileSet:          token.NewFileSet(),
+		Config:           config,
+	}
+	if _, err := NewFileProcessor(ctx).CollectAllGoFiles(absDir); err != nil {
+		return "", fmt.Errorf("failed to collect files: %v", err)
+	}
+	if len(ctx.BrokenHelpers) > 0 {
+		return "", &HelperLoadError{Files: ctx.BrokenHelpers, root: absDir}
+	}
+
+	files := make([]helperDocFile, 0, len(ctx.FuncFiles))
+	for _, path := range ctx.FuncFiles {
+		file, err := documentHelperFile(ctx, path)
+		if err != nil {
+			return "", err
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return renderHelperDocs(files), nil
+}
+
+func documentHelperFile(ctx *ProcessorContext, path string) (helperDocFile, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return helperDocFile{}, fmt.Errorf("failed to read helper file %s: %v", path, err)
+	}
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return helperDocFile{}, fmt.Errorf("failed to parse helper file %s: %v", path, err)
+	}
+
+	doc := helperDocFile{Path: ctx.relToRoot(path), Depth: ctx.HelperFileDepth(path)}
+	for _, decl := range node.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || !fn.Name.IsExported() {
+			continue
+		}
+		doc.Funcs = append(doc.Funcs, helperDocFunc{
+			Name:      fn.Name.Name,
+			Signature: funcSignature(fset, fn),
+			Doc:       strings.TrimSpace(fn.Doc.Text()),
+			Example:   exampleMarker(ctx.MarkerSyntax().Prefix(), fn),
+		})
+	}
+	for i, line := range strings.Split(string(src), "\n") {
+		d, ok, err := ParseDirective(line)
+		if err != nil && !errors.Is(err, errUnknownDirective) {
+			return helperDocFile{}, fmt.Errorf("%s:%d: %v", doc.Path, i+1, err)
+		}
+		if ok && d.Name == DirectiveImport {
+			doc.Imports = append(doc.Imports, helperDocImport{Alias: d.Alias, Path: ImportAlias{Path: d.Path, Version: d.Version}.String(), Line: i + 1})
+		}
+	}
+	return doc, nil
+}
+
+// funcSignature prints fn's declaration without its body or doc comment
+func funcSignature(fset *token.FileSet, fn *ast.FuncDecl) string {
+	decl := &ast.FuncDecl{Name: fn.Name, Type: fn.Type}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, decl); err != nil {
+		return "func " + fn.Name.Name + "(...)"
+	}
+	return buf.String()
+}
+
+// exampleMarker synthesizes a marker with prefix and a target line from
+// fn's parameter and result types
+func exampleMarker(prefix string, fn *ast.FuncDecl) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteString(fn.Name.Name)
+	for _, typ := range fieldTypes(fn.Type.Params) {
+		b.WriteString(":")
+		b.WriteString(exampleArgument(typ))
+	}
+
+	results := fieldTypes(fn.Type.Results)
+	target := "value"
+	if len(results) > 0 {
+		if zero := exampleZero(results[0]); zero != "" {
+			fmt.Fprintf(&b, "\nvar %s = %s", target, zero)
+			return b.String()
+		}
+		fmt.Fprintf(&b, "\nvar %s %s", target, results[0])
+		return b.String()
+	}
+	return b.String()
+}
+
+func exampleArgument(typ string) string {
+	if elem, ok := strings.CutPrefix(typ, "..."); ok {
+		return exampleArgument(elem)
+	}
+	switch mapOutputType(typ) {
+	case "string":
+		return `"example"`
+	case "int", "uint":
+		return "1"
+	case "float":
+		return "1.5"
+	case "bool":
+		return "true"
+	}
+	switch {
+	case typ == "[]byte":
+		return `=[]byte("example")`
+	case strings.HasPrefix(typ, "*"), strings.HasPrefix(typ, "[]"), strings.HasPrefix(typ, "map["),
+		strings.HasPrefix(typ, "func"), strings.HasPrefix(typ, "chan"), typ == "interface{}", typ == "any", typ == "error":
+		return "=nil"
+	default:
+		return "=" + typ + "{}"
+	}
+}
+
+func exampleZero(typ string) string {
+	switch mapOutputType(typ) {
+	case "string":
+		return `""`
+	case "int", "uint":
+		return "0"
+	case "float":
+		return "0.0"
+	case "bool":
+		return "false"
+	}
+	return ""
+}
+
+func renderHelperDocs(files []helperDocFile) string {
+	var b strings.Builder
+	b.WriteString("# Helper functions\n\n")
+	b.WriteString("<!-- Generated by goahead docs; do not edit. -->\n")
+	if len(files) == 0 {
+		b.WriteString("\nNo helper files found.\n")
+		return b.String()
+	}
+
+	var imports []string
+	for _, file := range files {
+		fmt.Fprintf(&b, "\n## %s\n\n", file.Path)
+		fmt.Fprintf(&b, "Depth %d.", file.Depth)
+		if len(file.Funcs) == 0 {
+			b.WriteString(" No exported helpers.\n")
+			continue
+		}
+		b.WriteString("\n")
+		for _, fn := range file.Funcs {
+			fmt.Fprintf(&b, "\n### %s\n\n", fn.Name)
+			fmt.Fprintf(&b, "```go\n%s\n```\n", fn.Signature)
+			if fn.Doc != "" {
+				fmt.Fprintf(&b, "\n%s\n", fn.Doc)
+			}
+			fmt.Fprintf(&b, "\nExample:\n\n```go\n%s\n```\n", fn.Example)
+		}
+		for _, imp := range file.Imports {
+			imports = append(imports, fmt.Sprintf("| `%s` | `%s` | %s:%d |", imp.Alias, imp.Path, file.Path, imp.Line))
+		}
+	}
+
+	if len(imports) > 0 {
+		b.WriteString("\n## Import overrides\n\n")
+		b.WriteString("| Alias | Package | Declared at |\n")
+		b.WriteString("|-------|---------|-------------|\n")
+		for _, row := range imports {
+			b.WriteString(row)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
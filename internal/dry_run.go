@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// dryRun is a -dry-run: the run writes its rewrites, and the files it
+// creates, in memory instead of on disk, and the files it changed are
+// printed as diffs against the sources, which are never written. Its read
+// and write methods go to the disk on a nil *dryRun.
+type dryRun struct {
+	// root is the module root of the sources; diffs name files from it
+	root string
+
+	mu sync.Mutex
+	// files holds what the run wrote by absolute path, nil for a file it
+	// removed
+	files map[string][]byte
+}
+
+// startDryRun prepares a dry run of the module holding dir
+func startDryRun(dir string) (*dryRun, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", dir, err)
+	}
+	root := findModuleRoot(absDir)
+	if root == "" {
+		root = absDir
+	}
+	return &dryRun{root: root, files: make(map[string][]byte)}, nil
+}
+
+// readFile returns the content of path as the run left it
+func (dry *dryRun) readFile(path string) ([]byte, error) {
+	if dry != nil {
+		dry.mu.Lock()
+		content, ok := dry.files[absPath(path)]
+		dry.mu.Unlock()
+		if ok && content == nil {
+			return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+		}
+		if ok {
+			return content, nil
+		}
+	}
+	return os.ReadFile(path)
+}
+
+// writeFile replaces the content of path
+func (dry *dryRun) writeFile(path string, content []byte) error {
+	if dry == nil {
+		return writeFileAtomic(path, content)
+	}
+	if content == nil {
+		content = []byte{}
+	}
+	dry.mu.Lock()
+	defer dry.mu.Unlock()
+	dry.files[absPath(path)] = content
+	return nil
+}
+
+// removeFile removes path
+func (dry *dryRun) removeFile(path string) error {
+	if dry == nil {
+		return os.Remove(path)
+	}
+	dry.mu.Lock()
+	defer dry.mu.Unlock()
+	dry.files[absPath(path)] = nil
+	return nil
+}
+
+// report writes a unified diff to w for each file the run changed, created
+// or removed, and returns how many there are
+func (dry *dryRun) report(w io.Writer) (int, error) {
+	dry.mu.Lock()
+	defer dry.mu.Unlock()
+	paths := make([]string, 0, len(dry.files))
+	for path := range dry.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	pending := 0
+	for _, path := range paths {
+		after := dry.files[path]
+		rel, err := filepath.Rel(dry.root, path)
+		if err != nil {
+			rel = path
+		}
+		rel = filepath.ToSlash(rel)
+		oldName, newName := "a/"+rel, "b/"+rel
+		before, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			if after == nil {
+				continue
+			}
+			oldName = "/dev/null"
+		} else if err != nil {
+			return pending, fmt.Errorf("failed to read %s: %v", rel, err)
+		}
+		if after == nil {
+			newName = "/dev/null"
+		}
+		if bytes.Equal(before, after) && after != nil {
+			continue
+		}
+		pending++
+		if _, err := io.WriteString(w, UnifiedDiff(oldName, newName, string(before), string(after))); err != nil {
+			return pending, err
+		}
+	}
+	return pending, nil
+}
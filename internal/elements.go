@@ -0,0 +1,229 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// compositeElement is an element of a composite literal written on one line,
+// such as {Name: "", Hash: ""} in a table of structs. A marker above it whose
+// helper returns one value per field, or a struct, fills it field by field.
+// The values of a multi-assignment such as host, port := "", 0 are filled
+// the same way, as an unkeyed element.
+type compositeElement struct {
+	fields []elementField
+	// assignment is set for the values of a multi-assignment
+	assignment bool
+}
+
+// elementField is one field of a compositeElement
+type elementField struct {
+	// key is the field name, "" in unkeyed elements
+	key string
+	// start and end are the byte offsets of the value in the line
+	start, end int
+	// kind is the literalKind of the value, "" when it is not a literal
+	kind string
+	// variable is the variable assigned the value in a multi-assignment
+	variable string
+}
+
+// elementTypePattern matches what may precede the opening brace of an
+// element: nothing, or its type as in &Target{...} or pkg.Target{...}
+var elementTypePattern = regexp.MustCompile(`^\s*&?(?:[A-Za-z_]\w*(?:\.[A-Za-z_]\w*)?)?$`)
+
+// parseElement returns the element on line, or nil when line does not hold
+// exactly one composite literal element, followed at most by a comma and a
+// comment. line has no tags.
+func parseElement(line string) *compositeElement {
+	open := strings.IndexByte(line, '{')
+	if open < 0 || !elementTypePattern.MatchString(line[:open]) {
+		return nil
+	}
+	end := elementEnd(line[open:])
+	if end < 0 {
+		return nil
+	}
+	expr, err := parser.ParseExpr("T" + line[open:open+end])
+	if err != nil {
+		return nil
+	}
+	literal, ok := expr.(*ast.CompositeLit)
+	if !ok || len(literal.Elts) == 0 {
+		return nil
+	}
+	// Positions start at 1, and "T" stands before the brace
+	offset := func(pos token.Pos) int { return open + int(pos) - 2 }
+	element := &compositeElement{}
+	for _, elt := range literal.Elts {
+		field := elementField{}
+		value := elt
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			key, ok := kv.Key.(*ast.Ident)
+			if !ok {
+				return nil
+			}
+			field.key, value = key.Name, kv.Value
+		}
+		field.start, field.end = offset(value.Pos()), offset(value.End())
+		field.kind = elementValueKind(value)
+		element.fields = append(element.fields, field)
+	}
+	return element
+}
+
+// parseMultiAssignment returns the values of a multi-assignment on line,
+// such as host, port := "", 0 or var lo, hi int = 0, 0, as an unkeyed
+// element whose fields are named after the variables; nil for other lines.
+// line has no tags.
+func parseMultiAssignment(line string) *compositeElement {
+	head, value, _, ok := splitAssignment(line)
+	if !ok {
+		return nil
+	}
+	lhs := strings.TrimSpace(head)
+	lhs = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(lhs, "="), ":"))
+	decl := false
+	for _, keyword := range []string{"var", "const"} {
+		if rest, ok := strings.CutPrefix(lhs, keyword+" "); ok {
+			lhs, decl = strings.TrimSpace(rest), true
+		}
+	}
+	names := strings.Split(lhs, ",")
+	if len(names) < 2 {
+		return nil
+	}
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		// The type of a declaration follows its last name
+		if words := strings.Fields(name); decl && i == len(names)-1 && len(words) > 1 {
+			name = words[0]
+		}
+		if _, err := parser.ParseExpr(name); err != nil || name == "" {
+			return nil
+		}
+		names[i] = name
+	}
+
+	expr, err := parser.ParseExpr("T{" + value + "}")
+	if err != nil {
+		return nil
+	}
+	literal, ok := expr.(*ast.CompositeLit)
+	if !ok || len(literal.Elts) != len(names) {
+		return nil
+	}
+	// Positions start at 1, and "T{" stands before the values
+	offset := func(pos token.Pos) int { return len(head) + int(pos) - 3 }
+	element := &compositeElement{assignment: true}
+	for i, elt := range literal.Elts {
+		if _, ok := elt.(*ast.KeyValueExpr); ok {
+			return nil
+		}
+		element.fields = append(element.fields, elementField{
+			start: offset(elt.Pos()), end: offset(elt.End()), kind: elementValueKind(elt), variable: names[i],
+		})
+	}
+	return element
+}
+
+// elementEnd returns the length of the element that src starts with, or -1
+// when anything but a comma and a comment follows it
+func elementEnd(src string) int {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, scanner.ScanComments)
+	depth, end, comma := 0, -1, false
+	for {
+		pos, tok, lit := s.Scan()
+		switch {
+		case tok == token.EOF:
+			return end
+		case end < 0 && tok == token.LBRACE:
+			depth++
+		case end < 0 && tok == token.RBRACE:
+			if depth--; depth == 0 {
+				end = file.Offset(pos) + 1
+			}
+		case end < 0:
+			if tok == token.ILLEGAL {
+				return -1
+			}
+		case tok == token.COMMA && !comma:
+			comma = true
+		case tok == token.COMMENT, tok == token.SEMICOLON && lit == "\n":
+		default:
+			return -1
+		}
+	}
+}
+
+// elementValueKind returns the literalKind of a field value, "" when it is
+// not a literal
+func elementValueKind(value ast.Expr) string {
+	if unary, ok := value.(*ast.UnaryExpr); ok && (unary.Op == token.SUB || unary.Op == token.ADD) {
+		value = unary.X
+		if lit, ok := value.(*ast.BasicLit); !ok || lit.Kind == token.STRING {
+			return ""
+		}
+	}
+	switch v := value.(type) {
+	case *ast.BasicLit:
+		switch v.Kind {
+		case token.STRING:
+			return "string"
+		case token.FLOAT:
+			return "float"
+		case token.INT, token.CHAR:
+			return "int"
+		}
+	case *ast.Ident:
+		if v.Name == "true" || v.Name == "false" {
+			return "bool"
+		}
+	}
+	return ""
+}
+
+// noun names e in messages
+func (e *compositeElement) noun() string {
+	if e.assignment {
+		return "assignment"
+	}
+	return "element"
+}
+
+// keys returns the field keys of e, "" for unkeyed fields
+func (e *compositeElement) keys() []string {
+	keys := make([]string, len(e.fields))
+	for i, field := range e.fields {
+		keys[i] = field.key
+	}
+	return keys
+}
+
+// name describes the i-th field in messages
+func (f elementField) name(i int) string {
+	if f.variable != "" {
+		return f.variable
+	}
+	if f.key != "" {
+		return f.key
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// describe names the i-th field in messages with what it is, "field Name"
+// or "variable host"
+func (f elementField) describe(i int) string {
+	if f.variable != "" {
+		return "variable " + f.variable
+	}
+	return "field " + f.name(i)
+}
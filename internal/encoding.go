@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// utf8BOM is the byte order mark some Windows editors write at the start of
+// UTF-8 files. Go accepts it there; goahead keeps it and re-emits it
+// unchanged when rewriting the file.
+const utf8BOM = "\ufeff"
+
+// splitBOM separates a leading byte order mark from content
+func splitBOM(content string) (bom, rest string) {
+	if strings.HasPrefix(content, utf8BOM) {
+		return utf8BOM, content[len(utf8BOM):]
+	}
+	return "", content
+}
+
+// invalidUTF8Offset returns the byte offset of the first invalid UTF-8
+// sequence of src outside string and rune literals, or -1. Bytes inside
+// literals are carried through rewrites untouched, so only the code around
+// them has to be readable.
+func invalidUTF8Offset(src string) int {
+	bom, src := splitBOM(src)
+	base := len(bom)
+	for i := 0; i < len(src); {
+		switch c := src[i]; {
+		case c == '"' || c == '\'':
+			i = skipQuoted(src, i, c)
+		case c == '`':
+			end := strings.IndexByte(src[i+1:], '`')
+			if end < 0 {
+				return -1
+			}
+			i += end + 2
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			if !utf8.ValidString(src[i : i+end]) {
+				return base + i + invalidIndex(src[i:i+end])
+			}
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			if !utf8.ValidString(src[i : i+end+2]) {
+				return base + i + invalidIndex(src[i:i+end+2])
+			}
+			i += end + 4
+		case c < utf8.RuneSelf:
+			i++
+		default:
+			r, size := utf8.DecodeRuneInString(src[i:])
+			if r == utf8.RuneError && size == 1 {
+				return base + i
+			}
+			i += size
+		}
+	}
+	return -1
+}
+
+// skipQuoted returns the offset just past the "..." or '...' literal
+// starting at start; an unterminated literal ends at the end of its line
+func skipQuoted(src string, start int, quote byte) int {
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			return i
+		}
+	}
+	return len(src)
+}
+
+// invalidIndex returns the offset of the first invalid sequence of s
+func invalidIndex(s string) int {
+	for i, r := range s {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size == 1 {
+				return i
+			}
+		}
+	}
+	return 0
+}
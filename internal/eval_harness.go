@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// evalHarness is the part of the data of the evaluation templates that
+// evalHarnessCode renders: the goaheadNow clock and the -env variables
+type evalHarness struct {
+	// Clock is the Go expression goaheadNow is set to
+	Clock string
+	// SetEnv makes main call goaheadSetEnv first
+	SetEnv     bool
+	EnvIsolate bool
+	// Env holds the quoted key and value arguments of each os.Setenv call
+	Env []string
+}
+
+// harness returns the evalHarness of the run's -freeze-time, -env and
+// -env-isolate; Validate has already rejected malformed values
+func (fe *FunctionExecutor) harness() evalHarness {
+	cfg := fe.ctx.Config
+	h := evalHarness{Clock: "goaheadtime.Now", EnvIsolate: cfg.EnvIsolate}
+	if cfg.FreezeTime != "" {
+		frozen, _ := time.Parse(time.RFC3339Nano, cfg.FreezeTime)
+		h.Clock = frozenClock(frozen)
+	}
+	for _, entry := range cfg.Env {
+		key, value, _ := strings.Cut(entry, "=")
+		h.Env = append(h.Env, strconv.Quote(key)+", "+strconv.Quote(value))
+	}
+	h.SetEnv = h.EnvIsolate || len(h.Env) > 0
+	return h
+}
+
+// frozenClock returns a function literal that always returns t, in its
+// original offset
+func frozenClock(t time.Time) string {
+	instant := fmt.Sprintf("goaheadtime.Unix(%d, %d)", t.Unix(), t.Nanosecond())
+	if _, offset := t.Zone(); offset != 0 {
+		instant += fmt.Sprintf(".In(goaheadtime.FixedZone(%q, %d))", t.Format("-07:00"), offset)
+	} else {
+		instant += ".UTC()"
+	}
+	return "func() goaheadtime.Time { return " + instant + " }"
+}
+
+// validateHarness checks the -freeze-time and -env values of c
+func (c Config) validateHarness() error {
+	if c.FreezeTime != "" {
+		if _, err := time.Parse(time.RFC3339Nano, c.FreezeTime); err != nil {
+			return fmt.Errorf("invalid -freeze-time %q (expected an RFC 3339 time such as 2026-01-22T17:49:00Z)", c.FreezeTime)
+		}
+	}
+	for _, entry := range c.Env {
+		if key, _, ok := strings.Cut(entry, "="); !ok || key == "" {
+			return fmt.Errorf("invalid -env %q (expected KEY=VALUE)", entry)
+		}
+	}
+	return nil
+}
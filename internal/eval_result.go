@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// evalResult is one value written by an evaluation program (see
+// evalResultCode)
+type evalResult struct {
+	Type     string          `json:"type"`
+	Encoding string          `json:"encoding"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// decodeEvalOutput reads the result line of an evaluation program's stdout
+// and returns each of its n results as Go source text, the form the rest of
+// goahead works with: quoted strings, []byte{...} and %#v for other values.
+// The tab-separated values of a tuple are those of a multi-output marker.
+// durations holds the run time of each call, nil when the program sent
+// none. Output printed before the result line is returned as helperOutput.
+func decodeEvalOutput(stdout string, n int) (results []string, durations []time.Duration, helperOutput string, err error) {
+	stdout = strings.ReplaceAll(stdout, "\r\n", "\n")
+	start := strings.LastIndex("\n"+stdout, "\n"+EvalResultPrefix)
+	if start < 0 {
+		return nil, nil, strings.TrimSpace(stdout), fmt.Errorf("evaluation program printed no result line; stdout:\n%s", stdout)
+	}
+	line := stdout[start+len(EvalResultPrefix):]
+	if end := strings.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	helperOutput = strings.TrimSpace(stdout[:start])
+
+	var payload struct {
+		Results   []evalResult `json:"results"`
+		Durations []int64      `json:"durations"`
+	}
+	if err := json.Unmarshal([]byte(line), &payload); err != nil {
+		return nil, nil, helperOutput, fmt.Errorf("invalid result line from evaluation program: %v", err)
+	}
+	if len(payload.Results) != n {
+		return nil, nil, helperOutput, fmt.Errorf("unexpected batch output: expected %d results got %d", n, len(payload.Results))
+	}
+	results = make([]string, n)
+	for i, result := range payload.Results {
+		if results[i], err = result.literal(); err != nil {
+			return nil, nil, helperOutput, fmt.Errorf("invalid result %d from evaluation program: %v", i+1, err)
+		}
+	}
+	if len(payload.Durations) == n {
+		durations = make([]time.Duration, n)
+		for i, d := range payload.Durations {
+			durations[i] = time.Duration(d)
+		}
+	}
+	return results, durations, helperOutput, nil
+}
+
+// literal returns r as Go source text
+func (r evalResult) literal() (string, error) {
+	switch r.Type {
+	case "string", "bytes":
+		var text string
+		if err := json.Unmarshal(r.Value, &text); err != nil {
+			return "", err
+		}
+		if r.Encoding == "base64" {
+			data, err := base64.StdEncoding.DecodeString(text)
+			if err != nil {
+				return "", err
+			}
+			if r.Type == "bytes" {
+				return fmt.Sprintf("%#v", data), nil
+			}
+			text = string(data)
+		}
+		return strconv.Quote(text), nil
+	case "tuple", "fields":
+		var values []evalResult
+		if err := json.Unmarshal(r.Value, &values); err != nil {
+			return "", err
+		}
+		literals := make([]string, len(values))
+		for i, value := range values {
+			literal, err := value.literal()
+			if err != nil {
+				return "", err
+			}
+			literals[i] = literal
+		}
+		if r.Type == "fields" {
+			return ElementFieldsPrefix + strings.Join(literals, "\t"), nil
+		}
+		return strings.Join(literals, "\t"), nil
+	case "skip":
+		return SkipResult, nil
+	case "missing-field", "failed":
+		var text string
+		if err := json.Unmarshal(r.Value, &text); err != nil {
+			return "", err
+		}
+		if r.Type == "failed" {
+			return EvalFailedPrefix + text, nil
+		}
+		return MissingFieldPrefix + text, nil
+	default:
+		var text string
+		if err := json.Unmarshal(r.Value, &text); err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(r.Type, "[") || strings.HasPrefix(r.Type, "map[") {
+			text = gofmtComposite(text)
+		}
+		// %#v spells byte arrays [N]uint8{...}
+		if strings.HasPrefix(r.Type, "[") && strings.HasSuffix(r.Type, "]uint8") {
+			text = strings.Replace(text, "]uint8{", "]byte{", 1)
+		}
+		return text, nil
+	}
+}
+
+// gofmtComposite prints the %#v text of a slice, array or map the way gofmt
+// would, map[string]int{"a": 1} rather than map[string]int{"a":1}; text
+// that does not parse is returned as is
+func gofmtComposite(text string) string {
+	fset := token.NewFileSet()
+	expr, err := parser.ParseExprFrom(fset, "", text, 0)
+	if err != nil {
+		return text
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, expr); err != nil {
+		return text
+	}
+	return buf.String()
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the file at the module root listing, in gitignore
+// syntax, the paths goahead never walks
+const IgnoreFileName = ".goaheadignore"
+
+// excludeRule is one -exclude glob or one pattern of the ignore file
+type excludeRule struct {
+	// source names the rule in messages: -exclude "gen/**" or
+	// .goaheadignore:3 (gen/)
+	source  string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// excludeRules are the exclusions of one module: the patterns of its ignore
+// file, then the -exclude globs, all relative to root. As in gitignore the
+// last rule matching a path decides, and nothing under an excluded
+// directory can be included again.
+type excludeRules struct {
+	root  string
+	rules []excludeRule
+}
+
+// loadExcludeRules reads the ignore file of root, if any, and adds globs, the
+// -exclude values. It returns nil when there is nothing to exclude.
+func loadExcludeRules(root string, globs []string) (*excludeRules, error) {
+	rules := &excludeRules{root: root}
+	path := filepath.Join(root, IgnoreFileName)
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	default:
+		defer func() { _ = f.Close() }()
+		scanner := bufio.NewScanner(f)
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line := strings.TrimRight(scanner.Text(), " \t\r")
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			rule, err := parseIgnorePattern(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+			}
+			rule.source = fmt.Sprintf("%s:%d (%s)", IgnoreFileName, lineNo, line)
+			rules.rules = append(rules.rules, rule)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+	}
+	for _, glob := range globs {
+		rule, err := parseExcludeGlob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -exclude pattern %q: %v", glob, err)
+		}
+		rule.source = fmt.Sprintf("-exclude %q", glob)
+		rules.rules = append(rules.rules, rule)
+	}
+	if len(rules.rules) == 0 {
+		return nil, nil
+	}
+	return rules, nil
+}
+
+// parseIgnorePattern parses one gitignore pattern: "!" negates it, a
+// trailing "/" matches directories only, and a pattern without a "/" before
+// its end matches at any depth
+func parseIgnorePattern(pattern string) (excludeRule, error) {
+	var rule excludeRule
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate, pattern = true, pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly, pattern = true, strings.TrimRight(pattern, "/")
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return rule, fmt.Errorf("empty pattern")
+	}
+	re, err := globRegexp(pattern, anchored)
+	rule.re = re
+	return rule, err
+}
+
+// parseExcludeGlob parses an -exclude value, a doublestar glob relative to
+// the module root such as gen/** or **/testdata/**
+func parseExcludeGlob(glob string) (excludeRule, error) {
+	var rule excludeRule
+	pattern := filepath.ToSlash(glob)
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly, pattern = true, strings.TrimRight(pattern, "/")
+	}
+	pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, "./"), "/")
+	if pattern == "" {
+		return rule, fmt.Errorf("empty pattern")
+	}
+	re, err := globRegexp(pattern, true)
+	rule.re = re
+	return rule, err
+}
+
+// globRegexp compiles a glob over slash-separated paths: "*" and "?" stay
+// within one element, "**" spans any number of them and [...] is a class.
+// An unanchored glob may match the trailing elements of a path.
+func globRegexp(glob string, anchored bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in %q", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// match returns the source of the rule excluding the absolute path abs, a
+// directory when isDir is set, or "" when it is not excluded. Paths outside
+// the root are never excluded.
+func (r *excludeRules) match(abs string, isDir bool) string {
+	if r == nil || !PathWithin(abs, r.root) || abs == r.root {
+		return ""
+	}
+	rel, err := filepath.Rel(r.root, abs)
+	if err != nil {
+		return ""
+	}
+	elems := strings.Split(filepath.ToSlash(rel), "/")
+	for i := 1; i <= len(elems); i++ {
+		path, dir := strings.Join(elems[:i], "/"), i < len(elems) || isDir
+		var last *excludeRule
+		for j := range r.rules {
+			rule := &r.rules[j]
+			if (!rule.dirOnly || dir) && rule.re.MatchString(path) {
+				last = rule
+			}
+		}
+		if last != nil && !last.negate {
+			return last.source
+		}
+	}
+	return ""
+}
+
+// loadExclude reads the exclusions of the module holding absRootDir, or of
+// absRootDir itself outside a module
+func (ctx *ProcessorContext) loadExclude(absRootDir string) error {
+	root := findModuleRoot(absRootDir)
+	if root == "" {
+		root = absRootDir
+	}
+	rules, err := loadExcludeRules(root, ctx.Config.Exclude)
+	if err != nil {
+		return err
+	}
+	ctx.exclude = rules
+	return nil
+}
+
+// excludedBy returns the rule excluding path, "" when none does
+func (ctx *ProcessorContext) excludedBy(path string, isDir bool) string {
+	if ctx.exclude == nil {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	return ctx.exclude.match(abs, isDir)
+}
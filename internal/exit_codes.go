@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit statuses of the goahead command. A run that had nothing to do and
+// one that replaced values both exit with ExitOK.
+const (
+	ExitOK = 0
+	// ExitMarkerErrors reports markers or helpers that are wrong: skipped
+	// markers under -strict, helpers that failed or broken helper files
+	ExitMarkerErrors = 1
+	// ExitEnvironment reports a run that could not do its work: invalid
+	// flags, a missing directory or go toolchain, files it cannot write
+	ExitEnvironment = 2
+	// ExitWarnings reports a run that succeeded with warnings or skipped
+	// markers; only with -warnings-exit-code=3, such a run exits with ExitOK
+	// otherwise
+	ExitWarnings = 3
+	// ExitInternal reports a bug in goahead, such as a panic
+	ExitInternal = 4
+	// ExitPendingChanges reports a -dry-run that found files to change; it
+	// has the value of ExitMarkerErrors, so CI fails either way
+	ExitPendingChanges = 1
+)
+
+// Sentinels wrapped by the errors of a run, so callers can classify them
+// with errors.Is; ExitCode maps them to exit statuses
+var (
+	// ErrUnresolvedMarker is wrapped by the -strict error for skipped markers
+	ErrUnresolvedMarker = errors.New("unresolved marker")
+	// ErrExecution is also wrapped by it when a helper failed
+	ErrExecution = errors.New("helper execution failed")
+	// ErrEnvironment is wrapped by errors of the setup rather than of the
+	// sources: the configuration, the go toolchain and the file system
+	ErrEnvironment = errors.New("environment error")
+)
+
+// classifiedError adds sentinels to an error without changing its message
+type classifiedError struct {
+	err   error
+	kinds []error
+}
+
+func (e *classifiedError) Error() string { return e.err.Error() }
+
+func (e *classifiedError) Unwrap() []error { return append([]error{e.err}, e.kinds...) }
+
+// classify wraps err, if not nil, with the sentinels kinds
+func classify(err error, kinds ...error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{err: err, kinds: kinds}
+}
+
+// environmentErrorf is fmt.Errorf for errors wrapping ErrEnvironment
+func environmentErrorf(format string, args ...any) error {
+	return classify(fmt.Errorf(format, args...), ErrEnvironment)
+}
+
+// ExitCode returns the exit status for err, returned by a run: ExitOK for
+// nil and InterruptExitCode for an interrupted run. Errors that wrap no
+// sentinel come from the sources and exit with ExitMarkerErrors.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrInterrupted):
+		return InterruptExitCode
+	case errors.Is(err, ErrEnvironment):
+		return ExitEnvironment
+	}
+	return ExitMarkerErrors
+}
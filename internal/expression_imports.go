@@ -0,0 +1,367 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// qualifiedPathPattern matches an import path qualified identifier such as
+// myapp/internal/config.EnvPrefix; group 1 is the path, group 2 the name
+var qualifiedPathPattern = regexp.MustCompile(`([A-Za-z0-9_~-]+(?:\.[A-Za-z0-9_~-]+)*(?:/[A-Za-z0-9_.~-]+)+)\.([A-Za-z_]\w*)`)
+
+// evalCompileErrorPattern matches a compile error of an evaluation program;
+// group 1 is the message
+var evalCompileErrorPattern = regexp.MustCompile(`goahead_eval_\w+\.go:\d+:\d+: (.+)`)
+
+// argumentImports lists the packages the expression arguments of one call
+// need in the evaluation program
+type argumentImports struct {
+	specs []string
+	// inModule is set when a package of the evaluating module is imported;
+	// the program must then live inside the module to see internal packages
+	inModule bool
+	// pins are the directives pinning the modules of imported aliases
+	pins []pinnedImport
+}
+
+// resolveArgumentImports finds the packages referenced by "=expr" arguments.
+// Import path qualified identifiers (=myapp/internal/config.EnvPrefix) are
+// rewritten to the package name, and selectors on names declared with
+// //go:ahead import or standard library packages (=config.EnvPrefix) are
+// imported as well. A path inside the module must name a package there.
+func (fe *FunctionExecutor) resolveArgumentImports(args []argument, sourceDir string) ([]argument, argumentImports, error) {
+	var imports argumentImports
+	root := fe.projectRoot(sourceDir)
+	modulePath := readModulePath(filepath.Join(root, "go.mod"))
+	specs := make(map[string]bool)
+	addImport := func(index int, name, path string) error {
+		if local, ok := modulePackageDir(root, modulePath, path); ok {
+			if !isPackageDir(local) {
+				return fmt.Errorf("argument %d: package %s not found in module %s (no Go files in %s)",
+					index+1, path, modulePath, filepath.ToSlash(local))
+			}
+			imports.inModule = true
+		}
+		specs[buildImportSpec(name, path)] = true
+		return nil
+	}
+
+	resolved := make([]argument, len(args))
+	for i, arg := range args {
+		resolved[i] = arg
+		if !arg.ForceExpression {
+			continue
+		}
+
+		expr, paths := qualifyImportPaths(arg.Raw, modulePath)
+		for name, path := range paths {
+			if err := addImport(i, name, path); err != nil {
+				return nil, argumentImports{}, err
+			}
+		}
+		resolved[i].Raw, resolved[i].Normalized = expr, expr
+
+		parsed, err := parser.ParseExpr(expr)
+		if err != nil {
+			continue // reported when the program is compiled
+		}
+		var names []string
+		ast.Inspect(parsed, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok && paths[ident.Name] == "" {
+					names = append(names, ident.Name)
+				}
+			}
+			return true
+		})
+		for _, name := range names {
+			if path, pin, ok := fe.resolveImportPath(name); ok {
+				if err := addImport(i, name, path); err != nil {
+					return nil, argumentImports{}, err
+				}
+				imports.pins = addPin(imports.pins, pin)
+			}
+		}
+	}
+
+	for spec := range specs {
+		imports.specs = append(imports.specs, spec)
+	}
+	sort.Strings(imports.specs)
+	return resolved, imports, nil
+}
+
+// expressionTarget resolves a callable expression used as the function of a
+// marker, such as strings.NewReplacer("a", "b").Replace or
+// NewGreeter("hi").Greet. Its leftmost identifier must name a helper or a
+// package, which is then imported; the arguments are passed as written.
+func (fe *FunctionExecutor) expressionTarget(funcName, sourceDir string) (callTarget, error) {
+	expr, err := parser.ParseExpr(funcName)
+	if err != nil {
+		return callTarget{}, fmt.Errorf("function expression %s: %v", funcName, err)
+	}
+	root := leftmostIdent(expr)
+	if root == nil {
+		return callTarget{}, fmt.Errorf("function expression %s must start with a helper or package name", funcName)
+	}
+
+	target := callTarget{kind: invocationExternal, callExpr: funcName}
+	if fn, _ := fe.ctx.ResolveFunction(root.Name, sourceDir); fn != nil {
+		return target, nil
+	}
+	if path, pin, ok := fe.resolveImportPath(root.Name); ok {
+		target.packageAlias, target.packagePath, target.importResolved, target.pin = root.Name, path, true, pin
+		return target, nil
+	}
+	return callTarget{}, fmt.Errorf("function expression %s: %s is neither a helper nor a known package; add //go:ahead import %s=<import path> in a function file",
+		funcName, root.Name, root.Name)
+}
+
+// rawTarget resolves the function part of a marker such as
+// //:=NewSchedule("abc").Derive(16), a Go expression evaluated as written
+// next to the helpers, so it may call their methods or build their types
+func rawTarget(expr string) (callTarget, error) {
+	if expr == "" {
+		return callTarget{}, fmt.Errorf("expression after = is empty")
+	}
+	if _, err := parser.ParseExpr(expr); err != nil {
+		return callTarget{}, fmt.Errorf("expression =%s: %v", expr, err)
+	}
+	return callTarget{kind: invocationExternal, callExpr: expr, raw: true}, nil
+}
+
+// explainExpressionFailure names the "=expr" function part among targets in
+// err, the failure of an evaluation program that did not compile: it is the
+// code goahead did not check beforehand
+func (fe *FunctionExecutor) explainExpressionFailure(err error, targets []callTarget, sourceDir string) error {
+	if !compileFailure(err) {
+		return err
+	}
+	for _, target := range targets {
+		if !target.raw {
+			continue
+		}
+		reason := "see the compiler output"
+		if match := evalCompileErrorPattern.FindStringSubmatch(err.Error()); match != nil {
+			reason = match[1]
+		}
+		return fmt.Errorf("expression =%s does not compile next to the helpers visible from %s: %s\n%w",
+			target.callExpr, fe.ctx.relToRoot(sourceDir), reason, err)
+	}
+	return err
+}
+
+// compileFailure reports whether err is an evaluation program that did not
+// compile, as go run reports it
+func compileFailure(err error) bool {
+	return strings.Contains(err.Error(), "# command-line-arguments")
+}
+
+func hasRawTarget(targets []callTarget) bool {
+	for _, target := range targets {
+		if target.raw {
+			return true
+		}
+	}
+	return false
+}
+
+// leftmostIdent follows calls, selectors, index expressions and parentheses
+// to the identifier expr starts with
+func leftmostIdent(expr ast.Expr) *ast.Ident {
+	for {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			return e
+		case *ast.CallExpr:
+			expr = e.Fun
+		case *ast.SelectorExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		default:
+			return nil
+		}
+	}
+}
+
+// qualifyImportPaths rewrites import path qualified identifiers outside
+// string literals to name.Ident and returns the packages by name. Only paths
+// inside modulePath or starting with a lowercase domain (github.com/...)
+// count, so divisions such as total/cfg.Size are left alone.
+func qualifyImportPaths(expr, modulePath string) (string, map[string]string) {
+	literals := stringLiteralRanges(expr)
+	paths := make(map[string]string)
+	var b strings.Builder
+	last := 0
+	for _, loc := range qualifiedPathPattern.FindAllStringSubmatchIndex(expr, -1) {
+		path := expr[loc[2]:loc[3]]
+		first, _, _ := strings.Cut(path, "/")
+		inModule := modulePath != "" && (path == modulePath || strings.HasPrefix(path, modulePath+"/"))
+		if (!inModule && !isDomain(first)) || insideRanges(loc[0], literals) {
+			continue
+		}
+		name := packageNameForPath(path)
+		if existing, ok := paths[name]; ok && existing != path {
+			continue // two packages with one name; left for the compiler to report
+		}
+		paths[name] = path
+		b.WriteString(expr[last:loc[0]])
+		b.WriteString(name + "." + expr[loc[4]:loc[5]])
+		last = loc[1]
+	}
+	b.WriteString(expr[last:])
+	return b.String(), paths
+}
+
+func isDomain(elem string) bool {
+	return strings.Contains(elem, ".") && strings.Trim(elem, "abcdefghijklmnopqrstuvwxyz0123456789.-") == ""
+}
+
+// packageNameForPath guesses the package name of an import path: its last
+// element without a major version suffix, made a valid identifier
+func packageNameForPath(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = elems[len(elems)-2]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || ('0' <= name[0] && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// modulePackageDir returns the directory of path when it belongs to the
+// module at root
+func modulePackageDir(root, modulePath, path string) (string, bool) {
+	if modulePath == "" {
+		return "", false
+	}
+	if path == modulePath {
+		return root, true
+	}
+	rest, ok := strings.CutPrefix(path, modulePath+"/")
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(root, filepath.FromSlash(rest)), true
+}
+
+// importsModulePackage reports whether one of the import specs of a program
+// evaluated for sourceDir names a package of its module, as a helper
+// importing mymodule/internal/crypto does. The program must then live inside
+// the module, like one whose arguments import such a package.
+func (fe *FunctionExecutor) importsModulePackage(specs []string, sourceDir string) bool {
+	modulePath := readModulePath(filepath.Join(fe.projectRoot(sourceDir), "go.mod"))
+	if modulePath == "" {
+		return false
+	}
+	for _, spec := range specs {
+		start := strings.IndexAny(spec, "\"`")
+		if start < 0 {
+			continue
+		}
+		end := strings.IndexByte(spec[start+1:], spec[start])
+		if end < 0 {
+			continue
+		}
+		path := spec[start+1 : start+1+end]
+		if path == modulePath || strings.HasPrefix(path, modulePath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// modulePackageSources returns the Go files of the packages of the module at
+// root that files import, directly or through each other, test files aside.
+// Their content goes into the result cache keys: a helper importing
+// mymodule/internal/crypto gets a new result once crypto changes.
+func modulePackageSources(root, modulePath string, files []string) []string {
+	if modulePath == "" {
+		return nil
+	}
+	var sources []string
+	seen := make(map[string]bool)
+	queue := append([]string(nil), files...)
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		parsed, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, imp := range parsed.Imports {
+			path, err := strconv.Unquote(imp.Path.Value)
+			if err != nil {
+				continue
+			}
+			dir, ok := modulePackageDir(root, modulePath, path)
+			if !ok || seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				name := entry.Name()
+				if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+					continue
+				}
+				sources = append(sources, filepath.Join(dir, name))
+				queue = append(queue, filepath.Join(dir, name))
+			}
+		}
+	}
+	return sources
+}
+
+// stringLiteralRanges returns the byte ranges of string and rune literals in expr
+func stringLiteralRanges(expr string) [][2]int {
+	var ranges [][2]int
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(expr))
+	var s scanner.Scanner
+	s.Init(file, []byte(expr), nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return ranges
+		}
+		if tok == token.STRING || tok == token.CHAR {
+			start := file.Offset(pos)
+			ranges = append(ranges, [2]int{start, start + len(lit)})
+		}
+	}
+}
+
+func insideRanges(offset int, ranges [][2]int) bool {
+	for _, r := range ranges {
+		if offset >= r[0] && offset < r[1] {
+			return true
+		}
+	}
+	return false
+}
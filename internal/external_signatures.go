@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// externalSignature returns the signature of an external package function
+// such as strings.Repeat, read from the package source with go/doc, so that
+// its arguments get the same typed formatting and arity checks as helpers.
+// Lookups are cached per package; nil means the signature is unknown and the
+// arguments are passed as written.
+func (fe *FunctionExecutor) externalSignature(target callTarget) *UserFunction {
+	_, name, _ := strings.Cut(target.callExpr, ".")
+	if target.packagePath == "" || name == "" || strings.Contains(name, ".") {
+		// Methods on package variables (base64.StdEncoding.EncodeToString) are not looked up
+		return nil
+	}
+
+	// A pinned package is read from the version its directive names
+	key := target.packagePath
+	if target.pin != nil {
+		key = target.pin.String()
+	}
+	fe.mu.Lock()
+	if fe.externalFuncs == nil {
+		fe.externalFuncs = make(map[string]map[string]*UserFunction)
+	}
+	funcs, ok := fe.externalFuncs[key]
+	fe.mu.Unlock()
+	if !ok {
+		var err error
+		if target.pin != nil {
+			funcs, err = fe.loadPinnedPackageFuncs(*target.pin)
+		} else {
+			funcs, err = loadPackageFuncs(target.packagePath, fe.ctx.RootDir)
+		}
+		if err != nil {
+			fe.ctx.Logger().Logf(LogExec, "[goahead] No signatures for %s (%v); arguments are passed as written", key, err)
+		}
+		fe.mu.Lock()
+		fe.externalFuncs[key] = funcs
+		fe.mu.Unlock()
+	}
+
+	fn := funcs[name]
+	if fn == nil {
+		return nil
+	}
+	sig := *fn
+	sig.Name = target.callExpr
+	return &sig
+}
+
+// loadPackageFuncs collects the exported top-level functions of importPath,
+// including constructors that go/doc groups under their result type
+func loadPackageFuncs(importPath, srcDir string) (map[string]*UserFunction, error) {
+	pkg, err := build.Default.Import(importPath, srcDir, 0)
+	if err != nil {
+		return nil, err
+	}
+	return packageFuncs(pkg, importPath)
+}
+
+// loadPinnedPackageFuncs reads the functions of a pinned package from the
+// module cache. go/build would look the package up with the go.mod of the
+// module, adding the requirement to it under -mod=mod.
+func (fe *FunctionExecutor) loadPinnedPackageFuncs(pin pinnedImport) (map[string]*UserFunction, error) {
+	projectRoot := fe.projectRoot(fe.ctx.RootDir)
+	pinned := fe.pinnedModuleFor(projectRoot, []pinnedImport{pin})
+	if pinned.err != nil {
+		return nil, pinned.err
+	}
+	cwd, args := pinned.dir, []string{"list", "-mod=mod", "-f", "{{.Dir}}"}
+	if pinned.modFile != "" {
+		cwd, args = projectRoot, append(args, "-modfile="+pinned.modFile)
+	}
+	stdout, stderr, err := fe.runner.Run(cwd, sanitizeGoEnv(os.Environ()), append(args, pin.Path)...)
+	if err != nil {
+		return nil, fmt.Errorf("go list %s: %v: %s", pin.Path, err, strings.TrimSpace(stderr))
+	}
+	pkg, err := build.Default.ImportDir(strings.TrimSpace(stdout), 0)
+	if err != nil {
+		return nil, err
+	}
+	return packageFuncs(pkg, pin.Path)
+}
+
+// packageFuncs collects the exported top-level functions of pkg
+func packageFuncs(pkg *build.Package, importPath string) (map[string]*UserFunction, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range pkg.GoFiles {
+		file, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	docPkg, err := doc.NewFromFiles(fset, files, importPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read documentation of %s: %v", importPath, err)
+	}
+
+	decls := append([]*doc.Func(nil), docPkg.Funcs...)
+	for _, typ := range docPkg.Types {
+		decls = append(decls, typ.Funcs...)
+	}
+
+	funcs := make(map[string]*UserFunction, len(decls))
+	for _, decl := range decls {
+		if decl.Decl == nil || decl.Decl.Recv != nil || decl.Decl.Type.TypeParams != nil {
+			continue
+		}
+		fn := &UserFunction{
+			Name:        decl.Name,
+			InputTypes:  fieldTypes(decl.Decl.Type.Params),
+			OutputTypes: fieldTypes(decl.Decl.Type.Results),
+			FilePath:    fset.Position(decl.Decl.Pos()).Filename,
+		}
+		fn.VariadicElem, fn.Variadic = variadicElem(decl.Decl.Type.Params)
+		funcs[decl.Name] = fn
+	}
+	return funcs, nil
+}
+
+// fieldTypes lists one type per parameter or result, expanding grouped names
+func fieldTypes(list *ast.FieldList) []string {
+	if list == nil {
+		return nil
+	}
+	var types []string
+	for _, field := range list.List {
+		typ := typeToString(field.Type)
+		count := len(field.Names)
+		if count == 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			types = append(types, typ)
+		}
+	}
+	return types
+}
+
+// formatExternalCall formats args for an external function, using its
+// signature when it is known
+func (fe *FunctionExecutor) formatExternalCall(target callTarget, args []argument) ([]string, error) {
+	sig := fe.externalSignature(target)
+	if sig == nil {
+		return formatExternalArguments(args), nil
+	}
+	return formatTypedArguments(sig, args, formatExternalArgument)
+}
+
+// formatExternalArgument applies typed formatting for basic parameter types
+// only; other types (any, named types, slices) keep the untyped display, so
+// the result is never worse than without a signature
+func formatExternalArgument(arg argument, expected string) (string, error) {
+	if hint := mapOutputType(expected); hint == "other" || hint == "composite" {
+		return argDisplayForExternal(arg), nil
+	}
+	return formatArgumentForType(arg, expected)
+}
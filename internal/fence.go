@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FenceStyle is the layout of the block of injected code: the comment lines
+// that open and close it and the blank lines around its parts
+type FenceStyle struct {
+	Begin string
+	End   string
+	// Before is the number of blank lines before Begin
+	Before int
+	// Inside is the number of blank lines before each injected function
+	Inside int
+	// After is the number of blank lines after End
+	After int
+}
+
+// DefaultFenceStyle is the layout used when Config.FenceStyle is empty
+var DefaultFenceStyle = FenceStyle{
+	Begin:  "// Code generated by goahead. DO NOT EDIT.",
+	End:    "// End of goahead generated code.",
+	Before: 1,
+	Inside: 1,
+	After:  1,
+}
+
+// generatedCodePattern is the Go convention for generated code comments
+var generatedCodePattern = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// ParseFenceStyle parses a -fence-style value: comma-separated key=value
+// pairs for begin, end, before, inside and after; missing keys keep the
+// DefaultFenceStyle values. Both fences must mention goahead and Begin must
+// follow the generated-code convention, so that a block written with any
+// earlier style is still found and replaced.
+func ParseFenceStyle(spec string) (FenceStyle, error) {
+	style := DefaultFenceStyle
+	if strings.TrimSpace(spec) == "" {
+		return style, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok {
+			return style, fmt.Errorf("invalid -fence-style entry %q (expected key=value)", pair)
+		}
+		switch key {
+		case "begin":
+			style.Begin = strings.TrimSpace(value)
+		case "end":
+			style.End = strings.TrimSpace(value)
+		case "before", "inside", "after":
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return style, fmt.Errorf("invalid -fence-style %s value %q (must be 0 or greater)", key, value)
+			}
+			switch key {
+			case "before":
+				style.Before = n
+			case "inside":
+				style.Inside = n
+			default:
+				style.After = n
+			}
+		default:
+			return style, fmt.Errorf("unknown -fence-style key %q (expected begin, end, before, inside or after)", key)
+		}
+	}
+	if !generatedCodePattern.MatchString(style.Begin) || !strings.Contains(style.Begin, "goahead") {
+		return style, fmt.Errorf("invalid -fence-style begin %q (must look like \"// Code generated by goahead ... DO NOT EDIT.\")", style.Begin)
+	}
+	if !isEndFence(style.End) {
+		return style, fmt.Errorf("invalid -fence-style end %q (must be a // comment mentioning goahead)", style.End)
+	}
+	return style, nil
+}
+
+// isBeginFence and isEndFence recognize the fences of any valid style
+func isBeginFence(line string) bool {
+	return generatedCodePattern.MatchString(line) && strings.Contains(line, "goahead")
+}
+
+func isEndFence(line string) bool {
+	return strings.HasPrefix(line, "//") && strings.Contains(line, "goahead") && !generatedCodePattern.MatchString(line)
+}
+
+// findInjectedBlock returns the offsets of the injected block in content,
+// from the start of its begin fence to the end of its end fence, whatever
+// style it was written with. The fences are top-level comments after the
+// package clause; injected declarations carry no top-level comments.
+func findInjectedBlock(content string) (start, end int, found bool, err error) {
+	start = -1
+	inPackage := false
+	offset := 0
+	for offset < len(content) {
+		lineEnd := strings.IndexByte(content[offset:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(content)
+		} else {
+			lineEnd += offset
+		}
+		line := strings.TrimRight(content[offset:lineEnd], " \t\r")
+		switch {
+		case !inPackage:
+			inPackage = strings.HasPrefix(line, "package ")
+		case start == -1 && isBeginFence(line):
+			start = offset
+		case start != -1 && isEndFence(line):
+			return start, offset + len(line), true, nil
+		}
+		offset = lineEnd + 1
+	}
+	if start != -1 {
+		return 0, 0, false, fmt.Errorf("unclosed injected block in file")
+	}
+	return 0, 0, false, nil
+}
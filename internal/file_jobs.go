@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// fileJobs returns how many files a run evaluates at once, 1 when files are
+// evaluated as they are rewritten
+func (c Config) fileJobs() int {
+	if c.Jobs > 0 || c.SingleProgram {
+		return 1
+	}
+	if c.FileJobs > 0 {
+		return c.FileJobs
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// prefetchFiles evaluates the markers of files ahead of the rewrite pass, up
+// to jobs programs at once. Each file gets the program the pass would run for
+// it, without the calls an earlier file already has, and the results wait in
+// the executor for the pass to take them (see takePrefetched). The pass still
+// reads, rewrites and reports the files one by one in order, so the output
+// does not depend on scheduling. A program that fails leaves no result, and
+// the pass then evaluates that file again to report the error at its
+// markers. Only the first call of a pipeline is evaluated ahead; nocache
+// helpers never are.
+func (cp *CodeProcessor) prefetchFiles(files []string, jobs int) {
+	type batch struct {
+		dir     string
+		pending []pendingCall
+	}
+	collector := &CodeProcessor{ctx: cp.ctx, executor: cp.executor}
+	var batches []batch
+	seen := make(map[string]bool)
+	for _, filePath := range files {
+		if cp.ctx.interrupted() {
+			return
+		}
+		if cp.ctx.SkipReason(filePath) != "" {
+			continue
+		}
+		content, err := os.ReadFile(filePath)
+		if err != nil || invalidUTF8Offset(string(content)) >= 0 {
+			continue
+		}
+		// Aliases resolve against the imports of the file, as when it is
+		// processed
+		if cp.ctx.FileImports, err = cp.ctx.fileImports(filePath, content); err != nil {
+			continue
+		}
+		var calls []BatchCall
+		collector.collected = &calls
+		_, text := splitBOM(string(content))
+		if _, _, err = collector.processLines(strings.NewReader(text), filePath, false); err != nil {
+			continue
+		}
+
+		dir := absPath(filepath.Dir(filePath))
+		var pending []pendingCall
+		for _, call := range calls {
+			if fn, _ := cp.ctx.ResolveFunction(call.FuncName, dir); fn != nil && fn.NoCache {
+				continue
+			}
+			p, cached, err := cp.executor.prepareCall(call, dir)
+			if err != nil || cached != nil || seen[p.cacheKey] {
+				continue
+			}
+			seen[p.cacheKey] = true
+			pending = append(pending, p)
+		}
+		if len(pending) > 0 {
+			batches = append(batches, batch{dir: dir, pending: pending})
+		}
+	}
+	cp.ctx.FileImports = nil
+	// A single program gains nothing from running ahead
+	if len(batches) < 2 {
+		return
+	}
+
+	cp.ctx.Logger().Logf(LogExec, "[goahead] Evaluating %d file(s), up to %d at once", len(batches), jobs)
+	var wg sync.WaitGroup
+	var panics workerPanics
+	semaphore := make(chan struct{}, jobs)
+	for _, b := range batches {
+		wg.Add(1)
+		go func(b batch) {
+			defer wg.Done()
+			defer panics.catch()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			if cp.ctx.interrupted() {
+				return
+			}
+			cp.executor.storePrefetched(b.pending, cp.executor.runPending(b.pending, b.dir, false))
+		}(b)
+	}
+	wg.Wait()
+	panics.raise()
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/parser"
@@ -14,10 +15,14 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"time"
 )
 
 type FileProcessor struct {
 	ctx *ProcessorContext
+
+	// candidates collects loaded definitions by depth and name before registration
+	candidates map[int]map[string][]*UserFunction
 }
 
 func NewFileProcessor(ctx *ProcessorContext) *FileProcessor {
@@ -31,12 +36,18 @@ func (fp *FileProcessor) CollectAllGoFiles(dir string) ([]string, error) {
 	var allFiles []string
 	fp.ctx.FuncFiles = []string{}
 	fp.ctx.Submodules = []string{}
+	fp.ctx.HelperDirFiles = make(map[string]bool)
+	fp.ctx.BrokenHelpers = nil
 
 	// Get absolute path of root dir to compare
 	absRootDir, err := filepath.Abs(dir)
 	if err != nil {
 		absRootDir = dir
 	}
+	helperDirs := fp.helperDirs(absRootDir)
+	if err := fp.ctx.loadExclude(absRootDir); err != nil {
+		return nil, err
+	}
 
 	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -46,6 +57,13 @@ func (fp *FileProcessor) CollectAllGoFiles(dir string) ([]string, error) {
 		// Check for submodule (directory with go.mod that's not the root)
 		if d.IsDir() {
 			absPath, _ := filepath.Abs(path)
+			if fp.ctx.isWorkDir(absPath) {
+				return filepath.SkipDir // evaluation programs, not sources
+			}
+			if rule := fp.ctx.excludedBy(absPath, true); rule != "" {
+				fp.ctx.Logger().Logf(LogFilter, "[goahead] Skipping %s/: excluded by %s", fp.relPath(path), rule)
+				return filepath.SkipDir
+			}
 			if absPath != absRootDir {
 				goModPath := filepath.Join(path, "go.mod")
 				if _, statErr := os.Stat(goModPath); statErr == nil {
@@ -54,37 +72,199 @@ func (fp *FileProcessor) CollectAllGoFiles(dir string) ([]string, error) {
 					return filepath.SkipDir
 				}
 			}
+			// Package patterns prune directories outside the matched
+			// packages, such as asset folders
+			if enter, _ := fp.ctx.patternScope(absPath); !enter && fp.containingHelperDir(path, helperDirs) == "" {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
 		if !strings.HasSuffix(path, ".go") {
 			return nil
 		}
+		if rule := fp.ctx.excludedBy(path, false); rule != "" {
+			fp.ctx.Logger().Logf(LogFilter, "[goahead] Skipping %s: excluded by %s", fp.relPath(path), rule)
+			return nil
+		}
+
+		// An unreadable helper, known by its directory or its build
+		// constraint, is reported with the other broken helpers, since helpers
+		// are excluded from builds and nothing else notices; any other
+		// unreadable file fails the walk
+		isFunctionFile, readErr := fp.hasFunctionMarker(path)
+		if readErr != nil {
+			if fp.containingHelperDir(path, helperDirs) != "" || hasExcludeConstraint(path) {
+				fp.ctx.BrokenHelpers = append(fp.ctx.BrokenHelpers, BrokenHelper{File: path, Err: readErr})
+				return nil
+			}
+			if isReadError(readErr) {
+				return fmt.Errorf("failed to read %s: %v", path, readErr)
+			}
+			return readErr
+		}
+
+		// Every file in a configured helper directory is a helper file, marker
+		// or not, but it still has to be excluded from normal builds
+		if helperDir := fp.containingHelperDir(path, helperDirs); helperDir != "" {
+			if !hasExcludeConstraint(path) {
+				return fmt.Errorf("helper file %s in helper directory %s is missing the '//go:build exclude' constraint",
+					fp.relPath(path), fp.relPath(helperDir))
+			}
+			fp.ctx.FuncFiles = append(fp.ctx.FuncFiles, path)
+			fp.ctx.HelperDirFiles[path] = true
+			return nil
+		}
 
 		// Function files (//go:ahead functions) are sources of helper functions,
 		// not targets for placeholder/injection processing.
 		// They go into FuncFiles only; all other .go files go into allFiles.
-		if fp.hasFunctionMarker(path) {
+		if isFunctionFile {
 			fp.ctx.FuncFiles = append(fp.ctx.FuncFiles, path)
-		} else {
+		} else if absDir, _ := filepath.Abs(filepath.Dir(path)); fp.ctx.processesDir(absDir) {
+			if reason := fp.ctx.SkipReason(path); reason != "" {
+				fp.ctx.Logger().Logf(LogFilter, "[goahead] Skipping %s: %s", fp.relPath(path), reason)
+				return nil
+			}
 			allFiles = append(allFiles, path)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Helpers between the processing root and its module root serve the
+	// subtree too; depths then count from the module root
+	fp.ctx.DepthRoot = absRootDir
+	if moduleRoot := findModuleRoot(absRootDir); moduleRoot != "" && moduleRoot != absRootDir {
+		fp.ctx.DepthRoot = moduleRoot
+		fp.collectAncestorHelpers(absRootDir, moduleRoot)
+	}
+	return allFiles, nil
+}
+
+// collectAncestorHelpers adds the helper files of every directory from the
+// parent of absRootDir up to moduleRoot, without entering their other
+// subdirectories
+func (fp *FileProcessor) collectAncestorHelpers(absRootDir, moduleRoot string) {
+	for dir := filepath.Dir(absRootDir); ; dir = filepath.Dir(dir) {
+		entries, err := os.ReadDir(dir)
+		if err == nil {
+			for _, entry := range entries {
+				if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+					continue
+				}
+				path := filepath.Join(dir, entry.Name())
+				if rule := fp.ctx.excludedBy(path, false); rule != "" {
+					fp.ctx.Logger().Logf(LogFilter, "[goahead] Skipping %s: excluded by %s", fp.relPath(path), rule)
+					continue
+				}
+				isFunctionFile, readErr := fp.hasFunctionMarker(path)
+				if readErr != nil {
+					if hasExcludeConstraint(path) {
+						fp.ctx.BrokenHelpers = append(fp.ctx.BrokenHelpers, BrokenHelper{File: path, Err: readErr})
+					}
+					continue
+				}
+				if isFunctionFile {
+					fp.ctx.FuncFiles = append(fp.ctx.FuncFiles, path)
+				}
+			}
+		}
+		if dir == moduleRoot || filepath.Dir(dir) == dir {
+			return
+		}
+	}
+}
+
+// helperDirs resolves Config.HelperDirs against the processing root, keeping
+// only directories that exist in this module
+func (fp *FileProcessor) helperDirs(absRootDir string) []string {
+	var dirs []string
+	for _, dir := range fp.ctx.Config.HelperDirs {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(absRootDir, dir)
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, filepath.Clean(dir))
+		}
+	}
+	return dirs
+}
+
+func (fp *FileProcessor) containingHelperDir(path string, helperDirs []string) string {
+	if len(helperDirs) == 0 {
+		return ""
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	for _, dir := range helperDirs {
+		if PathWithin(absPath, dir) {
+			return dir
+		}
+	}
+	return ""
+}
 
-	return allFiles, err
+// hasExcludeConstraint reports whether the file header carries a build
+// constraint mentioning the exclude tag
+// isReadError reports whether err comes from reading a file rather than
+// from a malformed directive in it
+func isReadError(err error) bool {
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr) || errors.Is(err, bufio.ErrTooLong)
+}
+
+func hasExcludeConstraint(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			return false
+		}
+		var expr string
+		switch {
+		case strings.HasPrefix(line, "//go:build "):
+			expr = strings.TrimPrefix(line, "//go:build ")
+		case strings.HasPrefix(line, "// +build "):
+			expr = strings.TrimPrefix(line, "// +build ")
+		default:
+			continue
+		}
+		for _, tag := range strings.FieldsFunc(expr, func(r rune) bool {
+			return r == ' ' || r == '(' || r == ')' || r == '&' || r == '|' || r == ','
+		}) {
+			if tag == "exclude" {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // FilterFilesWithMarkers quickly checks which files contain placeholder or inject markers
-// Uses parallel scanning for speed
+// Uses parallel scanning for speed, so the files come back in no particular
+// order
 func (fp *FileProcessor) FilterFilesWithMarkers(files []string) []string {
 	if len(files) == 0 {
 		return nil
 	}
 
 	// Compile patterns once
-	commentRe := regexp.MustCompile(CommentPattern)
-	injectRe := regexp.MustCompile(InjectPattern)
+	syntax := fp.ctx.MarkerSyntax()
+	commentRe := regexp.MustCompile(syntax.PlaceholderPattern())
+	injectRe := regexp.MustCompile(syntax.InjectPattern())
 
 	type result struct {
 		path      string
@@ -150,10 +330,10 @@ func (fp *FileProcessor) FindFunctionFiles(dir string) error {
 	return err
 }
 
-func (fp *FileProcessor) hasFunctionMarker(path string) bool {
+func (fp *FileProcessor) hasFunctionMarker(path string) (bool, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return false
+		return false, err
 	}
 	defer func(file *os.File) {
 		_ = file.Close()
@@ -162,22 +342,55 @@ func (fp *FileProcessor) hasFunctionMarker(path string) bool {
 	scanner := bufio.NewScanner(file)
 	lineCount := 0
 
+	// Helper files have all their directives validated when they are
+	// loaded; other files only report directives found in their header,
+	// which catches typos such as //go:ahead function
+	type headerDirective struct {
+		line int
+		text string
+	}
+	var directives []headerDirective
 	for scanner.Scan() && lineCount < 10 {
-		line := strings.TrimSpace(scanner.Text())
-		if line == FunctionMarker {
-			return true
-		}
 		lineCount++
+		line := scanner.Text()
+		d, ok, err := ParseDirective(line)
+		if !ok {
+			continue
+		}
+		if err == nil && d.Name == DirectiveFunctions {
+			return true, nil
+		}
+		directives = append(directives, headerDirective{lineCount, line})
 	}
-	return false
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	for _, d := range directives {
+		if _, _, err := fp.checkDirective(path, d.line, d.text); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
 }
 
 func (fp *FileProcessor) LoadUserFunctions() error {
+	fp.candidates = make(map[int]map[string][]*UserFunction)
+	fp.ctx.UnexportedHelpers = make(map[string]string)
+	// Broken files are collected rather than fatal here; Prepare reports
+	// them all at once or, with -skip-broken-helpers, leaves them out
+	loaded := fp.ctx.FuncFiles[:0]
 	for _, funcFile := range fp.ctx.FuncFiles {
 		if err := fp.loadFunctionsFromFile(funcFile); err != nil {
-			return fmt.Errorf("error loading functions from %s: %v", funcFile, err)
+			fp.ctx.BrokenHelpers = append(fp.ctx.BrokenHelpers, BrokenHelper{File: funcFile, Err: err})
+			continue
 		}
+		loaded = append(loaded, funcFile)
+	}
+	fp.ctx.FuncFiles = loaded
+	if err := fp.registerCandidates(); err != nil {
+		return err
 	}
+	fp.checkShadowing()
 	return nil
 }
 
@@ -191,106 +404,292 @@ func (fp *FileProcessor) loadFunctionsFromFile(filePath string) error {
 	if err != nil {
 		return fmt.Errorf("failed to parse functions file: %v", err)
 	}
+	if err := fp.loadDirectives(filePath, src); err != nil {
+		return err
+	}
 
+	var declErr error
 	ast.Inspect(node, func(n ast.Node) bool {
-		if fn, ok := n.(*ast.FuncDecl); ok {
-			fp.processFunctionDeclaration(fn, filePath)
+		if fn, ok := n.(*ast.FuncDecl); ok && declErr == nil {
+			declErr = fp.processFunctionDeclaration(fn, filePath)
 		}
-		return true
+		return declErr == nil
 	})
+	if declErr != nil {
+		return declErr
+	}
 
 	return nil
 }
 
-func (fp *FileProcessor) processFunctionDeclaration(fn *ast.FuncDecl, filePath string) {
+func (fp *FileProcessor) processFunctionDeclaration(fn *ast.FuncDecl, filePath string) error {
 	if !fp.isValidFunction(fn) {
-		return
+		return nil
 	}
 
 	funcName := fn.Name.Name
 
 	// Only exported (uppercase) functions are available for placeholder replacement
 	if !gotoken.IsExported(funcName) {
-		return
+		if fn.Recv == nil && fp.ctx.UnexportedHelpers != nil {
+			if _, seen := fp.ctx.UnexportedHelpers[funcName]; !seen {
+				fp.ctx.UnexportedHelpers[funcName] = filePath
+			}
+		}
+		return nil
 	}
 
-	// Get directory of the helper file
-	funcDir := filepath.Dir(filePath)
-	absDir, err := filepath.Abs(funcDir)
-	if err != nil {
-		absDir = funcDir
+	// Calculate depth relative to RootDir (helper directories use the configured depth)
+	depth := fp.ctx.HelperFileDepth(filePath)
+
+	namespace := fp.ctx.HelperNamespaces[filePath]
+	if namespace != "" {
+		funcName = namespace + "." + funcName
+	}
+	userFunc := &UserFunction{
+		Name:        funcName,
+		Namespace:   namespace,
+		TypeParams:  typeParamNames(fn),
+		InputTypes:  fp.extractInputTypes(fn),
+		OutputType:  fp.extractOutputType(fn),
+		OutputTypes: fp.extractOutputTypes(fn),
+		FilePath:    filePath,
+		Line:        fp.ctx.FileSet.Position(fn.Pos()).Line,
+		Depth:       depth,
+		Doc:         firstDocLine(fn.Doc),
+		NoCache:     hasDocDirective(fn.Doc, NoCacheDirective),
+	}
+	userFunc.VariadicElem, userFunc.Variadic = variadicElem(fn.Type.Params)
+	if results := fn.Type.Results; results != nil && len(results.List) > 0 {
+		userFunc.NotInlinable = !inlinableResult(results.List[0].Type)
+	}
+	if err := fp.parseLimits(userFunc, fn.Doc); err != nil {
+		return err
 	}
 
-	// Calculate depth relative to RootDir
-	depth := fp.ctx.CalculateDepth(absDir)
+	// Definitions are registered once every helper file is loaded so that
+	// duplicates can be reported together and settled by the configured policy
+	if fp.candidates[depth] == nil {
+		fp.candidates[depth] = make(map[string][]*UserFunction)
+	}
+	fp.candidates[depth][funcName] = append(fp.candidates[depth][funcName], userFunc)
+	return nil
+}
 
-	userFunc := &UserFunction{
-		Name:       funcName,
-		InputTypes: fp.extractInputTypes(fn),
-		OutputType: fp.extractOutputType(fn),
-		FilePath:   filePath,
-		Depth:      depth,
+// parseLimits reads the //goahead:timeout and //goahead:maxmem lines of a
+// helper's doc comment
+func (fp *FileProcessor) parseLimits(userFunc *UserFunction, doc *ast.CommentGroup) error {
+	location := fmt.Sprintf("%s:%d", fp.ctx.relToRoot(userFunc.FilePath), userFunc.Line)
+	if value, ok := docDirectiveValue(doc, TimeoutDirective); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("%s: invalid //%s %q on %s: expected a positive duration such as 5s", location, TimeoutDirective, value, userFunc.Name)
+		}
+		userFunc.Timeout = timeout
 	}
+	if value, ok := docDirectiveValue(doc, MaxMemDirective); ok {
+		maxMem, err := parseByteSize(value)
+		if err != nil || maxMem <= 0 {
+			return fmt.Errorf("%s: invalid //%s %q on %s: expected a positive size such as 256MiB", location, MaxMemDirective, value, userFunc.Name)
+		}
+		userFunc.MaxMem = maxMem
+	}
+	return nil
+}
+
+// registerCandidates stores every loaded definition in the depth and directory
+// maps, applying the duplicate policy to names defined more than once at a depth
+func (fp *FileProcessor) registerCandidates() error {
+	policy := fp.ctx.Config.DuplicatePolicy()
+	var conflicts []string
+
+	depths := make([]int, 0, len(fp.candidates))
+	for depth := range fp.candidates {
+		depths = append(depths, depth)
+	}
+	slices.Sort(depths)
+
+	for _, depth := range depths {
+		byName := fp.candidates[depth]
+		names := make([]string, 0, len(byName))
+		for name := range byName {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			defs := byName[name]
+			slices.SortStableFunc(defs, func(a, b *UserFunction) int {
+				return strings.Compare(a.FilePath, b.FilePath)
+			})
+			if len(defs) == 1 {
+				fp.register(defs[0])
+				continue
+			}
+
+			switch policy {
+			case DuplicatePolicyFirst:
+				fp.register(defs[0])
+				fp.recordDuplicate(name, depth, policy, defs, defs[0])
+			case DuplicatePolicySkip:
+				fp.recordDuplicate(name, depth, policy, defs, nil)
+			default:
+				conflicts = append(conflicts, fp.describeDuplicate(name, depth, defs))
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("duplicate helper definitions at the same depth:\n%s"+
+			"  Hint: give one of the files a namespace with %s %s <name> and call its\n"+
+			"  helpers as <name>.Func, rename one definition, or move it to a different depth.\n"+
+			"  To unblock a migration temporarily, use -on-duplicate=first (first definition\n"+
+			"  in lexical file order wins) or -on-duplicate=skip.",
+			strings.Join(conflicts, ""), DirectivePrefix, DirectiveNamespace)
+	}
+	return nil
+}
 
-	// Initialize maps if needed
+func (fp *FileProcessor) register(userFunc *UserFunction) {
+	absDir, err := filepath.Abs(filepath.Dir(userFunc.FilePath))
+	if err != nil {
+		absDir = filepath.Dir(userFunc.FilePath)
+	}
 	if fp.ctx.FunctionsByDir[absDir] == nil {
 		fp.ctx.FunctionsByDir[absDir] = make(map[string]*UserFunction)
 	}
-	if fp.ctx.FunctionsByDepth[depth] == nil {
-		fp.ctx.FunctionsByDepth[depth] = make(map[string]*UserFunction)
+	if fp.ctx.FunctionsByDepth[userFunc.Depth] == nil {
+		fp.ctx.FunctionsByDepth[userFunc.Depth] = make(map[string]*UserFunction)
 	}
+	fp.ctx.FunctionsByDepth[userFunc.Depth][userFunc.Name] = userFunc
+	fp.ctx.FunctionsByDir[absDir][userFunc.Name] = userFunc
+}
 
-	// Check for duplicate in same directory (this is an error)
-	if existingFunc, exists := fp.ctx.FunctionsByDir[absDir][funcName]; exists {
-		_, _ = fmt.Fprintf(os.Stderr, "ERROR: Duplicate function '%s' in same directory!\n"+
-			"  - First definition: %s\n"+
-			"  - Second definition: %s\n",
-			funcName, existingFunc.FilePath, filePath)
-		os.Exit(1)
-	}
+// recordDuplicate prints a prominent warning and keeps the resolution for the
+// verbose resolution trace
+func (fp *FileProcessor) recordDuplicate(name string, depth int, policy string, defs []*UserFunction, kept *UserFunction) {
+	fp.ctx.DuplicateResolutions = append(fp.ctx.DuplicateResolutions, DuplicateResolution{
+		Name:        name,
+		Depth:       depth,
+		Policy:      policy,
+		Definitions: defs,
+		Kept:        kept,
+	})
 
-	// Check for duplicate at same depth (different directories) - this is now an error
-	if existingFunc, exists := fp.ctx.FunctionsByDepth[depth][funcName]; exists {
-		_, _ = fmt.Fprintf(os.Stderr, "ERROR: Duplicate function '%s' at same depth level %d!\n"+
-			"  - First definition: %s\n"+
-			"  - Second definition: %s\n"+
-			"  Hint: Functions at the same depth level must have unique names.\n",
-			funcName, depth, existingFunc.FilePath, filePath)
-		os.Exit(1)
+	outcome := "all definitions are ignored"
+	location := defs[0]
+	if kept != nil {
+		outcome = "using " + fp.relPath(kept.FilePath)
+		location = kept
 	}
+	fp.ctx.Warn(Diagnostic{
+		Rule: RuleDuplicateHelper,
+		File: location.FilePath,
+		Line: location.Line,
+		Message: fmt.Sprintf("duplicate function '%s' at depth %d (%d definitions), -on-duplicate=%s: %s\n%s\n"+
+			"  declare %s %s <name> in one of the files to keep every definition",
+			name, depth, len(defs), policy, outcome, strings.TrimRight(fp.describeDefinitions(defs), "\n"),
+			DirectivePrefix, DirectiveNamespace),
+	})
+}
 
-	// Check for shadowing (function at deeper level shadows one at shallower level)
-	fp.checkShadowing(funcName, depth, filePath)
+func (fp *FileProcessor) describeDuplicate(name string, depth int, defs []*UserFunction) string {
+	return fmt.Sprintf("  '%s' is defined %d times at depth %d:\n%s", name, len(defs), depth, fp.describeDefinitions(defs))
+}
 
-	// Store in depth-specific map
-	fp.ctx.FunctionsByDepth[depth][funcName] = userFunc
+func (fp *FileProcessor) describeDefinitions(defs []*UserFunction) string {
+	var sb strings.Builder
+	for _, def := range defs {
+		sb.WriteString(fmt.Sprintf("    - %s: %s", fp.relPath(def.FilePath), def.Signature()))
+		if def.Doc != "" {
+			sb.WriteString(fmt.Sprintf(" // %s", def.Doc))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
 
-	// Store in directory-specific map
-	fp.ctx.FunctionsByDir[absDir][funcName] = userFunc
+func (fp *FileProcessor) relPath(path string) string {
+	relPath, err := filepath.Rel(fp.ctx.RootDir, path)
+	if err != nil || relPath == "" {
+		return path
+	}
+	return relPath
 }
 
-// checkShadowing warns if this function shadows one from a shallower depth level
-func (fp *FileProcessor) checkShadowing(funcName string, funcDepth int, filePath string) {
-	// Check all shallower depths (0 to funcDepth-1)
-	for depth := 0; depth < funcDepth; depth++ {
-		if funcs, ok := fp.ctx.FunctionsByDepth[depth]; ok {
-			if existingFunc, exists := funcs[funcName]; exists {
-				relPath, _ := filepath.Rel(fp.ctx.RootDir, filePath)
-				existingRelPath, _ := filepath.Rel(fp.ctx.RootDir, existingFunc.FilePath)
-				if relPath == "" {
-					relPath = filePath
-				}
-				if existingRelPath == "" {
-					existingRelPath = existingFunc.FilePath
+// checkShadowing warns for every function that shadows one from a shallower depth level
+func (fp *FileProcessor) checkShadowing() {
+	maxDepth := fp.ctx.GetMaxDepth()
+	for funcDepth := 1; funcDepth <= maxDepth; funcDepth++ {
+		funcs := fp.ctx.FunctionsByDepth[funcDepth]
+		names := make([]string, 0, len(funcs))
+		for name := range funcs {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, funcName := range names {
+			for depth := 0; depth < funcDepth; depth++ {
+				existingFunc, exists := fp.ctx.FunctionsByDepth[depth][funcName]
+				if !exists {
+					continue
 				}
-				_, _ = fmt.Fprintf(os.Stderr, "[goahead] WARNING: '%s' at depth %d (%s) shadows depth %d (%s)\n",
-					funcName, funcDepth, relPath, depth, existingRelPath)
-				return
+				shadowing := funcs[funcName]
+				fp.ctx.Warn(Diagnostic{
+					Rule: RuleShadowedHelper,
+					File: shadowing.FilePath,
+					Line: shadowing.Line,
+					Message: fmt.Sprintf("'%s' at depth %d (%s) shadows depth %d (%s)",
+						funcName, funcDepth, fp.relPath(shadowing.FilePath), depth, fp.relPath(existingFunc.FilePath)),
+				})
+				break
 			}
 		}
 	}
 }
 
+// firstDocLine returns the first non-empty line of a doc comment
+func firstDocLine(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// hasDocDirective reports whether doc holds the line //directive. Directives
+// are dropped from CommentGroup.Text, so the raw comments are checked.
+func hasDocDirective(doc *ast.CommentGroup, directive string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, comment := range doc.List {
+		if strings.TrimSpace(strings.TrimPrefix(comment.Text, "//")) == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// docDirectiveValue returns the argument of a "//directive value" line of
+// doc; ok is false when the directive is absent
+func docDirectiveValue(doc *ast.CommentGroup, directive string) (value string, ok bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, comment := range doc.List {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Text, "//"))
+		if rest, found := strings.CutPrefix(text, directive); found && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			return strings.TrimSpace(rest), true
+		}
+	}
+	return "", false
+}
+
 func (fp *FileProcessor) isValidFunction(fn *ast.FuncDecl) bool {
 	return fn.Name.IsExported() || (fn.Name.Name[0] >= 'a' && fn.Name.Name[0] <= 'z')
 }
@@ -314,6 +713,19 @@ func (fp *FileProcessor) extractInputTypes(fn *ast.FuncDecl) []string {
 	return inputTypes
 }
 
+// variadicElem returns the element type of a final ...T parameter, ok being
+// false when the function is not variadic
+func variadicElem(params *ast.FieldList) (string, bool) {
+	if params == nil || len(params.List) == 0 {
+		return "", false
+	}
+	ellipsis, ok := params.List[len(params.List)-1].Type.(*ast.Ellipsis)
+	if !ok {
+		return "", false
+	}
+	return typeToString(ellipsis.Elt), true
+}
+
 func (fp *FileProcessor) extractOutputType(fn *ast.FuncDecl) string {
 	if fn.Type.Results != nil && len(fn.Type.Results.List) > 0 {
 		return typeToString(fn.Type.Results.List[0].Type)
@@ -321,6 +733,40 @@ func (fp *FileProcessor) extractOutputType(fn *ast.FuncDecl) string {
 	return ""
 }
 
+func (fp *FileProcessor) extractOutputTypes(fn *ast.FuncDecl) []string {
+	var outputTypes []string
+	if fn.Type.Results != nil {
+		for _, result := range fn.Type.Results.List {
+			typeStr := typeToString(result.Type)
+			outputTypes = append(outputTypes, typeStr)
+			for i := 1; i < len(result.Names); i++ {
+				outputTypes = append(outputTypes, typeStr)
+			}
+		}
+	}
+	return outputTypes
+}
+
+// inlinableResult reports whether values of type expr print as literals
+// that compile in the target file; pointers, funcs, channels and errors print
+// as addresses or package-qualified structs instead
+func inlinableResult(expr ast.Expr) bool {
+	switch t := expr.(type) {
+	case *ast.StarExpr, *ast.FuncType, *ast.ChanType:
+		return false
+	case *ast.Ident:
+		return t.Name != "error"
+	case *ast.ArrayType:
+		return inlinableResult(t.Elt)
+	case *ast.MapType:
+		return inlinableResult(t.Key) && inlinableResult(t.Value)
+	case *ast.ParenExpr:
+		return inlinableResult(t.X)
+	default:
+		return true
+	}
+}
+
 func typeToString(expr ast.Expr) string {
 	switch t := expr.(type) {
 	case *ast.Ident:
@@ -340,6 +786,14 @@ func typeToString(expr ast.Expr) string {
 		return "interface{}"
 	case *ast.Ellipsis:
 		return "..." + typeToString(t.Elt)
+	case *ast.IndexExpr:
+		return typeToString(t.X) + "[" + typeToString(t.Index) + "]"
+	case *ast.IndexListExpr:
+		args := make([]string, len(t.Indices))
+		for i, index := range t.Indices {
+			args[i] = typeToString(index)
+		}
+		return typeToString(t.X) + "[" + strings.Join(args, ", ") + "]"
 	case *ast.ChanType:
 		switch t.Dir {
 		case ast.SEND:
@@ -358,14 +812,26 @@ func typeToString(expr ast.Expr) string {
 	}
 }
 
+// IsFunctionFile reports whether path is a helper file: one of FuncFiles or
+// a file whose header has the functions directive, as SkipReason decides
 func (fp *FileProcessor) IsFunctionFile(path string) bool {
-	return slices.Contains(fp.ctx.FuncFiles, path)
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	functions, _ := headerDirectives(abs)
+	return functions || fp.ctx.isHelperFile(abs)
 }
 
 func FilterUserFiles(files []string) []string {
-	ctx := newFilterContext(os.Getenv("GOAHEAD_VERBOSE") == "1")
+	ctx := newFilterContext(NewLoggerFromEnv().Enabled(LogFilter))
 	var userFiles []string
 
+	if ctx.verbose {
+		_, _ = fmt.Fprintf(os.Stderr, "[goahead] File filter mode: %s (GOROOT=%q, GOPATH=%q, module root=%q)\n",
+			ctx.mode, ctx.goroot, ctx.gopath, ctx.boundary())
+	}
+
 	for _, file := range files {
 		include, message := ctx.includeFile(file)
 		if include {
@@ -379,26 +845,76 @@ func FilterUserFiles(files []string) []string {
 	return userFiles
 }
 
+// File filter modes. The standard mode trusts GOROOT/GOPATH prefix checks;
+// the conservative mode is used when either cannot be determined and only
+// accepts files inside the module root. The module-less mode is used when no
+// go.mod encloses the working directory and only accepts files under it.
+const (
+	FilterModeStandard     = "standard"
+	FilterModeConservative = "conservative"
+	FilterModeModuleless   = "module-less"
+)
+
 type filterContext struct {
 	verbose    bool
+	mode       string
 	gopath     string
 	goroot     string
 	absCwd     string
 	moduleRoot string
+	// excludes caches the .goaheadignore and exclude setting rules of each
+	// module root
+	excludes map[string]*excludeRules
 }
 
+var (
+	conservativeFilterWarned sync.Once
+	modulelessFilterLogged   sync.Once
+)
+
 func newFilterContext(verbose bool) *filterContext {
-	ctx := &filterContext{verbose: verbose}
+	ctx := &filterContext{verbose: verbose, mode: FilterModeStandard}
 	ctx.gopath = determineGoPath()
 	ctx.goroot = determineGoRoot()
 	ctx.absCwd, ctx.moduleRoot = determineWorkspace()
+	if ctx.moduleRoot == "" {
+		// The compiler runs in the package directory; without a module the
+		// cwd and relative-path heuristics could let GOROOT sources through
+		// (-trimpath, a relative GOROOT), so nothing above it is accepted
+		ctx.mode = FilterModeModuleless
+		modulelessFilterLogged.Do(func() {
+			_, _ = fmt.Fprintf(os.Stderr, "[goahead] No go.mod found; module-less mode: only files under %s will be processed\n",
+				ctx.boundary())
+		})
+	} else if ctx.goroot == "" || ctx.gopath == "" {
+		// Without these the system-file prefix checks silently match nothing,
+		// so restrict processing to the module instead of including everything
+		ctx.mode = FilterModeConservative
+		conservativeFilterWarned.Do(func() {
+			_, _ = fmt.Fprintf(os.Stderr, "[goahead] WARNING: could not determine GOROOT or GOPATH; only files inside %s will be processed\n",
+				ctx.boundary())
+		})
+	}
 	return ctx
 }
 
+// boundary returns the directory files must live in under the conservative
+// and module-less modes
+func (c *filterContext) boundary() string {
+	if c.moduleRoot != "" {
+		return c.moduleRoot
+	}
+	return c.absCwd
+}
+
+func (c *filterContext) insideBoundary(absFile string) bool {
+	return PathWithin(absFile, c.boundary())
+}
+
 func determineGoPath() string {
 	gopath := os.Getenv("GOPATH")
 	if gopath != "" {
-		return gopath
+		return StripLongPathPrefix(gopath)
 	}
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -410,14 +926,14 @@ func determineGoPath() string {
 func determineGoRoot() string {
 	goroot := os.Getenv("GOROOT")
 	if goroot != "" {
-		return goroot
+		return StripLongPathPrefix(goroot)
 	}
 	cmd := exec.Command("go", "env", "GOROOT")
 	output, err := cmd.Output()
 	if err != nil {
 		return ""
 	}
-	return strings.TrimSpace(string(output))
+	return StripLongPathPrefix(strings.TrimSpace(string(output)))
 }
 
 func determineWorkspace() (string, string) {
@@ -429,20 +945,30 @@ func determineWorkspace() (string, string) {
 	if err != nil {
 		absCwd = cwd
 	}
-	return absCwd, findModuleRoot(cwd)
+	absCwd = StripLongPathPrefix(absCwd)
+	return absCwd, findModuleRoot(absCwd)
 }
 
 func (c *filterContext) includeFile(file string) (bool, string) {
 	absFile := c.absolutePath(file)
-	if shouldExcludeFile(absFile, c.goroot, c.gopath) {
+	if IsSystemFile(absFile, c.goroot, c.gopath) {
 		return false, fmt.Sprintf("[goahead] Skipping system file: %s", file)
 	}
+	if c.mode == FilterModeConservative && !c.insideBoundary(absFile) {
+		return false, fmt.Sprintf("[goahead] Skipping file outside module root (conservative filter): %s", file)
+	}
+	if c.mode == FilterModeModuleless && !c.insideBoundary(absFile) {
+		return false, fmt.Sprintf("[goahead] Skipping file outside %s (module-less mode): %s", c.absCwd, file)
+	}
 	if isVendorPath(file) {
 		return false, fmt.Sprintf("[goahead] Skipping vendor file: %s", file)
 	}
 	if isStdlibPath(file) {
 		return false, fmt.Sprintf("[goahead] Skipping standard library file: %s", file)
 	}
+	if rule := c.excludedBy(absFile); rule != "" {
+		return false, fmt.Sprintf("[goahead] Skipping file excluded by %s: %s", rule, file)
+	}
 	if containsTestDirectory(file) {
 		return true, fmt.Sprintf("[goahead] Including test directory file: %s", file)
 	}
@@ -452,18 +978,37 @@ func (c *filterContext) includeFile(file string) (bool, string) {
 	if isLocalPath(file) {
 		return true, fmt.Sprintf("[goahead] Including local file: %s", file)
 	}
-	if isUserFile(absFile, c.absCwd, c.moduleRoot) {
+	if IsUserFile(absFile, c.absCwd, c.moduleRoot) {
 		return true, fmt.Sprintf("[goahead] Including user file: %s", file)
 	}
 	return false, fmt.Sprintf("[goahead] Skipping non-user file: %s", file)
 }
 
+// excludedBy returns the .goaheadignore or exclude setting rule of its module
+// excluding absFile, "" when none does. An unreadable ignore file excludes
+// nothing here; the codegen run of the package reports it.
+func (c *filterContext) excludedBy(absFile string) string {
+	root := findModuleRoot(filepath.Dir(absFile))
+	if root == "" {
+		root = c.absCwd
+	}
+	rules, ok := c.excludes[root]
+	if !ok {
+		rules, _ = loadExcludeRules(root, projectExcludes(root))
+		if c.excludes == nil {
+			c.excludes = make(map[string]*excludeRules)
+		}
+		c.excludes[root] = rules
+	}
+	return rules.match(absFile, false)
+}
+
 func (c *filterContext) absolutePath(path string) string {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return path
+		return StripLongPathPrefix(path)
 	}
-	return absPath
+	return StripLongPathPrefix(absPath)
 }
 
 func isVendorPath(path string) bool {
@@ -493,26 +1038,40 @@ func isLocalPath(path string) bool {
 	return strings.HasPrefix(path, "./") || filepath.Base(path) == path
 }
 
+// findModuleRoot returns the closest directory from dir upwards holding a
+// go.mod, "" when there is none
 func findModuleRoot(dir string) string {
+	return FindModuleRoot(dir, func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+}
+
+// FindModuleRoot is findModuleRoot with exists reporting whether a go.mod
+// file is at path. Long-path prefixes of dir are not kept in the result.
+func FindModuleRoot(dir string, exists func(path string) bool) string {
+	current := slashPath(dir)
 	for {
-		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
-			return dir
+		if exists(nativePath(strings.TrimSuffix(current, "/")+"/go.mod", dir)) {
+			return nativePath(current, dir)
 		}
-
-		parent := filepath.Dir(dir)
-		if parent == dir {
+		parent := parentSlashPath(current)
+		if parent == current {
 			// We've reached the root directory
 			return ""
 		}
-		dir = parent
+		current = parent
 	}
 }
 
-func shouldExcludeFile(absFile, goroot, gopath string) bool {
-	if goroot != "" && strings.HasPrefix(absFile, goroot) {
+// IsSystemFile reports whether absFile belongs to the Go installation, the
+// module cache or a system directory, which goahead never processes
+func IsSystemFile(absFile, goroot, gopath string) bool {
+	absFile = StripLongPathPrefix(absFile)
+	if goroot != "" && PathWithin(absFile, goroot) {
 		return true
 	}
-	if gopath != "" && strings.Contains(absFile, filepath.Join(gopath, "pkg/mod")) {
+	if gopath != "" && PathWithin(absFile, gopath+"/pkg/mod") {
 		return true
 	}
 	for _, path := range GoInstallPaths {
@@ -536,35 +1095,43 @@ func shouldExcludeFile(absFile, goroot, gopath string) bool {
 	return false
 }
 
-func isUserFile(absFile, absCwd, moduleRoot string) bool {
-	if strings.HasPrefix(absFile, absCwd) {
+// IsUserFile reports whether absFile is one of the user's sources: under the
+// working directory or the module root, a test file, or a relative path
+func IsUserFile(absFile, absCwd, moduleRoot string) bool {
+	if PathWithin(absFile, absCwd) {
 		return true
 	}
-	if moduleRoot != "" && strings.HasPrefix(absFile, moduleRoot) {
+	if moduleRoot != "" && PathWithin(absFile, moduleRoot) {
 		return true
 	}
 	if strings.HasSuffix(absFile, "_test.go") {
 		return true
 	}
-	if !filepath.IsAbs(absFile) {
+	if !isRootedSlashPath(slashPath(absFile)) {
 		return true
 	}
 	return false
 }
 
+// FindCommonDir returns the deepest directory holding every file, in the
+// separator style of the first file and without a long-path prefix
 func FindCommonDir(files []string) string {
 	if len(files) == 0 {
 		return ""
 	}
 
-	commonDir := filepath.Dir(files[0])
+	commonDir := parentSlashPath(slashPath(files[0]))
 	for _, file := range files[1:] {
-		dir := filepath.Dir(file)
-		for !strings.HasPrefix(dir, commonDir) && commonDir != "." && commonDir != "/" {
-			commonDir = filepath.Dir(commonDir)
+		dir := parentSlashPath(slashPath(file))
+		for !PathWithin(dir, commonDir) {
+			parent := parentSlashPath(commonDir)
+			if parent == commonDir {
+				break
+			}
+			commonDir = parent
 		}
 	}
-	return commonDir
+	return nativePath(commonDir, files[0])
 }
 
 func (fp *FileProcessor) ProcessDirectory(dir string, verbose bool, codeProcessor *CodeProcessor) error {
@@ -572,7 +1139,10 @@ func (fp *FileProcessor) ProcessDirectory(dir string, verbose bool, codeProcesso
 		if err != nil {
 			return err
 		}
-		if d.IsDir() || !strings.HasSuffix(path, ".go") || fp.IsFunctionFile(path) {
+		if d.IsDir() && fp.ctx.excludedBy(path, true) != "" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".go") {
 			return nil
 		}
 		if err := codeProcessor.ProcessFile(path, verbose); err != nil {
@@ -587,7 +1157,10 @@ func (fp *FileProcessor) ProcessDirectoryInjections(dir string, verbose bool, in
 		if err != nil {
 			return err
 		}
-		if d.IsDir() || !strings.HasSuffix(path, ".go") || fp.IsFunctionFile(path) {
+		if d.IsDir() && fp.ctx.excludedBy(path, true) != "" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".go") {
 			return nil
 		}
 		if err := injector.ProcessFileInjections(path, verbose); err != nil {
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// LockSuffix is appended to a source file's path to form its advisory lock
+const LockSuffix = ".goahead.lock"
+
+// DefaultLockTTL is the age after which a lock left behind is considered
+// stale and taken over
+const DefaultLockTTL = 30 * time.Second
+
+var errFileLocked = errors.New("file is locked")
+
+// lockFile takes the advisory lock of path: <path>.goahead.lock is created
+// exclusively, so editors and concurrent goahead runs that honor the
+// protocol never rewrite the file at the same time. A lock younger than ttl
+// makes lockFile fail with errFileLocked; an older one is replaced. The
+// returned function removes the lock.
+func lockFile(path string, ttl time.Duration) (func(), error) {
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+	lockPath := path + LockSuffix
+	for attempt := 0; ; attempt++ {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, _ = file.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			_ = file.Close()
+			return func() { _ = os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lock %s: %v", lockPath, err)
+		}
+		if attempt > 0 {
+			// Another process took over the stale lock first
+			return nil, fmt.Errorf("%w by %s", errFileLocked, filepath.Base(lockPath))
+		}
+
+		info, statErr := os.Stat(lockPath)
+		if statErr != nil {
+			continue // released in the meantime
+		}
+		if age := time.Since(info.ModTime()); age < ttl {
+			return nil, fmt.Errorf("%w by %s (%s old, taken over after %s)", errFileLocked,
+				filepath.Base(lockPath), age.Round(time.Second), ttl)
+		}
+		if err := os.Remove(lockPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale lock %s: %v", lockPath, err)
+		}
+	}
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory, so readers never observe a partially written file. The
+// file keeps its permissions.
+func writeFileAtomic(path string, data []byte) error {
+	return writeFileAtomicFrom(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// writeFileAtomicFrom is writeFileAtomic for content produced by write as it
+// goes, which never has to be held in memory whole
+func writeFileAtomicFrom(path string, write func(w io.Writer) error) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".goahead-*")
+	if err != nil {
+		return environmentErrorf("failed to create temp file for %s: %v", path, err)
+	}
+	tmpPath := tmp.Name()
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, mode)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return environmentErrorf("failed to write file %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package internal
+
+import "sync"
+
+// flightGroup runs one function per key at a time: callers arriving while
+// the function for their key runs wait for it and share its result instead
+// of running it again. It is the one thing golang.org/x/sync/singleflight
+// is needed for here, without the dependency.
+type flightGroup[T any] struct {
+	mu      sync.Mutex
+	flights map[string]*flight[T]
+}
+
+type flight[T any] struct {
+	done   chan struct{}
+	result T
+}
+
+// do runs fn for key unless a run is already in flight, in which case it
+// waits for that run. shared reports whether the result came from another
+// caller's run.
+func (g *flightGroup[T]) do(key string, fn func() T) (result T, shared bool) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight[T])
+	}
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		<-f.done
+		return f.result, true
+	}
+	f := &flight[T]{done: make(chan struct{})}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.flights, key)
+		g.mu.Unlock()
+		close(f.done)
+	}()
+	f.result = fn()
+	return f.result, false
+}
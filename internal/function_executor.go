@@ -1,19 +1,23 @@
 package internal
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go/format"
-	gotoken "go/token"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
+
+	"github.com/AeonDave/goahead/marker"
 )
 
 const evalFmtAlias = "goaheadfmt"
@@ -35,30 +39,64 @@ type callTarget struct {
 	packageAlias   string
 	packagePath    string
 	importResolved bool
+	// pin is set when the package comes from a directive that pins its
+	// module version
+	pin *pinnedImport
+	// raw is set for a "=expr" function part, callExpr holding the
+	// expression: it is evaluated as written, without arguments
+	raw bool
 }
 
-type argumentKind int
+// Marker arguments are parsed by the public marker package; the aliases keep
+// the executor's formatting code independent of the package name
+type argumentKind = marker.ArgKind
 
 const (
-	argumentExpression argumentKind = iota
-	argumentString
-	argumentBool
-	argumentInt
-	argumentFloat
+	argumentExpression = marker.ArgExpression
+	argumentString     = marker.ArgString
+	argumentBool       = marker.ArgBool
+	argumentInt        = marker.ArgInt
+	argumentFloat      = marker.ArgFloat
 )
 
-type argument struct {
-	Raw             string
-	Normalized      string
-	Kind            argumentKind
-	AutoQuote       bool
-	ForceExpression bool
-}
+type argument = marker.Argument
 
+// FunctionExecutor evaluates markers by generating and running programs
+// that call the helpers.
+//
+// An executor is safe for concurrent use: ExecuteFunction and ExecuteBatch
+// may be called from several goroutines once Prepare has returned, and
+// concurrent calls for the same marker run the evaluation program once: the
+// others wait for its result. The ProcessorContext must not be
+// modified while calls are in flight.
 type FunctionExecutor struct {
-	ctx *ProcessorContext
+	ctx    *ProcessorContext
+	runner Runner
+
+	// mu guards the caches below; evaluation programs run without holding it
+	mu sync.Mutex
 
 	cache map[string]string
+	// failed holds the panics of calls of -single-program runs by cache key
+	failed map[string]string
+	// prefetched holds the results evaluated ahead by prefetchFiles until
+	// the rewrite pass takes them, see takePrefetched
+	prefetched map[string]BatchResult
+
+	// functionFlights and batchFlights let concurrent identical calls share
+	// one evaluation program, by cache key
+	functionFlights flightGroup[flightResult]
+	batchFlights    flightGroup[BatchResult]
+
+	// pinnedMods holds the go.mod files written for pinned imports, see
+	// pinnedModuleFor
+	pinnedMods map[string]pinnedModule
+	pinFlights flightGroup[pinnedModule]
+
+	// helpersHash qualifies the keys of the persistent result cache, see
+	// persistentKey
+	helpersOnce sync.Once
+	helpersHash string
 
 	// Cache for prepared code per directory
 	preparedByDir map[string]*preparedCode
@@ -66,6 +104,11 @@ type FunctionExecutor struct {
 	// Cache helper files by depth to avoid repeated scans
 	helperFilesByDepth map[int][]string
 
+	// Signatures of external package functions by import path, see externalSignature
+	externalFuncs map[string]map[string]*UserFunction
+
+	// Standard library package names, loaded once by ensureStdImportMap
+	stdOnce      sync.Once
 	stdImportMap map[string]string
 	stdListErr   error
 }
@@ -73,32 +116,191 @@ type FunctionExecutor struct {
 type BatchCall struct {
 	FuncName string
 	ArgsStr  string
+	// Location is the module-relative file:line of the marker, recorded in
+	// -trace-dir traces
+	Location string
+	// Outputs is set for multi-output markers; the result then has one value
+	// per output
+	Outputs []marker.Output
+	// Fields are the keys of the composite literal element below the marker,
+	// "" for unkeyed ones. Helpers returning one value per field, or a
+	// struct, fill the element field by field: the result then has one
+	// value per field.
+	Fields []string
+	// Assignment is set when Fields are the values of a multi-assignment
+	// such as host, port := "", 0, filled positionally
+	Assignment bool
+}
+
+// fieldCount describes the number of Fields of c in messages
+func (c BatchCall) fieldCount() string {
+	if c.Assignment {
+		return fmt.Sprintf("the assignment has %d variables", len(c.Fields))
+	}
+	return fmt.Sprintf("the element has %d fields", len(c.Fields))
 }
 
 type BatchResult struct {
 	Result   string
 	UserFunc *UserFunction
+	// Values holds one formatted value per output of a multi-output call
+	Values []string
+	// TraceID names the -trace-dir entry of the program that produced the
+	// result, empty when it was cached or not traced
+	TraceID string
+	// Duration is the time the call took in that program; Cached results
+	// have none
+	Duration time.Duration
+	Cached   bool
 	Err      error
 }
 
+// evalProgram is a generated evaluation program and what it evaluates
+type evalProgram struct {
+	// source is the formatted program that is run
+	source string
+	// unformatted is the template output before gofmt, kept for traces
+	unformatted string
+	calls       []string
+	markers     []string
+	// inModule places the program inside the project root, so it may
+	// import internal packages of the module (see resolveArgumentImports)
+	inModule bool
+	// pins are the pinned imports the program needs, see pinnedModuleFor
+	pins []pinnedImport
+	// maxMem is the largest //goahead:maxmem of the helpers it calls, the
+	// GOMEMLIMIT it runs with; 0 when none has one
+	maxMem int64
+}
+
 type preparedCode struct {
 	source    string
 	importSet map[string]struct{}
 }
 
 func NewFunctionExecutor(ctx *ProcessorContext) *FunctionExecutor {
+	if ctx.Config.Runner != nil {
+		return NewFunctionExecutorWithRunner(ctx, ctx.Config.Runner)
+	}
+	return NewFunctionExecutorWithRunner(ctx, goRunner{interrupt: ctx.Interrupt, timeout: ctx.Config.ExecTimeout})
+}
+
+// NewFunctionExecutorWithRunner creates an executor that runs the go
+// command through runner
+func NewFunctionExecutorWithRunner(ctx *ProcessorContext, runner Runner) *FunctionExecutor {
+	ctx.Logger() // initialize the lazy logger before concurrent use
 	return &FunctionExecutor{
 		ctx:           ctx,
+		runner:        runner,
 		cache:         make(map[string]string),
+		failed:        make(map[string]string),
+		prefetched:    make(map[string]BatchResult),
+		pinnedMods:    make(map[string]pinnedModule),
 		preparedByDir: make(map[string]*preparedCode),
 	}
 }
 
+// cachedResult and storeResult leave the cache alone for nocache helpers
+func (fe *FunctionExecutor) cachedResult(target callTarget, key string) (string, bool) {
+	if noCache(target) {
+		return "", false
+	}
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	result, ok := fe.cache[key]
+	return result, ok
+}
+
+func (fe *FunctionExecutor) storeResult(target callTarget, key, result string) {
+	if noCache(target) {
+		return
+	}
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	fe.cache[key] = result
+}
+
+// failedResult and storeFailure record the calls that panicked in a
+// -single-program run, which are not evaluated again
+func (fe *FunctionExecutor) failedResult(key string) (string, bool) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	message, ok := fe.failed[key]
+	return message, ok
+}
+
+func (fe *FunctionExecutor) storeFailure(key, message string) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	fe.failed[key] = message
+}
+
+// storePrefetched and takePrefetched hand the results of prefetchFiles to the
+// rewrite pass. The first call taking a result gets it as if it had just
+// been evaluated, program run time and trace included, so stats and hooks
+// are those of a serial run; later identical calls hit the cache as usual.
+func (fe *FunctionExecutor) storePrefetched(pending []pendingCall, results []BatchResult) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	for i, call := range pending {
+		if results[i].Err == nil {
+			fe.prefetched[call.cacheKey] = results[i]
+		}
+	}
+}
+
+func (fe *FunctionExecutor) takePrefetched(key string) (BatchResult, bool) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	result, ok := fe.prefetched[key]
+	delete(fe.prefetched, key)
+	return result, ok
+}
+
+func noCache(target callTarget) bool {
+	return target.userFunc != nil && target.userFunc.NoCache
+}
+
+// Prepare reports the helper files that could not be loaded, all at once and
+// before any file is processed. With Config.SkipBrokenHelpers they become
+// warnings instead. Helper code itself is assembled on demand per directory.
 func (fe *FunctionExecutor) Prepare() error {
-	// No-op now, preparation happens on demand per directory
+	broken := fe.ctx.BrokenHelpers
+	if len(broken) == 0 {
+		return nil
+	}
+	if !fe.ctx.Config.SkipBrokenHelpers {
+		return &HelperLoadError{Files: broken, root: fe.ctx.RootDir}
+	}
+	for _, b := range broken {
+		fe.ctx.Warn(Diagnostic{
+			Rule:    RuleBrokenHelper,
+			File:    b.File,
+			Message: fmt.Sprintf("skipping helper file %s: %v", fe.ctx.relToRoot(b.File), b.Err),
+		})
+	}
 	return nil
 }
 
+// HelperLoadError lists every helper file that could not be read or parsed
+type HelperLoadError struct {
+	Files []BrokenHelper
+	root  string
+}
+
+func (e *HelperLoadError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d helper file(s) could not be loaded (use -skip-broken-helpers to continue without them):", len(e.Files))
+	for _, f := range e.Files {
+		rel, err := filepath.Rel(e.root, f.File)
+		if err != nil {
+			rel = f.File
+		}
+		fmt.Fprintf(&b, "\n  %s: %v", filepath.ToSlash(rel), f.Err)
+	}
+	return b.String()
+}
+
 func (fe *FunctionExecutor) ExecuteFunction(funcName string, argsStr string, sourceDir string) (string, *UserFunction, error) {
 	args, err := fe.parseArguments(argsStr)
 	if err != nil {
@@ -106,6 +308,9 @@ func (fe *FunctionExecutor) ExecuteFunction(funcName string, argsStr string, sou
 	}
 
 	target, err := fe.determineTarget(funcName, sourceDir)
+	if err == nil {
+		err = checkInlinable(target)
+	}
 	if err != nil {
 		return "", nil, err
 	}
@@ -115,45 +320,88 @@ func (fe *FunctionExecutor) ExecuteFunction(funcName string, argsStr string, sou
 	if err != nil {
 		return "", nil, err
 	}
-	if cached, ok := fe.cache[key]; ok {
+	if cached, ok := fe.cachedResult(target, key); ok {
+		fe.ctx.Logger().Logf(LogCache, "[goahead] Cache hit: %s in %s", target.callExpr, sourceDir)
 		return cached, target.userFunc, nil
 	}
+	if persisted, ok := fe.persistedResult(target, key); ok {
+		fe.ctx.Logger().Logf(LogCache, "[goahead] Result cache hit: %s in %s", target.callExpr, sourceDir)
+		return persisted, target.userFunc, nil
+	}
+	if noCache(target) {
+		return fe.evaluateFunction(target, args, key, sourceDir)
+	}
 
-	formattedArgs, err := fe.formatArguments(target, args)
-	if err != nil {
-		return "", nil, err
+	// Concurrent misses on the same call share one program; a caller that
+	// missed the cache just before a run stored it finds the result there
+	evaluated, shared := fe.functionFlights.do(key, func() flightResult {
+		if cached, ok := fe.cachedResult(target, key); ok {
+			return flightResult{value: cached}
+		}
+		value, _, err := fe.evaluateFunction(target, args, key, sourceDir)
+		return flightResult{value: value, err: err}
+	})
+	if shared {
+		fe.sharedEvaluation(target, sourceDir)
 	}
+	if evaluated.err != nil {
+		return "", nil, evaluated.err
+	}
+	return evaluated.value, target.userFunc, nil
+}
 
-	callExpr := target.callExpr
-	if len(formattedArgs) > 0 {
-		callExpr = fmt.Sprintf("%s(%s)", target.callExpr, strings.Join(formattedArgs, ", "))
-	} else {
-		callExpr = fmt.Sprintf("%s()", target.callExpr)
+// flightResult is the outcome of a call shared by functionFlights
+type flightResult struct {
+	value string
+	err   error
+}
+
+// sharedEvaluation counts a call that got the result of an identical call
+// already in flight instead of running its own program
+func (fe *FunctionExecutor) sharedEvaluation(target callTarget, sourceDir string) {
+	fe.ctx.Logger().Logf(LogCache, "[goahead] Shared evaluation: %s in %s", target.callExpr, sourceDir)
+	fe.ctx.Stats.add(func(s *RunStats) { s.SharedEvaluations++ })
+}
+
+// evaluateFunction builds and runs the program for one call of
+// ExecuteFunction and caches its result under key
+func (fe *FunctionExecutor) evaluateFunction(target callTarget, args []argument, key, sourceDir string) (string, *UserFunction, error) {
+	callExpr, argImports, err := fe.callExpression(target, args, sourceDir)
+	if err != nil {
+		return "", nil, err
 	}
+	callExpr = limitedCallExpr(target, appliedCallExpr(target, callExpr))
 
-	program, err := fe.buildProgramForDir(target, callExpr, sourceDir)
+	program, err := fe.buildProgramForDir(target, callExpr, sourceDir, argImports)
 	if err != nil {
 		return "", nil, err
 	}
 
-	result, err := fe.executeProgram(program)
+	output, _, err := fe.executeProgram(program, sourceDir)
+	var results []string
+	if err == nil {
+		results, _, err = fe.decodeResults(output, 1, sourceDir)
+	}
 	if err != nil {
+		err = fe.explainExpressionFailure(err, []callTarget{target}, sourceDir)
 		if target.kind == invocationExternal && !target.importResolved {
+			_, stdListErr := fe.stdImports()
 			suggestion := fmt.Sprintf("%s=%s", target.packageAlias, target.packagePath)
-			if target.packagePath == target.packageAlias && fe.stdListErr != nil {
+			if target.packagePath == target.packageAlias && stdListErr != nil {
 				suggestion = fmt.Sprintf("%s=<import path>", target.packageAlias)
 			}
 			extra := ""
-			if fe.stdListErr != nil {
-				extra = fmt.Sprintf(" (automatic standard library resolution failed: %v)", fe.stdListErr)
+			if stdListErr != nil {
+				extra = fmt.Sprintf(" (automatic standard library resolution failed: %v)", stdListErr)
 			}
 			return "", nil, fmt.Errorf("%w. Add //go:ahead import %s in a function file to declare the package alias%s", err, suggestion, extra)
 		}
 		return "", nil, err
 	}
 
-	fe.cache[key] = result
-	return result, target.userFunc, nil
+	fe.storeResult(target, key, results[0])
+	fe.persistResult(target, key, results[0])
+	return results[0], target.userFunc, nil
 }
 
 func (fe *FunctionExecutor) ExecuteBatch(calls []BatchCall, sourceDir string) []BatchResult {
@@ -162,126 +410,489 @@ func (fe *FunctionExecutor) ExecuteBatch(calls []BatchCall, sourceDir string) []
 		return results
 	}
 
-	type pendingCall struct {
-		index    int
-		callExpr string
-		target   callTarget
-		cacheKey string
-	}
-
 	var pending []pendingCall
-	callExprs := make([]string, 0, len(calls))
-	targets := make([]callTarget, 0, len(calls))
-
 	for i, call := range calls {
-		args, err := fe.parseArguments(call.ArgsStr)
-		if err != nil {
+		p, cached, err := fe.prepareCall(call, sourceDir)
+		switch {
+		case err != nil:
 			results[i].Err = err
-			continue
+		case cached != nil:
+			results[i] = *cached
+		default:
+			p.index = i
+			pending = append(pending, p)
+		}
+	}
+	// A lone call, as ExecuteAll makes them, is shared with identical ones
+	// running at the same time
+	if len(pending) == 1 && !noCache(pending[0].target) {
+		p := pending[0]
+		result, shared := fe.batchFlights.do(p.cacheKey+"|"+outputsKey(p.call.Outputs), func() BatchResult {
+			if cached, ok := fe.cachedResult(p.target, p.cacheKey); ok {
+				fe.ctx.Stats.add(func(s *RunStats) { s.CacheHits++ })
+				result := newBatchResult(cached, p.target, p.call)
+				result.Cached = true
+				return result
+			}
+			return fe.runPending(pending, sourceDir, false)[0]
+		})
+		if shared {
+			fe.sharedEvaluation(p.target, sourceDir)
 		}
+		results[p.index] = result
+		return results
+	}
+	for i, result := range fe.runPending(pending, sourceDir, false) {
+		results[pending[i].index] = result
+	}
+	return results
+}
 
-		target, err := fe.determineTarget(call.FuncName, sourceDir)
-		if err != nil {
+// pendingCall is a call resolved and formatted for an evaluation program
+type pendingCall struct {
+	index    int
+	call     BatchCall
+	callExpr string
+	target   callTarget
+	cacheKey string
+	imports  argumentImports
+}
+
+// prepareCall resolves call and formats its expression. A call whose result
+// is cached returns it instead, as does one that failed in a -single-program
+// run.
+func (fe *FunctionExecutor) prepareCall(call BatchCall, sourceDir string) (pendingCall, *BatchResult, error) {
+	args, err := fe.parseArguments(call.ArgsStr)
+	if err != nil {
+		return pendingCall{}, nil, err
+	}
+
+	target, err := fe.determineTarget(call.FuncName, sourceDir)
+	// Struct pointers can still feed variables and elements by field
+	if err == nil && len(call.Outputs) == 0 && len(call.Fields) == 0 {
+		err = checkInlinable(target)
+	}
+	if err != nil {
+		return pendingCall{}, nil, err
+	}
+
+	key, err := fe.cacheKeyWithDir(target, args, sourceDir)
+	if err != nil {
+		return pendingCall{}, nil, err
+	}
+	if len(call.Outputs) > 0 {
+		key += "|->" + outputsKey(call.Outputs)
+	}
+	if len(call.Fields) > 0 {
+		key += "|{" + strings.Join(call.Fields, ",") + "}"
+	}
+	if prefetched, ok := fe.takePrefetched(key); ok {
+		result := newBatchResult(prefetched.Result, target, call)
+		result.TraceID, result.Duration = prefetched.TraceID, prefetched.Duration
+		return pendingCall{}, &result, nil
+	}
+	cached, ok := fe.cachedResult(target, key)
+	if ok {
+		fe.ctx.Logger().Logf(LogCache, "[goahead] Cache hit: %s in %s", target.callExpr, sourceDir)
+	} else if cached, ok = fe.persistedResult(target, key); ok {
+		fe.ctx.Logger().Logf(LogCache, "[goahead] Result cache hit: %s in %s", target.callExpr, sourceDir)
+	}
+	if ok {
+		fe.ctx.Stats.add(func(s *RunStats) { s.CacheHits++ })
+		result := newBatchResult(cached, target, call)
+		result.Cached = true
+		return pendingCall{}, &result, nil
+	}
+	if message, ok := fe.failedResult(key); ok {
+		return pendingCall{}, nil, fmt.Errorf("helper %s panicked: %s", call.FuncName, message)
+	}
+
+	callExpr, argImports, err := fe.callExpression(target, args, sourceDir)
+	if err != nil {
+		return pendingCall{}, nil, err
+	}
+	if len(call.Outputs) > 0 {
+		if callExpr, err = multiOutputCallExpr(target, callExpr, call.Outputs); err != nil {
+			return pendingCall{}, nil, err
+		}
+	} else if len(call.Fields) > 0 {
+		if callExpr, err = elementCallExpr(target, callExpr, call); err != nil {
+			return pendingCall{}, nil, err
+		}
+	} else {
+		callExpr = appliedCallExpr(target, callExpr)
+	}
+
+	return pendingCall{
+		call:     call,
+		callExpr: limitedCallExpr(target, callExpr),
+		target:   target,
+		cacheKey: key,
+		imports:  argImports,
+	}, nil, nil
+}
+
+// runPending evaluates pending in one program and returns their results in
+// order. With isolate, a call that panics fails alone: the others keep their
+// results, and the panic is remembered for the marker of the call (see
+// failedResult).
+func (fe *FunctionExecutor) runPending(pending []pendingCall, sourceDir string, isolate bool) []BatchResult {
+	results := make([]BatchResult, len(pending))
+	if len(pending) == 0 {
+		return results
+	}
+
+	callExprs := make([]string, len(pending))
+	targets := make([]callTarget, len(pending))
+	var locations []string
+	var batchImports argumentImports
+	for i, call := range pending {
+		if BeforeCallHook != nil {
+			BeforeCallHook(call.call.FuncName)
+		}
+		callExprs[i] = call.callExpr
+		targets[i] = call.target
+		if call.call.Location != "" {
+			locations = append(locations, call.call.Location)
+		}
+		batchImports.specs = append(batchImports.specs, call.imports.specs...)
+		batchImports.inModule = batchImports.inModule || call.imports.inModule
+		for i := range call.imports.pins {
+			batchImports.pins = addPin(batchImports.pins, &call.imports.pins[i])
+		}
+	}
+
+	fail := func(err error, traceID string) []BatchResult {
+		for i := range results {
 			results[i].Err = err
+			results[i].TraceID = traceID
+		}
+		return results
+	}
+	program, err := fe.buildProgramForDirBatch(targets, callExprs, sourceDir, batchImports, isolate)
+	if err != nil {
+		return fail(err, "")
+	}
+	program.markers = locations
+
+	start := time.Now()
+	output, traceID, err := fe.executeProgram(program, sourceDir)
+	duration := time.Since(start)
+	if err != nil && len(pending) > 1 && compileFailure(err) && hasRawTarget(targets) {
+		// A "=expr" function part that does not compile fails alone: each
+		// call gets a program of its own and reports its own error
+		for i := range pending {
+			results[i] = fe.runPending(pending[i:i+1], sourceDir, isolate)[0]
+		}
+		return results
+	}
+	if err != nil {
+		return fail(fe.explainExpressionFailure(err, targets, sourceDir), traceID)
+	}
+
+	lines, durations, err := fe.decodeResults(output, len(pending), sourceDir)
+	if err != nil {
+		return fail(err, traceID)
+	}
+
+	for i, call := range pending {
+		result := lines[i]
+		if message, ok := strings.CutPrefix(result, EvalFailedPrefix); ok {
+			fe.storeFailure(call.cacheKey, message)
+			results[i] = BatchResult{Err: fmt.Errorf("helper %s panicked: %s", call.call.FuncName, message), TraceID: traceID}
 			continue
 		}
+		fe.storeResult(call.target, call.cacheKey, result)
+		fe.persistResult(call.target, call.cacheKey, result)
+		results[i] = newBatchResult(result, call.target, call.call)
+		results[i].TraceID = traceID
+		results[i].Duration = duration
+		if durations != nil {
+			results[i].Duration = durations[i]
+		}
+	}
+	return results
+}
 
-		key, err := fe.cacheKeyWithDir(target, args, sourceDir)
-		if err != nil {
-			results[i].Err = err
+// ExecuteAll evaluates calls like ExecuteBatch, but each distinct call
+// runs in its own program and up to jobs programs run at once. Results are
+// returned in the order of calls, each with its own error; identical calls
+// are evaluated once. jobs below 1 means 1.
+func (fe *FunctionExecutor) ExecuteAll(calls []BatchCall, sourceDir string, jobs int) []BatchResult {
+	results := make([]BatchResult, len(calls))
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	// Group identical calls; the first of each group is evaluated
+	first := make(map[string]int)
+	groups := make(map[int][]int)
+	var distinct []int
+	for i, call := range calls {
+		key := call.FuncName + "\x00" + call.ArgsStr + "\x00" + outputsKey(call.Outputs)
+		// Calls to nocache helpers are never shared
+		if fn, _ := fe.ctx.ResolveFunction(call.FuncName, sourceDir); fn != nil && fn.NoCache {
+			distinct = append(distinct, i)
 			continue
 		}
-		if cached, ok := fe.cache[key]; ok {
-			results[i] = BatchResult{Result: cached, UserFunc: target.userFunc}
+		if j, ok := first[key]; ok {
+			groups[j] = append(groups[j], i)
 			continue
 		}
+		first[key] = i
+		distinct = append(distinct, i)
+	}
+
+	var wg sync.WaitGroup
+	var panics workerPanics
+	semaphore := make(chan struct{}, jobs)
+	for _, i := range distinct {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer panics.catch()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			if fe.ctx.interrupted() {
+				results[i] = BatchResult{Err: ErrInterrupted}
+				return
+			}
+			results[i] = fe.ExecuteBatch(calls[i:i+1], sourceDir)[0]
+		}(i)
+	}
+	wg.Wait()
+	panics.raise()
 
-		formattedArgs, err := fe.formatArguments(target, args)
-		if err != nil {
-			results[i].Err = err
-			continue
+	for i, same := range groups {
+		for _, j := range same {
+			results[j] = results[i]
 		}
+	}
+	return results
+}
 
-		callExpr := target.callExpr
-		if len(formattedArgs) > 0 {
-			callExpr = fmt.Sprintf("%s(%s)", target.callExpr, strings.Join(formattedArgs, ", "))
-		} else {
-			callExpr = fmt.Sprintf("%s()", target.callExpr)
+// hasLimits reports whether target is a helper with a //goahead:timeout or
+// //goahead:maxmem directive
+func hasLimits(target callTarget) bool {
+	return target.userFunc != nil && (target.userFunc.Timeout > 0 || target.userFunc.MaxMem > 0)
+}
+
+// maxMem returns the largest //goahead:maxmem of targets, 0 when none has one
+func maxMem(targets []callTarget) int64 {
+	var largest int64
+	for _, target := range targets {
+		if target.userFunc != nil {
+			largest = max(largest, target.userFunc.MaxMem)
 		}
+	}
+	return largest
+}
 
-		pending = append(pending, pendingCall{
-			index:    i,
-			callExpr: callExpr,
-			target:   target,
-			cacheKey: key,
-		})
-		callExprs = append(callExprs, callExpr)
-		targets = append(targets, target)
+// limitsAddressSpace reports whether the program calling targets caps its
+// address space during the calls with a maxmem, which it does on Linux
+func limitsAddressSpace(targets []callTarget) bool {
+	return runtime.GOOS == "linux" && maxMem(targets) > 0
+}
+
+// limitedCallExpr runs callExpr through goaheadLimit (see evalLimitCode)
+// when the helper declares limits
+func limitedCallExpr(target callTarget, callExpr string) string {
+	if !hasLimits(target) {
+		return callExpr
 	}
+	fn := target.userFunc
+	return fmt.Sprintf("goaheadLimit(%q, %d, %d, func() any { return goaheadFirst(%s) })", fn.Name, int64(fn.Timeout), fn.MaxMem, callExpr)
+}
 
-	if len(pending) == 0 {
-		return results
+// returnsApply reports whether fn returns (value, apply bool), the helpers
+// that may decline to replace their target
+func returnsApply(fn *UserFunction) bool {
+	return fn != nil && len(fn.OutputTypes) == 2 && fn.OutputTypes[1] == "bool"
+}
+
+// appliedCallExpr runs callExpr through goaheadApply (see evalResultCode)
+// when the helper returns (value, apply bool)
+func appliedCallExpr(target callTarget, callExpr string) string {
+	if !returnsApply(target.userFunc) {
+		return callExpr
 	}
+	return fmt.Sprintf("goaheadApply(%s)", callExpr)
+}
 
-	program, err := fe.buildProgramForDirBatch(targets, callExprs, sourceDir)
-	if err != nil {
-		for _, call := range pending {
-			results[call.index].Err = err
+// newBatchResult wraps one output line, splitting the values of a
+// multi-output call and of an element filled field by field
+func newBatchResult(line string, target callTarget, call BatchCall) BatchResult {
+	result := BatchResult{Result: line, UserFunc: target.userFunc}
+	if len(call.Outputs) > 0 {
+		result.Values, result.Err = splitMultiOutput(line, target, call.Outputs)
+	} else if fields, ok := strings.CutPrefix(line, ElementFieldsPrefix); ok {
+		result.Values, result.Err = splitElementFields(fields, target, call)
+	}
+	return result
+}
+
+// elementCallExpr wraps callExpr so that a helper with one result per field
+// of the element, or returning a struct, prints one value per field (see
+// goaheadElement). Other helpers fill the element like any marker target.
+func elementCallExpr(target callTarget, callExpr string, call BatchCall) (string, error) {
+	fields := call.Fields
+	results := resultTypes(target.userFunc)
+	switch {
+	case target.userFunc == nil || returnsApply(target.userFunc) && len(fields) != 2:
+		return appliedCallExpr(target, callExpr), nil
+	case len(results) > 1 && len(results) != len(fields):
+		return "", outputMismatchf("%s returns %d values but %s", target.callExpr, len(results), call.fieldCount())
+	case len(results) > 1:
+		return fmt.Sprintf("goaheadElementValues(goaheadTuple(%s))", callExpr), nil
+	}
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = strconv.Quote(field)
+	}
+	return fmt.Sprintf("goaheadElement(goaheadFirst(%s), %s)", callExpr, strings.Join(names, ", ")), nil
+}
+
+// splitElementFields splits the values printed for an element filled field
+// by field, like splitMultiOutput
+func splitElementFields(line string, target callTarget, call BatchCall) ([]string, error) {
+	fields := call.Fields
+	values := strings.Split(line, "\t")
+	if len(values) < len(fields) {
+		return nil, outputMismatchf("%s returned %d values but %s", target.callExpr, len(values), call.fieldCount())
+	}
+	// A trailing error result is dropped
+	values = values[:len(fields)]
+	var missing []string
+	for _, value := range values {
+		if field, ok := strings.CutPrefix(value, MissingFieldPrefix); ok {
+			missing = append(missing, field)
 		}
-		return results
 	}
+	if len(missing) > 0 {
+		return nil, outputMismatchf("result of %s has no exported field %s", target.callExpr, strings.Join(missing, ", "))
+	}
+	return values, nil
+}
 
-	output, err := fe.executeProgram(program)
-	if err != nil {
-		for _, call := range pending {
-			results[call.index].Err = err
+// multiOutputCallExpr wraps callExpr so that it prints one value per output:
+// the positional results of a multi-value helper, or the named fields of a
+// helper returning a single struct
+func multiOutputCallExpr(target callTarget, callExpr string, outputs []marker.Output) (string, error) {
+	results := resultTypes(target.userFunc)
+	hasFields := false
+	for _, out := range outputs {
+		if out.Field != "" {
+			hasFields = true
 		}
-		return results
 	}
 
-	lines := splitOutputLines(output)
-	if len(lines) != len(pending) {
-		err := fmt.Errorf("unexpected batch output lines: expected %d got %d", len(pending), len(lines))
-		for _, call := range pending {
-			results[call.index].Err = err
+	if target.userFunc != nil && len(results) == 1 && (len(outputs) > 1 || hasFields) {
+		fields := make([]string, len(outputs))
+		for i, out := range outputs {
+			fields[i] = strconv.Quote(outputField(out))
 		}
-		return results
+		return fmt.Sprintf("goaheadFields(goaheadFirst(%s), %s)", callExpr, strings.Join(fields, ", ")), nil
 	}
+	if hasFields {
+		return "", outputMismatchf("field mappings need a helper returning a single struct, %s returns %d values",
+			target.callExpr, len(results))
+	}
+	if target.userFunc != nil && len(results) != len(outputs) {
+		return "", outputMismatchf("%s returns %d values but the marker names %d variables",
+			target.callExpr, len(results), len(outputs))
+	}
+	return fmt.Sprintf("goaheadTuple(%s)", callExpr), nil
+}
 
-	for i, call := range pending {
-		result := lines[i]
-		fe.cache[call.cacheKey] = result
-		results[call.index] = BatchResult{Result: result, UserFunc: call.target.userFunc}
+// splitMultiOutput splits the tab-separated values printed for a
+// multi-output call; a trailing error result is dropped
+func splitMultiOutput(line string, target callTarget, outputs []marker.Output) ([]string, error) {
+	values := strings.Split(line, "\t")
+	if len(values) < len(outputs) {
+		return nil, outputMismatchf("%s returned %d values but the marker names %d variables",
+			target.callExpr, len(values), len(outputs))
+	}
+	values = values[:len(outputs)]
+	var missing []string
+	for _, value := range values {
+		if field, ok := strings.CutPrefix(value, MissingFieldPrefix); ok {
+			missing = append(missing, field)
+		}
 	}
+	if len(missing) > 0 {
+		return nil, outputMismatchf("result of %s has no exported field %s", target.callExpr, strings.Join(missing, ", "))
+	}
+	return values, nil
+}
 
-	return results
+// resultTypes returns the helper's result types without a trailing error
+func resultTypes(fn *UserFunction) []string {
+	if fn == nil {
+		return nil
+	}
+	types := fn.OutputTypes
+	if len(types) > 1 && types[len(types)-1] == "error" {
+		types = types[:len(types)-1]
+	}
+	return types
 }
 
-func (fe *FunctionExecutor) parseArguments(argsStr string) ([]argument, error) {
-	if strings.TrimSpace(argsStr) == "" {
-		return nil, nil
+// outputField is the struct field read for out: the explicit mapping, or
+// the variable name with its first letter upper-cased
+func outputField(out marker.Output) string {
+	if out.Field != "" {
+		return out.Field
 	}
+	return exportedName(out.Var)
+}
 
-	rawArgs, err := splitArguments(argsStr)
-	if err != nil {
-		return nil, err
+func outputsKey(outputs []marker.Output) string {
+	parts := make([]string, len(outputs))
+	for i, out := range outputs {
+		parts[i] = out.String()
 	}
+	return strings.Join(parts, ",")
+}
 
-	args := make([]argument, len(rawArgs))
-	for i, token := range rawArgs {
-		args[i] = classifyArgument(token)
+func (fe *FunctionExecutor) parseArguments(argsStr string) ([]argument, error) {
+	return marker.ParseArguments(argsStr)
+}
+
+// checkInlinable rejects single-value calls of helpers returning pointers,
+// funcs, channels or errors before their program runs; their %#v text does
+// not compile where it would be written
+func checkInlinable(target callTarget) error {
+	if fn := target.userFunc; fn != nil && fn.NotInlinable {
+		return fmt.Errorf("helper %s returns %s %w; return a string, number or bool, or a slice or map of them",
+			fn.Name, fn.OutputType, errNotInlinable)
 	}
-	return args, nil
+	return nil
 }
 
 func (fe *FunctionExecutor) determineTarget(funcName string, sourceDir string) (callTarget, error) {
+	if expr, ok := strings.CutPrefix(funcName, "="); ok {
+		return rawTarget(strings.TrimSpace(expr))
+	}
+	if strings.Contains(funcName, "(") {
+		return fe.expressionTarget(funcName, sourceDir)
+	}
+
 	// Use hierarchical resolution: walk up from sourceDir to find the function
 	if fn, helperPath := fe.ctx.ResolveFunction(funcName, sourceDir); fn != nil {
 		_ = helperPath // Used for logging in caller
+		callExpr := fn.programName()
+		if _, typeArgs := marker.SplitTypeArgs(funcName); typeArgs != "" {
+			inst, err := instantiate(fn, typeArgs)
+			if err != nil {
+				return callTarget{}, err
+			}
+			fn = inst
+			callExpr += "[" + typeArgs + "]"
+		}
 		return callTarget{
 			kind:     invocationUser,
 			userFunc: fn,
-			callExpr: funcName,
+			callExpr: callExpr,
 		}, nil
 	}
 
@@ -290,12 +901,12 @@ func (fe *FunctionExecutor) determineTarget(funcName string, sourceDir string) (
 		// Provide helpful error message
 		// Check if it's a lowercase function (unexported)
 		if len(funcName) > 0 && funcName[0] >= 'a' && funcName[0] <= 'z' {
-			return callTarget{}, fmt.Errorf("function '%s' not found (note: only exported/uppercase functions are available)", funcName)
+			return callTarget{}, fmt.Errorf("function '%s' %w (note: only exported/uppercase functions are available)", funcName, errFunctionNotFound)
 		}
-		return callTarget{}, fmt.Errorf("function '%s' not found; define it in a //go:ahead functions file", funcName)
+		return callTarget{}, fmt.Errorf("function '%s' %w; define it in a //go:ahead functions file", funcName, errFunctionNotFound)
 	}
 
-	path, resolved := fe.resolveImportPath(alias)
+	path, pin, resolved := fe.resolveImportPath(alias)
 
 	return callTarget{
 		kind:           invocationExternal,
@@ -303,24 +914,64 @@ func (fe *FunctionExecutor) determineTarget(funcName string, sourceDir string) (
 		packageAlias:   alias,
 		packagePath:    path,
 		importResolved: resolved,
+		pin:            pin,
 	}, nil
 }
 
-func (fe *FunctionExecutor) resolveImportPath(alias string) (string, bool) {
+// resolveImportPath returns the import path of alias, and the directive
+// pinning its module version if there is one
+func (fe *FunctionExecutor) resolveImportPath(alias string) (string, *pinnedImport, bool) {
 	if alias == "" {
-		return "", false
+		return "", nil, false
+	}
+	imp, ok := fe.ctx.FileImports[alias]
+	if !ok {
+		imp, ok = fe.ctx.ImportAliases[alias]
+	}
+	if ok {
+		if imp.Version != "" {
+			return imp.Path, &pinnedImport{Alias: alias, ImportAlias: imp}, true
+		}
+		return imp.Path, nil, true
+	}
+	stdImports, _ := fe.stdImports()
+	if path, ok := stdImports[alias]; ok && path != "" {
+		return path, nil, true
+	}
+	return alias, nil, false
+}
+
+// callExpression resolves the packages of the "=expr" arguments of a call
+// of target and returns the call with its arguments formatted
+func (fe *FunctionExecutor) callExpression(target callTarget, args []argument, sourceDir string) (string, argumentImports, error) {
+	if target.raw {
+		if len(args) > 0 {
+			return "", argumentImports{}, fmt.Errorf("expression =%s takes no arguments; write them in the expression", target.callExpr)
+		}
+		// Its packages are imported as for an "=expr" argument
+		args = []argument{{Raw: target.callExpr, Normalized: target.callExpr, Kind: argumentExpression, ForceExpression: true}}
+	}
+	args, argImports, err := fe.resolveArgumentImports(args, sourceDir)
+	if err != nil {
+		return "", argumentImports{}, err
+	}
+	formattedArgs, err := fe.formatArguments(target, args)
+	if err != nil {
+		return "", argumentImports{}, err
 	}
-	fe.ensureStdImportMap()
-	if path, ok := fe.stdImportMap[alias]; ok && path != "" {
-		return path, true
+	if target.raw {
+		return formattedArgs[0], argImports, nil
 	}
-	return alias, false
+	return fmt.Sprintf("%s(%s)", target.callExpr, strings.Join(formattedArgs, ", ")), argImports, nil
 }
 
 func (fe *FunctionExecutor) formatArguments(target callTarget, args []argument) ([]string, error) {
-	if target.kind != invocationUser {
+	if target.raw {
 		return formatExternalArguments(args), nil
 	}
+	if target.kind != invocationUser {
+		return fe.formatExternalCall(target, args)
+	}
 	return formatUserArguments(target.userFunc, args)
 }
 
@@ -333,34 +984,37 @@ func formatExternalArguments(args []argument) []string {
 }
 
 func formatUserArguments(fn *UserFunction, args []argument) ([]string, error) {
-	expected := fn.InputTypes
-
-	// Check for variadic function (last param starts with ...)
-	isVariadic := len(expected) > 0 && strings.HasPrefix(expected[len(expected)-1], "...")
+	return formatTypedArguments(fn, args, formatArgumentForType)
+}
 
-	if isVariadic {
-		// For variadic functions, we need at least (len(expected) - 1) arguments
-		minArgs := len(expected) - 1
-		if len(args) < minArgs {
-			return nil, fmt.Errorf("function %s expects at least %d arguments, got %d", fn.Name, minArgs, len(args))
-		}
-	} else {
-		if len(expected) != len(args) {
-			return nil, fmt.Errorf("function %s expects %d arguments, got %d", fn.Name, len(expected), len(args))
+// formatTypedArguments checks args against fn's parameters and formats each
+// one for its expected type with formatArg
+func formatTypedArguments(fn *UserFunction, args []argument, formatArg func(argument, string) (string, error)) ([]string, error) {
+	expected := fn.InputTypes
+	if fn.Variadic {
+		// The fixed parameters come first, then any number of trailing
+		// arguments of the element type, none included
+		fixed := len(expected) - 1
+		if len(args) < fixed {
+			return nil, fmt.Errorf("function %s expects at least %d arguments, got %d", fn.Name, fixed, len(args))
 		}
+	} else if len(expected) != len(args) {
+		return nil, fmt.Errorf("function %s expects %d arguments, got %d", fn.Name, len(expected), len(args))
 	}
 
 	formatted := make([]string, len(args))
 	for i, arg := range args {
-		var typ string
-		if i < len(expected)-1 || !isVariadic {
+		typ := fn.VariadicElem
+		if !fn.Variadic || i < len(expected)-1 {
 			typ = expected[i]
-		} else {
-			// Variadic argument: extract element type from "...T"
-			typ = strings.TrimPrefix(expected[len(expected)-1], "...")
+		}
+		if fn.usesTypeParam(typ) {
+			// Left to inference, the argument is passed as written
+			formatted[i] = argDisplayForExternal(arg)
+			continue
 		}
 
-		value, err := formatArgumentForType(arg, typ)
+		value, err := formatArg(arg, typ)
 		if err != nil {
 			return nil, fmt.Errorf("argument %d for %s: %w", i, fn.Name, err)
 		}
@@ -369,10 +1023,10 @@ func formatUserArguments(fn *UserFunction, args []argument) ([]string, error) {
 	return formatted, nil
 }
 
-func (fe *FunctionExecutor) buildProgramForDir(target callTarget, callExpr string, sourceDir string) (string, error) {
+func (fe *FunctionExecutor) buildProgramForDir(target callTarget, callExpr string, sourceDir string, argImports argumentImports) (evalProgram, error) {
 	prepared, err := fe.ensurePreparedForDir(sourceDir)
 	if err != nil {
-		return "", err
+		return evalProgram{}, err
 	}
 
 	importSet := make(map[string]struct{})
@@ -385,6 +1039,9 @@ func (fe *FunctionExecutor) buildProgramForDir(target callTarget, callExpr strin
 			importSet[spec] = struct{}{}
 		}
 	}
+	for _, spec := range argImports.specs {
+		importSet[spec] = struct{}{}
+	}
 
 	imports := make([]string, 0, len(importSet))
 	for spec := range importSet {
@@ -393,34 +1050,37 @@ func (fe *FunctionExecutor) buildProgramForDir(target callTarget, callExpr strin
 	sort.Strings(imports)
 
 	data := struct {
-		Imports  []string
-		UserCode string
-		CallExpr string
-		FmtAlias string
+		Imports      []string
+		UserCode     string
+		CallExpr     string
+		FmtAlias     string
+		Limits       bool
+		AddressLimit bool
+		Harness      evalHarness
 	}{
-		Imports:  imports,
-		UserCode: strings.TrimSpace(prepared.source),
-		CallExpr: callExpr,
-		FmtAlias: evalFmtAlias,
-	}
-
-	var builder strings.Builder
-	if err := executionTemplate.Execute(&builder, data); err != nil {
-		return "", fmt.Errorf("failed to execute template: %v", err)
-	}
-
-	formatted, err := format.Source([]byte(builder.String()))
-	if err != nil {
-		return "", fmt.Errorf("failed to format generated program: %v", err)
-	}
-
-	return string(formatted), nil
+		Imports:      imports,
+		UserCode:     strings.TrimSpace(prepared.source),
+		CallExpr:     callExpr,
+		FmtAlias:     evalFmtAlias,
+		Limits:       hasLimits(target),
+		AddressLimit: limitsAddressSpace([]callTarget{target}),
+		Harness:      fe.harness(),
+	}
+
+	program, err := renderProgram(executionTemplate, data)
+	program.maxMem = maxMem([]callTarget{target})
+	program.calls = []string{callExpr}
+	program.inModule = argImports.inModule || fe.importsModulePackage(imports, sourceDir)
+	program.pins = addPin(append([]pinnedImport(nil), argImports.pins...), target.pin)
+	return program, err
 }
 
-func (fe *FunctionExecutor) buildProgramForDirBatch(targets []callTarget, callExprs []string, sourceDir string) (string, error) {
+// buildProgramForDirBatch builds the program evaluating callExprs; with
+// isolate each call recovers from its own panic
+func (fe *FunctionExecutor) buildProgramForDirBatch(targets []callTarget, callExprs []string, sourceDir string, argImports argumentImports, isolate bool) (evalProgram, error) {
 	prepared, err := fe.ensurePreparedForDir(sourceDir)
 	if err != nil {
-		return "", err
+		return evalProgram{}, err
 	}
 
 	importSet := make(map[string]struct{})
@@ -435,6 +1095,9 @@ func (fe *FunctionExecutor) buildProgramForDirBatch(targets []callTarget, callEx
 			}
 		}
 	}
+	for _, spec := range argImports.specs {
+		importSet[spec] = struct{}{}
+	}
 
 	imports := make([]string, 0, len(importSet))
 	for spec := range importSet {
@@ -443,32 +1106,55 @@ func (fe *FunctionExecutor) buildProgramForDirBatch(targets []callTarget, callEx
 	sort.Strings(imports)
 
 	data := struct {
-		Imports  []string
-		UserCode string
-		Calls    []string
-		FmtAlias string
+		Imports      []string
+		UserCode     string
+		Calls        []string
+		FmtAlias     string
+		Limits       bool
+		AddressLimit bool
+		Harness      evalHarness
+		Isolate      bool
 	}{
-		Imports:  imports,
-		UserCode: strings.TrimSpace(prepared.source),
-		Calls:    callExprs,
-		FmtAlias: evalFmtAlias,
+		Imports:      imports,
+		UserCode:     strings.TrimSpace(prepared.source),
+		Calls:        callExprs,
+		FmtAlias:     evalFmtAlias,
+		Limits:       slices.ContainsFunc(targets, hasLimits),
+		AddressLimit: limitsAddressSpace(targets),
+		Harness:      fe.harness(),
+		Isolate:      isolate,
+	}
+
+	program, err := renderProgram(executionBatchTemplate, data)
+	program.maxMem = maxMem(targets)
+	program.calls = callExprs
+	program.inModule = argImports.inModule || fe.importsModulePackage(imports, sourceDir)
+	program.pins = append([]pinnedImport(nil), argImports.pins...)
+	for _, target := range targets {
+		program.pins = addPin(program.pins, target.pin)
 	}
+	return program, err
+}
 
+// renderProgram executes tmpl with data and formats the result
+func renderProgram(tmpl *template.Template, data any) (evalProgram, error) {
 	var builder strings.Builder
-	if err := executionBatchTemplate.Execute(&builder, data); err != nil {
-		return "", fmt.Errorf("failed to execute template: %v", err)
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return evalProgram{}, fmt.Errorf("failed to execute template: %v", err)
 	}
 
 	formatted, err := format.Source([]byte(builder.String()))
 	if err != nil {
-		return "", fmt.Errorf("failed to format generated program: %v", err)
+		return evalProgram{}, fmt.Errorf("failed to format generated program: %v", err)
 	}
 
-	return string(formatted), nil
+	return evalProgram{source: string(formatted), unformatted: builder.String()}, nil
 }
 
 // ensurePreparedForDir prepares code with only the declarations visible from sourceDir
 func (fe *FunctionExecutor) ensurePreparedForDir(sourceDir string) (*preparedCode, error) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
 	if prepared, ok := fe.preparedByDir[sourceDir]; ok {
 		return prepared, nil
 	}
@@ -482,20 +1168,21 @@ func (fe *FunctionExecutor) ensurePreparedForDir(sourceDir string) (*preparedCod
 
 	// Process files in order from closest to furthest (local shadows global)
 	for _, file := range visibleFiles {
-		code, imports, identifiers := fe.processFunctionFileWithNames(file)
-
-		// Filter out declarations that are already defined (shadowed)
-		filteredCode := fe.filterShadowedDeclarations(code, identifiers, seenIdentifiers)
-
-		if filteredCode != "" {
-			pieces = append(pieces, filteredCode)
+		source, ok := readHelperSource(file, fe.ctx.HelperNamespaces[file])
+		if !ok {
+			continue
 		}
-		for spec := range imports {
+		if code := source.code(seenIdentifiers); code != "" {
+			pieces = append(pieces, code)
+		}
+		for _, spec := range source.imports {
 			importSet[spec] = struct{}{}
 		}
 		// Mark these identifiers as seen
-		for _, id := range identifiers {
-			seenIdentifiers[id] = true
+		for _, decl := range source.decls {
+			for _, id := range decl.names {
+				seenIdentifiers[id] = true
+			}
 		}
 	}
 
@@ -511,6 +1198,7 @@ func (fe *FunctionExecutor) ensurePreparedForDir(sourceDir string) (*preparedCod
 // collectVisibleHelperFiles returns helper files visible from sourceDir using depth-based resolution.
 // All project helper files are visible everywhere; depth determines shadowing priority.
 // Files are ordered: closest depth first (for shadowing), then deeper depths (lower priority).
+// The caller holds fe.mu.
 func (fe *FunctionExecutor) collectVisibleHelperFiles(sourceDir string) []string {
 	var result []string
 	absSourceDir, err := filepath.Abs(sourceDir)
@@ -546,12 +1234,7 @@ func (fe *FunctionExecutor) collectVisibleHelperFiles(sourceDir string) []string
 func (fe *FunctionExecutor) buildHelperFilesByDepth() map[int][]string {
 	depthToFiles := make(map[int][]string)
 	for _, file := range fe.ctx.FuncFiles {
-		dir := filepath.Dir(file)
-		absDir, err := filepath.Abs(dir)
-		if err != nil {
-			absDir = dir
-		}
-		depth := fe.ctx.CalculateDepth(absDir)
+		depth := fe.ctx.HelperFileDepth(file)
 		depthToFiles[depth] = append(depthToFiles[depth], file)
 	}
 	for depth := range depthToFiles {
@@ -560,261 +1243,236 @@ func (fe *FunctionExecutor) buildHelperFilesByDepth() map[int][]string {
 	return depthToFiles
 }
 
-// filterShadowedDeclarations removes declarations (func/var/const/type) that are already in seenIdentifiers
-func (fe *FunctionExecutor) filterShadowedDeclarations(code string, identifiers []string, seen map[string]bool) string {
-	// Quick check: if no overlap, return original code
-	hasOverlap := false
-	for _, id := range identifiers {
-		if seen[id] {
-			hasOverlap = true
-			break
+// executeProgram runs the evaluation program from the project root of
+// sourceDir so helpers reading relative paths behave the same in standalone
+// and toolexec runs. The root is also exported as GOAHEAD_PROJECT_ROOT. With
+// -trace-dir the run is saved and its trace ID returned.
+func (fe *FunctionExecutor) executeProgram(program evalProgram, sourceDir string) (string, string, error) {
+	projectRoot := fe.projectRoot(sourceDir)
+	programDir := fe.ctx.TempDir
+	if program.inModule {
+		// A hidden directory, which go build ./... and goahead skip
+		dir, err := os.MkdirTemp(projectRoot, evalDirPrefix+"*")
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create evaluation directory in %s: %v", projectRoot, err)
 		}
-	}
-	if !hasOverlap {
-		return code
+		defer func() { _ = os.RemoveAll(dir) }()
+		programDir = dir
 	}
 
-	// Need to filter - parse and remove shadowed declarations
-	lines := strings.Split(code, "\n")
-	var result []string
-	inBlock := false
-	skipBlock := false
-	braceCount := 0
-	parenCount := 0
-
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-
-		if !inBlock {
-			// Check if this starts a declaration we should skip
-			if strings.HasPrefix(trimmed, "func ") {
-				name := extractFuncName(trimmed)
-				if name != "" && seen[name] {
-					skipBlock = true
-					inBlock = true
-					braceCount = strings.Count(line, "{") - strings.Count(line, "}")
-					continue
-				}
-				inBlock = true
-				braceCount = strings.Count(line, "{") - strings.Count(line, "}")
-			} else if strings.HasPrefix(trimmed, "var ") {
-				names := extractVarNames(trimmed)
-				if namesOverlap(names, seen) {
-					skipBlock = true
-					inBlock = true
-					parenCount = strings.Count(line, "(") - strings.Count(line, ")")
-					braceCount = strings.Count(line, "{") - strings.Count(line, "}")
-					if parenCount == 0 && braceCount == 0 && !strings.HasSuffix(trimmed, "(") {
-						// Single-line var declaration
-						inBlock = false
-						skipBlock = false
-					}
-					continue
-				}
-				inBlock = true
-				parenCount = strings.Count(line, "(") - strings.Count(line, ")")
-				braceCount = strings.Count(line, "{") - strings.Count(line, "}")
-			} else if strings.HasPrefix(trimmed, "const ") {
-				names := extractConstNames(trimmed)
-				if namesOverlap(names, seen) {
-					skipBlock = true
-					inBlock = true
-					parenCount = strings.Count(line, "(") - strings.Count(line, ")")
-					if parenCount == 0 && !strings.HasSuffix(trimmed, "(") {
-						// Single-line const declaration
-						inBlock = false
-						skipBlock = false
-					}
-					continue
-				}
-				inBlock = true
-				parenCount = strings.Count(line, "(") - strings.Count(line, ")")
-			} else if strings.HasPrefix(trimmed, "type ") {
-				names := extractTypeNames(trimmed)
-				if namesOverlap(names, seen) {
-					skipBlock = true
-					inBlock = true
-					parenCount = strings.Count(line, "(") - strings.Count(line, ")")
-					braceCount = strings.Count(line, "{") - strings.Count(line, "}")
-					if parenCount == 0 && braceCount == 0 && !strings.HasSuffix(trimmed, "(") && !strings.HasSuffix(trimmed, "{") {
-						// Single-line type declaration
-						inBlock = false
-						skipBlock = false
-					}
-					continue
-				}
-				inBlock = true
-				parenCount = strings.Count(line, "(") - strings.Count(line, ")")
-				braceCount = strings.Count(line, "{") - strings.Count(line, "}")
-			}
+	// One file per run, so that concurrent evaluations do not overwrite
+	// each other's program
+	file, err := os.CreateTemp(programDir, "goahead_eval_*.go")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to write temp file: %v", err)
+	}
+	tempFile := file.Name()
+	defer func() { _ = os.Remove(tempFile) }()
+	_, err = file.WriteString(program.source)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to write temp file: %v", err)
+	}
+
+	args := []string{"run"}
+	cwd := projectRoot
+	modFlag := fe.evalModFlag(projectRoot)
+	if len(program.pins) > 0 {
+		// Pinned modules come from a go.mod of their own; vendor/ cannot
+		// provide them
+		pinned := fe.pinnedModuleFor(projectRoot, program.pins)
+		if pinned.err != nil {
+			return "", "", pinned.err
+		}
+		modFlag = "mod"
+		if pinned.modFile != "" {
+			args = append(args, "-modfile="+pinned.modFile)
 		} else {
-			braceCount += strings.Count(line, "{") - strings.Count(line, "}")
-			parenCount += strings.Count(line, "(") - strings.Count(line, ")")
-			if braceCount <= 0 && parenCount <= 0 {
-				inBlock = false
-				if skipBlock {
-					skipBlock = false
-					continue
-				}
-			}
+			cwd = pinned.dir
 		}
+	}
+	if modFlag != "" {
+		args = append(args, "-mod="+modFlag)
+	}
+	args = append(args, tempFile)
+	fe.ctx.Logger().Logf(LogExec, "[goahead] Running evaluation program for %s (cwd %s, go %s)", sourceDir, cwd, strings.Join(args, " "))
+	env := append(sanitizeGoEnv(os.Environ()), ProjectRootEnv+"="+fe.ctx.Config.sourcePath(projectRoot))
+	if fe.ctx.Config.Offline {
+		// Guarantee no network access: anything not vendored or cached fails
+		env = append(env, "GOPROXY=off")
+	}
+	if program.maxMem > 0 {
+		// From the start of the program, before goaheadLimit narrows it
+		// to each call
+		env = append(env, "GOMEMLIMIT="+strconv.FormatInt(program.maxMem, 10))
+	}
+	stdoutStr, stderrStr, err := fe.runner.Run(cwd, env, args...)
+	traceID := fe.trace(program, cwd, args, env, stdoutStr, stderrStr, err)
 
-		if !skipBlock {
-			result = append(result, line)
+	if err != nil {
+		// On Windows, "go run" may fail to clean up temp executables
+		// (e.g. "go: unlinkat ... Access is denied.") causing a non-zero
+		// exit even though the program itself executed successfully.
+		// If the only stderr content is cleanup errors, use stdout.
+		if stdoutStr != "" && IsGoCleanupError(stderrStr) {
+			return stdoutStr, traceID, nil
+		}
+		if violation := limitViolation(stderrStr); violation != "" {
+			return "", traceID, errors.New(violation)
 		}
+		if errors.Is(err, ErrEnvironment) {
+			return "", traceID, err
+		}
+		return "", traceID, fmt.Errorf("failed to execute temp program: %v\nOutput:\n%s%s%s", err, stdoutStr, stderrStr,
+			explainDependencyFailure(stderrStr))
 	}
 
-	return strings.Join(result, "\n")
+	return stdoutStr, traceID, nil
 }
 
-// extractFuncName extracts the function name from a "func name(" line
-func extractFuncName(line string) string {
-	// Remove "func " prefix
-	rest := strings.TrimPrefix(line, "func ")
-	// Find opening paren
-	parenIdx := strings.Index(rest, "(")
-	if parenIdx == -1 {
+// limitViolation returns the message of the helper limit that stopped an
+// evaluation program, or "". A program that ran out of memory while its
+// address space was capped for a call exceeded the maxmem of that call.
+func limitViolation(stderr string) string {
+	capped := ""
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		if message, ok := strings.CutPrefix(line, EvalLimitPrefix); ok {
+			return message
+		}
+		if call, ok := strings.CutPrefix(line, EvalAddressLimitPrefix); ok {
+			capped = call
+			if call == "-" {
+				capped = ""
+			}
+		}
+	}
+	name, limit, ok := strings.Cut(capped, " ")
+	if !ok || !outOfMemoryPattern.MatchString(stderr) {
 		return ""
 	}
-	return strings.TrimSpace(rest[:parenIdx])
+	return fmt.Sprintf("helper %s exceeded its //%s of %s bytes (the address space limit was reached)", name, MaxMemDirective, limit)
 }
 
-// extractVarNames extracts variable names from a "var" declaration line
-// Handles: "var x int", "var x, y int", "var x = 1", "var ("
-func extractVarNames(line string) []string {
-	trimmed := strings.TrimSpace(line)
-	rest := strings.TrimPrefix(trimmed, "var ")
-	rest = strings.TrimSpace(rest)
+// outOfMemoryPattern matches the fatal errors of a Go program whose memory
+// could not grow
+var outOfMemoryPattern = regexp.MustCompile(`out of memory|cannot allocate memory|failed to create new OS thread`)
 
-	// Check for block start
-	if rest == "(" || rest == "" {
-		return nil
+// decodeResults extracts the n results, and the run time of each call, from
+// the stdout of an evaluation program; what the helpers printed themselves
+// is only logged
+func (fe *FunctionExecutor) decodeResults(stdout string, n int, sourceDir string) ([]string, []time.Duration, error) {
+	results, durations, helperOutput, err := decodeEvalOutput(stdout, n)
+	if helperOutput != "" {
+		fe.ctx.Logger().Logf(LogExec, "[goahead] Helper output for %s:\n%s", sourceDir, helperOutput)
 	}
+	return results, durations, err
+}
 
-	// Find the end of the name(s) - could be space, =, or type
-	var names []string
-	// Split by comma for multiple names
-	if eqIdx := strings.Index(rest, "="); eqIdx != -1 {
-		rest = rest[:eqIdx]
+// trace saves one evaluation run when -trace-dir is set; tracing problems
+// are warnings and never fail the run
+func (fe *FunctionExecutor) trace(program evalProgram, dir string, args, env []string, stdout, stderr string, runErr error) string {
+	if fe.ctx.Tracer == nil {
+		return ""
 	}
-	// Remove type annotation
-	for _, sep := range []string{" int", " string", " bool", " float", " byte", " rune", " uint", " ["} {
-		if idx := strings.Index(rest, sep); idx != -1 {
-			rest = rest[:idx]
-			break
-		}
+	entry := TraceEntry{
+		Markers: program.markers,
+		Calls:   program.calls,
+		Dir:     dir,
+		Command: append([]string{"go"}, args...),
+		Env:     env,
 	}
-	// Also handle custom types (anything after space)
-	if spaceIdx := strings.Index(rest, " "); spaceIdx != -1 {
-		rest = rest[:spaceIdx]
+	if runErr != nil {
+		entry.Error = runErr.Error()
 	}
-
-	for _, name := range strings.Split(rest, ",") {
-		name = strings.TrimSpace(name)
-		if name != "" {
-			names = append(names, name)
-		}
+	id, err := fe.ctx.Tracer.Record(entry, program.unformatted, program.source, stdout, stderr)
+	if err != nil {
+		fe.ctx.Warn(Diagnostic{Rule: RuleTrace, Message: err.Error()})
 	}
-	return names
+	return id
 }
 
-// extractConstNames extracts constant names from a "const" declaration line
-func extractConstNames(line string) []string {
-	trimmed := strings.TrimSpace(line)
-	rest := strings.TrimPrefix(trimmed, "const ")
-	rest = strings.TrimSpace(rest)
-
-	// Check for block start
-	if rest == "(" || rest == "" {
-		return nil
+// evalModFlag returns the -mod value for the evaluation program: the outer
+// build's choice (-mod in the goahead command line or GOFLAGS, which is
+// otherwise stripped from the child environment), else "vendor" when the
+// project has a vendor directory
+func (fe *FunctionExecutor) evalModFlag(projectRoot string) string {
+	if fe.ctx.Config.ModFlag != "" {
+		return fe.ctx.Config.ModFlag
 	}
-
-	// Find the end of the name(s)
-	var names []string
-	if eqIdx := strings.Index(rest, "="); eqIdx != -1 {
-		rest = rest[:eqIdx]
+	if mod := modFlagFromGoFlags(os.Getenv("GOFLAGS")); mod != "" {
+		return mod
 	}
-	// Remove type annotation
-	if spaceIdx := strings.Index(rest, " "); spaceIdx != -1 {
-		rest = rest[:spaceIdx]
+	if _, err := os.Stat(filepath.Join(projectRoot, "vendor", "modules.txt")); err == nil {
+		return "vendor"
 	}
+	return ""
+}
 
-	for _, name := range strings.Split(rest, ",") {
-		name = strings.TrimSpace(name)
-		if name != "" {
-			names = append(names, name)
+func modFlagFromGoFlags(goflags string) string {
+	for _, field := range strings.Fields(goflags) {
+		if value, ok := strings.CutPrefix(strings.TrimLeft(field, "-"), "mod="); ok {
+			return value
 		}
 	}
-	return names
+	return ""
 }
 
-// extractTypeNames extracts type names from a "type" declaration line
-// Handles: "type X struct", "type X = int", "type ("
-func extractTypeNames(line string) []string {
-	trimmed := strings.TrimSpace(line)
-	rest := strings.TrimPrefix(trimmed, "type ")
-	rest = strings.TrimSpace(rest)
+var (
+	vendorMissingPattern  = regexp.MustCompile(`cannot find module providing package (\S+): import lookup disabled by -mod=vendor`)
+	offlineMissingPattern = regexp.MustCompile(`(\S+?)(?:@(\S+))?: module lookup disabled by GOPROXY=off`)
+	requireMissingPattern = regexp.MustCompile(`no required module provides package ([^\s;]+)`)
+)
 
-	// Check for block start
-	if rest == "(" || rest == "" {
-		return nil
+// explainDependencyFailure turns go command errors about unavailable
+// dependencies into hints naming the missing module or package
+func explainDependencyFailure(stderr string) string {
+	var hints []string
+	seen := make(map[string]bool)
+	add := func(hint string) {
+		if !seen[hint] {
+			seen[hint] = true
+			hints = append(hints, hint)
+		}
 	}
-
-	// Find the type name (first identifier)
-	var name string
-	for i, r := range rest {
-		if r == ' ' || r == '=' || r == '[' {
-			name = rest[:i]
-			break
+	for _, match := range vendorMissingPattern.FindAllStringSubmatch(stderr, -1) {
+		add(fmt.Sprintf("dependency %s is missing from vendor/; require it in go.mod and run 'go mod vendor'", match[1]))
+	}
+	for _, match := range offlineMissingPattern.FindAllStringSubmatch(stderr, -1) {
+		if match[2] == "" {
+			continue // positional line without module; the module@version line names it
 		}
+		add(fmt.Sprintf("dependency %s@%s is neither vendored nor in the module cache and downloads are disabled (GOPROXY=off)", match[1], match[2]))
 	}
-	if name == "" {
-		name = rest
+	for _, match := range requireMissingPattern.FindAllStringSubmatch(stderr, -1) {
+		add(fmt.Sprintf("no module requires %s; add it with 'go get %s', or pin its version in the directive that imports it: %s import <alias>=%s@<version>",
+			match[1], match[1], DirectivePrefix, match[1]))
 	}
-	name = strings.TrimSpace(name)
-	if name != "" {
-		return []string{name}
+	if strings.Contains(stderr, "inconsistent vendoring") {
+		add("vendor/modules.txt is out of sync with go.mod; run 'go mod vendor'")
 	}
-	return nil
-}
-
-// namesOverlap checks if any name in the list is in the seen map
-func namesOverlap(names []string, seen map[string]bool) bool {
-	for _, name := range names {
-		if seen[name] {
-			return true
-		}
+	if len(hints) == 0 {
+		return ""
 	}
-	return false
+	return "\nHint: " + strings.Join(hints, "\nHint: ")
 }
 
-func (fe *FunctionExecutor) executeProgram(program string) (string, error) {
-	tempFile := filepath.Join(fe.ctx.TempDir, "goahead_eval.go")
-	if err := os.WriteFile(tempFile, []byte(program), 0o600); err != nil {
-		return "", fmt.Errorf("failed to write temp file: %v", err)
-	}
-
-	cmd := exec.Command("go", "run", tempFile)
-	cmd.Env = sanitizeGoEnv(os.Environ())
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	stdoutStr := stdout.String()
-	stderrStr := stderr.String()
-
+// projectRoot returns the module root containing sourceDir, falling back to
+// the processing root when sourceDir is not inside a module
+func (fe *FunctionExecutor) projectRoot(sourceDir string) string {
+	absSourceDir, err := filepath.Abs(sourceDir)
 	if err != nil {
-		// On Windows, "go run" may fail to clean up temp executables
-		// (e.g. "go: unlinkat ... Access is denied.") causing a non-zero
-		// exit even though the program itself executed successfully.
-		// If the only stderr content is cleanup errors, use stdout.
-		if stdoutStr != "" && IsGoCleanupError(stderrStr) {
-			return strings.TrimSpace(stdoutStr), nil
-		}
-		return "", fmt.Errorf("failed to execute temp program: %v\nOutput:\n%s%s", err, stdoutStr, stderrStr)
+		absSourceDir = sourceDir
 	}
-
-	return strings.TrimSpace(stdoutStr), nil
+	if root := findModuleRoot(absSourceDir); root != "" {
+		return root
+	}
+	if fe.ctx.RootDir != "" {
+		return fe.ctx.RootDir
+	}
+	return absSourceDir
 }
 
 // IsGoCleanupError returns true when every non-blank line in stderr is a
@@ -839,393 +1497,6 @@ func IsGoCleanupError(stderr string) bool {
 	return true
 }
 
-func splitOutputLines(output string) []string {
-	if output == "" {
-		return nil
-	}
-
-	scanner := bufio.NewScanner(strings.NewReader(output))
-	lines := make([]string, 0, 8)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
-	return lines
-}
-
-func (fe *FunctionExecutor) processFunctionFile(path string) (string, map[string]struct{}) {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return "", make(map[string]struct{})
-	}
-
-	lines := strings.Split(string(content), "\n")
-	var builder strings.Builder
-	imports := make(map[string]struct{})
-
-	inBlock := false // inside func, const, var, type block
-	inImportBlock := false
-	braceCount := 0
-	parenCount := 0 // for const/var/type blocks with ()
-
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-
-		// Skip build tags and package declaration
-		if strings.HasPrefix(trimmed, "//go:build") || strings.HasPrefix(trimmed, "// +build") {
-			continue
-		}
-		if strings.HasPrefix(trimmed, "//go:ahead") {
-			continue
-		}
-		if strings.HasPrefix(trimmed, "package ") {
-			continue
-		}
-
-		// Handle import statements
-		if strings.HasPrefix(trimmed, "import ") {
-			if strings.HasSuffix(trimmed, "(") {
-				inImportBlock = true
-			} else {
-				spec := strings.TrimSpace(strings.TrimPrefix(trimmed, "import"))
-				if spec != "" {
-					imports[spec] = struct{}{}
-				}
-			}
-			continue
-		}
-		if inImportBlock {
-			if trimmed == ")" {
-				inImportBlock = false
-				continue
-			}
-			if trimmed == "" || strings.HasPrefix(trimmed, "//") {
-				continue
-			}
-			imports[trimmed] = struct{}{}
-			continue
-		}
-
-		// Skip standalone comments when not in a block
-		if strings.HasPrefix(trimmed, "//") && !inBlock {
-			continue
-		}
-
-		// Detect start of top-level declarations
-		if !inBlock {
-			if strings.HasPrefix(trimmed, "func ") {
-				inBlock = true
-				braceCount = 0
-			} else if strings.HasPrefix(trimmed, "const ") ||
-				strings.HasPrefix(trimmed, "var ") ||
-				strings.HasPrefix(trimmed, "type ") {
-				inBlock = true
-				parenCount = 0
-				braceCount = 0
-			}
-		}
-
-		if inBlock {
-			builder.WriteString(line)
-			builder.WriteByte('\n')
-
-			// Count braces and parens to detect end of block
-			for _, r := range line {
-				switch r {
-				case '{':
-					braceCount++
-				case '}':
-					braceCount--
-				case '(':
-					parenCount++
-				case ')':
-					parenCount--
-				}
-			}
-
-			// Check if block is complete
-			// For func: ends when braceCount returns to 0 after being > 0
-			// For const/var/type: ends when line doesn't end with ( and parenCount == 0, or single line
-			if braceCount == 0 && parenCount == 0 {
-				// Check if it's a complete declaration
-				if strings.Contains(line, "}") ||
-					strings.Contains(line, ")") ||
-					(!strings.HasSuffix(trimmed, "(") && !strings.HasSuffix(trimmed, "{") && !strings.HasSuffix(trimmed, ",")) {
-					inBlock = false
-					builder.WriteByte('\n')
-				}
-			}
-		}
-	}
-
-	return strings.TrimSpace(builder.String()), imports
-}
-
-// processFunctionFileWithNames is like processFunctionFile but also returns all identifier names
-// (functions, variables, constants, types) for proper shadowing support
-func (fe *FunctionExecutor) processFunctionFileWithNames(path string) (string, map[string]struct{}, []string) {
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return "", make(map[string]struct{}), nil
-	}
-
-	lines := strings.Split(string(content), "\n")
-	var builder strings.Builder
-	imports := make(map[string]struct{})
-	var identifiers []string
-
-	inBlock := false
-	inImportBlock := false
-	braceCount := 0
-	parenCount := 0
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-
-		if strings.HasPrefix(trimmed, "//go:build") || strings.HasPrefix(trimmed, "// +build") {
-			continue
-		}
-		if strings.HasPrefix(trimmed, "//go:ahead") {
-			continue
-		}
-		if strings.HasPrefix(trimmed, "package ") {
-			continue
-		}
-
-		if strings.HasPrefix(trimmed, "import ") {
-			if strings.HasSuffix(trimmed, "(") {
-				inImportBlock = true
-			} else {
-				spec := strings.TrimSpace(strings.TrimPrefix(trimmed, "import"))
-				if spec != "" {
-					imports[spec] = struct{}{}
-				}
-			}
-			continue
-		}
-		if inImportBlock {
-			if trimmed == ")" {
-				inImportBlock = false
-				continue
-			}
-			if trimmed == "" || strings.HasPrefix(trimmed, "//") {
-				continue
-			}
-			imports[trimmed] = struct{}{}
-			continue
-		}
-
-		if strings.HasPrefix(trimmed, "//") && !inBlock {
-			continue
-		}
-
-		if !inBlock {
-			if strings.HasPrefix(trimmed, "func ") {
-				inBlock = true
-				braceCount = 0
-				funcName := extractFuncName(trimmed)
-				// Only include exported functions for placeholder usage
-				if funcName != "" && gotoken.IsExported(funcName) {
-					identifiers = append(identifiers, funcName)
-				}
-			} else if strings.HasPrefix(trimmed, "var ") {
-				inBlock = true
-				parenCount = 0
-				braceCount = 0
-				varNames := extractVarNames(trimmed)
-				// Only include exported variables
-				for _, name := range varNames {
-					if gotoken.IsExported(name) {
-						identifiers = append(identifiers, name)
-					}
-				}
-			} else if strings.HasPrefix(trimmed, "const ") {
-				inBlock = true
-				parenCount = 0
-				braceCount = 0
-				constNames := extractConstNames(trimmed)
-				// Only include exported constants
-				for _, name := range constNames {
-					if gotoken.IsExported(name) {
-						identifiers = append(identifiers, name)
-					}
-				}
-			} else if strings.HasPrefix(trimmed, "type ") {
-				inBlock = true
-				parenCount = 0
-				braceCount = 0
-				typeNames := extractTypeNames(trimmed)
-				// Only include exported types
-				for _, name := range typeNames {
-					if gotoken.IsExported(name) {
-						identifiers = append(identifiers, name)
-					}
-				}
-			}
-		}
-
-		if inBlock {
-			builder.WriteString(line)
-			builder.WriteByte('\n')
-
-			for _, r := range line {
-				switch r {
-				case '{':
-					braceCount++
-				case '}':
-					braceCount--
-				case '(':
-					parenCount++
-				case ')':
-					parenCount--
-				}
-			}
-
-			if braceCount == 0 && parenCount == 0 {
-				if strings.Contains(line, "}") ||
-					strings.Contains(line, ")") ||
-					(!strings.HasSuffix(trimmed, "(") && !strings.HasSuffix(trimmed, "{") && !strings.HasSuffix(trimmed, ",")) {
-					inBlock = false
-					builder.WriteByte('\n')
-				}
-			}
-		}
-	}
-
-	return strings.TrimSpace(builder.String()), imports, identifiers
-}
-
-func splitArguments(input string) ([]string, error) {
-	var (
-		parts      []string
-		current    strings.Builder
-		inQuote    bool
-		quote      rune
-		escape     bool
-		braceDepth int
-		parenDepth int
-		brackDepth int
-	)
-
-	for _, r := range input {
-		switch {
-		case escape:
-			current.WriteRune(r)
-			escape = false
-		case r == '\\' && inQuote:
-			current.WriteRune(r)
-			escape = true
-		case inQuote:
-			current.WriteRune(r)
-			if r == quote {
-				inQuote = false
-			}
-		case r == '"' || r == '\'' || r == '`':
-			inQuote = true
-			quote = r
-			current.WriteRune(r)
-		case r == '{':
-			braceDepth++
-			current.WriteRune(r)
-		case r == '}':
-			braceDepth--
-			current.WriteRune(r)
-		case r == '(':
-			parenDepth++
-			current.WriteRune(r)
-		case r == ')':
-			parenDepth--
-			current.WriteRune(r)
-		case r == '[':
-			brackDepth++
-			current.WriteRune(r)
-		case r == ']':
-			brackDepth--
-			current.WriteRune(r)
-		case r == ':' && braceDepth == 0 && parenDepth == 0 && brackDepth == 0:
-			parts = append(parts, strings.TrimSpace(current.String()))
-			current.Reset()
-		default:
-			current.WriteRune(r)
-		}
-	}
-
-	if escape {
-		return nil, fmt.Errorf("unterminated escape sequence in %q", input)
-	}
-
-	parts = append(parts, strings.TrimSpace(current.String()))
-	return parts, nil
-}
-
-func classifyArgument(raw string) argument {
-	trimmed := strings.TrimSpace(raw)
-	if strings.HasPrefix(trimmed, "=") {
-		expr := strings.TrimSpace(trimmed[1:])
-		return argument{
-			Raw:             expr,
-			Normalized:      expr,
-			Kind:            argumentExpression,
-			ForceExpression: true,
-		}
-	}
-
-	if trimmed == "" {
-		return argument{
-			Raw:        "",
-			Normalized: "",
-			Kind:       argumentString,
-			AutoQuote:  true,
-		}
-	}
-
-	if unquoted, err := strconv.Unquote(trimmed); err == nil {
-		return argument{
-			Raw:        unquoted,
-			Normalized: unquoted,
-			Kind:       argumentString,
-		}
-	}
-
-	lower := strings.ToLower(trimmed)
-	if lower == "true" || lower == "false" {
-		return argument{
-			Raw:        lower,
-			Normalized: lower,
-			Kind:       argumentBool,
-		}
-	}
-
-	if _, err := strconv.ParseInt(trimmed, 0, 64); err == nil {
-		return argument{
-			Raw:        trimmed,
-			Normalized: trimmed,
-			Kind:       argumentInt,
-		}
-	}
-
-	if _, err := strconv.ParseFloat(trimmed, 64); err == nil {
-		return argument{
-			Raw:        trimmed,
-			Normalized: trimmed,
-			Kind:       argumentFloat,
-		}
-	}
-
-	if gotoken.IsIdentifier(trimmed) {
-		return argument{
-			Raw:        trimmed,
-			Normalized: trimmed,
-			Kind:       argumentString,
-			AutoQuote:  true,
-		}
-	}
-
-	return argument{
-		Raw:        trimmed,
-		Normalized: trimmed,
-		Kind:       argumentExpression,
-	}
-}
-
 func argDisplayForExternal(arg argument) string {
 	if arg.ForceExpression || arg.Kind == argumentExpression {
 		return arg.Raw
@@ -1243,6 +1514,14 @@ func formatArgumentForType(arg argument, expected string) (string, error) {
 		return arg.Raw, nil
 	}
 
+	// A word or bool passed for a number would only fail to compile
+	// in the evaluation program, naming none of the marker
+	if hint := mapOutputType(expected); hint == "int" || hint == "uint" || hint == "float" || expected == "uintptr" {
+		if arg.Kind == argumentString || arg.Kind == argumentBool {
+			return "", fmt.Errorf("%s is not a number, as %s requires", arg, expected)
+		}
+	}
+
 	switch expected {
 	case "string":
 		return strconv.Quote(arg.Normalized), nil
@@ -1288,10 +1567,15 @@ func (fe *FunctionExecutor) cacheKey(target callTarget, args []argument) (string
 	payload := struct {
 		Call string   `json:"c"`
 		Args []argKey `json:"a"`
+		// Pin is the pinned module version of the package called
+		Pin string `json:"p,omitempty"`
 	}{
 		Call: target.callExpr,
 		Args: make([]argKey, len(args)),
 	}
+	if target.pin != nil {
+		payload.Pin = target.pin.String()
+	}
 
 	for i, arg := range args {
 		value := arg.Normalized
@@ -1318,7 +1602,16 @@ func (fe *FunctionExecutor) cacheKeyWithDir(target callTarget, args []argument,
 	if err != nil {
 		return "", err
 	}
-	// Include sourceDir in key to handle shadowing properly
+	// Include sourceDir in key to handle shadowing properly, and the
+	// aliases of the file, which may give the same call another package
+	if len(fe.ctx.FileImports) > 0 {
+		aliases := make([]string, 0, len(fe.ctx.FileImports))
+		for alias, imp := range fe.ctx.FileImports {
+			aliases = append(aliases, alias+"="+imp.String())
+		}
+		sort.Strings(aliases)
+		baseKey += "|" + strings.Join(aliases, ",")
+	}
 	return fmt.Sprintf("%s|%s", sourceDir, baseKey), nil
 }
 
@@ -1333,18 +1626,20 @@ func sanitizeGoEnv(env []string) []string {
 	return clean
 }
 
-func (fe *FunctionExecutor) ensureStdImportMap() {
-	if fe.stdImportMap != nil {
-		return
-	}
+// stdImports returns the standard library package paths by name, loading
+// them on first use
+func (fe *FunctionExecutor) stdImports() (map[string]string, error) {
+	fe.stdOnce.Do(fe.ensureStdImportMap)
+	return fe.stdImportMap, fe.stdListErr
+}
 
+// ensureStdImportMap runs once per executor, through stdImports
+func (fe *FunctionExecutor) ensureStdImportMap() {
 	fe.stdImportMap = make(map[string]string)
 
-	cmd := exec.Command("go", "list", "std")
-	cmd.Env = sanitizeGoEnv(os.Environ())
-	output, err := cmd.CombinedOutput()
+	output, stderr, err := fe.runner.Run("", sanitizeGoEnv(os.Environ()), "list", "std")
 	if err != nil {
-		trimmed := strings.TrimSpace(string(output))
+		trimmed := strings.TrimSpace(output + stderr)
 		if trimmed != "" {
 			fe.stdListErr = fmt.Errorf("go list std: %w: %s", err, trimmed)
 		} else {
@@ -1353,11 +1648,17 @@ func (fe *FunctionExecutor) ensureStdImportMap() {
 		return
 	}
 
-	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
 		line = strings.TrimSpace(line)
 		if line == "" {
 			continue
 		}
+		// Internal and vendored packages cannot be imported, so they do not
+		// make a name such as errors (internal/errors) ambiguous
+		if line == "internal" || strings.HasPrefix(line, "vendor/") || strings.HasPrefix(line, "internal/") ||
+			strings.Contains(line, "/internal/") || strings.HasSuffix(line, "/internal") {
+			continue
+		}
 		base := filepath.Base(line)
 		if existing, ok := fe.stdImportMap[base]; ok && existing != line {
 			fe.stdImportMap[base] = ""
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"slices"
+	"strings"
+)
+
+// typeParamNames lists the type parameters of a generic helper, one per
+// name, as in [K comparable, V any]
+func typeParamNames(fn *ast.FuncDecl) []string {
+	if fn.Type.TypeParams == nil {
+		return nil
+	}
+	var names []string
+	for _, field := range fn.Type.TypeParams.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+// instantiate returns fn with its type parameters replaced by typeArgs, the
+// text between the brackets of a marker such as //:Max[int]:3:7, so its
+// arguments and result are formatted as for a helper written for those
+// types
+func instantiate(fn *UserFunction, typeArgs string) (*UserFunction, error) {
+	if len(fn.TypeParams) == 0 {
+		return nil, fmt.Errorf("function %s is not generic; drop the [%s]", fn.Name, typeArgs)
+	}
+	args, err := splitTypeArgList(typeArgs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid type arguments [%s] for %s: %v", typeArgs, fn.Name, err)
+	}
+	if len(args) != len(fn.TypeParams) {
+		return nil, fmt.Errorf("function %s takes %d type argument(s) [%s], got %d",
+			fn.Name, len(fn.TypeParams), strings.Join(fn.TypeParams, ", "), len(args))
+	}
+	bindings := make(map[string]string, len(args))
+	for i, param := range fn.TypeParams {
+		bindings[param] = args[i]
+	}
+
+	inst := *fn
+	inst.TypeParams = nil
+	inst.InputTypes = substituteTypes(fn.InputTypes, bindings)
+	inst.OutputTypes = substituteTypes(fn.OutputTypes, bindings)
+	inst.OutputType = substituteType(fn.OutputType, bindings)
+	inst.VariadicElem = substituteType(fn.VariadicElem, bindings)
+	if expr, err := parser.ParseExpr(inst.OutputType); err == nil {
+		inst.NotInlinable = !inlinableResult(expr)
+	}
+	return &inst, nil
+}
+
+// splitTypeArgList splits "string, map[string]int" into its types, reading
+// them as the index of a Go expression so nested brackets and commas are
+// handled
+func splitTypeArgList(typeArgs string) ([]string, error) {
+	src := "_[" + typeArgs + "]"
+	fset := token.NewFileSet()
+	expr, err := parser.ParseExprFrom(fset, "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	var indices []ast.Expr
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		indices = []ast.Expr{e.Index}
+	case *ast.IndexListExpr:
+		indices = e.Indices
+	default:
+		return nil, fmt.Errorf("expected a list of types")
+	}
+	types := make([]string, len(indices))
+	for i, index := range indices {
+		types[i] = src[fset.Position(index.Pos()).Offset:fset.Position(index.End()).Offset]
+	}
+	return types, nil
+}
+
+func substituteTypes(types []string, bindings map[string]string) []string {
+	if types == nil {
+		return nil
+	}
+	out := make([]string, len(types))
+	for i, typ := range types {
+		out[i] = substituteType(typ, bindings)
+	}
+	return out
+}
+
+// substituteType replaces the type parameters named in typ, as in []T
+func substituteType(typ string, bindings map[string]string) string {
+	var b strings.Builder
+	last := 0
+	forEachIdent(typ, func(offset int, name string) {
+		if bound, ok := bindings[name]; ok {
+			b.WriteString(typ[last:offset])
+			b.WriteString(bound)
+			last = offset + len(name)
+		}
+	})
+	b.WriteString(typ[last:])
+	return b.String()
+}
+
+// usesTypeParam reports whether typ names a type parameter of fn; such
+// parameters have no type to format an argument for
+func (fn *UserFunction) usesTypeParam(typ string) bool {
+	if len(fn.TypeParams) == 0 {
+		return false
+	}
+	uses := false
+	forEachIdent(typ, func(_ int, name string) {
+		uses = uses || slices.Contains(fn.TypeParams, name)
+	})
+	return uses
+}
+
+// forEachIdent calls fn with the offset and name of every identifier of typ
+func forEachIdent(typ string, fn func(offset int, name string)) {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(typ))
+	s.Init(file, []byte(typ), nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return
+		}
+		if tok == token.IDENT {
+			fn(file.Offset(pos), lit)
+		}
+	}
+}
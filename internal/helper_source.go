@@ -0,0 +1,278 @@
+package internal
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"slices"
+	"strings"
+)
+
+// helperSource is what a helper file contributes to evaluation programs:
+// its imports and every top-level declaration, constants, variables and
+// types included, as written
+type helperSource struct {
+	imports []string
+	decls   []helperDecl
+}
+
+// helperDecl is one top-level declaration of a helper file
+type helperDecl struct {
+	// names are the exported names it declares, by which a closer helper
+	// file shadows it
+	names []string
+	// recv is the receiver type of a method, which goes with its type
+	recv   string
+	source string
+}
+
+// readHelperSource parses the helper file at path. Declarations named like
+// the identifiers of the program template (main, goahead...) are left out;
+// ok is false when the file cannot be read or parsed, which loading the
+// helpers has already reported. The top-level names of a file declaring
+// //go:ahead namespace are renamed by namespacedName.
+func readHelperSource(path, namespace string) (helperSource, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return helperSource{}, false
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return helperSource{}, false
+	}
+
+	var renamed map[*ast.Ident]string
+	if namespace != "" {
+		renamed = namespaceIdents(file, namespace)
+	}
+
+	var source helperSource
+	for _, imp := range file.Imports {
+		spec := imp.Path.Value
+		if imp.Name != nil {
+			spec = imp.Name.Name + " " + spec
+		}
+		source.imports = append(source.imports, spec)
+	}
+	for _, decl := range file.Decls {
+		var names []string
+		var recv string
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				recv = receiverTypeName(d.Recv.List[0].Type)
+			} else {
+				names = append(names, d.Name.Name)
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						names = append(names, name.Name)
+					}
+				case *ast.TypeSpec:
+					names = append(names, s.Name.Name)
+				}
+			}
+		}
+		if templateName(names) {
+			continue
+		}
+		var exported []string
+		for _, name := range names {
+			if token.IsExported(name) {
+				if namespace != "" {
+					name = namespacedName(namespace, name)
+				}
+				exported = append(exported, name)
+			}
+		}
+		if namespace != "" && recv != "" {
+			recv = namespacedName(namespace, recv)
+		}
+		start, end := fset.Position(decl.Pos()).Offset, fset.Position(decl.End()).Offset
+		source.decls = append(source.decls, helperDecl{names: exported, recv: recv, source: renameIdents(fset, content, start, end, renamed)})
+	}
+	return source, true
+}
+
+// namespacedName returns the name a top-level declaration of a file
+// declaring //go:ahead namespace takes in evaluation programs, where it must
+// not collide with the declarations of the other helper files
+func namespacedName(namespace, name string) string {
+	return namespace + "_" + name
+}
+
+// namespaceIdents returns the identifiers of file that refer to its
+// top-level declarations, with their namespaced names. Selected names,
+// struct fields, interface methods, method names and the keys of struct
+// literals are left alone.
+func namespaceIdents(file *ast.File, namespace string) map[*ast.Ident]string {
+	topLevel := make(map[string]bool)
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				topLevel[d.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						topLevel[name.Name] = true
+					}
+				case *ast.TypeSpec:
+					topLevel[s.Name.Name] = true
+				}
+			}
+		}
+	}
+	delete(topLevel, "_")
+
+	kept := make(map[*ast.Ident]bool)
+	keepFields := func(fields *ast.FieldList) {
+		if fields == nil {
+			return
+		}
+		for _, field := range fields.List {
+			for _, name := range field.Names {
+				kept[name] = true
+			}
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			kept[n.Sel] = true
+		case *ast.StructType:
+			keepFields(n.Fields)
+		case *ast.InterfaceType:
+			keepFields(n.Methods)
+		case *ast.FuncDecl:
+			if n.Recv != nil {
+				kept[n.Name] = true
+			}
+		case *ast.CompositeLit:
+			if _, isMap := n.Type.(*ast.MapType); isMap {
+				break
+			}
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok {
+						kept[key] = true
+					}
+				}
+			}
+		}
+		return true
+	})
+
+	renamed := make(map[*ast.Ident]string)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && topLevel[ident.Name] && !kept[ident] {
+			renamed[ident] = namespacedName(namespace, ident.Name)
+		}
+		return true
+	})
+	return renamed
+}
+
+// renameIdents returns content[start:end] with the identifiers of renamed
+// in that range written under their new names
+func renameIdents(fset *token.FileSet, content []byte, start, end int, renamed map[*ast.Ident]string) string {
+	type edit struct {
+		offset int
+		ident  *ast.Ident
+	}
+	var edits []edit
+	for ident := range renamed {
+		if offset := fset.Position(ident.Pos()).Offset; offset >= start && offset < end {
+			edits = append(edits, edit{offset, ident})
+		}
+	}
+	if len(edits) == 0 {
+		return string(content[start:end])
+	}
+	slices.SortFunc(edits, func(a, b edit) int { return a.offset - b.offset })
+
+	var sb strings.Builder
+	last := start
+	for _, e := range edits {
+		sb.Write(content[last:e.offset])
+		sb.WriteString(renamed[e.ident])
+		last = e.offset + len(e.ident.Name)
+	}
+	sb.Write(content[last:end])
+	return sb.String()
+}
+
+// templateName reports whether one of names would collide with the program
+// template, which declares main and the goahead-prefixed identifiers
+func templateName(names []string) bool {
+	for _, name := range names {
+		if name == "main" || strings.HasPrefix(name, "goahead") {
+			return true
+		}
+	}
+	return false
+}
+
+// receiverTypeName returns the name of the type of a method receiver such
+// as l Level, p *Pair or s Set[T]
+func receiverTypeName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// code returns the declarations of s that no closer helper file shadows,
+// seen holding the names those files declare. A declaration goes as a whole
+// when one of its names is shadowed, and the methods of a shadowed type go
+// with it.
+func (s helperSource) code(seen map[string]bool) string {
+	shadowed := make(map[string]bool)
+	keep := make([]bool, len(s.decls))
+	for i, decl := range s.decls {
+		keep[i] = true
+		for _, name := range decl.names {
+			if seen[name] {
+				keep[i] = false
+			}
+		}
+		if !keep[i] {
+			for _, name := range decl.names {
+				shadowed[name] = true
+			}
+		}
+	}
+	var pieces []string
+	for i, decl := range s.decls {
+		if keep[i] && (decl.recv == "" || !shadowed[decl.recv]) {
+			pieces = append(pieces, decl.source)
+		}
+	}
+	return strings.Join(pieces, "\n\n")
+}
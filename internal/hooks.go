@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hooks are optional callbacks that report the progress of a run to an
+// embedding program, such as a build dashboard. They are called
+// synchronously from the pipeline, one at a time, so they must return
+// quickly and must not block; hand slow work to another goroutine. The
+// [goahead] progress lines of the CLI are printed by a default set of hooks
+// that runs before these.
+type Hooks struct {
+	// FileStarted is called before a file with markers is processed
+	FileStarted func(FileEvent)
+	// MarkerEvaluated is called for every marker target that received a
+	// value, whether or not the literal changed, and for targets whose
+	// helper declined to replace them
+	MarkerEvaluated func(MarkerEvent)
+	// MarkerSkipped is called for every marker that could not fire
+	MarkerSkipped func(SkippedMarker)
+	// Injected is called for every function or method injected into a file
+	Injected func(InjectionEvent)
+	// FileWritten is called once a processed file has been rewritten
+	FileWritten func(FileEvent)
+	// Warning is called for every warning of the run
+	Warning func(Diagnostic)
+}
+
+// FileEvent names a source file, as found by the directory walk
+type FileEvent struct {
+	File string
+}
+
+// MarkerEvent describes the value a marker wrote to one target
+type MarkerEvent struct {
+	File string
+	// Line is the line of the target literal
+	Line   int
+	Helper string
+	Args   string
+	// Output is the variable of a multi-output marker, "" otherwise
+	Output string
+	// Result is the value as Go source text
+	Result string
+	// Size is the length of Result in bytes
+	Size int
+	// Duration is the time the helper call took in its evaluation program,
+	// not counting the other calls of a batch; cached values have none
+	Duration time.Duration
+	Cached   bool
+	// Replaced is false when the literal already held the value
+	Replaced bool
+	// Declined is true when the helper asked to leave the target as it is
+	// (see SkipResult); Result is then empty
+	Declined bool
+	// Func is the helper, nil for standard library functions
+	Func *UserFunction
+}
+
+// InjectionEvent describes one injected function, interface method or
+// variable
+type InjectionEvent struct {
+	File      string
+	Function  string
+	Interface string
+	// Variable is the variable of an inject-var marker; Function is then
+	// the helper that produced its value
+	Variable string
+}
+
+// hookSet calls the hooks of goahead itself, then those of Config.Hooks
+type hookSet struct {
+	mu       sync.Mutex
+	defaults []Hooks
+	user     *Hooks
+}
+
+func newHookSet(ctx *ProcessorContext) *hookSet {
+	h := &hookSet{defaults: []Hooks{logHooks(ctx)}, user: ctx.Config.Hooks}
+	if ctx.index != nil {
+		h.defaults = append(h.defaults, ctx.index.hooks())
+	}
+	return h
+}
+
+// events returns the hooks of the run, creating them for contexts that were
+// not set up by runCodegen
+func (ctx *ProcessorContext) events() *hookSet {
+	if ctx.hooks == nil {
+		ctx.hooks = newHookSet(ctx)
+	}
+	return ctx.hooks
+}
+
+// skip adds a marker to the run's skip report
+func (ctx *ProcessorContext) skip(m SkippedMarker) {
+	ctx.Skipped.Add(m)
+	ctx.events().markerSkipped(m)
+}
+
+// call runs pick on the default hooks and the user's hooks
+func (h *hookSet) call(pick func(*Hooks)) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := range h.defaults {
+		pick(&h.defaults[i])
+	}
+	if h.user != nil {
+		pick(h.user)
+	}
+}
+
+func (h *hookSet) fileStarted(e FileEvent) {
+	h.call(func(hooks *Hooks) {
+		if hooks.FileStarted != nil {
+			hooks.FileStarted(e)
+		}
+	})
+}
+
+func (h *hookSet) markerEvaluated(e MarkerEvent) {
+	e.Size = len(e.Result)
+	h.call(func(hooks *Hooks) {
+		if hooks.MarkerEvaluated != nil {
+			hooks.MarkerEvaluated(e)
+		}
+	})
+}
+
+func (h *hookSet) markerSkipped(m SkippedMarker) {
+	h.call(func(hooks *Hooks) {
+		if hooks.MarkerSkipped != nil {
+			hooks.MarkerSkipped(m)
+		}
+	})
+}
+
+func (h *hookSet) injected(e InjectionEvent) {
+	h.call(func(hooks *Hooks) {
+		if hooks.Injected != nil {
+			hooks.Injected(e)
+		}
+	})
+}
+
+func (h *hookSet) fileWritten(e FileEvent) {
+	h.call(func(hooks *Hooks) {
+		if hooks.FileWritten != nil {
+			hooks.FileWritten(e)
+		}
+	})
+}
+
+func (h *hookSet) warning(d Diagnostic) {
+	h.call(func(hooks *Hooks) {
+		if hooks.Warning != nil {
+			hooks.Warning(d)
+		}
+	})
+}
+
+// logHooks prints the [goahead] progress lines of the CLI: replacements and
+// warnings always, the rest under their -verbose categories
+func logHooks(ctx *ProcessorContext) Hooks {
+	logger := ctx.Logger()
+	redact := func(s string) string {
+		if ctx.Config.Redact && s != "" {
+			return Redacted
+		}
+		return s
+	}
+	// A "=expr" function part holds its arguments, so it is shown, or
+	// redacted, whole
+	call := func(e MarkerEvent) string {
+		if strings.HasPrefix(e.Helper, "=") {
+			if ctx.Config.Redact {
+				return "=" + Redacted
+			}
+			return e.Helper
+		}
+		return fmt.Sprintf("%s(%s)", e.Helper, redact(e.Args))
+	}
+	return Hooks{
+		MarkerEvaluated: func(e MarkerEvent) {
+			e.File = ctx.Config.shownPath(e.File)
+			switch {
+			case e.Declined:
+				logger.Logf(LogReplace, "[goahead] Kept in %s: %s declined to replace the value", e.File, call(e))
+			case e.Output != "" && e.Replaced:
+				_, _ = fmt.Fprintf(os.Stderr, "[goahead] Replaced in %s: %s %s -> %s\n", e.File, call(e), e.Output, redact(e.Result))
+			case e.Output != "":
+				logger.Logf(LogReplace, "[goahead] Unchanged in %s: %s %s = %s", e.File, call(e), e.Output, redact(e.Result))
+			case e.Replaced:
+				_, _ = fmt.Fprintf(os.Stderr, "[goahead] Replaced in %s: %s -> %s%s\n", e.File, call(e), redact(e.Result), helperInfo(ctx.RootDir, e.Func))
+			default:
+				logger.Logf(LogReplace, "[goahead] Unchanged in %s: %s = %s", e.File, call(e), redact(e.Result))
+			}
+		},
+		Injected: func(e InjectionEvent) {
+			e.File = ctx.Config.shownPath(e.File)
+			if e.Variable != "" {
+				logger.Logf(LogInject, "[goahead] Injected variable '%s' from %s in %s", e.Variable, e.Function, e.File)
+			} else if e.Interface == "" {
+				logger.Logf(LogInject, "[goahead] Injected function '%s' in %s", e.Function, e.File)
+			} else {
+				logger.Logf(LogInject, "[goahead] Injected method '%s' for interface '%s' in %s", e.Function, e.Interface, e.File)
+			}
+		},
+		Warning: func(d Diagnostic) {
+			_, _ = fmt.Fprintf(os.Stderr, "[goahead] WARNING: %s\n", d.Message)
+		},
+	}
+}
+
+// helperInfo describes where a replacing helper comes from
+func helperInfo(rootDir string, userFunc *UserFunction) string {
+	if userFunc == nil {
+		return ""
+	}
+	relPath, _ := filepath.Rel(rootDir, userFunc.FilePath)
+	if relPath == "" {
+		relPath = userFunc.FilePath
+	}
+	if userFunc.NoCache {
+		return fmt.Sprintf(" (from %s, depth %d, nocache: not reproducible)", relPath, userFunc.Depth)
+	}
+	return fmt.Sprintf(" (from %s, depth %d)", relPath, userFunc.Depth)
+}
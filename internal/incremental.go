@@ -0,0 +1,393 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AeonDave/goahead/internal/artifact"
+)
+
+// IndexFileName is the file, in the directory of the run, where -incremental
+// records what each processed file depended on
+const IndexFileName = ".goahead-index.json"
+
+// IndexEntry is what -incremental remembers of one processed file
+type IndexEntry = artifact.IndexFile
+
+// incrementalIndex selects the files of an -incremental run and records the
+// index for the next one
+type incrementalIndex struct {
+	mu      sync.Mutex
+	path    string
+	baseDir string
+	// previous holds the last run's entries; nil processes every file
+	previous map[string]IndexEntry
+	// files is the next index: the previous entries, updated for every
+	// processed file
+	files map[string]IndexEntry
+	// pending collects the entries of the files being processed, and
+	// pendingHelpers the helper hashes of their module
+	pending        map[string]*IndexEntry
+	pendingHelpers map[string]string
+	// skipped marks the files this run left alone, by absolute path
+	skipped map[string]bool
+}
+
+// loadIndex returns nil unless config.Incremental is set. An index that is
+// missing or unreadable, including one of an older schema version, which is
+// never migrated, or written by another goahead makes the run process every
+// file.
+func loadIndex(config Config) *incrementalIndex {
+	if !config.Incremental {
+		return nil
+	}
+	baseDir := runBaseDir(config)
+	ix := &incrementalIndex{
+		path:    filepath.Join(baseDir, IndexFileName),
+		baseDir: baseDir,
+		files:   make(map[string]IndexEntry),
+		pending: make(map[string]*IndexEntry),
+		skipped: make(map[string]bool),
+	}
+	if _, err := os.Stat(ix.path); errors.Is(err, os.ErrNotExist) {
+		return ix
+	}
+	var doc artifact.Index
+	switch err := artifact.Read(ix.path, &doc); {
+	case err != nil:
+		_, _ = fmt.Fprintf(os.Stderr, "[goahead] Incremental: %v; processing every file\n", err)
+		return ix
+	case doc.GoaheadVersion != Version:
+		_, _ = fmt.Fprintf(os.Stderr, "[goahead] Incremental: %s was written by goahead %s; processing every file\n", IndexFileName, doc.GoaheadVersion)
+		return ix
+	}
+	ix.previous = doc.Files
+	if ix.previous == nil {
+		ix.previous = make(map[string]IndexEntry)
+	}
+	for rel, entry := range ix.previous {
+		ix.files[rel] = entry
+	}
+	return ix
+}
+
+// needs reports whether filePath must be processed, and why
+func (ix *incrementalIndex) needs(filePath string, helpers map[string]string, project string) (bool, string) {
+	if ix == nil {
+		return true, ""
+	}
+	if ix.previous == nil {
+		return true, "no index"
+	}
+	entry, ok := ix.previous[ix.relative(filePath)]
+	if !ok {
+		return true, "new file"
+	}
+	if entry.Unresolved {
+		return true, "skipped markers or warnings last run"
+	}
+	if hash, err := hashFile(filePath); err != nil || hash != entry.Hash {
+		return true, "file changed"
+	}
+	if entry.Project != project {
+		return true, ProjectFileName + " changed"
+	}
+	names := make([]string, 0, len(entry.Helpers))
+	for name := range entry.Helpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if helpers[name] != entry.Helpers[name] {
+			return true, "helper " + name + " changed"
+		}
+	}
+	return false, ""
+}
+
+// skip records that filePath was left alone
+func (ix *incrementalIndex) skip(filePath string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.skipped[absPath(filePath)] = true
+}
+
+// partial reports whether the run left some files alone
+func (ix *incrementalIndex) partial() bool {
+	if ix == nil {
+		return false
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return len(ix.skipped) > 0
+}
+
+// wasSkipped reports whether the run left filePath alone
+func (ix *incrementalIndex) wasSkipped(filePath string) bool {
+	if ix == nil {
+		return false
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.skipped[absPath(filePath)]
+}
+
+// begin starts the entry of filePath; helpers are the current hashes of
+// the helpers of its module
+func (ix *incrementalIndex) begin(filePath string, helpers map[string]string, project string) {
+	if ix == nil {
+		return
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	entry := &IndexEntry{Helpers: make(map[string]string), Project: project}
+	ix.pending[ix.relative(filePath)] = entry
+	ix.pendingHelpers = helpers
+}
+
+// finish completes the entry of filePath with its processed content
+func (ix *incrementalIndex) finish(filePath string) error {
+	if ix == nil {
+		return nil
+	}
+	hash, err := hashFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", filePath, err)
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	rel := ix.relative(filePath)
+	entry := ix.pending[rel]
+	delete(ix.pending, rel)
+	if entry == nil {
+		return nil
+	}
+	entry.Hash = hash
+	if len(entry.Helpers) == 0 {
+		entry.Helpers = nil
+	}
+	ix.files[rel] = *entry
+	return nil
+}
+
+// use records that the pending file at filePath depends on helper name
+func (ix *incrementalIndex) use(filePath, name string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if entry := ix.pending[ix.relative(filePath)]; entry != nil {
+		entry.Helpers[name] = ix.pendingHelpers[name]
+	}
+}
+
+// unresolved marks the pending file at filePath for the next run
+func (ix *incrementalIndex) unresolved(filePath string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if entry := ix.pending[ix.relative(filePath)]; entry != nil {
+		entry.Unresolved = true
+	}
+}
+
+// hooks feed the entries of the files being processed
+func (ix *incrementalIndex) hooks() Hooks {
+	return Hooks{
+		MarkerEvaluated: func(e MarkerEvent) { ix.use(e.File, e.Helper) },
+		MarkerSkipped:   func(m SkippedMarker) { ix.unresolved(m.File) },
+		Injected:        func(e InjectionEvent) { ix.use(e.File, e.Function) },
+		Warning: func(d Diagnostic) {
+			if d.File != "" {
+				ix.unresolved(d.File)
+			}
+		},
+	}
+}
+
+// Write saves the index, without the files that no longer exist
+func (ix *incrementalIndex) Write() error {
+	if ix == nil {
+		return nil
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for rel := range ix.files {
+		if _, err := os.Stat(filepath.Join(ix.baseDir, filepath.FromSlash(rel))); err != nil {
+			delete(ix.files, rel)
+		}
+	}
+	return artifact.Write(ix.path, &artifact.Index{GoaheadVersion: Version, Files: ix.files})
+}
+
+func (ix *incrementalIndex) relative(path string) string {
+	rel, err := filepath.Rel(ix.baseDir, absPath(path))
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return hashBytes(data), nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// projectHash covers what marker variables are read from: .goahead.toml,
+// the profile and the GOAHEAD_VAR_ environment
+func (ctx *ProcessorContext) projectHash() string {
+	var buf bytes.Buffer
+	if data, err := os.ReadFile(filepath.Join(ctx.DepthRoot, ProjectFileName)); err == nil {
+		buf.Write(data)
+	}
+	if ctx.Variables != nil {
+		buf.WriteString("\x00profile=" + ctx.Variables.Profile)
+	}
+	var env []string
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, VariableEnvPrefix) {
+			env = append(env, kv)
+		}
+	}
+	sort.Strings(env)
+	for _, kv := range env {
+		buf.WriteString("\x00" + kv)
+	}
+	if buf.Len() == 0 {
+		return ""
+	}
+	return hashBytes(buf.Bytes())
+}
+
+// helperHashes returns a content hash for every function name declared in
+// the helper files of the module. A function's hash covers its declaration,
+// the functions of its directory it calls, and everything else in the
+// helper files of its directory (imports, types, methods, directives).
+// Definitions of the same name in several directories share one hash, so a
+// helper added at another depth counts as a change.
+func (ctx *ProcessorContext) helperHashes() map[string]string {
+	byDir := make(map[string][]string)
+	for _, file := range ctx.FuncFiles {
+		dir := filepath.Dir(file)
+		byDir[dir] = append(byDir[dir], file)
+	}
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	parts := make(map[string][]string)
+	for _, dir := range dirs {
+		for name, hash := range hashHelperDir(byDir[dir]) {
+			parts[name] = append(parts[name], hash)
+		}
+	}
+	hashes := make(map[string]string, len(parts))
+	for name, list := range parts {
+		if len(list) == 1 {
+			hashes[name] = list[0]
+		} else {
+			hashes[name] = hashBytes([]byte(strings.Join(list, "\x00")))
+		}
+	}
+	return hashes
+}
+
+// writeShared adds code outside the functions, whose layout does not matter
+func writeShared(shared *bytes.Buffer, code []byte) {
+	for _, field := range strings.Fields(string(code)) {
+		shared.WriteString(field + " ")
+	}
+}
+
+// hashHelperDir hashes the functions of the helper files of one directory
+func hashHelperDir(files []string) map[string]string {
+	sort.Strings(files)
+	var shared bytes.Buffer
+	own := make(map[string]string)
+	calls := make(map[string][]string)
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		fset := token.NewFileSet()
+		parsed, err := parser.ParseFile(fset, file, src, parser.ParseComments)
+		if err != nil {
+			shared.Write(src)
+			continue
+		}
+		// Everything outside the functions is shared by all of them
+		last := 0
+		for _, decl := range parsed.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil {
+				continue
+			}
+			start := fn.Pos()
+			if fn.Doc != nil {
+				start = fn.Doc.Pos()
+			}
+			from, to := fset.Position(start).Offset, fset.Position(fn.End()).Offset
+			writeShared(&shared, src[last:from])
+			last = to
+			own[fn.Name.Name] += string(src[from:to])
+			if fn.Body != nil {
+				ast.Inspect(fn.Body, func(n ast.Node) bool {
+					if id, ok := n.(*ast.Ident); ok {
+						calls[fn.Name.Name] = append(calls[fn.Name.Name], id.Name)
+					}
+					return true
+				})
+			}
+		}
+		writeShared(&shared, src[last:])
+	}
+
+	hashes := make(map[string]string, len(own))
+	for name := range own {
+		// The function and, transitively, the functions it refers to
+		seen := map[string]bool{name: true}
+		queue := []string{name}
+		for i := 0; i < len(queue); i++ {
+			for _, id := range calls[queue[i]] {
+				if _, ok := own[id]; ok && !seen[id] {
+					seen[id] = true
+					queue = append(queue, id)
+				}
+			}
+		}
+		sort.Strings(queue)
+		var buf bytes.Buffer
+		buf.Write(shared.Bytes())
+		for _, fn := range queue {
+			buf.WriteString("\x00" + own[fn])
+		}
+		hashes[name] = hashBytes(buf.Bytes())
+	}
+	return hashes
+}
@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/AeonDave/goahead/marker"
+)
+
+// injectVarRequest is an //:inject-var: marker found in a file
+type injectVarRequest struct {
+	lineIdx int
+	line    string
+	marker  *marker.Marker
+}
+
+// valueProcessor returns the code processor that evaluates inject-var calls;
+// runs share theirs, so the calls use the same executor and cache as
+// placeholder markers
+func (inj *Injector) valueProcessor() *CodeProcessor {
+	if inj.values == nil {
+		inj.values = NewCodeProcessor(inj.ctx, NewFunctionExecutor(inj.ctx))
+	}
+	return inj.values
+}
+
+// injectVariables evaluates the calls of the inject-var markers of filePath,
+// whose content is given, and returns the declaration of each variable for
+// the injected block. A variable must not reuse the name of a package-level
+// identifier of the package, or of the code injected with it (injected).
+func (inj *Injector) injectVariables(filePath, content string, requests []injectVarRequest, injected map[string]bool) ([]string, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	declared, err := inj.packageIdentifiers(filePath, content)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]int)
+	for _, req := range requests {
+		name, line := req.marker.Var, req.lineIdx+1
+		if first, ok := seen[name]; ok {
+			return nil, fmt.Errorf("inject-var %s at %s:%d is already injected by the marker at line %d", name, filePath, line, first)
+		}
+		seen[name] = line
+		if injected[name] {
+			return nil, fmt.Errorf("inject-var %s at %s:%d collides with code injected into the same file", name, filePath, line)
+		}
+		if where, ok := declared[name]; ok {
+			return nil, fmt.Errorf("inject-var %s at %s:%d collides with %s declared at %s", name, filePath, line, name, where)
+		}
+	}
+
+	cp := inj.valueProcessor()
+	placeholders := make([]placeholder, len(requests))
+	calls := make([]BatchCall, len(requests))
+	for i, req := range requests {
+		placeholders[i] = placeholder{
+			funcName:     req.marker.Func,
+			argsStr:      req.marker.RawArgs,
+			marker:       strings.TrimSpace(req.line),
+			markerLine:   req.lineIdx + 1,
+			markerColumn: strings.Index(req.line, "//") + 1,
+			pipeline:     req.marker.Pipeline,
+		}
+		calls[i] = BatchCall{FuncName: req.marker.Func, ArgsStr: req.marker.RawArgs, Location: cp.markerLocation(filePath, placeholders[i])}
+	}
+	absDir, _ := filepath.Abs(filepath.Dir(filePath))
+	results := cp.evaluatePipelines(placeholders, calls, absDir)
+	if inj.ctx.interrupted() {
+		return nil, ErrInterrupted
+	}
+
+	decls := make([]string, len(requests))
+	for i, req := range requests {
+		name, result := req.marker.Var, results[i]
+		switch {
+		case result.Err != nil:
+			return nil, fmt.Errorf("cannot inject variable '%s' at %s:%d: %w", name, filePath, req.lineIdx+1, result.Err)
+		case result.Result == SkipResult:
+			return nil, fmt.Errorf("cannot inject variable '%s' at %s:%d: %s declined to produce a value", name, filePath, req.lineIdx+1, req.marker.Func)
+		}
+		outputType := ""
+		if result.UserFunc != nil {
+			outputType = result.UserFunc.OutputType
+		}
+		decls[i] = injectedVarDecl(name, result.Result, outputType)
+		inj.ctx.Stats.add(func(s *RunStats) { s.Injected++ })
+		inj.ctx.events().injected(InjectionEvent{File: filePath, Function: req.marker.Func, Variable: name})
+	}
+	return decls, nil
+}
+
+// injectedVarDecl declares name initialized to value, the Go source of a
+// helper result of type typ. A basic literal would give the variable its
+// default type, so any other typ is written out.
+func injectedVarDecl(name, value, typ string) string {
+	if def := defaultLiteralType(value); def != "" && typ != "" && typ != def {
+		return fmt.Sprintf("var %s %s = %s", name, typ, value)
+	}
+	return fmt.Sprintf("var %s = %s", name, value)
+}
+
+// defaultLiteralType returns the default type of the basic literal value,
+// with an optional sign, "" for other expressions
+func defaultLiteralType(value string) string {
+	expr, err := parser.ParseExpr(value)
+	if err != nil {
+		return ""
+	}
+	if unary, ok := expr.(*ast.UnaryExpr); ok && (unary.Op == token.SUB || unary.Op == token.ADD) {
+		expr = unary.X
+	}
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if e.Name == "true" || e.Name == "false" {
+			return "bool"
+		}
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.INT:
+			return "int"
+		case token.FLOAT:
+			return "float64"
+		case token.IMAG:
+			return "complex128"
+		case token.CHAR:
+			return "rune"
+		case token.STRING:
+			return "string"
+		}
+	}
+	return ""
+}
+
+// packageIdentifiers maps the package-level identifiers that an injected
+// variable of filePath would collide with to where they are declared: the
+// declarations of the file, outside its injected block, and its imports,
+// and the declarations of the other files of its package in the build
+func (inj *Injector) packageIdentifiers(filePath, content string) (map[string]string, error) {
+	own, err := removeInjectedBlock(content)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	declared := make(map[string]string)
+	file, _ := parser.ParseFile(fset, filePath, own, parser.SkipObjectResolution)
+	if file == nil || file.Name == nil {
+		return declared, nil
+	}
+	addDeclarations(fset, file, declared)
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := importCandidates(importPath)[0]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		declared[name] = fmt.Sprintf("%s (import %s)", fset.Position(spec.Pos()), spec.Path.Value)
+	}
+
+	dir := filepath.Dir(filePath)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", dir, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		sibling := filepath.Join(dir, name)
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || sibling == filepath.Clean(filePath) {
+			continue
+		}
+		if abs, err := filepath.Abs(sibling); err == nil && inj.ctx.isHelperFile(abs) {
+			continue
+		}
+		if match, err := build.Default.MatchFile(dir, name); err != nil || !match {
+			continue
+		}
+		other, _ := parser.ParseFile(fset, sibling, nil, parser.SkipObjectResolution)
+		if other != nil && other.Name != nil && other.Name.Name == file.Name.Name {
+			addDeclarations(fset, other, declared)
+		}
+	}
+	return declared, nil
+}
+
+// addDeclarations records the package-level functions, types, variables and
+// constants of file in declared
+func addDeclarations(fset *token.FileSet, file *ast.File, declared map[string]string) {
+	record := func(ident *ast.Ident) {
+		if ident.Name != "_" {
+			declared[ident.Name] = fset.Position(ident.Pos()).String()
+		}
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil && d.Name.Name != "init" {
+				record(d.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					record(s.Name)
+				case *ast.ValueSpec:
+					for _, ident := range s.Names {
+						record(ident)
+					}
+				}
+			}
+		}
+	}
+}
@@ -6,19 +6,15 @@ import (
 	"go/parser"
 	"go/printer"
 	"go/token"
-	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
+
+	"github.com/AeonDave/goahead/marker"
 )
 
 // InjectPattern matches //:inject:MethodName
-const InjectPattern = `^\s*//\s*:inject:(\w+)\s*$`
-
-// Markers for injected code blocks (follows Go convention for generated code)
-const injectBlockStart = "// Code generated by goahead. DO NOT EDIT."
-const injectBlockEnd = "// End of goahead generated code."
+const InjectPattern = marker.InjectPattern
 
 // InjectionResult contains the extracted function and its dependencies
 type InjectionResult struct {
@@ -34,6 +30,8 @@ type InjectionResult struct {
 // Injector handles function injection from helper files
 type Injector struct {
 	ctx *ProcessorContext
+	// values evaluates the calls of inject-var markers
+	values *CodeProcessor
 }
 
 // NewInjector creates a new Injector
@@ -43,9 +41,16 @@ func NewInjector(ctx *ProcessorContext) *Injector {
 
 // ProcessFileInjections handles all //:inject: directives in a file.
 // Inject markers must appear above an interface declaration.
-// The method name must exist in that interface.
+// The method name must exist in that interface. Free-standing //:inject!:
+// markers skip the interface check and must be at top level, as must
+// //:inject-var: markers, whose variables join the injected block. Files
+// that SkipReason names are left alone.
 func (inj *Injector) ProcessFileInjections(filePath string, verbose bool) error {
-	content, err := os.ReadFile(filePath)
+	if reason := inj.ctx.SkipReason(filePath); reason != "" {
+		inj.ctx.Logger().Logf(LogFilter, "[goahead] Not injecting into %s: %s", inj.ctx.relToRoot(filePath), reason)
+		return nil
+	}
+	content, err := inj.ctx.readSource(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %v", err)
 	}
@@ -53,11 +58,11 @@ func (inj *Injector) ProcessFileInjections(filePath string, verbose bool) error
 	sourceDir := filepath.Dir(filePath)
 	absSourceDir, _ := filepath.Abs(sourceDir)
 
-	injectRe := regexp.MustCompile(InjectPattern)
-
 	// Normalize to \n for scanning and rewriting; we'll write back with \n.
 	// (CRLF preservation is handled by git/core.autocrlf or repo settings; Go compiler accepts both.)
-	normalized := strings.ReplaceAll(string(content), "\r\n", "\n")
+	// A byte order mark would hide the package clause; it is put back on write
+	bom, text := splitBOM(string(content))
+	normalized := strings.ReplaceAll(text, "\r\n", "\n")
 	lines := strings.Split(normalized, "\n")
 
 	// First pass: find all inject markers and their associated interfaces
@@ -66,23 +71,50 @@ func (inj *Injector) ProcessFileInjections(filePath string, verbose bool) error
 		methodName   string
 		interfaceIdx int
 		ifaceName    string
+		placement    string
 	}
 
 	var requests []injectRequest
+	var varRequests []injectVarRequest
 	var pendingMarkers []struct {
 		lineIdx    int
 		methodName string
+		placement  string
 	}
 
+	prefix := inj.ctx.MarkerSyntax().Prefix()
 	for i, line := range lines {
 		trimmed := strings.TrimSpace(line)
 
+		m, perr := inj.ctx.MarkerSyntax().Parse(line)
+		if m != nil && m.Kind == marker.KindInjectVar {
+			if perr != nil {
+				return fmt.Errorf("invalid inject-var marker at %s:%d: %v", filePath, i+1, perr)
+			}
+			if trimmed != strings.TrimRight(line, " \t") {
+				return fmt.Errorf("%sinject-var: marker at %s:%d must be at top level", prefix, filePath, i+1)
+			}
+			varRequests = append(varRequests, injectVarRequest{lineIdx: i, line: line, marker: m})
+			continue
+		}
+
 		// Check for inject marker
-		if match := injectRe.FindStringSubmatch(line); match != nil {
+		if m != nil && m.Kind == marker.KindInject {
+			if perr != nil {
+				return fmt.Errorf("invalid inject marker at %s:%d: %v", filePath, i+1, perr)
+			}
+			if m.Free {
+				if trimmed != strings.TrimRight(line, " \t") {
+					return fmt.Errorf("%sinject!: marker at %s:%d must be at top level", prefix, filePath, i+1)
+				}
+				requests = append(requests, injectRequest{lineIdx: i, methodName: m.Func, interfaceIdx: -1, placement: m.Placement})
+				continue
+			}
 			pendingMarkers = append(pendingMarkers, struct {
 				lineIdx    int
 				methodName string
-			}{lineIdx: i, methodName: match[1]})
+				placement  string
+			}{lineIdx: i, methodName: m.Func, placement: m.Placement})
 			continue
 		}
 
@@ -107,6 +139,7 @@ func (inj *Injector) ProcessFileInjections(filePath string, verbose bool) error
 						methodName:   pm.methodName,
 						interfaceIdx: i,
 						ifaceName:    ifaceName,
+						placement:    pm.placement,
 					})
 				}
 			}
@@ -115,20 +148,51 @@ func (inj *Injector) ProcessFileInjections(filePath string, verbose bool) error
 
 		// Non-empty, non-comment line after markers without interface = error
 		if len(pendingMarkers) > 0 && trimmed != "" && !strings.HasPrefix(trimmed, "//") {
-			return fmt.Errorf("//:inject markers at %s:%d must be followed by an interface declaration",
-				filePath, pendingMarkers[0].lineIdx+1)
+			return fmt.Errorf("%sinject markers at %s:%d must be followed by an interface declaration (use %sinject!:%s for a free function)",
+				prefix, filePath, pendingMarkers[0].lineIdx+1, prefix, pendingMarkers[0].methodName)
 		}
 	}
 
 	// Check for dangling markers at end of file
 	if len(pendingMarkers) > 0 {
-		return fmt.Errorf("//:inject markers at %s:%d must be followed by an interface declaration",
-			filePath, pendingMarkers[0].lineIdx+1)
+		return fmt.Errorf("%sinject markers at %s:%d must be followed by an interface declaration (use %sinject!:%s for a free function)",
+			prefix, filePath, pendingMarkers[0].lineIdx+1, prefix, pendingMarkers[0].methodName)
 	}
 
-	if len(requests) == 0 {
+	if len(requests) == 0 && len(varRequests) == 0 {
 		return nil
 	}
+	if inj.ctx.Config.Companion {
+		line := 0
+		if len(requests) > 0 {
+			line = requests[0].lineIdx + 1
+		}
+		if len(varRequests) > 0 && (line == 0 || varRequests[0].lineIdx+1 < line) {
+			line = varRequests[0].lineIdx + 1
+		}
+		return fmt.Errorf("-companion cannot write the inject marker at %s:%d: injected code must be written to the source", filePath, line)
+	}
+
+	// The file has a single injected block, so the markers that name a
+	// placement must agree on it
+	placement, anchorIface := "", ""
+	for _, req := range requests {
+		if req.placement == "" {
+			continue
+		}
+		if placement == "" {
+			placement, anchorIface = req.placement, req.ifaceName
+			continue
+		}
+		if req.placement != placement || (placement == marker.PlaceAfterInterface && req.ifaceName != anchorIface) {
+			return fmt.Errorf("conflicting placements for the injected block in %s: the marker at line %d asks for @%s, another one for @%s",
+				filePath, req.lineIdx+1, describePlacement(req.placement, req.ifaceName), describePlacement(placement, anchorIface))
+		}
+	}
+
+	// Packages the target already imports are reused under the target's
+	// names instead of being imported a second time
+	targetImports := importNamesByPath(normalized)
 
 	// Extract functions and build injection content, deduplicating shared dependencies
 	var importsToAdd []string
@@ -138,8 +202,11 @@ func (inj *Injector) ProcessFileInjections(filePath string, verbose bool) error
 	seenDeps := make(map[string]bool)
 
 	for _, req := range requests {
-		result, err := inj.ExtractFunction(req.methodName, absSourceDir)
+		result, err := inj.extractFunction(req.methodName, absSourceDir, targetImports)
 		if err != nil {
+			if req.ifaceName == "" {
+				return fmt.Errorf("cannot inject function '%s': %v", req.methodName, err)
+			}
 			return fmt.Errorf("cannot inject method '%s' for interface '%s': %v",
 				req.methodName, req.ifaceName, err)
 		}
@@ -182,11 +249,23 @@ func (inj *Injector) ProcessFileInjections(filePath string, verbose bool) error
 			}
 		}
 
-		if verbose {
-			fmt.Fprintf(os.Stderr, "[goahead] Injected method '%s' for interface '%s' in %s\n",
-				req.methodName, req.ifaceName, filePath)
-		}
+		inj.ctx.Stats.add(func(s *RunStats) { s.Injected++ })
+		inj.ctx.events().injected(InjectionEvent{File: filePath, Function: req.methodName, Interface: req.ifaceName})
+	}
+
+	// Injected variables come first in the block
+	injected := make(map[string]bool, len(seenFuncs)+len(seenDeps))
+	for name := range seenFuncs {
+		injected[name] = true
 	}
+	for name := range seenDeps {
+		injected[name] = true
+	}
+	varDecls, err := inj.injectVariables(filePath, normalized, varRequests, injected)
+	if err != nil {
+		return err
+	}
+	depsToAdd = append(varDecls, depsToAdd...)
 
 	// Build new file content
 	// 1. Keep inject markers (they stay!)
@@ -197,30 +276,36 @@ func (inj *Injector) ProcessFileInjections(filePath string, verbose bool) error
 	// Insert imports only (dependencies will be appended in the injected block)
 	baseContent := inj.insertImportsAndDeps(lines, importsToAdd, nil)
 
-	// Build injected block (deps + functions). Keep boundaries stable:
-	// - Start at injectBlockStart
-	// - No blank line immediately before injectBlockEnd
-	// - Always one blank line after injectBlockEnd
+	// Build injected block (deps + functions) in the configured fence style;
+	// there is never a blank line before the end fence
 	block := inj.buildInjectedBlock(depsToAdd, funcsToAdd)
+	if err := checkSize("injected code", block, inj.ctx.Config.MaxInjectSize, DefaultMaxInjectSize, "-max-inject-size"); err != nil {
+		return err
+	}
 
-	finalContent, err := inj.replaceOrAppendInjectedBlock(baseContent, block)
+	finalContent, err := inj.placeInjectedBlock(baseContent, block, placement, anchorIface)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(filePath, []byte(finalContent), 0o644)
+	return inj.ctx.writeSource(filePath, []byte(bom+finalContent))
 }
 
 func (inj *Injector) buildInjectedBlock(depsToAdd []string, funcsToAdd []string) string {
+	fence := inj.ctx.Config.Fence()
 	var b strings.Builder
-	b.WriteString(injectBlockStart)
+	b.WriteString(fence.Begin)
 	b.WriteString("\n")
 
-	for _, dep := range depsToAdd {
+	for i, dep := range depsToAdd {
 		trimmed := strings.TrimSpace(dep)
 		if trimmed == "" {
 			continue
 		}
+		// A doc comment right below the begin fence would join its group
+		if i == 0 && strings.HasPrefix(trimmed, "//") {
+			b.WriteString("\n")
+		}
 		b.WriteString(trimmed)
 		b.WriteString("\n")
 	}
@@ -230,40 +315,109 @@ func (inj *Injector) buildInjectedBlock(depsToAdd []string, funcsToAdd []string)
 		if trimmed == "" {
 			continue
 		}
-		b.WriteString("\n")
+		b.WriteString(strings.Repeat("\n", fence.Inside))
 		b.WriteString(trimmed)
 		b.WriteString("\n")
 	}
 
-	b.WriteString(injectBlockEnd)
-	b.WriteString("\n")
-	// Always leave one empty line after the end marker
+	b.WriteString(fence.End)
 	b.WriteString("\n")
+	b.WriteString(strings.Repeat("\n", fence.After))
 	return b.String()
 }
 
+// joinBlock puts block after head, separated by the blank lines of the
+// fence style
+func (inj *Injector) joinBlock(head, block string) string {
+	head = strings.TrimRight(head, "\n")
+	if head == "" {
+		return block
+	}
+	return head + "\n" + strings.Repeat("\n", inj.ctx.Config.Fence().Before) + block
+}
+
 func (inj *Injector) replaceOrAppendInjectedBlock(content string, block string) (string, error) {
-	startIdx := strings.Index(content, injectBlockStart)
-	if startIdx == -1 {
-		// No existing block: append at EOF with one blank line separation.
-		trimmed := strings.TrimRight(content, "\n")
-		if trimmed == "" {
-			return block, nil
-		}
-		return trimmed + "\n\n" + block, nil
+	startIdx, endIdx, found, err := findInjectedBlock(content)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		// No existing block: append at EOF
+		return inj.joinBlock(content, block), nil
+	}
+
+	// Drop any blank lines after the old end fence; the new block adds its own
+	remainder := trimLeadingBlankLines(content[endIdx:])
+	return inj.joinBlock(content[:startIdx], block) + remainder, nil
+}
+
+// placeInjectedBlock writes block at placement. The old block is removed
+// wherever it is first, so switching placements moves it instead of
+// duplicating it; the default placement keeps it where it was.
+func (inj *Injector) placeInjectedBlock(content, block, placement, ifaceName string) (string, error) {
+	if placement == "" {
+		return inj.replaceOrAppendInjectedBlock(content, block)
+	}
+	content, err := removeInjectedBlock(content)
+	if err != nil {
+		return "", err
+	}
+	if placement == marker.PlaceEndOfFile {
+		return inj.replaceOrAppendInjectedBlock(content, block)
 	}
 
-	endRel := strings.Index(content[startIdx:], injectBlockEnd)
-	if endRel == -1 {
-		return "", fmt.Errorf("unclosed injected block in file")
+	if ifaceName == "" {
+		return "", fmt.Errorf("placement @%s has no interface to follow", marker.PlaceAfterInterface)
 	}
-	endIdx := startIdx + endRel + len(injectBlockEnd)
+	lines := strings.Split(content, "\n")
+	end := interfaceEndLine(lines, ifaceName)
+	if end == -1 {
+		return "", fmt.Errorf("interface '%s' for @%s not found", ifaceName, marker.PlaceAfterInterface)
+	}
+	head := strings.Join(lines[:end+1], "\n")
+	tail := trimLeadingBlankLines("\n" + strings.Join(lines[end+1:], "\n"))
+	return inj.joinBlock(head, block) + tail, nil
+}
+
+// removeInjectedBlock drops the injected block and the blank lines after it
+func removeInjectedBlock(content string) (string, error) {
+	startIdx, endIdx, found, err := findInjectedBlock(content)
+	if err != nil || !found {
+		return content, err
+	}
+	head := strings.TrimRight(content[:startIdx], "\n")
+	remainder := trimLeadingBlankLines(content[endIdx:])
+	if head == "" || remainder == "" {
+		return head + remainder, nil
+	}
+	return head + "\n\n" + remainder, nil
+}
 
-	// Drop any blank lines immediately after the old end marker; the new block will add exactly one.
-	remainder := content[endIdx:]
-	remainder = trimLeadingBlankLines(remainder)
+// interfaceEndLine returns the index of the line closing the declaration of
+// interface name, or -1
+func interfaceEndLine(lines []string, name string) int {
+	for i, line := range lines {
+		parts := strings.Fields(line)
+		if len(parts) < 3 || parts[0] != "type" || parts[1] != name || !strings.HasPrefix(parts[2], "interface") {
+			continue
+		}
+		depth := 0
+		for j := i; j < len(lines); j++ {
+			depth += strings.Count(lines[j], "{") - strings.Count(lines[j], "}")
+			if depth <= 0 && strings.Contains(lines[j], "}") {
+				return j
+			}
+		}
+		return -1
+	}
+	return -1
+}
 
-	return content[:startIdx] + block + remainder, nil
+func describePlacement(placement, ifaceName string) string {
+	if placement == marker.PlaceAfterInterface {
+		return placement + " of interface " + ifaceName
+	}
+	return placement
 }
 
 func trimLeadingBlankLines(s string) string {
@@ -334,6 +488,14 @@ func (inj *Injector) parseInterfaceMethods(lines []string, startIdx int) map[str
 
 // ExtractFunction extracts a function and its dependencies from helper files
 func (inj *Injector) ExtractFunction(funcName, sourceDir string) (*InjectionResult, error) {
+	return inj.extractFunction(funcName, sourceDir, nil)
+}
+
+// extractFunction is ExtractFunction for a target file importing
+// targetImports (local name by path): packages the target already imports
+// under another name are not imported again, and the extracted code is
+// rewritten to use the target's name
+func (inj *Injector) extractFunction(funcName, sourceDir string, targetImports map[string]string) (*InjectionResult, error) {
 	// Find the function using hierarchical resolution
 	userFunc, helperPath := inj.ctx.ResolveFunction(funcName, sourceDir)
 	if userFunc == nil {
@@ -357,8 +519,10 @@ func (inj *Injector) ExtractFunction(funcName, sourceDir string) (*InjectionResu
 		}
 	}
 
-	// Ensure the target exists
-	funcDecl, ok := funcDecls[funcName]
+	// Ensure the target exists; a namespaced helper is declared without
+	// its namespace
+	funcName = userFunc.DeclName()
+	_, ok := funcDecls[funcName]
 	if !ok {
 		return nil, fmt.Errorf("function '%s' not found in %s", funcName, helperPath)
 	}
@@ -399,20 +563,28 @@ func (inj *Injector) ExtractFunction(funcName, sourceDir string) (*InjectionResu
 		}
 	}
 
+	// Dependencies can refer to packages and other declarations too
+	addDependencyIdentifiers(node, usedIdents)
+
 	// Extract only the imports that are actually used
+	renames := make(map[string]string)
 	for _, imp := range node.Imports {
 		// Get the package name (either alias or last part of path)
+		path := strings.Trim(imp.Path.Value, `"`)
 		var pkgName string
 		if imp.Name != nil {
 			pkgName = imp.Name.Name
 		} else {
 			// Extract package name from path (e.g., "encoding/hex" -> "hex")
-			path := strings.Trim(imp.Path.Value, `"`)
 			parts := strings.Split(path, "/")
 			pkgName = parts[len(parts)-1]
 		}
 
 		// Check if this package is used
+		if local, ok := targetImports[path]; ok && local != pkgName && usedIdents[pkgName] {
+			renames[pkgName] = local
+			continue
+		}
 		if usedIdents[pkgName] {
 			var importSpec string
 			if imp.Name != nil {
@@ -424,24 +596,24 @@ func (inj *Injector) ExtractFunction(funcName, sourceDir string) (*InjectionResu
 		}
 	}
 
+	requalify(node, renames)
+
 	// Extract dependencies (const, var, type) that are used
 	result.DepDecls = inj.extractDependencyDecls(node, fset, usedIdents)
 
 	// Build individual function declarations for deduplication across injection requests
 	result.FunctionDecls = make(map[string]string)
 	for name, fn := range included {
-		var buf strings.Builder
-		if err := printer.Fprint(&buf, fset, fn); err != nil {
+		code, err := printWithComments(fset, node, fn)
+		if err != nil {
 			return nil, fmt.Errorf("failed to print function '%s': %v", name, err)
 		}
-		result.FunctionDecls[name] = buf.String()
+		result.FunctionDecls[name] = code
 	}
 
 	// Build concatenated function code (target first, then dependencies sorted)
 	var funcBuf strings.Builder
-	if err := printer.Fprint(&funcBuf, fset, funcDecl); err != nil {
-		return nil, fmt.Errorf("failed to print function: %v", err)
-	}
+	funcBuf.WriteString(result.FunctionDecls[funcName])
 
 	var otherNames []string
 	for name := range included {
@@ -454,9 +626,7 @@ func (inj *Injector) ExtractFunction(funcName, sourceDir string) (*InjectionResu
 
 	for _, name := range otherNames {
 		funcBuf.WriteString("\n\n")
-		if err := printer.Fprint(&funcBuf, fset, included[name]); err != nil {
-			return nil, fmt.Errorf("failed to print dependent function: %v", err)
-		}
+		funcBuf.WriteString(result.FunctionDecls[name])
 	}
 
 	result.FunctionCode = funcBuf.String()
@@ -495,6 +665,46 @@ func (inj *Injector) collectUsedIdentifiers(fn *ast.FuncDecl) map[string]bool {
 	return used
 }
 
+// addDependencyIdentifiers adds the identifiers referenced by the used
+// const/var/type declarations of file to used, until no new ones appear
+func addDependencyIdentifiers(file *ast.File, used map[string]bool) {
+	for changed := true; changed; {
+		changed = false
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok == token.IMPORT {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				if !declaresUsed(spec, used) {
+					continue
+				}
+				ast.Inspect(spec, func(n ast.Node) bool {
+					if ident, ok := n.(*ast.Ident); ok && !used[ident.Name] {
+						used[ident.Name] = true
+						changed = true
+					}
+					return true
+				})
+			}
+		}
+	}
+}
+
+func declaresUsed(spec ast.Spec, used map[string]bool) bool {
+	switch s := spec.(type) {
+	case *ast.ValueSpec:
+		for _, name := range s.Names {
+			if used[name.Name] {
+				return true
+			}
+		}
+	case *ast.TypeSpec:
+		return used[s.Name.Name]
+	}
+	return false
+}
+
 // extractDependencies extracts const/var/type declarations used by the function
 func (inj *Injector) extractDependencies(file *ast.File, fset *token.FileSet, usedIdents map[string]bool) (constants, variables, types string) {
 	depDecls := inj.extractDependencyDecls(file, fset, usedIdents)
@@ -526,48 +736,29 @@ func (inj *Injector) extractDependencyDecls(file *ast.File, fset *token.FileSet,
 			continue
 		}
 
-		switch genDecl.Tok {
-		case token.CONST:
-			for _, spec := range genDecl.Specs {
-				vs := spec.(*ast.ValueSpec)
-				for _, name := range vs.Names {
-					if usedIdents[name.Name] {
-						var buf strings.Builder
-						printer.Fprint(&buf, fset, &ast.GenDecl{
-							Tok:   token.CONST,
-							Specs: []ast.Spec{vs},
-						})
-						result[name.Name] = buf.String()
-						break
-					}
-				}
+		for _, spec := range genDecl.Specs {
+			var names []*ast.Ident
+			var doc *ast.CommentGroup
+			switch spec := spec.(type) {
+			case *ast.ValueSpec:
+				names, doc = spec.Names, spec.Doc
+			case *ast.TypeSpec:
+				names, doc = []*ast.Ident{spec.Name}, spec.Doc
+			default:
+				continue
 			}
-		case token.VAR:
-			for _, spec := range genDecl.Specs {
-				vs := spec.(*ast.ValueSpec)
-				for _, name := range vs.Names {
-					if usedIdents[name.Name] {
-						var buf strings.Builder
-						printer.Fprint(&buf, fset, &ast.GenDecl{
-							Tok:   token.VAR,
-							Specs: []ast.Spec{vs},
-						})
-						result[name.Name] = buf.String()
-						break
-					}
+			for _, name := range names {
+				if !usedIdents[name.Name] {
+					continue
 				}
-			}
-		case token.TYPE:
-			for _, spec := range genDecl.Specs {
-				ts := spec.(*ast.TypeSpec)
-				if usedIdents[ts.Name.Name] {
-					var buf strings.Builder
-					printer.Fprint(&buf, fset, &ast.GenDecl{
-						Tok:   token.TYPE,
-						Specs: []ast.Spec{ts},
-					})
-					result[ts.Name.Name] = buf.String()
+				// A spec taken out of a group becomes a declaration of its
+				// own, documented by its own doc comment
+				single := &ast.GenDecl{Doc: doc, Tok: genDecl.Tok, TokPos: spec.Pos(), Specs: []ast.Spec{spec}}
+				if !genDecl.Lparen.IsValid() {
+					single.TokPos, single.Doc = genDecl.TokPos, genDecl.Doc
 				}
+				result[name.Name], _ = printWithComments(fset, file, single)
+				break
 			}
 		}
 	}
@@ -575,6 +766,96 @@ func (inj *Injector) extractDependencyDecls(file *ast.File, fset *token.FileSet,
 	return result
 }
 
+// printWithComments prints node with its doc comment and the helper file's
+// comments inside it; printer.Fprint alone drops comments in function
+// bodies. goahead directives such as //goahead:nocache are left out of the
+// doc comment.
+func printWithComments(fset *token.FileSet, file *ast.File, node ast.Node) (string, error) {
+	start, end := node.Pos(), node.End()
+	var doc *ast.CommentGroup
+	switch node := node.(type) {
+	case *ast.FuncDecl:
+		doc = node.Doc
+	case *ast.GenDecl:
+		doc = node.Doc
+	}
+	if doc != nil {
+		start = doc.Pos()
+	}
+	var comments []*ast.CommentGroup
+	for _, group := range file.Comments {
+		if group.Pos() >= start && group.Pos() <= end {
+			comments = append(comments, group)
+		}
+	}
+	var buf strings.Builder
+	if err := printer.Fprint(&buf, fset, &printer.CommentedNode{Node: node, Comments: comments}); err != nil {
+		return "", err
+	}
+	if doc == nil {
+		return buf.String(), nil
+	}
+
+	// The doc comment comes first; drop its directive lines and the empty
+	// // lines gofmt puts before them
+	lines := strings.SplitAfter(buf.String(), "\n")
+	docLines := 0
+	for docLines < len(lines) && strings.HasPrefix(lines[docLines], "//") {
+		docLines++
+	}
+	var kept []string
+	for _, line := range lines[:docLines] {
+		if !strings.HasPrefix(line, "//goahead:") {
+			kept = append(kept, line)
+		}
+	}
+	for len(kept) > 0 && strings.TrimSpace(kept[len(kept)-1]) == "//" {
+		kept = kept[:len(kept)-1]
+	}
+	return strings.Join(append(kept, lines[docLines:]...), ""), nil
+}
+
+// importNamesByPath maps the import paths of a Go source file to the names
+// they are referenced by; blank and dot imports are left out
+func importNamesByPath(src string) map[string]string {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+	names := make(map[string]string)
+	for _, imp := range file.Imports {
+		path := strings.Trim(imp.Path.Value, `"`)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if _, seen := names[path]; !seen && name != "_" && name != "." {
+			names[path] = name
+		}
+	}
+	return names
+}
+
+// requalify rewrites package qualifiers in node (helperName.X becomes
+// targetName.X); identifiers resolved to local declarations are untouched
+func requalify(node ast.Node, renames map[string]string) {
+	if len(renames) == 0 {
+		return
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+			if local, ok := renames[ident.Name]; ok {
+				ident.Name = local
+			}
+		}
+		return true
+	})
+}
+
 // insertImportsAndDeps adds imports and dependencies to the file content
 func (inj *Injector) insertImportsAndDeps(lines []string, imports []string, deps []string) string {
 	if len(imports) == 0 && len(deps) == 0 {
@@ -585,30 +866,28 @@ func (inj *Injector) insertImportsAndDeps(lines []string, imports []string, deps
 	for _, imp := range imports {
 		importSet[imp] = true
 	}
-
-	packageLineIdx := -1
-	importStart := -1
-	importEnd := -1
-	importSingle := -1
-	inImport := false
-
-	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "package ") && packageLineIdx == -1 {
-			packageLineIdx = i
-		}
-		if strings.HasPrefix(trimmed, "import (") {
-			importStart = i
-			inImport = true
-		}
-		if inImport && trimmed == ")" {
-			importEnd = i
-			inImport = false
-		}
-		if strings.HasPrefix(trimmed, "import ") && !strings.HasSuffix(trimmed, "(") {
-			if importStart == -1 {
-				importSingle = i
-			}
+	// Sorted, so that every run adds them in the same order
+	newImports := make([]string, 0, len(importSet))
+	for imp := range importSet {
+		newImports = append(newImports, imp)
+	}
+	sort.Strings(newImports)
+
+	layout := locateImports(lines)
+	packageLineIdx, importStart, importEnd := layout.packageLine, layout.blockStart, layout.blockEnd
+	importSingle, cgoImportEnd := layout.single, layout.cgoEnd
+	// An existing block takes the new imports; a single import before it is
+	// left alone so they are not added twice
+	if importStart != -1 {
+		importSingle = -1
+	}
+	// Without other imports, a new block goes after the package clause, or
+	// after import "C" in cgo files
+	newBlockAfter := -1
+	if importStart == -1 && importSingle == -1 {
+		newBlockAfter = packageLineIdx
+		if cgoImportEnd != -1 {
+			newBlockAfter = cgoImportEnd
 		}
 	}
 
@@ -625,7 +904,7 @@ func (inj *Injector) insertImportsAndDeps(lines []string, imports []string, deps
 			if spec != "" {
 				result = append(result, "\t"+spec)
 			}
-			for imp := range importSet {
+			for _, imp := range newImports {
 				if spec == imp {
 					continue
 				}
@@ -637,11 +916,11 @@ func (inj *Injector) insertImportsAndDeps(lines []string, imports []string, deps
 
 		result = append(result, line)
 
-		// Insert imports after package if none exist
-		if i == packageLineIdx && importStart == -1 && importSingle == -1 && len(importSet) > 0 {
+		// Insert imports after package (or import "C") if none exist
+		if i == newBlockAfter && len(importSet) > 0 {
 			result = append(result, "")
 			result = append(result, "import (")
-			for imp := range importSet {
+			for _, imp := range newImports {
 				result = append(result, "\t"+imp)
 			}
 			result = append(result, ")")
@@ -650,7 +929,7 @@ func (inj *Injector) insertImportsAndDeps(lines []string, imports []string, deps
 		// Extend import block before closing )
 		if i == importEnd && len(importSet) > 0 {
 			result = result[:len(result)-1]
-			for imp := range importSet {
+			for _, imp := range newImports {
 				found := false
 				for j := importStart; j <= importEnd; j++ {
 					if strings.Contains(lines[j], imp) {
@@ -667,7 +946,7 @@ func (inj *Injector) insertImportsAndDeps(lines []string, imports []string, deps
 
 		// Insert dependencies after imports
 		if !insertedDeps && len(deps) > 0 {
-			if i == importEnd || (importStart == -1 && importSingle == -1 && i == packageLineIdx) || i == importSingle {
+			if i == importEnd || i == newBlockAfter || i == importSingle {
 				result = append(result, "")
 				for _, dep := range deps {
 					result = append(result, strings.TrimSpace(dep))
@@ -679,3 +958,104 @@ func (inj *Injector) insertImportsAndDeps(lines []string, imports []string, deps
 
 	return strings.Join(result, "\n")
 }
+
+// importLayout holds the line indices insertImportsAndDeps edits around; -1
+// marks what the file does not have
+type importLayout struct {
+	packageLine int
+	// blockStart and blockEnd are the import ( and ) lines of the first
+	// parenthesized import declaration other than import "C"
+	blockStart, blockEnd int
+	// single is the first one-line import declaration
+	single int
+	// cgoEnd is the last line of the import "C" declaration. Its preamble
+	// comment must stay directly above it and it must stay a declaration
+	// of its own, so imports are never added to it.
+	cgoEnd int
+}
+
+// locateImports finds the package clause and import declarations of lines
+// from the positions of the parsed file, so comments, build constraints and
+// string literals that look like them are never taken for them. Content
+// that does not parse falls back to scanning lines.
+func locateImports(lines []string) importLayout {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", strings.Join(lines, "\n"), parser.ImportsOnly)
+	if err != nil {
+		return scanImports(lines)
+	}
+	index := func(pos token.Pos) int { return fset.Position(pos).Line - 1 }
+	layout := importLayout{packageLine: index(file.Package), blockStart: -1, blockEnd: -1, single: -1, cgoEnd: -1}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		isCgo := false
+		for _, spec := range gen.Specs {
+			if imp, ok := spec.(*ast.ImportSpec); ok && imp.Path.Value == `"C"` {
+				isCgo = true
+			}
+		}
+		switch {
+		case isCgo:
+			layout.cgoEnd = index(gen.End())
+		case gen.Lparen.IsValid() && index(gen.Lparen) != index(gen.Rparen):
+			if layout.blockStart == -1 {
+				layout.blockStart, layout.blockEnd = index(gen.Pos()), index(gen.Rparen)
+			}
+		case !gen.Lparen.IsValid() && layout.single == -1:
+			layout.single = index(gen.Pos())
+		}
+	}
+	return layout
+}
+
+// scanImports is locateImports for content that does not parse
+func scanImports(lines []string) importLayout {
+	packageLineIdx := -1
+	importStart := -1
+	importEnd := -1
+	importSingle := -1
+	cgoImportEnd := -1
+	blockStart, blockIsCgo := -1, false
+	inComment := false
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if inComment {
+			inComment = !strings.Contains(trimmed, "*/")
+			continue
+		}
+		if strings.HasPrefix(trimmed, "/*") && !strings.Contains(trimmed, "*/") {
+			inComment = true
+			continue
+		}
+		if strings.HasPrefix(trimmed, "package ") && packageLineIdx == -1 {
+			packageLineIdx = i
+		}
+		if blockStart != -1 {
+			if trimmed == `"C"` {
+				blockIsCgo = true
+			}
+			if trimmed == ")" {
+				if blockIsCgo {
+					cgoImportEnd = i
+				} else if importStart == -1 {
+					importStart, importEnd = blockStart, i
+				}
+				blockStart = -1
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(trimmed, "import ("):
+			blockStart, blockIsCgo = i, false
+		case trimmed == `import "C"`:
+			cgoImportEnd = i
+		case strings.HasPrefix(trimmed, "import ") && importSingle == -1:
+			importSingle = i
+		}
+	}
+	return importLayout{packageLine: packageLineIdx, blockStart: importStart, blockEnd: importEnd, single: importSingle, cgoEnd: cgoImportEnd}
+}
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ErrInterrupted is returned by a run stopped by SIGINT or SIGTERM. Files
+// processed before the signal keep their changes; the others are untouched.
+var ErrInterrupted = errors.New("interrupted")
+
+// InterruptGrace is how long evaluation programs still running when the
+// run is interrupted get to exit before they are killed
+const InterruptGrace = 2 * time.Second
+
+// InterruptExitCode is the exit status of an interrupted run, the shell
+// convention for SIGINT
+const InterruptExitCode = 130
+
+// BeforeFileHook, when set, is called before each source file is
+// processed; tests use it to interrupt a run at a known point
+var BeforeFileHook func(filePath string)
+
+// notifyInterrupt returns a context that is done once the process receives
+// SIGINT or SIGTERM; stop restores the default signal behavior
+func notifyInterrupt() (ctx context.Context, stop func()) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// interrupted reports whether the run received SIGINT or SIGTERM
+func (ctx *ProcessorContext) interrupted() bool {
+	return ctx.Interrupt != nil && ctx.Interrupt.Err() != nil
+}
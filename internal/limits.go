@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxLiteralSize and DefaultMaxInjectSize cap, in bytes, a single
+// replacement value and the code injected into one file, so a helper that
+// returns a whole file by mistake fails its marker instead of bloating the
+// source
+const (
+	DefaultMaxLiteralSize = 1 << 20
+	DefaultMaxInjectSize  = 8 << 20
+)
+
+// sizePreviewLength is the number of leading bytes shown of an oversized value
+const sizePreviewLength = 200
+
+var errTooLarge = errors.New("too large")
+
+// checkSize fails when value is longer than limit bytes; limit 0 means def
+func checkSize(what, value string, limit, def int, flagName string) error {
+	if limit <= 0 {
+		limit = def
+	}
+	if len(value) <= limit {
+		return nil
+	}
+	// Values are Go literals or source code already, shown as written
+	preview := value
+	if len(preview) > sizePreviewLength {
+		preview = preview[:sizePreviewLength] + "..."
+	}
+	preview = strings.ReplaceAll(preview, "\n", `\n`)
+	return fmt.Errorf("%s is %w: %d bytes, over the %d-byte limit (raise it with %s); it starts with %s",
+		what, errTooLarge, len(value), limit, flagName, preview)
+}
+
+// byteUnits are the suffixes accepted by parseByteSize, longest first
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"B", 1},
+}
+
+// parseByteSize parses sizes such as 256MiB, 1GB or 4096
+func parseByteSize(s string) (int64, error) {
+	number, unit := strings.TrimSpace(s), int64(1)
+	for _, u := range byteUnits {
+		if rest, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, unit = strings.TrimSpace(rest), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n > 0 && n > (1<<63-1)/unit {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * unit, nil
+}
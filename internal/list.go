@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Unresolved is the helper of a listed call no loaded helper serves
+const Unresolved = "UNRESOLVED"
+
+// Listing is what goahead list reports: the helpers of a module and the
+// markers of its files, paths relative to the listed directory
+type Listing struct {
+	Helpers []ListedHelper `json:"helpers"`
+	Markers []ListedMarker `json:"markers"`
+}
+
+// ListedHelper is one exported helper function
+type ListedHelper struct {
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Depth     int    `json:"depth"`
+}
+
+// ListedMarker is one marker of a user file, with the helpers its calls
+// resolve to
+type ListedMarker struct {
+	File   string       `json:"file"`
+	Line   int          `json:"line"`
+	Kind   string       `json:"kind"`
+	Marker string       `json:"marker"`
+	Calls  []ListedCall `json:"calls,omitempty"`
+	// Error is why the marker does not parse; it then has no calls
+	Error string `json:"error,omitempty"`
+}
+
+// ListedCall is one call of a marker, the head of a pipeline first. Helper
+// is "<file>:<line>" of the helper serving it, "package <name>" for a call
+// qualified by a package, or Unresolved.
+type ListedCall struct {
+	Func   string `json:"func"`
+	Helper string `json:"helper"`
+}
+
+// ListProject scans config.Dir without evaluating anything: it loads the
+// helpers as a run would and resolves the calls of every marker with them.
+// Submodules are not included; list them separately.
+func ListProject(config Config) (*Listing, error) {
+	if err := config.applyProjectSettings(); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config.compileMarkerSyntax()
+	absDir, err := filepath.Abs(config.Dir)
+	if err != nil {
+		absDir = config.Dir
+	}
+	ctx := &ProcessorContext{
+		FunctionsByDir:   make(map[string]map[string]*UserFunction),
+		FunctionsByDepth: make(map[int]map[string]*UserFunction),
+		RootDir:          absDir,
+		Log:              NewLogger(config.LogCategories),
+		FileSet:          token.NewFileSet(),
+		Config:           config,
+	}
+	fileProcessor := NewFileProcessor(ctx)
+	files, err := fileProcessor.CollectAllGoFiles(absDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect files: %v", err)
+	}
+	if err := fileProcessor.LoadUserFunctions(); err != nil {
+		return nil, fmt.Errorf("failed to load user functions: %v", err)
+	}
+	if len(ctx.BrokenHelpers) > 0 {
+		return nil, &HelperLoadError{Files: ctx.BrokenHelpers, root: absDir}
+	}
+	files = fileProcessor.FilterFilesWithMarkers(files)
+	if err := ctx.resolveSyntax(files); err != nil {
+		return nil, err
+	}
+
+	listing := &Listing{Helpers: []ListedHelper{}, Markers: []ListedMarker{}}
+	for _, funcs := range ctx.FunctionsByDir {
+		for _, fn := range funcs {
+			listing.Helpers = append(listing.Helpers, ListedHelper{
+				Name:      fn.Name,
+				Signature: fn.Signature(),
+				File:      ctx.relToRoot(fn.FilePath),
+				Line:      fn.Line,
+				Depth:     fn.Depth,
+			})
+		}
+	}
+	sort.Slice(listing.Helpers, func(i, j int) bool {
+		a, b := listing.Helpers[i], listing.Helpers[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+
+	sort.Strings(files)
+	for _, path := range files {
+		markers, err := listMarkers(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		listing.Markers = append(listing.Markers, markers...)
+	}
+	return listing, nil
+}
+
+// listMarkers returns the markers of the user file at path
+func listMarkers(ctx *ProcessorContext, path string) ([]ListedMarker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	sourceDir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		sourceDir = filepath.Dir(path)
+	}
+	resolve := func(fn, selector, name string) ListedCall {
+		call := ListedCall{Func: fn, Helper: Unresolved}
+		if selector != "" {
+			call.Helper = "package " + selector
+		} else if helper, _ := ctx.ResolveFunction(name, sourceDir); helper != nil {
+			call.Helper = fmt.Sprintf("%s:%d", ctx.relToRoot(helper.FilePath), helper.Line)
+		}
+		return call
+	}
+
+	var markers []ListedMarker
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		m, perr := ctx.MarkerSyntax().Parse(scanner.Text())
+		if m == nil {
+			continue
+		}
+		listed := ListedMarker{File: ctx.relToRoot(path), Line: line, Kind: m.Kind.String(), Marker: strings.TrimSpace(scanner.Text())}
+		if perr != nil {
+			listed.Error = perr.Error()
+			markers = append(markers, listed)
+			continue
+		}
+		name := m.Name
+		if name == "" {
+			name = m.Func
+		}
+		listed.Calls = []ListedCall{resolve(m.Func, m.Selector, name)}
+		for _, stage := range m.Pipeline {
+			listed.Calls = append(listed.Calls, resolve(stage.Func, stage.Selector, stage.Name))
+		}
+		markers = append(markers, listed)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return markers, nil
+}
+
+// Format renders the listing as two tables, helpers then markers
+func (l *Listing) Format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[goahead] %d helper(s):\n", len(l.Helpers))
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "  HELPER\tSIGNATURE\tLOCATION\tDEPTH")
+	for _, h := range l.Helpers {
+		_, _ = fmt.Fprintf(w, "  %s\t%s\t%s:%d\t%d\n", h.Name, h.Signature, h.File, h.Line, h.Depth)
+	}
+	_ = w.Flush()
+
+	fmt.Fprintf(&b, "[goahead] %d marker(s):\n", len(l.Markers))
+	w = tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "  LOCATION\tKIND\tMARKER\tHELPER")
+	for _, m := range l.Markers {
+		helper := m.Error
+		if m.Error == "" {
+			helpers := make([]string, len(m.Calls))
+			for i, call := range m.Calls {
+				helpers[i] = call.Helper
+			}
+			helper = strings.Join(helpers, " | ")
+		}
+		_, _ = fmt.Fprintf(w, "  %s:%d\t%s\t%s\t%s\n", m.File, m.Line, m.Kind, m.Marker, helper)
+	}
+	_ = w.Flush()
+	return b.String()
+}
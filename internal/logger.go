@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// LogCategory selects a family of verbose messages
+type LogCategory string
+
+const (
+	LogScan    LogCategory = "scan"    // directory walk, helper loading, timings
+	LogFilter  LogCategory = "filter"  // toolexec file detection and filtering
+	LogExec    LogCategory = "exec"    // evaluation program runs
+	LogReplace LogCategory = "replace" // placeholder replacement details
+	LogInject  LogCategory = "inject"  // function injection details
+	LogCache   LogCategory = "cache"   // executor cache hits
+)
+
+// LogCategories lists every category in display order
+var LogCategories = []LogCategory{LogScan, LogFilter, LogExec, LogReplace, LogInject, LogCache}
+
+// Logger writes category-tagged verbose messages to stderr.
+// A nil *Logger is valid and logs nothing.
+type Logger struct {
+	enabled map[LogCategory]bool
+}
+
+var unknownCategoryWarned sync.Once
+
+// NewLogger builds a logger from a GOAHEAD_VERBOSE style spec: "" or "0"
+// disables logging, "1", "true" or "all" enables every category, and a
+// comma-separated list such as "replace,inject" enables only those.
+func NewLogger(spec string) *Logger {
+	l := &Logger{enabled: make(map[LogCategory]bool)}
+	spec = strings.TrimSpace(spec)
+	switch strings.ToLower(spec) {
+	case "", "0", "false":
+		return l
+	case "1", "true", "all":
+		return l.withAll()
+	}
+
+	var unknown []string
+	for _, part := range strings.Split(spec, ",") {
+		cat := LogCategory(strings.ToLower(strings.TrimSpace(part)))
+		if cat == "" {
+			continue
+		}
+		if !isLogCategory(cat) {
+			unknown = append(unknown, string(cat))
+			continue
+		}
+		l.enabled[cat] = true
+	}
+	if len(unknown) > 0 {
+		unknownCategoryWarned.Do(func() {
+			names := make([]string, len(LogCategories))
+			for i, cat := range LogCategories {
+				names[i] = string(cat)
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "[goahead] WARNING: unknown GOAHEAD_VERBOSE categor(ies) %s (valid: %s)\n",
+				strings.Join(unknown, ", "), strings.Join(names, ", "))
+		})
+	}
+	return l
+}
+
+// NewLoggerFromEnv builds a logger from the GOAHEAD_VERBOSE environment variable
+func NewLoggerFromEnv() *Logger {
+	return NewLogger(os.Getenv("GOAHEAD_VERBOSE"))
+}
+
+func isLogCategory(cat LogCategory) bool {
+	for _, known := range LogCategories {
+		if cat == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Logger) withAll() *Logger {
+	all := &Logger{enabled: make(map[LogCategory]bool, len(LogCategories))}
+	for _, cat := range LogCategories {
+		all.enabled[cat] = true
+	}
+	return all
+}
+
+// OrAll returns a logger with every category enabled when force is true
+func (l *Logger) OrAll(force bool) *Logger {
+	if force {
+		return l.withAll()
+	}
+	return l
+}
+
+// Enabled reports whether messages of category cat are written
+func (l *Logger) Enabled(cat LogCategory) bool {
+	return l != nil && l.enabled[cat]
+}
+
+// All reports whether every category is enabled (the classic verbose mode)
+func (l *Logger) All() bool {
+	if l == nil {
+		return false
+	}
+	for _, cat := range LogCategories {
+		if !l.enabled[cat] {
+			return false
+		}
+	}
+	return true
+}
+
+// Any reports whether at least one category is enabled
+func (l *Logger) Any() bool {
+	return l != nil && len(l.enabled) > 0
+}
+
+// Logf writes a formatted message when cat is enabled; a trailing newline is added if missing
+func (l *Logger) Logf(cat LogCategory, format string, args ...any) {
+	if !l.Enabled(cat) {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	_, _ = fmt.Fprint(os.Stderr, msg)
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/AeonDave/goahead/marker"
+)
+
+var (
+	// declaredNamesPattern matches the names a line declares outside var
+	// blocks: "var a, b = ...", "const a = ..." or "a, b := ..."
+	declaredNamesPattern = regexp.MustCompile(`^\s*(?:(?:var|const)\s+(\w+(?:\s*,\s*\w+)*)|(\w+(?:\s*,\s*\w+)*)\s*:=)`)
+	// blockNamesPattern matches the names of a var or const block entry
+	blockNamesPattern = regexp.MustCompile(`^\s*(\w+(?:\s*,\s*\w+)*)(?:\s|=|$)`)
+)
+
+// targetedMarker returns the placeholder of the "> name" marker m read from
+// line at index; markers that cannot be evaluated are skipped
+func (cp *CodeProcessor) targetedMarker(filePath string, m *marker.Marker, parseErr error, line string, index int) (placeholder, bool) {
+	ph := placeholder{
+		lineIndex:    index,
+		funcName:     m.Func,
+		argsStr:      m.RawArgs,
+		marker:       strings.TrimSpace(line),
+		markerLine:   cp.fileLine(index),
+		markerColumn: strings.Index(line, "//") + 1,
+		pipeline:     m.Pipeline,
+		target:       m.Target,
+	}
+	location := cp.markerLocation(filePath, ph)
+	switch {
+	case errors.As(parseErr, new(*marker.ArgumentError)):
+	case parseErr != nil:
+		parseErr = outputMismatchf("%s: %v", location, parseErr)
+	case marker.UsesBelow(ph.argsStr):
+		parseErr = fmt.Errorf("%w: %s cannot be combined with a > %s target", errBlockArgument, marker.BelowArgument, ph.target)
+	}
+	if parseErr != nil {
+		cp.recordSkipped(filePath, ph, parseErr, fmt.Sprintf("%s: %v", location, parseErr))
+		return placeholder{}, false
+	}
+	return ph, true
+}
+
+// resolveTargets finds the target lines of "> name" markers once the whole
+// file is read: the declaration of name in the var block holding the marker,
+// then the first one further down the file. Markers whose name is declared
+// nowhere, or whose declaration is already the target of another marker, are
+// skipped. placeholders are those of the other markers; the result holds
+// both, in line order.
+func (cp *CodeProcessor) resolveTargets(filePath string, lines []string, placeholders, targeted []placeholder) []placeholder {
+	if len(targeted) == 0 {
+		return placeholders
+	}
+	// inBlock[i] is whether line i sits inside a var block
+	inBlock := make([]bool, len(lines)+1)
+	for i, line := range lines {
+		inBlock[i+1] = trackVarBlock(line, inBlock[i])
+	}
+	taken := make(map[int]placeholder)
+	for _, ph := range placeholders {
+		taken[ph.lineIndex] = ph
+	}
+
+	for _, ph := range targeted {
+		markerIndex := ph.lineIndex
+		index := -1
+		if inBlock[markerIndex] {
+			start, end := markerIndex, markerIndex
+			for start > 0 && inBlock[start] {
+				start--
+			}
+			for end < len(lines) && inBlock[end+1] {
+				end++
+			}
+			for i := start + 1; i <= end && index < 0; i++ {
+				if declaresName(lines[i], ph.target, true) {
+					index = i
+				}
+			}
+		}
+		for i := markerIndex + 1; i < len(lines) && index < 0; i++ {
+			if declaresName(lines[i], ph.target, inBlock[i]) {
+				index = i
+			}
+		}
+
+		location := cp.markerLocation(filePath, ph)
+		if index < 0 {
+			err := fmt.Errorf("no declaration of %s in the var block of the marker or below it", ph.target)
+			cp.recordSkipped(filePath, ph, fmt.Errorf("%w: %v", errNoTarget, err), fmt.Sprintf("%s: %v", location, err))
+			continue
+		}
+		if other, ok := taken[index]; ok {
+			err := fmt.Errorf("%w: %s and %s both replace line %d", errOverlappingMarkers, cp.markerLocation(filePath, other), location, cp.fileLine(index))
+			cp.recordSkipped(filePath, ph, err, fmt.Sprintf("%s: %v", location, err))
+			continue
+		}
+		ph.lineIndex, ph.inVarBlock = index, inBlock[index]
+		taken[index] = ph
+		placeholders = append(placeholders, ph)
+	}
+	sort.SliceStable(placeholders, func(i, j int) bool { return placeholders[i].lineIndex < placeholders[j].lineIndex })
+	return placeholders
+}
+
+// declaresName reports whether line declares name, as an entry of a var or
+// const block when inBlock is set
+func declaresName(line, name string, inBlock bool) bool {
+	var names string
+	if inBlock {
+		m := blockNamesPattern.FindStringSubmatch(line)
+		if m == nil {
+			return false
+		}
+		names = m[1]
+	} else {
+		m := declaredNamesPattern.FindStringSubmatch(line)
+		if m == nil {
+			return false
+		}
+		names = m[1] + m[2]
+	}
+	for _, declared := range strings.Split(names, ",") {
+		if strings.TrimSpace(declared) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// -out-link modes: how an -out tree holds the files of the source tree
+const (
+	OutLinkCopy    = "copy"
+	OutLinkHard    = "hard"
+	OutLinkSymlink = "symlink"
+)
+
+// OutManifestName lists, in an -out tree, the files mirrored into it, so a
+// later run can remove those the source tree no longer has. A directory
+// holding it is not a source tree of its own.
+const OutManifestName = ".goahead-out"
+
+// vcsDirs are left out of -out trees
+var vcsDirs = map[string]bool{".git": true, ".hg": true, ".svn": true}
+
+// mirrorTree makes out mirror the module holding dir for an -out run and
+// returns the directory of out that stands for dir. Files are copied,
+// hard-linked or symlinked according to link; rewrites replace a file
+// through a rename, so a linked file is never written through. The mirror
+// keeps the module's hierarchy, so helpers resolve as they would in place.
+func mirrorTree(dir, out, link string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %v", dir, err)
+	}
+	absOut, err := filepath.Abs(StripLongPathPrefix(out))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve -out %s: %v", out, err)
+	}
+	root := findModuleRoot(absDir)
+	if root == "" {
+		root = absDir
+	}
+	if PathWithin(root, absOut) {
+		return "", fmt.Errorf("-out %s must not contain the source tree %s", out, root)
+	}
+	previous, err := readOutManifest(absOut)
+	if err != nil {
+		return "", err
+	}
+
+	var mirrored []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (path == absOut || vcsDirs[name] || strings.HasPrefix(name, evalDirPrefix) || isOutTree(path)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		if strings.HasSuffix(name, LockSuffix) || isRewriteTemp(name) || name == IndexFileName {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if err := mirrorFile(path, filepath.Join(absOut, rel), link); err != nil {
+			return err
+		}
+		mirrored = append(mirrored, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to mirror %s into %s: %v", root, out, err)
+	}
+
+	current := make(map[string]bool, len(mirrored))
+	for _, rel := range mirrored {
+		current[rel] = true
+	}
+	for rel := range previous {
+		stale := filepath.Join(absOut, filepath.FromSlash(rel))
+		if current[rel] || !PathWithin(stale, absOut) {
+			continue
+		}
+		if err := os.Remove(stale); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to remove %s from -out: %v", rel, err)
+		}
+	}
+	sort.Strings(mirrored)
+	manifest := "# Files mirrored by goahead -out from " + filepath.ToSlash(root) + "\n" + strings.Join(mirrored, "\n") + "\n"
+	if err := writeFileAtomic(filepath.Join(absOut, OutManifestName), []byte(manifest)); err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, absDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(absOut, rel), nil
+}
+
+// mirroredPath returns the path in the mirror of dir, at mirrorDir, of the
+// file at path; path is returned unchanged when it cannot be resolved
+func mirroredPath(dir, mirrorDir, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return path
+	}
+	return filepath.Join(mirrorDir, rel)
+}
+
+// sourcePath returns path, in the Out mirror of a toolexec run, as the path
+// of the source it stands for, so that persistent cache keys and
+// GOAHEAD_PROJECT_ROOT are those of a run on the sources. Other paths, and
+// those of other runs, are returned unchanged.
+func (c Config) sourcePath(path string) string {
+	if c.sourceRoot == "" || !filepath.IsAbs(path) {
+		return path
+	}
+	out, err := filepath.Abs(StripLongPathPrefix(c.Out))
+	if err != nil || !PathWithin(path, out) {
+		return path
+	}
+	return mirroredPath(out, c.sourceRoot, path)
+}
+
+// shownPath returns how messages name the file at path: as its source,
+// relative to the working directory, when path is in the mirror of a
+// toolexec run
+func (c Config) shownPath(path string) string {
+	if c.sourceRoot == "" {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	source := c.sourcePath(abs)
+	if source == abs {
+		return path
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, source); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return source
+}
+
+// readOutManifest returns the files an earlier run mirrored into out. out
+// must be missing, empty or an -out tree, which keeps -out from deleting
+// files it did not write.
+func readOutManifest(out string) (map[string]bool, error) {
+	entries, err := os.ReadDir(out)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read -out %s: %v", out, err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, OutManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		if len(entries) > 0 {
+			return nil, fmt.Errorf("-out %s is not empty and has no %s; refusing to write into a directory goahead did not create", out, OutManifestName)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", OutManifestName, err)
+	}
+	files := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			files[line] = true
+		}
+	}
+	return files, nil
+}
+
+// mirrorFile replaces dst with src, or a link to it
+func mirrorFile(src, dst, link string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if err := os.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	switch link {
+	case OutLinkHard:
+		return os.Link(src, dst)
+	case OutLinkSymlink:
+		return os.Symlink(src, dst)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func(in *os.File) {
+		_ = in.Close()
+	}(in)
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	outFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(outFile, in)
+	if closeErr := outFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// isOutTree reports whether dir is the root of an -out tree
+func isOutTree(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, OutManifestName))
+	return err == nil
+}
@@ -0,0 +1,340 @@
+package internal
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/AeonDave/goahead/marker"
+)
+
+// AfterRewriteHook, when set, is called with the rewritten content of a file
+// before -paranoid checks it and returns the content to keep; tests use it
+// to simulate a rewriting bug
+var AfterRewriteHook func(filePath string, content []byte) []byte
+
+// stagedRewrites holds the files -paranoid checks before they are written:
+// while a file is staged, the passes that rewrite it read and write its
+// content here, so a rewrite that fails the check never reaches the disk
+type stagedRewrites struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (s *stagedRewrites) stage(filePath string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = make(map[string][]byte)
+	}
+	s.files[filePath] = content
+}
+
+func (s *stagedRewrites) drop(filePath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, filePath)
+}
+
+// readSource returns the content of filePath, the staged one when it is
+// staged
+func (ctx *ProcessorContext) readSource(filePath string) ([]byte, error) {
+	ctx.staged.mu.Lock()
+	content, ok := ctx.staged.files[filePath]
+	ctx.staged.mu.Unlock()
+	if ok {
+		return content, nil
+	}
+	return ctx.dry.readFile(filePath)
+}
+
+// writeSource replaces the content of filePath, only in memory when it is
+// staged
+func (ctx *ProcessorContext) writeSource(filePath string, content []byte) error {
+	ctx.staged.mu.Lock()
+	_, ok := ctx.staged.files[filePath]
+	if ok {
+		ctx.staged.files[filePath] = content
+	}
+	ctx.staged.mu.Unlock()
+	if ok {
+		return nil
+	}
+	return ctx.dry.writeFile(filePath, content)
+}
+
+// maxDivergences is how many differences a -paranoid error lists
+const maxDivergences = 5
+
+// verifyRewrite is the -paranoid check: outside the marker targets and the
+// injected block, before and after must hold the same declarations,
+// statements and comments. Added imports are allowed; tags and the markers
+// themselves are not compared. It returns the differences found, as
+// "line N: ..." against after.
+func (ctx *ProcessorContext) verifyRewrite(before, after []byte) []string {
+	b, err := parseForCheck(ctx.MarkerSyntax(), before)
+	if err != nil {
+		// Nothing to compare against; the rewrite is not to blame
+		return nil
+	}
+	a, err := parseForCheck(ctx.MarkerSyntax(), after)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	check := &rewriteCheck{before: b, after: a}
+	check.imports()
+	check.node(reflect.ValueOf(check.before.decls), reflect.ValueOf(check.after.decls), nil, nil)
+	check.comments()
+	return check.found
+}
+
+// checkedFile is one side of the comparison
+type checkedFile struct {
+	fset *token.FileSet
+	file *ast.File
+	// decls are the declarations other than imports
+	decls []ast.Decl
+	// targets are the lines a marker may rewrite
+	targets map[int]bool
+	// markers are the lines holding a marker comment
+	markers map[int]bool
+}
+
+// parseForCheck parses src with its injected block blanked out
+func parseForCheck(syntax *marker.Syntax, src []byte) (*checkedFile, error) {
+	_, text := splitBOM(string(src))
+	if start, end, found, err := findInjectedBlock(text); err != nil {
+		return nil, err
+	} else if found {
+		// Blank lines keep the line numbers of the file
+		text = text[:start] + strings.Repeat("\n", strings.Count(text[start:end], "\n")) + text[end:]
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", text, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("rewritten file does not parse: %v", err)
+	}
+	checked := &checkedFile{fset: fset, file: file, targets: map[int]bool{}, markers: map[int]bool{}}
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			continue
+		}
+		checked.decls = append(checked.decls, decl)
+	}
+
+	// A marker targets the first code line below it, and a whole block
+	// opened on that line
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		m, _ := syntax.Parse(lines[i])
+		if m == nil || m.Kind != marker.KindPlaceholder {
+			continue
+		}
+		checked.markers[i+1] = true
+		j := i + 1
+		for j < len(lines) {
+			trimmed := strings.TrimSpace(lines[j])
+			if next, _ := syntax.Parse(lines[j]); next != nil {
+				checked.markers[j+1] = true
+			} else if strings.HasPrefix(trimmed, "/*") && marker.UsesBelow(m.RawArgs) {
+				// The @below argument block belongs to the marker
+				for ; j < len(lines) && !strings.Contains(lines[j], "*/"); j++ {
+					checked.markers[j+1] = true
+				}
+				checked.markers[j+1] = true
+			} else if trimmed != "" {
+				break
+			}
+			j++
+		}
+		if j == len(lines) {
+			break
+		}
+		checked.targets[j+1] = true
+		if strings.HasSuffix(strings.TrimSpace(lines[j]), "(") {
+			for j++; j < len(lines) && strings.TrimSpace(lines[j]) != ")"; j++ {
+				checked.targets[j+1] = true
+			}
+		}
+		i = j
+	}
+	return checked, nil
+}
+
+// inTargets reports whether n lies on target lines only
+func (f *checkedFile) inTargets(n ast.Node) bool {
+	for line := f.line(n.Pos()); line <= f.line(n.End()-1); line++ {
+		if !f.targets[line] {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *checkedFile) line(pos token.Pos) int {
+	return f.fset.Position(pos).Line
+}
+
+// rewriteCheck collects the differences between two files
+type rewriteCheck struct {
+	before, after *checkedFile
+	found         []string
+}
+
+func (c *rewriteCheck) report(line int, format string, args ...any) {
+	if len(c.found) < maxDivergences {
+		c.found = append(c.found, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+	}
+}
+
+var (
+	posType          = reflect.TypeOf(token.NoPos)
+	commentGroupType = reflect.TypeOf(&ast.CommentGroup{})
+	objectType       = reflect.TypeOf(&ast.Object{})
+	scopeType        = reflect.TypeOf(&ast.Scope{})
+	nodeType         = reflect.TypeOf((*ast.Node)(nil)).Elem()
+)
+
+// node compares two values of the syntax tree. bn and an are the closest
+// enclosing nodes, whose lines are reported.
+func (c *rewriteCheck) node(b, a reflect.Value, bn, an ast.Node) {
+	if b.Type() != a.Type() {
+		c.diverge(bn, an, "%s became %s", describe(b), describe(a))
+		return
+	}
+	switch b.Type() {
+	case posType, commentGroupType, objectType, scopeType:
+		return
+	}
+	if b.Type().Implements(nodeType) && !isNil(b) && !isNil(a) {
+		bNode, aNode := b.Interface().(ast.Node), a.Interface().(ast.Node)
+		// Whatever a marker wrote over its target is expected to differ
+		if c.before.inTargets(bNode) && c.after.inTargets(aNode) {
+			return
+		}
+		bn, an = bNode, aNode
+	}
+	switch b.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if isNil(b) || isNil(a) {
+			if isNil(b) != isNil(a) {
+				c.diverge(bn, an, "%s became %s", describe(b), describe(a))
+			}
+			return
+		}
+		c.node(b.Elem(), a.Elem(), bn, an)
+	case reflect.Struct:
+		for i := 0; i < b.NumField(); i++ {
+			c.node(b.Field(i), a.Field(i), bn, an)
+		}
+	case reflect.Slice:
+		if b.Len() != a.Len() {
+			c.diverge(bn, an, "%d %s became %d", b.Len(), elementName(b), a.Len())
+			return
+		}
+		for i := 0; i < b.Len(); i++ {
+			c.node(b.Index(i), a.Index(i), bn, an)
+		}
+	default:
+		if b.Interface() != a.Interface() {
+			c.diverge(bn, an, "%v became %v", b.Interface(), a.Interface())
+		}
+	}
+}
+
+func (c *rewriteCheck) diverge(bn, an ast.Node, format string, args ...any) {
+	if an == nil {
+		c.report(1, format, args...)
+		return
+	}
+	c.report(c.after.line(an.Pos()), "%s (line %d before): %s", nodeName(an), c.before.line(bn.Pos()), fmt.Sprintf(format, args...))
+}
+
+// imports reports imports removed or changed by the rewrite
+func (c *rewriteCheck) imports() {
+	after := make(map[string]bool)
+	for _, spec := range c.after.file.Imports {
+		after[importKey(spec)] = true
+	}
+	for _, spec := range c.before.file.Imports {
+		if !after[importKey(spec)] {
+			c.report(c.before.line(spec.Pos()), "import %s was removed (line number before the rewrite)", importKey(spec))
+		}
+	}
+}
+
+func importKey(spec *ast.ImportSpec) string {
+	path, _ := strconv.Unquote(spec.Path.Value)
+	if spec.Name != nil {
+		return spec.Name.Name + " " + strconv.Quote(path)
+	}
+	return strconv.Quote(path)
+}
+
+// comments compares the comments that are neither markers nor on a target
+// line, where tags live; their layout does not matter
+func (c *rewriteCheck) comments() {
+	type comment struct {
+		line int
+		text string
+	}
+	collect := func(f *checkedFile) []comment {
+		var list []comment
+		for _, group := range f.file.Comments {
+			for _, cm := range group.List {
+				line := f.line(cm.Pos())
+				if f.markers[line] || f.targets[line] {
+					continue
+				}
+				list = append(list, comment{line, strings.Join(strings.Fields(cm.Text), " ")})
+			}
+		}
+		return list
+	}
+	before, after := collect(c.before), collect(c.after)
+	for i := 0; i < len(before) || i < len(after); i++ {
+		switch {
+		case i >= len(after):
+			c.report(c.after.line(c.after.file.End()), "comment %q (line %d before) was removed", before[i].text, before[i].line)
+		case i >= len(before):
+			c.report(after[i].line, "comment %q was added", after[i].text)
+		case before[i].text != after[i].text:
+			c.report(after[i].line, "comment %q (line %d before) became %q", before[i].text, before[i].line, after[i].text)
+		default:
+			continue
+		}
+		return
+	}
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map:
+		return v.IsNil()
+	}
+	return false
+}
+
+func describe(v reflect.Value) string {
+	if isNil(v) {
+		return "nothing"
+	}
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	return strings.TrimPrefix(v.Type().String(), "*ast.")
+}
+
+func elementName(v reflect.Value) string {
+	name := strings.TrimPrefix(strings.TrimPrefix(v.Type().Elem().String(), "*"), "ast.")
+	return strings.ToLower(name) + "s"
+}
+
+func nodeName(n ast.Node) string {
+	return strings.TrimPrefix(reflect.TypeOf(n).String(), "*ast.")
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"path"
+	"strings"
+)
+
+// Windows checkouts may be reached through a long path (\\?\C:\src\...) or
+// a UNC share (\\server\share\...). The functions below strip the long-path
+// prefix at the boundaries where paths enter goahead (the directory to
+// process, the working directory, files passed by the compiler) and compare
+// paths as strings, with either separator, so they behave the same on every
+// OS. The os package adds the prefix back by itself for paths too long for
+// the Windows API.
+
+const (
+	longPathPrefix    = `\\?\`
+	longUNCPathPrefix = `\\?\UNC\`
+)
+
+// StripLongPathPrefix removes the \\?\ prefix of a Windows long path:
+// \\?\C:\src becomes C:\src and \\?\UNC\server\share\src becomes
+// \\server\share\src. Other paths are returned unchanged.
+func StripLongPathPrefix(p string) string {
+	switch {
+	case len(p) >= len(longUNCPathPrefix) && strings.EqualFold(p[:len(longUNCPathPrefix)], longUNCPathPrefix):
+		return `\\` + p[len(longUNCPathPrefix):]
+	case strings.HasPrefix(p, longPathPrefix):
+		return p[len(longPathPrefix):]
+	}
+	return p
+}
+
+// slashPath returns p without a long-path prefix, with forward slashes and
+// cleaned, keeping the volume: a drive ("C:") or a UNC share
+// ("//server/share")
+func slashPath(p string) string {
+	p = strings.ReplaceAll(StripLongPathPrefix(p), `\`, "/")
+	volume := pathVolume(p)
+	rest := p[len(volume):]
+	switch {
+	case rest == "" && strings.HasPrefix(volume, "//"):
+		// A share is always rooted
+		rest = "/"
+	case rest == "" && volume != "":
+		return volume
+	}
+	return volume + path.Clean(rest)
+}
+
+// pathVolume returns the drive or UNC share that starts the slash path p,
+// "" when there is none
+func pathVolume(p string) string {
+	if len(p) >= 2 && p[1] == ':' && ('a' <= p[0]|0x20 && p[0]|0x20 <= 'z') {
+		return p[:2]
+	}
+	if strings.HasPrefix(p, "//") && !strings.HasPrefix(p, "///") {
+		parts := strings.SplitN(p[2:], "/", 3)
+		if len(parts) >= 2 && parts[0] != "" && parts[1] != "" {
+			return "//" + parts[0] + "/" + parts[1]
+		}
+	}
+	return ""
+}
+
+// PathWithin reports whether p is dir or lies under it. Both may use either
+// separator and a long-path prefix; Windows paths (with a drive or a UNC
+// share) are compared case-insensitively.
+func PathWithin(p, dir string) bool {
+	p, dir = slashPath(p), slashPath(dir)
+	if pathVolume(p) != "" || pathVolume(dir) != "" {
+		p, dir = strings.ToLower(p), strings.ToLower(dir)
+	}
+	if p == dir || dir == "." && !isRootedSlashPath(p) {
+		return true
+	}
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	return strings.HasPrefix(p, dir)
+}
+
+// isRootedSlashPath reports whether the slash path p is absolute, or starts
+// at the root of its drive
+func isRootedSlashPath(p string) bool {
+	return strings.HasPrefix(p[len(pathVolume(p)):], "/")
+}
+
+// parentSlashPath is path.Dir for slash paths that may start with a volume;
+// the parent of a volume's root is the root itself
+func parentSlashPath(p string) string {
+	volume := pathVolume(p)
+	dir := path.Dir(p[len(volume):])
+	if volume != "" && dir == "." && !strings.HasPrefix(p[len(volume):], "/") {
+		return volume
+	}
+	return volume + dir
+}
+
+// nativePath converts the slash path p back to the separator used by like
+func nativePath(p, like string) string {
+	if strings.Contains(StripLongPathPrefix(like), `\`) {
+		return strings.ReplaceAll(p, "/", `\`)
+	}
+	return p
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExpandPackagePatterns resolves Go package patterns (./..., ./cmd/...,
+// import paths inside the module) relative to dir into the absolute
+// directories of the matched packages. It asks `go list -find` through
+// runner (the go binary when nil) and falls back to walking the file system
+// when the go command fails, for example outside a module or without a
+// toolchain. Like go build, patterns never cross into nested modules.
+func ExpandPackagePatterns(runner Runner, dir string, patterns []string) ([]string, error) {
+	if runner == nil {
+		runner = goRunner{}
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		absDir = dir
+	}
+
+	args := append([]string{"list", "-e", "-find", "-f", "{{.Dir}}"}, patterns...)
+	stdout, _, err := runner.Run(absDir, sanitizeGoEnv(os.Environ()), args...)
+	if err != nil {
+		return walkPackagePatterns(absDir, patterns)
+	}
+
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, line := range strings.Split(stdout, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !seen[line] {
+			seen[line] = true
+			dirs = append(dirs, filepath.Clean(line))
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// walkPackagePatterns is the file system fallback of ExpandPackagePatterns:
+// a package directory holds at least one .go file that is not excluded from
+// builds, and "..." walks skip testdata, vendor and directories starting
+// with "." or "_", as the go command does
+func walkPackagePatterns(absDir string, patterns []string) ([]string, error) {
+	modulePath := readModulePath(filepath.Join(absDir, "go.mod"))
+
+	seen := make(map[string]bool)
+	var dirs []string
+	add := func(dir string) {
+		if !seen[dir] && isPackageDir(dir) {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, pattern := range patterns {
+		rel := filepath.ToSlash(pattern)
+		if modulePath != "" && (rel == modulePath || strings.HasPrefix(rel, modulePath+"/")) {
+			rel = "." + strings.TrimPrefix(rel, modulePath)
+		}
+		base, recursive := strings.CutSuffix(rel, "/...")
+		if rel == "..." {
+			base, recursive = ".", true
+		}
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(absDir, base)
+		}
+		base = filepath.Clean(base)
+		if info, err := os.Stat(base); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("package pattern %q does not name a directory in %s", pattern, absDir)
+		}
+
+		if !recursive {
+			add(base)
+			continue
+		}
+		err := filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			if path != base {
+				name := d.Name()
+				if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor" {
+					return filepath.SkipDir
+				}
+				if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			add(path)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand package pattern %q: %v", pattern, err)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+func isPackageDir(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") && !hasExcludeConstraint(filepath.Join(dir, entry.Name())) {
+			return true
+		}
+	}
+	return false
+}
+
+// readModulePath returns the module path declared in goMod, or ""
+func readModulePath(goMod string) string {
+	file, err := os.Open(goMod)
+	if err != nil {
+		return ""
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "module "); ok {
+			return strings.Trim(strings.TrimSpace(path), `"`)
+		}
+	}
+	return ""
+}
+
+// processesDir reports whether the non-helper files of dir are processed
+func (ctx *ProcessorContext) processesDir(dir string) bool {
+	_, process := ctx.patternScope(dir)
+	return process
+}
+
+// patternScope reports whether the walk must enter dir and whether its
+// files are processed: matched package directories are processed, their
+// ancestors are entered for helper files only, and everything else is
+// skipped. Without patterns every directory is processed.
+func (ctx *ProcessorContext) patternScope(dir string) (enter, process bool) {
+	if ctx.Config.packageDirs == nil {
+		return true, true
+	}
+	if ctx.Config.packageDirs[dir] {
+		return true, true
+	}
+	for pkgDir := range ctx.Config.packageDirs {
+		if PathWithin(pkgDir, dir) {
+			return true, false
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pinnedImport is a //go:ahead import directive that pins the module of its
+// package, as in uuid=github.com/google/uuid@v1.6.0
+type pinnedImport struct {
+	Alias string
+	ImportAlias
+}
+
+// directive renders p as written, for messages
+func (p pinnedImport) directive() string {
+	return fmt.Sprintf("%s import %s=%s", DirectivePrefix, p.Alias, p.ImportAlias)
+}
+
+// addPin appends pin to pins unless its path and version are already there
+func addPin(pins []pinnedImport, pin *pinnedImport) []pinnedImport {
+	if pin == nil {
+		return pins
+	}
+	for _, p := range pins {
+		if p.String() == pin.String() {
+			return pins
+		}
+	}
+	return append(pins, *pin)
+}
+
+// pinnedModule is the go.mod evaluation programs importing pinned packages
+// are run with: the go.mod of the module, or an empty one outside a module,
+// with the pinned versions required
+type pinnedModule struct {
+	// modFile is passed as -modfile when the program runs inside the
+	// module; outside a module the program runs from dir instead
+	modFile string
+	dir     string
+	err     error
+}
+
+// pinnedModuleFor returns the go.mod requiring pins for programs run from
+// projectRoot. It is written once per root and set of pins, in the run's
+// temp dir, so the go.mod and go.sum of the module are never touched.
+func (fe *FunctionExecutor) pinnedModuleFor(projectRoot string, pins []pinnedImport) pinnedModule {
+	specs := make([]string, len(pins))
+	for i, pin := range pins {
+		specs[i] = pin.String()
+	}
+	sort.Strings(specs)
+	key := projectRoot + "|" + strings.Join(specs, ",")
+
+	fe.mu.Lock()
+	mod, ok := fe.pinnedMods[key]
+	fe.mu.Unlock()
+	if ok {
+		return mod
+	}
+	mod, _ = fe.pinFlights.do(key, func() pinnedModule {
+		fe.mu.Lock()
+		mod, ok := fe.pinnedMods[key]
+		fe.mu.Unlock()
+		if !ok {
+			mod = fe.writePinnedModule(projectRoot, pins)
+			fe.mu.Lock()
+			fe.pinnedMods[key] = mod
+			fe.mu.Unlock()
+		}
+		return mod
+	})
+	return mod
+}
+
+func (fe *FunctionExecutor) writePinnedModule(projectRoot string, pins []pinnedImport) pinnedModule {
+	dir, err := os.MkdirTemp(fe.ctx.TempDir, "pinned-*")
+	if err != nil {
+		return pinnedModule{err: fmt.Errorf("failed to create the go.mod of pinned imports: %v", err)}
+	}
+	mod := pinnedModule{dir: dir}
+	modFile := filepath.Join(dir, "go.mod")
+	inModule := fileExists(filepath.Join(projectRoot, "go.mod"))
+	if inModule {
+		// The go.sum next to -modfile is the one the go command reads
+		for _, name := range []string{"go.mod", "go.sum"} {
+			data, err := os.ReadFile(filepath.Join(projectRoot, name))
+			if err != nil && name == "go.mod" {
+				return pinnedModule{err: fmt.Errorf("failed to read %s: %v", filepath.Join(projectRoot, name), err)}
+			}
+			if err == nil {
+				if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+					return pinnedModule{err: fmt.Errorf("failed to write the go.mod of pinned imports: %v", err)}
+				}
+			}
+		}
+		mod.modFile = modFile
+	} else if err := os.WriteFile(modFile, []byte("module goahead.eval\n\ngo 1.22\n"), 0o644); err != nil {
+		return pinnedModule{err: fmt.Errorf("failed to write the go.mod of pinned imports: %v", err)}
+	}
+
+	cwd, args := dir, []string{"get"}
+	if inModule {
+		cwd, args = projectRoot, append(args, "-modfile="+modFile)
+	}
+	env := sanitizeGoEnv(os.Environ())
+	if fe.ctx.Config.Offline {
+		env = append(env, "GOPROXY=off")
+	}
+	for _, pin := range pins {
+		fe.ctx.Logger().Logf(LogExec, "[goahead] Requiring %s for %s", pin.ImportAlias, pin.directive())
+		if _, stderr, err := fe.runner.Run(cwd, env, append(args, pin.String())...); err != nil {
+			return pinnedModule{err: fmt.Errorf("%s:%d: %s: go get %s failed: %v\n%s%s",
+				fe.ctx.relToRoot(pin.File), pin.Line, pin.directive(), pin, err, stderr, explainDependencyFailure(stderr))}
+		}
+	}
+	return mod
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package internal
+
+import "os/exec"
+
+// setProcessGroup is a no-op: without process groups only the go command
+// itself can be stopped
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// interruptProcessGroup kills the go command; interrupts cannot be sent to
+// other processes here
+func interruptProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProjectFileName is the project settings file read from the module root
+const ProjectFileName = ".goahead.toml"
+
+// projectValue is one "key = value" of the project file
+type projectValue struct {
+	// Kind is "string", "int", "float", "bool" or "array"
+	Kind string
+	// Value is the decoded value; Raw is the text after "="
+	Value string
+	Raw   string
+	Line  int
+	// List holds the strings of an array, the only kind of array accepted
+	List []string
+}
+
+// projectFile is the parsed project file: keys before the first section
+// header, then one key table per "[section]"
+type projectFile struct {
+	Path     string
+	Keys     map[string]projectValue
+	Sections map[string]map[string]projectValue
+}
+
+var (
+	projectKeyPattern     = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	projectSectionPattern = regexp.MustCompile(`^\[\s*([A-Za-z0-9_-]+(?:\.[A-Za-z0-9_-]+)*)\s*\]$`)
+)
+
+// readProjectFile parses the project file of root; it returns nil without
+// error when there is none. Only the TOML subset goahead needs is accepted:
+// comments, [section] headers and key = string, integer, float, bool or a
+// one-line array of strings.
+func readProjectFile(root string) (*projectFile, error) {
+	path := filepath.Join(root, ProjectFileName)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	file := &projectFile{Path: path, Keys: map[string]projectValue{}, Sections: map[string]map[string]projectValue{}}
+	keys := file.Keys
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(stripProjectComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if m := projectSectionPattern.FindStringSubmatch(line); m != nil {
+			if _, ok := file.Sections[m[1]]; ok {
+				return nil, fmt.Errorf("%s:%d: section [%s] is defined twice", path, lineNo, m[1])
+			}
+			keys = map[string]projectValue{}
+			file.Sections[m[1]] = keys
+			continue
+		}
+		key, raw, ok := strings.Cut(line, "=")
+		key, raw = strings.TrimSpace(key), strings.TrimSpace(raw)
+		if !ok || !projectKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("%s:%d: expected key = value or [section], got %q", path, lineNo, line)
+		}
+		if _, dup := keys[key]; dup {
+			return nil, fmt.Errorf("%s:%d: key %s is defined twice", path, lineNo, key)
+		}
+		value, err := parseProjectValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %v", path, lineNo, key, err)
+		}
+		value.Line = lineNo
+		keys[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return file, nil
+}
+
+// key returns the top-level key name of f, which may be nil
+func (f *projectFile) key(name string) (projectValue, bool) {
+	if f == nil {
+		return projectValue{}, false
+	}
+	v, ok := f.Keys[name]
+	return v, ok
+}
+
+// stripProjectComment drops a "#" comment that is not inside a string
+func stripProjectComment(line string) string {
+	var quote rune
+	escape := false
+	for i, r := range line {
+		switch {
+		case escape:
+			escape = false
+		case quote == '"' && r == '\\':
+			escape = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseProjectValue(raw string) (projectValue, error) {
+	switch {
+	case raw == "":
+		return projectValue{}, errors.New("missing value")
+	case strings.HasPrefix(raw, `"`):
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return projectValue{}, fmt.Errorf("invalid string %s", raw)
+		}
+		return projectValue{Kind: "string", Value: s, Raw: raw}, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") || strings.Contains(raw[1:len(raw)-1], "'") {
+			return projectValue{}, fmt.Errorf("invalid string %s", raw)
+		}
+		return projectValue{Kind: "string", Value: raw[1 : len(raw)-1], Raw: raw}, nil
+	case raw == "true" || raw == "false":
+		return projectValue{Kind: "bool", Value: raw, Raw: raw}, nil
+	case strings.HasPrefix(raw, "["):
+		list, err := parseProjectArray(raw)
+		if err != nil {
+			return projectValue{}, err
+		}
+		return projectValue{Kind: "array", Raw: raw, List: list}, nil
+	}
+	if !strings.ContainsAny(raw[:1], "+-.0123456789") {
+		return projectValue{}, fmt.Errorf("unsupported value %s (expected a string, number or bool)", raw)
+	}
+	if _, err := strconv.ParseInt(raw, 0, 64); err == nil {
+		return projectValue{Kind: "int", Value: raw, Raw: raw}, nil
+	}
+	if _, err := strconv.ParseFloat(raw, 64); err == nil {
+		return projectValue{Kind: "float", Value: raw, Raw: raw}, nil
+	}
+	return projectValue{}, fmt.Errorf("unsupported value %s (expected a string, number or bool)", raw)
+}
+
+// parseProjectArray decodes a one-line array of strings such as
+// ["gen/**", 'vendor/'], a trailing comma allowed
+func parseProjectArray(raw string) ([]string, error) {
+	if !strings.HasSuffix(raw, "]") {
+		return nil, fmt.Errorf("invalid array %s (arrays must end on the line they start)", raw)
+	}
+	list := []string{}
+	rest := strings.TrimSpace(raw[1 : len(raw)-1])
+	for rest != "" {
+		end := len(rest)
+		var quote rune
+		escape := false
+		for i, r := range rest {
+			switch {
+			case escape:
+				escape = false
+			case quote == '"' && r == '\\':
+				escape = true
+			case quote != 0:
+				if r == quote {
+					quote = 0
+				}
+			case r == '"' || r == '\'':
+				quote = r
+			case r == ',':
+				end = i
+			}
+			if end != len(rest) {
+				break
+			}
+		}
+		item := strings.TrimSpace(rest[:end])
+		value, err := parseProjectValue(item)
+		if err != nil || value.Kind != "string" {
+			return nil, fmt.Errorf("invalid array %s (expected strings, got %s)", raw, item)
+		}
+		list = append(list, value.Value)
+		if end == len(rest) {
+			break
+		}
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+	return list, nil
+}
@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AeonDave/goahead/internal/artifact"
+)
+
+// ResultCacheEnv names the directory of the persistent result cache; "off"
+// disables it. It takes precedence over Config.CacheDir; by default the cache
+// is the goahead directory of the Go build cache (go env GOCACHE).
+const ResultCacheEnv = "GOAHEAD_CACHE"
+
+// resultCache keeps the results of helper calls across runs, one file per
+// result. Keys cover the call, the content of the helper files and module
+// files the run loaded (see FunctionExecutor.persistentKey), the Go toolchain
+// version and the -freeze-time and -env settings, so editing a helper or
+// upgrading Go invalidates results without any bookkeeping.
+type resultCache struct {
+	once sync.Once
+	dir  string
+	salt string
+	// err is why the cache could not be located; the run goes on without it
+	err error
+
+	config Config
+}
+
+// newResultCache returns nil when results are not persisted: with -no-cache,
+// with GOAHEAD_CACHE=off or a CacheDir of "off", with -trace-dir, whose traces would miss the
+// programs of cached results, and for runs with a custom Runner, which does
+// not run the go command that results would be cached for. The cache is
+// located on first use.
+func newResultCache(config Config) *resultCache {
+	if config.NoCache || config.TraceDir != "" || config.Runner != nil || cacheSetting(config) == "off" {
+		return nil
+	}
+	return &resultCache{config: config}
+}
+
+// locate finds the cache directory and the toolchain version once
+func (c *resultCache) locate() error {
+	c.once.Do(func() {
+		var version string
+		c.dir, version, c.err = resultCacheLocation(c.config.Dir, cacheSetting(c.config))
+		if c.err == nil && c.dir == "" {
+			c.err = errors.New("GOCACHE is off")
+		}
+		salt := []string{"go=" + version, "freeze-time=" + c.config.FreezeTime, fmt.Sprintf("env-isolate=%t", c.config.EnvIsolate)}
+		for _, kv := range c.config.Env {
+			salt = append(salt, "env="+kv)
+		}
+		c.salt = strings.Join(salt, "\x00")
+	})
+	return c.err
+}
+
+// cacheSetting returns the cache directory asked for, GOAHEAD_CACHE then
+// config.CacheDir, "" for the default
+func cacheSetting(config Config) string {
+	if dir := os.Getenv(ResultCacheEnv); dir != "" {
+		return dir
+	}
+	return config.CacheDir
+}
+
+// resultCacheLocation returns the directory of the persistent result cache,
+// setting unless it is empty, and the version of the go command selected in
+// dir; the directory is "" when GOCACHE is off
+func resultCacheLocation(dir, setting string) (cacheDir, version string, err error) {
+	stdout, stderr, err := (goRunner{}).Run(dir, os.Environ(), "env", "GOVERSION", "GOCACHE")
+	if err != nil {
+		return "", "", fmt.Errorf("go env failed: %v\n%s", err, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(stdout, "\r\n", "\n")), "\n")
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("unexpected go env output %q", stdout)
+	}
+	version = lines[0]
+	if setting != "" {
+		cacheDir, err = filepath.Abs(setting)
+		return cacheDir, version, err
+	}
+	if lines[1] == "" || lines[1] == "off" {
+		return "", version, nil
+	}
+	return filepath.Join(lines[1], "goahead"), version, nil
+}
+
+// path returns the file of the result stored under key
+func (c *resultCache) path(key string) string {
+	sum := sha256.Sum256([]byte(c.salt + "\x00" + key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// get returns the result stored under key. Unreadable entries are misses.
+func (c *resultCache) get(key string) (string, bool) {
+	if c.locate() != nil {
+		return "", false
+	}
+	var entry artifact.CacheEntry
+	if err := artifact.Read(c.path(key), &entry); err != nil {
+		return "", false
+	}
+	return entry.Result, true
+}
+
+// put stores result under key; concurrent runs writing the same entry
+// write the same content
+func (c *resultCache) put(key, result string) error {
+	if err := c.locate(); err != nil {
+		return err
+	}
+	data, err := artifact.Encode(&artifact.CacheEntry{Result: result})
+	if err != nil {
+		return err
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create the result cache: %v", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// CleanResultCache removes the persistent result cache of the module in the
+// working directory, its cache-dir setting included, and returns its
+// directory, "" when there is none
+func CleanResultCache() (string, error) {
+	config := Config{Dir: "."}
+	if err := config.applyProjectSettings(); err != nil {
+		return "", environmentErrorf("%v", err)
+	}
+	setting := cacheSetting(config)
+	if setting == "off" {
+		return "", nil
+	}
+	dir, _, err := resultCacheLocation(".", setting)
+	if err != nil {
+		return "", environmentErrorf("cannot locate the result cache: %v", err)
+	}
+	if dir == "" {
+		return "", nil
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", environmentErrorf("failed to remove %s: %v", dir, err)
+	}
+	return dir, nil
+}
+
+// persistentKey returns key qualified by the hash of the helper files the
+// run loaded, those of enclosing modules included, of the module packages
+// they import, and of the go.mod and go.sum of the module, which pin the
+// other packages helpers import. Paths in the
+// mirror of a toolexec run are those of the sources, which share its results.
+func (fe *FunctionExecutor) persistentKey(key string) string {
+	fe.helpersOnce.Do(func() {
+		files := append([]string(nil), fe.ctx.FuncFiles...)
+		for _, fn := range fe.ctx.ParentHelpers {
+			files = append(files, fn.FilePath)
+		}
+		if root := findModuleRoot(fe.ctx.RootDir); root != "" {
+			files = append(files, modulePackageSources(root, readModulePath(filepath.Join(root, "go.mod")), files)...)
+			files = append(files, filepath.Join(root, "go.mod"), filepath.Join(root, "go.sum"))
+		}
+		sort.Strings(files)
+		var buf bytes.Buffer
+		for i, file := range files {
+			if i > 0 && file == files[i-1] {
+				continue
+			}
+			buf.WriteString(fe.ctx.Config.sourcePath(file) + "\x00")
+			if data, err := os.ReadFile(file); err == nil {
+				buf.Write(data)
+			}
+			buf.WriteString("\x00")
+		}
+		fe.helpersHash = hashBytes(buf.Bytes())
+	})
+	// Keys of calls start with the directory of their source file
+	if dir, rest, ok := strings.Cut(key, "|"); ok {
+		key = fe.ctx.Config.sourcePath(dir) + "|" + rest
+	}
+	return fe.helpersHash + "\x00" + key
+}
+
+// persistedResult looks up a result of an earlier run, keeping it in the
+// executor cache on a hit
+func (fe *FunctionExecutor) persistedResult(target callTarget, key string) (string, bool) {
+	if fe.ctx.results == nil || noCache(target) || fe.ctx.results.locate() != nil {
+		return "", false
+	}
+	result, ok := fe.ctx.results.get(fe.persistentKey(key))
+	fe.ctx.Stats.add(func(s *RunStats) {
+		if ok {
+			s.ResultCacheHits++
+		} else {
+			s.ResultCacheMisses++
+		}
+	})
+	if ok {
+		fe.storeResult(target, key, result)
+	}
+	return result, ok
+}
+
+// persistResult stores a result for later runs; failures only cost the
+// next run an evaluation
+func (fe *FunctionExecutor) persistResult(target callTarget, key, result string) {
+	if fe.ctx.results == nil || noCache(target) {
+		return
+	}
+	if err := fe.ctx.results.put(fe.persistentKey(key), result); err != nil {
+		fe.ctx.Logger().Logf(LogCache, "[goahead] Result cache not written: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Runner runs the go command for the executor: `go run` for evaluation
+// programs and `go list std` for standard library resolution. Runners
+// shared by an executor that is used from several goroutines must be safe
+// for concurrent use.
+type Runner interface {
+	// Run executes go with args in dir and returns its standard output and
+	// standard error. For `go run`, the last argument is the program file.
+	Run(dir string, env []string, args ...string) (stdout, stderr string, err error)
+}
+
+// goRunner runs the go binary found in PATH. Once interrupt is done, a
+// running command and the program it started get an interrupt and
+// InterruptGrace to exit before they are killed; so do commands running
+// longer than timeout, when set.
+type goRunner struct {
+	interrupt context.Context
+	timeout   time.Duration
+}
+
+func (r goRunner) Run(dir string, env []string, args ...string) (string, string, error) {
+	ctx := r.interrupt
+	if r.timeout > 0 {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	cmd := exec.Command("go", args...)
+	if ctx != nil {
+		cmd = exec.CommandContext(ctx, "go", args...)
+		setProcessGroup(cmd)
+		cmd.Cancel = func() error { return interruptProcessGroup(cmd) }
+		cmd.WaitDelay = InterruptGrace
+	}
+	cmd.Dir = dir
+	cmd.Env = env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx != nil && ctx.Err() != nil && cmd.Process != nil {
+		killProcessGroup(cmd)
+	}
+	if r.timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("go %s did not finish within -exec-timeout %v", args[0], r.timeout)
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		err = environmentErrorf("the go toolchain is required to evaluate helpers: %v", err)
+	}
+	return stdout.String(), stderr.String(), err
+}
@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// settingsSection is the project file section holding run options, which
+// reach toolexec runs that take no flags
+const settingsSection = "settings"
+
+// Keys of the [settings] section, named after the flags they stand for; see
+// settingKey for their underscore spellings
+const (
+	settingStrict       = "strict"
+	settingExclude      = "exclude"
+	settingMarkerPrefix = "marker-prefix"
+	settingHelperDirs   = "helper-dirs"
+	settingHelperDepth  = "helper-depth"
+	settingCacheDir     = "cache-dir"
+	settingVerbose      = "verbose"
+)
+
+var settingKeys = []string{settingStrict, settingExclude, settingMarkerPrefix, settingHelperDirs, settingHelperDepth, settingCacheDir, settingVerbose}
+
+// topLevelKeys are the keys of the project file above its first section
+var topLevelKeys = []string{profileKey, syntaxKey}
+
+// settingKey returns the name of a [settings] key, which may also be spelled
+// with underscores, as in marker_prefix
+func settingKey(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// projectSettings returns the [settings] section of file under the names of
+// settingKeys, rejecting unknown keys and keys set under both spellings
+func projectSettings(file *projectFile) (map[string]projectValue, error) {
+	settings := make(map[string]projectValue)
+	for key, v := range file.Sections[settingsSection] {
+		name := settingKey(key)
+		if !slices.Contains(settingKeys, name) {
+			return nil, fmt.Errorf("%s:%d: unknown setting %s (known: %s)", file.Path, v.Line, key, strings.Join(settingKeys, ", "))
+		}
+		if other, dup := settings[name]; dup {
+			line := max(v.Line, other.Line)
+			return nil, fmt.Errorf("%s:%d: setting %s is defined twice", file.Path, line, name)
+		}
+		settings[name] = v
+	}
+	return settings, nil
+}
+
+// applyProjectSettings fills the options c leaves unset from the [settings]
+// section of the project file at the module root of c.Dir: a flag that sets
+// a value wins over the file. A relative cache-dir is taken from that root.
+func (c *Config) applyProjectSettings() error {
+	absDir, err := filepath.Abs(StripLongPathPrefix(c.Dir))
+	if err != nil {
+		return nil
+	}
+	root := findModuleRoot(absDir)
+	if root == "" {
+		root = absDir
+	}
+	file, err := readProjectFile(root)
+	if err != nil || file == nil {
+		return err
+	}
+	for key, v := range file.Keys {
+		switch {
+		case slices.Contains(topLevelKeys, key):
+		case slices.Contains(settingKeys, settingKey(key)):
+			return fmt.Errorf("%s:%d: %s is a setting; move it into the [%s] section", file.Path, v.Line, key, settingsSection)
+		default:
+			return fmt.Errorf("%s:%d: unknown key %s (known: %s; run options go in the [%s] section)", file.Path, v.Line, key, strings.Join(topLevelKeys, ", "), settingsSection)
+		}
+	}
+	settings, err := projectSettings(file)
+	if err != nil {
+		return err
+	}
+	expect := func(key, kind string) (projectValue, bool, error) {
+		v, ok := settings[key]
+		if ok && v.Kind != kind {
+			if kind == "array" {
+				kind = "an array of strings"
+			} else {
+				kind = "a " + kind
+			}
+			return v, false, fmt.Errorf("%s:%d: %s must be %s", file.Path, v.Line, key, kind)
+		}
+		return v, ok, nil
+	}
+
+	if v, ok, err := expect(settingStrict, "bool"); err != nil {
+		return err
+	} else if ok && !c.Strict {
+		c.Strict = v.Value == "true"
+	}
+	if v, ok, err := expect(settingExclude, "array"); err != nil {
+		return err
+	} else if ok && len(c.Exclude) == 0 {
+		c.Exclude = v.List
+	}
+	if v, ok, err := expect(settingMarkerPrefix, "string"); err != nil {
+		return err
+	} else if ok && c.MarkerPrefix == "" {
+		c.MarkerPrefix = v.Value
+	}
+	if v, ok, err := expect(settingHelperDirs, "array"); err != nil {
+		return err
+	} else if ok && len(c.HelperDirs) == 0 {
+		c.HelperDirs = v.List
+	}
+	if v, ok, err := expect(settingHelperDepth, "int"); err != nil {
+		return err
+	} else if ok && c.HelperDepth == 0 {
+		depth, err := strconv.Atoi(v.Value)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: %v", file.Path, v.Line, settingHelperDepth, err)
+		}
+		c.HelperDepth = depth
+	}
+	if v, ok, err := expect(settingCacheDir, "string"); err != nil {
+		return err
+	} else if ok && c.CacheDir == "" {
+		c.CacheDir = v.Value
+		if c.CacheDir != "off" && !filepath.IsAbs(c.CacheDir) {
+			c.CacheDir = filepath.Join(root, c.CacheDir)
+		}
+	}
+	if v, ok := settings[settingVerbose]; ok && c.LogCategories == "" && !c.Verbose {
+		switch v.Kind {
+		case "bool", "string":
+			c.LogCategories = v.Value
+		default:
+			return fmt.Errorf("%s:%d: %s must be a bool or a list of categories such as \"replace,inject\"", file.Path, v.Line, settingVerbose)
+		}
+	}
+	return nil
+}
+
+// projectExcludes returns the exclude setting of the project file at root,
+// nil when it has none or cannot be read
+func projectExcludes(root string) []string {
+	file, err := readProjectFile(root)
+	if err != nil || file == nil {
+		return nil
+	}
+	settings, err := projectSettings(file)
+	if err != nil {
+		return nil
+	}
+	return settings[settingExclude].List
+}
+
+// defaultProjectFile is what goahead init writes: every setting, commented
+// out with its default or an example
+const defaultProjectFile = `# goahead project file, read from the module root.
+
+# Marker syntax level of the module; without it a new tree gets the newest
+# level and a tree goahead has written to gets level 1.
+# syntax = "3"
+
+# Profile selecting the [profile.<name>] variables, when neither -profile nor
+# GOAHEAD_PROFILE is set.
+# profile = "dev"
+
+[settings]
+# Run options, applied to every run including toolexec ones. A flag given on
+# the command line takes precedence over the value here. Keys may also be
+# spelled with underscores, e.g. marker_prefix.
+
+# Fail when any marker is skipped (-strict).
+# strict = true
+
+# Paths never walked, relative to the module root (-exclude); they add to
+# the patterns of .goaheadignore.
+# exclude = ["gen/**", "**/testdata/**"]
+
+# Comment prefix that starts markers (-marker-prefix).
+# marker-prefix = "//:"
+
+# Directories whose files are all helper files, and their visibility depth
+# (-helper-dirs, -helper-depth).
+# helper-dirs = ["build/goahead"]
+# helper-depth = 0
+
+# Directory of the persistent result cache, relative to the module root, or
+# "off"; GOAHEAD_CACHE takes precedence (-cache-dir).
+# cache-dir = ".goahead/cache"
+
+# Verbose output: true, or categories such as "replace,inject".
+# verbose = "replace,inject"
+
+[vars]
+# Marker variables shared by every profile, read as ${name}.
+# name = "value"
+`
+
+// InitProjectFile writes a commented default project file at the module root
+// of dir, or dir itself outside a module, and returns its path. An existing
+// file is left alone unless force is set.
+func InitProjectFile(dir string, force bool) (string, error) {
+	absDir, err := filepath.Abs(StripLongPathPrefix(dir))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %v", dir, err)
+	}
+	if info, err := os.Stat(absDir); err != nil || !info.IsDir() {
+		return "", environmentErrorf("%s is not a directory", absDir)
+	}
+	root := findModuleRoot(absDir)
+	if root == "" {
+		root = absDir
+	}
+	path := filepath.Join(root, ProjectFileName)
+	if _, err := os.Stat(path); err == nil && !force {
+		return "", environmentErrorf("%s already exists; pass -force to overwrite it", path)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", environmentErrorf("failed to check %s: %v", path, err)
+	}
+	if err := writeFileAtomic(path, []byte(defaultProjectFile)); err != nil {
+		return "", environmentErrorf("failed to write %s: %v", path, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// evaluateAhead is the first pass of a -single-program run: the markers of
+// files are read without being replaced, and the calls of each directory are
+// evaluated by one program whose results fill the executor's cache, so that
+// files are then rewritten as usual without running the go command again.
+// Only the first call of a pipeline is evaluated ahead; nocache helpers
+// never are. A call that panics fails alone and is reported for its own
+// marker. When a program fails as a whole, for instance because a call does
+// not compile, its directory is evaluated file by file, which reports each
+// error with its marker.
+func (cp *CodeProcessor) evaluateAhead(files []string) {
+	collector := &CodeProcessor{ctx: cp.ctx, executor: cp.executor}
+	var dirs []string
+	pending := make(map[string][]pendingCall)
+	seen := make(map[string]bool)
+	for _, filePath := range files {
+		if cp.ctx.interrupted() {
+			return
+		}
+		if cp.ctx.SkipReason(filePath) != "" {
+			continue
+		}
+		content, err := os.ReadFile(filePath)
+		if err != nil || invalidUTF8Offset(string(content)) >= 0 {
+			continue
+		}
+		// Aliases resolve against the imports of the file, as when it is
+		// processed
+		if cp.ctx.FileImports, err = cp.ctx.fileImports(filePath, content); err != nil {
+			continue
+		}
+		var calls []BatchCall
+		collector.collected = &calls
+		_, text := splitBOM(string(content))
+		_, _, err = collector.processLines(strings.NewReader(text), filePath, false)
+		if err != nil {
+			continue
+		}
+
+		dir := absPath(filepath.Dir(filePath))
+		for _, call := range calls {
+			if fn, _ := cp.ctx.ResolveFunction(call.FuncName, dir); fn != nil && fn.NoCache {
+				continue
+			}
+			p, cached, err := cp.executor.prepareCall(call, dir)
+			if err != nil || cached != nil || seen[dir+"\x00"+p.cacheKey] {
+				continue
+			}
+			seen[dir+"\x00"+p.cacheKey] = true
+			if len(pending[dir]) == 0 {
+				dirs = append(dirs, dir)
+			}
+			pending[dir] = append(pending[dir], p)
+		}
+	}
+	cp.ctx.FileImports = nil
+
+	logger := cp.ctx.Logger()
+	for _, dir := range dirs {
+		if cp.ctx.interrupted() {
+			return
+		}
+		results := cp.executor.runPending(pending[dir], dir, true)
+		failed := 0
+		for _, result := range results {
+			if result.Err != nil {
+				failed++
+			}
+		}
+		if failed == len(results) && len(results) > 0 {
+			logger.Logf(LogExec, "[goahead] Single program for %s failed, evaluating its files one by one: %v", cp.ctx.relToRoot(dir), results[0].Err)
+			continue
+		}
+		logger.Logf(LogExec, "[goahead] Evaluated %d call(s) of %s in a single program (%d failed)", len(results), cp.ctx.relToRoot(dir), failed)
+	}
+}
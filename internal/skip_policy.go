@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// evalDirPrefix starts the hidden directories evaluation programs run from;
+// one left behind by a killed run holds Go files that are not sources
+const evalDirPrefix = ".goahead-eval-"
+
+// SkipReason says why goahead never rewrites path, "" when it may. The walk,
+// the injector and the code processor all ask it, so no pass touches a file
+// that another one leaves alone. Skipped are helper files, files with a
+// //go:ahead skip directive, the -const-sink file, the temporary files of
+// atomic rewrites, evaluation programs and -trace-dir traces, files of
+// -exclude and .goaheadignore, and, with -respect-build-tags, files excluded
+// from the target build.
+func (ctx *ProcessorContext) SkipReason(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	functions, skip := headerDirectives(abs)
+	switch {
+	case ctx.isHelperFile(abs) || functions:
+		return "it is a helper file"
+	case skip:
+		return "it has a " + DirectivePrefix + " " + DirectiveSkip + " directive"
+	case ctx.ConstSink != nil && abs == ctx.ConstSink.path:
+		return "it is the -const-sink file"
+	case isRewriteTemp(filepath.Base(abs)):
+		return "it is the temporary file of an atomic rewrite"
+	case ctx.inWorkDir(abs):
+		return "it belongs to an evaluation program or a -trace-dir trace"
+	case ctx.excludedBy(abs, false) != "":
+		return "it is excluded by " + ctx.excludedBy(abs, false)
+	case !ctx.buildFilter().matches(abs):
+		return fmt.Sprintf("its build constraints exclude it from %s", ctx.buildFilter().target())
+	}
+	return ""
+}
+
+// isHelperFile reports whether the absolute path abs is one of FuncFiles
+func (ctx *ProcessorContext) isHelperFile(abs string) bool {
+	for _, file := range ctx.FuncFiles {
+		if file == abs {
+			return true
+		}
+		if fileAbs, err := filepath.Abs(file); err == nil && fileAbs == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// headerDirectives reports whether the header of path, the lines above its
+// package clause, holds the functions and the skip directives. The content
+// is checked as well as FuncFiles so that a helper file is recognized even
+// by a pass that runs outside the walk which found it.
+func headerDirectives(path string) (functions, skip bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, false
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		if d, ok, err := ParseDirective(line); ok && err == nil {
+			functions = functions || d.Name == DirectiveFunctions
+			skip = skip || d.Name == DirectiveSkip
+		}
+	}
+	return functions, skip
+}
+
+// isRewriteTemp reports whether name is a temporary file of writeFileAtomic,
+// such as .main.go.goahead-123
+func isRewriteTemp(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, ".go.goahead-")
+}
+
+// inWorkDir reports whether abs lies in an evaluation directory or in the
+// -trace-dir directory
+func (ctx *ProcessorContext) inWorkDir(abs string) bool {
+	if dir := ctx.Tracer.Dir(); dir != "" && PathWithin(abs, dir) {
+		return true
+	}
+	root := ctx.DepthRoot
+	if root == "" {
+		root = ctx.RootDir
+	}
+	rel, err := filepath.Rel(root, filepath.Dir(abs))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Dir(abs)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if strings.HasPrefix(part, evalDirPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWorkDir reports whether the walk must leave out the directory abs; an
+// -out tree inside the module is not one of its sources
+func (ctx *ProcessorContext) isWorkDir(abs string) bool {
+	return strings.HasPrefix(filepath.Base(abs), evalDirPrefix) || abs == ctx.Tracer.Dir() ||
+		abs != ctx.RootDir && isOutTree(abs)
+}
+
+// buildFilter returns the -respect-build-tags matcher of the run, nil (which
+// matches every file) when the flag is off
+func (ctx *ProcessorContext) buildFilter() *buildMatcher {
+	if !ctx.buildLoaded {
+		ctx.build, ctx.buildLoaded = newBuildMatcher(ctx.Config), true
+	}
+	return ctx.build
+}
@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SkipReason categorizes why a placeholder marker produced no replacement
+type SkipReason string
+
+const (
+	SkipUnresolved         SkipReason = "unresolved"          // no helper with that name is visible
+	SkipSubmoduleIsolation SkipReason = "submodule-isolation" // helper lives in a parent module
+	SkipUnexported         SkipReason = "unexported-helper"   // helper exists but is lowercase
+	SkipNoTarget           SkipReason = "no-target"           // marker is not followed by a code line
+	SkipNoLiteral          SkipReason = "no-literal"          // target line has no literal to replace
+	SkipExecFailed         SkipReason = "exec-failed"         // helper call failed
+	SkipInvalidArgument    SkipReason = "invalid-argument"    // "=expr" argument is not a valid Go expression, or @below has no block
+	SkipOutputMismatch     SkipReason = "output-mismatch"     // "->" variables do not match the var block or results
+	SkipTooLarge           SkipReason = "too-large"           // helper value is over -max-literal-size
+	SkipUnsupportedType    SkipReason = "unsupported-type"    // helper returns a pointer, func, chan or error
+	SkipOverlapping        SkipReason = "overlapping-markers" // stacked markers would replace the same literal
+	SkipUndefinedVariable  SkipReason = "undefined-variable"  // ${name} argument names no variable
+	SkipConstSink          SkipReason = "const-sink"          // the marker's package cannot import -const-sink
+	SkipCompanion          SkipReason = "companion"           // -companion cannot assign the marker's target
+	SkipConstantOverflow   SkipReason = "constant-overflow"   // numeric value does not fit the target's type
+	SkipLengthMismatch     SkipReason = "length-mismatch"     // byte result is not as long as the [N]byte target
+)
+
+// SkippedMarker describes one marker that did not fire during a run
+type SkippedMarker struct {
+	File       string
+	Line       int
+	Column     int // 1-based column of the marker comment
+	Marker     string
+	Reason     SkipReason
+	Suggestion string
+	// Trace is the -trace-dir ID of the evaluation program behind the
+	// failure, if one ran
+	Trace string
+}
+
+// SkipReport collects skipped markers for a whole run, including submodules.
+// A nil *SkipReport is valid and records nothing.
+type SkipReport struct {
+	mu      sync.Mutex
+	markers []SkippedMarker
+}
+
+// NewSkipReport creates an empty report
+func NewSkipReport() *SkipReport {
+	return &SkipReport{}
+}
+
+// Add records a skipped marker
+func (r *SkipReport) Add(marker SkippedMarker) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.markers = append(r.markers, marker)
+}
+
+// Len returns the number of skipped markers
+func (r *SkipReport) Len() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.markers)
+}
+
+// Markers returns the skipped markers ordered by file and line
+func (r *SkipReport) Markers() []SkippedMarker {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	markers := append([]SkippedMarker(nil), r.markers...)
+	r.mu.Unlock()
+	sort.SliceStable(markers, func(i, j int) bool {
+		if markers[i].File != markers[j].File {
+			return markers[i].File < markers[j].File
+		}
+		return markers[i].Line < markers[j].Line
+	})
+	return markers
+}
+
+// Format renders the report as a table with paths relative to baseDir
+func (r *SkipReport) Format(baseDir string) string {
+	markers := r.Markers()
+	if len(markers) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[goahead] %d marker(s) were skipped:\n", len(markers))
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "  LOCATION\tMARKER\tREASON\tSUGGESTION")
+	for _, m := range markers {
+		location := m.File
+		if rel, err := filepath.Rel(baseDir, m.File); err == nil && !strings.HasPrefix(rel, "..") {
+			location = rel
+		}
+		suggestion := m.Suggestion
+		if m.Trace != "" {
+			suggestion += " (trace " + m.Trace + ")"
+		}
+		_, _ = fmt.Fprintf(w, "  %s:%d\t%s\t%s\t%s\n", filepath.ToSlash(location), m.Line, m.Marker, m.Reason, suggestion)
+	}
+	_ = w.Flush()
+	return b.String()
+}
+
+// explainUnresolved picks the most helpful reason for a marker whose helper
+// could not be resolved: an unexported helper in this module, a helper that
+// only exists in a parent module, or no helper at all
+func (ctx *ProcessorContext) explainUnresolved(funcName string) (SkipReason, string) {
+	if file, name, ok := ctx.findUnexportedHelper(funcName); ok {
+		return SkipUnexported, fmt.Sprintf("helper '%s' exists at %s but is unexported — rename it to '%s' (only exported helpers are available)",
+			name, ctx.relToRoot(file), exportedName(name))
+	}
+	if fn, ok := ctx.ParentHelpers[funcName]; ok {
+		return SkipSubmoduleIsolation, fmt.Sprintf("helper exists at %s but is blocked by go.mod boundary — see submodule isolation",
+			ctx.relToRoot(fn.FilePath))
+	}
+	if len(ctx.BrokenHelpers) > 0 {
+		files := make([]string, len(ctx.BrokenHelpers))
+		for i, b := range ctx.BrokenHelpers {
+			files[i] = ctx.relToRoot(b.File)
+		}
+		return SkipUnresolved, fmt.Sprintf("no helper named '%s' is loaded; it may be in the skipped helper file(s) %s",
+			funcName, strings.Join(files, ", "))
+	}
+	if len(ctx.FuncFiles) == 0 {
+		return SkipUnresolved, fmt.Sprintf("no helper files in this module; define '%s' in a %s file", funcName, FunctionMarker)
+	}
+	return SkipUnresolved, fmt.Sprintf("no helper named '%s' is defined; add it to a %s file", funcName, FunctionMarker)
+}
+
+func (ctx *ProcessorContext) findUnexportedHelper(funcName string) (string, string, bool) {
+	if file, ok := ctx.UnexportedHelpers[funcName]; ok {
+		return file, funcName, true
+	}
+	var names []string
+	for name := range ctx.UnexportedHelpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.EqualFold(name, funcName) {
+			return ctx.UnexportedHelpers[name], name, true
+		}
+	}
+	return "", "", false
+}
+
+func (ctx *ProcessorContext) relToRoot(path string) string {
+	rel, err := filepath.Rel(ctx.RootDir, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func exportedName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	if r == utf8.RuneError {
+		return name
+	}
+	return string(unicode.ToUpper(r)) + name[size:]
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RunStats counts the work of one codegen run, submodules included. It is
+// safe for concurrent use; a nil *RunStats counts nothing.
+type RunStats struct {
+	mu sync.Mutex
+
+	// Files is the number of Go files found by the walk
+	Files int
+	// Markers is the number of value markers evaluated
+	Markers int
+	// Replaced is the number of literals that changed
+	Replaced int
+	// Injected is the number of functions and methods injected
+	Injected int
+	// CacheHits is the number of markers served from the executor cache
+	CacheHits int
+	// ResultCacheHits and ResultCacheMisses count the lookups of the
+	// persistent result cache, hits being part of CacheHits
+	ResultCacheHits   int
+	ResultCacheMisses int
+	// SharedEvaluations is the number of calls that waited for an identical
+	// call in flight instead of running their own program
+	SharedEvaluations int
+	// Skipped is the number of markers that could not fire
+	Skipped int
+	// Warnings is the number of warnings, skipped markers aside
+	Warnings int
+	// Pending is the number of files a -dry-run would change
+	Pending int
+	// Duration is the wall time of the run
+	Duration time.Duration
+}
+
+func (s *RunStats) add(update func(*RunStats)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	update(s)
+	s.mu.Unlock()
+}
+
+// Summary renders the counters as the one-line toolexec summary for the
+// package in dir
+func (s *RunStats) Summary(dir string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("[goahead] pkg=%s files=%d markers=%d replaced=%d injected=%d cache=%d/%d dur=%s",
+		dir, s.Files, s.Markers, s.Replaced, s.Injected, s.CacheHits, s.Markers, s.Duration.Round(time.Millisecond))
+}
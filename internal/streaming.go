@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/AeonDave/goahead/marker"
+)
+
+// streamThreshold is the size from which the values of a file are replaced
+// while streaming it instead of reading it whole
+const streamThreshold = 4 << 20
+
+// windowRunLimit bounds the lines one marker may pull into the window; a
+// longer run, such as a huge var block below a multi-output marker, leaves
+// the file to the in-memory path
+const windowRunLimit = 4096
+
+// lineWindow holds the lines of a streamed file that markers read or
+// rewrite: runs from each marker through its target line, and through the
+// var block a target opens. processLines reads them in place of the file.
+type lineWindow struct {
+	source []string
+	// lines are the file line numbers of source
+	lines []int
+	// varBlock tells, by the index in source of the first line of each
+	// run, whether a var block is open above it
+	varBlock map[int]bool
+	// header holds the lines up to the package clause, which declare the
+	// file's imports
+	header []byte
+	bom    string
+}
+
+// varBlockAt returns the var block state above the run starting at index
+// of the window, if one starts there
+func (w *lineWindow) varBlockAt(index int) (bool, bool) {
+	if w == nil {
+		return false, false
+	}
+	state, ok := w.varBlock[index]
+	return state, ok
+}
+
+// streamLockedFile replaces the values of a large file without holding it in
+// memory: a first pass collects the window of marker lines, processLines
+// evaluates it, and a second pass copies the file to its atomic rewrite with
+// the changed lines substituted. It reports false, leaving the file to the
+// in-memory path, for small files, files with inject markers or lines that are
+// not UTF-8, and runs with -format, -paranoid, -const-sink, -backup or
+// -companion, which need the whole file, or -dry-run, which rewrites in
+// memory.
+func streamLockedFile(ctx *ProcessorContext, codeProcessor *CodeProcessor, filePath string) (bool, error) {
+	if ctx.Config.Format || ctx.Config.Paranoid || ctx.ConstSink != nil || ctx.Config.Backup || ctx.Config.Companion || ctx.dry != nil {
+		return false, nil
+	}
+	info, err := os.Stat(filePath)
+	if err != nil || info.Size() < streamThreshold {
+		return false, nil
+	}
+	window, ok, err := codeProcessor.collectWindow(filePath)
+	if err != nil || !ok {
+		return false, err
+	}
+	ctx.Logger().Logf(LogReplace, "[goahead] Streaming %s (%d bytes, %d window lines)", ctx.relToRoot(filePath), info.Size(), len(window.lines))
+	if ctx.FileImports, err = ctx.fileImports(filePath, window.header); err != nil {
+		return true, err
+	}
+	defer func() { ctx.FileImports = nil }()
+
+	written, err := codeProcessor.streamFile(filePath, window, ctx.Verbose)
+	if err != nil {
+		return true, fmt.Errorf("error processing %s: %w", filePath, err)
+	}
+	if written {
+		ctx.events().fileWritten(FileEvent{File: filePath})
+	}
+	return true, nil
+}
+
+// collectWindow reads filePath line by line and keeps the runs of lines its
+// placeholder markers need. It reports false for a file the window cannot
+// serve: one with inject markers, "> name" markers, lines that are not
+// UTF-8 or a run longer than windowRunLimit.
+func (cp *CodeProcessor) collectWindow(filePath string) (*lineWindow, bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open file %s: %v", filePath, err)
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	window := &lineWindow{varBlock: make(map[int]bool)}
+	syntax := cp.ctx.MarkerSyntax()
+	var (
+		inHeader   = true
+		inVarBlock bool
+		// open is set from a marker through the end of its run; the run
+		// holds a block argument or, once the target opened one, a var block
+		open, inBlock, inTargetBlock bool
+		runLines                     int
+	)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		raw := scanner.Bytes()
+		if n == 1 && bytes.HasPrefix(raw, []byte(utf8BOM)) {
+			window.bom, raw = utf8BOM, raw[len(utf8BOM):]
+		}
+		if !utf8.Valid(raw) {
+			return nil, false, nil
+		}
+		if inHeader {
+			window.header = append(append(window.header, raw...), '\n')
+			inHeader = !bytes.HasPrefix(raw, []byte("package "))
+		}
+
+		trimmed := bytes.TrimSpace(raw)
+		var m *marker.Marker
+		if bytes.HasPrefix(trimmed, []byte("//")) {
+			m, _ = syntax.Parse(string(raw))
+		}
+		// The declaration a "> name" marker targets may be anywhere below
+		if m != nil && (m.Kind != marker.KindPlaceholder || m.Target != "") {
+			return nil, false, nil
+		}
+		above := inVarBlock
+		if len(trimmed) > 0 && (trimmed[0] == 'v' || trimmed[0] == ')') {
+			inVarBlock = trackVarBlock(string(trimmed), inVarBlock)
+		}
+
+		include := open
+		switch {
+		case open && inBlock:
+			inBlock = string(trimmed) != marker.BlockArgumentEnd
+		case open && inTargetBlock:
+			open, inTargetBlock = inVarBlock, inVarBlock
+		case open && (m != nil || len(trimmed) == 0):
+		case open && string(trimmed) == marker.BlockArgumentStart:
+			inBlock = true
+		case open:
+			// The target; a var block it opens holds the outputs
+			inTargetBlock = !above && inVarBlock
+			open = inTargetBlock
+		case m != nil:
+			open, include, inBlock, inTargetBlock, runLines = true, true, false, false, 0
+			window.varBlock[len(window.lines)] = above
+		}
+		if !include {
+			continue
+		}
+		if runLines++; runLines > windowRunLimit {
+			return nil, false, nil
+		}
+		window.source = append(window.source, string(raw))
+		window.lines = append(window.lines, n)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, fmt.Errorf("error reading file %s: %v", filePath, err)
+	}
+	return window, true, nil
+}
+
+// streamFile evaluates the markers of window and rewrites filePath with the
+// lines they changed, reporting whether it wrote the file
+func (cp *CodeProcessor) streamFile(filePath string, window *lineWindow, verbose bool) (bool, error) {
+	if len(window.source) == 0 {
+		return false, nil
+	}
+	cp.window = window
+	defer func() { cp.window = nil }()
+
+	lines, modified, err := cp.processLines(strings.NewReader(strings.Join(window.source, "\n")), filePath, verbose)
+	if err != nil || !modified {
+		return false, err
+	}
+	// Value replacement never changes the line count without a sink
+	if len(lines) != len(window.source) {
+		return false, fmt.Errorf("the rewrite of %d window lines produced %d", len(window.source), len(lines))
+	}
+	changed := make(map[int]string)
+	for i, line := range lines {
+		if line != window.source[i] {
+			changed[window.lines[i]] = line
+		}
+	}
+	if len(changed) == 0 {
+		return false, nil
+	}
+	err = writeFileAtomicFrom(filePath, func(w io.Writer) error {
+		return copyWithChanges(filePath, w, window.bom, changed)
+	})
+	return err == nil, err
+}
+
+// copyWithChanges writes the lines of filePath to w, each ended by "\n" as
+// writeFile does, replacing those changed holds by line number
+func copyWithChanges(filePath string, w io.Writer, bom string, changed map[int]string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %v", filePath, err)
+	}
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	out := bufio.NewWriter(w)
+	_, _ = out.WriteString(bom)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		if n == 1 {
+			line = bytes.TrimPrefix(line, []byte(utf8BOM))
+		}
+		if replacement, ok := changed[n]; ok {
+			_, _ = out.WriteString(replacement)
+		} else {
+			_, _ = out.Write(line)
+		}
+		_ = out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading file %s: %v", filePath, err)
+	}
+	return out.Flush()
+}
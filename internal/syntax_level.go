@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/AeonDave/goahead/marker"
+)
+
+// syntaxKey is the .goahead.toml key declaring the marker syntax level
+const syntaxKey = "syntax"
+
+// syntaxDeclaration is where a module declares its marker syntax level
+type syntaxDeclaration struct {
+	Level int
+	File  string
+	Line  int
+}
+
+func parseSyntaxLevel(s string) (int, error) {
+	level, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || level < marker.Level1 || level > marker.LatestLevel {
+		return 0, fmt.Errorf("expected a marker syntax level from %d to %d", marker.Level1, marker.LatestLevel)
+	}
+	return level, nil
+}
+
+// declareSyntax records the //go:ahead syntax directive at line of the helper
+// file path. Only helpers at the module root declare the level, and all
+// declarations must agree.
+func (ctx *ProcessorContext) declareSyntax(level int, path string, line int) error {
+	location := fmt.Sprintf("%s:%d", ctx.relToRoot(path), line)
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	if filepath.Dir(abs) != filepath.Clean(ctx.DepthRoot) {
+		return fmt.Errorf("%s: %s %s is only read from helper files at the module root", location, DirectivePrefix, DirectiveSyntax)
+	}
+	if prev := ctx.syntaxDecl; prev != nil && prev.Level != level {
+		return fmt.Errorf("%s: syntax %d conflicts with syntax %d declared at %s:%d",
+			location, level, prev.Level, ctx.relToRoot(prev.File), prev.Line)
+	}
+	ctx.syntaxDecl = &syntaxDeclaration{Level: level, File: path, Line: line}
+	return nil
+}
+
+// resolveSyntax picks the marker grammar of the module once its helpers are
+// loaded: the level declared by the project file or a //go:ahead syntax
+// directive; otherwise the newest one for a fresh tree, and level 1 for a
+// tree goahead has already written to, whose markers predate the newer
+// levels. files are the module's files with markers.
+func (ctx *ProcessorContext) resolveSyntax(files []string) error {
+	decl := ctx.syntaxDecl
+	file, err := readProjectFile(ctx.DepthRoot)
+	if err != nil {
+		return err
+	}
+	if v, ok := file.key(syntaxKey); ok {
+		level, err := parseSyntaxLevel(v.Value)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: %v", file.Path, v.Line, syntaxKey, err)
+		}
+		if decl != nil && decl.Level != level {
+			return fmt.Errorf("%s:%d: syntax %d conflicts with syntax %d declared at %s:%d",
+				file.Path, v.Line, level, decl.Level, ctx.relToRoot(decl.File), decl.Line)
+		}
+		decl = &syntaxDeclaration{Level: level, File: file.Path, Line: v.Line}
+	}
+
+	level := marker.LatestLevel
+	switch {
+	case decl != nil:
+		level = decl.Level
+		ctx.syntaxOrigin = fmt.Sprintf("declared at %s:%d", ctx.relToRoot(decl.File), decl.Line)
+	case ctx.processedBefore(files):
+		level = marker.Level1
+		ctx.syntaxOrigin = "the default for trees an earlier goahead has written to"
+	default:
+		ctx.syntaxOrigin = "the default for new trees"
+	}
+	syntax, err := ctx.MarkerSyntax().WithLevel(level)
+	if err != nil {
+		return err
+	}
+	ctx.syntax = syntax
+	ctx.Logger().Logf(LogScan, "[goahead] Marker syntax %d (%s)", level, ctx.syntaxOrigin)
+	return nil
+}
+
+// processedBefore reports whether goahead has written to the module: it
+// holds an -incremental index, or one of files holds injected code or a
+// replacement tag
+func (ctx *ProcessorContext) processedBefore(files []string) bool {
+	for _, dir := range []string{ctx.DepthRoot, runBaseDir(ctx.Config)} {
+		if _, err := os.Stat(filepath.Join(dir, IndexFileName)); err == nil {
+			return true
+		}
+	}
+	tags := ctx.Tags()
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		found := false
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() && !found {
+			line := strings.TrimSpace(scanner.Text())
+			found = generatedCodePattern.MatchString(line) && strings.Contains(line, "goahead") || tags.Strip(line) != line
+		}
+		_ = f.Close()
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// warnNewerSyntax reports a marker at line of filePath that a newer syntax
+// level than the module's would read differently
+func (cp *CodeProcessor) warnNewerSyntax(filePath string, line int, m *marker.Marker) {
+	if cp.collected != nil {
+		return
+	}
+	level := cp.ctx.MarkerSyntax().Level()
+	text, meaning, escape := `"|"`, "a pipeline", `quote arguments holding a literal "|" ("a|b")`
+	if m.NewerLevel == marker.Level3 {
+		text, meaning, escape = `"> name"`, "a named target", `quote arguments holding a literal ">" ("a>b")`
+	}
+	cp.ctx.Warn(Diagnostic{
+		Rule: RuleNewerSyntax,
+		File: filePath,
+		Line: line,
+		Message: fmt.Sprintf("%s:%d: %s: marker syntax %d (%s) reads %s as part of the call; syntax %d makes it %s. "+
+			"To migrate, %s or wrap operators in =(...), "+
+			"then set %s = \"%d\" in %s or add %s %s %d to a helper at the module root",
+			cp.ctx.relToRoot(filePath), line, m.Func, level, cp.ctx.syntaxOrigin, text, m.NewerLevel, meaning, escape,
+			syntaxKey, m.NewerLevel, ProjectFileName, DirectivePrefix, DirectiveSyntax, m.NewerLevel),
+	})
+}
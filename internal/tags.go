@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+
+	"github.com/AeonDave/goahead/marker"
+)
+
+// DefaultTagFormat is the -tag-format of the provenance comments written by
+// -tag-replacements, e.g. //g:Shadow("ntdll")@v1.4.0
+const DefaultTagFormat = "//g:{call}@{version}"
+
+// Redacted replaces helper arguments and values in output under -redact
+const Redacted = "<redacted>"
+
+// tagFields are the placeholders of a -tag-format template
+var tagFields = []string{"{call}", "{helper}", "{args}", "{version}"}
+
+var tagFieldPattern = regexp.MustCompile(`\{(?:call|helper|args|version)\}`)
+
+// TagFormat renders and recognizes the end-of-line provenance comments of
+// replaced literals
+type TagFormat struct {
+	template string
+	// trailing matches every tag at the end of a line, with the blanks
+	// before them
+	trailing *regexp.Regexp
+}
+
+// ParseTagFormat checks a -tag-format template; empty means DefaultTagFormat
+func ParseTagFormat(template string) (*TagFormat, error) {
+	if template == "" {
+		template = DefaultTagFormat
+	}
+	if !strings.HasPrefix(template, "//") || strings.ContainsAny(template, "\r\n") {
+		return nil, fmt.Errorf("invalid -tag-format %q: must be a single // comment", template)
+	}
+	if !tagFieldPattern.MatchString(template) {
+		return nil, fmt.Errorf("invalid -tag-format %q: must contain one of %s", template, strings.Join(tagFields, ", "))
+	}
+	var pattern strings.Builder
+	last := 0
+	for _, loc := range tagFieldPattern.FindAllStringIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		pattern.WriteString(".*?")
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	return &TagFormat{
+		template: template,
+		trailing: regexp.MustCompile(`(?:[ \t]*` + pattern.String() + `)+[ \t]*$`),
+	}, nil
+}
+
+// Tag renders the tag of one helper call; redact hides its arguments
+func (f *TagFormat) Tag(funcName, argsStr string, redact bool) string {
+	args := displayArgs(argsStr, redact)
+	return strings.NewReplacer(
+		"{call}", funcName+"("+args+")",
+		"{helper}", funcName,
+		"{args}", args,
+		"{version}", Version,
+	).Replace(f.template)
+}
+
+// Strip removes the tags at the end of line. Tags are comments, so text
+// inside literals that looks like one is kept.
+func (f *TagFormat) Strip(line string) string {
+	start := commentStart(line)
+	if start < 0 {
+		return line
+	}
+	if loc := f.trailing.FindStringIndex(line[start:]); loc != nil {
+		return strings.TrimRight(line[:start+loc[0]], " \t")
+	}
+	return line
+}
+
+// Apply replaces the tags at the end of line with tags
+func (f *TagFormat) Apply(line string, tags []string) string {
+	return f.Strip(line) + " " + strings.Join(tags, " ")
+}
+
+// commentStart returns the offset of the first // comment of line outside
+// string and rune literals, or -1
+func commentStart(line string) int {
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == '"' || c == '\'':
+			i = skipQuoted(line, i, c)
+		case c == '`':
+			end := strings.IndexByte(line[i+1:], '`')
+			if end < 0 {
+				return -1
+			}
+			i += end + 2
+		case strings.HasPrefix(line[i:], "//"):
+			return i
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// displayArgs renders a marker's arguments as those of a Go call
+func displayArgs(argsStr string, redact bool) string {
+	if strings.TrimSpace(argsStr) == "" {
+		return ""
+	}
+	if redact {
+		return Redacted
+	}
+	parts, err := marker.SplitArguments(argsStr)
+	if err != nil {
+		return argsStr
+	}
+	return strings.Join(parts, ", ")
+}
+
+// lineTags collects the tags of one file's replaced lines. Tags are removed
+// from a target line before its literal is located, so that the call they
+// quote is never taken for the literal, and written back by apply.
+type lineTags struct {
+	format  *TagFormat
+	enabled bool
+	// original holds the lines as read, before their tags were removed
+	original map[int]string
+	tags     map[int][]string
+}
+
+func newLineTags(format *TagFormat, enabled bool) *lineTags {
+	return &lineTags{format: format, enabled: enabled, original: make(map[int]string), tags: make(map[int][]string)}
+}
+
+// strip returns line without its tags
+func (t *lineTags) strip(line string) string {
+	return t.format.Strip(line)
+}
+
+// take removes the tags of lines[index], remembering the line as read
+func (t *lineTags) take(lines []string, index int) string {
+	if _, seen := t.original[index]; !seen {
+		t.original[index] = lines[index]
+	}
+	lines[index] = t.strip(lines[index])
+	return lines[index]
+}
+
+// add records the tag of a marker that replaced, or confirmed, lines[index]
+func (t *lineTags) add(index int, tag string) {
+	if t.enabled {
+		t.tags[index] = append(t.tags[index], tag)
+	}
+}
+
+// splice records that lines[index:index+span] were replaced with count
+// lines: the tags of the lines below move with them, and those of the
+// replaced lines after index are dropped
+func (t *lineTags) splice(index, span, count int) {
+	spliceLines(t.original, index, span, count)
+	spliceLines(t.tags, index, span, count)
+}
+
+// spliceLines is lineTags.splice on one map keyed by line index
+func spliceLines[V any](m map[int]V, index, span, count int) {
+	moved := make(map[int]V)
+	for i, v := range m {
+		if i <= index {
+			continue
+		}
+		delete(m, i)
+		if i >= index+span {
+			moved[i+count-span] = v
+		}
+	}
+	maps.Copy(m, moved)
+}
+
+// apply writes the recorded tags back and reports whether any taken line
+// differs from the line as read
+func (t *lineTags) apply(lines []string) bool {
+	modified := false
+	for index, original := range t.original {
+		if tags := t.tags[index]; len(tags) > 0 {
+			lines[index] = t.format.Apply(lines[index], tags)
+		}
+		if lines[index] != original {
+			modified = true
+		}
+	}
+	return modified
+}
@@ -6,9 +6,19 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 )
 
+// InPlaceEnv set to 1 makes toolexec runs rewrite the sources of each
+// package in place instead of compiling processed copies
+const InPlaceEnv = "GOAHEAD_IN_PLACE"
+
+// StrictEnv set to 1 makes toolexec runs fail the compile of a package with
+// skipped markers instead of compiling it with its placeholders unfilled
+const StrictEnv = "GOAHEAD_STRICT"
+
 type ToolexecManager struct{}
 
 var versionShown = false
@@ -30,25 +40,184 @@ func (tm *ToolexecManager) RunAsToolexec() {
 		return
 	}
 	goFiles, outputDir := tm.extractFilesAndOutputDir(originalArgs)
+	if os.Getenv(InPlaceEnv) == "1" {
+		if err := tm.ProcessPackage(goFiles, outputDir); err != nil {
+			// Pass the failure on instead of compiling half-processed code
+			_, _ = fmt.Fprintf(os.Stderr, "[goahead] Codegen %v\n", err)
+			os.Exit(ExitCode(err))
+		}
+		tm.runOriginalTool(originalTool, originalArgs)
+		return
+	}
+	args, cleanup, err := tm.ProcessPackageCopy(originalArgs)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "[goahead] Codegen %v\n", err)
+		os.Exit(ExitCode(err))
+	}
+	code := tm.runTool(originalTool, args)
+	cleanup()
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+// ProcessPackage runs codegen for the Go files of one compile invocation;
+// outputDir is used when the user files share no directory. Codegen
+// failures are logged and the compile goes on; only ErrInterrupted is
+// returned, and with StrictEnv set the error of skipped markers.
+func (tm *ToolexecManager) ProcessPackage(goFiles []string, outputDir string) error {
+	if len(goFiles) == 0 {
+		return nil
+	}
+	userFiles := FilterUserFiles(goFiles)
+	if len(userFiles) == 0 {
+		return nil
+	}
+
+	logger := NewLoggerFromEnv()
+	if logger.Enabled(LogScan) && !versionShown {
+		logger.Logf(LogScan, "[goahead] GoAhead Code Generator %s", Version)
+		logger.Logf(LogScan, "[goahead] Processing user code with intelligent code generation")
+		versionShown = true
+	}
+	workDir := tm.determineWorkDir(userFiles, outputDir)
+	return tm.runCodegenIfVerbose(workDir, goFiles, userFiles, "")
+}
 
-	if len(goFiles) > 0 {
-		userFiles := FilterUserFiles(goFiles)
+// ProcessPackageCopy runs codegen for the Go files of one compile invocation
+// on a mirror of their module in a temporary directory, so the sources are
+// never written. It returns args, the compile arguments, with the user files
+// swapped for their processed copies and a -trimpath rule giving the copies
+// the paths the sources would have had, and a function removing the mirror
+// once the compiler is done. Codegen failures are logged and the sources are
+// compiled as they are; only ErrInterrupted is returned, and with StrictEnv
+// set the error of skipped markers.
+func (tm *ToolexecManager) ProcessPackageCopy(args []string) ([]string, func(), error) {
+	goFiles, outputDir := tm.extractFilesAndOutputDir(args)
+	userFiles := FilterUserFiles(goFiles)
+	if len(userFiles) == 0 {
+		return args, func() {}, nil
+	}
+	logger := NewLoggerFromEnv()
+	if logger.Enabled(LogScan) && !versionShown {
+		logger.Logf(LogScan, "[goahead] GoAhead Code Generator %s", Version)
+		logger.Logf(LogScan, "[goahead] Processing copies of user code with intelligent code generation")
+		versionShown = true
+	}
+	out, err := os.MkdirTemp("", "goahead-toolexec-*")
+	if err != nil {
+		logger.Logf(LogExec, "[goahead] Codegen failed: %v", err)
+		return args, func() {}, nil
+	}
+	cleanup := func() { _ = os.RemoveAll(out) }
+	workDir := tm.determineWorkDir(userFiles, outputDir)
+	if err := tm.runCodegenIfVerbose(workDir, goFiles, userFiles, out); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	absWorkDir, err := filepath.Abs(workDir)
+	if err != nil {
+		cleanup()
+		return args, func() {}, nil
+	}
+	mirrorDir := mirroredPath(mirroredRoot(absWorkDir), out, absWorkDir)
 
-		if len(userFiles) == 0 {
-			tm.runOriginalTool(originalTool, originalArgs)
-			return
+	swapped := make(map[string]bool, len(userFiles))
+	for _, file := range userFiles {
+		swapped[file] = true
+	}
+	rewritten := make([]string, 0, len(args)+2)
+	rules := make(map[string]string)
+	for _, arg := range args {
+		if !swapped[arg] {
+			rewritten = append(rewritten, arg)
+			continue
 		}
+		copied := mirroredPath(absWorkDir, mirrorDir, arg)
+		if _, err := os.Stat(copied); err != nil {
+			// Codegen stopped before mirroring, untrusted modules included;
+			// the directory alone proves nothing, as for a package at the
+			// module root it is out itself
+			cleanup()
+			return args, func() {}, nil
+		}
+		rewritten = append(rewritten, copied)
+		if source, err := filepath.Abs(arg); err == nil {
+			rules[filepath.Dir(copied)] = filepath.Dir(source)
+		}
+	}
+	return withTrimpathRules(rewritten, rules), cleanup, nil
+}
 
-		verbose := os.Getenv("GOAHEAD_VERBOSE") == "1"
-		if verbose && !versionShown {
-			_, _ = fmt.Fprintf(os.Stderr, "[goahead] GoAhead Code Generator %s\n", Version)
-			_, _ = fmt.Fprintf(os.Stderr, "[goahead] Processing user code with intelligent code generation\n")
-			versionShown = true
+// mirroredRoot returns the directory an -out run on dir mirrors, as
+// mirrorTree does: the module holding dir, or dir outside any module
+func mirroredRoot(dir string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	if root := findModuleRoot(absDir); root != "" {
+		return root
+	}
+	return absDir
+}
+
+// withTrimpathRules adds to the -trimpath of compile args one rule per
+// directory of copies in rules, rewriting it to what the rules of args make
+// of the source directory it stands for, so that positions, panics and
+// debug information name the sources
+func withTrimpathRules(args []string, rules map[string]string) []string {
+	if len(rules) == 0 {
+		return args
+	}
+	index, existing := -1, ""
+	for i, arg := range args {
+		if arg == "-trimpath" && i+1 < len(args) {
+			index, existing = i+1, args[i+1]
+		}
+	}
+	dirs := make([]string, 0, len(rules))
+	for dir := range rules {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	added := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		added = append(added, dir+"=>"+applyTrimpath(rules[dir], existing))
+	}
+	value := strings.Join(added, ";")
+	if index < 0 {
+		return append([]string{"-trimpath", value}, args...)
+	}
+	args = append([]string(nil), args...)
+	args[index] = value + ";" + existing
+	return args
+}
+
+// applyTrimpath rewrites path with the first matching prefix=>replacement
+// rule of rewrites, as the compiler does for -trimpath
+func applyTrimpath(path, rewrites string) string {
+	if rewrites == "" {
+		return path
+	}
+	for _, rule := range strings.Split(rewrites, ";") {
+		prefix, replacement := rule, ""
+		if i := strings.LastIndex(rule, "=>"); i >= 0 {
+			prefix, replacement = rule[:i], rule[i+len("=>"):]
+		}
+		if prefix == "" || !strings.HasPrefix(path, prefix) || !(len(path) == len(prefix) || os.IsPathSeparator(path[len(prefix)])) {
+			continue
+		}
+		switch {
+		case len(path) == len(prefix):
+			return replacement
+		case replacement == "":
+			return path[len(prefix)+1:]
+		default:
+			return replacement + path[len(prefix):]
 		}
-		workDir := tm.determineWorkDir(userFiles, outputDir)
-		tm.runCodegenIfVerbose(workDir, goFiles, userFiles)
 	}
-	tm.runOriginalTool(originalTool, originalArgs)
+	return path
 }
 
 func (tm *ToolexecManager) isCompilerTool(tool string) bool {
@@ -85,30 +254,49 @@ func (tm *ToolexecManager) determineWorkDir(userFiles []string, outputDir string
 	return workDir
 }
 
-func (tm *ToolexecManager) runCodegenIfVerbose(workDir string, goFiles, userFiles []string) {
-	verbose := os.Getenv("GOAHEAD_VERBOSE") == "1"
+// runCodegenIfVerbose runs codegen for the package of one compile
+// invocation, in workDir or, when out is set, on a mirror of its module there
+func (tm *ToolexecManager) runCodegenIfVerbose(workDir string, goFiles, userFiles []string, out string) error {
+	spec := os.Getenv("GOAHEAD_VERBOSE")
+	logger := NewLogger(spec)
 
-	if verbose {
-		_, _ = fmt.Fprintf(os.Stderr, "[goahead] Files detected: %v\n", goFiles)
-		_, _ = fmt.Fprintf(os.Stderr, "[goahead] User files after filtering: %v\n", userFiles)
-		_, _ = fmt.Fprintf(os.Stderr, "[goahead] Running codegen in %s\n", workDir)
-		cwd, err := os.Getwd()
-		if err == nil {
-			_, _ = fmt.Fprintf(os.Stderr, "[goahead] Current working directory: %s\n", cwd)
-		}
-	}
-	if verbose {
-		tm.logFileTypes(goFiles)
+	logger.Logf(LogFilter, "[goahead] Files detected: %v", goFiles)
+	logger.Logf(LogFilter, "[goahead] User files after filtering: %v", userFiles)
+	logger.Logf(LogScan, "[goahead] Running codegen in %s", workDir)
+	if cwd, err := os.Getwd(); err == nil {
+		logger.Logf(LogScan, "[goahead] Current working directory: %s", cwd)
 	}
+	tm.logFileTypes(logger, goFiles)
 
-	if err := RunCodegen(workDir, verbose); err != nil {
-		if verbose {
-			_, _ = fmt.Fprintf(os.Stderr, "[goahead] Codegen failed: %v\n", err)
+	// The compiler's file list and environment describe the target build
+	config := Config{Dir: workDir, LogCategories: spec, RequireTrust: true, RespectBuildTags: true, BuildFiles: userFiles}
+	config.Strict = os.Getenv(StrictEnv) == "1"
+	if out != "" {
+		config.Out, config.OutLink, config.sourceRoot = out, toolexecOutLink(), mirroredRoot(workDir)
+	}
+	stats, err := RunCodegenWithStats(config)
+	// Only strict runs, from StrictEnv or the strict setting, fail that way
+	if errors.Is(err, ErrInterrupted) || errors.Is(err, ErrUnresolvedMarker) {
+		return err
+	}
+	if err != nil {
+		logger.Logf(LogExec, "[goahead] Codegen failed: %v", err)
+	}
+	// One line per compile invocation tells which package rewrote what
+	if logger.Any() && stats != nil {
+		pkgDir, err := filepath.Abs(workDir)
+		if err != nil {
+			pkgDir = workDir
 		}
+		_, _ = fmt.Fprintln(os.Stderr, stats.Summary(pkgDir))
 	}
+	return nil
 }
 
-func (tm *ToolexecManager) logFileTypes(files []string) {
+func (tm *ToolexecManager) logFileTypes(logger *Logger, files []string) {
+	if !logger.Enabled(LogFilter) {
+		return
+	}
 	for _, file := range files {
 		fileType := "unknown"
 		if strings.Contains(file, "_test.go") {
@@ -122,7 +310,7 @@ func (tm *ToolexecManager) logFileTypes(files []string) {
 			location = "system file"
 		}
 
-		_, _ = fmt.Fprintf(os.Stderr, "[goahead] File: %s (Type: %s, Location: %s)\n", file, fileType, location)
+		logger.Logf(LogFilter, "[goahead] File: %s (Type: %s, Location: %s)", file, fileType, location)
 	}
 }
 
@@ -143,7 +331,24 @@ func (tm *ToolexecManager) isSystemFile(file string) bool {
 	return false
 }
 
+// toolexecOutLink is how the mirror of a toolexec run holds the files no
+// marker changes: symlinks, which cost little per compile invocation, except
+// on Windows, where creating them takes a privilege
+func toolexecOutLink() string {
+	if runtime.GOOS == "windows" {
+		return OutLinkCopy
+	}
+	return OutLinkSymlink
+}
+
 func (tm *ToolexecManager) runOriginalTool(tool string, args []string) {
+	if code := tm.runTool(tool, args); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// runTool runs tool and returns its exit code
+func (tm *ToolexecManager) runTool(tool string, args []string) int {
 	cmd := exec.Command(tool, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -152,8 +357,9 @@ func (tm *ToolexecManager) runOriginalTool(tool string, args []string) {
 	if err := cmd.Run(); err != nil {
 		var exitError *exec.ExitError
 		if errors.As(err, &exitError) {
-			os.Exit(exitError.ExitCode())
+			return exitError.ExitCode()
 		}
-		os.Exit(1)
+		return 1
 	}
+	return 0
 }
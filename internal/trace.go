@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/AeonDave/goahead/internal/artifact"
+)
+
+// DefaultTraceLimit is the number of evaluation programs -trace-dir saves
+// before it stops; -trace-limit=0 removes the limit
+const DefaultTraceLimit = 100
+
+// traceModule is written to the trace directory as go.mod, so the saved
+// programs are a separate module that go build ./... never compiles
+const traceModule = "module goahead-trace\n"
+
+var errTraceLimit = errors.New("trace limit reached")
+
+// TraceEntry is the trace.json of one saved evaluation program
+type TraceEntry = artifact.Trace
+
+// Tracer saves every evaluation program of a run (-trace-dir) into numbered
+// subdirectories: program.raw.go (template output), program.go (the
+// formatted program that was run), stdout.txt, stderr.txt and trace.json.
+// It is safe for concurrent use; a nil *Tracer saves nothing.
+type Tracer struct {
+	dir   string
+	limit int
+
+	mu      sync.Mutex
+	next    int
+	saved   int
+	refused bool
+}
+
+// NewTracer prepares dir for tracing. Numbering continues after the traces
+// of earlier runs. limit caps the programs saved by this tracer, 0 means no
+// limit.
+func NewTracer(dir string, limit int) (*Tracer, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		absDir = dir
+	}
+	if err := os.MkdirAll(absDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create trace directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(absDir, "go.mod"), []byte(traceModule), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write trace directory go.mod: %v", err)
+	}
+
+	t := &Tracer{dir: absDir, limit: limit}
+	entries, err := os.ReadDir(absDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trace directory: %v", err)
+	}
+	for _, entry := range entries {
+		if n, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() && n > t.next {
+			t.next = n
+		}
+	}
+	return t, nil
+}
+
+// Dir returns the absolute trace directory
+func (t *Tracer) Dir() string {
+	if t == nil {
+		return ""
+	}
+	return t.dir
+}
+
+// Record saves one evaluation program and returns its trace ID. Once the
+// limit is reached Record fails with errTraceLimit a single time, and later
+// calls save nothing and return an empty ID.
+func (t *Tracer) Record(entry TraceEntry, unformatted, program, stdout, stderr string) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	t.mu.Lock()
+	if t.limit > 0 && t.saved >= t.limit {
+		refused := t.refused
+		t.refused = true
+		t.mu.Unlock()
+		if refused {
+			return "", nil
+		}
+		return "", fmt.Errorf("%w: %d programs saved to %s; use -trace-limit=0 to trace all of them", errTraceLimit, t.limit, t.dir)
+	}
+	t.next++
+	t.saved++
+	entry.ID = fmt.Sprintf("%04d", t.next)
+	t.mu.Unlock()
+
+	dir := filepath.Join(t.dir, entry.ID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create trace %s: %v", entry.ID, err)
+	}
+	data, err := artifact.Encode(&entry)
+	if err != nil {
+		return "", err
+	}
+	files := []struct {
+		name, content string
+	}{
+		{"program.raw.go", unformatted},
+		{"program.go", program},
+		{"stdout.txt", stdout},
+		{"stderr.txt", stderr},
+		{"trace.json", string(data)},
+	}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(dir, file.name), []byte(file.content), 0o644); err != nil {
+			return "", fmt.Errorf("failed to write trace %s: %v", entry.ID, err)
+		}
+	}
+	return entry.ID, nil
+}
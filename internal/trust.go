@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrustAllEnv disables the trust check when set to 1
+const TrustAllEnv = "GOAHEAD_TRUST_ALL"
+
+// TrustFilePath returns the trust list location,
+// $XDG_CONFIG_HOME/goahead/trusted or ~/.config/goahead/trusted
+func TrustFilePath() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "goahead", "trusted"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot locate trust file: %v", err)
+	}
+	return filepath.Join(home, ".config", "goahead", "trusted"), nil
+}
+
+// LoadTrustedDirs reads the trust list: one absolute directory per line,
+// blank lines and # comments ignored. A missing file is an empty list.
+func LoadTrustedDirs() ([]string, error) {
+	path, err := TrustFilePath()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust file %s: %v", path, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var dirs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dirs = append(dirs, filepath.Clean(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trust file %s: %v", path, err)
+	}
+	return dirs, nil
+}
+
+// IsTrusted reports whether helpers under dir may be executed: dir is inside
+// a trusted directory, or GOAHEAD_TRUST_ALL=1
+func IsTrusted(dir string) bool {
+	if os.Getenv(TrustAllEnv) == "1" {
+		return true
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	trusted, err := LoadTrustedDirs()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "[goahead] WARNING: %v\n", err)
+		return false
+	}
+	for _, t := range trusted {
+		if PathWithin(absDir, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTrustedDir appends dir (made absolute) to the trust list. It returns
+// false when dir was already listed.
+func AddTrustedDir(dir string) (bool, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, fmt.Errorf("invalid directory %s: %v", dir, err)
+	}
+	dirs, err := LoadTrustedDirs()
+	if err != nil {
+		return false, err
+	}
+	for _, d := range dirs {
+		if d == absDir {
+			return false, nil
+		}
+	}
+	return true, writeTrustedDirs(append(dirs, absDir))
+}
+
+// RemoveTrustedDir removes dir from the trust list. It returns false when dir
+// was not listed.
+func RemoveTrustedDir(dir string) (bool, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, fmt.Errorf("invalid directory %s: %v", dir, err)
+	}
+	dirs, err := LoadTrustedDirs()
+	if err != nil {
+		return false, err
+	}
+	kept := dirs[:0]
+	for _, d := range dirs {
+		if d != absDir {
+			kept = append(kept, d)
+		}
+	}
+	if len(kept) == len(dirs) {
+		return false, nil
+	}
+	return true, writeTrustedDirs(kept)
+}
+
+func writeTrustedDirs(dirs []string) error {
+	path, err := TrustFilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create trust file directory: %v", err)
+	}
+	var b strings.Builder
+	b.WriteString("# Directories whose goahead helpers may run in toolexec mode\n")
+	for _, d := range dirs {
+		b.WriteString(d)
+		b.WriteString("\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write trust file %s: %v", path, err)
+	}
+	return nil
+}
+
+// warnedTTL is how long the record of a warning is kept; a go command
+// that runs longer may warn again
+const warnedTTL = 24 * time.Hour
+
+// warnUntrusted prints the untrusted-module warning once per go command:
+// toolexec runs one goahead process per package, so a record keyed by the
+// module root and the parent go process, kept next to the trust file,
+// suppresses repeats. Records of earlier go commands are pruned.
+func warnUntrusted(root string) {
+	if trustFile, err := TrustFilePath(); err == nil {
+		dir := filepath.Join(filepath.Dir(trustFile), "warned")
+		pruneWarned(dir)
+		sum := sha256.Sum256([]byte(root + "\x00" + strconv.Itoa(os.Getppid())))
+		record := filepath.Join(dir, hex.EncodeToString(sum[:8]))
+		if os.MkdirAll(dir, 0o755) == nil {
+			if f, err := os.OpenFile(record, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644); err == nil {
+				_ = f.Close()
+			} else if os.IsExist(err) {
+				return
+			}
+		}
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, `[goahead] ==================================================================
+[goahead] WARNING: helper execution disabled for untrusted module
+[goahead]   %s
+[goahead] goahead helpers run arbitrary code at build time. Markers in this
+[goahead] module were left untouched. If you trust this code, run:
+[goahead]   goahead trust add %s
+[goahead] or set %s=1 to trust every module.
+[goahead] ==================================================================
+`, root, root, TrustAllEnv)
+}
+
+// pruneWarned removes the warning records older than warnedTTL
+func pruneWarned(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > warnedTTL {
+			_ = os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
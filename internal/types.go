@@ -1,12 +1,18 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"go/token"
+	"io"
+	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
+	"time"
+
+	"github.com/AeonDave/goahead/marker"
 )
 
 // pathsEqual compares two paths for equality, handling case-insensitivity on Windows
@@ -18,11 +24,81 @@ func pathsEqual(p1, p2 string) bool {
 }
 
 type UserFunction struct {
-	Name       string
+	// Name is the name markers call the helper by, ns.Func when its file
+	// declares //go:ahead namespace ns
+	Name      string
+	Namespace string
+	// TypeParams names the type parameters of a generic helper, which a
+	// marker instantiates as in //:Max[int]:3:7
+	TypeParams []string
 	InputTypes []string
-	OutputType string
-	FilePath   string
-	Depth      int // Depth relative to RootDir (0 = root)
+	// Variadic is set when the last parameter is ...T, the last of
+	// InputTypes; VariadicElem is T, the type of each trailing argument
+	Variadic     bool
+	VariadicElem string
+	OutputType   string
+	FilePath     string
+	// OutputTypes lists every result type; OutputType is the first of them
+	OutputTypes []string
+	Line        int    // Line of the declaration in FilePath
+	Depth       int    // Depth relative to RootDir (0 = root)
+	Doc         string // First line of the helper's doc comment, if any
+	// NotInlinable is set when OutputType has no literal form that compiles
+	// in the target file (pointers, funcs, channels, errors)
+	NotInlinable bool
+	// NoCache is set by a //goahead:nocache line in the doc comment: every
+	// call is evaluated, its result is never cached or shared with an
+	// identical call, and it is reported as not reproducible
+	NoCache bool
+	// Timeout and MaxMem (bytes) limit each call, set by //goahead:timeout
+	// and //goahead:maxmem lines in the doc comment; zero means no limit
+	Timeout time.Duration
+	MaxMem  int64
+}
+
+// Signature renders the function as "Name(in1, in2) out", with the results
+// in parentheses when there are several, for diagnostics and listings
+func (fn *UserFunction) Signature() string {
+	name := fn.Name
+	if len(fn.TypeParams) > 0 {
+		name += "[" + strings.Join(fn.TypeParams, ", ") + "]"
+	}
+	sig := fmt.Sprintf("%s(%s)", name, strings.Join(fn.InputTypes, ", "))
+	switch {
+	case len(fn.OutputTypes) > 1:
+		sig += " (" + strings.Join(fn.OutputTypes, ", ") + ")"
+	case fn.OutputType != "":
+		sig += " " + fn.OutputType
+	}
+	return sig
+}
+
+// DeclName returns the name of the helper as declared in its file
+func (fn *UserFunction) DeclName() string {
+	if fn.Namespace == "" {
+		return fn.Name
+	}
+	return strings.TrimPrefix(fn.Name, fn.Namespace+".")
+}
+
+// programName returns the identifier of the helper in evaluation programs,
+// where the declarations of a namespace file are renamed (see
+// namespacedName)
+func (fn *UserFunction) programName() string {
+	if fn.Namespace == "" {
+		return fn.Name
+	}
+	return namespacedName(fn.Namespace, fn.DeclName())
+}
+
+// DuplicateResolution records how a same-depth duplicate was settled by the
+// configured duplicate policy
+type DuplicateResolution struct {
+	Name        string
+	Depth       int
+	Policy      string
+	Definitions []*UserFunction // All definitions in lexical file order
+	Kept        *UserFunction   // nil when the policy dropped every definition
 }
 
 type ProcessorContext struct {
@@ -37,22 +113,160 @@ type ProcessorContext struct {
 	// RootDir is the root directory being processed (for hierarchy resolution)
 	RootDir string
 
+	// DepthRoot is the directory helper depths are counted from: the module
+	// root when RootDir is a subdirectory of a module, otherwise RootDir.
+	// Set by CollectAllGoFiles.
+	DepthRoot string
+
 	// Verbose enables detailed logging
 	Verbose bool
 
+	// Log writes category-tagged verbose messages; see Logger()
+	Log *Logger
+
 	// Submodules contains paths to directories with their own go.mod (treated as separate projects)
 	Submodules []string
 
+	// Config holds the options this run was started with
+	Config Config
+
+	// Annotations collects literal provenance for -annotations (nil when disabled)
+	Annotations *AnnotationSet
+
+	// Skipped collects markers that did not produce a replacement
+	Skipped *SkipReport
+
+	// Diagnostics collects structured warnings other than skipped markers
+	Diagnostics *Diagnostics
+
+	// Tracer saves evaluation programs for -trace-dir (nil when disabled)
+	Tracer *Tracer
+
+	// ConstSink collects the values of -const-sink (nil when disabled)
+	ConstSink *ConstSink
+
+	// Stats counts the work of the run
+	Stats *RunStats
+
+	// hooks reports progress through Config.Hooks; see events
+	hooks *hookSet
+
+	// index records the run for -incremental (nil when disabled)
+	index *incrementalIndex
+
+	// backups records the edits of the run for -backup (nil when disabled)
+	backups *backupSet
+	// staged holds the rewrites -paranoid has yet to check
+	staged stagedRewrites
+	// dry holds the writes of a -dry-run (nil when disabled)
+	dry *dryRun
+
+	// results is the persistent result cache (nil with -no-cache)
+	results *resultCache
+
+	// Interrupt is done once the run receives SIGINT or SIGTERM (nil when
+	// signals are not watched); no new file or evaluation starts after that
+	Interrupt context.Context
+
+	// UnexportedHelpers maps lowercase helper names to their files so skipped
+	// markers can point at them
+	UnexportedHelpers map[string]string
+
+	// ParentHelpers holds helpers of enclosing modules, which submodule
+	// isolation hides; used only to explain skipped markers
+	ParentHelpers map[string]*UserFunction
+
+	// DuplicateResolutions lists same-depth duplicates settled by a non-error policy
+	DuplicateResolutions []DuplicateResolution
+
 	FileSet     *token.FileSet
 	CurrentFile string
 	FuncFiles   []string
-	TempDir     string
+
+	// HelperDirFiles marks helper files discovered through Config.HelperDirs
+	HelperDirFiles map[string]bool
+
+	// BrokenHelpers lists helper files that could not be read or parsed
+	BrokenHelpers []BrokenHelper
+
+	// ImportAliases maps aliases declared with //go:ahead import to their
+	// package paths; they take precedence over standard library names
+	ImportAliases map[string]ImportAlias
+
+	// HelperNamespaces maps helper files declaring //go:ahead namespace to
+	// the namespace their helpers are called in
+	HelperNamespaces map[string]string
+
+	// FileImports are the //go:ahead import aliases in the header of the
+	// file being processed; they take precedence over ImportAliases
+	FileImports map[string]ImportAlias
+
+	// Variables are the ${name} marker variables of the module
+	Variables *Variables
+	TempDir   string
+
+	// syntax is the marker grammar at the module's syntax level, set by
+	// resolveSyntax; syntaxOrigin says where the level comes from
+	syntax       *marker.Syntax
+	syntaxOrigin string
+	// syntaxDecl is the //go:ahead syntax directive of the module's helpers
+	syntaxDecl *syntaxDeclaration
+
+	// build is the -respect-build-tags matcher; see buildFilter
+	build       *buildMatcher
+	buildLoaded bool
+
+	// exclude holds the -exclude globs and .goaheadignore patterns of the
+	// module, nil when there are none
+	exclude *excludeRules
+}
+
+// BrokenHelper is a helper file that could not be loaded
+type BrokenHelper struct {
+	File string
+	Err  error
+}
+
+// MarkerSyntax returns the marker grammar of the run: the one for
+// Config.MarkerPrefix, or the default "//:" grammar, at the module's syntax
+// level once it is known
+func (ctx *ProcessorContext) MarkerSyntax() *marker.Syntax {
+	if ctx.syntax != nil {
+		return ctx.syntax
+	}
+	if ctx.Config.markers != nil {
+		return ctx.Config.markers
+	}
+	return marker.Default
+}
+
+// Tags returns the provenance comment format of the run
+func (ctx *ProcessorContext) Tags() *TagFormat {
+	if ctx.Config.tags != nil {
+		return ctx.Config.tags
+	}
+	tags, _ := ParseTagFormat(DefaultTagFormat)
+	ctx.Config.tags = tags
+	return tags
+}
+
+// Logger returns the context logger, deriving one from Verbose when unset
+func (ctx *ProcessorContext) Logger() *Logger {
+	if ctx.Log == nil {
+		ctx.Log = NewLogger("").OrAll(ctx.Verbose)
+	}
+	return ctx.Log
 }
 
-// CalculateDepth returns the depth of a directory relative to RootDir
+// CalculateDepth returns the depth of a directory relative to DepthRoot,
+// or RootDir when DepthRoot is unset
 func (ctx *ProcessorContext) CalculateDepth(dir string) int {
+	root := ctx.RootDir
+	if ctx.DepthRoot != "" {
+		root = ctx.DepthRoot
+	}
 	// Normalize paths
-	rootClean := filepath.Clean(ctx.RootDir)
+	rootClean := filepath.Clean(root)
 	dirClean := filepath.Clean(dir)
 
 	// If same as root, depth is 0
@@ -78,11 +292,43 @@ func (ctx *ProcessorContext) CalculateDepth(dir string) int {
 	return len(parts)
 }
 
+// HelperFileDepth returns the depth at which helpers from file are registered:
+// Config.HelperDepth for files found in helper directories, otherwise the
+// depth of the file's own directory
+func (ctx *ProcessorContext) HelperFileDepth(file string) int {
+	if ctx.HelperDirFiles[file] {
+		return ctx.Config.HelperDepth
+	}
+	dir := filepath.Dir(file)
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		absDir = dir
+	}
+	return ctx.CalculateDepth(absDir)
+}
+
+// outerHelpers merges this module's helpers into ParentHelpers, shallowest
+// definitions winning, for use by nested submodules
+func (ctx *ProcessorContext) outerHelpers() map[string]*UserFunction {
+	merged := make(map[string]*UserFunction, len(ctx.ParentHelpers))
+	for name, fn := range ctx.ParentHelpers {
+		merged[name] = fn
+	}
+	for depth := ctx.GetMaxDepth(); depth >= 0; depth-- {
+		for name, fn := range ctx.FunctionsByDepth[depth] {
+			merged[name] = fn
+		}
+	}
+	return merged
+}
+
 // ResolveFunction finds a function using depth-based resolution.
 // It first searches from the source file's depth down to depth 0 (closest wins).
 // If not found, it searches deeper depths so all project helpers are visible.
 // Returns the function and the helper file path it came from.
 func (ctx *ProcessorContext) ResolveFunction(name, sourceDir string) (*UserFunction, string) {
+	// A generic helper is found by its name, without the instantiation
+	name, _ = marker.SplitTypeArgs(name)
 	sourceDepth := ctx.CalculateDepth(sourceDir)
 
 	// Search from sourceDepth down to 0 (closest definitions take priority)
@@ -164,4 +410,357 @@ type Config struct {
 	Verbose bool
 	Help    bool
 	Version bool
+
+	// LogCategories is a GOAHEAD_VERBOSE style spec ("replace,inject") enabling
+	// individual verbose categories; Verbose enables all of them
+	LogCategories string
+
+	// Annotations is the path of an optional JSON file mapping generated
+	// literals (module-relative file:line) back to the helpers that produced them
+	Annotations string
+
+	// OnDuplicate selects how same-depth duplicate helpers are handled:
+	// "error" (default), "first" or "skip"
+	OnDuplicate string
+
+	// Diagnostics is an optional "format:path" (sarif or checkstyle) output
+	// for the warnings and errors of the run
+	Diagnostics string
+
+	// RequireTrust disables helper execution unless the module root is in
+	// the trust list; set for toolexec runs, where the user never named the
+	// directory explicitly
+	RequireTrust bool
+
+	// Offline forbids module downloads for the evaluation program (GOPROXY=off)
+	Offline bool
+
+	// FreezeTime, an RFC 3339 time, is what goaheadNow() returns to helpers;
+	// empty leaves goaheadNow as time.Now
+	FreezeTime string
+
+	// Env holds KEY=VALUE variables set for helpers, not for the go
+	// command; EnvIsolate hides every other variable from them, except
+	// GOAHEAD_PROJECT_ROOT
+	Env        []string
+	EnvIsolate bool
+
+	// Format runs go/format on the final content of every file the run
+	// modified; unmodified files are never reformatted
+	Format bool
+
+	// Profile selects the [profile.<name>] section of .goahead.toml whose
+	// variables markers can reference as ${name}; empty falls back to
+	// GOAHEAD_PROFILE, then to the file's profile key
+	Profile string
+
+	// ModFlag is the outer build's -mod value, reused for the evaluation program
+	ModFlag string
+
+	// Strict turns skipped markers into an error at the end of the run
+	Strict bool
+
+	// Check evaluates every marker without writing anything, as DryRun
+	// does, but prints no diff and fails the run, as Strict does, when any
+	// marker is skipped
+	Check bool
+
+	// DryRun keeps the rewrites of the run in memory and writes them, as
+	// unified diffs against the sources, to DiffOutput (stdout when nil)
+	// instead of rewriting files
+	DryRun     bool
+	DiffOutput io.Writer
+
+	// Backup records the lines each rewritten file had before the run in
+	// .goahead/backup.json, which goahead restore reverts
+	Backup bool
+
+	// NoCache neither reads nor writes the persistent result cache, which
+	// otherwise serves helper results of earlier runs
+	NoCache bool
+
+	// WarningsExitCode is the exit status of the CLI for a run that succeeded
+	// with warnings or skipped markers: ExitOK (the default) or ExitWarnings
+	WarningsExitCode int
+
+	// SkipBrokenHelpers downgrades unreadable or unparsable helper files from
+	// an error to warnings; their helpers are then unavailable
+	SkipBrokenHelpers bool
+
+	// StrictDirectives turns unknown //go:ahead directive names from
+	// warnings into errors
+	StrictDirectives bool
+
+	// ExecTimeout stops any evaluation program, compilation included, that
+	// runs longer; zero means no limit. Helpers can declare tighter limits
+	// of their own with //goahead:timeout.
+	ExecTimeout time.Duration
+
+	// LockTTL is the age after which another process's <file>.goahead.lock
+	// is considered stale; younger locks make the file be skipped. Zero
+	// means DefaultLockTTL.
+	LockTTL time.Duration
+
+	// MaxLiteralSize is the largest value, in bytes, a marker may write into
+	// a literal; larger values skip the marker. Zero means
+	// DefaultMaxLiteralSize.
+	MaxLiteralSize int
+
+	// MaxInjectSize is the largest block of injected code, in bytes, for one
+	// file. Zero means DefaultMaxInjectSize.
+	MaxInjectSize int
+
+	// FenceStyle is a -fence-style spec for the fences and blank lines of
+	// injected blocks (see ParseFenceStyle); empty means DefaultFenceStyle
+	FenceStyle string
+
+	// HelperDirs lists directories (relative to Dir) whose .go files are
+	// helper files even without the //go:ahead functions marker
+	HelperDirs []string
+
+	// Exclude lists doublestar globs, relative to the module root, of paths
+	// the walk never enters; they add to the patterns of .goaheadignore
+	Exclude []string
+
+	// CacheDir is the directory of the persistent result cache, "off" to
+	// disable it; GOAHEAD_CACHE takes precedence, and the goahead directory
+	// of the Go build cache is used when both are empty
+	CacheDir string
+
+	// HelperDepth is the visibility depth assigned to helpers loaded from
+	// HelperDirs; 0 (the default) makes them visible across the module
+	HelperDepth int
+
+	// Jobs evaluates the markers of a file in separate programs, up to Jobs
+	// at once; 0 (the default) evaluates a file's markers in one program
+	Jobs int
+
+	// SingleProgram evaluates the markers of all the files of a directory
+	// in one program before any file is rewritten, instead of one program
+	// per file
+	SingleProgram bool
+
+	// FileJobs evaluates the markers of up to FileJobs files at once, one
+	// program per file, before the files are rewritten one by one in order;
+	// 0 (the default) uses GOMAXPROCS and 1 evaluates each file as it is
+	// rewritten. It does not apply with Jobs or SingleProgram.
+	FileJobs int
+
+	// TraceDir saves every evaluation program with its command, environment
+	// and output into numbered subdirectories (see Tracer)
+	TraceDir string
+
+	// TraceLimit is the number of programs TraceDir saves; 0 means no limit
+	TraceLimit int
+
+	// MarkerPrefix replaces the "//:" trigger prefix of markers, e.g. "//ga:"
+	// when another generator uses "//:" comments. //go:ahead directives are
+	// not affected. Empty means marker.DefaultPrefix.
+	MarkerPrefix string
+
+	// TagReplacements appends a provenance comment rendered from TagFormat
+	// to every line a marker replaced, e.g. //g:Shadow("ntdll")@v1.4.0
+	TagReplacements bool
+
+	// TagFormat is the -tag-format template of those comments; empty means
+	// DefaultTagFormat
+	TagFormat string
+
+	// ConstSink, when set, is a .go file (relative to Dir) that receives
+	// every string, number and bool value as a constant; marker targets
+	// then refer to the constant instead of holding the literal
+	ConstSink string
+
+	// Redact hides helper arguments and values in progress lines and
+	// provenance comments
+	Redact bool
+
+	// RespectBuildTags skips consumer files whose build constraints exclude
+	// them from the target build: GOOS and GOARCH from the environment, plus
+	// BuildTags and the -tags of GOFLAGS
+	RespectBuildTags bool
+
+	// BuildTags are the extra tags of the target build (go build -tags)
+	BuildTags []string
+
+	// BuildFiles lists the files of one compiler invocation in toolexec
+	// mode; they always belong to the target build
+	BuildFiles []string
+
+	// Paranoid checks every rewritten file against its original and undoes
+	// rewrites that changed code outside marker targets and injected blocks
+	Paranoid bool
+
+	// Incremental processes only the files whose content, helpers or
+	// .goahead.toml changed since the run that wrote IndexFileName, and the
+	// files that had skipped markers then
+	Incremental bool
+
+	// Out, when set, leaves the sources alone: the module holding Dir is
+	// mirrored into Out and processed there
+	Out string
+
+	// Companion leaves the sources alone too: the values of package-level
+	// variables are assigned by an init function of a <name>_goahead.go
+	// file next to each source, and markers with other targets are skipped
+	Companion bool
+
+	// OutLink is how Out holds files: OutLinkCopy (the default), OutLinkHard
+	// or OutLinkSymlink. Files the run rewrites become copies either way.
+	OutLink string
+
+	// Hooks receive the progress events of the run (see Hooks); nil means
+	// only the CLI's progress lines
+	Hooks *Hooks
+
+	// Runner, when set, runs the go commands of helper evaluation instead of
+	// the go binary in PATH; tests and benchmarks use it to leave the
+	// toolchain out
+	Runner Runner
+
+	// Patterns limits processing to the packages matched by Go package
+	// patterns (./..., ./cmd/...), resolved relative to Dir. Helper files in
+	// the parent directories of matched packages stay visible.
+	Patterns []string
+
+	// packageDirs is the expansion of Patterns; nil processes every directory
+	packageDirs map[string]bool
+
+	// markers is the compiled grammar of MarkerPrefix; see compileMarkerSyntax
+	markers *marker.Syntax
+
+	// tags is the compiled TagFormat; see compileMarkerSyntax
+	tags *TagFormat
+
+	// sourceRoot, set by toolexec runs, is the module root the Out mirror
+	// stands for; see Config.sourcePath
+	sourceRoot string
+}
+
+// DuplicatePolicy returns the effective duplicate policy, defaulting to "error"
+func (c Config) DuplicatePolicy() string {
+	if c.OnDuplicate == "" {
+		return DuplicatePolicyError
+	}
+	return c.OnDuplicate
+}
+
+// ActiveProfile returns the profile selected by -profile or GOAHEAD_PROFILE
+func (c Config) ActiveProfile() string {
+	if c.Profile != "" {
+		return c.Profile
+	}
+	return os.Getenv(ProfileEnv)
+}
+
+// Validate checks option values that cannot be enforced by the flag parser
+func (c Config) Validate() error {
+	switch c.DuplicatePolicy() {
+	case DuplicatePolicyError, DuplicatePolicyFirst, DuplicatePolicySkip:
+	default:
+		return fmt.Errorf("invalid -on-duplicate value %q (expected %s, %s or %s)",
+			c.OnDuplicate, DuplicatePolicyError, DuplicatePolicyFirst, DuplicatePolicySkip)
+	}
+	if c.Diagnostics != "" {
+		if _, _, err := ParseDiagnosticsSpec(c.Diagnostics); err != nil {
+			return err
+		}
+	}
+	if c.HelperDepth < 0 {
+		return fmt.Errorf("invalid -helper-depth value %d (must be 0 or greater)", c.HelperDepth)
+	}
+	if c.MaxLiteralSize < 0 {
+		return fmt.Errorf("invalid -max-literal-size value %d (must be 0 or greater)", c.MaxLiteralSize)
+	}
+	if c.MaxInjectSize < 0 {
+		return fmt.Errorf("invalid -max-inject-size value %d (must be 0 or greater)", c.MaxInjectSize)
+	}
+	if c.Jobs < 0 {
+		return fmt.Errorf("invalid -jobs value %d (must be 0 or greater)", c.Jobs)
+	}
+	if c.FileJobs < 0 {
+		return fmt.Errorf("invalid -file-jobs value %d (must be 0 or greater)", c.FileJobs)
+	}
+	if c.ExecTimeout < 0 {
+		return fmt.Errorf("invalid -exec-timeout value %v (must be 0 or greater)", c.ExecTimeout)
+	}
+	if c.TraceLimit < 0 {
+		return fmt.Errorf("invalid -trace-limit value %d (must be 0 or greater)", c.TraceLimit)
+	}
+	if _, err := ParseFenceStyle(c.FenceStyle); err != nil {
+		return err
+	}
+	if c.ConstSink != "" && (!strings.HasSuffix(c.ConstSink, ".go") || strings.HasSuffix(c.ConstSink, "_test.go")) {
+		return fmt.Errorf("invalid -const-sink %q: must be a .go file that is not a test", c.ConstSink)
+	}
+	switch c.OutLink {
+	case "", OutLinkCopy, OutLinkHard, OutLinkSymlink:
+	default:
+		return fmt.Errorf("invalid -out-link value %q (expected %s, %s or %s)", c.OutLink, OutLinkCopy, OutLinkHard, OutLinkSymlink)
+	}
+	if c.WarningsExitCode != ExitOK && c.WarningsExitCode != ExitWarnings {
+		return fmt.Errorf("invalid -warnings-exit-code %d (expected %d or %d)", c.WarningsExitCode, ExitOK, ExitWarnings)
+	}
+	if err := c.validateHarness(); err != nil {
+		return err
+	}
+	if c.Check && c.Out != "" {
+		return fmt.Errorf("-check cannot be combined with -out, which writes the processed tree")
+	}
+	if c.Check && c.Backup {
+		return fmt.Errorf("-check cannot be combined with -backup, which records the rewrites")
+	}
+	if c.Check && c.Annotations != "" {
+		return fmt.Errorf("-check cannot be combined with -annotations, which writes a file")
+	}
+	if c.DryRun && c.Out != "" {
+		return fmt.Errorf("-dry-run cannot be combined with -out, which writes the processed tree")
+	}
+	if c.DryRun && c.Backup {
+		return fmt.Errorf("-dry-run cannot be combined with -backup, which records the rewrites")
+	}
+	if c.DryRun && c.Annotations != "" {
+		return fmt.Errorf("-dry-run cannot be combined with -annotations, which writes a file")
+	}
+	if c.Companion && c.ConstSink != "" {
+		return fmt.Errorf("-companion cannot be combined with -const-sink, which rewrites the marker targets")
+	}
+	if c.Companion && c.TagReplacements {
+		return fmt.Errorf("-companion cannot be combined with -tag-replacements, which rewrites the marker targets")
+	}
+	if c.Out != "" && c.Incremental {
+		return fmt.Errorf("-incremental cannot be combined with -out: every -out run mirrors the tree afresh")
+	}
+	if _, err := ParseTagFormat(c.TagFormat); err != nil {
+		return err
+	}
+	if c.MarkerPrefix != "" {
+		if _, err := marker.NewSyntax(c.MarkerPrefix); err != nil {
+			return fmt.Errorf("invalid -marker-prefix: %v", err)
+		}
+	}
+	return nil
+}
+
+// Fence returns the parsed FenceStyle; Validate has already rejected
+// invalid specs
+func (c Config) Fence() FenceStyle {
+	style, err := ParseFenceStyle(c.FenceStyle)
+	if err != nil {
+		return DefaultFenceStyle
+	}
+	return style
+}
+
+// compileMarkerSyntax compiles MarkerPrefix and TagFormat once per run;
+// Validate has already rejected invalid values
+func (c *Config) compileMarkerSyntax() {
+	if c.MarkerPrefix != "" && c.markers == nil {
+		c.markers = marker.MustNewSyntax(c.MarkerPrefix)
+	}
+	if c.tags == nil {
+		if tags, err := ParseTagFormat(c.TagFormat); err == nil {
+			c.tags = tags
+		}
+	}
 }
@@ -0,0 +1,542 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// errByteArrayLength is wrapped by errors for byte results whose length is
+// not that of the [N]byte array they are written to
+var errByteArrayLength = errors.New("length mismatch")
+
+// literalSpan is a literal of a marker's target line: its byte offsets and
+// its class, "string", "int", "float" or "bool". A number keeps its sign.
+type literalSpan struct {
+	start, end int
+	class      string
+}
+
+// lineTokens scans code as Go source; comments are returned as tokens so
+// callers can leave them alone
+func lineTokens(code string) []lineToken {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(code))
+	var s scanner.Scanner
+	s.Init(file, []byte(code), func(token.Position, string) {}, scanner.ScanComments)
+	var tokens []lineToken
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return tokens
+		}
+		// Automatic semicolons are not part of the line
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		start := file.Offset(pos)
+		end := start + len(lit)
+		if lit == "" {
+			end = start + len(tok.String())
+		}
+		tokens = append(tokens, lineToken{tok: tok, lit: lit, start: start, end: min(end, len(code))})
+	}
+}
+
+// lineToken is one token of a line, at code[start:end]
+type lineToken struct {
+	tok        token.Token
+	lit        string
+	start, end int
+}
+
+// codeEnd returns the offset where the trailing comment of code starts,
+// blanks before it included; len(code) when it has none
+func codeEnd(code string) int {
+	for _, t := range lineTokens(code) {
+		if t.tok == token.COMMENT {
+			return len(strings.TrimRight(code[:t.start], " \t"))
+		}
+	}
+	return len(code)
+}
+
+// splitAssignment splits line at its first "=" or ":=" outside brackets:
+// head runs through the operator and the blanks after it, value is the
+// assigned expression and rest the trailing comment with the blanks before
+// it. ok is false for lines that assign nothing.
+func splitAssignment(line string) (head, value, rest string, ok bool) {
+	depth := 0
+	for _, t := range lineTokens(line) {
+		switch t.tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.ASSIGN, token.DEFINE:
+			if depth != 0 {
+				continue
+			}
+			valueStart := t.end
+			for valueStart < len(line) && (line[valueStart] == ' ' || line[valueStart] == '\t') {
+				valueStart++
+			}
+			end := valueStart + codeEnd(line[valueStart:])
+			return line[:valueStart], line[valueStart:end], line[end:], true
+		case token.COMMENT:
+			return "", "", "", false
+		}
+	}
+	return "", "", "", false
+}
+
+// splitKeyedElement splits a keyed element of a composite literal, such as
+// `Name: "",` or `"http": 0, // comment`, after its colon: head runs through
+// the colon and the blanks after it, value is the element's value and rest
+// its trailing comma and comment. ok is false for other lines, for case
+// clauses and labels, and for values continuing on the next lines.
+func splitKeyedElement(line string) (head, value, rest string, ok bool) {
+	tokens := lineTokens(line)
+	colon := -1
+	for i, t := range tokens {
+		if t.tok == token.COLON {
+			colon = i
+			break
+		}
+		// A key is a name, a qualified name or a basic literal
+		switch t.tok {
+		case token.IDENT, token.PERIOD, token.STRING, token.INT, token.FLOAT, token.CHAR:
+		default:
+			return "", "", "", false
+		}
+	}
+	if colon <= 0 {
+		return "", "", "", false
+	}
+	depth := 0
+	for _, t := range tokens[colon+1:] {
+		switch t.tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		}
+	}
+	valueStart := tokens[colon].end
+	for valueStart < len(line) && (line[valueStart] == ' ' || line[valueStart] == '\t') {
+		valueStart++
+	}
+	code := line[valueStart : valueStart+codeEnd(line[valueStart:])]
+	value = strings.TrimRight(strings.TrimSuffix(strings.TrimRight(code, " \t"), ","), " \t")
+	if depth != 0 || value == "" {
+		return "", "", "", false
+	}
+	return line[:valueStart], value, line[valueStart+len(value):], true
+}
+
+// splitValue splits line around the value a marker replaces: the assigned
+// expression of an assignment or the value of a keyed element
+func splitValue(line string) (head, value, rest string, ok bool) {
+	if head, value, rest, ok := splitAssignment(line); ok {
+		return head, value, rest, ok
+	}
+	return splitKeyedElement(line)
+}
+
+// valueLiterals returns the literals of expression in source order, leaving
+// out its trailing comment and the lengths of array types such as the 4 of
+// NewRing[[4]int](0). Expressions that parse are walked as a syntax tree;
+// partial ones, such as the first line of a call spanning several lines,
+// are scanned token by token.
+func valueLiterals(expression string) []literalSpan {
+	code := expression[:codeEnd(expression)]
+	src := strings.TrimSuffix(strings.TrimRight(code, " \t"), ",")
+	if expr, err := parser.ParseExpr(src); err == nil {
+		return astLiterals(expr)
+	}
+
+	var spans []literalSpan
+	for _, t := range lineTokens(code) {
+		span := literalSpan{start: t.start, end: t.end}
+		switch {
+		case t.tok == token.STRING && len(t.lit) >= 2 && t.lit[len(t.lit)-1] == t.lit[0]:
+			// An unterminated raw string continues on the next lines
+			span.class = "string"
+		case t.tok == token.INT && !isArrayLength(code, t.start, t.end):
+			span.class = "int"
+		case t.tok == token.FLOAT:
+			span.class = "float"
+		case t.tok == token.IDENT && (t.lit == "true" || t.lit == "false"):
+			span.class = "bool"
+		default:
+			continue
+		}
+		if span.class == "int" || span.class == "float" {
+			if isUnaryMinus(code, span.start) {
+				span.start--
+			}
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// astLiterals lists the literals of expr; positions are those of an
+// expression parsed on its own
+func astLiterals(expr ast.Expr) []literalSpan {
+	var spans []literalSpan
+	add := func(node ast.Node, class string) {
+		spans = append(spans, literalSpan{start: int(node.Pos()) - 1, end: int(node.End()) - 1, class: class})
+	}
+	var visit func(ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.StructType, *ast.InterfaceType:
+			return false
+		case *ast.UnaryExpr:
+			if lit, ok := n.X.(*ast.BasicLit); ok && (n.Op == token.SUB || n.Op == token.ADD) && (lit.Kind == token.INT || lit.Kind == token.FLOAT) {
+				add(n, basicLitClass(lit.Kind))
+				return false
+			}
+		case *ast.BasicLit:
+			if class := basicLitClass(n.Kind); class != "" {
+				add(n, class)
+			}
+		case *ast.SelectorExpr:
+			// The true of pkg.true is not the constant
+			ast.Inspect(n.X, visit)
+			return false
+		case *ast.Ident:
+			if n.Name == "true" || n.Name == "false" {
+				add(n, "bool")
+			}
+		}
+		return true
+	}
+	ast.Inspect(expr, visit)
+	return spans
+}
+
+func basicLitClass(kind token.Token) string {
+	switch kind {
+	case token.STRING:
+		return "string"
+	case token.INT:
+		return "int"
+	case token.FLOAT:
+		return "float"
+	}
+	return ""
+}
+
+// firstLiteral returns the first literal of expression a value of typeHint
+// replaces, and its index among the literals of expression: strings replace
+// strings, booleans booleans, integers integers, and floats the first float,
+// or else the first integer. The literals at the indexes in taken are left
+// out.
+func firstLiteral(expression, typeHint string, taken []int) (literalSpan, int, bool) {
+	return pickLiteral(valueLiterals(expression), typeHint, taken)
+}
+
+// pickLiteral is firstLiteral on the literals spans of an expression
+func pickLiteral(spans []literalSpan, typeHint string, taken []int) (literalSpan, int, bool) {
+	find := func(class string) (literalSpan, int, bool) {
+		for i, span := range spans {
+			if span.class == class && !slices.Contains(taken, i) {
+				return span, i, true
+			}
+		}
+		return literalSpan{}, -1, false
+	}
+	switch typeHint {
+	case "string", "bool":
+		return find(typeHint)
+	case "int", "uint":
+		return find("int")
+	case "float":
+		if span, i, ok := find("float"); ok {
+			return span, i, true
+		}
+		return find("int")
+	}
+	return literalSpan{}, -1, false
+}
+
+// byteSequence returns the type node of a []byte, [N]byte, []uint8 or
+// [N]uint8 type
+func byteSequence(typ ast.Expr) (*ast.ArrayType, bool) {
+	array, ok := typ.(*ast.ArrayType)
+	if !ok {
+		return nil, false
+	}
+	elt, ok := array.Elt.(*ast.Ident)
+	return array, ok && (elt.Name == "byte" || elt.Name == "uint8")
+}
+
+// valueByteType returns the type of value, a []byte{...} or [N]byte{...}
+// composite literal, as written; "" for other values
+func valueByteType(value string) string {
+	src := strings.TrimSuffix(strings.TrimRight(value[:codeEnd(value)], " \t"), ",")
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return ""
+	}
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok || lit.Type == nil {
+		return ""
+	}
+	if _, ok := byteSequence(lit.Type); !ok {
+		return ""
+	}
+	return src[lit.Type.Pos()-1 : lit.Type.End()-1]
+}
+
+// fitByteLiteral rewrites result, a byte literal such as []byte{0x68} or
+// [4]byte{0x1, ...}, with the byte type typ of its target, so that a [16]byte
+// target keeps its type; an array target takes exactly as many bytes as it
+// holds. ok is false, and result is returned unchanged, for other results
+// and targets of other types.
+func fitByteLiteral(typ, result string) (fitted string, ok bool, err error) {
+	typeExpr, err := parser.ParseExpr(typ)
+	if err != nil {
+		return result, false, nil
+	}
+	target, isBytes := byteSequence(typeExpr)
+	if !isBytes {
+		return result, false, nil
+	}
+	expr, err := parser.ParseExpr(result)
+	if err != nil {
+		return result, false, nil
+	}
+	lit, isLiteral := expr.(*ast.CompositeLit)
+	if !isLiteral || lit.Type == nil {
+		return result, false, nil
+	}
+	if _, isBytes := byteSequence(lit.Type); !isBytes {
+		return result, false, nil
+	}
+	if target.Len != nil {
+		length, isLiteral := target.Len.(*ast.BasicLit)
+		if !isLiteral || length.Kind != token.INT {
+			return result, false, nil
+		}
+		n, err := strconv.ParseInt(length.Value, 0, 64)
+		if err != nil {
+			return result, false, nil
+		}
+		if int64(len(lit.Elts)) != n {
+			return "", false, fmt.Errorf("%w: the helper returned %d byte(s) but %s holds %d", errByteArrayLength, len(lit.Elts), typ, n)
+		}
+	}
+	return typ + result[lit.Lbrace-1:], true, nil
+}
+
+// compositeType returns the type of expression, a composite literal such as
+// []string{"a"} or map[string]int{"a": 1}, as written; "" for other values
+func compositeType(expression string) string {
+	expr, err := parser.ParseExpr(expression)
+	if err != nil {
+		return ""
+	}
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok || lit.Type == nil {
+		return ""
+	}
+	switch lit.Type.(type) {
+	case *ast.ArrayType, *ast.MapType:
+		return expression[lit.Type.Pos()-1 : lit.Type.End()-1]
+	}
+	return ""
+}
+
+// compositeSpan returns the offsets of the first composite literal of type
+// typ in code, braces included; the types are compared token by token, so
+// spacing does not matter
+func compositeSpan(code, typ string) (start, end int, ok bool) {
+	want := lineTokens(typ)
+	if len(want) == 0 {
+		return 0, 0, false
+	}
+	tokens := lineTokens(code)
+next:
+	for i := 0; i+len(want) < len(tokens); i++ {
+		for j, w := range want {
+			if t := tokens[i+j]; t.tok != w.tok || t.lit != w.lit {
+				continue next
+			}
+		}
+		if tokens[i+len(want)].tok != token.LBRACE {
+			continue
+		}
+		depth := 0
+		for _, t := range tokens[i+len(want):] {
+			switch t.tok {
+			case token.LBRACE:
+				depth++
+			case token.RBRACE:
+				if depth--; depth == 0 {
+					return tokens[i].start, t.end, true
+				}
+			}
+		}
+		return 0, 0, false
+	}
+	return 0, 0, false
+}
+
+// targetSyntax is the syntax of the file whose lines are rewritten, for the
+// values that continue below their target line. It is parsed when first
+// needed and again only once the lines have changed. The file is alone in
+// its file set, so the offset of a position is pos-1, as for astLiterals.
+type targetSyntax struct {
+	src  string
+	fset *token.FileSet
+	file *ast.File
+}
+
+// parse makes s the syntax of lines, reporting false when they do not parse
+// as a Go file
+func (s *targetSyntax) parse(lines []string) bool {
+	src := strings.Join(lines, "\n")
+	if s.fset != nil && src == s.src {
+		return s.file != nil
+	}
+	s.src, s.fset = src, token.NewFileSet()
+	file, err := parser.ParseFile(s.fset, "", src, parser.SkipObjectResolution)
+	if err != nil {
+		file = nil
+	}
+	s.file = file
+	return file != nil
+}
+
+// valueAt returns the value assigned by the single-name declaration or
+// assignment, or the keyed element, that starts on line (1-based); nil when
+// there is none
+func (s *targetSyntax) valueAt(line int) ast.Expr {
+	var value ast.Expr
+	ast.Inspect(s.file, func(n ast.Node) bool {
+		if value != nil || n == nil {
+			return false
+		}
+		if s.fset.Position(n.End()).Line < line {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			if s.fset.Position(n.Pos()).Line == line && len(n.Names) == 1 && len(n.Values) == 1 {
+				value = n.Values[0]
+			}
+		case *ast.AssignStmt:
+			if s.fset.Position(n.Pos()).Line == line && len(n.Lhs) == 1 && len(n.Rhs) == 1 {
+				value = n.Rhs[0]
+			}
+		case *ast.KeyValueExpr:
+			if s.fset.Position(n.Pos()).Line == line {
+				value = n.Value
+			}
+		}
+		return value == nil
+	})
+	return value
+}
+
+// lineRange returns the offsets of src from the start of line first through
+// the end of line last, its newline left out
+func (s *targetSyntax) lineRange(first, last int) (start, end int) {
+	file := s.fset.File(s.file.Pos())
+	start = file.Offset(file.LineStart(first))
+	end = len(s.src)
+	if last < file.LineCount() {
+		end = file.Offset(file.LineStart(last+1)) - 1
+	}
+	return start, end
+}
+
+// continuesBelow reports whether the value assigned on the line code goes
+// on over the next lines: a bracket is left open, or the line ends with an
+// operator or the assignment itself
+func continuesBelow(code string) bool {
+	depth := 0
+	var last token.Token
+	for _, t := range lineTokens(code) {
+		switch t.tok {
+		case token.COMMENT:
+			continue
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		}
+		last = t.tok
+	}
+	if depth > 0 {
+		return true
+	}
+	switch last {
+	case token.RPAREN, token.RBRACK, token.RBRACE, token.INC, token.DEC, token.SEMICOLON:
+		return false
+	}
+	return last.IsOperator()
+}
+
+// continuedReplacement returns the span of src, the source of a file, that
+// a result replaces in expr, a value spanning several lines, and the text
+// it is replaced with. Byte values take the result written with their own
+// type and composite results replace the first composite literal of their
+// type; other results replace the first literal they stand for (see
+// firstLiteral), or expr as a whole when it has none.
+func continuedReplacement(src string, expr ast.Expr, formattedResult, typeHint string, taken []int) (start, end int, text string, err error) {
+	offset := func(pos token.Pos) int { return int(pos) - 1 }
+	start, end = offset(expr.Pos()), offset(expr.End())
+	if lit, ok := expr.(*ast.CompositeLit); ok && lit.Type != nil {
+		if _, isBytes := byteSequence(lit.Type); isBytes {
+			fitted, ok, err := fitByteLiteral(src[offset(lit.Type.Pos()):offset(lit.Type.End())], formattedResult)
+			if err != nil {
+				return 0, 0, "", err
+			}
+			if ok {
+				return start, end, fitted, nil
+			}
+		}
+	}
+	if typeHint == "composite" {
+		want := compositeType(formattedResult)
+		var found *ast.CompositeLit
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if lit, ok := n.(*ast.CompositeLit); ok && found == nil && lit.Type != nil && sameTokens(src[offset(lit.Type.Pos()):offset(lit.Type.End())], want) {
+				found = lit
+			}
+			return found == nil
+		})
+		if found != nil {
+			return offset(found.Pos()), offset(found.End()), formattedResult, nil
+		}
+	}
+	if span, _, ok := pickLiteral(astLiterals(expr), typeHint, taken); ok {
+		return span.start, span.end, formattedResult, nil
+	}
+	return start, end, formattedResult, nil
+}
+
+// sameTokens reports whether a and b are the same Go tokens, whatever their
+// spacing
+func sameTokens(a, b string) bool {
+	ta, tb := lineTokens(a), lineTokens(b)
+	if len(ta) == 0 || len(ta) != len(tb) {
+		return false
+	}
+	for i := range ta {
+		if ta[i].tok != tb[i].tok || ta[i].lit != tb[i].lit {
+			return false
+		}
+	}
+	return true
+}
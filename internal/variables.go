@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AeonDave/goahead/marker"
+)
+
+// Marker variables: ${name} in marker arguments reads name from the project
+// file or the environment
+const (
+	// VariableEnvPrefix names environment variables that define or override
+	// marker variables: GOAHEAD_VAR_db_host sets ${db_host}
+	VariableEnvPrefix = "GOAHEAD_VAR_"
+	// ProfileEnv selects the active profile when -profile is not given
+	ProfileEnv = "GOAHEAD_PROFILE"
+
+	// variablesSection holds the variables shared by every profile;
+	// "[profile.<name>]" sections add to and override them
+	variablesSection = "vars"
+	profilePrefix    = "profile."
+	// profileKey is the top-level key naming the default profile
+	profileKey = "profile"
+)
+
+var (
+	variablePattern      = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	errUndefinedVariable = errors.New("undefined variable")
+)
+
+// Variables are the marker variables of one module
+type Variables struct {
+	// Profile is the active profile, empty when none is selected
+	Profile string
+	values  map[string]projectValue
+}
+
+// loadVariables reads the marker variables of the module at root for the
+// given profile; the project file's "profile" key is used when profile is empty
+func (ctx *ProcessorContext) loadVariables(root, profile string) (*Variables, error) {
+	file, err := readProjectFile(root)
+	if err != nil || file == nil {
+		return &Variables{Profile: profile}, err
+	}
+	if profile == "" {
+		if v, ok := file.Keys[profileKey]; ok {
+			if v.Kind != "string" {
+				return nil, fmt.Errorf("%s:%d: %s must be a string", file.Path, v.Line, profileKey)
+			}
+			profile = v.Value
+		}
+	}
+
+	vars := &Variables{Profile: profile, values: map[string]projectValue{}}
+	for name, value := range file.Sections[variablesSection] {
+		vars.values[name] = value
+	}
+	sections := make([]string, 0, len(file.Sections))
+	for section := range file.Sections {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	var profiles []string
+	for _, section := range sections {
+		if name, ok := strings.CutPrefix(section, profilePrefix); ok {
+			profiles = append(profiles, name)
+		} else if section != variablesSection && section != settingsSection {
+			ctx.Warn(Diagnostic{Rule: RuleProjectFile, File: file.Path, Message: fmt.Sprintf("%s: ignoring unknown section [%s]", file.Path, section)})
+		}
+	}
+	if profile != "" {
+		section, ok := file.Sections[profilePrefix+profile]
+		if !ok {
+			return nil, fmt.Errorf("profile %q is not defined in %s (profiles: %s)", profile, file.Path, listOrNone(profiles))
+		}
+		for name, value := range section {
+			vars.values[name] = value
+		}
+	}
+	for name, value := range vars.values {
+		if !variablePattern.MatchString("${" + name + "}") {
+			return nil, fmt.Errorf("%s:%d: %s is not a valid variable name", file.Path, value.Line, name)
+		}
+		if value.Kind == "array" {
+			return nil, fmt.Errorf("%s:%d: %s: variables cannot be arrays", file.Path, value.Line, name)
+		}
+	}
+	return vars, nil
+}
+
+// Interpolate substitutes every ${name} of a marker's argument string before
+// the arguments are classified. A reference making up a whole argument
+// becomes a Go literal of the variable's type, so a string variable is a
+// string argument and a number stays a number; inside a quoted argument the
+// plain value is spliced into the string.
+func (v *Variables) Interpolate(argsStr string) (string, error) {
+	if !variablePattern.MatchString(argsStr) {
+		return argsStr, nil
+	}
+	parts, err := marker.SplitArguments(argsStr)
+	if err != nil {
+		return "", err
+	}
+	for i, part := range parts {
+		if !variablePattern.MatchString(part) {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(part); err == nil {
+			value, err := v.replace(unquoted, false)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = strconv.Quote(value)
+			continue
+		}
+		if parts[i], err = v.replace(part, true); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// replace substitutes the references of s with the variables' literals or,
+// inside strings, their plain values
+func (v *Variables) replace(s string, literal bool) (string, error) {
+	var firstErr error
+	out := variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := variablePattern.FindStringSubmatch(ref)[1]
+		value, ok := v.lookup(name)
+		if !ok {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%w ${%s} (defined: %s)", errUndefinedVariable, name, listOrNone(v.names()))
+			}
+			return ref
+		}
+		if !literal {
+			return value.Value
+		}
+		if value.Kind == "string" {
+			return strconv.Quote(value.Value)
+		}
+		return value.Raw
+	})
+	return out, firstErr
+}
+
+// lookup returns the variable name. The environment overrides the project
+// file; its value is read like a project file value, so 5432 is a number
+// unless it overrides a string variable, and anything else is a string.
+func (v *Variables) lookup(name string) (projectValue, bool) {
+	var fromFile projectValue
+	var inFile bool
+	if v != nil {
+		fromFile, inFile = v.values[name]
+	}
+	env, inEnv := os.LookupEnv(VariableEnvPrefix + name)
+	if !inEnv {
+		return fromFile, inFile
+	}
+	if inFile && fromFile.Kind == "string" {
+		return projectValue{Kind: "string", Value: env}, true
+	}
+	parsed, err := parseProjectValue(strings.TrimSpace(env))
+	if err != nil || (inFile && parsed.Kind != fromFile.Kind) {
+		return projectValue{Kind: "string", Value: env}, true
+	}
+	return parsed, true
+}
+
+// names lists the defined variables, from the project file and the environment
+func (v *Variables) names() []string {
+	seen := map[string]bool{}
+	if v != nil {
+		for name := range v.values {
+			seen[name] = true
+		}
+	}
+	for _, kv := range os.Environ() {
+		if name, ok := strings.CutPrefix(kv, VariableEnvPrefix); ok {
+			name, _, _ = strings.Cut(name, "=")
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// BeforeCallHook, when set, is called with the helper name of each call
+// before its program runs, in the goroutine that runs it; tests use it to
+// make a -jobs or -file-jobs worker panic
+var BeforeCallHook func(funcName string)
+
+// WorkerPanic is a panic recovered in a worker goroutine of -jobs or
+// -file-jobs. It is raised again in the goroutine waiting for the workers,
+// so the panic handler of the run reports it; Stack is that of the worker.
+type WorkerPanic struct {
+	Value any
+	Stack []byte
+}
+
+func (p *WorkerPanic) String() string {
+	return fmt.Sprint(p.Value)
+}
+
+// workerPanics keeps the first panic of a group of worker goroutines
+type workerPanics struct {
+	mu    sync.Mutex
+	first *WorkerPanic
+}
+
+// catch is deferred by each worker
+func (w *workerPanics) catch() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.first == nil {
+		w.first = &WorkerPanic{Value: r, Stack: debug.Stack()}
+	}
+}
+
+// raise panics with the first panic of the workers; it is called once they
+// are all done
+func (w *workerPanics) raise() {
+	if w.first != nil {
+		panic(w.first)
+	}
+}
@@ -1,18 +1,25 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/AeonDave/goahead/internal"
 )
 
 func main() {
+	defer reportPanic()
 	if isToolexecMode() {
 		toolexecManager := internal.NewToolexecManager()
 		toolexecManager.RunAsToolexec()
@@ -25,6 +32,30 @@ func main() {
 		case "build", "run", "test":
 			runGoCommandWithCodegen(os.Args[1], os.Args[2:])
 			return
+		case "trust":
+			runTrustCommand(os.Args[2:])
+			return
+		case "docs":
+			runDocsCommand(os.Args[2:])
+			return
+		case "restore":
+			runRestoreCommand(os.Args[2:])
+			return
+		case "clean":
+			runCleanCommand(os.Args[2:])
+			return
+		case "list":
+			runListCommand(os.Args[2:])
+			return
+		case "clean-cache":
+			runCleanCacheCommand()
+			return
+		case "init":
+			runInitCommand(os.Args[2:])
+			return
+		case "check":
+			// goahead check [flags] [patterns] is the standalone run with -check
+			os.Args = append([]string{os.Args[0], "-check"}, os.Args[2:]...)
 		}
 	}
 
@@ -34,6 +65,7 @@ func main() {
 		return
 	}
 	config := parseFlags()
+	config.LogCategories = os.Getenv("GOAHEAD_VERBOSE")
 
 	if config.Help {
 		showHelp()
@@ -50,15 +82,60 @@ func main() {
 		fmt.Printf("Processing directory: %s\n", config.Dir)
 	}
 
-	if err := internal.RunCodegen(config.Dir, config.Verbose); err != nil {
-		log.Fatalf("Error: %v", err)
+	stats, err := internal.RunCodegenWithStats(*config)
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	if config.DryRun && stats.Pending > 0 {
+		os.Exit(internal.ExitPendingChanges)
+	}
+	if config.Check {
+		fmt.Println("[goahead] Check passed: every marker resolves")
+	}
+	if stats.Skipped > 0 || stats.Warnings > 0 {
+		os.Exit(config.WarningsExitCode)
 	}
 }
 
 // runGoCommandWithCodegen runs codegen first, then executes go build/run/test
 func runGoCommandWithCodegen(command string, args []string) {
-	verbose := os.Getenv("GOAHEAD_VERBOSE") == "1"
+	logCategories := os.Getenv("GOAHEAD_VERBOSE")
+	verbose := internal.NewLogger(logCategories).All()
 	codegenDir := "."
+	onDuplicate := ""
+	annotations := ""
+	diagnostics := ""
+	var helperDirs []string
+	var exclude []string
+	cacheDir := ""
+	helperDepth := 0
+	strict := false
+	skipBroken := false
+	strictDirectives := false
+	var lockTTL time.Duration
+	var execTimeout time.Duration
+	markerPrefix := ""
+	fenceStyle := ""
+	profile := ""
+	tagReplacements := false
+	tagFormat := ""
+	redact := false
+	respectBuildTags := false
+	incremental := false
+	paranoid := false
+	companion := false
+	var buildTags []string
+	constSink := ""
+	traceDir := ""
+	jobs := 0
+	fileJobs := 0
+	maxLiteralSize := 0
+	maxInjectSize := 0
+	traceLimit := internal.DefaultTraceLimit
+	offline := false
+	noCache := false
+	format := false
+	modFlag := ""
 
 	// Parse goahead-specific flags from args
 	var goArgs []string
@@ -68,6 +145,73 @@ func runGoCommandWithCodegen(command string, args []string) {
 			verbose = true
 			continue
 		}
+		if arg == "-strict" || arg == "--strict" {
+			strict = true
+			continue
+		}
+		if arg == "-skip-broken-helpers" || arg == "--skip-broken-helpers" {
+			skipBroken = true
+			continue
+		}
+		if arg == "-strict-directives" || arg == "--strict-directives" {
+			strictDirectives = true
+			continue
+		}
+		if arg == "-offline" || arg == "--offline" {
+			offline = true
+			continue
+		}
+		if arg == "-no-cache" || arg == "--no-cache" {
+			noCache = true
+			continue
+		}
+		if arg == "-format" || arg == "--format" {
+			format = true
+			continue
+		}
+		if arg == "-tag-replacements" || arg == "--tag-replacements" {
+			tagReplacements = true
+			continue
+		}
+		if arg == "-redact" || arg == "--redact" {
+			redact = true
+			continue
+		}
+		if arg == "-respect-build-tags" || arg == "--respect-build-tags" {
+			respectBuildTags = true
+			continue
+		}
+		if arg == "-paranoid" || arg == "--paranoid" {
+			paranoid = true
+			continue
+		}
+		if arg == "-companion" || arg == "--companion" {
+			companion = true
+			continue
+		}
+		if arg == "-incremental" || arg == "--incremental" {
+			incremental = true
+			continue
+		}
+		if strings.HasPrefix(arg, "-incremental=") || strings.HasPrefix(arg, "--incremental=") {
+			on, err := strconv.ParseBool(strings.SplitN(arg, "=", 2)[1])
+			if err != nil {
+				exitUsage("[goahead] Invalid -incremental: %v", err)
+			}
+			incremental = on
+			continue
+		}
+		// Forwarded to go as well; files outside the tagged build are skipped
+		if (arg == "-tags" || arg == "--tags") && i+1 < len(args) {
+			buildTags = internal.SplitBuildTags(args[i+1])
+		}
+		if strings.HasPrefix(arg, "-tags=") || strings.HasPrefix(arg, "--tags=") {
+			buildTags = internal.SplitBuildTags(strings.SplitN(arg, "=", 2)[1])
+		}
+		if strings.HasPrefix(arg, "-mod=") || strings.HasPrefix(arg, "--mod=") {
+			// Forwarded to go as well; the evaluation program uses the same mode
+			modFlag = strings.SplitN(arg, "=", 2)[1]
+		}
 		if arg == "-dir" || arg == "--dir" {
 			if i+1 < len(args) {
 				codegenDir = args[i+1]
@@ -79,6 +223,118 @@ func runGoCommandWithCodegen(command string, args []string) {
 			codegenDir = strings.SplitN(arg, "=", 2)[1]
 			continue
 		}
+		if strings.HasPrefix(arg, "-on-duplicate=") || strings.HasPrefix(arg, "--on-duplicate=") {
+			onDuplicate = strings.SplitN(arg, "=", 2)[1]
+			continue
+		}
+		if strings.HasPrefix(arg, "-annotations=") || strings.HasPrefix(arg, "--annotations=") {
+			annotations = strings.SplitN(arg, "=", 2)[1]
+			continue
+		}
+		if strings.HasPrefix(arg, "-diagnostics=") || strings.HasPrefix(arg, "--diagnostics=") {
+			diagnostics = strings.SplitN(arg, "=", 2)[1]
+			continue
+		}
+		if strings.HasPrefix(arg, "-helper-dirs=") || strings.HasPrefix(arg, "--helper-dirs=") {
+			helperDirs = splitList(strings.SplitN(arg, "=", 2)[1])
+			continue
+		}
+		if strings.HasPrefix(arg, "-exclude=") || strings.HasPrefix(arg, "--exclude=") {
+			exclude = append(exclude, strings.SplitN(arg, "=", 2)[1])
+			continue
+		}
+		if strings.HasPrefix(arg, "-cache-dir=") || strings.HasPrefix(arg, "--cache-dir=") {
+			cacheDir = strings.SplitN(arg, "=", 2)[1]
+			continue
+		}
+		if strings.HasPrefix(arg, "-marker-prefix=") || strings.HasPrefix(arg, "--marker-prefix=") {
+			markerPrefix = strings.SplitN(arg, "=", 2)[1]
+			continue
+		}
+		if strings.HasPrefix(arg, "-fence-style=") || strings.HasPrefix(arg, "--fence-style=") {
+			fenceStyle = strings.SplitN(arg, "=", 2)[1]
+			continue
+		}
+		if strings.HasPrefix(arg, "-profile=") || strings.HasPrefix(arg, "--profile=") {
+			profile = strings.SplitN(arg, "=", 2)[1]
+			continue
+		}
+		if strings.HasPrefix(arg, "-const-sink=") || strings.HasPrefix(arg, "--const-sink=") {
+			constSink = strings.SplitN(arg, "=", 2)[1]
+			continue
+		}
+		if strings.HasPrefix(arg, "-tag-format=") || strings.HasPrefix(arg, "--tag-format=") {
+			tagFormat = strings.SplitN(arg, "=", 2)[1]
+			continue
+		}
+		if strings.HasPrefix(arg, "-max-literal-size=") || strings.HasPrefix(arg, "--max-literal-size=") {
+			n, err := strconv.Atoi(strings.SplitN(arg, "=", 2)[1])
+			if err != nil {
+				exitUsage("[goahead] Invalid -max-literal-size: %v", err)
+			}
+			maxLiteralSize = n
+			continue
+		}
+		if strings.HasPrefix(arg, "-max-inject-size=") || strings.HasPrefix(arg, "--max-inject-size=") {
+			n, err := strconv.Atoi(strings.SplitN(arg, "=", 2)[1])
+			if err != nil {
+				exitUsage("[goahead] Invalid -max-inject-size: %v", err)
+			}
+			maxInjectSize = n
+			continue
+		}
+		if strings.HasPrefix(arg, "-jobs=") || strings.HasPrefix(arg, "--jobs=") {
+			n, err := strconv.Atoi(strings.SplitN(arg, "=", 2)[1])
+			if err != nil {
+				exitUsage("[goahead] Invalid -jobs: %v", err)
+			}
+			jobs = n
+			continue
+		}
+		if strings.HasPrefix(arg, "-file-jobs=") || strings.HasPrefix(arg, "--file-jobs=") {
+			n, err := strconv.Atoi(strings.SplitN(arg, "=", 2)[1])
+			if err != nil {
+				exitUsage("[goahead] Invalid -file-jobs: %v", err)
+			}
+			fileJobs = n
+			continue
+		}
+		if strings.HasPrefix(arg, "-trace-dir=") || strings.HasPrefix(arg, "--trace-dir=") {
+			traceDir = strings.SplitN(arg, "=", 2)[1]
+			continue
+		}
+		if strings.HasPrefix(arg, "-trace-limit=") || strings.HasPrefix(arg, "--trace-limit=") {
+			limit, err := strconv.Atoi(strings.SplitN(arg, "=", 2)[1])
+			if err != nil {
+				exitUsage("[goahead] Invalid -trace-limit: %v", err)
+			}
+			traceLimit = limit
+			continue
+		}
+		if strings.HasPrefix(arg, "-lock-ttl=") || strings.HasPrefix(arg, "--lock-ttl=") {
+			ttl, err := time.ParseDuration(strings.SplitN(arg, "=", 2)[1])
+			if err != nil {
+				exitUsage("[goahead] Invalid -lock-ttl: %v", err)
+			}
+			lockTTL = ttl
+			continue
+		}
+		if strings.HasPrefix(arg, "-exec-timeout=") || strings.HasPrefix(arg, "--exec-timeout=") {
+			timeout, err := time.ParseDuration(strings.SplitN(arg, "=", 2)[1])
+			if err != nil {
+				exitUsage("[goahead] Invalid -exec-timeout: %v", err)
+			}
+			execTimeout = timeout
+			continue
+		}
+		if strings.HasPrefix(arg, "-helper-depth=") || strings.HasPrefix(arg, "--helper-depth=") {
+			depth, err := strconv.Atoi(strings.SplitN(arg, "=", 2)[1])
+			if err != nil {
+				exitUsage("[goahead] Invalid -helper-depth: %v", err)
+			}
+			helperDepth = depth
+			continue
+		}
 		goArgs = append(goArgs, arg)
 	}
 
@@ -109,8 +365,41 @@ func runGoCommandWithCodegen(command string, args []string) {
 	}
 
 	// Run codegen first
-	if err := internal.RunCodegen(codegenDir, verbose); err != nil {
-		log.Fatalf("[goahead] Codegen failed: %v", err)
+	config := internal.Config{Dir: codegenDir, Verbose: verbose, LogCategories: logCategories, OnDuplicate: onDuplicate, Annotations: annotations}
+	config.HelperDirs = helperDirs
+	config.Exclude = exclude
+	config.CacheDir = cacheDir
+	config.HelperDepth = helperDepth
+	config.Strict = strict
+	config.SkipBrokenHelpers = skipBroken
+	config.StrictDirectives = strictDirectives
+	config.LockTTL = lockTTL
+	config.ExecTimeout = execTimeout
+	config.MarkerPrefix = markerPrefix
+	config.FenceStyle = fenceStyle
+	config.Jobs = jobs
+	config.FileJobs = fileJobs
+	config.MaxLiteralSize = maxLiteralSize
+	config.MaxInjectSize = maxInjectSize
+	config.TraceDir = traceDir
+	config.TraceLimit = traceLimit
+	config.Diagnostics = diagnostics
+	config.Offline = offline
+	config.NoCache = noCache
+	config.Format = format
+	config.Profile = profile
+	config.TagReplacements = tagReplacements
+	config.TagFormat = tagFormat
+	config.Redact = redact
+	config.RespectBuildTags = respectBuildTags
+	config.Incremental = incremental
+	config.Paranoid = paranoid
+	config.Companion = companion
+	config.BuildTags = buildTags
+	config.ConstSink = constSink
+	config.ModFlag = modFlag
+	if err := internal.RunCodegenWithConfig(config); err != nil {
+		exitWithError("[goahead] Codegen failed: %v", err)
 	}
 
 	// Now run go command WITHOUT toolexec
@@ -132,6 +421,219 @@ func runGoCommandWithCodegen(command string, args []string) {
 	}
 }
 
+// exitWithError prints the run error err with format and exits with its
+// internal.ExitCode. An interrupted run has printed its partial report and
+// exits quietly with internal.InterruptExitCode.
+func exitWithError(format string, err error) {
+	if !errors.Is(err, internal.ErrInterrupted) {
+		log.Printf(format, err)
+	}
+	os.Exit(internal.ExitCode(err))
+}
+
+// exitUsage reports an invalid flag value and exits with
+// internal.ExitEnvironment, as the flag package does
+func exitUsage(format string, args ...any) {
+	log.Printf(format, args...)
+	os.Exit(internal.ExitEnvironment)
+}
+
+// reportPanic turns a panic of the run into a bug report with the version
+// and stack, and exits with internal.ExitInternal. A panic of a worker
+// goroutine reaches it as an internal.WorkerPanic, reported with the stack
+// of the worker.
+func reportPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := debug.Stack()
+	if worker, ok := r.(*internal.WorkerPanic); ok {
+		r, stack = worker.Value, append(append(worker.Stack, "\nraised again in:\n"...), stack...)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "\n[goahead] BUG: goahead %s (%s, %s/%s) panicked: %v\n", internal.Version, runtime.Version(), runtime.GOOS, runtime.GOARCH, r)
+	_, _ = fmt.Fprintf(os.Stderr, "This is a bug in goahead, not in your code. Please report it with the output below at\nhttps://github.com/AeonDave/goahead/issues\n\n%s", stack)
+	os.Exit(internal.ExitInternal)
+}
+
+// runTrustCommand manages the list of modules whose helpers may run in
+// toolexec mode: goahead trust add|remove <dir>, goahead trust list
+func runTrustCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: goahead trust add|remove <dir> | goahead trust list")
+	}
+	switch args[0] {
+	case "add", "remove":
+		if len(args) != 2 {
+			log.Fatalf("Usage: goahead trust %s <dir>", args[0])
+		}
+		dir := args[1]
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			log.Fatalf("Error: %s is not a directory", dir)
+		}
+		var (
+			changed bool
+			err     error
+		)
+		if args[0] == "add" {
+			changed, err = internal.AddTrustedDir(dir)
+		} else {
+			changed, err = internal.RemoveTrustedDir(dir)
+		}
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		absDir, _ := filepath.Abs(dir)
+		switch {
+		case args[0] == "add" && changed:
+			fmt.Printf("Trusted %s\n", absDir)
+		case args[0] == "add":
+			fmt.Printf("%s is already trusted\n", absDir)
+		case changed:
+			fmt.Printf("Removed %s from the trust list\n", absDir)
+		default:
+			fmt.Printf("%s was not trusted\n", absDir)
+		}
+	case "list":
+		dirs, err := internal.LoadTrustedDirs()
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		for _, d := range dirs {
+			fmt.Println(d)
+		}
+	default:
+		log.Fatalf("Unknown trust command %q (expected add, remove or list)", args[0])
+	}
+}
+
+// runDocsCommand writes Markdown documentation of the helper files:
+// goahead docs [-dir .] [-o HELPERS.md]
+func runDocsCommand(args []string) {
+	fs := flag.NewFlagSet("docs", flag.ExitOnError)
+	var (
+		config     internal.Config
+		output     string
+		helperDirs string
+	)
+	fs.StringVar(&config.Dir, "dir", ".", "Directory whose helper files are documented")
+	fs.StringVar(&output, "o", "", "Output file (default: stdout)")
+	fs.StringVar(&helperDirs, "helper-dirs", "", "Comma-separated directories whose files are all helper files")
+	fs.IntVar(&config.HelperDepth, "helper-depth", 0, "Visibility depth for helpers from -helper-dirs (0 = whole module)")
+	fs.StringVar(&config.MarkerPrefix, "marker-prefix", "", "Marker trigger prefix used in the examples (default: //:)")
+	_ = fs.Parse(args)
+	config.HelperDirs = splitList(helperDirs)
+
+	docs, err := internal.GenerateHelperDocs(config)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if output == "" {
+		fmt.Print(docs)
+		return
+	}
+	if err := os.WriteFile(output, []byte(docs), 0o644); err != nil {
+		log.Fatalf("Error: failed to write %s: %v", output, err)
+	}
+}
+
+// runListCommand prints the helpers and markers of a module without
+// evaluating anything: goahead list [-dir .] [-json]
+func runListCommand(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var (
+		config     internal.Config
+		asJSON     bool
+		helperDirs string
+	)
+	fs.StringVar(&config.Dir, "dir", ".", "Directory whose helpers and markers are listed")
+	fs.BoolVar(&asJSON, "json", false, "Print the listing as JSON")
+	fs.StringVar(&helperDirs, "helper-dirs", "", "Comma-separated directories whose files are all helper files")
+	fs.IntVar(&config.HelperDepth, "helper-depth", 0, "Visibility depth for helpers from -helper-dirs (0 = whole module)")
+	fs.StringVar(&config.MarkerPrefix, "marker-prefix", "", "Marker trigger prefix (default: //:)")
+	_ = fs.Parse(args)
+	config.HelperDirs = splitList(helperDirs)
+
+	listing, err := internal.ListProject(config)
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	if !asJSON {
+		fmt.Print(listing.Format())
+		return
+	}
+	data, err := json.MarshalIndent(listing, "", "  ")
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	fmt.Println(string(data))
+}
+
+// runRestoreCommand reverts the rewrites recorded by -backup runs:
+// goahead restore [-dir .]
+func runRestoreCommand(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dir := fs.String("dir", ".", "Directory the -backup runs processed")
+	_ = fs.Parse(args)
+
+	report, err := internal.RestoreBackups(*dir)
+	if report != nil {
+		for _, rel := range report.Restored {
+			fmt.Fprintf(os.Stderr, "[goahead] Restored %s\n", rel)
+		}
+	}
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+}
+
+// runCleanCommand removes the injected blocks of a tree:
+// goahead clean [-dir .]
+func runCleanCommand(args []string) {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	dir := fs.String("dir", ".", "Directory to remove injected code from")
+	_ = fs.Parse(args)
+
+	report, err := internal.CleanInjected(*dir)
+	if report != nil {
+		for _, rel := range report.Cleaned {
+			fmt.Fprintf(os.Stderr, "[goahead] Cleaned %s\n", rel)
+		}
+	}
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+}
+
+// runInitCommand writes a commented default project file:
+// goahead init [-dir .] [-force]
+func runInitCommand(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	dir := fs.String("dir", ".", "Directory whose module gets the project file")
+	force := fs.Bool("force", false, "Overwrite an existing "+internal.ProjectFileName)
+	_ = fs.Parse(args)
+
+	path, err := internal.InitProjectFile(*dir, *force)
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "[goahead] Wrote %s\n", path)
+}
+
+// runCleanCacheCommand removes the persistent result cache:
+// goahead clean-cache
+func runCleanCacheCommand() {
+	dir, err := internal.CleanResultCache()
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	if dir == "" {
+		fmt.Fprintln(os.Stderr, "[goahead] No result cache to remove")
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[goahead] Removed %s\n", dir)
+}
+
 func isToolexecMode() bool {
 	if len(os.Args) < 2 {
 		return false
@@ -170,16 +672,90 @@ func looksLikeGoTool(arg string) bool {
 
 func parseFlags() *internal.Config {
 	config := &internal.Config{}
+	var helperDirs string
 
-	flag.StringVar(&config.Dir, "dir", ".", "Directory to process")
+	flag.StringVar(&config.Dir, "dir", ".", "Directory or package pattern (./cmd/...) to process")
 	flag.BoolVar(&config.Verbose, "verbose", false, "Enable verbose output")
 	flag.BoolVar(&config.Help, "help", false, "Show help")
 	flag.BoolVar(&config.Version, "version", false, "Show version")
+	flag.StringVar(&config.Annotations, "annotations", "", "Write a JSON map of generated literals to their helpers")
+	flag.StringVar(&config.OnDuplicate, "on-duplicate", internal.DuplicatePolicyError, "Same-depth duplicate policy: error, first or skip")
+	flag.BoolVar(&config.Strict, "strict", false, "Fail when any marker is skipped")
+	flag.IntVar(&config.WarningsExitCode, "warnings-exit-code", internal.ExitOK, "Exit status of a successful run with warnings or skipped markers: 0 or 3")
+	flag.BoolVar(&config.SkipBrokenHelpers, "skip-broken-helpers", false, "Warn about unreadable or unparsable helper files instead of failing")
+	flag.BoolVar(&config.StrictDirectives, "strict-directives", false, "Fail on unknown //go:ahead directives instead of warning")
+	flag.IntVar(&config.MaxLiteralSize, "max-literal-size", internal.DefaultMaxLiteralSize, "Largest value in bytes a marker may write into a literal")
+	flag.IntVar(&config.MaxInjectSize, "max-inject-size", internal.DefaultMaxInjectSize, "Largest block of injected code in bytes per file")
+	flag.IntVar(&config.Jobs, "jobs", 0, "Evaluate up to n markers of a file at once, each in its own program (0 = one program per file)")
+	flag.IntVar(&config.FileJobs, "file-jobs", 0, "Evaluate up to n files at once before rewriting them in order (0 = GOMAXPROCS, 1 = one at a time)")
+	flag.BoolVar(&config.SingleProgram, "single-program", false, "Evaluate the markers of all the files of a directory in one program")
+	flag.StringVar(&config.TraceDir, "trace-dir", "", "Save every evaluation program with its command and output to this directory")
+	flag.IntVar(&config.TraceLimit, "trace-limit", internal.DefaultTraceLimit, "Maximum number of programs saved by -trace-dir (0 = no limit)")
+	flag.StringVar(&config.MarkerPrefix, "marker-prefix", "", "Comment prefix that starts a marker, e.g. //ga: (default: //:)")
+	flag.StringVar(&config.FenceStyle, "fence-style", "", "Fences and blank lines of injected blocks: begin=,end=,before=,inside=,after=")
+	flag.DurationVar(&config.ExecTimeout, "exec-timeout", 0, "Stop evaluation programs that run longer, compilation included (0 = no limit)")
+	flag.DurationVar(&config.LockTTL, "lock-ttl", internal.DefaultLockTTL, "Age after which another process's <file>.goahead.lock is taken over")
+	flag.StringVar(&config.Diagnostics, "diagnostics", "", "Write warnings and errors to a file: sarif:<path> or checkstyle:<path>")
+	flag.BoolVar(&config.Offline, "offline", false, "Forbid module downloads while evaluating helpers (GOPROXY=off)")
+	flag.StringVar(&config.FreezeTime, "freeze-time", "", "RFC 3339 time that goaheadNow() returns to helpers, e.g. 2026-01-22T17:49:00Z")
+	flag.Var((*listFlag)(&config.Env), "env", "KEY=VALUE variable set for helpers (repeatable)")
+	flag.BoolVar(&config.EnvIsolate, "env-isolate", false, "Hide every variable but those of -env and "+internal.ProjectRootEnv+" from helpers")
+	flag.BoolVar(&config.Format, "format", false, "Run gofmt on every file goahead modifies")
+	flag.StringVar(&config.Profile, "profile", "", "Profile of .goahead.toml whose variables markers use as ${name} (default: $GOAHEAD_PROFILE)")
+	flag.BoolVar(&config.TagReplacements, "tag-replacements", false, "Append a provenance comment such as //g:Shadow(\"ntdll\")@v1.4.0 to every replaced line")
+	flag.StringVar(&config.TagFormat, "tag-format", internal.DefaultTagFormat, "Template of -tag-replacements comments: {call}, {helper}, {args}, {version}")
+	flag.StringVar(&config.ConstSink, "const-sink", "", "Write values as constants to this .go file and refer to them at the markers")
+	flag.BoolVar(&config.Redact, "redact", false, "Hide helper arguments and values in progress output and tags")
+	flag.BoolVar(&config.RespectBuildTags, "respect-build-tags", false, "Skip files whose build constraints exclude them for $GOOS/$GOARCH and the build tags")
+	flag.BoolVar(&config.Paranoid, "paranoid", false, "Undo rewrites that change code outside marker targets and injected blocks")
+	flag.StringVar(&config.CacheDir, "cache-dir", "", "Directory of the persistent result cache, or off (default: goahead in the Go build cache)")
+	flag.BoolVar(&config.NoCache, "no-cache", false, "Neither read nor write the persistent result cache (see goahead clean-cache)")
+	flag.BoolVar(&config.Backup, "backup", false, "Record the lines each rewritten file had in "+internal.BackupDirName+"/"+internal.BackupFileName+" for goahead restore")
+	flag.BoolVar(&config.DryRun, "dry-run", false, "Print the changes as unified diffs instead of writing them; exit 1 if there are any")
+	flag.BoolVar(&config.Check, "check", false, "Evaluate every marker without writing anything and fail if any is skipped")
+	flag.StringVar(&config.Out, "out", "", "Mirror the module into this directory and process the copy, leaving the sources unchanged")
+	flag.BoolVar(&config.Companion, "companion", false, "Leave the sources unchanged and assign package-level variables from an init function of <name>_goahead.go")
+	flag.StringVar(&config.OutLink, "out-link", internal.OutLinkCopy, "How -out holds files no marker changes: copy, hard or symlink")
+	flag.BoolVar(&config.Incremental, "incremental", false, "Process only files whose content, helpers or "+internal.ProjectFileName+" changed since the last -incremental run")
+	flag.StringVar(&config.ModFlag, "mod", "", "Module download mode for helper evaluation (e.g. vendor)")
+	flag.StringVar(&helperDirs, "helper-dirs", "", "Comma-separated directories whose files are all helper files")
+	flag.Var((*listFlag)(&config.Exclude), "exclude", "Glob of paths, relative to the module root, never to walk (repeatable)")
+	flag.IntVar(&config.HelperDepth, "helper-depth", 0, "Visibility depth for helpers from -helper-dirs (0 = whole module)")
 	flag.Parse()
+	config.HelperDirs = splitList(helperDirs)
+
+	// Package patterns are given as arguments or as -dir=./cmd/...; they
+	// are resolved relative to -dir (or the current directory)
+	config.Patterns = flag.Args()
+	if strings.Contains(config.Dir, "...") {
+		config.Patterns = append([]string{config.Dir}, config.Patterns...)
+		config.Dir = "."
+	}
 
 	return config
 }
 
+// listFlag collects the values of a flag given once per value, such as -env
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func showHelp() {
 	const boxInnerWidth = 79
 
@@ -262,11 +838,34 @@ USAGE
 		goahead run ./cmd/app        Process + run  
 		goahead test ./...           Process + test
 
-	Toolexec mode:
+	Toolexec mode (helpers run only in trusted modules):
 		go build -toolexec="goahead" ./...
+		goahead trust add <dir>      Trust a module (also: remove, list)
+
+	Helper documentation:
+		goahead docs -dir . -o HELPERS.md
+
+	Helpers and markers, without evaluating anything:
+		goahead list -dir . [-json]
+
+	Undo the rewrites of -backup runs:
+		goahead restore -dir .
+
+	Remove injected code, keeping its markers:
+		goahead clean -dir .
+
+	Remove the persistent result cache:
+		goahead clean-cache
+
+	Write a commented default .goahead.toml at the module root:
+		goahead init [-dir .] [-force]
+
+	Fail when a marker would be skipped, writing nothing (for CI):
+		goahead check [-dir .] [patterns]
 
 	Standalone (process only):
 		goahead -dir=./mypackage
+		goahead ./cmd/... ./pkg/...  Only the matched packages
 
 QUICK START
 	1. Create a helper file (helpers.go):
@@ -286,13 +885,122 @@ QUICK START
 	Result: greeting becomes "Hello, gopher"
 
 OPTIONS
-	-dir <path>    Directory to process (default: current)
+	-dir <path>    Directory or package pattern to process (default: current)
 	-verbose       Enable verbose output
+	-on-duplicate  Same-depth duplicate policy: error|first|skip (default: error)
+	-annotations <file>
+	               Write a JSON map of generated literals to their helpers
+	-strict        Fail when any marker is skipped (unresolved, no target, ...)
+	-warnings-exit-code <n>
+	               Exit with n (0 or 3) when the run succeeds with warnings or
+	               skipped markers (default: 0)
+	-skip-broken-helpers
+	               Warn about unreadable/unparsable helper files instead of failing
+	-strict-directives
+	               Fail on unknown //go:ahead directives instead of warning
+	-max-literal-size <bytes>
+	               Skip markers whose value is larger (default: 1048576, 1 MiB)
+	-max-inject-size <bytes>
+	               Fail when a file's injected code is larger (default: 8388608, 8 MiB)
+	-jobs <n>      Evaluate up to n markers of a file at once, each in its own
+	               program (default: 0, one program per file)
+	-file-jobs <n> Evaluate up to n files at once, each in its own program,
+	               before rewriting them in order (default: 0, GOMAXPROCS)
+	-single-program
+	               Evaluate the markers of all the files of a directory in one
+	               program before rewriting them
+	-trace-dir <dir>
+	               Save each evaluation program, command, environment and output
+	-trace-limit <n>
+	               Programs saved by -trace-dir before it stops (default: 100, 0 = all)
+	-marker-prefix <p>
+	               Comment prefix that starts markers, e.g. //ga: (default: //:)
+	-fence-style <spec>
+	               Fence comments and blank lines of injected blocks, e.g.
+	               inside=0,after=2 (keys: begin, end, before, inside, after)
+	-exec-timeout <d>
+	               Stop an evaluation program, compilation included, after d
+	               (default: 0, no limit); see also //goahead:timeout
+	-lock-ttl <d>  Skip files whose <file>.goahead.lock is younger than d (default: 30s)
+	-diagnostics <format>:<path>
+	               Write warnings and errors as sarif or checkstyle for editors/CI
+	-offline       Forbid module downloads while evaluating helpers (GOPROXY=off)
+	-freeze-time <t>
+	               RFC 3339 time returned by goaheadNow() in helpers, for
+	               reproducible output (default: the current time)
+	-env KEY=VALUE Set a variable for helpers, not for the go command (repeatable)
+	-env-isolate   Hide every variable but those of -env and GOAHEAD_PROJECT_ROOT
+	               from helpers
+	-format        Run gofmt on every file goahead modifies; others are left alone
+	-profile <name>
+	               .goahead.toml profile for ${name} marker variables
+	               (default: $GOAHEAD_PROFILE, then the file's profile key)
+	-tag-replacements
+	               Append //g:Helper(args)@version to every replaced line
+	-tag-format <template>
+	               Template of those tags: {call}, {helper}, {args}, {version}
+	               (default: //g:{call}@{version})
+	-const-sink <file>
+	               Write values as GoaheadVal_<hash> constants to this generated
+	               .go file and refer to them at each marker instead
+	-redact        Hide helper arguments and values in progress output and tags
+	-respect-build-tags
+	               Skip files whose build constraints exclude them for $GOOS,
+	               $GOARCH and the -tags of GOFLAGS (always on in toolexec mode)
+	-paranoid      Check each rewritten file against the original and leave it
+	               unchanged if code outside markers and injected blocks differs
+	-incremental   Process only files whose content, helpers or .goahead.toml
+	               changed since the last run, and files with skipped markers;
+	               the state is kept in .goahead-index.json
+	-no-cache      Evaluate every marker, ignoring the results of earlier runs
+	               kept in the persistent result cache, and store none
+	-cache-dir <dir>
+	               Keep the persistent result cache in dir, or off to disable it
+	               (default: goahead in the Go build cache; GOAHEAD_CACHE wins)
+	-backup        Record the original lines of every rewritten file in
+	               .goahead/backup.json, for goahead restore
+	-dry-run       Print the changes a run would make as unified diffs and write
+	               nothing; exits with 1 when files would change
+	-check         Evaluate every marker as -dry-run does, without printing the
+	               diffs unless -dry-run is set too, and exit with 1 listing the
+	               markers that would be skipped; same as goahead check
+	-out <dir>     Mirror the module into dir and apply replacements and
+	               injections there; the sources are left unchanged
+	-out-link <mode>
+	               How -out holds files: copy (default), hard or symlink
+	-companion     Leave the sources unchanged and write the values of package-
+	               level variables to an init function of <name>_goahead.go
+	-mod <mode>    Module mode for helper evaluation (default: vendor if vendor/ exists)
+	-helper-dirs <dirs>
+	               Comma-separated directories whose files are all helper files
+	-helper-depth  Visibility depth for -helper-dirs helpers (default: 0, module-wide)
+	-exclude <glob>
+	               Never walk the paths matching glob, relative to the module
+	               root: gen/**, **/testdata/** (repeatable); adds to the
+	               gitignore patterns of .goaheadignore
 	-help          Show this help
 	-version       Show version
 
 ENVIRONMENT
 	GOAHEAD_VERBOSE=1    Enable verbose output
+	GOAHEAD_VERBOSE=replace,inject
+	                     Enable only some categories (scan, filter, exec,
+	                     replace, inject, cache)
+	GOAHEAD_TRUST_ALL=1  Run helpers of every module in toolexec mode
+	GOAHEAD_STRICT=1     Fail the compile of packages with skipped markers in
+	                     toolexec mode
+	GOAHEAD_PROFILE=dev  Select the .goahead.toml profile (like -profile)
+	GOAHEAD_VAR_name=v   Set or override the marker variable ${name}
+
+EXIT CODES
+	0    Nothing to do, or values replaced
+	1    Marker errors: skipped markers with -strict or -check, failed or broken
+	     helpers; with -dry-run, files that would change
+	2    Environment or setup errors: invalid flags, missing directory or go
+	     toolchain, files that cannot be written
+	3    Warnings or skipped markers only, with -warnings-exit-code=3
+	4    Internal error: a bug in goahead, reported with its stack
+	130  Interrupted by SIGINT or SIGTERM
 
 DOCUMENTATION
 	https://github.com/AeonDave/goahead
@@ -0,0 +1,849 @@
+// Package marker implements the goahead marker grammar so that the code
+// generator and external tools (editor plugins, linters) parse markers the
+// same way.
+//
+// Two kinds of markers exist:
+//
+//	//:Func:arg1:arg2     placeholder; replaces the literal on the next code line
+//	//:inject:Method      injection; copies a helper implementation for an interface method
+//	//:inject!:Func       free-standing injection; copies a helper without an interface
+//
+// A third kind combines the two: "//:inject-var:name = Func:args" injects
+// "var name = <value>" with the result of the call, which takes arguments
+// and pipelines like a placeholder.
+//
+// An injection marker may end with a placement, "@after-interface" or
+// "@end-of-file", choosing where the generated block goes; without one the
+// block stays where it is, or is appended to the end of the file.
+//
+// Arguments are separated by colons outside quotes and brackets. Each argument
+// is classified as a string, bool, int, float or Go expression; a leading "="
+// forces the expression form and must parse as a Go expression. A dotted
+// function name such as strings.ToUpper calls a package function, whose
+// qualifier is reported as the Selector.
+//
+// An argument written as @below takes its value from the block comment
+// between the marker and its literal, so multi-line text needs no escapes:
+//
+//	//:Render:@below
+//	/* goahead:arg
+//	Hello {{.Name}},
+//	welcome.
+//	*/
+//	var tmpl = ""
+//
+// The comment opens with a "/* goahead:arg" line and closes with a "*/"
+// line; the lines in between, joined by newlines, are the string argument.
+//
+// A placeholder may end with "-> a, b, c" to feed several variables of the
+// following var block from one call: positionally from a multi-value result,
+// or by field from a struct result ("host=Host" maps variable host to field
+// Host).
+//
+// The "//:" trigger prefix can be replaced, for example by "//ga:" when
+// another tool in the build already owns "//:" comments; NewSyntax builds the
+// grammar for such a prefix and Parse uses the default one.
+//
+// The grammar is versioned. Level 2 adds pipelines: "|" outside quotes and
+// brackets passes the result of each call as the first argument of the
+// next, so "//:ReadFile:\"VERSION\" | strings.TrimSpace" trims the helper's
+// result. At level 1 the "|" is part of the arguments, as it always was, and
+// the marker reports the newer level it would need (NewerLevel). A tree
+// picks its level once, so upgrading goahead never changes what its markers
+// mean.
+//
+// Level 3 adds named targets: a placeholder ending with "> name" outside
+// quotes and brackets replaces the value of the declaration of name, in the
+// var block holding the marker or further down the file, instead of the
+// next line, as in "//:Port > port". At lower levels the "> name" is part of
+// the arguments, such as the expression of "//:Max:=a > b".
+//
+// The grammar has no modifiers or fallback values; Marker gains fields for
+// them only once the syntax exists.
+package marker
+
+import (
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	gotoken "go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPrefix is the comment prefix that starts a marker
+	DefaultPrefix = "//:"
+	// PlaceholderPattern matches //:Func[:args]; group 1 is the function, group 2 the raw arguments
+	PlaceholderPattern = `^\s*//\s*:([^:]+)(?::(.*))?`
+	// InjectPattern matches //:inject:MethodName and //:inject!:FuncName;
+	// group 1 is the "!" of the free-standing form, group 2 the name and
+	// group 3 the optional placement after "@"
+	InjectPattern = `^\s*//\s*:inject(!?):(\w+)(?:\s+@([\w-]+))?\s*$`
+	// InjectVarPattern matches //:inject-var:name = Func[:args]; group 1 is
+	// the variable, group 2 the call
+	InjectVarPattern = `^\s*//\s*:inject-var:\s*(\w+)\s*=(.*)$`
+
+	// PlaceAfterInterface puts the injected block right after the interface
+	// following the marker
+	PlaceAfterInterface = "after-interface"
+	// PlaceEndOfFile puts the injected block at the end of the file
+	PlaceEndOfFile = "end-of-file"
+
+	// BelowArgument is the argument filled from the block comment below the marker
+	BelowArgument = "@below"
+	// BlockArgumentStart and BlockArgumentEnd are the lines that open and
+	// close the block comment read by BelowArgument
+	BlockArgumentStart = "/* goahead:arg"
+	BlockArgumentEnd   = "*/"
+)
+
+// Grammar levels. Each level keeps the markers of the previous one valid
+// except where it gives meaning to text the older grammar passed through.
+const (
+	// Level1 is the original grammar
+	Level1 = 1
+	// Level2 adds "|" pipelines
+	Level2 = 2
+	// Level3 adds "> name" targets
+	Level3 = 3
+	// LatestLevel is the newest level, used by NewSyntax
+	LatestLevel = Level3
+)
+
+var (
+	// Default is the grammar of DefaultPrefix, used by Parse
+	Default = MustNewSyntax(DefaultPrefix)
+
+	// ErrNotMarker is returned by Parse for lines that are not markers
+	ErrNotMarker = errors.New("not a goahead marker")
+)
+
+// Syntax is the marker grammar for one trigger prefix. It is immutable and
+// safe for concurrent use.
+type Syntax struct {
+	prefix             string
+	level              int
+	placeholderPattern string
+	injectPattern      string
+	placeholderRe      *regexp.Regexp
+	injectRe           *regexp.Regexp
+	injectVarRe        *regexp.Regexp
+}
+
+// NewSyntax returns the grammar for markers starting with prefix, such as
+// "//ga:". The prefix must be a line comment; like "// :Func", whitespace
+// after the slashes is tolerated. "//go:" is rejected because it would turn
+// go directives into markers.
+func NewSyntax(prefix string) (*Syntax, error) {
+	rest, ok := strings.CutPrefix(prefix, "//")
+	switch {
+	case !ok || rest == "":
+		return nil, fmt.Errorf("marker prefix %q must start with // followed by at least one character", prefix)
+	case strings.ContainsAny(rest, " \t"):
+		return nil, fmt.Errorf("marker prefix %q must not contain whitespace", prefix)
+	case strings.HasPrefix(rest, "go:"):
+		return nil, fmt.Errorf("marker prefix %q collides with //go: directives", prefix)
+	}
+	lead := `^\s*//\s*` + regexp.QuoteMeta(rest)
+	s := &Syntax{
+		prefix:             prefix,
+		level:              LatestLevel,
+		placeholderPattern: lead + `([^:]+)(?::(.*))?`,
+		injectPattern:      lead + `inject(!?):(\w+)(?:\s+@([\w-]+))?\s*$`,
+	}
+	s.placeholderRe = regexp.MustCompile(s.placeholderPattern)
+	s.injectRe = regexp.MustCompile(s.injectPattern)
+	s.injectVarRe = regexp.MustCompile(lead + `inject-var:\s*(\w+)\s*=(.*)$`)
+	return s, nil
+}
+
+// MustNewSyntax is NewSyntax for prefixes known to be valid; it panics on error
+func MustNewSyntax(prefix string) *Syntax {
+	s, err := NewSyntax(prefix)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Prefix returns the trigger prefix, e.g. "//:"
+func (s *Syntax) Prefix() string { return s.prefix }
+
+// Level returns the grammar level of s
+func (s *Syntax) Level() int { return s.level }
+
+// WithLevel returns the grammar of s at another level, Level1 to LatestLevel
+func (s *Syntax) WithLevel(level int) (*Syntax, error) {
+	if level < Level1 || level > LatestLevel {
+		return nil, fmt.Errorf("unknown marker syntax %d (supported: %d to %d)", level, Level1, LatestLevel)
+	}
+	if level == s.level {
+		return s, nil
+	}
+	c := *s
+	c.level = level
+	return &c, nil
+}
+
+// PlaceholderPattern is PlaceholderPattern for this prefix
+func (s *Syntax) PlaceholderPattern() string { return s.placeholderPattern }
+
+// InjectPattern is InjectPattern for this prefix
+func (s *Syntax) InjectPattern() string { return s.injectPattern }
+
+// Kind distinguishes placeholder markers from injection markers
+type Kind int
+
+const (
+	KindPlaceholder Kind = iota
+	KindInject
+	// KindInjectVar markers inject a variable holding a helper result
+	KindInjectVar
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindInject:
+		return "inject"
+	case KindInjectVar:
+		return "inject-var"
+	}
+	return "placeholder"
+}
+
+// ArgKind is the classification of a marker argument
+type ArgKind int
+
+const (
+	ArgExpression ArgKind = iota
+	ArgString
+	ArgBool
+	ArgInt
+	ArgFloat
+)
+
+func (k ArgKind) String() string {
+	switch k {
+	case ArgString:
+		return "string"
+	case ArgBool:
+		return "bool"
+	case ArgInt:
+		return "int"
+	case ArgFloat:
+		return "float"
+	default:
+		return "expression"
+	}
+}
+
+// Argument is one classified marker argument
+type Argument struct {
+	Raw        string
+	Normalized string
+	Kind       ArgKind
+	// AutoQuote is set for bare identifiers and empty arguments, which are
+	// passed as strings unless the helper expects another type
+	AutoQuote bool
+	// ForceExpression is set for "=expr" arguments, passed through verbatim
+	ForceExpression bool
+}
+
+// String renders the argument in canonical marker form
+func (a Argument) String() string {
+	switch {
+	case a.ForceExpression:
+		return "=" + a.Raw
+	case a.Kind == ArgString && !a.AutoQuote:
+		return strconv.Quote(a.Normalized)
+	default:
+		return a.Raw
+	}
+}
+
+// Marker is a parsed marker comment
+type Marker struct {
+	Kind Kind
+	// Func is the function as written, e.g. "Version" or "strings.ToUpper";
+	// for injection markers it is the method name
+	Func string
+	// Selector is the package qualifier of Func ("strings"), empty for helpers
+	Selector string
+	// Name is Func without its Selector and type arguments
+	Name string
+	// TypeArgs is the instantiation of a generic function, "int" for
+	// "Max[int]", empty when Func has none
+	TypeArgs string
+	// RawArgs is the argument text after the function, trimmed
+	RawArgs string
+	Args    []Argument
+	// Outputs lists the variables after "->", empty for single-value markers
+	Outputs []Output
+	// Target is the variable after ">" in a level 3 marker, whose
+	// declaration the marker replaces instead of the next line
+	Target string
+	// Free is set for //:inject!: markers, which inject a free function
+	// instead of implementing a method of the following interface
+	Free bool
+	// Placement is the "@" placement of an injection marker: PlaceAfterInterface,
+	// PlaceEndOfFile or empty for the default
+	Placement string
+	// Var is the variable of an inject-var marker; Func and the fields
+	// after it describe its call
+	Var string
+	// Pipeline lists the calls after "|" in a level 2 marker; each receives
+	// the result of the call before as its first argument
+	Pipeline []Stage
+	// NewerLevel is set when the line uses text that a newer grammar level
+	// reads differently, such as a "|" parsed as an argument at level 1. It
+	// is the lowest such level; the marker is parsed by the Syntax's own.
+	NewerLevel int
+
+	// prefix is the trigger prefix the marker was parsed with
+	prefix string
+}
+
+// Stage is one call of a pipeline after the first
+type Stage struct {
+	// Func, Selector, Name and TypeArgs are as in Marker
+	Func     string
+	Selector string
+	Name     string
+	TypeArgs string
+	// RawArgs are the arguments after the previous result, trimmed
+	RawArgs string
+	Args    []Argument
+}
+
+// Output is one variable fed by a multi-value marker
+type Output struct {
+	Var string
+	// Field is the struct field to read, empty for positional results
+	Field string
+}
+
+func (o Output) String() string {
+	if o.Field == "" {
+		return o.Var
+	}
+	return o.Var + "=" + o.Field
+}
+
+// Parse parses a single source line with the default "//:" prefix. Lines
+// that are not markers return ErrNotMarker. When the line is a marker but its
+// arguments are malformed, the marker is returned with Args unset together
+// with the error.
+func Parse(line string) (*Marker, error) {
+	return Default.Parse(line)
+}
+
+// Parse parses a single source line like the package-level Parse, for the
+// prefix of s
+func (s *Syntax) Parse(line string) (*Marker, error) {
+	if match := s.injectRe.FindStringSubmatch(line); match != nil {
+		m := &Marker{Kind: KindInject, Func: match[2], Name: match[2], Free: match[1] == "!", Placement: match[3], prefix: s.prefix}
+		switch m.Placement {
+		case "", PlaceAfterInterface, PlaceEndOfFile:
+		default:
+			return m, fmt.Errorf("unknown placement @%s for %s (use @%s or @%s)", m.Placement, m.Func, PlaceAfterInterface, PlaceEndOfFile)
+		}
+		if m.Free && m.Placement == PlaceAfterInterface {
+			return m, fmt.Errorf("%s: placement @%s needs an interface; free-standing %s cannot use it (use %sinject:%s above the interface, or @%s)",
+				m, PlaceAfterInterface, m.Func, s.prefix, m.Func, PlaceEndOfFile)
+		}
+		return m, nil
+	}
+
+	if match := s.injectVarRe.FindStringSubmatch(line); match != nil {
+		m, err := s.parseCall(match[2])
+		m.Kind, m.Var = KindInjectVar, match[1]
+		switch {
+		case err != nil:
+		case m.Func == "":
+			err = fmt.Errorf("inject-var %s has no call after =", m.Var)
+		case len(m.Outputs) > 0:
+			err = fmt.Errorf("inject-var %s takes a single value; drop the -> outputs", m.Var)
+		}
+		return m, err
+	}
+
+	loc := s.placeholderRe.FindStringSubmatchIndex(line)
+	if loc == nil {
+		return nil, ErrNotMarker
+	}
+	// Group 1 starts the body
+	return s.parseCall(line[loc[2]:])
+}
+
+// parseCall parses the body of a placeholder marker, the text after the
+// prefix: the call, its pipeline and its outputs
+func (s *Syntax) parseCall(body string) (*Marker, error) {
+	// The outputs and the target are cut off before splitting the function
+	// from its arguments so "//:F -> a, b" has no arguments
+	body, outputs, hasOutputs := cutOutputs(body)
+	call, target, hasTarget := cutTarget(body)
+	newer := 0
+	if hasTarget && s.level < Level3 {
+		// Older trees pass the "> name" to the function or its arguments
+		call, target, hasTarget, newer = body, "", false, Level3
+	}
+	stages := splitPipeline(call)
+	if len(stages) > 1 && s.level < Level2 {
+		// Older trees pass the "|" to the function or its arguments
+		stages, newer = []string{call}, Level2
+	}
+	head, err := parseStage(stages[0])
+	m := &Marker{Kind: KindPlaceholder, Func: head.Func, Selector: head.Selector, Name: head.Name, TypeArgs: head.TypeArgs, RawArgs: head.RawArgs, Target: target, NewerLevel: newer, prefix: s.prefix}
+	if hasTarget && hasOutputs {
+		return m, fmt.Errorf("%s cannot have both a > %s target and -> outputs", m.Func, target)
+	}
+
+	if hasOutputs {
+		parsed, err := ParseOutputs(outputs)
+		if err != nil {
+			return m, fmt.Errorf("invalid outputs for %s: %w", m.Func, err)
+		}
+		m.Outputs = parsed
+	}
+
+	if err != nil {
+		return m, fmt.Errorf("invalid arguments for %s: %w", m.Func, err)
+	}
+	m.Args = head.Args
+	for _, text := range stages[1:] {
+		stage, err := parseStage(text)
+		if stage.Func == "" {
+			return m, fmt.Errorf("empty pipeline stage after %s", m.Func)
+		}
+		if err != nil {
+			return m, fmt.Errorf("invalid arguments for %s: %w", stage.Func, err)
+		}
+		m.Pipeline = append(m.Pipeline, stage)
+	}
+	return m, nil
+}
+
+// parseStage parses one "Func[:args]" call of a marker. A function part
+// starting with "=" is a Go expression evaluated as written, as in
+// //:=NewSchedule("abc").Derive(16): it runs to the end of the stage, colons
+// included, and takes no arguments.
+func parseStage(text string) (Stage, error) {
+	if expr := strings.TrimSpace(text); strings.HasPrefix(expr, "=") {
+		return Stage{Func: expr, Name: expr}, nil
+	}
+	funcName, rawArgs, _ := strings.Cut(text, ":")
+	stage := Stage{Func: strings.TrimSpace(funcName), RawArgs: strings.TrimSpace(rawArgs)}
+	stage.Name, stage.TypeArgs = SplitTypeArgs(stage.Func)
+	if selector, name, ok := strings.Cut(stage.Name, "."); ok && selector != "" && name != "" {
+		stage.Selector, stage.Name = selector, name
+	}
+	args, err := ParseArguments(stage.RawArgs)
+	stage.Args = args
+	return stage, err
+}
+
+// SplitTypeArgs splits the instantiation off a generic function: "Max[int]"
+// gives "Max" and "int", "pkg.Pair[string, int]" gives "pkg.Pair" and
+// "string, int". A name without one is returned as is.
+func SplitTypeArgs(name string) (base, typeArgs string) {
+	open := strings.IndexByte(name, '[')
+	if open <= 0 || !strings.HasSuffix(name, "]") {
+		return name, ""
+	}
+	typeArgs = strings.TrimSpace(name[open+1 : len(name)-1])
+	if typeArgs == "" {
+		return name, ""
+	}
+	return strings.TrimSpace(name[:open]), typeArgs
+}
+
+// splitPipeline splits body at every "|" outside quotes and brackets; "||"
+// is an operator, not a pipe
+func splitPipeline(body string) []string {
+	var (
+		parts []string
+		quote rune
+		depth int
+		prev  rune
+		start int
+	)
+	for i, r := range body {
+		switch {
+		case quote != 0:
+			if r == quote && prev != '\\' {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			depth--
+		case r == '|' && depth == 0 && prev != '|' && !strings.HasPrefix(body[i+1:], "|"):
+			parts = append(parts, body[start:i])
+			start = i + 1
+		}
+		if prev == '\\' && r == '\\' {
+			prev = 0
+			continue
+		}
+		prev = r
+	}
+	return append(parts, body[start:])
+}
+
+// String renders the marker in canonical form, with the prefix it was
+// parsed with
+func (m *Marker) String() string {
+	prefix := m.prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	if m.Kind == KindInject {
+		s := prefix + "inject:" + m.Func
+		if m.Free {
+			s = prefix + "inject!:" + m.Func
+		}
+		if m.Placement != "" {
+			s += " @" + m.Placement
+		}
+		return s
+	}
+	var b strings.Builder
+	b.WriteString(prefix)
+	if m.Kind == KindInjectVar {
+		b.WriteString("inject-var:" + m.Var + " = ")
+	}
+	b.WriteString(m.Func)
+	for _, arg := range m.Args {
+		b.WriteString(":")
+		b.WriteString(arg.String())
+	}
+	for _, stage := range m.Pipeline {
+		b.WriteString(" | ")
+		b.WriteString(stage.Func)
+		for _, arg := range stage.Args {
+			b.WriteString(":")
+			b.WriteString(arg.String())
+		}
+	}
+	if m.Target != "" {
+		b.WriteString(" > " + m.Target)
+	}
+	for i, out := range m.Outputs {
+		if i == 0 {
+			b.WriteString(" -> ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(out.String())
+	}
+	return b.String()
+}
+
+// ParseOutputs parses the comma-separated list after "->"
+func ParseOutputs(s string) ([]Output, error) {
+	var outputs []Output
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		name, field, hasField := strings.Cut(part, "=")
+		out := Output{Var: strings.TrimSpace(name), Field: strings.TrimSpace(field)}
+		if !gotoken.IsIdentifier(out.Var) || (hasField && !gotoken.IsIdentifier(out.Field)) {
+			return nil, fmt.Errorf("%q is not a variable name or name=Field mapping", part)
+		}
+		if seen[out.Var] {
+			return nil, fmt.Errorf("variable %s is listed twice", out.Var)
+		}
+		seen[out.Var] = true
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+// cutOutputs splits body at the first "->" outside quotes and brackets
+func cutOutputs(body string) (string, string, bool) {
+	var (
+		quote rune
+		depth int
+		prev  rune
+	)
+	for i, r := range body {
+		switch {
+		case quote != 0:
+			if r == quote && prev != '\\' {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			depth--
+		case r == '>' && prev == '-' && depth == 0:
+			return body[:i-1], body[i+1:], true
+		}
+		if prev == '\\' && r == '\\' {
+			// An escaped backslash does not escape the next rune
+			prev = 0
+			continue
+		}
+		prev = r
+	}
+	return body, "", false
+}
+
+// cutTarget splits body at a final "> name" outside quotes and brackets;
+// the ">" of "->", ">>" and ">=" is not a target
+func cutTarget(body string) (string, string, bool) {
+	var (
+		quote rune
+		depth int
+		prev  rune
+		last  = -1
+	)
+	for i, r := range body {
+		switch {
+		case quote != 0:
+			if r == quote && prev != '\\' {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			depth--
+		case r == '>' && depth == 0 && prev != '-' && prev != '>' && !strings.HasPrefix(body[i+1:], ">") && !strings.HasPrefix(body[i+1:], "="):
+			last = i
+		}
+		if prev == '\\' && r == '\\' {
+			prev = 0
+			continue
+		}
+		prev = r
+	}
+	if last < 0 {
+		return body, "", false
+	}
+	name := strings.TrimSpace(body[last+1:])
+	if !gotoken.IsIdentifier(name) {
+		return body, "", false
+	}
+	return body[:last], name, true
+}
+
+// ArgumentError reports an "=expr" argument that is not a valid Go
+// expression. It is detected while parsing, before the argument is pasted
+// into an evaluation program.
+type ArgumentError struct {
+	// Index is the 1-based position of the argument
+	Index int
+	Raw   string
+	Err   error
+}
+
+func (e *ArgumentError) Error() string {
+	var list scanner.ErrorList
+	if errors.As(e.Err, &list) && len(list) > 0 {
+		return fmt.Sprintf("argument %d (=%s): column %d: %s", e.Index, e.Raw, list[0].Pos.Column, list[0].Msg)
+	}
+	return fmt.Sprintf("argument %d (=%s): %v", e.Index, e.Raw, e.Err)
+}
+
+func (e *ArgumentError) Unwrap() error { return e.Err }
+
+// ParseArguments splits and classifies a raw argument string; "=expr"
+// arguments that do not parse fail with an *ArgumentError
+func ParseArguments(argsStr string) ([]Argument, error) {
+	if strings.TrimSpace(argsStr) == "" {
+		return nil, nil
+	}
+
+	rawArgs, err := SplitArguments(argsStr)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]Argument, len(rawArgs))
+	for i, token := range rawArgs {
+		args[i] = ClassifyArgument(token)
+		if !args[i].ForceExpression {
+			continue
+		}
+		if _, err := parser.ParseExpr(args[i].Raw); err != nil {
+			return nil, &ArgumentError{Index: i + 1, Raw: args[i].Raw, Err: err}
+		}
+	}
+	return args, nil
+}
+
+// SplitArguments splits on colons outside quotes, braces, parentheses and brackets
+func SplitArguments(input string) ([]string, error) {
+	var (
+		parts      []string
+		current    strings.Builder
+		inQuote    bool
+		quote      rune
+		escape     bool
+		braceDepth int
+		parenDepth int
+		brackDepth int
+	)
+
+	for _, r := range input {
+		switch {
+		case escape:
+			current.WriteRune(r)
+			escape = false
+		case r == '\\' && inQuote:
+			current.WriteRune(r)
+			escape = true
+		case inQuote:
+			current.WriteRune(r)
+			if r == quote {
+				inQuote = false
+			}
+		case r == '"' || r == '\'' || r == '`':
+			inQuote = true
+			quote = r
+			current.WriteRune(r)
+		case r == '{':
+			braceDepth++
+			current.WriteRune(r)
+		case r == '}':
+			braceDepth--
+			current.WriteRune(r)
+		case r == '(':
+			parenDepth++
+			current.WriteRune(r)
+		case r == ')':
+			parenDepth--
+			current.WriteRune(r)
+		case r == '[':
+			brackDepth++
+			current.WriteRune(r)
+		case r == ']':
+			brackDepth--
+			current.WriteRune(r)
+		case r == ':' && braceDepth == 0 && parenDepth == 0 && brackDepth == 0:
+			parts = append(parts, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if escape {
+		return nil, fmt.Errorf("unterminated escape sequence in %q", input)
+	}
+
+	parts = append(parts, strings.TrimSpace(current.String()))
+	return parts, nil
+}
+
+// UsesBelow reports whether argsStr has an @below argument
+func UsesBelow(argsStr string) bool {
+	if !strings.Contains(argsStr, BelowArgument) {
+		return false
+	}
+	parts, err := SplitArguments(argsStr)
+	if err != nil {
+		return false
+	}
+	for _, part := range parts {
+		if part == BelowArgument {
+			return true
+		}
+	}
+	return false
+}
+
+// SubstituteBelow replaces every @below argument of argsStr with value as a
+// quoted string
+func SubstituteBelow(argsStr, value string) (string, error) {
+	parts, err := SplitArguments(argsStr)
+	if err != nil {
+		return "", err
+	}
+	for i, part := range parts {
+		if part == BelowArgument {
+			parts[i] = strconv.Quote(value)
+		}
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// ClassifyArgument determines the kind of a single raw argument
+func ClassifyArgument(raw string) Argument {
+	trimmed := strings.TrimSpace(raw)
+	if strings.HasPrefix(trimmed, "=") {
+		expr := strings.TrimSpace(trimmed[1:])
+		return Argument{
+			Raw:             expr,
+			Normalized:      expr,
+			Kind:            ArgExpression,
+			ForceExpression: true,
+		}
+	}
+
+	if trimmed == "" {
+		return Argument{
+			Raw:        "",
+			Normalized: "",
+			Kind:       ArgString,
+			AutoQuote:  true,
+		}
+	}
+
+	if unquoted, err := strconv.Unquote(trimmed); err == nil {
+		return Argument{
+			Raw:        unquoted,
+			Normalized: unquoted,
+			Kind:       ArgString,
+		}
+	}
+
+	lower := strings.ToLower(trimmed)
+	if lower == "true" || lower == "false" {
+		return Argument{
+			Raw:        lower,
+			Normalized: lower,
+			Kind:       ArgBool,
+		}
+	}
+
+	if _, err := strconv.ParseInt(trimmed, 0, 64); err == nil {
+		return Argument{
+			Raw:        trimmed,
+			Normalized: trimmed,
+			Kind:       ArgInt,
+		}
+	}
+
+	if _, err := strconv.ParseFloat(trimmed, 64); err == nil {
+		return Argument{
+			Raw:        trimmed,
+			Normalized: trimmed,
+			Kind:       ArgFloat,
+		}
+	}
+
+	if gotoken.IsIdentifier(trimmed) {
+		return Argument{
+			Raw:        trimmed,
+			Normalized: trimmed,
+			Kind:       ArgString,
+			AutoQuote:  true,
+		}
+	}
+
+	return Argument{
+		Raw:        trimmed,
+		Normalized: trimmed,
+		Kind:       ArgExpression,
+	}
+}
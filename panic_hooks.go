@@ -0,0 +1,32 @@
+//go:build goahead_panic
+
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// Built with -tags goahead_panic, a run panics before it processes the file
+// of the base name set with -ldflags "-X main.panicFile=<name>", and in the
+// goroutine evaluating a call to the helper set with -X main.panicCall=<name>;
+// tests use it to check the bug report. Release builds have neither.
+var panicFile, panicCall string
+
+func init() {
+	if panicFile != "" {
+		internal.BeforeFileHook = func(path string) {
+			if filepath.Base(path) == panicFile {
+				panic("panicFile reached: " + path)
+			}
+		}
+	}
+	if panicCall != "" {
+		internal.BeforeCallHook = func(funcName string) {
+			if funcName == panicCall {
+				panic("panicCall reached: " + funcName)
+			}
+		}
+	}
+}
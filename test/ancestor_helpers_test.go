@@ -0,0 +1,83 @@
+package test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+var ancestorHelpersProject = map[string]string{
+	"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Greeting() string { return "from root" }
+`,
+	"cmd/helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Banner() string { return "from cmd" }
+`,
+	"cmd/other/helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Sibling() string { return "from sibling" }
+`,
+}
+
+func TestSubdirectoryRunIgnoresSiblingHelpers(t *testing.T) {
+	dir, _ := setupTestDir(t, ancestorHelpersProject)
+	writeFile(t, dir, "cmd/agent/main.go", `package main
+
+//:Sibling
+var sibling = ""
+
+func main() { println(sibling) }
+`)
+
+	agentDir := filepath.Join(dir, "cmd", "agent")
+	report, err := runWithReport(t, internal.Config{Dir: agentDir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipUnresolved {
+		t.Errorf("expected the sibling helper to stay invisible, got %+v", skip)
+	}
+	if !strings.Contains(readMain(t, agentDir), `var sibling = ""`) {
+		t.Error("target line should be unchanged")
+	}
+}
+
+func TestDepthsCountFromModuleRoot(t *testing.T) {
+	dir, _ := setupTestDir(t, ancestorHelpersProject)
+	writeFile(t, dir, "cmd/agent/main.go", "package main\n\nfunc main() {}\n")
+
+	ctx := &internal.ProcessorContext{
+		FunctionsByDir:   make(map[string]map[string]*internal.UserFunction),
+		FunctionsByDepth: make(map[int]map[string]*internal.UserFunction),
+		RootDir:          filepath.Join(dir, "cmd", "agent"),
+	}
+	if _, err := internal.NewFileProcessor(ctx).CollectAllGoFiles(ctx.RootDir); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.DepthRoot != dir {
+		t.Errorf("expected depth root %s, got %s", dir, ctx.DepthRoot)
+	}
+	if got := ctx.HelperFileDepth(filepath.Join(dir, "helpers.go")); got != 0 {
+		t.Errorf("root helper should be at depth 0, got %d", got)
+	}
+	if got := ctx.CalculateDepth(ctx.RootDir); got != 2 {
+		t.Errorf("cmd/agent should be at depth 2, got %d", got)
+	}
+	if len(ctx.FuncFiles) != 2 {
+		t.Errorf("expected the root and cmd helper files, got %v", ctx.FuncFiles)
+	}
+}
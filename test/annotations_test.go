@@ -0,0 +1,87 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// TestAnnotationsUseFinalLineNumbers checks that annotations point at the
+// replaced literal after injection has added imports above it
+func TestAnnotationsUseFinalLineNumbers(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Shift(s string) string { return strings.ToUpper(s) }
+
+func Greeting(name string) string { return "hello " + name }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:inject:Shift
+type Shifter interface {
+	Shift(s string) string
+}
+
+//:Greeting:"gopher"
+var greeting = ""
+
+func main() {
+	_ = Shift(greeting)
+}
+`)
+
+	mapPath := filepath.Join(dir, "out", "goahead.map.json")
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Annotations: mapPath}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+
+	lines := strings.Split(readMain(t, dir), "\n")
+	literalLine := 0
+	for i, line := range lines {
+		if strings.Contains(line, `var greeting = "hello gopher"`) {
+			literalLine = i + 1
+		}
+	}
+	if literalLine == 0 {
+		t.Fatalf("replacement missing, got:\n%s", strings.Join(lines, "\n"))
+	}
+	if literalLine <= 9 {
+		t.Fatalf("fixture should place the literal below injected imports, found it on line %d", literalLine)
+	}
+
+	data, err := os.ReadFile(mapPath)
+	if err != nil {
+		t.Fatalf("annotations file not written: %v", err)
+	}
+	var parsed internal.AnnotationFile
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("invalid annotations JSON: %v\n%s", err, data)
+	}
+
+	key := fmt.Sprintf("main.go:%d", literalLine)
+	entry, ok := parsed.Entries[key]
+	if !ok {
+		t.Fatalf("expected entry %s, got %v", key, parsed.Entries)
+	}
+	if entry.Helper != "Greeting" || entry.HelperFile != "helpers.go" {
+		t.Errorf("unexpected helper info: %+v", entry)
+	}
+	if !strings.HasPrefix(entry.ArgsHash, "sha256:") || entry.GoaheadVersion != internal.Version {
+		t.Errorf("unexpected hash or version: %+v", entry)
+	}
+	if len(parsed.Entries) != 1 {
+		t.Errorf("expected exactly one entry, got %v", parsed.Entries)
+	}
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal/artifact"
+)
+
+func TestArtifactRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	annotations := &artifact.Annotations{Entries: map[string]artifact.Annotation{
+		"main.go:4": {Helper: "Greeting", HelperFile: "helpers.go", ArgsHash: "sha256:00", GoaheadVersion: "dev", Trace: "0001"},
+	}}
+	path := filepath.Join(dir, "nested", "annotations.json")
+	if err := artifact.Write(path, annotations); err != nil {
+		t.Fatal(err)
+	}
+	var readAnnotations artifact.Annotations
+	if err := artifact.Read(path, &readAnnotations); err != nil {
+		t.Fatal(err)
+	}
+	if readAnnotations.SchemaVersion != artifact.AnnotationsVersion || !reflect.DeepEqual(readAnnotations.Entries, annotations.Entries) {
+		t.Errorf("annotations changed in a round trip: %+v", readAnnotations)
+	}
+
+	trace := &artifact.Trace{ID: "0002", Markers: []string{"main.go:3"}, Calls: []string{"Greeting()"}, Dir: dir, Command: []string{"go", "run"}, Env: []string{"A=1"}}
+	data, err := artifact.Encode(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"version": 1`) || !strings.HasSuffix(string(data), "}\n") {
+		t.Errorf("unexpected encoding:\n%s", data)
+	}
+	var readTrace artifact.Trace
+	if err := artifact.Decode("trace.json", data, &readTrace); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&readTrace, trace) {
+		t.Errorf("trace changed in a round trip:\n%+v\n%+v", readTrace, *trace)
+	}
+}
+
+func TestArtifactFromNewerGoahead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "annotations.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99, "entries": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var doc artifact.Annotations
+	err := artifact.Read(path, &doc)
+	if !errors.Is(err, artifact.ErrNewerVersion) {
+		t.Fatalf("expected ErrNewerVersion, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "produced by a newer goahead (schema version 99, this goahead reads up to 1)") {
+		t.Errorf("unclear error: %v", err)
+	}
+}
+
+func TestArtifactUnknownFieldsWarn(t *testing.T) {
+	var doc artifact.Annotations
+	var err error
+	stderr := captureStderr(t, func() {
+		err = artifact.Decode("annotations.json", []byte(`{"version": 1, "owner": "ci", "entries": {"a.go:1": {"helper": "H"}}}`), &doc)
+	})
+	if err != nil {
+		t.Fatalf("unknown fields should not fail the read: %v", err)
+	}
+	if !strings.Contains(stderr, `Warning: annotations annotations.json: ignoring unknown field "owner"`) {
+		t.Errorf("expected a warning, got %q", stderr)
+	}
+	if doc.Entries["a.go:1"].Helper != "H" {
+		t.Errorf("known fields should still be read: %+v", doc)
+	}
+}
+
+func TestArtifactMigratesUnversionedTrace(t *testing.T) {
+	var doc artifact.Trace
+	if err := artifact.Decode("trace.json", []byte(`{"id": "0007", "calls": ["F()"]}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.SchemaVersion != artifact.TraceVersion || doc.ID != "0007" {
+		t.Errorf("unexpected migrated trace: %+v", doc)
+	}
+
+	var annotations artifact.Annotations
+	if err := artifact.Decode("annotations.json", []byte(`{"entries": {}}`), &annotations); err == nil || !strings.Contains(err.Error(), "cannot migrate") {
+		t.Errorf("annotations have no version 0; expected a migration error, got %v", err)
+	}
+}
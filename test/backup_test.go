@@ -0,0 +1,130 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const backupHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Secret() string { return "s3cr3t" }
+
+func Shout(s string) string { return strings.ToUpper(s) }
+`
+
+const backupMain = `package main
+
+import "fmt"
+
+//:inject!:Shout
+
+//:Secret
+var secret = ""
+
+func main() { fmt.Println(secret, Shout("hi")) }
+`
+
+var backupModule = map[string]string{
+	"helpers.go": backupHelpers,
+	"main.go":    backupMain,
+}
+
+func TestRestoreRevertsBackedUpRuns(t *testing.T) {
+	dir, _ := setupTestDir(t, backupModule)
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Backup: true}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	generated := readMain(t, dir)
+	if !strings.Contains(generated, `var secret = "s3cr3t"`) || !strings.Contains(generated, "func Shout(") || !strings.Contains(generated, `"strings"`) {
+		t.Fatalf("expected the value, the injected function and its import:\n%s", generated)
+	}
+
+	// A second run records its own changes on top of the first
+	writeFile(t, dir, "helpers.go", strings.Replace(backupHelpers, `"s3cr3t"`, `"rotated"`, 1))
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Backup: true}); err != nil {
+		t.Fatalf("second RunCodegen failed: %v", err)
+	}
+	// Edits outside the generated lines survive the restore
+	edited := strings.Replace(readMain(t, dir), `fmt.Println(secret, Shout("hi"))`, `fmt.Println(secret, Shout("edited"))`, 1)
+	writeFile(t, dir, "main.go", edited)
+
+	report, err := internal.RestoreBackups(dir)
+	if err != nil {
+		t.Fatalf("RestoreBackups failed: %v", err)
+	}
+	if len(report.Restored) != 1 || report.Restored[0] != "main.go" || len(report.Conflicts) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	want := strings.Replace(backupMain, `Shout("hi")`, `Shout("edited")`, 1)
+	if content := readMain(t, dir); content != want {
+		t.Errorf("expected the pre-generation content with the manual edit:\n%s\nwant:\n%s", content, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, internal.BackupDirName)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the backup to be removed once everything was restored, got %v", err)
+	}
+}
+
+func TestRestoreLeavesEditedGeneratedLines(t *testing.T) {
+	dir, _ := setupTestDir(t, backupModule)
+	writeFile(t, dir, "other.go", "package main\n\n//:Secret\nvar other = \"\"\n")
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Backup: true}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	edited := strings.Replace(readMain(t, dir), `var secret = "s3cr3t"`, `var secret = "by hand"`, 1)
+	writeFile(t, dir, "main.go", edited)
+
+	report, err := internal.RestoreBackups(dir)
+	if err == nil || internal.ExitCode(err) != internal.ExitMarkerErrors || !strings.Contains(err.Error(), "main.go: line ") {
+		t.Fatalf("expected a conflict for main.go, got %v", err)
+	}
+	if readMain(t, dir) != edited {
+		t.Error("expected the edited file to be left alone")
+	}
+	if content := readProjectFile(t, dir, "other.go"); content != "package main\n\n//:Secret\nvar other = \"\"\n" || len(report.Restored) != 1 {
+		t.Errorf("expected the other file to be restored, got %+v:\n%s", report, content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, internal.BackupDirName, internal.BackupFileName)); err != nil {
+		t.Errorf("expected the backup of main.go to be kept: %v", err)
+	}
+}
+
+func TestRestoreWithoutBackup(t *testing.T) {
+	_, err := internal.RestoreBackups(t.TempDir())
+	if err == nil || internal.ExitCode(err) != internal.ExitEnvironment || !strings.Contains(err.Error(), "run goahead with -backup first") {
+		t.Errorf("expected a missing backup to be an environment error, got %v", err)
+	}
+}
+
+func TestRestoreSubcommand(t *testing.T) {
+	exe := buildGoahead(t)
+	dir, _ := setupTestDir(t, backupModule)
+	run := func(args ...string) string {
+		cmd := exec.Command(exe, args...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("goahead %s failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+		return string(output)
+	}
+	run("-dir", dir, "-backup")
+	if readMain(t, dir) == backupMain {
+		t.Fatal("expected the -backup run to rewrite main.go")
+	}
+	if output := run("restore", "-dir", dir); !strings.Contains(output, "[goahead] Restored main.go") {
+		t.Errorf("expected the restored file to be listed:\n%s", output)
+	}
+	if content := readMain(t, dir); content != backupMain {
+		t.Errorf("expected the original content:\n%s", content)
+	}
+}
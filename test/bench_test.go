@@ -0,0 +1,324 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// The benchmarks answer evaluation programs with benchRunner, so they
+// measure goahead itself rather than the go command. Fixtures are generated.
+
+const benchHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Value(n int) string { return "" }
+
+func Shout(s string) string { return strings.ToUpper(s) }
+`
+
+// benchRunner answers every helper call of an evaluation program with the
+// call itself, Value(3) with "Value(3)"
+type benchRunner struct{}
+
+var benchCallPattern = regexp.MustCompile(`goaheadFirst\((\w+\([^()]*\))\)`)
+
+func (benchRunner) Run(dir string, env []string, args ...string) (string, string, error) {
+	if len(args) > 0 && args[0] == "list" {
+		return "fmt\nstrings\n", "", nil
+	}
+	program, err := os.ReadFile(args[len(args)-1])
+	if err != nil {
+		return "", "", err
+	}
+	var values []string
+	for _, match := range benchCallPattern.FindAllSubmatch(program, -1) {
+		values = append(values, string(match[1]))
+	}
+	if len(values) == 0 {
+		return "", "no helper call in program\n", errors.New("exit status 1")
+	}
+	return evalOutput(values...), "", nil
+}
+
+// writeBenchTree writes files Go files named by file, spread over packages
+// of 50 files, with the helpers at the module root
+func writeBenchTree(b *testing.B, dir string, files int, file func(i int) string) {
+	b.Helper()
+	writeFile(b, dir, "go.mod", "module benchmod\ngo 1.22\n")
+	writeFile(b, dir, "helpers.go", benchHelpers)
+	for i := 0; i < files; i++ {
+		pkg := fmt.Sprintf("pkg%02d", i/50)
+		writeFile(b, dir, fmt.Sprintf("%s/file%04d.go", pkg, i), "package "+pkg+"\n\n"+file(i))
+	}
+}
+
+// runBenchCodegen runs codegen on dir b.N times; reset, when set, restores
+// the fixture before every run, outside the timer
+func runBenchCodegen(b *testing.B, dir string, reset func()) {
+	b.Helper()
+	silenceOutput(b)
+	// Spare every run the go env GOROOT call
+	goroot, err := benchGoRoot()
+	if err != nil {
+		b.Fatalf("go env GOROOT: %v", err)
+	}
+	b.Setenv("GOROOT", goroot)
+	config := internal.Config{Dir: dir, Runner: benchRunner{}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if reset != nil {
+			b.StopTimer()
+			reset()
+			b.StartTimer()
+		}
+		// Skipped markers would mean the fixture no longer measures them
+		if report, err := internal.RunCodegenWithReport(config); err != nil || report.Len() != 0 {
+			b.Fatalf("RunCodegen failed: %v\n%s", err, report.Format(dir))
+		}
+	}
+}
+
+var benchGoRoot = sync.OnceValues(func() (string, error) {
+	out, err := exec.Command("go", "env", "GOROOT").Output()
+	return strings.TrimSpace(string(out)), err
+})
+
+// silenceOutput sends the progress lines of the run to the null device
+func silenceOutput(b *testing.B) {
+	b.Helper()
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = null, null
+	b.Cleanup(func() {
+		os.Stdout, os.Stderr = stdout, stderr
+		_ = null.Close()
+	})
+}
+
+func BenchmarkScanWithoutMarkers(b *testing.B) {
+	dir := b.TempDir()
+	writeBenchTree(b, dir, 1000, func(i int) string {
+		return fmt.Sprintf("// F%d is not generated\nfunc F%d() int { return %d }\n", i, i, i)
+	})
+	runBenchCodegen(b, dir, nil)
+}
+
+// benchEchoCalls are 50 distinct marker calls; calls of another round
+// differ from them
+func benchEchoCalls(round int) []internal.BatchCall {
+	calls := make([]internal.BatchCall, 50)
+	for i := range calls {
+		calls[i] = internal.BatchCall{FuncName: "Echo", ArgsStr: fmt.Sprintf(`"value-%d-%d"`, round, i)}
+	}
+	return calls
+}
+
+func BenchmarkEvaluateMarkersUncached(b *testing.B) {
+	executor, dir := newEchoExecutor(b, benchRunner{})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, result := range executor.ExecuteBatch(benchEchoCalls(i), dir) {
+			if result.Err != nil || result.Cached {
+				b.Fatalf("expected an evaluated result, got %+v", result)
+			}
+		}
+	}
+}
+
+func BenchmarkEvaluateMarkersCached(b *testing.B) {
+	executor, dir := newEchoExecutor(b, benchRunner{})
+	calls := benchEchoCalls(0)
+	executor.ExecuteBatch(calls, dir)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, result := range executor.ExecuteBatch(calls, dir) {
+			if result.Err != nil || !result.Cached {
+				b.Fatalf("expected a cached result, got %+v", result)
+			}
+		}
+	}
+}
+
+func BenchmarkInjectTwentyFiles(b *testing.B) {
+	dir := b.TempDir()
+	file := func(i int) string {
+		return fmt.Sprintf("//:inject!:Shout\n\nfunc Hello%d() string { return Shout(\"hello\") }\n", i)
+	}
+	writeBenchTree(b, dir, 20, file)
+	runBenchCodegen(b, dir, func() { writeBenchTree(b, dir, 20, file) })
+}
+
+func BenchmarkMediumProject(b *testing.B) {
+	dir := b.TempDir()
+	file := func(i int) string {
+		var src strings.Builder
+		if i%5 == 0 {
+			src.WriteString("//:inject!:Shout\n\n")
+		}
+		for j := 0; j < 3; j++ {
+			fmt.Fprintf(&src, "//:Value:%d\nvar v%d_%d = \"\"\n\n", i*3+j, i, j)
+		}
+		fmt.Fprintf(&src, "func F%d() string { return v%d_0 }\n", i, i)
+		return src.String()
+	}
+	writeBenchTree(b, dir, 100, file)
+	runBenchCodegen(b, dir, func() { writeBenchTree(b, dir, 100, file) })
+}
+
+// BenchmarkStreamLargeFile replaces the value at the end of a 100MB file,
+// which is streamed: the heap must not grow by more than streamHeapLimit
+func BenchmarkStreamLargeFile(b *testing.B) {
+	dir := b.TempDir()
+	writeFile(b, dir, "go.mod", "module benchmod\ngo 1.22\n")
+	writeFile(b, dir, "helpers.go", benchHelpers)
+	path := filepath.Join(dir, "main.go")
+	reset := func() { writeLargeFixture(b, path, 100<<20, "package main\n\n", "//:Value:1\nvar v = \"\"\n") }
+	reset()
+
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	base, peak := stats.HeapAlloc, stats.HeapAlloc
+	done, sampled := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				var s runtime.MemStats
+				runtime.ReadMemStats(&s)
+				peak = max(peak, s.HeapAlloc)
+			}
+		}
+	}()
+	runBenchCodegen(b, dir, reset)
+	close(done)
+	<-sampled
+	b.StopTimer()
+
+	if content, err := os.ReadFile(path); err != nil || !strings.HasSuffix(string(content), "var v = \"Value(1)\"\n") {
+		b.Fatalf("expected the value at the end of the file to be replaced (%v)", err)
+	}
+	growth := int64(peak) - int64(base)
+	b.ReportMetric(float64(growth)/(1<<20), "heap-MB")
+	if growth > streamHeapLimit {
+		b.Errorf("the heap grew by %d MB while streaming a 100MB file, more than %d MB", growth>>20, streamHeapLimit>>20)
+	}
+}
+
+// streamHeapLimit is the loose bound on the heap growth of
+// BenchmarkStreamLargeFile
+const streamHeapLimit = 16 << 20
+
+// guardedBenchmarks are the benchmarks TestBenchmarkRegression compares
+var guardedBenchmarks = map[string]func(*testing.B){
+	"ScanWithoutMarkers":      BenchmarkScanWithoutMarkers,
+	"EvaluateMarkersUncached": BenchmarkEvaluateMarkersUncached,
+	"EvaluateMarkersCached":   BenchmarkEvaluateMarkersCached,
+	"InjectTwentyFiles":       BenchmarkInjectTwentyFiles,
+	"MediumProject":           BenchmarkMediumProject,
+}
+
+// benchSlowdownLimit is the ratio to the baseline above which a benchmark
+// counts as a regression
+const benchSlowdownLimit = 1.3
+
+// benchRounds is how many times each benchmark runs; the fastest round is
+// kept, which filters out most of the noise of a busy machine
+const benchRounds = 3
+
+// TestBenchmarkRegression runs the benchmarks above and compares their
+// fastest ns/op with the baseline file named by GOAHEAD_BENCH_BASELINE,
+// failing for those more than 30% slower. A missing baseline is written from this
+// run, as is an existing one with GOAHEAD_BENCH_UPDATE=1. Pass -benchtime
+// to go test for steadier numbers; record the baseline on the machine that
+// compares against it.
+func TestBenchmarkRegression(t *testing.T) {
+	path := os.Getenv("GOAHEAD_BENCH_BASELINE")
+	if path == "" {
+		t.Skip("set GOAHEAD_BENCH_BASELINE to a baseline file to compare benchmarks")
+	}
+	names := make([]string, 0, len(guardedBenchmarks))
+	for name := range guardedBenchmarks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	current := make(map[string]int64, len(names))
+	for _, name := range names {
+		for round := 0; round < benchRounds; round++ {
+			result := testing.Benchmark(guardedBenchmarks[name])
+			if result.N == 0 {
+				t.Fatalf("benchmark %s failed", name)
+			}
+			if ns := result.NsPerOp(); round == 0 || ns < current[name] {
+				current[name] = ns
+			}
+		}
+		t.Logf("%s: %d ns/op", name, current[name])
+	}
+
+	var baseline map[string]int64
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		writeBenchBaseline(t, path, current)
+		t.Logf("recorded the baseline in %s", path)
+		return
+	case err != nil:
+		t.Fatalf("read baseline: %v", err)
+	}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		t.Fatalf("invalid baseline %s: %v", path, err)
+	}
+	for _, name := range names {
+		base, ok := baseline[name]
+		if !ok || base <= 0 {
+			t.Logf("%s: not in the baseline", name)
+			continue
+		}
+		if ratio := float64(current[name]) / float64(base); ratio > benchSlowdownLimit {
+			t.Errorf("%s: %d ns/op against %d in the baseline (%.0f%% slower)", name, current[name], base, (ratio-1)*100)
+		}
+	}
+	if os.Getenv("GOAHEAD_BENCH_UPDATE") == "1" {
+		writeBenchBaseline(t, path, current)
+	}
+}
+
+func writeBenchBaseline(t *testing.T, path string, results map[string]int64) {
+	t.Helper()
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,137 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+	"github.com/AeonDave/goahead/marker"
+)
+
+const templateHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import (
+	"strings"
+	"text/template"
+)
+
+func RenderTemplate(text string) string {
+	var b strings.Builder
+	t := template.Must(template.New("t").Parse(text))
+	_ = t.Execute(&b, map[string]string{"Name": "Ada", "Service": "goahead"})
+	return b.String()
+}
+
+func Join(sep, text string) string {
+	return strings.Join(strings.Split(text, "\n"), sep)
+}
+`
+
+func TestBelowArgumentRendersMultiLineTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", templateHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+//:RenderTemplate:@below
+/* goahead:arg
+Hello {{.Name}},
+welcome to {{.Service}}: "enjoy".
+*/
+var greeting = ""
+
+//:Join:" | ":@below
+
+/* goahead:arg
+a
+b
+*/
+var joined = ""
+
+func main() { println(greeting, joined) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("expected no skipped markers, got:\n%s", report.Format(dir))
+	}
+	first := readMain(t, dir)
+	for _, want := range []string{
+		`var greeting = "Hello Ada,\nwelcome to goahead: \"enjoy\"."`,
+		`var joined = "a | b"`,
+		"/* goahead:arg\nHello {{.Name}},",
+	} {
+		if !strings.Contains(first, want) {
+			t.Errorf("expected %q in:\n%s", want, first)
+		}
+	}
+	verifyCompiles(t, dir)
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	if second := readMain(t, dir); second != first {
+		t.Errorf("second run changed the file:\n---- first ----\n%s\n---- second ----\n%s", first, second)
+	}
+}
+
+func TestBelowArgumentWithoutBlockIsSkipped(t *testing.T) {
+	for name, tc := range map[string]struct {
+		source string
+		want   string
+	}{
+		"missing": {
+			source: "package main\n\n//:RenderTemplate:@below\nvar greeting = \"\"\n\nfunc main() {}\n",
+			want:   "no /* goahead:arg ... */ block comment below the marker",
+		},
+		"unterminated": {
+			source: "package main\n\n//:RenderTemplate:@below\n/* goahead:arg\nHello\n",
+			want:   "block comment is not closed",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+			writeFile(t, dir, "helpers.go", templateHelpers)
+			writeFile(t, dir, "main.go", tc.source)
+
+			report, err := runWithReport(t, internal.Config{Dir: dir})
+			if err != nil {
+				t.Fatalf("RunCodegen failed: %v", err)
+			}
+			skip := singleSkip(t, report)
+			if skip.Reason != internal.SkipInvalidArgument || skip.Line != 3 || !strings.Contains(skip.Suggestion, tc.want) {
+				t.Errorf("unexpected skip: %+v", skip)
+			}
+			if readMain(t, dir) != tc.source {
+				t.Error("file should be unchanged")
+			}
+		})
+	}
+}
+
+func TestSubstituteBelow(t *testing.T) {
+	if !marker.UsesBelow(`" | ":@below`) || marker.UsesBelow(`"@below"`) || marker.UsesBelow("below") {
+		t.Error("UsesBelow should only match a bare @below argument")
+	}
+	got, err := marker.SubstituteBelow(`" | ":@below`, "a\nb: \"c\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `" | ":"a\nb: \"c\""`; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+	args, err := marker.ParseArguments(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 2 || args[1].Raw != "a\nb: \"c\"" || args[1].Kind != marker.ArgString {
+		t.Errorf("substituted argument should parse back as the string, got %+v", args)
+	}
+}
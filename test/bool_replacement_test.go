@@ -0,0 +1,53 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestBoolReplacement(t *testing.T) {
+	tests := []struct {
+		name   string
+		helper string
+		line   string
+		want   string
+	}{
+		{"TrueToFalse", "false", "var enabled = true", "var enabled = false"},
+		{"FalseToTrue", "true", "var enabled = false", "var enabled = true"},
+		{"OnlyFirstToken", "true", "var enabled = false || true", "var enabled = true || true"},
+		{"SkipsStringLiterals", "true", `var enabled = mode == "false" || false`, `var enabled = mode == "false" || true`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+			writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func IsEnabled() bool { return `+tt.helper+` }
+`)
+			writeFile(t, dir, "main.go", `package main
+
+var mode = ""
+
+//:IsEnabled
+`+tt.line+`
+
+func main() { println(enabled) }
+`)
+
+			if err := internal.RunCodegen(dir, false); err != nil {
+				t.Fatalf("RunCodegen failed: %v", err)
+			}
+			content := readMain(t, dir)
+			if !strings.Contains(content, tt.want+"\n") {
+				t.Errorf("expected %q in:\n%s", tt.want, content)
+			}
+			verifyCompiles(t, dir)
+		})
+	}
+}
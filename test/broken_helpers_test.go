@@ -0,0 +1,138 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// brokenHelperProject is a module whose good.go helper works and whose
+// broken.go helper defines Secret, for the tests to break
+var brokenHelperProject = map[string]string{
+	"good.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Greeting() string { return "hello" }
+`,
+	"broken.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Secret() string { return "s3cret" }
+`,
+	"main.go": `package main
+
+//:Greeting
+var greeting = ""
+
+//:Secret
+var secret = ""
+
+func main() {}
+`,
+}
+
+// unreadable keeps the build constraint of the helper readable, so it is
+// known to be a helper, but breaks its header with an over-long line
+func unreadable(t *testing.T) func(string) {
+	return func(path string) {
+		writeFile(t, filepath.Dir(path), filepath.Base(path), "//go:build exclude\n// "+strings.Repeat("x", 1<<17)+"\n//go:ahead functions\n\npackage main\n")
+	}
+}
+
+// chmodUnreadable makes path unreadable, skipping where permissions do not
+// apply
+func chmodUnreadable(t *testing.T, path string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("file permissions are not enforced on Windows")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("root can read files with mode 000")
+	}
+	if err := os.Chmod(path, 0o000); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(path, 0o644) })
+}
+
+func unparsable(t *testing.T) func(string) {
+	return func(path string) {
+		writeFile(t, filepath.Dir(path), filepath.Base(path), `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Secret() string { return "s3cret"
+`)
+	}
+}
+
+func TestBrokenHelperAggregatedError(t *testing.T) {
+	for name, corrupt := range map[string]func(*testing.T) func(string){"Unreadable": unreadable, "Unparsable": unparsable} {
+		t.Run(name, func(t *testing.T) {
+			dir, _ := setupTestDir(t, brokenHelperProject)
+			corrupt(t)(filepath.Join(dir, "broken.go"))
+			original := readMain(t, dir)
+
+			_, err := runWithReport(t, internal.Config{Dir: dir})
+			if err == nil {
+				t.Fatal("expected an error for the broken helper file")
+			}
+			if !strings.Contains(err.Error(), "1 helper file(s) could not be loaded") || !strings.Contains(err.Error(), "broken.go: ") {
+				t.Errorf("error should name broken.go: %v", err)
+			}
+			if readMain(t, dir) != original {
+				t.Error("no file should be processed when a helper file is broken")
+			}
+		})
+	}
+}
+
+func TestSkipBrokenHelpers(t *testing.T) {
+	for name, corrupt := range map[string]func(*testing.T) func(string){"Unreadable": unreadable, "Unparsable": unparsable} {
+		t.Run(name, func(t *testing.T) {
+			dir, _ := setupTestDir(t, brokenHelperProject)
+			corrupt(t)(filepath.Join(dir, "broken.go"))
+
+			var (
+				report *internal.SkipReport
+				err    error
+			)
+			stderr := captureStderr(t, func() {
+				report, err = internal.RunCodegenWithReport(internal.Config{Dir: dir, SkipBrokenHelpers: true})
+			})
+			if err != nil {
+				t.Fatalf("RunCodegen failed: %v", err)
+			}
+			if !strings.Contains(stderr, "WARNING: skipping helper file broken.go") {
+				t.Errorf("expected a warning for broken.go:\n%s", stderr)
+			}
+			if content := readMain(t, dir); !strings.Contains(content, `var greeting = "hello"`) {
+				t.Errorf("markers of working helpers should still be processed:\n%s", content)
+			}
+			skip := singleSkip(t, report)
+			if skip.Marker != "//:Secret" || !strings.Contains(skip.Suggestion, "skipped helper file(s) broken.go") {
+				t.Errorf("unexpected skip: %+v", skip)
+			}
+		})
+	}
+}
+
+func TestUnreadableSourceIsNotAHelper(t *testing.T) {
+	dir, _ := setupTestDir(t, brokenHelperProject)
+	writeFile(t, dir, "other.go", "package main\n\nvar other = 1\n")
+	chmodUnreadable(t, filepath.Join(dir, "other.go"))
+
+	_, err := runWithReport(t, internal.Config{Dir: dir})
+	if err == nil || strings.Contains(err.Error(), "could not be loaded") || !strings.Contains(err.Error(), "other.go") {
+		t.Fatalf("expected the read error of other.go, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// otherGOOS is a platform the tests are not built for
+func otherGOOS() string {
+	if runtime.GOOS == "windows" {
+		return "linux"
+	}
+	return "windows"
+}
+
+var constrainedProject = map[string]string{
+	"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Secret() string { return "s3cret" }
+`,
+	"main.go": `package main
+
+//:Secret
+var host = ""
+
+func main() { println(host) }
+`,
+	"tagged.go": "//go:build " + otherGOOS() + `
+
+package main
+
+//:Secret
+var tagged = ""
+`,
+	"suffix_" + otherGOOS() + ".go": `package main
+
+//:Secret
+var suffixed = ""
+`,
+	"integration.go": `//go:build integration
+
+package main
+
+//:Secret
+var integration = ""
+`,
+}
+
+func readProjectFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestRespectBuildTagsSkipsOtherPlatforms(t *testing.T) {
+	dir, _ := setupTestDir(t, constrainedProject)
+	if _, err := runWithReport(t, internal.Config{Dir: dir, RespectBuildTags: true}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if !strings.Contains(readMain(t, dir), `var host = "s3cret"`) {
+		t.Errorf("expected the host file to be processed:\n%s", readMain(t, dir))
+	}
+	for _, name := range []string{"tagged.go", "suffix_" + otherGOOS() + ".go", "integration.go"} {
+		if strings.Contains(readProjectFile(t, dir, name), "s3cret") {
+			t.Errorf("expected %s to be skipped:\n%s", name, readProjectFile(t, dir, name))
+		}
+	}
+
+	// Build tags select files like go build -tags
+	if _, err := runWithReport(t, internal.Config{Dir: dir, RespectBuildTags: true, BuildTags: []string{"integration"}}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if !strings.Contains(readProjectFile(t, dir, "integration.go"), `var integration = "s3cret"`) {
+		t.Errorf("expected integration.go to be processed with -tags=integration")
+	}
+	if strings.Contains(readProjectFile(t, dir, "tagged.go"), "s3cret") {
+		t.Errorf("expected tagged.go to stay skipped")
+	}
+}
+
+func TestBuildTagsIgnoredByDefault(t *testing.T) {
+	dir, _ := setupTestDir(t, constrainedProject)
+	if _, err := runWithReport(t, internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	for _, name := range []string{"main.go", "tagged.go", "suffix_" + otherGOOS() + ".go", "integration.go"} {
+		if !strings.Contains(readProjectFile(t, dir, name), `= "s3cret"`) {
+			t.Errorf("expected %s to be processed without -respect-build-tags:\n%s", name, readProjectFile(t, dir, name))
+		}
+	}
+}
+
+func TestToolexecHonorsCompiledFiles(t *testing.T) {
+	isolateTrust(t, "1")
+	dir, _ := setupTestDir(t, constrainedProject)
+	chdir(t, dir)
+
+	// The go command compiled main.go and, built with -tags=integration,
+	// integration.go; the tags themselves are not passed to the compiler
+	if err := internal.NewToolexecManager().ProcessPackage([]string{"./main.go", "./integration.go"}, ""); err != nil {
+		t.Fatalf("ProcessPackage failed: %v", err)
+	}
+	for name, want := range map[string]bool{"main.go": true, "integration.go": true, "tagged.go": false} {
+		if got := strings.Contains(readProjectFile(t, dir, name), "s3cret"); got != want {
+			t.Errorf("%s processed = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const byteLiteralHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Encrypt(s string) []byte {
+	out := []byte(s)
+	for i := range out {
+		out[i] ^= 0x2a
+	}
+	return out
+}
+
+func Key() [4]byte { return [4]byte{1, 2, 3, 4} }
+`
+
+func TestByteResultsIntoByteTargets(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", byteLiteralHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+//:Encrypt:"hello"
+var blob = []byte{}
+
+//:Encrypt:"hi"
+var unset []byte = nil
+
+//:Encrypt:"abcd"
+var fixed = [4]byte{} // key
+
+//:Encrypt:"abcd"
+var declared [4]byte
+
+//:Key
+var key = [4]byte{}
+
+//:Key
+var keySlice = []byte{}
+
+func main() { println(len(blob), len(unset), len(fixed), len(declared), len(key), len(keySlice)) }
+`)
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{
+		"var blob = []byte{0x42, 0x4f, 0x46, 0x46, 0x45}",
+		"var unset []byte = []byte{0x42, 0x43}",
+		"var fixed = [4]byte{0x4b, 0x48, 0x49, 0x4e} // key",
+		"var declared [4]byte = [4]byte{0x4b, 0x48, 0x49, 0x4e}",
+		"var key = [4]byte{0x1, 0x2, 0x3, 0x4}",
+		"var keySlice = []byte{0x1, 0x2, 0x3, 0x4}",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestByteArrayLengthMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", byteLiteralHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+//:Encrypt:"ab"
+var key = [16]byte{}
+
+func main() { println(len(key)) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skipped := singleSkip(t, report)
+	if skipped.Reason != internal.SkipLengthMismatch || skipped.Suggestion != "the helper returned 2 byte(s) but [16]byte holds 16" {
+		t.Errorf("expected a length-mismatch skip, got %+v", skipped)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, "var key = [16]byte{}") {
+		t.Errorf("expected the target to be left alone:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+}
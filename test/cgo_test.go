@@ -1,6 +1,9 @@
 package test
 
 import (
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"os"
 	"path/filepath"
 	"strings"
@@ -144,3 +147,87 @@ func main() {
 		}
 	})
 }
+
+// assertCgoPreamble checks that src parses, that import "C" is a declaration
+// of its own with the preamble as its doc comment, and that want is imported
+func assertCgoPreamble(t *testing.T, src, want string) {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("injected file does not parse: %v\n%s", err, src)
+	}
+	foundC, foundWant := false, false
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			path := spec.(*ast.ImportSpec).Path.Value
+			switch path {
+			case `"C"`:
+				foundC = true
+				if len(gen.Specs) != 1 || gen.Doc == nil || !strings.Contains(gen.Doc.Text(), "#include <stdlib.h>") {
+					t.Errorf("import \"C\" lost its preamble or shares its declaration:\n%s", src)
+				}
+			case want:
+				foundWant = true
+			}
+		}
+	}
+	if !foundC || !foundWant {
+		t.Errorf("expected imports \"C\" and %s:\n%s", want, src)
+	}
+}
+
+func TestCgoInjectionImports(t *testing.T) {
+	const preamble = "/*\n#include <stdlib.h>\n*/\nimport \"C\"\n"
+	for name, imports := range map[string]string{
+		"only cgo":          preamble,
+		"single after cgo":  preamble + "\nimport \"fmt\"\n",
+		"single before cgo": "import \"fmt\"\n\n" + preamble,
+		"block before cgo":  "import (\n\t\"fmt\"\n)\n\n" + preamble,
+		"cgo block":         "/*\n#include <stdlib.h>\n*/\nimport (\n\t\"C\"\n)\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+			writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "encoding/hex"
+
+func Decode(s string) string {
+	b, _ := hex.DecodeString(s)
+	return string(b)
+}
+`)
+			use := ""
+			if strings.Contains(imports, `"fmt"`) {
+				use = "\nvar _ = fmt.Sprint\n"
+			}
+			writeFile(t, dir, "main.go", "package main\n\n"+imports+use+`
+//:inject!:Decode
+
+func main() { C.free(nil); println(Decode("6869")) }
+`)
+			if err := internal.RunCodegen(dir, false); err != nil {
+				t.Fatalf("RunCodegen failed: %v", err)
+			}
+			content := readMain(t, dir)
+			assertCgoPreamble(t, content, `"encoding/hex"`)
+			if strings.Count(content, `"encoding/hex"`) != 1 || strings.Count(content, `"fmt"`) > 1 {
+				t.Errorf("imports were added twice:\n%s", content)
+			}
+
+			if err := internal.RunCodegen(dir, false); err != nil {
+				t.Fatalf("second run failed: %v", err)
+			}
+			if again := readMain(t, dir); again != content {
+				t.Errorf("second run changed the file:\n%s", again)
+			}
+		})
+	}
+}
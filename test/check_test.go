@@ -0,0 +1,142 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const checkHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Version() string { return "1.0" }
+
+func Add(a, b int) int { return a + b }
+`
+
+func TestCheckFailsOnSkippedMarkers(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOAHEAD_CACHE", "off")
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", checkHelpers)
+	mainSource := `package main
+
+//:Version
+var version = ""
+
+//:Missing
+var missing = ""
+
+//:Add:1
+var sum = 0
+
+func main() { println(version, missing, sum) }
+`
+	writeFile(t, dir, "main.go", mainSource)
+
+	var err error
+	stderr := captureStderr(t, func() {
+		_, err = internal.RunCodegenWithStats(internal.Config{Dir: dir, Check: true})
+	})
+	if !errors.Is(err, internal.ErrUnresolvedMarker) || internal.ExitCode(err) != internal.ExitMarkerErrors {
+		t.Fatalf("expected the skipped markers to fail the check, got %v", err)
+	}
+	for _, want := range []string{"main.go:6", "unresolved", "main.go:9", "expects 2 arguments, got 1"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("expected %q in the report:\n%s", want, stderr)
+		}
+	}
+	if strings.Contains(stderr, "main.go:3 ") {
+		t.Errorf("expected the resolved marker left out of the report:\n%s", stderr)
+	}
+	if content := readMain(t, dir); content != mainSource {
+		t.Fatalf("expected main.go unchanged:\n%s", content)
+	}
+
+	// Once every marker resolves the check passes, still writing nothing
+	fixed := strings.Replace(strings.Replace(mainSource, "//:Missing", "//:Version", 1), "//:Add:1", "//:Add:1:2", 1)
+	writeFile(t, dir, "main.go", fixed)
+	stats, err := internal.RunCodegenWithStats(internal.Config{Dir: dir, Check: true})
+	if err != nil || stats.Skipped != 0 {
+		t.Fatalf("expected the check to pass, got %+v, %v", stats, err)
+	}
+	if content := readMain(t, dir); content != fixed {
+		t.Errorf("expected main.go unchanged:\n%s", content)
+	}
+
+	if err := (internal.Config{Dir: dir, Check: true, Backup: true}).Validate(); err == nil {
+		t.Error("expected -check with -backup to be rejected")
+	}
+}
+
+func TestToolexecStrictFailsCompile(t *testing.T) {
+	dir := t.TempDir()
+	isolateTrust(t, "1")
+	t.Setenv("GOAHEAD_CACHE", "off")
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", checkHelpers)
+	writeFile(t, dir, "main.go", "package main\n\n//:Missing\nvar missing = \"\"\n\nfunc main() { println(missing) }\n")
+	chdir(t, dir)
+
+	args := []string{"-o", "/work/b001/_pkg_.a", "-p", "main", dir + "/main.go"}
+	var err error
+	captureStderr(t, func() {
+		_, cleanup, perr := internal.NewToolexecManager().ProcessPackageCopy(args)
+		if perr == nil {
+			cleanup()
+		}
+		err = perr
+	})
+	if err != nil {
+		t.Fatalf("expected the compile to go on without %s, got %v", internal.StrictEnv, err)
+	}
+
+	t.Setenv(internal.StrictEnv, "1")
+	captureStderr(t, func() {
+		_, _, err = internal.NewToolexecManager().ProcessPackageCopy(args)
+	})
+	if !errors.Is(err, internal.ErrUnresolvedMarker) {
+		t.Errorf("expected %s=1 to fail the compile, got %v", internal.StrictEnv, err)
+	}
+	captureStderr(t, func() {
+		err = internal.NewToolexecManager().ProcessPackage([]string{dir + "/main.go"}, dir)
+	})
+	if !errors.Is(err, internal.ErrUnresolvedMarker) {
+		t.Errorf("expected %s=1 to fail the in-place compile, got %v", internal.StrictEnv, err)
+	}
+}
+
+func TestCheckReportsSourcePaths(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOAHEAD_CACHE", "off")
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", strings.Replace(checkHelpers, "//go:ahead functions\n", "//go:ahead functions\n//go:ahead bogus\n", 1))
+	writeFile(t, dir, "main.go", "package main\n\n//:Missing\nvar missing = \"\"\n\nfunc main() { println(missing) }\n")
+	out := filepath.Join(t.TempDir(), "goahead.xml")
+
+	var err error
+	stderr := captureStderr(t, func() {
+		_, err = internal.RunCodegenWithStats(internal.Config{Dir: dir, Check: true, Diagnostics: "checkstyle:" + out})
+	})
+	if !errors.Is(err, internal.ErrUnresolvedMarker) {
+		t.Fatalf("expected the check to fail on the skipped marker, got %v", err)
+	}
+	if strings.Contains(stderr, "goahead-dry-run") || !strings.Contains(stderr, filepath.Join(dir, "main.go")) {
+		t.Errorf("expected the warnings to name the sources:\n%s", stderr)
+	}
+	data, readErr := os.ReadFile(out)
+	if readErr != nil {
+		t.Fatalf("diagnostics file not written: %v", readErr)
+	}
+	for _, want := range []string{`<file name="helpers.go">`, `<file name="main.go">`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %s, a path from the sources, in:\n%s", want, data)
+		}
+	}
+}
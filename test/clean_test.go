@@ -0,0 +1,126 @@
+package test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const cleanHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func Shout(s string) string { return strings.ToUpper(s) }
+
+func Describe(n int) string { return fmt.Sprintf("%d items", n) }
+`
+
+func TestCleanRemovesInjectedCode(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", cleanHelpers)
+	// No imports: the run adds a declaration of its own
+	mainSource := `package main
+
+//:inject!:Shout
+
+func main() { println(Shout("hi"), describe()) }
+`
+	// The file's own import is kept, the block's is dropped
+	describeSource := `package main
+
+import "os"
+
+//:inject:Describe
+type Describer interface {
+	Describe(n int) string
+}
+
+func describe() string { return Describe(len(os.Args)) }
+`
+	writeFile(t, dir, "main.go", mainSource)
+	writeFile(t, dir, "describe.go", describeSource)
+	writeFile(t, dir, "sub/go.mod", "module sub\ngo 1.22\n")
+	writeFile(t, dir, "sub/helpers.go", cleanHelpers)
+	writeFile(t, dir, "sub/main.go", mainSource)
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	generated := map[string]string{}
+	for _, name := range []string{"main.go", "describe.go", "sub/main.go"} {
+		generated[name] = readProjectFile(t, dir, name)
+		if !strings.Contains(generated[name], "// End of goahead generated code.") {
+			t.Fatalf("expected an injected block in %s:\n%s", name, generated[name])
+		}
+	}
+	cmd := exec.Command("go", "build", "./...")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, output)
+	}
+
+	report, err := internal.CleanInjected(dir)
+	if err != nil {
+		t.Fatalf("CleanInjected failed: %v", err)
+	}
+	if strings.Join(report.Cleaned, ",") != "describe.go,main.go,sub/main.go" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	// The run turned the single import into a block, which stays one
+	cleanedDescribe := strings.Replace(describeSource, `import "os"`, "import (\n\t\"os\"\n)", 1)
+	for name, want := range map[string]string{"main.go": mainSource, "describe.go": cleanedDescribe, "sub/main.go": mainSource} {
+		if content := readProjectFile(t, dir, name); content != want {
+			t.Errorf("expected %s back to its source:\n%s\nwant:\n%s", name, content, want)
+		}
+	}
+
+	// Nothing is left to clean
+	if report, err := internal.CleanInjected(dir); err != nil || len(report.Cleaned) != 0 {
+		t.Errorf("expected a second clean to be a no-op, got %+v, %v", report, err)
+	}
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen after clean failed: %v", err)
+	}
+	for name, want := range generated {
+		if content := readProjectFile(t, dir, name); content != want {
+			t.Errorf("expected %s regenerated identically:\n%s\nwant:\n%s", name, content, want)
+		}
+	}
+}
+
+func TestCleanKeepsImportsTheFileUses(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", cleanHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+//:inject!:Describe
+
+func main() { fmt.Println(strings.ToLower(Describe(1))) }
+`)
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if _, err := internal.CleanInjected(dir); err != nil {
+		t.Fatalf("CleanInjected failed: %v", err)
+	}
+	content := readMain(t, dir)
+	if strings.Contains(content, "func Describe(") || !strings.Contains(content, "\t\"fmt\"\n\t\"strings\"\n") {
+		t.Errorf("expected the block removed and both imports kept:\n%s", content)
+	}
+}
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const companionHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "time"
+
+func Version() string { return "1.2.0" }
+
+func Port() int { return 8080 }
+
+func Endpoint() (string, int) { return "api.local", 443 }
+
+func Timeout() time.Duration { return 3 * time.Second }
+`
+
+const companionMain = `package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type config struct {
+	Name    string
+	Timeout time.Duration
+}
+
+//:Version
+var version = ""
+
+//:Endpoint -> host, port
+var (
+	host = ""
+	port = 0
+)
+
+var cfg = config{
+	//:Version
+	Name:    "",
+	Timeout: time.Duration(0),
+}
+
+func main() {
+	fmt.Println(version, host, port, cfg.Name)
+}
+`
+
+func TestCompanionLeavesSourcesUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", companionHelpers)
+	writeFile(t, dir, "main.go", companionMain)
+
+	want := `// Code generated by goahead; DO NOT EDIT.
+
+package main
+
+import "time"
+
+func init() {
+	version = "1.2.0"
+	host = "api.local"
+	port = 443
+	cfg = config{
+		Name:    "1.2.0",
+		Timeout: time.Duration(0),
+	}
+}
+`
+	for run := 1; run <= 2; run++ {
+		report, err := runWithReport(t, internal.Config{Dir: dir, Companion: true})
+		if err != nil {
+			t.Fatalf("run %d: RunCodegen failed: %v", run, err)
+		}
+		if report.Len() != 0 {
+			t.Fatalf("run %d: expected no skipped markers, got:\n%s", run, report.Format(dir))
+		}
+		if content := readMain(t, dir); content != companionMain {
+			t.Fatalf("run %d: expected main.go unchanged:\n%s", run, content)
+		}
+		if content := readProjectFile(t, dir, "main_goahead.go"); content != want {
+			t.Fatalf("run %d: unexpected companion:\n%s", run, content)
+		}
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run failed: %v\n%s", err, output)
+	}
+	if got := strings.TrimSpace(string(output)); got != "1.2.0 api.local 443 1.2.0" {
+		t.Errorf("expected the companion's values at run time, got %q", got)
+	}
+}
+
+func TestCompanionSkipsTargetsItCannotAssign(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", companionHelpers)
+	source := `package main
+
+//:Port
+const limit = 0
+
+func main() {
+	//:Version
+	local := ""
+	println(local, limit)
+}
+`
+	writeFile(t, dir, "main_linux.go", source)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir, Companion: true})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skips := report.Markers()
+	if len(skips) != 2 {
+		t.Fatalf("expected two skipped markers, got:\n%s", report.Format(dir))
+	}
+	for i, want := range []string{
+		"the target is a constant; only package-level variables can be assigned from main_goahead_linux.go",
+		"the target is a local declaration of func main; only package-level variables can be assigned from main_goahead_linux.go",
+	} {
+		if skips[i].Reason != internal.SkipCompanion || skips[i].Suggestion != want {
+			t.Errorf("expected a companion skip %q, got %+v", want, skips[i])
+		}
+	}
+	if content := readProjectFile(t, dir, "main_linux.go"); content != source {
+		t.Errorf("expected main_linux.go unchanged:\n%s", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "main_goahead_linux.go")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no companion without values, got %v", err)
+	}
+}
+
+func TestCompanionRefusesInjectMarkers(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", companionHelpers)
+	writeFile(t, dir, "main.go", "package main\n\n//:inject!:Version\n\nfunc main() {}\n")
+
+	err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Companion: true})
+	if err == nil || !strings.Contains(err.Error(), "-companion cannot write the inject marker at") {
+		t.Fatalf("expected the inject marker to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const compositeHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Routes() map[string]string { return map[string]string{"/": "index", "/about": "about"} }
+
+func Names() []string { return []string{"ada", "bob"} }
+
+func Ports() []int { return []int{80, 443} }
+
+func Weights() map[string]float64 { return map[string]float64{"cpu": 1.5} }
+`
+
+func TestCompositeResultsReplaceCompositeLiterals(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", compositeHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+type server struct {
+	Names  []string
+	Routes map[string]string
+}
+
+//:Routes
+var routes = map[string]string{}
+
+//:Names
+var names = []string{"placeholder"}
+
+//:Ports
+var ports []int
+
+//:Weights
+var weights = map[string]float64{} // per resource
+
+//:Names
+var none []string = nil
+
+//:Names
+var all = append([]string{}, "eve")
+
+var srv = server{
+	//:Names
+	Names: []string{},
+	//:Routes
+	Routes: map[string]string{},
+}
+
+func main() { println(len(routes), len(names), len(ports), len(weights), len(none), len(all), len(srv.Names)) }
+`)
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{
+		`var routes = map[string]string{"/": "index", "/about": "about"}`,
+		`var names = []string{"ada", "bob"}`,
+		`var ports []int = []int{80, 443}`,
+		`var weights = map[string]float64{"cpu": 1.5} // per resource`,
+		`var none []string = []string{"ada", "bob"}`,
+		`var all = append([]string{"ada", "bob"}, "eve")`,
+		`Names: []string{"ada", "bob"},`,
+		`Routes: map[string]string{"/": "index", "/about": "about"},`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestCompositeOutputOfStringLiteralIsMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", compositeHelpers+"\nfunc Both() ([]string, int) { return []string{\"a\"}, 1 }\n")
+	writeFile(t, dir, "main.go", `package main
+
+//:Both -> names, count
+var (
+	names = ""
+	count = 0
+)
+
+func main() { println(names, count) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if skipped := singleSkip(t, report); skipped.Reason != internal.SkipOutputMismatch {
+		t.Errorf("expected a slice into a string literal to be an output mismatch, got %+v", skipped)
+	}
+	verifyCompiles(t, dir)
+}
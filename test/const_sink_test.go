@@ -0,0 +1,169 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const sinkHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Greeting() string { return "hello" }
+
+func Limit() int { return 42 }
+`
+
+var sinkConstPattern = regexp.MustCompile(`GoaheadVal_[0-9a-f]{16}`)
+
+var sinkProject = map[string]string{
+	"go.mod":     "module testmod\ngo 1.22\n",
+	"helpers.go": sinkHelpers,
+	"main.go": `package main
+
+import "testmod/pkg/a"
+
+//:Greeting
+var greeting = ""
+
+func main() { println(greeting, a.Limit) }
+`,
+	"pkg/a/a.go": `package a
+
+//:Limit
+var Limit = 0
+`,
+	"internal/generated/doc.go": "// Package generated holds goahead values\npackage generated\n",
+}
+
+func readSink(t *testing.T, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "internal", "generated", "values.go"))
+	if err != nil {
+		t.Fatalf("failed to read the sink: %v", err)
+	}
+	return string(data)
+}
+
+// buildModule builds every package of the module in dir
+func buildModule(t *testing.T, dir string) {
+	t.Helper()
+	cmd := exec.Command("go", "vet", "./...")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generated module does not build: %v\n%s", err, output)
+	}
+}
+
+func TestConstSinkReferencedFromTwoPackages(t *testing.T) {
+	dir, _ := setupTestDir(t, sinkProject)
+	cfg := internal.Config{Dir: dir, ConstSink: "internal/generated/values.go"}
+	report, err := runWithReport(t, cfg)
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("expected no skipped markers, got:\n%s", report.Format(dir))
+	}
+
+	sink := readSink(t, dir)
+	if !strings.HasPrefix(sink, "// Code generated by goahead; DO NOT EDIT.\n\npackage generated\n") {
+		t.Errorf("unexpected sink header:\n%s", sink)
+	}
+	names := sinkConstPattern.FindAllString(sink, -1)
+	if len(names) != 2 || names[0] >= names[1] {
+		t.Fatalf("expected two sorted constants in:\n%s", sink)
+	}
+	if !strings.Contains(sink, `= "hello"`) || !strings.Contains(sink, "= 42\n") {
+		t.Errorf("expected both values in the sink:\n%s", sink)
+	}
+
+	mainContent := readMain(t, dir)
+	pkgContent, _ := os.ReadFile(filepath.Join(dir, "pkg", "a", "a.go"))
+	for file, content := range map[string]string{"main.go": mainContent, "a.go": string(pkgContent)} {
+		if !strings.Contains(content, `"testmod/internal/generated"`) || !regexp.MustCompile(`= generated\.GoaheadVal_[0-9a-f]{16}\n`).MatchString(content) {
+			t.Errorf("expected %s to import and reference the sink:\n%s", file, content)
+		}
+	}
+	// The sink import joins the one of main.go in gofmt order
+	if !strings.Contains(mainContent, "import (\n\t\"testmod/internal/generated\"\n\t\"testmod/pkg/a\"\n)\n") {
+		t.Errorf("expected the imports of main.go sorted:\n%s", mainContent)
+	}
+
+	// A second run leaves every file as it is
+	if _, err := runWithReport(t, cfg); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if readSink(t, dir) != sink || readMain(t, dir) != mainContent {
+		t.Errorf("re-run changed the output:\n%s\n%s", readSink(t, dir), readMain(t, dir))
+	}
+	buildModule(t, dir)
+}
+
+func TestConstSinkFollowsHelperChanges(t *testing.T) {
+	dir, _ := setupTestDir(t, sinkProject)
+	cfg := internal.Config{Dir: dir, ConstSink: "internal/generated/values.go"}
+	if _, err := runWithReport(t, cfg); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	before := sinkConstPattern.FindString(readMain(t, dir))
+
+	writeFile(t, dir, "helpers.go", strings.Replace(sinkHelpers, `"hello"`, `"goodbye"`, 1))
+	report, err := runWithReport(t, cfg)
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("expected no skipped markers, got:\n%s", report.Format(dir))
+	}
+	sink := readSink(t, dir)
+	after := sinkConstPattern.FindString(readMain(t, dir))
+	if after == before || !strings.Contains(sink, after+` = "goodbye"`) {
+		t.Errorf("expected main.go to reference the new value, got %s in:\n%s", after, sink)
+	}
+	if strings.Contains(sink, "hello") || strings.Contains(sink, before) {
+		t.Errorf("the previous value must be dropped:\n%s", sink)
+	}
+	if strings.Count(readMain(t, dir), `"testmod/internal/generated"`) != 1 {
+		t.Errorf("the import must be added once:\n%s", readMain(t, dir))
+	}
+	buildModule(t, dir)
+}
+
+func TestConstSinkImportCycleIsSkipped(t *testing.T) {
+	dir, _ := setupTestDir(t, sinkProject)
+	// The sink package imports pkg/a, so pkg/a cannot refer to it
+	writeFile(t, dir, "internal/generated/doc.go", `// Package generated holds goahead values
+package generated
+
+import "testmod/pkg/a"
+
+var _ = a.Limit
+`)
+	report, err := runWithReport(t, internal.Config{Dir: dir, ConstSink: "internal/generated/values.go"})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipConstSink || !strings.Contains(skip.Suggestion, "import cycle") || !strings.Contains(skip.Suggestion, "testmod/pkg/a") {
+		t.Errorf("expected an import-cycle skip, got %+v", skip)
+	}
+	pkgContent, _ := os.ReadFile(filepath.Join(dir, "pkg", "a", "a.go"))
+	if strings.Contains(string(pkgContent), "generated") {
+		t.Errorf("pkg/a must not import the sink:\n%s", pkgContent)
+	}
+	if !strings.Contains(readMain(t, dir), "generated.GoaheadVal_") {
+		t.Errorf("expected main.go to reference the sink:\n%s", readMain(t, dir))
+	}
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir, ConstSink: "values_test.go"}); err == nil || !strings.Contains(err.Error(), "-const-sink") {
+		t.Errorf("expected an error for a test file sink, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const constantRangeHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Port() int { return 300 }
+
+func Pair() (int, int) { return 300, -129 }
+`
+
+func TestConstantOverflowIntoByte(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", constantRangeHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+//:Port
+var b byte = 0
+
+func main() { println(b) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skipped := singleSkip(t, report)
+	if skipped.Reason != internal.SkipConstantOverflow || skipped.Suggestion != "300 overflows byte (range 0 to 255)" {
+		t.Errorf("expected a constant-overflow skip citing the range, got %+v", skipped)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, "var b byte = 0") {
+		t.Errorf("expected the target to be left alone:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestConstantRangeOfTargets(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", constantRangeHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+//:Port
+var n int = 0
+
+//:Port
+var wide = int16(0)
+
+//:Port
+var narrow = int8(0)
+
+//:Pair -> lo, hi
+var (
+	lo uint16 = 0
+	hi int8   = 0
+)
+
+func main() { println(n, wide, narrow, lo, hi) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{"var n int = 300", "var wide = int16(300)", "var narrow = int8(0)", "lo uint16 = 0", "hi int8   = 0"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	markers := report.Markers()
+	if len(markers) != 2 {
+		t.Fatalf("expected two skipped markers, got %+v", markers)
+	}
+	for i, want := range []string{"300 overflows int8 (range -128 to 127)", "variable hi: -129 overflows int8 (range -128 to 127)"} {
+		if markers[i].Reason != internal.SkipConstantOverflow || !strings.HasSuffix(markers[i].Suggestion, want) {
+			t.Errorf("expected a constant-overflow skip ending with %q, got %+v", want, markers[i])
+		}
+	}
+	verifyCompiles(t, dir)
+}
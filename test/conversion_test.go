@@ -0,0 +1,111 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestConversionWrappedPlaceholders(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "time"
+
+func Port() int { return 8080 }
+
+func Port32() int32 { return 8080 }
+
+func Timeout() time.Duration { return 30 * time.Second }
+
+func Seconds() int { return 30 }
+
+func Ratio() float64 { return 0.75 }
+
+func Whole() float64 { return 2 }
+
+func Offset() int { return -5 }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+import "time"
+
+//:Port32
+var port = int32(0)
+
+//:Port
+var widePort = int32(0)
+
+//:Timeout
+var timeout = time.Duration(0)
+
+//:Seconds
+var window = time.Duration(0) * time.Second
+
+//:Ratio
+var ratio = float64(0)
+
+//:Whole
+var whole = float64(0.0)
+
+//:Offset
+var offset = int32(-1)
+
+func main() { println(port, widePort, timeout, window, ratio, whole, offset) }
+`)
+
+	want := []string{
+		"var port = int32(8080)",
+		"var widePort = int32(8080)",
+		"var timeout = time.Duration(30000000000)",
+		"var window = time.Duration(30) * time.Second",
+		"var ratio = float64(0.75)",
+		"var whole = float64(2)",
+		"var offset = int32(-5)",
+	}
+	var first string
+	for run := 1; run <= 2; run++ {
+		var report *internal.SkipReport
+		var err error
+		stderr := captureStderr(t, func() {
+			report, err = internal.RunCodegenWithReport(internal.Config{Dir: dir})
+		})
+		if err != nil {
+			t.Fatalf("run %d: RunCodegen failed: %v", run, err)
+		}
+		if report.Len() != 0 {
+			t.Fatalf("run %d: expected no skipped markers, got:\n%s", run, report.Format(dir))
+		}
+		content := readMain(t, dir)
+		for _, w := range want {
+			if !strings.Contains(content, w) {
+				t.Errorf("run %d: expected %q in:\n%s", run, w, content)
+			}
+		}
+		if run == 1 {
+			first = content
+		} else if content != first {
+			t.Errorf("re-run changed the file:\n%s", content)
+		}
+
+		// Only the mismatching conversions are reported, on every run
+		for _, w := range []string{
+			"main.go:9: Port returns int but its value is converted to int32",
+			"main.go:15: Seconds returns int but its value is converted to time.Duration",
+			"main.go:24: Offset returns int but its value is converted to int32",
+		} {
+			if !strings.Contains(stderr, w) {
+				t.Errorf("run %d: expected warning %q in:\n%s", run, w, stderr)
+			}
+		}
+		if n := strings.Count(stderr, "but its value is converted"); n != 3 {
+			t.Errorf("run %d: expected 3 conversion warnings, got %d:\n%s", run, n, stderr)
+		}
+	}
+	verifyCompiles(t, dir)
+}
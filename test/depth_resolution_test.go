@@ -262,9 +262,6 @@ func TestDepthCalculation(t *testing.T) {
 
 // TestDuplicateAtSameDepthError tests that duplicate functions at the same depth cause an error
 func TestDuplicateAtSameDepthError(t *testing.T) {
-	// This test verifies the error condition - we can't easily test os.Exit(1)
-	// but we can verify the context state before the check
-
 	dir := t.TempDir()
 
 	writeFile(t, dir, "pkg1/helpers.go", `//go:build exclude
@@ -279,21 +276,12 @@ func Duplicate() string { return "from-pkg2" }
 `)
 
 	// This should fail because Duplicate() is defined twice at depth 1
-	// We capture this by checking if the warning/error is produced
-	// In a real scenario, this would call os.Exit(1)
-
-	// For now, we just document the expected behavior
-	t.Log("Expected: ERROR: Duplicate function 'Duplicate' at same depth level 1")
-	t.Log("This test documents expected behavior - actual enforcement is via os.Exit(1)")
-
-	// Verify files exist
-	_, err := os.Stat(filepath.Join(dir, "pkg1", "helpers.go"))
-	if err != nil {
-		t.Fatalf("pkg1/helpers.go should exist: %v", err)
+	err := internal.RunCodegen(dir, false)
+	if err == nil {
+		t.Fatal("expected duplicate functions at the same depth to fail")
 	}
-	_, err = os.Stat(filepath.Join(dir, "pkg2", "helpers.go"))
-	if err != nil {
-		t.Fatalf("pkg2/helpers.go should exist: %v", err)
+	if !strings.Contains(err.Error(), "'Duplicate' is defined 2 times at depth 1") {
+		t.Errorf("unexpected error: %v", err)
 	}
 }
 
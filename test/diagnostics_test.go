@@ -0,0 +1,194 @@
+package test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const diagnosticsMain = `package main
+
+  //:Missing
+var s = ""
+
+func main() {}
+`
+
+// checkSARIFSchema verifies the members SARIF 2.1.0 requires of a log,
+// its runs and their results
+func checkSARIFSchema(t *testing.T, doc map[string]interface{}) {
+	t.Helper()
+	if doc["version"] != "2.1.0" {
+		t.Fatalf("version = %v, want 2.1.0", doc["version"])
+	}
+	runs, ok := doc["runs"].([]interface{})
+	if !ok || len(runs) != 1 {
+		t.Fatalf("expected exactly one run, got %v", doc["runs"])
+	}
+	run := runs[0].(map[string]interface{})
+	driver, ok := run["tool"].(map[string]interface{})["driver"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("run has no tool.driver: %v", run)
+	}
+	if name, _ := driver["name"].(string); name == "" {
+		t.Fatalf("tool.driver.name is required")
+	}
+	rules := map[string]bool{}
+	for _, r := range driver["rules"].([]interface{}) {
+		rule := r.(map[string]interface{})
+		id, _ := rule["id"].(string)
+		if id == "" {
+			t.Fatalf("rule without id: %v", rule)
+		}
+		rules[id] = true
+	}
+	results, ok := run["results"].([]interface{})
+	if !ok {
+		t.Fatalf("run.results must be an array, got %v", run["results"])
+	}
+	for _, r := range results {
+		result := r.(map[string]interface{})
+		if text, _ := result["message"].(map[string]interface{})["text"].(string); text == "" {
+			t.Errorf("result without message.text: %v", result)
+		}
+		switch result["level"] {
+		case "none", "note", "warning", "error":
+		default:
+			t.Errorf("invalid level %v", result["level"])
+		}
+		if !rules[result["ruleId"].(string)] {
+			t.Errorf("ruleId %v is not declared by the driver", result["ruleId"])
+		}
+	}
+}
+
+func TestDiagnosticsSARIFUnresolvedMarker(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "main.go", diagnosticsMain)
+	out := filepath.Join(dir, "out", "goahead.sarif")
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir, Diagnostics: "sarif:" + out}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("diagnostics file not written: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid SARIF JSON: %v", err)
+	}
+	checkSARIFSchema(t, doc)
+
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine   int `json:"startLine"`
+							StartColumn int `json:"startColumn"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("invalid SARIF JSON: %v", err)
+	}
+	results := log.Runs[0].Results
+	if len(results) != 1 {
+		t.Fatalf("expected one result, got %+v", results)
+	}
+	result := results[0]
+	if result.RuleID != string(internal.SkipUnresolved) || result.Level != "warning" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	loc := result.Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "main.go" || loc.Region.StartLine != 3 || loc.Region.StartColumn != 3 {
+		t.Errorf("unexpected location: %+v", loc)
+	}
+}
+
+func TestDiagnosticsStrictReportsErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "main.go", diagnosticsMain)
+	out := filepath.Join(dir, "goahead.sarif")
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir, Strict: true, Diagnostics: "sarif:" + out}); err == nil {
+		t.Fatal("expected strict mode to fail")
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("diagnostics file not written on failure: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid SARIF JSON: %v", err)
+	}
+	checkSARIFSchema(t, doc)
+	text := string(data)
+	if !strings.Contains(text, `"ruleId": "run-failed"`) || strings.Contains(text, `"level": "warning"`) {
+		t.Errorf("expected only error results including run-failed:\n%s", text)
+	}
+}
+
+func TestDiagnosticsCheckstyle(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "main.go", diagnosticsMain)
+	out := filepath.Join(dir, "checkstyle.xml")
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir, Diagnostics: "checkstyle:" + out}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("diagnostics file not written: %v", err)
+	}
+	var report struct {
+		Files []struct {
+			Name   string `xml:"name,attr"`
+			Errors []struct {
+				Line     int    `xml:"line,attr"`
+				Column   int    `xml:"column,attr"`
+				Severity string `xml:"severity,attr"`
+				Source   string `xml:"source,attr"`
+			} `xml:"error"`
+		} `xml:"file"`
+	}
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid checkstyle XML: %v", err)
+	}
+	if len(report.Files) != 1 || report.Files[0].Name != "main.go" || len(report.Files[0].Errors) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	e := report.Files[0].Errors[0]
+	if e.Line != 3 || e.Column != 3 || e.Severity != "warning" || e.Source != "goahead.unresolved" {
+		t.Errorf("unexpected error entry: %+v", e)
+	}
+}
+
+func TestDiagnosticsInvalidSpec(t *testing.T) {
+	for _, spec := range []string{"sarif", "json:out.json", "checkstyle:"} {
+		if err := (internal.Config{Dir: ".", Diagnostics: spec}).Validate(); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
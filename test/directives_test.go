@@ -243,3 +243,139 @@ func main() {}
 		}
 	})
 }
+
+func TestParseDirective(t *testing.T) {
+	tests := []struct {
+		line    string
+		ok      bool
+		want    internal.Directive
+		wantErr string
+	}{
+		{"//go:ahead functions", true, internal.Directive{Name: "functions"}, ""},
+		{"  //go:ahead import b64=encoding/base64", true, internal.Directive{Name: "import", Alias: "b64", Path: "encoding/base64"}, ""},
+		{`//go:ahead import b64 = "encoding/base64"`, true, internal.Directive{Name: "import", Alias: "b64", Path: "encoding/base64"}, ""},
+		{"//go:ahead import uuid=github.com/google/uuid@v1.6.0", true, internal.Directive{Name: "import", Alias: "uuid", Path: "github.com/google/uuid", Version: "v1.6.0"}, ""},
+		{"//go:ahead import uuid=github.com/google/uuid@", true, internal.Directive{}, "expected alias=path or alias=path@version"},
+		{"//go:build exclude", false, internal.Directive{}, ""},
+		{"//go:aheadfunctions", false, internal.Directive{}, ""},
+		{"//go:ahead import encoding/base64", true, internal.Directive{}, "malformed //go:ahead import"},
+		{"//go:ahead import 1x=fmt", true, internal.Directive{}, "malformed //go:ahead import"},
+		{"//go:ahead functions please", true, internal.Directive{}, "takes no arguments"},
+		{"//go:ahead skip", true, internal.Directive{Name: "skip"}, ""},
+		{"//go:ahead skip now", true, internal.Directive{}, "takes no arguments"},
+		{"//go:ahead namespace net", true, internal.Directive{Name: "namespace", Namespace: "net"}, ""},
+		{"//go:ahead namespace", true, internal.Directive{}, "expected an identifier"},
+		{"//go:ahead namespace a-b", true, internal.Directive{}, "expected an identifier"},
+		{"//go:ahead namespace main", true, internal.Directive{}, "expected an identifier"},
+		{"//go:ahead", true, internal.Directive{}, "missing directive name"},
+		{"//go:ahead function", true, internal.Directive{}, `unknown //go:ahead directive "function"; valid directives: functions, import`},
+	}
+	for _, tt := range tests {
+		d, ok, err := internal.ParseDirective(tt.line)
+		if ok != tt.ok {
+			t.Errorf("ParseDirective(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+		}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseDirective(%q) error = %v, want %q", tt.line, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || d != tt.want {
+			t.Errorf("ParseDirective(%q) = %+v, %v; want %+v", tt.line, d, err, tt.want)
+		}
+	}
+}
+
+func directiveProject(helperHeader, main string) map[string]string {
+	return map[string]string{
+		"helpers.go": "//go:build exclude\n" + helperHeader + `
+package main
+
+func Greeting() string { return "hello" }
+`,
+		"main.go": main,
+	}
+}
+
+func TestDirectiveTypo(t *testing.T) {
+	main := `package main
+
+//:Greeting
+var greeting = ""
+
+func main() {}
+`
+	t.Run("Warning", func(t *testing.T) {
+		dir, _ := setupTestDir(t, directiveProject("//go:ahead function\n", main))
+		stderr := captureStderr(t, func() {
+			if _, err := internal.RunCodegenWithReport(internal.Config{Dir: dir}); err != nil {
+				t.Fatalf("RunCodegen failed: %v", err)
+			}
+		})
+		want := `WARNING: helpers.go:2: unknown //go:ahead directive "function"; valid directives: functions, import`
+		if !strings.Contains(stderr, want) {
+			t.Errorf("expected %q in:\n%s", want, stderr)
+		}
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		dir, _ := setupTestDir(t, directiveProject("//go:ahead function\n", main))
+		_, err := runWithReport(t, internal.Config{Dir: dir, StrictDirectives: true})
+		if err == nil || !strings.Contains(err.Error(), `helpers.go:2: unknown //go:ahead directive "function"`) {
+			t.Fatalf("expected an unknown directive error, got %v", err)
+		}
+	})
+}
+
+func TestDirectiveMalformedImport(t *testing.T) {
+	dir, _ := setupTestDir(t, directiveProject("//go:ahead functions\n//go:ahead import encoding/base64\n", `package main
+
+//:Greeting
+var greeting = ""
+
+func main() {}
+`))
+	original := readMain(t, dir)
+
+	_, err := runWithReport(t, internal.Config{Dir: dir})
+	if err == nil || !strings.Contains(err.Error(), `helpers.go:3: malformed //go:ahead import "encoding/base64": expected alias=path`) {
+		t.Fatalf("expected a malformed import error, got %v", err)
+	}
+	if readMain(t, dir) != original {
+		t.Error("no file should be processed when a directive is malformed")
+	}
+}
+
+func TestDirectiveValidMix(t *testing.T) {
+	dir, _ := setupTestDir(t, directiveProject("//go:ahead functions\n//go:ahead import b64=encoding/base64\n", `package main
+
+//:Greeting
+var greeting = ""
+
+//:b64.StdEncoding.EncodeToString:=[]byte("hi")
+var encoded = ""
+
+func main() {}
+`))
+
+	var report *internal.SkipReport
+	stderr := captureStderr(t, func() {
+		var err error
+		report, err = internal.RunCodegenWithReport(internal.Config{Dir: dir, StrictDirectives: true})
+		if err != nil {
+			t.Fatalf("RunCodegen failed: %v", err)
+		}
+	})
+	if strings.Contains(stderr, "WARNING") {
+		t.Errorf("valid directives should not warn:\n%s", stderr)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("unexpected skipped markers: %+v", report.Markers())
+	}
+	content := readMain(t, dir)
+	if !strings.Contains(content, `var greeting = "hello"`) || !strings.Contains(content, `var encoded = "aGk="`) {
+		t.Errorf("markers not replaced:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// helperDocsGolden is the expected `goahead docs` output for the fixture in
+// TestHelperDocsGolden; regenerate it with GOAHEAD_UPDATE_GOLDEN=1
+var helperDocsGolden = filepath.Join("testdata", "helper_docs.golden.md")
+
+func TestHelperDocsGolden(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+//go:ahead import enc=encoding/base64
+
+package main
+
+import "strings"
+
+// Greeting returns a greeting for name.
+//
+// It is used by the banner.
+func Greeting(name string) string { return "Hello, " + name }
+
+// Add sums two integers.
+func Add(a, b int) int { return a + b }
+
+func Join(sep string, parts ...string) string { return strings.Join(parts, sep) }
+
+// Checksum hashes data.
+func Checksum(data []byte, seed uint32) (uint32, error) { return seed, nil }
+
+func unexported() string { return "" }
+`)
+	writeFile(t, dir, "pkg/helpers.go", `//go:build exclude
+//go:ahead functions
+
+package pkg
+
+// Ratio scales value.
+func Ratio(value float64, enabled bool) float64 { return value }
+`)
+	writeFile(t, dir, "pkg/empty.go", `//go:build exclude
+//go:ahead functions
+
+package pkg
+
+func internalOnly() int { return 0 }
+`)
+	writeFile(t, dir, "main.go", "package main\n\nfunc main() {}\n")
+
+	docs, err := internal.GenerateHelperDocs(internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("GenerateHelperDocs failed: %v", err)
+	}
+
+	if os.Getenv("GOAHEAD_UPDATE_GOLDEN") == "1" {
+		if err := os.WriteFile(helperDocsGolden, []byte(docs), 0o644); err != nil {
+			t.Fatalf("write golden: %v", err)
+		}
+	}
+	want, err := os.ReadFile(helperDocsGolden)
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+	if string(want) != docs {
+		t.Errorf("helper docs changed; diff against %s:\n%s", helperDocsGolden, docs)
+	}
+}
@@ -0,0 +1,179 @@
+package test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const dryRunHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Version() string { return "1.0" }
+
+func Double(n int) int { return n * 2 }
+`
+
+const dryRunMain = `package main
+
+import "fmt"
+
+//:inject!:Double
+
+//:Version
+var version = ""
+
+func main() { fmt.Println(version, Double(2)) }
+`
+
+func TestDryRunPrintsDiffsAndWritesNothing(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", dryRunHelpers)
+	writeFile(t, dir, "main.go", dryRunMain)
+	writeFile(t, dir, "sub/plain.go", "package sub\n")
+
+	var diff bytes.Buffer
+	stats, err := internal.RunCodegenWithStats(internal.Config{Dir: dir, DryRun: true, DiffOutput: &diff})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if content := readMain(t, dir); content != dryRunMain {
+		t.Fatalf("expected -dry-run to leave main.go alone:\n%s", content)
+	}
+	if stats.Pending != 1 || stats.Replaced != 1 || stats.Injected != 1 {
+		t.Errorf("expected one pending file with a replacement and an injection, got %+v", stats)
+	}
+
+	// The diff is the one between the sources and a real run
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	want := internal.UnifiedDiff("a/main.go", "b/main.go", dryRunMain, readMain(t, dir))
+	if diff.String() != want {
+		t.Errorf("dry run diff:\n%s\nwant:\n%s", diff.String(), want)
+	}
+	for _, line := range []string{"-var version = \"\"\n", "+var version = \"1.0\"\n", "+func Double(n int) int\t{ return n * 2 }\n"} {
+		if !strings.Contains(want, line) {
+			t.Errorf("expected the diff to hold %q:\n%s", line, want)
+		}
+	}
+
+	// Once the tree is up to date, there is nothing to print
+	diff.Reset()
+	stats, err = internal.RunCodegenWithStats(internal.Config{Dir: dir, DryRun: true, DiffOutput: &diff})
+	if err != nil {
+		t.Fatalf("second dry run failed: %v", err)
+	}
+	if stats.Pending != 0 || diff.Len() != 0 {
+		t.Errorf("expected no pending changes, got %d:\n%s", stats.Pending, diff.String())
+	}
+}
+
+func TestDryRunShowsCreatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", dryRunHelpers)
+	writeFile(t, dir, "main.go", "package main\n\n//:Version\nvar version = \"\"\n\nfunc main() {}\n")
+
+	var diff bytes.Buffer
+	if _, err := internal.RunCodegenWithStats(internal.Config{Dir: dir, DryRun: true, DiffOutput: &diff, ConstSink: "consts_gen.go"}); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if !strings.Contains(diff.String(), "--- /dev/null\n+++ b/consts_gen.go\n@@ -0,0 ") {
+		t.Errorf("expected the -const-sink file as a new file:\n%s", diff.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "consts_gen.go")); err == nil {
+		t.Error("expected -dry-run not to create the -const-sink file")
+	}
+}
+
+func TestDryRunRejectsWritingOptions(t *testing.T) {
+	dir := t.TempDir()
+	for _, cfg := range []internal.Config{
+		{Dir: dir, DryRun: true, Out: t.TempDir()},
+		{Dir: dir, DryRun: true, Annotations: "map.json"},
+		{Dir: dir, DryRun: true, Backup: true},
+	} {
+		if err := internal.RunCodegenWithConfig(cfg); err == nil || !strings.Contains(err.Error(), "-dry-run cannot be combined") {
+			t.Errorf("expected %+v to be rejected, got %v", cfg, err)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm"
+	want := `--- a/f
++++ b/f
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -10,3 +10,4 @@
+ j
+ k
+ l
++m
+\ No newline at end of file
+`
+	if got := internal.UnifiedDiff("a/f", "b/f", old, new); got != want {
+		t.Errorf("UnifiedDiff:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Changes whose context overlaps share a hunk
+	got := internal.UnifiedDiff("a/f", "b/f", old, strings.Replace(strings.Replace(old, "b\n", "", 1), "g\n", "G\n", 1))
+	if !strings.Contains(got, "@@ -1,10 +1,9 @@\n a\n-b\n c\n") || strings.Count(got, "@@ -") != 1 {
+		t.Errorf("expected one hunk:\n%s", got)
+	}
+	if internal.UnifiedDiff("a/f", "b/f", old, old) != "" {
+		t.Error("expected no diff for equal content")
+	}
+	if got := internal.UnifiedDiff("/dev/null", "b/f", "", "x\n"); got != "--- /dev/null\n+++ b/f\n@@ -0,0 +1 @@\n+x\n" {
+		t.Errorf("unexpected diff for a new file:\n%s", got)
+	}
+}
+
+func TestDryRunNamesSourceFiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", dryRunHelpers)
+	writeFile(t, dir, "main.go", "package main\n\n//:Version\nvar version = \"\"\n\n//:Double:two\nvar twice = 0\n\nfunc main() {}\n")
+	writeFile(t, dir, "vendor/modules.txt", "")
+
+	var diff bytes.Buffer
+	var err error
+	stderr := captureStderr(t, func() {
+		_, err = internal.RunCodegenWithStats(internal.Config{Dir: dir, DryRun: true, DiffOutput: &diff, Verbose: true})
+	})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if strings.Contains(stderr, "goahead-dry-run") || !strings.Contains(stderr, filepath.Join(dir, "main.go")) {
+		t.Errorf("expected the progress lines to name the sources:\n%s", stderr)
+	}
+	if !strings.Contains(stderr, "main.go:6") {
+		t.Errorf("expected the skipped marker at main.go:6:\n%s", stderr)
+	}
+	if !strings.HasPrefix(diff.String(), "--- a/main.go\n+++ b/main.go\n") {
+		t.Errorf("expected the diff to name main.go from the module root:\n%s", diff.String())
+	}
+	// Nothing of the module is copied
+	entries, _ := os.ReadDir(tmp)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "goahead-dry-run") {
+			t.Errorf("expected no copy of the module, found %s", e.Name())
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// threeWayDuplicate is three sibling packages at depth 1 that all define
+// Dup, plus a consumer in the first package
+var threeWayDuplicate = func() map[string]string {
+	files := map[string]string{"alpha/main.go": `package alpha
+
+//:Dup
+var value = ""
+`}
+	for _, pkg := range []string{"alpha", "beta", "gamma"} {
+		files[pkg+"/helpers.go"] = `//go:build exclude
+//go:ahead functions
+
+package ` + pkg + `
+
+// Dup returns the name of the ` + pkg + ` package
+func Dup() string { return "` + pkg + `" }
+`
+	}
+	return files
+}()
+
+func TestDuplicatePolicyErrorListsAllDefinitions(t *testing.T) {
+	dir, _ := setupTestDir(t, threeWayDuplicate)
+
+	err := internal.RunCodegenWithConfig(internal.Config{Dir: dir})
+	if err == nil {
+		t.Fatal("expected same-depth duplicates to fail with the default policy")
+	}
+
+	msg := err.Error()
+	for _, want := range []string{
+		"'Dup' is defined 3 times at depth 1",
+		filepath.Join("alpha", "helpers.go") + ": Dup() string // Dup returns the name of the alpha package",
+		filepath.Join("beta", "helpers.go"),
+		filepath.Join("gamma", "helpers.go"),
+		"//go:ahead namespace <name>",
+		"-on-duplicate=first",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error should mention %q, got:\n%s", want, msg)
+		}
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "alpha", "main.go"))
+	if !strings.Contains(string(content), `var value = ""`) {
+		t.Errorf("no file should be processed when loading fails, got:\n%s", content)
+	}
+}
+
+func TestDuplicatePolicyFirstUsesLexicalOrder(t *testing.T) {
+	dir, _ := setupTestDir(t, threeWayDuplicate)
+
+	err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, OnDuplicate: internal.DuplicatePolicyFirst})
+	if err != nil {
+		t.Fatalf("RunCodegen with -on-duplicate=first failed: %v", err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "alpha", "main.go"))
+	if !strings.Contains(string(content), `var value = "alpha"`) {
+		t.Errorf("first definition in lexical order (alpha) should win, got:\n%s", content)
+	}
+	verifyCompiles(t, string(content)+"\nfunc main() {}\n")
+}
+
+func TestDuplicatePolicySkipDropsAllDefinitions(t *testing.T) {
+	dir, _ := setupTestDir(t, threeWayDuplicate)
+
+	err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, OnDuplicate: internal.DuplicatePolicySkip})
+	if err != nil {
+		t.Fatalf("RunCodegen with -on-duplicate=skip failed: %v", err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "alpha", "main.go"))
+	if !strings.Contains(string(content), `var value = ""`) {
+		t.Errorf("skipped duplicates should leave the placeholder untouched, got:\n%s", content)
+	}
+}
+
+func TestDuplicatePolicyRejectsUnknownValue(t *testing.T) {
+	dir, _ := setupTestDir(t, threeWayDuplicate)
+
+	err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, OnDuplicate: "last"})
+	if err == nil || !strings.Contains(err.Error(), "invalid -on-duplicate value") {
+		t.Fatalf("expected invalid policy error, got %v", err)
+	}
+}
+
+func TestNamespaceSettlesDuplicates(t *testing.T) {
+	files := map[string]string{"alpha/main.go": `package alpha
+
+//:Dup
+var plain = ""
+
+//:beta.Dup
+var namespaced = ""
+
+//:beta.Twice:"ab"
+var twice = ""
+`}
+	for pkg, namespace := range map[string]string{"alpha": "", "beta": "//go:ahead namespace beta\n"} {
+		files[pkg+"/helpers.go"] = `//go:build exclude
+//go:ahead functions
+` + namespace + `
+package ` + pkg + `
+
+import "strings"
+
+type label string
+
+const prefix = "` + pkg + `"
+
+func Dup() string { return string(label(prefix)) }
+
+// Twice repeats s after the package name
+func Twice(s string) string { return Dup() + ":" + strings.Repeat(s, 2) }
+`
+	}
+	dir, _ := setupTestDir(t, files)
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("a namespace should settle the duplicates, got: %v", err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "alpha", "main.go"))
+	for _, want := range []string{`var plain = "alpha"`, `var namespaced = "beta"`, `var twice = "beta:abab"`} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected %s, got:\n%s", want, content)
+		}
+	}
+}
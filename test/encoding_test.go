@@ -0,0 +1,92 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const encodingHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Decode(s string) string { return strings.ToUpper(s) }
+
+func Greeting() string { return "hello" }
+`
+
+func encodingProject(main string) map[string]string {
+	return map[string]string{
+		"helpers.go": encodingHelpers,
+		"main.go":    main,
+	}
+}
+
+func TestByteOrderMarkIsKept(t *testing.T) {
+	dir, _ := setupTestDir(t, encodingProject("\ufeffpackage main\n\n//:inject:Decode\ntype Decoder interface {\n\tDecode(s string) string\n}\n\n//:Greeting\nvar greeting = \"\"\n\nfunc main() { println(Decode(\"x\"), greeting) }\n"))
+
+	for _, format := range []bool{false, true} {
+		report, err := runWithReport(t, internal.Config{Dir: dir, Format: format})
+		if err != nil {
+			t.Fatalf("RunCodegen failed: %v", err)
+		}
+		if report.Len() != 0 {
+			t.Fatalf("expected no skipped markers, got:\n%s", report.Format(dir))
+		}
+		content := readMain(t, dir)
+		if !strings.HasPrefix(content, "\ufeffpackage main\n\nimport (\n\t\"strings\"\n)\n") {
+			t.Errorf("format=%v: expected the BOM, then the package clause and the added import:\n%q", format, content)
+		}
+		if strings.Count(content, "\ufeff") != 1 || strings.Count(content, "func Decode(") != 1 {
+			t.Errorf("format=%v: expected one BOM and one injected Decode:\n%s", format, content)
+		}
+		if !strings.Contains(content, `var greeting = "hello"`) {
+			t.Errorf("format=%v: expected the marker to fire:\n%s", format, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestInvalidUTF8InStringLiteralIsPreserved(t *testing.T) {
+	source := "package main\n\n//:Greeting\nvar greeting = \"\"\n\nvar raw = \"\xff\xfe bytes\"\n\nvar r = '\xff'\n\nfunc main() { println(greeting, raw, r) }\n"
+	dir, _ := setupTestDir(t, encodingProject(source))
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("expected no skipped markers, got:\n%s", report.Format(dir))
+	}
+	want := strings.Replace(source, `var greeting = ""`, `var greeting = "hello"`, 1)
+	if got := readMain(t, dir); got != want {
+		t.Errorf("expected only the marker's literal to change:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestInvalidUTF8InCodeSkipsFile(t *testing.T) {
+	source := "package main\n\n// caf\xe9\n//:Greeting\nvar greeting = \"\"\n\nfunc main() { println(greeting) }\n"
+	dir, _ := setupTestDir(t, encodingProject(source))
+	var err error
+	stderr := captureStderr(t, func() {
+		_, err = internal.RunCodegenWithReport(internal.Config{Dir: dir})
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if want := "skipping main.go: invalid UTF-8 at byte offset 20"; !strings.Contains(stderr, want) {
+		t.Errorf("expected %q in:\n%s", want, stderr)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != source {
+		t.Errorf("the file must be left byte-for-byte as it was:\n%q", got)
+	}
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestResultsSurviveHelperOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "fmt"
+
+func Padded() string { return "  padded  " }
+
+func Lines() string { return "first\nsecond\n" }
+
+func Invalid() string { return "\xff\xfe" }
+
+// Noisy prints debug output, the last line without a newline
+func Noisy(n int) int {
+	fmt.Println("debug: computing", n)
+	fmt.Print("\"not the result\"")
+	return n * 2
+}
+
+func Pair() (string, int) {
+	fmt.Println("pair\tdebug")
+	return " a\tb ", 7
+}
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Padded
+var padded = ""
+
+//:Lines
+var lines = ""
+
+//:Invalid
+var invalid = ""
+
+//:Noisy:21
+var noisy = 0
+
+//:Pair -> name, count
+var (
+	name  = ""
+	count = 0
+)
+
+func main() { println(padded, lines, invalid, noisy, name, count) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("expected no skipped markers, got:\n%s", report.Format(dir))
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{
+		`var padded = "  padded  "`,
+		`var lines = "first\nsecond\n"`,
+		`var invalid = "\xff\xfe"`,
+		`var noisy = 42`,
+		`name  = " a\tb "`,
+		`count = 7`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "debug") || strings.Contains(content, "not the result") {
+		t.Errorf("helper output must not reach the source:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+
+	// Evaluated alone, each marker's program behaves the same
+	writeFile(t, dir, "main.go", strings.Replace(content, "var noisy = 42", "var noisy = 0", 1))
+	report, err = runWithReport(t, internal.Config{Dir: dir, Jobs: 2})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 || readMain(t, dir) != content {
+		t.Errorf("expected -jobs to produce the same file (skipped: %d):\n%s", report.Len(), readMain(t, dir))
+	}
+}
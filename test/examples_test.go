@@ -0,0 +1,105 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// examplesDir holds one runnable program per subdirectory. Each is copied
+// into a temp module, generated and run; its stdout must match the
+// output.golden file next to it. Regenerate with GOAHEAD_UPDATE_GOLDEN=1.
+var examplesDir = filepath.Join("..", "examples")
+
+// exampleEpoch pins SOURCE_DATE_EPOCH for helpers that print a timestamp
+const exampleEpoch = "1769104140"
+
+func TestExamples(t *testing.T) {
+	entries, err := os.ReadDir(examplesDir)
+	if err != nil {
+		t.Fatalf("read examples: %v", err)
+	}
+	t.Setenv("SOURCE_DATE_EPOCH", exampleEpoch)
+	t.Setenv("ADMIN_EMAIL", "")
+	_ = os.Unsetenv("ADMIN_EMAIL")
+
+	found := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		found++
+		name := entry.Name()
+		t.Run(name, func(t *testing.T) {
+			runExample(t, filepath.Join(examplesDir, name))
+		})
+	}
+	if found == 0 {
+		t.Fatalf("no examples found in %s", examplesDir)
+	}
+}
+
+func runExample(t *testing.T, src string) {
+	t.Helper()
+	dir := copyExample(t, src)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("expected no skipped markers, got:\n%s", report.Format(dir))
+	}
+
+	bin := filepath.Join(t.TempDir(), "example")
+	build := exec.Command("go", "build", "-o", bin, ".")
+	build.Dir = dir
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	out, err := exec.Command(bin).Output()
+	if err != nil {
+		t.Fatalf("run example: %v", err)
+	}
+
+	golden := filepath.Join(src, "output.golden")
+	if os.Getenv("GOAHEAD_UPDATE_GOLDEN") == "1" {
+		if err := os.WriteFile(golden, out, 0o644); err != nil {
+			t.Fatalf("write golden: %v", err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+	if string(want) != string(out) {
+		t.Errorf("output differs from %s:\n---- want ----\n%s\n---- got ----\n%s", golden, want, out)
+	}
+}
+
+// copyExample copies the Go sources of an example, helper files included,
+// into a fresh module so that generation never touches the checked-in tree
+func copyExample(t *testing.T, src string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module example\ngo 1.22\n")
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		t.Fatalf("read %s: %v", src, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(src, entry.Name()))
+		if err != nil {
+			t.Fatalf("read %s: %v", entry.Name(), err)
+		}
+		writeFile(t, dir, entry.Name(), string(content))
+	}
+	return dir
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestExcludeGlobsAndIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOAHEAD_CACHE", "off")
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", "//go:build exclude\n//go:ahead functions\n\npackage main\n\nfunc Version() string { return \"1.0\" }\n")
+	writeFile(t, dir, internal.IgnoreFileName, "# generated code\nthird_party/\n*.pb.go\n!keep.pb.go\n")
+	source := "package main\n\n//:Version\nvar version = \"\"\n"
+	files := []string{"main.go", "gen/gen.go", "third_party/dep/dep.go", "fixtures/testdata/case.go", "api.pb.go", "keep.pb.go", "fixtures/fixture.go"}
+	for _, name := range files {
+		writeFile(t, dir, name, source)
+	}
+	// An excluded helper file is not loaded either
+	writeFile(t, dir, "gen/helpers.go", "//go:build exclude\n//go:ahead functions\n\npackage main\n\nfunc Version() string { return \"gen\" }\n")
+
+	config := internal.Config{Dir: dir, Exclude: []string{"gen/**", "**/testdata/**"}, LogCategories: "filter"}
+	var err error
+	stderr := captureStderr(t, func() {
+		err = internal.RunCodegenWithConfig(config)
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	for _, name := range files {
+		processed := strings.Contains(readProjectFile(t, dir, name), `var version = "1.0"`)
+		want := name == "main.go" || name == "keep.pb.go" || name == "fixtures/fixture.go"
+		if processed != want {
+			t.Errorf("%s: expected processed=%v:\n%s", name, want, readProjectFile(t, dir, name))
+		}
+	}
+	for _, want := range []string{
+		`Skipping gen/gen.go: excluded by -exclude "gen/**"`,
+		"Skipping third_party/: excluded by .goaheadignore:2 (third_party/)",
+		"Skipping api.pb.go: excluded by .goaheadignore:3 (*.pb.go)",
+		`Skipping fixtures/testdata/case.go: excluded by -exclude "**/testdata/**"`,
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("expected %q in the verbose output:\n%s", want, stderr)
+		}
+	}
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Exclude: []string{"gen/[a"}}); err == nil || !strings.Contains(err.Error(), `invalid -exclude pattern "gen/[a"`) {
+		t.Errorf("expected an invalid glob to fail the run, got %v", err)
+	}
+}
+
+func TestFilterUserFilesHonorsIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, internal.IgnoreFileName, "/gen/\n")
+	chdir(t, dir)
+
+	got := internal.FilterUserFiles([]string{filepath.Join(dir, "main.go"), filepath.Join(dir, "gen", "gen.go"), filepath.Join(dir, "cmd", "gen", "gen.go")})
+	if len(got) != 2 || got[0] != filepath.Join(dir, "main.go") || got[1] != filepath.Join(dir, "cmd", "gen", "gen.go") {
+		t.Errorf("expected gen/gen.go filtered out, got %v", got)
+	}
+}
@@ -0,0 +1,156 @@
+package test
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// fakeRunner answers evaluation programs calling Echo(n) without invoking
+// the go command, so the test exercises only the executor's own state
+type fakeRunner struct {
+	runs atomic.Int32
+}
+
+var echoCallPattern = regexp.MustCompile(`goaheadFirst\(Echo\((\d+)\)\)`)
+
+func (r *fakeRunner) Run(dir string, env []string, args ...string) (string, string, error) {
+	if len(args) > 0 && args[0] == "list" {
+		return "fmt\nstrings\n", "", nil
+	}
+	r.runs.Add(1)
+	program, err := os.ReadFile(args[len(args)-1])
+	if err != nil {
+		return "", "", err
+	}
+	match := echoCallPattern.FindSubmatch(program)
+	if match == nil {
+		return "", "unexpected program", fmt.Errorf("exit status 1")
+	}
+	return evalOutput("echo-" + string(match[1])), "", nil
+}
+
+// setupEchoExecutor prepares an executor over a module with an Echo helper
+// and a pkg subdirectory, evaluating through runner
+func setupEchoExecutor(t *testing.T, runner internal.Runner) (*internal.FunctionExecutor, *internal.ProcessorContext, string) {
+	t.Helper()
+	dir, _ := setupTestDir(t, map[string]string{
+		"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Echo(n int) string { return "" }
+`,
+		"pkg/pkg.go": "package pkg\n",
+	})
+
+	ctx := &internal.ProcessorContext{
+		FunctionsByDir:   make(map[string]map[string]*internal.UserFunction),
+		FunctionsByDepth: make(map[int]map[string]*internal.UserFunction),
+		RootDir:          dir,
+		FileSet:          token.NewFileSet(),
+		TempDir:          t.TempDir(),
+	}
+	fileProcessor := internal.NewFileProcessor(ctx)
+	if _, err := fileProcessor.CollectAllGoFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileProcessor.LoadUserFunctions(); err != nil {
+		t.Fatal(err)
+	}
+
+	executor := internal.NewFunctionExecutorWithRunner(ctx, runner)
+	if err := executor.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	return executor, ctx, dir
+}
+
+func TestExecutorConcurrentExecuteFunction(t *testing.T) {
+	runner := &fakeRunner{}
+	executor, _, dir := setupEchoExecutor(t, runner)
+	// Warm the cache for some markers so goroutines mix hits and misses
+	for n := 0; n < 3; n++ {
+		if _, _, err := executor.ExecuteFunction("Echo", fmt.Sprint(n), dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sourceDirs := []string{dir, filepath.Join(dir, "pkg")}
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			n := i % 10
+			result, fn, err := executor.ExecuteFunction("Echo", fmt.Sprint(n), sourceDirs[i%2])
+			switch {
+			case err != nil:
+				errs <- err
+			case result != fmt.Sprintf(`"echo-%d"`, n) || fn == nil || fn.Name != "Echo":
+				errs <- fmt.Errorf("Echo(%d) = %s", n, result)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// 3 warm-up runs, then one run for each of the 8 uncached
+	// marker/directory pairs: concurrent misses on the same pair share it,
+	// and the 10 calls for the warmed pairs never run
+	if runs := runner.runs.Load(); runs != 3+8 {
+		t.Errorf("unexpected number of evaluation runs: %d", runs)
+	}
+}
+
+// slowRunner is a fakeRunner whose programs take a while, so that calls
+// started together overlap
+type slowRunner struct {
+	fakeRunner
+}
+
+func (r *slowRunner) Run(dir string, env []string, args ...string) (string, string, error) {
+	time.Sleep(300 * time.Millisecond)
+	return r.fakeRunner.Run(dir, env, args...)
+}
+
+func TestExecutorSharesConcurrentBatchCalls(t *testing.T) {
+	runner := &slowRunner{}
+	executor, ctx, dir := setupEchoExecutor(t, runner)
+	ctx.Stats = &internal.RunStats{}
+
+	var wg sync.WaitGroup
+	results := make([]internal.BatchResult, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = executor.ExecuteBatch([]internal.BatchCall{{FuncName: "Echo", ArgsStr: "7"}}, dir)[0]
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range results {
+		if result.Err != nil || result.Result != `"echo-7"` {
+			t.Errorf("call %d: got %+v", i, result)
+		}
+	}
+	if runs := runner.runs.Load(); runs != 1 {
+		t.Errorf("expected the calls to share one evaluation run, got %d", runs)
+	}
+	if shared, hits := ctx.Stats.SharedEvaluations, ctx.Stats.CacheHits; shared+hits != 7 || shared == 0 {
+		t.Errorf("expected 7 calls served by the first one, got %d shared and %d cache hits", shared, hits)
+	}
+}
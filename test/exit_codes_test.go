@@ -0,0 +1,160 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// TestExitCodes runs the goahead binary against a fixture for each class of
+// outcome and checks its exit status
+func TestExitCodes(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files named boom.go and calls to Boom make this build panic, for the
+	// bug report path
+	exe := filepath.Join(t.TempDir(), "goahead.exe")
+	build := exec.Command("go", "build", "-tags", "goahead_panic", "-ldflags", "-X main.panicFile=boom.go -X main.panicCall=Boom", "-o", exe, ".")
+	build.Dir = filepath.Dir(wd)
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build goahead: %v\nOutput: %s", err, output)
+	}
+
+	const helpers = "//go:build exclude\n//go:ahead functions\n\npackage main\n\nfunc Version() string { return \"1.0\" }\n"
+	const unresolved = "package main\n\n//:Missing:\nvar v = \"\"\n\nfunc main() {}\n"
+	tests := []struct {
+		name  string
+		files map[string]string
+		args  []string
+		env   []string
+		want  int
+		// output must appear in the combined output
+		output string
+	}{
+		{
+			name:  "nothing to do",
+			files: map[string]string{"main.go": "package main\n\nfunc main() {}\n"},
+			want:  internal.ExitOK,
+		},
+		{
+			name:  "replacements",
+			files: map[string]string{"helpers.go": helpers, "main.go": "package main\n\n//:Version:\nvar v = \"\"\n\nfunc main() {}\n"},
+			want:  internal.ExitOK,
+		},
+		{
+			name:  "warnings only",
+			files: map[string]string{"helpers.go": helpers, "main.go": unresolved},
+			want:  internal.ExitOK,
+		},
+		{
+			name:  "warnings only with -warnings-exit-code=3",
+			files: map[string]string{"helpers.go": helpers, "main.go": unresolved},
+			args:  []string{"-warnings-exit-code=3"},
+			want:  internal.ExitWarnings,
+		},
+		{
+			name:   "marker errors",
+			files:  map[string]string{"helpers.go": helpers, "main.go": unresolved},
+			args:   []string{"-strict"},
+			want:   internal.ExitMarkerErrors,
+			output: "marker(s) were skipped (strict mode)",
+		},
+		{
+			name:   "missing go toolchain",
+			files:  map[string]string{"helpers.go": helpers, "main.go": "package main\n\n//:Version:\nvar v = \"\"\n\nfunc main() {}\n"},
+			env:    []string{"PATH=" + t.TempDir()},
+			want:   internal.ExitEnvironment,
+			output: "the go toolchain is required",
+		},
+		{
+			name:   "dry run with pending changes",
+			files:  map[string]string{"helpers.go": helpers, "main.go": "package main\n\n//:Version:\nvar v = \"\"\n\nfunc main() {}\n"},
+			args:   []string{"-dry-run"},
+			want:   internal.ExitPendingChanges,
+			output: "+var v = \"1.0\"",
+		},
+		{
+			name:   "invalid flag value",
+			files:  map[string]string{"main.go": "package main\n\nfunc main() {}\n"},
+			args:   []string{"-out-link=junction"},
+			want:   internal.ExitEnvironment,
+			output: "invalid -out-link",
+		},
+		{
+			name:   "internal bug",
+			files:  map[string]string{"helpers.go": helpers, "boom.go": "package main\n\n//:Version:\nvar v = \"\"\n"},
+			want:   internal.ExitInternal,
+			output: "[goahead] BUG: goahead ",
+		},
+		{
+			name:   "internal bug in a -jobs worker",
+			files:  map[string]string{"helpers.go": helpers + "\nfunc Boom() string { return \"x\" }\n", "main.go": "package main\n\n//:Boom:\nvar b = \"\"\n\n//:Version:\nvar v = \"\"\n\nfunc main() {}\n"},
+			args:   []string{"-jobs=2"},
+			want:   internal.ExitInternal,
+			output: "panicked: panicCall reached: Boom",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+			for name, content := range tt.files {
+				writeFile(t, dir, name, content)
+			}
+			cmd := exec.Command(exe, append([]string{"-dir", dir}, tt.args...)...)
+			cmd.Env = append(os.Environ(), tt.env...)
+			output, err := cmd.CombinedOutput()
+			code := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if code != tt.want {
+				t.Errorf("exit code = %d, want %d\nOutput: %s", code, tt.want, output)
+			}
+			if !strings.Contains(string(output), tt.output) {
+				t.Errorf("expected the output to contain %q:\n%s", tt.output, output)
+			}
+			if tt.want == internal.ExitInternal && !strings.Contains(string(output), "main.reportPanic") {
+				t.Errorf("expected the bug report to hold the stack:\n%s", output)
+			}
+		})
+	}
+
+	missing := exec.Command(exe, "-dir", filepath.Join(t.TempDir(), "missing"))
+	if err := missing.Run(); !errors.As(err, new(*exec.ExitError)) || missing.ProcessState.ExitCode() != internal.ExitEnvironment {
+		t.Errorf("expected a missing -dir to exit with %d, got %v", internal.ExitEnvironment, err)
+	}
+}
+
+func TestExitCodeClassifiesRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", "//go:build exclude\n//go:ahead functions\n\npackage main\n\nfunc Fail() string { panic(\"no\") }\n")
+	writeFile(t, dir, "main.go", "package main\n\n//:Fail:\nvar v = \"\"\n\n//:Missing:\nvar w = \"\"\n\nfunc main() {}\n")
+
+	_, err := runWithReport(t, internal.Config{Dir: dir, Strict: true})
+	if !errors.Is(err, internal.ErrUnresolvedMarker) || !errors.Is(err, internal.ErrExecution) {
+		t.Errorf("expected the strict error to wrap ErrUnresolvedMarker and ErrExecution, got %v", err)
+	}
+	if code := internal.ExitCode(err); code != internal.ExitMarkerErrors {
+		t.Errorf("ExitCode = %d, want %d", code, internal.ExitMarkerErrors)
+	}
+
+	err = internal.RunCodegenWithConfig(internal.Config{Dir: dir, OnDuplicate: "merge"})
+	if !errors.Is(err, internal.ErrEnvironment) || internal.ExitCode(err) != internal.ExitEnvironment {
+		t.Errorf("expected an invalid configuration to be an environment error, got %v", err)
+	}
+	if internal.ExitCode(internal.ErrInterrupted) != internal.InterruptExitCode || internal.ExitCode(nil) != internal.ExitOK {
+		t.Error("expected interruptions and successful runs to keep their exit codes")
+	}
+}
@@ -0,0 +1,76 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// constantModule is module myapp with a constant in an internal
+// package and a helper that prefixes environment variable names
+func constantModule(helperHeader, main string) map[string]string {
+	return map[string]string{
+		"go.mod":                    "module myapp\ngo 1.22\n",
+		"internal/config/config.go": "package config\n\nconst EnvPrefix = \"MYAPP_\"\n",
+		"helpers.go": `//go:build exclude
+//go:ahead functions
+` + helperHeader + `
+package main
+
+func Prefixed(prefix, name string) string { return prefix + name }
+`,
+		"main.go": "package main\n\n" + main + "\nfunc main() { println(dbURL) }\n",
+	}
+}
+
+func TestExpressionArgumentModuleConstant(t *testing.T) {
+	tests := []struct {
+		name, header, marker, want string
+	}{
+		{"ImportPath", "", `//:Prefixed:=myapp/internal/config.EnvPrefix:"DATABASE_URL"`, "MYAPP_DATABASE_URL"},
+		{"ImportDirective", "//go:ahead import cfg=myapp/internal/config\n", `//:Prefixed:=cfg.EnvPrefix + "DB_":"URL"`, "MYAPP_DB_URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := setupTestDir(t, constantModule(tt.header, tt.marker+"\nvar dbURL = \"\"\n"))
+
+			report, err := runWithReport(t, internal.Config{Dir: dir})
+			if err != nil {
+				t.Fatalf("RunCodegen failed: %v", err)
+			}
+			if markers := report.Markers(); len(markers) != 0 {
+				t.Fatalf("unexpected skipped markers: %+v", markers)
+			}
+			if content := readMain(t, dir); !strings.Contains(content, `var dbURL = "`+tt.want+`"`) {
+				t.Errorf("constant was not evaluated:\n%s", content)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if strings.HasPrefix(entry.Name(), ".goahead-eval-") {
+					t.Errorf("evaluation directory %s left behind", entry.Name())
+				}
+			}
+			verifyCompiles(t, dir)
+		})
+	}
+}
+
+func TestExpressionArgumentUnknownModulePackage(t *testing.T) {
+	dir, _ := setupTestDir(t, constantModule("", `//:Prefixed:=myapp/config.EnvPrefix:"DATABASE_URL"`+"\nvar dbURL = \"\"\n"))
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	want := "argument 1: package myapp/config not found in module myapp (no Go files in " + filepath.ToSlash(filepath.Join(dir, "config")) + ")"
+	if skip.Reason != internal.SkipExecFailed || skip.Suggestion != want {
+		t.Errorf("unexpected skip: %+v", skip)
+	}
+}
@@ -221,6 +221,119 @@ func main() {}
 		}
 	})
 
+	t.Run("LiteralsOutsideTheValue", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func GetName() string { return "replaced" }
+
+func GetCount() int { return 42 }
+`)
+		writeFile(t, dir, "main.go", `package main
+
+type config struct{ Default string }
+
+var cfg config
+
+var (
+    //:GetName
+    name = "" // trailing comment with 0
+    //:GetName
+    prefixed = cfg.Default + ""
+    //:GetCount
+    count = len(cfg.Default) // falls back to 0
+)
+
+func main() {
+    m := map[string]string{}
+    //:GetName
+    m["key"] = ""
+}
+`)
+		err := internal.RunCodegen(dir, false)
+		if err != nil {
+			t.Fatalf("RunCodegen failed: %v", err)
+		}
+		content := readMain(t, dir)
+		for _, want := range []string{
+			`name = "replaced" // trailing comment with 0`,
+			`prefixed = cfg.Default + "replaced"`,
+			`count = 42 // falls back to 0`,
+			`m["key"] = "replaced"`,
+		} {
+			if !strings.Contains(content, want) {
+				t.Errorf("expected %q\n%s", want, content)
+			}
+		}
+		verifyCompiles(t, dir)
+	})
+
+	t.Run("ValuesOverSeveralLines", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func GetName() string { return "replaced" }
+
+func GetCount() int { return 42 }
+
+func GetNames() []string { return []string{"x", "y"} }
+`)
+		writeFile(t, dir, "main.go", `package main
+
+type config struct {
+	Count int
+	Name  string
+}
+
+//:GetCount
+var cfg = config{
+	Count: 0,
+	Name:  "kept",
+}
+
+//:GetNames
+var names = []string{
+	"a",
+	"b",
+}
+
+//:GetName
+var label = pad(
+	"", 1)
+
+func pad(s string, n int) string { return s }
+
+func main() {
+	//:GetCount
+	count := max(0,
+		1)
+	_ = count
+}
+`)
+		err := internal.RunCodegen(dir, false)
+		if err != nil {
+			t.Fatalf("RunCodegen failed: %v", err)
+		}
+		content := readMain(t, dir)
+		for _, want := range []string{
+			"var cfg = config{\n\tCount: 42,\n\tName:  \"kept\",\n}\n",
+			"var names = []string{\"x\", \"y\"}\n\n//:GetName\n",
+			"var label = pad(\n\t\"replaced\", 1)\n",
+			"count := max(42,\n\t\t1)\n",
+		} {
+			if !strings.Contains(content, want) {
+				t.Errorf("expected %q\n%s", want, content)
+			}
+		}
+		verifyCompiles(t, dir)
+	})
+
 	t.Run("PreserveIndentation", func(t *testing.T) {
 		dir := t.TempDir()
 		writeFile(t, dir, "helpers.go", `//go:build exclude
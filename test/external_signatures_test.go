@@ -0,0 +1,105 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// runExternalMarkers processes main with a placeholder helper file, so that
+// the module has local work and external markers are evaluated
+func runExternalMarkers(t *testing.T, main string) (string, *internal.SkipReport) {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Unused() string { return "" }
+`)
+	writeFile(t, dir, "main.go", main)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	return readMain(t, dir), report
+}
+
+func TestExternalSignatureIntArgument(t *testing.T) {
+	content, report := runExternalMarkers(t, `package main
+
+//:strings.Repeat:ab:3
+var repeated = ""
+
+func main() {}
+`)
+	if report.Len() != 0 {
+		t.Fatalf("unexpected skipped markers: %+v", report.Markers())
+	}
+	if !strings.Contains(content, `var repeated = "ababab"`) {
+		t.Errorf("strings.Repeat not evaluated:\n%s", content)
+	}
+}
+
+func TestExternalSignatureBoolLookingArguments(t *testing.T) {
+	content, report := runExternalMarkers(t, `package main
+
+//:strconv.FormatBool:"true"
+var formatted = ""
+
+//:strings.ToUpper:true
+var upper = ""
+
+func main() {}
+`)
+	if report.Len() != 0 {
+		t.Fatalf("unexpected skipped markers: %+v", report.Markers())
+	}
+	// strconv.FormatBool takes a bool, so the quoted "true" is passed as one
+	if !strings.Contains(content, `var formatted = "true"`) {
+		t.Errorf("strconv.FormatBool not evaluated:\n%s", content)
+	}
+	// strings.ToUpper takes a string, so the bare true is quoted
+	if !strings.Contains(content, `var upper = "TRUE"`) {
+		t.Errorf("bool-looking argument was not passed as a string:\n%s", content)
+	}
+}
+
+func TestExternalSignatureArity(t *testing.T) {
+	_, report := runExternalMarkers(t, `package main
+
+//:strings.Repeat:ab
+var repeated = ""
+
+func main() {}
+`)
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipExecFailed || !strings.Contains(skip.Suggestion, "strings.Repeat expects 2 arguments, got 1") {
+		t.Errorf("unexpected skip: %+v", skip)
+	}
+}
+
+func TestExternalSignatureFallback(t *testing.T) {
+	// fmt.Sprint takes ...any and base64.StdEncoding is a variable; both keep
+	// the untyped argument handling
+	content, report := runExternalMarkers(t, `package main
+
+//:fmt.Sprint:hello:"world"
+var joined = ""
+
+//:base64.StdEncoding.EncodeToString:=[]byte("hi")
+var encoded = ""
+
+func main() {}
+`)
+	if report.Len() != 0 {
+		t.Fatalf("unexpected skipped markers: %+v", report.Markers())
+	}
+	if !strings.Contains(content, `var joined = "helloworld"`) || !strings.Contains(content, `var encoded = "aGk="`) {
+		t.Errorf("fallback formatting changed:\n%s", content)
+	}
+}
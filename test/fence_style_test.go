@@ -0,0 +1,107 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const teamFenceStyle = "begin=// Code generated by goahead (team style). DO NOT EDIT.,end=// goahead: end of generated code,inside=0,after=2"
+
+var fenceProject = map[string]string{
+	"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+const shift = 1
+
+func Decode(s string) string { return rotate(s) }
+
+func rotate(s string) string {
+	out := []byte(s)
+	for i := range out {
+		out[i] -= shift
+	}
+	return string(out)
+}
+`,
+	"main.go": `package main
+
+//:inject:Decode
+type Decoder interface {
+	Decode(s string) string
+}
+
+func main() { println(Decode("ifmmp")) }
+`,
+}
+
+func runFence(t *testing.T, dir, style string) string {
+	t.Helper()
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, FenceStyle: style}); err != nil {
+		t.Fatalf("RunCodegen with fence style %q failed: %v", style, err)
+	}
+	content := readMain(t, dir)
+	if n := strings.Count(content, "DO NOT EDIT."); n != 1 {
+		t.Fatalf("expected one injected block, got %d:\n%s", n, content)
+	}
+	if n := strings.Count(content, "func Decode("); n != 1 {
+		t.Fatalf("expected one Decode, got %d:\n%s", n, content)
+	}
+	return content
+}
+
+func TestFenceStyleMigratesBetweenRuns(t *testing.T) {
+	dir, _ := setupTestDir(t, fenceProject)
+	original := runFence(t, dir, "")
+
+	team := runFence(t, dir, teamFenceStyle)
+	begin := strings.Index(team, "// Code generated by goahead (team style). DO NOT EDIT.")
+	end := strings.Index(team, "// goahead: end of generated code")
+	if begin == -1 || end == -1 || strings.Contains(team, "End of goahead generated code") {
+		t.Fatalf("block should use the new fences only:\n%s", team)
+	}
+	if strings.Contains(team[begin:end], "\n\n") {
+		t.Errorf("expected no blank line inside the block:\n%s", team[begin:end])
+	}
+	if !strings.HasSuffix(team, "// goahead: end of generated code\n\n\n") {
+		t.Errorf("expected two blank lines after the end fence:\n%q", team[end:])
+	}
+	verifyCompiles(t, dir)
+
+	if again := runFence(t, dir, teamFenceStyle); again != team {
+		t.Errorf("re-run with the same style changed the file:\n%s", again)
+	}
+	if back := runFence(t, dir, ""); back != original {
+		t.Errorf("switching back to the default style should restore the original layout:\n---- original ----\n%s\n---- got ----\n%s", original, back)
+	}
+}
+
+func TestParseFenceStyle(t *testing.T) {
+	style, err := internal.ParseFenceStyle("inside=0,after=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := internal.DefaultFenceStyle
+	want.Inside, want.After = 0, 2
+	if style != want {
+		t.Errorf("expected %+v, got %+v", want, style)
+	}
+
+	for spec, msg := range map[string]string{
+		"after=-1":                        "must be 0 or greater",
+		"gap=1":                           "unknown -fence-style key",
+		"inside":                          "expected key=value",
+		"begin=// Generated by goahead":   "DO NOT EDIT",
+		"end=// generated code ends here": "mentioning goahead",
+	} {
+		if _, err := internal.ParseFenceStyle(spec); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%q: expected error containing %q, got %v", spec, msg, err)
+		}
+		if err := (internal.Config{Dir: ".", FenceStyle: spec}).Validate(); err == nil {
+			t.Errorf("%q: Validate should reject the spec", spec)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestConsumerImportWithoutHelperFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "main.go", `//go:ahead import sx=strings
+
+package main
+
+//:sx.ToUpper:"gopher"
+var name = ""
+
+func main() { println(name) }
+`)
+	writeFile(t, dir, "other.go", `package main
+
+//:sx.ToLower:"GOPHER"
+var other = ""
+`)
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if !strings.Contains(readMain(t, dir), `var name = "GOPHER"`) {
+		t.Errorf("expected the file's alias to resolve:\n%s", readMain(t, dir))
+	}
+	// The alias is scoped to the file that declares it
+	skip := singleSkip(t, report)
+	if !strings.HasSuffix(skip.File, "other.go") {
+		t.Errorf("expected other.go to be skipped, got %+v", skip)
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestConsumerImportOverridesHelperImport(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "texta/texta.go", "package texta\n\nfunc Name() string { return \"from a\" }\n")
+	writeFile(t, dir, "textb/textb.go", "package textb\n\nfunc Name() string { return \"from b\" }\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+//go:ahead import txt=testmod/texta
+
+package main
+`)
+	writeFile(t, dir, "main.go", `//go:ahead import txt=testmod/textb
+
+package main
+
+//:txt.Name
+var name = ""
+
+func main() { println(name, other) }
+`)
+	writeFile(t, dir, "other.go", `package main
+
+//:txt.Name
+var other = ""
+`)
+
+	var stderr string
+	var err error
+	stderr = captureStderr(t, func() {
+		err = internal.RunCodegenWithConfig(internal.Config{Dir: dir, LogCategories: "scan"})
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v\n%s", err, stderr)
+	}
+	if !strings.Contains(readMain(t, dir), `var name = "from b"`) {
+		t.Errorf("expected the file-scoped alias to win:\n%s", readMain(t, dir))
+	}
+	if content := readProjectFile(t, dir, "other.go"); !strings.Contains(content, `var other = "from a"`) {
+		t.Errorf("expected other files to keep the helper alias:\n%s", content)
+	}
+	if !strings.Contains(stderr, `main.go:1: import alias "txt" uses testmod/textb instead of testmod/texta from helpers.go:3`) {
+		t.Errorf("expected a scan log line for the override:\n%s", stderr)
+	}
+
+	writeFile(t, dir, "main.go", `//go:ahead import txt=testmod/texta
+//go:ahead import txt=testmod/textb
+
+package main
+
+//:txt.Name
+var name = ""
+`)
+	if _, err := runWithReport(t, internal.Config{Dir: dir}); err == nil || !strings.Contains(err.Error(), `main.go:2: import alias "txt" is already declared as testmod/texta at line 1`) {
+		t.Errorf("expected an error for conflicting file aliases, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestFileJobsMatchSerialRun(t *testing.T) {
+	t.Setenv("GOAHEAD_CACHE", "off")
+	serial, _ := setupTestDir(t, singleProgramModule)
+	serialReport, err := runWithReport(t, internal.Config{Dir: serial, FileJobs: 1})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+
+	parallel, _ := setupTestDir(t, singleProgramModule)
+	var report *internal.SkipReport
+	stderr := captureStderr(t, func() {
+		report, err = internal.RunCodegenWithReport(internal.Config{Dir: parallel, FileJobs: 4, LogCategories: "exec"})
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if !strings.Contains(stderr, "Evaluating 2 file(s), up to 4 at once") {
+		t.Errorf("expected the files evaluated ahead:\n%s", stderr)
+	}
+	for _, file := range []string{"main.go", "a.go", "b.go"} {
+		if got, want := readProjectFile(t, parallel, file), readProjectFile(t, serial, file); got != want {
+			t.Errorf("%s differs from the serial run:\n%s\nwant:\n%s", file, got, want)
+		}
+	}
+	if content := readProjectFile(t, parallel, "main.go"); !strings.Contains(content, `var name = "MAIN"`) {
+		t.Errorf("expected the call shared with b.go to be applied:\n%s", content)
+	}
+
+	// The program of b.go panics ahead and is evaluated again, so its
+	// markers are reported as in the serial run
+	skips, want := report.Markers(), serialReport.Markers()
+	if len(skips) != 2 || len(skips) != len(want) {
+		t.Fatalf("expected the skips of the serial run %+v, got %+v", want, skips)
+	}
+	for i := range skips {
+		if skips[i].Line != want[i].Line || skips[i].Reason != want[i].Reason || skips[i].Suggestion != want[i].Suggestion {
+			t.Errorf("expected the skip of the serial run %+v, got %+v", want[i], skips[i])
+		}
+	}
+
+	if err := (internal.Config{Dir: parallel, FileJobs: -1}).Validate(); err == nil {
+		t.Error("expected a negative -file-jobs to be rejected")
+	}
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+var lockProject = map[string]string{
+	"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Greeting() string { return "hello" }
+`,
+	"main.go": `package main
+
+//:Greeting
+var greeting = ""
+
+func main() {}
+`,
+}
+
+func TestFreshLockSkipsFile(t *testing.T) {
+	dir, _ := setupTestDir(t, lockProject)
+	lockPath := filepath.Join(dir, "main.go"+internal.LockSuffix)
+	writeFile(t, dir, "main.go"+internal.LockSuffix, "4242\n")
+	original := readMain(t, dir)
+
+	stderr := captureStderr(t, func() {
+		if _, err := internal.RunCodegenWithReport(internal.Config{Dir: dir, LockTTL: time.Minute}); err != nil {
+			t.Fatalf("RunCodegen failed: %v", err)
+		}
+	})
+	if !strings.Contains(stderr, "WARNING: skipping main.go: file is locked by main.go.goahead.lock") {
+		t.Errorf("expected a lock warning:\n%s", stderr)
+	}
+	if readMain(t, dir) != original {
+		t.Error("a locked file must not be rewritten")
+	}
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Errorf("another process's lock must be left alone: %v", err)
+	}
+}
+
+func TestStaleLockIsReplaced(t *testing.T) {
+	dir, _ := setupTestDir(t, lockProject)
+	lockPath := filepath.Join(dir, "main.go"+internal.LockSuffix)
+	writeFile(t, dir, "main.go"+internal.LockSuffix, "4242\n")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir, LockTTL: time.Minute}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var greeting = "hello"`) {
+		t.Errorf("file behind a stale lock should be processed:\n%s", content)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("the replaced lock should be released after processing: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".goahead-") {
+			t.Errorf("temporary file %s left behind", entry.Name())
+		}
+	}
+}
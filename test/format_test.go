@@ -0,0 +1,85 @@
+package test
+
+import (
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const misIndented = `package main
+
+import "fmt"
+
+func helper()   {
+fmt.Println(  "layout kept" )
+}
+`
+
+func TestFormatOnlyModifiedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Greeting() string { return "hello" }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+import "fmt"
+
+var (
+  //:Greeting
+  greeting = ""
+  other = 1
+)
+
+func main()   {
+fmt.Println(greeting,   other)
+}
+`)
+	writeFile(t, dir, "untouched.go", misIndented)
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Format: true}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	formatted, err := format.Source([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(formatted) != content {
+		t.Errorf("main.go is not gofmt-clean:\n%s", content)
+	}
+	if want := "\n\tgreeting = \"hello\"\n"; !strings.Contains(content, want) {
+		t.Errorf("expected %q in:\n%s", want, content)
+	}
+	untouched, err := os.ReadFile(filepath.Join(dir, "untouched.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(untouched) != misIndented {
+		t.Errorf("a file without changes must not be reformatted:\n%s", untouched)
+	}
+
+	mainPath := filepath.Join(dir, "main.go")
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(mainPath, past, past); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Format: true}); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	if again := readMain(t, dir); again != content {
+		t.Errorf("second run changed main.go:\n%s", again)
+	}
+	if info, err := os.Stat(mainPath); err != nil || !info.ModTime().Equal(past) {
+		t.Errorf("second run should not rewrite main.go: %v", err)
+	}
+}
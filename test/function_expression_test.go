@@ -0,0 +1,138 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func functionExpressionProject(source string) map[string]string {
+	return map[string]string{
+		"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+type Greeter struct{ Greeting string }
+
+func NewGreeter(greeting string) Greeter { return Greeter{Greeting: greeting} }
+
+func (g Greeter) Greet(name string) string { return g.Greeting + ", " + name }
+`,
+		"main.go": source,
+	}
+}
+
+func TestFunctionExpressionMarkers(t *testing.T) {
+	dir, _ := setupTestDir(t, functionExpressionProject(`package main
+
+//:strings.NewReplacer("a","b").Replace:"banana"
+var replaced = ""
+
+//:strings.NewReplacer("a","o").Replace:"banana"
+var other = ""
+
+//:NewGreeter("hi").Greet:"bob"
+var greeting = ""
+
+func main() { println(replaced, other, greeting) }
+`))
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("expected no skipped markers, got:\n%s", report.Format(dir))
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{
+		`var replaced = "bbnbnb"`,
+		// Same method and argument, different expression: not a cache hit
+		`var other = "bonono"`,
+		`var greeting = "hi, bob"`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestFunctionExpressionUnresolvableIdentifier(t *testing.T) {
+	dir, _ := setupTestDir(t, functionExpressionProject(`package main
+
+//:nosuch.Thing().Do:"x"
+var value = ""
+
+func main() {}
+`))
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if skip.Line != 3 || !strings.Contains(skip.Suggestion, "nosuch is neither a helper nor a known package") {
+		t.Errorf("unexpected skip: %+v", skip)
+	}
+	if !strings.Contains(readMain(t, dir), `var value = ""`) {
+		t.Error("target line should be unchanged")
+	}
+}
+
+func TestFunctionExpressionMustParse(t *testing.T) {
+	dir, _ := setupTestDir(t, functionExpressionProject(`package main
+
+//:NewGreeter("hi".Greet:"bob"
+var value = ""
+
+func main() {}
+`))
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if !strings.Contains(skip.Suggestion, `function expression NewGreeter("hi".Greet`) {
+		t.Errorf("unexpected skip: %+v", skip)
+	}
+}
+
+func TestRawExpressionMarkers(t *testing.T) {
+	dir, _ := setupTestDir(t, functionExpressionProject(`package main
+
+//:=NewGreeter("hi").Greet("bob")
+var greeting = ""
+
+//:=Greeter{Greeting: "hey"}.Greet("a:b")
+var literal = ""
+
+//:=strings.ToUpper(NewGreeter("yo").Greet("x"))
+var upper = ""
+
+//:=NewGreeter("hi").Greet(42)
+var wrong = ""
+
+func main() {}
+`))
+	t.Setenv("GOAHEAD_CACHE", "off")
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{`var greeting = "hi, bob"`, `var literal = "hey, a:b"`, `var upper = "YO, X"`, `var wrong = ""`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	// The expression that does not compile fails alone
+	skip := singleSkip(t, report)
+	if skip.Line != 12 || !strings.Contains(skip.Suggestion, `expression =NewGreeter("hi").Greet(42) does not compile next to the helpers visible from .: cannot use 42`) {
+		t.Errorf("unexpected skip: %+v", skip)
+	}
+}
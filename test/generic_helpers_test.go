@@ -0,0 +1,81 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestGenericHelperInstantiation(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOAHEAD_CACHE", "off")
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "cmp"
+
+func Max[T cmp.Ordered](a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func Last[T any](values ...T) T { return values[len(values)-1] }
+
+func Entry[K comparable, V any](key K, value V) map[K]V { return map[K]V{key: value} }
+
+func Version() string { return "1.0" }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Max[int]:3:7
+var maxInt = 0
+
+//:Max[string]:"apple":"pear"
+var maxString = ""
+
+//:Max:"b":"a"
+var inferred = ""
+
+//:Last[string]:a:b
+var last = ""
+
+//:Entry[string, int]:"a":1
+var entry = map[string]int{}
+
+//:Max[int, string]:1:2
+var tooMany = 0
+
+//:Version[int]
+var version = ""
+
+func main() {}
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{`var maxInt = 7`, `var maxString = "pear"`, `var inferred = "b"`, `var last = "b"`, `var entry = map[string]int{"a": 1}`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+
+	markers := report.Markers()
+	if len(markers) != 2 {
+		t.Fatalf("expected two skipped markers, got %+v", markers)
+	}
+	if !strings.Contains(markers[0].Suggestion, "function Max takes 1 type argument(s) [T], got 2") {
+		t.Errorf("expected the type argument count reported, got %+v", markers[0])
+	}
+	if !strings.Contains(markers[1].Suggestion, "function Version is not generic") {
+		t.Errorf("expected a non-generic helper reported, got %+v", markers[1])
+	}
+}
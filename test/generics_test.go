@@ -0,0 +1,154 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const genericsTypes = `
+type Cache[K comparable, V any] struct {
+	size int
+	m    map[K]V
+}
+
+func NewCache[V any](size int) *Cache[string, V] { return &Cache[string, V]{size: size} }
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type Ring[T any] struct{ n int }
+
+func NewRing[T any](n int) Ring[T] { return Ring[T]{n: n} }
+`
+
+func genericsProject(body string) map[string]string {
+	return map[string]string{
+		"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Size() int { return 64 }
+
+func Label() string { return "hot" }
+
+func Ratio() float64 { return 0.5 }
+`,
+		"main.go": "package main\n" + genericsTypes + body,
+	}
+}
+
+func runGenerics(t *testing.T, dir string) string {
+	t.Helper()
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("expected no skipped markers, got:\n%s", report.Format(dir))
+	}
+	return readMain(t, dir)
+}
+
+func assertGenerics(t *testing.T, content string, want []string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(content, w) {
+			t.Errorf("expected %q in:\n%s", w, content)
+		}
+	}
+}
+
+func TestMarkerInsideInstantiatedConstructor(t *testing.T) {
+	dir, _ := setupTestDir(t, genericsProject(`
+//:Size
+var cache = NewCache[string](0)
+
+//:Size
+var ring = NewRing[[4]int](0)
+
+//:Size
+var typed Ring[[8]byte] = NewRing[[8]byte](0)
+
+var (
+	//:Size
+	grouped Ring[[3]int] = NewRing[[3]int](0)
+)
+
+func main() {
+	//:Size
+	m := NewCache[map[[2]int]string](0)
+	//:Ratio
+	w := Pair[[2]string, float64]{Value: 0}
+	println(cache, ring.n, typed.n, grouped.n, m, w.Value)
+}
+`))
+	content := runGenerics(t, dir)
+	assertGenerics(t, content, []string{
+		"var cache = NewCache[string](64)",
+		"var ring = NewRing[[4]int](64)",
+		"var typed Ring[[8]byte] = NewRing[[8]byte](64)",
+		"grouped Ring[[3]int] = NewRing[[3]int](64)",
+		"m := NewCache[map[[2]int]string](64)",
+		"w := Pair[[2]string, float64]{Value: 0.5}",
+	})
+	verifyCompiles(t, dir)
+
+	if again := runGenerics(t, dir); again != content {
+		t.Errorf("re-run changed the file:\n%s", again)
+	}
+}
+
+func TestMarkerInsideGenericStructLiteral(t *testing.T) {
+	dir, _ := setupTestDir(t, genericsProject(`
+//:Label
+var pair Pair[string, int] = Pair[string, int]{Key: "", Value: 7}
+
+//:Size
+var sized Pair[[2]string, int] = Pair[[2]string, int]{Value: 0}
+
+func Build[T any]() Ring[T] {
+	//:Size
+	r := NewRing[T](0)
+	//:Label
+	p := Pair[string, T]{Key: ""}
+	_ = p
+	return r
+}
+
+func main() {
+	println(pair.Key, sized.Value)
+	_ = Build[int]()
+}
+`))
+	content := runGenerics(t, dir)
+	assertGenerics(t, content, []string{
+		`var pair Pair[string, int] = Pair[string, int]{Key: "hot", Value: 7}`,
+		"var sized Pair[[2]string, int] = Pair[[2]string, int]{Value: 64}",
+		"r := NewRing[T](64)",
+		`p := Pair[string, T]{Key: "hot"}`,
+	})
+	verifyCompiles(t, dir)
+
+	if again := runGenerics(t, dir); again != content {
+		t.Errorf("re-run changed the file:\n%s", again)
+	}
+}
+
+func TestSliceIndexIsStillReplaced(t *testing.T) {
+	dir, _ := setupTestDir(t, genericsProject(`
+var table = []int{1, 2, 3}
+
+func main() {
+	//:Size
+	v := table[0] + 0
+	println(v)
+}
+`))
+	content := runGenerics(t, dir)
+	assertGenerics(t, content, []string{"v := table[64] + 0"})
+}
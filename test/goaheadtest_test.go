@@ -0,0 +1,92 @@
+package test
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/goaheadtest"
+)
+
+// goldenFixtures holds one fixture and golden tree per goaheadtest case;
+// regenerate the golden trees with GOAHEAD_UPDATE_GOLDEN=1
+var goldenFixtures = filepath.Join("testdata", "goaheadtest")
+
+func runGoldenCase(t *testing.T, name string, opts goaheadtest.Options) {
+	t.Helper()
+	goaheadtest.RunGolden(t, filepath.Join(goldenFixtures, name, "fixture"), filepath.Join(goldenFixtures, name, "golden"), opts)
+}
+
+func TestSubdirectoryRunResolvesAncestorHelpers(t *testing.T) {
+	runGoldenCase(t, "ancestor_helpers", goaheadtest.Options{Dir: "cmd/agent", Compile: true})
+}
+
+func TestSliceAndMapReturnsAreInlined(t *testing.T) {
+	runGoldenCase(t, "inlined_returns", goaheadtest.Options{Compile: true})
+}
+
+func TestRunGoldenUpdateRewritesGoldenTree(t *testing.T) {
+	golden := t.TempDir()
+	writeFile(t, golden, "stale.go", "package main\n")
+	fixture := filepath.Join(goldenFixtures, "inlined_returns", "fixture")
+
+	setUpdate(t, "true")
+	goaheadtest.RunGolden(t, fixture, golden, goaheadtest.Options{})
+	if _, err := os.Stat(filepath.Join(golden, "stale.go")); !os.IsNotExist(err) {
+		t.Errorf("update should remove files that are no longer produced: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(golden, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `var keys = []string{"a", "b"}`) {
+		t.Errorf("expected the generated main.go in the golden tree:\n%s", content)
+	}
+
+	// The freshly written tree is what a comparing run expects
+	setUpdate(t, "false")
+	goaheadtest.RunGolden(t, fixture, golden, goaheadtest.Options{})
+}
+
+func TestRunGoldenReportsDifferences(t *testing.T) {
+	if os.Getenv("GOAHEADTEST_MISMATCH") == "1" {
+		golden := t.TempDir()
+		writeFile(t, golden, "helpers.go", "stale\n")
+		writeFile(t, golden, "main.go", "package main\n\nvar keys = nil\n")
+		writeFile(t, golden, "missing.go", "package main\n")
+		setUpdate(t, "false")
+		goaheadtest.RunGolden(t, filepath.Join(goldenFixtures, "inlined_returns", "fixture"), golden, goaheadtest.Options{})
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunGoldenReportsDifferences$")
+	cmd.Env = append(os.Environ(), "GOAHEADTEST_MISMATCH=1", goaheadtest.UpdateEnv+"=")
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected the mismatching golden tree to fail the test:\n%s", out)
+	}
+	for _, want := range []string{
+		"helpers.go differs from",
+		"main.go differs from",
+		">    3 | var keys = nil",
+		">    3 | //:Keys",
+		"missing.go is in the golden tree but was not produced",
+		"go.mod was produced but is not in the golden tree",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+}
+
+func setUpdate(t *testing.T, value string) {
+	t.Helper()
+	previous := flag.Lookup("goahead.update").Value.String()
+	if err := flag.Set("goahead.update", value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = flag.Set("goahead.update", previous) })
+}
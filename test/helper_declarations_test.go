@@ -0,0 +1,73 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestHelperDeclarationsReadFromSyntaxTree(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOAHEAD_CACHE", "off")
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Braces inside literals do not end a declaration
+var replacer = strings.NewReplacer(
+	"{", "(",
+	"}", ")",
+)
+
+const xorKey = 0x42
+
+type Level int
+
+func (l Level) String() string { return "root" }
+
+func Wrap() string {
+	s := "}"
+	return replacer.Replace("{" + s)
+}
+
+func Key() int { return xorKey ^ 1 }
+
+func Name() string { return fmt.Sprint(Level(1)) }
+
+// A main of the helper file would clash with the one of the program
+func main() {}
+`)
+	// Shadowing Level in sub/ drops the root type and its methods there
+	writeFile(t, dir, "sub/helpers.go", `//go:build exclude
+//go:ahead functions
+
+package sub
+
+type Level int
+
+func (l Level) String() string { return "sub" }
+`)
+	writeFile(t, dir, "main.go", "package main\n\n//:Wrap\nvar wrapped = \"\"\n\n//:Key\nvar key = 0\n\n//:Name\nvar name = \"\"\n\nfunc main() {}\n")
+	writeFile(t, dir, "sub/sub.go", "package sub\n\n//:Name\nvar name = \"\"\n")
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{`var wrapped = "()"`, "var key = 67", `var name = "root"`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in main.go:\n%s", want, content)
+		}
+	}
+	if content := readProjectFile(t, dir, "sub/sub.go"); !strings.Contains(content, `var name = "sub"`) {
+		t.Errorf("expected the shadowing Level in sub/:\n%s", content)
+	}
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// TestHelperDirsPowerMarkersAcrossTree checks that unmarked files in a helper
+// directory serve markers at every depth of the module
+func TestHelperDirsPowerMarkersAcrossTree(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, filepath.Join("build", "goahead", "names.go"), `//go:build exclude
+
+package main
+
+func AppName() string { return "helper-dirs" }
+`)
+	// A marked file in the helper directory must not be registered twice
+	writeFile(t, dir, filepath.Join("build", "goahead", "ports.go"), `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Port() int { return 8080 }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:AppName
+var name = ""
+
+func main() { println(name) }
+`)
+	writeFile(t, dir, filepath.Join("internal", "deep", "pkg", "pkg.go"), `package pkg
+
+//:Port
+var Port = 0
+`)
+
+	config := internal.Config{Dir: dir, HelperDirs: []string{filepath.Join("build", "goahead")}}
+	if err := internal.RunCodegenWithConfig(config); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+
+	if main := readMain(t, dir); !strings.Contains(main, `var name = "helper-dirs"`) {
+		t.Errorf("root marker not served by helper dir, got:\n%s", main)
+	}
+	pkg, _ := os.ReadFile(filepath.Join(dir, "internal", "deep", "pkg", "pkg.go"))
+	if !strings.Contains(string(pkg), "var Port = 8080") {
+		t.Errorf("nested marker not served by helper dir, got:\n%s", pkg)
+	}
+	helper, _ := os.ReadFile(filepath.Join(dir, "build", "goahead", "names.go"))
+	if strings.Contains(string(helper), "Code generated") {
+		t.Error("helper directory files must not be processed as targets")
+	}
+}
+
+func TestHelperDirsMissingBuildTag(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, filepath.Join("build", "goahead", "names.go"), `package main
+
+func AppName() string { return "oops" }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:AppName
+var name = ""
+
+func main() { println(name) }
+`)
+
+	err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, HelperDirs: []string{"build/goahead"}})
+	if err == nil {
+		t.Fatal("expected an error for a helper file without //go:build exclude")
+	}
+	if !strings.Contains(err.Error(), "missing the '//go:build exclude' constraint") ||
+		!strings.Contains(err.Error(), "names.go") {
+		t.Errorf("unclear error: %v", err)
+	}
+}
+
+func TestHelperDirsMustExist(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+
+	err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, HelperDirs: []string{"build/goahead"}})
+	if err == nil || !strings.Contains(err.Error(), "helper directory build/goahead not found") {
+		t.Errorf("expected a missing helper directory error, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func limitProject(helpers string) map[string]string {
+	return map[string]string{
+		"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "time"
+
+` + helpers,
+		"main.go": `package main
+
+//:Sleepy
+var value = ""
+
+func main() { println(value) }
+`,
+	}
+}
+
+func TestHelperTimeoutDirectiveFailsFast(t *testing.T) {
+	dir, _ := setupTestDir(t, limitProject(`// Sleepy never finishes in time
+//
+//goahead:timeout 100ms
+func Sleepy() string {
+	time.Sleep(time.Minute)
+	return "late"
+}
+`))
+	start := time.Now()
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("expected the timeout to stop the helper early, took %v", elapsed)
+	}
+	skip := singleSkip(t, report)
+	if !strings.Contains(skip.Suggestion, "helper Sleepy exceeded its //goahead:timeout of 100ms") {
+		t.Errorf("expected the error to name the helper and its limit, got %+v", skip)
+	}
+	if strings.Contains(readMain(t, dir), "late") {
+		t.Errorf("the marker must not be replaced:\n%s", readMain(t, dir))
+	}
+}
+
+func TestGlobalExecTimeoutWithoutDirective(t *testing.T) {
+	dir, _ := setupTestDir(t, limitProject(`func Sleepy() string {
+	time.Sleep(time.Minute)
+	return "late"
+}
+`))
+	report, err := runWithReport(t, internal.Config{Dir: dir, ExecTimeout: 3 * time.Second})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if !strings.Contains(skip.Suggestion, "-exec-timeout 3s") {
+		t.Errorf("expected the -exec-timeout error, got %+v", skip)
+	}
+}
+
+func TestHelperMaxMemDirective(t *testing.T) {
+	dir, _ := setupTestDir(t, limitProject(`var keep [][]byte
+
+// Sleepy holds on to far more than its limit
+//
+//goahead:maxmem 16MiB
+func Sleepy() string {
+	for i := 0; i < 64; i++ {
+		keep = append(keep, make([]byte, 1<<20))
+		time.Sleep(2 * time.Millisecond)
+	}
+	return "big"
+}
+`))
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if !strings.Contains(skip.Suggestion, "helper Sleepy exceeded its //goahead:maxmem of 16777216 bytes") {
+		t.Errorf("expected the error to name the helper and its limit, got %+v", skip)
+	}
+
+	// A helper within its limits is unaffected
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+//goahead:timeout 1m
+//goahead:maxmem 256MiB
+func Sleepy() string { return "fine" }
+`)
+	report, err = runWithReport(t, internal.Config{Dir: dir})
+	if err != nil || report.Len() != 0 {
+		t.Fatalf("expected the marker to fire, got %v:\n%s", err, report.Format(dir))
+	}
+	if !strings.Contains(readMain(t, dir), `var value = "fine"`) {
+		t.Errorf("expected the value to be written:\n%s", readMain(t, dir))
+	}
+
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+//goahead:maxmem lots
+func Sleepy() string { return "fine" }
+`)
+	if _, err := runWithReport(t, internal.Config{Dir: dir}); err == nil || !strings.Contains(err.Error(), `invalid //goahead:maxmem "lots" on Sleepy`) {
+		t.Errorf("expected an error for a malformed directive, got %v", err)
+	}
+}
+
+func TestHelperMaxMemAddressSpaceLimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the address space is only capped on Linux")
+	}
+	// One allocation far past the limit, returned before the heap is sampled
+	dir, _ := setupTestDir(t, limitProject(`var keep []byte
+
+//goahead:maxmem 64MiB
+func Sleepy() string {
+	keep = make([]byte, 1<<30)
+	_ = time.Now()
+	return "big"
+}
+`))
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if !strings.Contains(skip.Suggestion, "helper Sleepy exceeded its //goahead:maxmem of 67108864 bytes (the address space limit was reached)") {
+		t.Errorf("expected the error to name the helper and its limit, got %+v", skip)
+	}
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const skipHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Feature(name string) (string, bool) {
+	if name == "beta" {
+		return "", false
+	}
+	return "on-" + name, true
+}
+
+func Legacy() string { return "\x00goahead:skip" }
+`
+
+func TestHelperDeclinesReplacement(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", skipHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+//:Feature:"alpha"
+var alpha = "default"
+
+//:Feature:"beta"
+var beta = "default"
+
+//:Legacy
+var legacy = "keep"
+
+func main() { println(alpha, beta, legacy) }
+`)
+
+	run := func() (declined, replaced []string) {
+		t.Helper()
+		hooks := &internal.Hooks{MarkerEvaluated: func(e internal.MarkerEvent) {
+			switch {
+			case e.Declined:
+				declined = append(declined, e.Args+e.Helper)
+			case e.Replaced:
+				replaced = append(replaced, e.Args+e.Helper)
+			}
+		}}
+		report, err := runWithReport(t, internal.Config{Dir: dir, TagReplacements: true, Hooks: hooks})
+		if err != nil || report.Len() != 0 {
+			t.Fatalf("RunCodegen failed: %v\n%s", err, report.Format(dir))
+		}
+		return declined, replaced
+	}
+
+	declined, replaced := run()
+	if strings.Join(declined, " ") != `"beta"Feature Legacy` || strings.Join(replaced, " ") != `"alpha"Feature` {
+		t.Errorf("expected beta and Legacy to decline and alpha to apply, got declined %v, replaced %v", declined, replaced)
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{`var alpha = "on-alpha"`, `var beta = "default"` + "\n", `var legacy = "keep"` + "\n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+
+	// A re-run finds nothing to change
+	if _, replaced := run(); len(replaced) != 0 {
+		t.Errorf("expected a stable re-run, replaced %v", replaced)
+	}
+	if again := readMain(t, dir); again != content {
+		t.Errorf("expected the re-run to leave main.go alone:\n%s", again)
+	}
+}
+
+func TestDeclinedMarkerKeepsSinkConstant(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", strings.Replace(skipHelpers, `name == "beta"`, `name == "gamma"`, 1))
+	writeFile(t, dir, "main.go", `package main
+
+//:Feature:"beta"
+var beta = "default"
+
+func main() { println(beta) }
+`)
+	cfg := internal.Config{Dir: dir, ConstSink: "values.go"}
+	if report, err := runWithReport(t, cfg); err != nil || report.Len() != 0 {
+		t.Fatalf("RunCodegen failed: %v\n%s", err, report.Format(dir))
+	}
+	sinkRef := readMain(t, dir)
+	if strings.Contains(sinkRef, `"default"`) {
+		t.Fatalf("expected a sink reference:\n%s", sinkRef)
+	}
+
+	writeFile(t, dir, "helpers.go", skipHelpers)
+	if report, err := runWithReport(t, cfg); err != nil || report.Len() != 0 {
+		t.Fatalf("RunCodegen failed: %v\n%s", err, report.Format(dir))
+	}
+	if got := readMain(t, dir); got != sinkRef {
+		t.Errorf("expected the declined target to keep its reference:\n%s", got)
+	}
+	if values := readProjectFile(t, dir, "values.go"); !strings.Contains(values, `"on-beta"`) {
+		t.Errorf("expected the sink to keep the referenced constant:\n%s", values)
+	}
+	buildModule(t, dir)
+}
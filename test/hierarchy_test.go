@@ -380,12 +380,13 @@ func Duplicate() string { return "second" }
 var d = ""
 `)
 
-	// This should cause the process to exit - we can't easily test os.Exit(1)
-	// but we can verify the behavior doesn't panic
-	// In a real scenario this would exit with error
-
-	// For now, just verify the code doesn't panic during setup
-	// The actual exit happens in processFunctionDeclaration
+	err := internal.RunCodegen(dir, false)
+	if err == nil {
+		t.Fatal("expected duplicate functions in the same directory to fail")
+	}
+	if !strings.Contains(err.Error(), "'Duplicate' is defined 2 times at depth 0") {
+		t.Errorf("unexpected error: %v", err)
+	}
 }
 
 // TestHierarchyMultipleFunctionsPerLevel tests multiple functions at each level
@@ -0,0 +1,183 @@
+package test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AeonDave/goahead/codegen"
+	"github.com/AeonDave/goahead/internal"
+)
+
+// recordHooks returns hooks that append one line per event to events
+func recordHooks(dir string, events *[]string) *internal.Hooks {
+	rel := func(path string) string {
+		if r, err := filepath.Rel(dir, path); err == nil {
+			return filepath.ToSlash(r)
+		}
+		return path
+	}
+	return &internal.Hooks{
+		FileStarted: func(e internal.FileEvent) { *events = append(*events, "start "+rel(e.File)) },
+		MarkerEvaluated: func(e internal.MarkerEvent) {
+			*events = append(*events, fmt.Sprintf("marker %s:%d %s(%s)=%s size=%d replaced=%v", rel(e.File), e.Line, e.Helper, e.Args, e.Result, e.Size, e.Replaced))
+		},
+		MarkerSkipped: func(m internal.SkippedMarker) {
+			*events = append(*events, fmt.Sprintf("skipped %s:%d %s", rel(m.File), m.Line, m.Reason))
+		},
+		Injected:    func(e internal.InjectionEvent) { *events = append(*events, "injected "+rel(e.File)+" "+e.Function) },
+		FileWritten: func(e internal.FileEvent) { *events = append(*events, "written "+rel(e.File)) },
+		Warning:     func(d internal.Diagnostic) { *events = append(*events, "warning "+d.Rule) },
+	}
+}
+
+func TestHooksReceiveEventSequence(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+//go:ahead bogus
+
+package main
+
+func Greeting(name string) string { return "hello " + name }
+
+func Decode(s string) string { return s }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Greeting:"gopher"
+var greeting = ""
+
+//:Missing
+var missing = ""
+
+//:inject!:Decode
+
+func main() { println(greeting, missing, Decode("x")) }
+`)
+
+	var events []string
+	cfg := internal.Config{Dir: dir}
+	cfg.Hooks = recordHooks(dir, &events)
+	if _, err := runWithReport(t, cfg); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	want := []string{
+		"warning unknown-directive",
+		"start main.go",
+		"injected main.go Decode",
+		`marker main.go:4 Greeting("gopher")="hello gopher" size=14 replaced=true`,
+		"skipped main.go:6 unresolved",
+		"written main.go",
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected events:\n%s\nwant:\n%s", strings.Join(events, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Nothing changes on a second run, so no file is written; the injection
+	// is redone and matches the file
+	events = nil
+	if _, err := runWithReport(t, cfg); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	for _, event := range events {
+		if strings.HasPrefix(event, "written") {
+			t.Errorf("unexpected %q on an unchanged run:\n%s", event, strings.Join(events, "\n"))
+		}
+	}
+	if !containsLine(events, `marker main.go:`) || !containsLine(events, "replaced=false") {
+		t.Errorf("expected an unchanged marker event:\n%s", strings.Join(events, "\n"))
+	}
+}
+
+func TestDefaultHooksPrintProgress(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Greeting() string { return "hello" }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Greeting
+var greeting = ""
+
+func main() { println(greeting) }
+`)
+	var events []string
+	var err error
+	stderr := captureStderr(t, func() {
+		_, err = internal.RunCodegenWithReport(internal.Config{Dir: dir, Hooks: recordHooks(dir, &events)})
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	// Registering hooks keeps the CLI's own lines
+	if !strings.Contains(stderr, `[goahead] Replaced in `) || !strings.Contains(stderr, `Greeting() -> "hello"`) {
+		t.Errorf("expected the progress line in:\n%s", stderr)
+	}
+	if !containsLine(events, "written main.go") {
+		t.Errorf("expected a written event:\n%s", strings.Join(events, "\n"))
+	}
+}
+
+func TestPublicHooksReportEachCall(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOAHEAD_CACHE", "off")
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "time"
+
+func Slow() int {
+	time.Sleep(300 * time.Millisecond)
+	return 1
+}
+
+func Fast() int { return 2 }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Slow
+var slow = 0
+
+//:Fast
+var fast = 0
+
+func main() { println(slow, fast) }
+`)
+
+	events := map[string]codegen.MarkerEvent{}
+	_, err := codegen.Run(codegen.Config{Dir: dir, Hooks: &codegen.Hooks{
+		MarkerEvaluated: func(e codegen.MarkerEvent) { events[e.Helper] = e },
+	}})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	slow, fast := events["Slow"], events["Fast"]
+	if slow.Line != 4 || fast.Line != 7 {
+		t.Errorf("expected the target lines 4 and 7, got %d and %d", slow.Line, fast.Line)
+	}
+	// Both calls run in one program; each event has the time of its own call
+	if slow.Duration < 300*time.Millisecond || fast.Duration >= 300*time.Millisecond {
+		t.Errorf("expected per-call durations, got Slow %v and Fast %v", slow.Duration, fast.Duration)
+	}
+}
+
+func containsLine(lines []string, substr string) bool {
+	for _, line := range lines {
+		if strings.Contains(line, substr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const importLocationHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Shout(s string) string { return strings.ToUpper(s) }
+`
+
+func TestImportsInsertedAfterLicenseAndBuildTags(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", importLocationHelpers)
+	writeFile(t, dir, "main.go", `/*
+Copyright 2024 Example Corp.
+Licensed under the MIT license.
+*/
+
+//go:build linux || darwin || windows
+
+/* History: split from the old tool. */ /*
+package tools used to be called helpers
+*/
+
+// Package main is a demo.
+// package foo used to be called bar
+package main
+
+//:inject!:Shout
+
+func main() { println(Shout("x")) }
+`)
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	if !strings.Contains(content, "package tools used to be called helpers\n*/\n") {
+		t.Errorf("expected the comment to be left alone:\n%s", content)
+	}
+	if !strings.Contains(content, "// package foo used to be called bar\npackage main\n\nimport (\n\t\"strings\"\n)\n") {
+		t.Errorf("expected the import right after the package clause:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestImportsNotInsertedIntoStringLiterals(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", importLocationHelpers)
+	writeFile(t, dir, "main.go", "package main\n\nimport \"fmt\"\n\n"+
+		"const template = `package generated\n\nimport (\n\t\"os\"\n)\n`\n\n"+
+		"//:inject!:Shout\n\nfunc main() { fmt.Println(template, Shout(\"x\")) }\n")
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	if !strings.Contains(content, "import (\n\t\"fmt\"\n\t\"strings\"\n)\n") {
+		t.Errorf("expected the single import to become a block:\n%s", content)
+	}
+	if !strings.Contains(content, "import (\n\t\"os\"\n)\n`") {
+		t.Errorf("expected the string literal to be left alone:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+}
@@ -0,0 +1,151 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+	"github.com/AeonDave/goahead/internal/artifact"
+)
+
+const incrementalHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Alpha() string { return "alpha-1" }
+
+func Beta() string { return "beta-1" }
+
+func Gamma() string { return "gamma-1" }
+`
+
+var incrementalProject = func() map[string]string {
+	files := map[string]string{
+		"helpers.go": incrementalHelpers,
+		"main.go":    "package main\n\nfunc main() { println(alpha, beta, gamma) }\n",
+	}
+	for _, name := range []string{"Alpha", "Beta", "Gamma"} {
+		files[strings.ToLower(name)+".go"] = "package main\n\n//:" + name + "\nvar " + strings.ToLower(name) + " = \"\"\n"
+	}
+	return files
+}()
+
+// runIncremental runs with -incremental and returns the files it processed
+func runIncremental(t *testing.T, dir string, incremental bool) []string {
+	t.Helper()
+	var started []string
+	hooks := &internal.Hooks{FileStarted: func(e internal.FileEvent) {
+		started = append(started, filepath.Base(e.File))
+	}}
+	if _, err := runWithReport(t, internal.Config{Dir: dir, Incremental: incremental, Hooks: hooks}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	sort.Strings(started)
+	return started
+}
+
+func readIndex(t *testing.T, dir string) artifact.Index {
+	t.Helper()
+	var index artifact.Index
+	if err := artifact.Read(filepath.Join(dir, internal.IndexFileName), &index); err != nil {
+		t.Fatalf("read index: %v", err)
+	}
+	return index
+}
+
+func TestIncrementalRewritesConsumersOfChangedHelper(t *testing.T) {
+	dir, _ := setupTestDir(t, incrementalProject)
+	if got := runIncremental(t, dir, true); strings.Join(got, " ") != "alpha.go beta.go gamma.go" {
+		t.Fatalf("expected the first run to process every file, got %v", got)
+	}
+	before := readIndex(t, dir)
+	if got := runIncremental(t, dir, true); len(got) != 0 {
+		t.Errorf("expected nothing to be processed without changes, got %v", got)
+	}
+
+	writeFile(t, dir, "helpers.go", strings.Replace(incrementalHelpers, "beta-1", "beta-2", 1))
+	if got := runIncremental(t, dir, true); strings.Join(got, " ") != "beta.go" {
+		t.Errorf("expected only the consumer of Beta to be processed, got %v", got)
+	}
+	if content := readProjectFile(t, dir, "beta.go"); !strings.Contains(content, `var beta = "beta-2"`) {
+		t.Errorf("expected beta.go to be rewritten:\n%s", content)
+	}
+
+	after := readIndex(t, dir)
+	if before.Files["beta.go"].Helpers["Beta"] == after.Files["beta.go"].Helpers["Beta"] {
+		t.Errorf("expected the index to record the new hash of Beta: %+v", after.Files["beta.go"])
+	}
+	if before.Files["beta.go"].Hash == after.Files["beta.go"].Hash {
+		t.Errorf("expected the index to record the new content of beta.go")
+	}
+	if before.Files["alpha.go"].Helpers["Alpha"] != after.Files["alpha.go"].Helpers["Alpha"] {
+		t.Errorf("expected Alpha to keep its hash: %+v -> %+v", before.Files["alpha.go"], after.Files["alpha.go"])
+	}
+
+	// Without -incremental every file is processed
+	if got := runIncremental(t, dir, false); len(got) != 3 {
+		t.Errorf("expected a full run, got %v", got)
+	}
+}
+
+func TestIncrementalReprocessesChangedAndUnresolvedFiles(t *testing.T) {
+	dir, _ := setupTestDir(t, incrementalProject)
+	writeFile(t, dir, "delta.go", "package main\n\n//:Delta\nvar delta = \"\"\n")
+	runIncremental(t, dir, true)
+	if !readIndex(t, dir).Files["delta.go"].Unresolved {
+		t.Fatalf("expected delta.go to be recorded as unresolved")
+	}
+
+	writeFile(t, dir, "alpha.go", "package main\n\n//:Alpha\nvar alpha = \"\"\n\n//:Gamma\nvar other = \"\"\n")
+	if got := runIncremental(t, dir, true); strings.Join(got, " ") != "alpha.go delta.go" {
+		t.Errorf("expected the edited and the unresolved file, got %v", got)
+	}
+	if content := readProjectFile(t, dir, "alpha.go"); !strings.Contains(content, `var other = "gamma-1"`) {
+		t.Errorf("expected alpha.go to be processed:\n%s", content)
+	}
+	if helpers := readIndex(t, dir).Files["alpha.go"].Helpers; len(helpers) != 2 {
+		t.Errorf("expected alpha.go to depend on Alpha and Gamma, got %v", helpers)
+	}
+
+	// A helper defined for the first time resolves the file
+	writeFile(t, dir, "helpers.go", incrementalHelpers+"\nfunc Delta() string { return \"delta-1\" }\n")
+	if got := runIncremental(t, dir, true); strings.Join(got, " ") != "delta.go" {
+		t.Errorf("expected only delta.go, got %v", got)
+	}
+	if readIndex(t, dir).Files["delta.go"].Unresolved {
+		t.Errorf("expected delta.go to be resolved")
+	}
+}
+
+func TestIncrementalIgnoresIndexOfOtherSchema(t *testing.T) {
+	dir, _ := setupTestDir(t, incrementalProject)
+	runIncremental(t, dir, true)
+
+	indexPath := filepath.Join(dir, internal.IndexFileName)
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer := strings.Replace(string(data), `"version": 1`, `"version": 99`, 1)
+	if err := os.WriteFile(indexPath, []byte(newer), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	processed := 0
+	hooks := &internal.Hooks{FileStarted: func(internal.FileEvent) { processed++ }}
+	stderr := captureStderr(t, func() {
+		err = internal.RunCodegenWithConfig(internal.Config{Dir: dir, Incremental: true, Hooks: hooks})
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if processed != 3 || !strings.Contains(stderr, "produced by a newer goahead") || !strings.Contains(stderr, "processing every file") {
+		t.Errorf("expected a full run for a newer index, processed %d:\n%s", processed, stderr)
+	}
+	if index := readIndex(t, dir); index.SchemaVersion != artifact.IndexVersion || len(index.Files) != 3 {
+		t.Errorf("expected the index to be rewritten, got %+v", index)
+	}
+}
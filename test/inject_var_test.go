@@ -0,0 +1,146 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const injectVarHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func DeriveKey(seed string) string { return strings.Repeat(seed, 2) }
+
+func Port() uint16 { return 8080 }
+`
+
+const injectVarMain = `package main
+
+import "fmt"
+
+//:inject-var:buildKey = DeriveKey:"seed"
+//:inject-var:port = Port
+
+func main() { fmt.Println(buildKey, port) }
+`
+
+func TestInjectVarCreatesAndUpdatesVariables(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", injectVarHelpers)
+	writeFile(t, dir, "main.go", injectVarMain)
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	want := internal.DefaultFenceStyle.Begin + "\nvar buildKey = \"seedseed\"\nvar port uint16 = 0x1f90\n" + internal.DefaultFenceStyle.End + "\n"
+	if !strings.HasPrefix(content, injectVarMain) || !strings.Contains(content, want) {
+		t.Fatalf("expected the fenced variables below the untouched code:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+
+	// A second run leaves the file as it is
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("second RunCodegen failed: %v", err)
+	}
+	if again := readMain(t, dir); again != content {
+		t.Errorf("expected a repeat run to be stable:\n%s", again)
+	}
+
+	// A changed helper updates the literal in place
+	writeFile(t, dir, "helpers.go", strings.Replace(injectVarHelpers, "strings.Repeat(seed, 2)", `"v2-" + strings.ToUpper(seed)`, 1))
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen after the helper change failed: %v", err)
+	}
+	updated := readMain(t, dir)
+	if !strings.Contains(updated, `var buildKey = "v2-SEED"`) || strings.Contains(updated, "seedseed") || strings.Count(updated, internal.DefaultFenceStyle.Begin) != 1 {
+		t.Errorf("expected the variable to be updated in the one fenced block:\n%s", updated)
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestInjectVarJoinsInjectedFunctions(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", injectVarHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+import "fmt"
+
+//:inject-var:key = DeriveKey:"ab"
+//:inject!:DeriveKey
+
+func main() { fmt.Println(key, DeriveKey("x")) }
+`)
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	if strings.Count(content, internal.DefaultFenceStyle.Begin) != 1 || !strings.Contains(content, internal.DefaultFenceStyle.Begin+"\nvar key = \"abab\"\n") || !strings.Contains(content, "func DeriveKey(") {
+		t.Fatalf("expected the variable and the function in one block:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestInjectVarNameCollisions(t *testing.T) {
+	tests := map[string]struct {
+		main  string
+		other string
+		want  string
+	}{
+		"declared in the file": {
+			main: "package main\n\n//:inject-var:port = Port\n\nvar port = 1\n\nfunc main() {}\n",
+			want: "collides with port declared at",
+		},
+		"declared in the package": {
+			main:  "package main\n\n//:inject-var:port = Port\n\nfunc main() {}\n",
+			other: "package main\n\nfunc port() {}\n",
+			want:  "other.go:3",
+		},
+		"an import": {
+			main: "package main\n\nimport \"strings\"\n\n//:inject-var:strings = DeriveKey:\"x\"\n\nfunc main() { _ = strings.ToUpper }\n",
+			want: "(import \"strings\")",
+		},
+		"a major-version import": {
+			main: "package main\n\nimport \"example.com/yaml/v2\"\n\n//:inject-var:yaml = DeriveKey:\"x\"\n\nfunc main() { _ = yaml.Marshal }\n",
+			want: "(import \"example.com/yaml/v2\")",
+		},
+		"a gopkg.in import": {
+			main: "package main\n\nimport \"gopkg.in/yaml.v3\"\n\n//:inject-var:yaml = DeriveKey:\"x\"\n\nfunc main() { _ = yaml.Marshal }\n",
+			want: "(import \"gopkg.in/yaml.v3\")",
+		},
+		"injected code": {
+			main: "package main\n\n//:inject-var:DeriveKey = Port\n//:inject!:DeriveKey\n\nfunc main() {}\n",
+			want: "collides with code injected into the same file",
+		},
+		"another marker": {
+			main: "package main\n\n//:inject-var:port = Port\n//:inject-var:port = Port\n\nfunc main() {}\n",
+			want: "already injected by the marker at line 3",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+			writeFile(t, dir, "helpers.go", injectVarHelpers)
+			writeFile(t, dir, "main.go", tt.main)
+			if tt.other != "" {
+				writeFile(t, dir, "other.go", tt.other)
+			}
+			err := internal.RunCodegen(dir, false)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected a collision error mentioning %q, got %v", tt.want, err)
+			}
+			if content := readMain(t, dir); content != tt.main {
+				t.Errorf("expected the file to be left alone:\n%s", content)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestInjectedFunctionsKeepTheirComments(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+// Decode upper-cases s and joins its words with Separator.
+// It never fails.
+//
+//goahead:nocache
+func Decode(s string) string {
+	// Words are trimmed first
+	return strings.Join(strings.Fields(Trim(s)), Separator)
+}
+
+// Trim removes surrounding blanks
+func Trim(s string) string { return strings.TrimSpace(s) }
+
+// Separator joins decoded words
+const Separator = "-"
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:inject:Decode
+type Decoder interface {
+	Decode(s string) string
+}
+
+func main() { println(Decode(" a b ")) }
+`)
+
+	var first string
+	for run := 1; run <= 2; run++ {
+		if err := internal.RunCodegen(dir, false); err != nil {
+			t.Fatalf("run %d: RunCodegen failed: %v", run, err)
+		}
+		content := readMain(t, dir)
+		for _, want := range []string{
+			"// Decode upper-cases s and joins its words with Separator.\n// It never fails.\nfunc Decode(s string) string {\n\t// Words are trimmed first\n",
+			"// Trim removes surrounding blanks\nfunc Trim(",
+			"// Separator joins decoded words\nconst Separator = \"-\"",
+		} {
+			if strings.Count(content, want) != 1 {
+				t.Errorf("run %d: expected %q once in:\n%s", run, want, content)
+			}
+		}
+		if strings.Contains(content, "goahead:nocache") {
+			t.Errorf("run %d: goahead directives must not be injected:\n%s", run, content)
+		}
+		if run == 1 {
+			first = content
+		} else if content != first {
+			t.Errorf("re-run changed the file:\n%s", content)
+		}
+	}
+
+	// Every exported injected declaration is documented, starting with its name
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filepath.Join(dir, "main.go"), nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decl := range file.Decls {
+		var name string
+		var doc *ast.CommentGroup
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name, doc = decl.Name.Name, decl.Doc
+		case *ast.GenDecl:
+			if decl.Tok != token.CONST {
+				continue
+			}
+			name, doc = decl.Specs[0].(*ast.ValueSpec).Names[0].Name, decl.Doc
+		}
+		if !ast.IsExported(name) {
+			continue
+		}
+		if doc == nil || !strings.HasPrefix(doc.Text(), name+" ") {
+			t.Errorf("exported %s has no doc comment starting with its name", name)
+		}
+	}
+	verifyCompiles(t, dir)
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const placementHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Decode(s string) string { return strings.ToUpper(s) }
+`
+
+func placementSource(placement string) string {
+	return `package main
+
+import "strings"
+
+//:inject:Decode` + placement + `
+type Decoder interface {
+	Decode(s string) string
+}
+
+func main() { println(Decode("x"), strings.TrimSpace(" y ")) }
+`
+}
+
+func placementProject(placement string) map[string]string {
+	return map[string]string{
+		"helpers.go": placementHelpers,
+		"main.go":    placementSource(placement),
+	}
+}
+
+// blockFollowsInterface reports whether the injected block comes right
+// after the Decoder interface
+func blockFollowsInterface(content string) bool {
+	return strings.Contains(content, "\tDecode(s string) string\n}\n\n// Code generated by goahead. DO NOT EDIT.")
+}
+
+func TestInjectionPlacements(t *testing.T) {
+	for name, tc := range map[string]struct {
+		placement      string
+		afterInterface bool
+	}{
+		"default":         {placement: "", afterInterface: false},
+		"after-interface": {placement: " @after-interface", afterInterface: true},
+		"end-of-file":     {placement: " @end-of-file", afterInterface: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir, _ := setupTestDir(t, placementProject(tc.placement))
+			if err := internal.RunCodegen(dir, false); err != nil {
+				t.Fatalf("RunCodegen failed: %v", err)
+			}
+			content := readMain(t, dir)
+			if strings.Count(content, "func Decode(") != 1 {
+				t.Fatalf("expected one injected Decode, got:\n%s", content)
+			}
+			if !strings.Contains(content, "//:inject:Decode"+tc.placement+"\ntype Decoder interface") {
+				t.Errorf("marker should stay above the interface, got:\n%s", content)
+			}
+			if got := blockFollowsInterface(content); got != tc.afterInterface {
+				t.Errorf("block after interface = %v, want %v:\n%s", got, tc.afterInterface, content)
+			}
+			if !tc.afterInterface && !strings.HasSuffix(content, "// End of goahead generated code.\n\n") {
+				t.Errorf("block should end the file, got:\n%s", content)
+			}
+			verifyCompiles(t, dir)
+
+			if err := internal.RunCodegen(dir, false); err != nil {
+				t.Fatalf("second run failed: %v", err)
+			}
+			if again := readMain(t, dir); again != content {
+				t.Errorf("second run changed the file:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestInjectionPlacementSwitchMovesBlock(t *testing.T) {
+	dir, _ := setupTestDir(t, placementProject(" @after-interface"))
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if !blockFollowsInterface(readMain(t, dir)) {
+		t.Fatalf("block should follow the interface:\n%s", readMain(t, dir))
+	}
+
+	for _, step := range []struct {
+		from, to       string
+		afterInterface bool
+	}{
+		{from: " @after-interface", to: " @end-of-file", afterInterface: false},
+		{from: " @end-of-file", to: " @after-interface", afterInterface: true},
+		// The default keeps the block wherever the previous run put it
+		{from: " @after-interface", to: "", afterInterface: true},
+	} {
+		content := readMain(t, dir)
+		writeFile(t, dir, "main.go", strings.Replace(content, "//:inject:Decode"+step.from+"\n", "//:inject:Decode"+step.to+"\n", 1))
+		if err := internal.RunCodegen(dir, false); err != nil {
+			t.Fatalf("switch to %q failed: %v", step.to, err)
+		}
+		content = readMain(t, dir)
+		if n := strings.Count(content, "// Code generated by goahead. DO NOT EDIT."); n != 1 {
+			t.Fatalf("switch to %q left %d blocks:\n%s", step.to, n, content)
+		}
+		if got := blockFollowsInterface(content); got != step.afterInterface {
+			t.Errorf("switch to %q: block after interface = %v, want %v:\n%s", step.to, got, step.afterInterface, content)
+		}
+		verifyCompiles(t, dir)
+	}
+}
+
+func TestInjectionPlacementErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		source string
+		want   string
+	}{
+		"unknown": {
+			source: placementSource(" @middle"),
+			want:   "unknown placement @middle",
+		},
+		"free after interface": {
+			source: "package main\n\n//:inject!:Decode @after-interface\n\nfunc main() {}\n",
+			want:   "//:inject!:Decode @after-interface: placement @after-interface needs an interface",
+		},
+		"conflicting": {
+			source: "package main\n\n//:inject!:Decode @end-of-file\n\n//:inject:Decode @after-interface\ntype Decoder interface {\n\tDecode(s string) string\n}\n\nfunc main() {}\n",
+			want:   "conflicting placements",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir, _ := setupTestDir(t, placementProject(""))
+			writeFile(t, dir, "main.go", tc.source)
+			err := internal.RunCodegen(dir, false)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected %q error, got %v", tc.want, err)
+			}
+			if readMain(t, dir) != tc.source {
+				t.Error("file should be unchanged")
+			}
+		})
+	}
+}
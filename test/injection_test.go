@@ -1365,3 +1365,176 @@ go 1.22
 	// Must compile
 	verifyCompiles(t, dir)
 }
+
+// freeInjection is a module whose main.go injects Decode, which depends on
+// a helper constant, with the given marker line
+func freeInjection(markerLine string) map[string]string {
+	return map[string]string{
+		"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+const decodeKey = "k"
+
+func Decode(s string) string { return strings.TrimPrefix(s, decodeKey) }
+`,
+		"main.go": `package main
+
+` + markerLine + `
+
+func main() {
+	println(Decode("kvalue"))
+}
+`,
+	}
+}
+
+// TestInjectionFreeStanding tests //:inject!: markers, which inject a free
+// function without an interface
+func TestInjectionFreeStanding(t *testing.T) {
+	dir, _ := setupTestDir(t, freeInjection("//:inject!:Decode"))
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{"//:inject!:Decode", `"strings"`, `const decodeKey = "k"`, "func Decode(s string) string", "// Code generated by goahead. DO NOT EDIT."} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+// TestInjectionFreeStandingGoesToTheBlock tests that a free function is
+// written to the generated block at the end of the file, not at its marker
+func TestInjectionFreeStandingGoesToTheBlock(t *testing.T) {
+	dir, _ := setupTestDir(t, freeInjection("//:inject!:Decode"))
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	markerAt, mainAt := strings.Index(content, "//:inject!:Decode"), strings.Index(content, "func main()")
+	fenceAt, decodeAt := strings.Index(content, "// Code generated by goahead. DO NOT EDIT."), strings.Index(content, "func Decode(")
+	if markerAt < 0 || !(markerAt < mainAt && mainAt < fenceAt && fenceAt < decodeAt) {
+		t.Errorf("expected the marker, main, then the block holding Decode:\n%s", content)
+	}
+	if !strings.HasSuffix(strings.TrimRight(content, "\n"), "// End of goahead generated code.") {
+		t.Errorf("expected the block at the end of the file:\n%s", content)
+	}
+}
+
+// TestInjectionFreeStandingStable tests that re-running a free-standing
+// injection leaves the file unchanged
+func TestInjectionFreeStandingStable(t *testing.T) {
+	dir, _ := setupTestDir(t, freeInjection("//:inject!:Decode"))
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("First RunCodegen failed: %v", err)
+	}
+	first := readMain(t, dir)
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("Second RunCodegen failed: %v", err)
+	}
+	if second := readMain(t, dir); second != first {
+		t.Errorf("second run changed the file:\nfirst:\n%s\nsecond:\n%s", first, second)
+	}
+	if count := strings.Count(first, "func Decode("); count != 1 {
+		t.Errorf("Expected 1 Decode function, got %d", count)
+	}
+}
+
+// TestInjectionStrictFormRequiresInterface tests that plain //:inject:
+// markers still need an interface and point at the free-standing form
+func TestInjectionStrictFormRequiresInterface(t *testing.T) {
+	dir, _ := setupTestDir(t, freeInjection("//:inject:Decode"))
+
+	err := internal.RunCodegen(dir, false)
+	if err == nil {
+		t.Fatal("Expected error for inject marker without interface")
+	}
+	if !strings.Contains(err.Error(), "must be followed by an interface declaration (use //:inject!:Decode for a free function)") {
+		t.Errorf("Expected interface error, got: %v", err)
+	}
+}
+
+// TestInjectionFreeStandingTopLevel tests that //:inject!: markers inside a
+// function body are rejected
+func TestInjectionFreeStandingTopLevel(t *testing.T) {
+	dir, _ := setupTestDir(t, freeInjection("func init() {\n\t//:inject!:Decode\n}"))
+
+	err := internal.RunCodegen(dir, false)
+	if err == nil || !strings.Contains(err.Error(), "must be at top level") {
+		t.Errorf("Expected top level error, got: %v", err)
+	}
+}
+
+// TestInjectionReusesTargetImportAlias tests that injected code is rewritten
+// to the name under which the target already imports a package, in both
+// directions, instead of importing the package a second time
+func TestInjectionReusesTargetImportAlias(t *testing.T) {
+	tests := []struct {
+		name         string
+		helperImport string
+		helperQual   string
+		targetImport string
+		targetQual   string
+	}{
+		{"TargetAliased", `"encoding/base64"`, "base64", `b64 "encoding/base64"`, "b64"},
+		{"HelperAliased", `b64 "encoding/base64"`, "b64", `"encoding/base64"`, "base64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+			writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import `+tt.helperImport+`
+
+var encoding = `+tt.helperQual+`.StdEncoding
+
+func Decode(s string) string {
+	b, _ := encoding.DecodeString(s)
+	return string(b)
+}
+`)
+			writeFile(t, dir, "main.go", `package main
+
+import `+tt.targetImport+`
+
+//:inject!:Decode
+
+func main() {
+	println(Decode(`+tt.targetQual+`.StdEncoding.EncodeToString([]byte("hi"))))
+}
+`)
+
+			if err := internal.RunCodegen(dir, false); err != nil {
+				t.Fatalf("RunCodegen failed: %v", err)
+			}
+			content := readMain(t, dir)
+			if count := strings.Count(content, `"encoding/base64"`); count != 1 {
+				t.Errorf("expected encoding/base64 to be imported once, got %d:\n%s", count, content)
+			}
+			if want := "var encoding = " + tt.targetQual + ".StdEncoding"; !strings.Contains(content, want) {
+				t.Errorf("expected %q in:\n%s", want, content)
+			}
+			verifyCompiles(t, dir)
+
+			// The rewrite is stable across runs
+			if err := internal.RunCodegen(dir, false); err != nil {
+				t.Fatalf("Second RunCodegen failed: %v", err)
+			}
+			if again := readMain(t, dir); again != content {
+				t.Errorf("second run changed the file:\n%s", again)
+			}
+		})
+	}
+}
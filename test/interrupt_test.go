@@ -0,0 +1,146 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// interruptSelf sends SIGINT to the test process, which the run catches;
+// it may be called from other goroutines
+func interruptSelf(t *testing.T) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(os.Interrupt)
+	}
+	if err != nil {
+		t.Errorf("send SIGINT: %v", err)
+	}
+}
+
+// assertNoTempLeft checks that neither the run's temp dir, the build dir of
+// go run nor evaluation dirs in the project survived
+func assertNoTempLeft(t *testing.T, tmp, dir string) {
+	t.Helper()
+	entries, _ := os.ReadDir(tmp)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "codegen-") || strings.HasPrefix(e.Name(), "go-build") {
+			t.Errorf("temp dir %s was left behind", e.Name())
+		}
+	}
+	entries, _ = os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".goahead-") || strings.HasSuffix(e.Name(), ".goahead.lock") {
+			t.Errorf("%s was left behind in the project", e.Name())
+		}
+	}
+}
+
+// interruptProject is a module with three files whose markers call Value,
+// defined by helper
+func interruptProject(helper string) map[string]string {
+	files := map[string]string{
+		"helpers.go": "//go:build exclude\n//go:ahead functions\n\npackage main\n\n" + helper,
+		"main.go":    "package main\n\nfunc main() { println(a, b, c) }\n",
+	}
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		files[name] = "package main\n\n//:Value\nvar " + strings.TrimSuffix(name, ".go") + " = \"\"\n"
+	}
+	return files
+}
+
+// isolateInterrupt skips the test where the own process cannot be
+// interrupted and returns the temp dir of the run, for assertNoTempLeft
+func isolateInterrupt(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("cannot send SIGINT to the own process on Windows")
+	}
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	t.Cleanup(func() { internal.BeforeFileHook = nil })
+	return tmp
+}
+
+func TestInterruptBetweenFiles(t *testing.T) {
+	tmp := isolateInterrupt(t)
+	dir, _ := setupTestDir(t, interruptProject(`func Value() string { return "set" }`))
+	// Files are processed in sorted order: a.go is written, the run stops
+	// before b.go
+	var started []string
+	internal.BeforeFileHook = func(filePath string) {
+		started = append(started, filepath.Base(filePath))
+		if len(started) == 2 {
+			interruptSelf(t)
+			time.Sleep(200 * time.Millisecond)
+		}
+	}
+
+	var err error
+	stderr := captureStderr(t, func() { err = internal.RunCodegen(dir, false) })
+	if !errors.Is(err, internal.ErrInterrupted) {
+		t.Fatalf("expected ErrInterrupted, got %v", err)
+	}
+	if strings.Join(started, " ") != "a.go b.go" {
+		t.Errorf("expected a.go then b.go started, got %v", started)
+	}
+	if !strings.Contains(stderr, "Interrupted") {
+		t.Errorf("expected an interruption note, got %q", stderr)
+	}
+	for name, want := range map[string]string{"a.go": `var a = "set"`, "b.go": `var b = ""`, "c.go": `var c = ""`} {
+		content, readErr := os.ReadFile(filepath.Join(dir, name))
+		if readErr != nil || !strings.Contains(string(content), want) {
+			t.Errorf("expected %q in %s, got:\n%s", want, name, content)
+		}
+	}
+	assertNoTempLeft(t, tmp, dir)
+}
+
+func TestInterruptStopsRunningEvaluation(t *testing.T) {
+	tmp := isolateInterrupt(t)
+	dir, _ := setupTestDir(t, interruptProject("import \"time\"\n\nfunc Value() string { time.Sleep(time.Minute); return \"set\" }\n"))
+	// Every file blocks in the helper; the first one started is interrupted
+	var firstStarted string
+	internal.BeforeFileHook = func(filePath string) {
+		if firstStarted == "" {
+			firstStarted = filepath.Base(filePath)
+			time.AfterFunc(3*time.Second, func() { interruptSelf(t) })
+		}
+	}
+
+	var err error
+	captureStderr(t, func() {
+		done := make(chan error, 1)
+		go func() { done <- internal.RunCodegen(dir, false) }()
+		select {
+		case err = <-done:
+		case <-time.After(30 * time.Second):
+			t.Fatal("the run was not stopped 30s after starting; the evaluation should have been interrupted")
+		}
+	})
+	if !errors.Is(err, internal.ErrInterrupted) {
+		t.Fatalf("expected ErrInterrupted, got %v", err)
+	}
+	if firstStarted != "a.go" {
+		t.Errorf("expected a.go processed first, got %s", firstStarted)
+	}
+	if content := readFileString(t, filepath.Join(dir, "a.go")); !strings.Contains(content, `var a = ""`) {
+		t.Errorf("interrupted file should be unchanged, got:\n%s", content)
+	}
+	assertNoTempLeft(t, tmp, dir)
+}
+
+func readFileString(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
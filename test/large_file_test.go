@@ -0,0 +1,82 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// writeLargeFixture writes a Go file of about size bytes to path as it goes:
+// head, a generated table and tail
+func writeLargeFixture(tb testing.TB, path string, size int, head, tail string) {
+	tb.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	w := bufio.NewWriter(file)
+	_, _ = w.WriteString(head + "var table = []string{\n")
+	for n, written := 0, 0; written < size; n++ {
+		k, _ := fmt.Fprintf(w, "\t\"%064x\",\n", n)
+		written += k
+	}
+	_, _ = w.WriteString("}\n\n" + tail)
+	if err := w.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+const largeFileHead = "package main\n\n//:Missing:1\nvar missing = 0\n\n"
+
+func TestLargeFileStreamed(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", skipPolicyHelpers)
+	path := filepath.Join(dir, "main.go")
+	writeLargeFixture(t, path, 20<<20, largeFileHead, "//:Shout:\"big\"\nvar name = \"\"\n")
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if skipped := singleSkip(t, report); skipped.Line != 3 {
+		t.Errorf("expected the skipped marker at its line of the file, got %+v", skipped)
+	}
+	want := filepath.Join(t.TempDir(), "want.go")
+	writeLargeFixture(t, want, 20<<20, largeFileHead, "//:Shout:\"big\"\nvar name = \"BIG\"\n")
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, err := os.ReadFile(want); err != nil || !bytes.Equal(got, expected) {
+		t.Errorf("expected only the last line to change (%v), file ends with:\n%s", err, got[len(got)-200:])
+	}
+}
+
+func TestLargeFileWithInjectionsReadWhole(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", skipPolicyHelpers)
+	path := filepath.Join(dir, "main.go")
+	writeLargeFixture(t, path, 5<<20, "package main\n\n", "//:Shout:\"big\"\nvar name = \"\"\n\n//:inject!:Shout\n")
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tail := got[len(got)-1000:]
+	if !bytes.Contains(tail, []byte(`var name = "BIG"`)) || !bytes.Contains(tail, []byte("func Shout(")) {
+		t.Errorf("expected the value and the injected helper, file ends with:\n%s", tail)
+	}
+}
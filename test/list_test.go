@@ -0,0 +1,134 @@
+package test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestListHelpersAndMarkers(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Version() string { return "1.0" }
+
+func Decode(s string) string { return s }
+`)
+	writeFile(t, dir, "cmd/helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Version() string { return "cmd" }
+`)
+	mainSource := `package main
+
+//:Version | strings.ToUpper
+var version = ""
+
+//:Missing:1
+var missing = 0
+
+//:inject!:Decode
+
+func main() { println(version, missing) }
+`
+	writeFile(t, dir, "main.go", mainSource)
+	writeFile(t, dir, "cmd/main.go", "package main\n\n//:Version\nvar version = \"\"\n\nfunc main() { println(version) }\n")
+
+	listing, err := internal.ListProject(internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("ListProject failed: %v", err)
+	}
+	wantHelpers := []internal.ListedHelper{
+		{Name: "Version", Signature: "Version() string", File: "cmd/helpers.go", Line: 6, Depth: 1},
+		{Name: "Version", Signature: "Version() string", File: "helpers.go", Line: 6, Depth: 0},
+		{Name: "Decode", Signature: "Decode(string) string", File: "helpers.go", Line: 8, Depth: 0},
+	}
+	if !reflect.DeepEqual(listing.Helpers, wantHelpers) {
+		t.Errorf("unexpected helpers:\n%+v", listing.Helpers)
+	}
+	wantMarkers := []internal.ListedMarker{
+		{File: "cmd/main.go", Line: 3, Kind: "placeholder", Marker: "//:Version", Calls: []internal.ListedCall{{Func: "Version", Helper: "cmd/helpers.go:6"}}},
+		{File: "main.go", Line: 3, Kind: "placeholder", Marker: "//:Version | strings.ToUpper", Calls: []internal.ListedCall{
+			{Func: "Version", Helper: "helpers.go:6"}, {Func: "strings.ToUpper", Helper: "package strings"},
+		}},
+		{File: "main.go", Line: 6, Kind: "placeholder", Marker: "//:Missing:1", Calls: []internal.ListedCall{{Func: "Missing", Helper: internal.Unresolved}}},
+		{File: "main.go", Line: 9, Kind: "inject", Marker: "//:inject!:Decode", Calls: []internal.ListedCall{{Func: "Decode", Helper: "helpers.go:8"}}},
+	}
+	if !reflect.DeepEqual(listing.Markers, wantMarkers) {
+		t.Errorf("unexpected markers:\n%+v", listing.Markers)
+	}
+
+	// Listing evaluates and writes nothing
+	if content := readMain(t, dir); content != mainSource {
+		t.Errorf("expected main.go unchanged:\n%s", content)
+	}
+
+	table := listing.Format()
+	for _, want := range []string{"[goahead] 3 helper(s):", "[goahead] 4 marker(s):", "helpers.go:6 | package strings", "UNRESOLVED\n"} {
+		if !strings.Contains(table, want) {
+			t.Errorf("expected %q in the table:\n%s", want, table)
+		}
+	}
+
+	data, err := json.Marshal(listing)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded struct {
+		Helpers []map[string]any `json:"helpers"`
+		Markers []map[string]any `json:"markers"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded.Helpers) != 3 || len(decoded.Markers) != 4 {
+		t.Fatalf("unexpected JSON %s: %v", data, err)
+	}
+	if decoded.Markers[2]["file"] != "main.go" || decoded.Markers[2]["line"] != float64(6) {
+		t.Errorf("unexpected JSON marker: %v", decoded.Markers[2])
+	}
+}
+
+func TestListSignaturesWithSeveralResults(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Lookup(key string) (string, error) { return key, nil }
+
+func Bounds() (lo, hi int) { return 1, 2 }
+
+func Pair[K comparable, V any](k K, v V) (K, V) { return k, v }
+`)
+	writeFile(t, dir, "main.go", "package main\n\nfunc main() {}\n")
+
+	listing, err := internal.ListProject(internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("ListProject failed: %v", err)
+	}
+	var signatures []string
+	for _, helper := range listing.Helpers {
+		signatures = append(signatures, helper.Signature)
+	}
+	want := []string{"Lookup(string) (string, error)", "Bounds() (int, int)", "Pair[K, V](K, V) (K, V)"}
+	if !reflect.DeepEqual(signatures, want) {
+		t.Errorf("expected signatures %q, got %q", want, signatures)
+	}
+
+	data, err := json.Marshal(listing)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"signature":"Lookup(string) (string, error)"`) {
+		t.Errorf("expected the full result list in the JSON listing: %s", data)
+	}
+}
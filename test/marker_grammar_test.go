@@ -0,0 +1,275 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/marker"
+)
+
+// markerGrammarGolden is the published grammar reference; regenerate it with
+// GOAHEAD_UPDATE_GOLDEN=1 only for intentional grammar changes
+var markerGrammarGolden = filepath.Join("testdata", "marker_grammar.golden.json")
+
+var markerGrammarCases = []string{
+	`//:Version`,
+	`//:Version:`,
+	`//:Greeting:"gopher"`,
+	`//   :SpaceTest`,
+	`// :Add:1:2`,
+	`//:Scale:1.5:true`,
+	`//:Hex:0x1F`,
+	`//:Rune:'a'`,
+	`//:Name:gopher`,
+	`//:Empty::x`,
+	`//:URL:"http://localhost:8080"`,
+	`//:Sum:=[]int{1, 2}:=map[string]int{"a": 1}`,
+	`//:Join:fmt.Sprint("a:b"):x`,
+	`//:strings.ToUpper:hello`,
+	`//:base64.StdEncoding.EncodeToString:=[]byte("hi")`,
+	`//:Max[int]:3:7`,
+	`//:Pick[time.Duration, map[string]int]:1`,
+	`//:slices.Max[[]int]:=[]int{1, 2}`,
+	`//:=NewSchedule("abc").Derive(16)`,
+	`//:=KeySchedule{Seed: "a:b"}.Derive(16) -> key`,
+	`//:Decode:"key":=[]byte{0x89, 0x50`,
+	`//:Calc:=(1 + 2`,
+	`	//:Indented:"tab"`,
+	`//:Bad:"abc\`,
+	`//:GetDBConfig -> dbHost, dbPort, dbTLS`,
+	`//:Config:"prod" -> host=Host, port=Port`,
+	`//:Arrow:"a->b" -> out`,
+	`//:Bad -> 1x`,
+	`//:Read:"cfg" | strings.TrimSpace | Wrap:"[":"]"`,
+	`//:Split:"a|b":"|" | Count`,
+	`//:Flags:=(1|4) | Describe -> text, code`,
+	`//:Any:=a || b`,
+	`//:Read:"cfg" | `,
+	`//:inject:Decode`,
+	`// :inject:Transform`,
+	`//:inject:Decode extra`,
+	`//:inject!:Decode`,
+	`	// :inject!:Decode`,
+	`//:inject:Decode @after-interface`,
+	`//:inject!:Decode @end-of-file`,
+	`//:inject:Decode @middle`,
+	`//:inject!:Decode @after-interface`,
+	`//:inject-var:buildKey = DeriveKey:"seed"`,
+	`//:inject-var:banner=strings.ToUpper:hi | Wrap:"[":"]"`,
+	`//:inject-var:empty =`,
+	`//:inject-var:pair = Split:"a,b" -> x, y`,
+	`// plain comment`,
+	`var x = 1`,
+}
+
+type goldenArgument struct {
+	Raw             string `json:"raw"`
+	Kind            string `json:"kind"`
+	AutoQuote       bool   `json:"auto_quote,omitempty"`
+	ForceExpression bool   `json:"force_expression,omitempty"`
+}
+
+type goldenMarker struct {
+	Line      string           `json:"line"`
+	IsMarker  bool             `json:"is_marker"`
+	Kind      string           `json:"kind,omitempty"`
+	Func      string           `json:"func,omitempty"`
+	Selector  string           `json:"selector,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	TypeArgs  string           `json:"type_args,omitempty"`
+	RawArgs   string           `json:"raw_args,omitempty"`
+	Args      []goldenArgument `json:"args,omitempty"`
+	Outputs   []string         `json:"outputs,omitempty"`
+	Pipeline  []string         `json:"pipeline,omitempty"`
+	Placement string           `json:"placement,omitempty"`
+	Var       string           `json:"var,omitempty"`
+	Canonical string           `json:"canonical,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+func describeMarker(line string) goldenMarker {
+	g := goldenMarker{Line: line}
+	m, err := marker.Parse(line)
+	if errors.Is(err, marker.ErrNotMarker) {
+		return g
+	}
+	g.IsMarker = true
+	g.Kind = m.Kind.String()
+	g.Func, g.Selector, g.Name, g.TypeArgs, g.RawArgs = m.Func, m.Selector, m.Name, m.TypeArgs, m.RawArgs
+	g.Placement, g.Var = m.Placement, m.Var
+	for _, out := range m.Outputs {
+		g.Outputs = append(g.Outputs, out.String())
+	}
+	for _, stage := range m.Pipeline {
+		g.Pipeline = append(g.Pipeline, stage.Func+":"+stage.RawArgs)
+	}
+	if err != nil {
+		g.Error = err.Error()
+		return g
+	}
+	for _, arg := range m.Args {
+		g.Args = append(g.Args, goldenArgument{
+			Raw: arg.Raw, Kind: arg.Kind.String(), AutoQuote: arg.AutoQuote, ForceExpression: arg.ForceExpression,
+		})
+	}
+	g.Canonical = m.String()
+	return g
+}
+
+func TestMarkerGrammarGolden(t *testing.T) {
+	var got []goldenMarker
+	for _, line := range markerGrammarCases {
+		got = append(got, describeMarker(line))
+	}
+	data, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	data = append(data, '\n')
+
+	if os.Getenv("GOAHEAD_UPDATE_GOLDEN") == "1" {
+		if err := os.WriteFile(markerGrammarGolden, data, 0o644); err != nil {
+			t.Fatalf("write golden: %v", err)
+		}
+	}
+	want, err := os.ReadFile(markerGrammarGolden)
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+	if string(want) != string(data) {
+		t.Errorf("marker grammar changed; diff against %s:\n%s", markerGrammarGolden, data)
+	}
+}
+
+// TestMarkerCanonicalRoundTrip checks that canonical output parses back to
+// the same function and arguments
+func TestMarkerCanonicalRoundTrip(t *testing.T) {
+	for _, line := range markerGrammarCases {
+		m, err := marker.Parse(line)
+		if err != nil {
+			continue
+		}
+		again, err := marker.Parse(m.String())
+		if err != nil {
+			t.Errorf("canonical form %q of %q does not parse: %v", m.String(), line, err)
+			continue
+		}
+		if again.String() != m.String() || again.Func != m.Func || again.Var != m.Var || len(again.Args) != len(m.Args) || len(again.Outputs) != len(m.Outputs) || len(again.Pipeline) != len(m.Pipeline) {
+			t.Errorf("round trip of %q changed it: %q -> %q", line, m.String(), again.String())
+			continue
+		}
+		for i := range m.Args {
+			if again.Args[i] != m.Args[i] {
+				t.Errorf("argument %d of %q changed: %+v -> %+v", i, line, m.Args[i], again.Args[i])
+			}
+		}
+	}
+}
+
+func TestMarkerSyntaxLevels(t *testing.T) {
+	v1, err := marker.Default.WithLevel(marker.Level1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := `//:Flags:=1|4:"a|b"`
+	m, err := v1.Parse(line)
+	if err != nil {
+		t.Fatalf("level 1 rejected %q: %v", line, err)
+	}
+	if m.RawArgs != `=1|4:"a|b"` || len(m.Pipeline) != 0 || m.NewerLevel != marker.Level2 {
+		t.Errorf("expected level 1 to keep the | in the arguments and report level 2, got %+v", m)
+	}
+	if m, _ := v1.Parse(`//:Any:=a || b`); m.NewerLevel != 0 {
+		t.Errorf("expected || not to need level 2, got %+v", m)
+	}
+
+	m, err = marker.Parse(line)
+	if err != nil {
+		t.Fatalf("level 2 rejected %q: %v", line, err)
+	}
+	if m.RawArgs != "=1" || len(m.Pipeline) != 1 || m.Pipeline[0].Func != "4" || m.NewerLevel != 0 {
+		t.Errorf("expected level 2 to split the pipeline, got %+v", m)
+	}
+
+	if _, err := marker.Default.WithLevel(marker.LatestLevel + 1); err == nil {
+		t.Error("expected an unknown level to be rejected")
+	}
+}
+
+func TestMarkerNamedTargets(t *testing.T) {
+	tests := []struct {
+		line, target, args string
+	}{
+		{`//:Port > port`, "port", ""},
+		{`//:Read:"app" | strings.TrimSpace > name`, "name", `"app"`},
+		{`//:Max:=(a > b)`, "", "=(a > b)"},
+		{`//:Label:"a > b"`, "", `"a > b"`},
+		{`//:Shift:=a>>b`, "", "=a>>b"},
+		{`//:Cmp:=a>=b`, "", "=a>=b"},
+	}
+	for _, tt := range tests {
+		m, err := marker.Parse(tt.line)
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if m.Target != tt.target || m.RawArgs != tt.args {
+			t.Errorf("%q: expected target %q and arguments %q, got %q and %q", tt.line, tt.target, tt.args, m.Target, m.RawArgs)
+		}
+		if m.String() != tt.line {
+			t.Errorf("%q: rendered as %q", tt.line, m.String())
+		}
+	}
+
+	if _, err := marker.Parse(`//:Config > host -> a, b`); err == nil || !strings.Contains(err.Error(), "both a > host target and -> outputs") {
+		t.Errorf("expected a target and outputs to be rejected, got %v", err)
+	}
+
+	v2, err := marker.Default.WithLevel(marker.Level2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := v2.Parse(`//:Max:=a > b`)
+	if m.RawArgs != "=a > b" || m.Target != "" || m.NewerLevel != marker.Level3 {
+		t.Errorf("expected level 2 to keep the > in the arguments and report level 3, got %+v", m)
+	}
+}
+
+func TestParseArgumentsValidatesExpressions(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		index   int
+		wantErr string
+	}{
+		{"MalformedSliceLiteral", `"key":=[]byte{0x89, 0x50`, 2, "argument 2 (=[]byte{0x89, 0x50): column 18: missing ','"},
+		{"UnbalancedParens", `=(1 + 2) * (3`, 1, "argument 1 (=(1 + 2) * (3): column 13: expected ')'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := marker.ParseArguments(tt.args)
+			var argErr *marker.ArgumentError
+			if !errors.As(err, &argErr) {
+				t.Fatalf("expected an ArgumentError, got %v", err)
+			}
+			if argErr.Index != tt.index || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("unexpected error (index %d): %v", argErr.Index, err)
+			}
+		})
+	}
+
+	t.Run("ValidComplexExpression", func(t *testing.T) {
+		expr := `map[string][]int{"a": {1, (2 + 3) * 4}, "b:c": nil}`
+		args, err := marker.ParseArguments("=" + expr + ":plain")
+		if err != nil {
+			t.Fatalf("valid expression rejected: %v", err)
+		}
+		if len(args) != 2 || args[0].Raw != expr || !args[0].ForceExpression {
+			t.Errorf("expression was not passed through unchanged: %+v", args)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+	"github.com/AeonDave/goahead/marker"
+)
+
+func TestMarkerSyntaxCustomPrefix(t *testing.T) {
+	syntax, err := marker.NewSyntax("//ga:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for line, want := range map[string]string{
+		`//ga:Greeting:"gopher"`: `//ga:Greeting:"gopher"`,
+		`// ga:Add:1:2`:          `//ga:Add:1:2`,
+		`//ga:inject!:Decode`:    `//ga:inject!:Decode`,
+	} {
+		m, err := syntax.Parse(line)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", line, err)
+			continue
+		}
+		if got := m.String(); got != want {
+			t.Errorf("Parse(%q).String() = %q, want %q", line, got, want)
+		}
+	}
+	for _, line := range []string{`//:Greeting:"gopher"`, `//:inject!:Decode`, `//go:build exclude`} {
+		if _, err := syntax.Parse(line); !errors.Is(err, marker.ErrNotMarker) {
+			t.Errorf("Parse(%q) should not be a marker, got %v", line, err)
+		}
+	}
+
+	for _, prefix := range []string{"", "ga:", "//", "//g a:", "//go:"} {
+		if _, err := marker.NewSyntax(prefix); err == nil {
+			t.Errorf("NewSyntax(%q) should fail", prefix)
+		}
+	}
+}
+
+func TestRunCodegenCustomMarkerPrefix(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Greeting(name string) string { return "hello " + name }
+
+func Upper(s string) string { return strings.ToUpper(s) }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//ga:Greeting:"gopher"
+var greeting = ""
+
+//:Greeting:"other tool"
+var legacy = ""
+
+//:Missing
+var untouched = ""
+
+//ga:inject!:Upper
+
+func main() { println(greeting, legacy, untouched, Upper("x")) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir, MarkerPrefix: "//ga:"})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if markers := report.Markers(); len(markers) != 0 {
+		t.Errorf("legacy //: comments must not be reported: %+v", markers)
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{`var greeting = "hello gopher"`, `var legacy = ""`, `var untouched = ""`, "func Upper(s string) string"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir, MarkerPrefix: "//go:"}); err == nil || !strings.Contains(err.Error(), "invalid -marker-prefix") {
+		t.Errorf("expected an invalid prefix error, got %v", err)
+	}
+}
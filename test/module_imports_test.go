@@ -0,0 +1,55 @@
+package test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestHelperImportsModulePackage(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOAHEAD_CACHE", t.TempDir())
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "testmod/internal/crypto"
+
+func Key() string { return crypto.Sum("k") }
+`)
+	writeFile(t, dir, "internal/crypto/crypto.go", "package crypto\n\nimport \"testmod/internal/encode\"\n\nfunc Sum(s string) string { return encode.Tag(\"sum-\" + s) }\n")
+	writeFile(t, dir, "internal/encode/encode.go", "package encode\n\nfunc Tag(s string) string { return \"<\" + s + \">\" }\n")
+	writeFile(t, dir, "cmd/app/main.go", "package main\n\n//:Key\nvar key = \"\"\n\nfunc main() { println(key) }\n")
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content := readProjectFile(t, dir, "cmd/app/main.go"); !strings.Contains(content, `var key = "<sum-k>"`) {
+		t.Fatalf("expected the helper to call the internal package:\n%s", content)
+	}
+	// The program ran in a hidden directory of the module, removed after
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".goahead-") {
+			t.Errorf("%s was left behind in the module", e.Name())
+		}
+	}
+
+	// The persistent result cache sees the packages the helper depends on
+	writeFile(t, dir, "internal/encode/encode.go", "package encode\n\nfunc Tag(s string) string { return \"[\" + s + \"]\" }\n")
+	var stats *internal.RunStats
+	var err error
+	captureStderr(t, func() {
+		stats, err = internal.RunCodegenWithStats(internal.Config{Dir: dir})
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content := readProjectFile(t, dir, "cmd/app/main.go"); !strings.Contains(content, `var key = "[sum-k]"`) || stats.ResultCacheHits != 0 {
+		t.Errorf("expected a new result once the package changed (%d cache hits):\n%s", stats.ResultCacheHits, content)
+	}
+}
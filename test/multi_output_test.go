@@ -0,0 +1,253 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestMultiOutputTupleReturn(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func GetDBConfig() (string, int, bool) { return "db.internal", 5432, true }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:GetDBConfig -> dbHost, dbPort, dbTLS
+var (
+	dbHost = ""
+	dbPort = 0 // default
+	dbTLS  = false
+)
+
+func main() { println(dbHost, dbPort, dbTLS) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("unexpected skipped markers: %+v", report.Markers())
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{`dbHost = "db.internal"`, `dbPort = 5432 // default`, `dbTLS  = true`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestMultiOutputStructFields(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+type DBConfig struct {
+	Host   string
+	Port   int
+	UseTLS bool
+}
+
+func GetDBConfig(env string) (*DBConfig, error) {
+	return &DBConfig{Host: env + ".db", Port: 6432, UseTLS: true}, nil
+}
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:GetDBConfig:"prod" -> host, port, dbTLS=UseTLS
+var (
+	host  string
+	port  = 0
+	dbTLS = false
+)
+
+func main() { println(host, port, dbTLS) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("unexpected skipped markers: %+v", report.Markers())
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{`host  string = "prod.db"`, `port  = 6432`, `dbTLS = true`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestMultiOutputMissingVariable(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func GetDBConfig() (string, int, bool) { return "db.internal", 5432, true }
+`)
+	original := `package main
+
+//:GetDBConfig -> dbHost, dbPort, dbTLS
+var (
+	dbHost = ""
+	dbPort = 0
+)
+
+func main() { println(dbHost, dbPort) }
+`
+	writeFile(t, dir, "main.go", original)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipOutputMismatch || skip.Line != 3 {
+		t.Errorf("unexpected skip: %+v", skip)
+	}
+	if !strings.Contains(skip.Suggestion, "main.go:3: variable dbTLS not found in the var block") {
+		t.Errorf("suggestion should name the marker location and variable: %s", skip.Suggestion)
+	}
+	if content := readMain(t, dir); content != original {
+		t.Errorf("no variable should change when one is missing:\n%s", content)
+	}
+}
+
+func TestMultiOutputKindMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Pair() (string, int) { return "a", 1 }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Pair -> name, count
+var (
+	name  = ""
+	count = ""
+)
+
+func main() { println(name, count) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipOutputMismatch || !strings.Contains(skip.Suggestion, "variable count holds a string literal") {
+		t.Errorf("unexpected skip: %+v", skip)
+	}
+}
+
+const multiAssignmentHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import (
+	"net"
+	"strconv"
+)
+
+func SplitHostPort(addr string) (string, int, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := strconv.Atoi(port)
+	return host, n, err
+}
+
+func Triple() (string, int, bool) { return "a", 1, true }
+
+func Name() string { return "ada" }
+`
+
+func TestMultiAssignmentFilledPositionally(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", multiAssignmentHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+//:SplitHostPort:"db.internal:5432"
+var dbHost, dbPort = "", 0
+
+func main() {
+	//:SplitHostPort:"example.com:8080"
+	host, port := "", 0 // defaults
+
+	// A single value still replaces the first literal of its kind
+	//:Name
+	name, count := "", 0
+	println(dbHost, dbPort, host, port, name, count)
+}
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("unexpected skipped markers: %+v", report.Markers())
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{
+		`var dbHost, dbPort = "db.internal", 5432`,
+		`host, port := "example.com", 8080 // defaults`,
+		`name, count := "ada", 0`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestMultiAssignmentArityMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", multiAssignmentHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+func main() {
+	//:Triple
+	label, n := "", 0
+	println(label, n)
+}
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skipped := singleSkip(t, report)
+	if skipped.Reason != internal.SkipOutputMismatch || skipped.Line != 4 ||
+		skipped.Suggestion != "main.go:4: Triple returns 3 values but the assignment has 2 variables" {
+		t.Errorf("expected an arity mismatch naming the marker line, got %+v", skipped)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `label, n := "", 0`) {
+		t.Errorf("expected the assignment to be left alone:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const namedTargetHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Port() int { return 8080 }
+
+func Host() string { return "example.com" }
+
+func Name() string { return "svc" }
+`
+
+func TestNamedTargetsReplaceTheirDeclaration(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", namedTargetHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+var (
+	//:Port > port
+	//:Host > host
+	name = ""
+	host = "" // default
+
+	port = 0
+)
+
+// The marker below a targeted one still takes the next line
+//:Name > label
+//:Host
+var other = ""
+
+var start = "keep"
+
+func main() {
+	label := ""
+	println(name, host, port, other, start, label)
+}
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("unexpected skipped markers: %+v", report.Markers())
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{
+		`name = ""`,
+		`host = "example.com" // default`,
+		`port = 8080`,
+		`var other = "example.com"`,
+		`var start = "keep"`,
+		`label := "svc"`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+// Declarations above the marker, outside its var block, are not targets
+func TestNamedTargetWithoutDeclaration(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", namedTargetHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+var port = 0
+
+func main() {
+	//:Port > port
+	count := 0
+	println(port, count)
+}
+`)
+
+	stderr := captureStderr(t, func() {
+		report, err := internal.RunCodegenWithReport(internal.Config{Dir: dir})
+		if err != nil {
+			t.Fatalf("RunCodegen failed: %v", err)
+		}
+		skipped := singleSkip(t, report)
+		if skipped.Reason != internal.SkipNoTarget || skipped.Line != 6 ||
+			skipped.Suggestion != "no declaration of port in the var block of the marker or below it" {
+			t.Errorf("unexpected skip: %+v", skipped)
+		}
+	})
+	if !strings.Contains(stderr, "main.go:6: no declaration of port") {
+		t.Errorf("expected a warning naming the marker line, got:\n%s", stderr)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, "count := 0") || !strings.Contains(content, "var port = 0") {
+		t.Errorf("expected the file to be left alone:\n%s", content)
+	}
+}
+
+func TestNamedTargetsCannotShareADeclaration(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", namedTargetHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+//:Name > name
+//:Host
+var name = ""
+
+func main() { println(name) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if skipped := singleSkip(t, report); skipped.Reason != internal.SkipOverlapping || skipped.Line != 3 {
+		t.Errorf("expected the targeted marker to be skipped as overlapping, got %+v", skipped)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var name = "example.com"`) {
+		t.Errorf("expected the marker above the line to keep it:\n%s", content)
+	}
+}
@@ -0,0 +1,111 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// The counter is kept in a file so that it also advances across the
+// separate evaluation programs of different source files
+const counterHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func bump(name string) int {
+	path := filepath.Join(os.Getenv("GOAHEAD_PROJECT_ROOT"), name)
+	data, _ := os.ReadFile(path)
+	n, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	n++
+	_ = os.WriteFile(path, []byte(strconv.Itoa(n)), 0o644)
+	return n
+}
+
+// Next returns the next ticket number.
+//
+//goahead:nocache
+func Next() int { return bump("next.count") }
+
+// Cached returns the next ticket number, but is cached like any helper
+func Cached() int { return bump("cached.count") }
+`
+
+func TestNoCacheHelperIsEvaluatedForEveryMarker(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", counterHelpers)
+	writeFile(t, dir, "a.go", `package main
+
+//:Next
+var first = 0
+
+//:Cached
+var cachedFirst = 0
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Next
+var second = 0
+
+//:Cached
+var cachedSecond = 0
+
+func main() { println(first, second, cachedFirst, cachedSecond) }
+`)
+	annotations := filepath.Join(t.TempDir(), "map.json")
+
+	var err error
+	stderr := captureStderr(t, func() {
+		err = internal.RunCodegenWithConfig(internal.Config{Dir: dir, Annotations: annotations})
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+
+	a, err := os.ReadFile(filepath.Join(dir, "a.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(a) + readMain(t, dir)
+	for _, want := range []string{"var first = 1", "var second = 2", "var cachedFirst = 1", "var cachedSecond = 1"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	if n := strings.Count(stderr, "nocache: not reproducible"); n != 2 {
+		t.Errorf("expected both Next replacements flagged, got %d:\n%s", n, stderr)
+	}
+
+	data, err := os.ReadFile(annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file internal.AnnotationFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	flagged := 0
+	for key, entry := range file.Entries {
+		if entry.NotReproducible != (entry.Helper == "Next") {
+			t.Errorf("%s: unexpected not_reproducible for %s", key, entry.Helper)
+		}
+		if entry.NotReproducible {
+			flagged++
+		}
+	}
+	if len(file.Entries) != 4 || flagged != 2 {
+		t.Errorf("expected four annotations, two flagged: %+v", file.Entries)
+	}
+}
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// writeOutSource writes a module with values, an injection, a data file and
+// a nested module to dir
+func writeOutSource(t *testing.T, dir string) {
+	t.Helper()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", skipPolicyHelpers)
+	writeFile(t, dir, "main.go", "package main\n\nimport \"testmod/pkg\"\n\n//:Shout:\"hi\"\nvar greeting = \"\"\n\nfunc main() { println(greeting, pkg.Loud()) }\n")
+	writeFile(t, dir, "pkg/loud.go", "package pkg\n\n//:inject!:Shout\n\nfunc Loud() string { return Shout(\"pkg\") }\n")
+	writeFile(t, dir, "pkg/plain.go", "package pkg\n\nconst Plain = 1\n")
+	writeFile(t, dir, "data/banner.txt", "banner\n")
+	writeFile(t, dir, "sub/go.mod", "module submod\ngo 1.22\n")
+	writeFile(t, dir, "sub/helpers.go", "//go:build exclude\n//go:ahead functions\n\npackage main\n\nfunc Answer() int { return 42 }\n")
+	writeFile(t, dir, "sub/main.go", "package main\n\n//:Answer\nvar answer = 0\n\nfunc main() { println(answer) }\n")
+}
+
+// snapshotTree returns the content of every file under dir by slash path,
+// leaving out the directory skip
+func snapshotTree(t *testing.T, dir, skip string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == skip {
+			if err == nil {
+				err = filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func goBuild(t *testing.T, dir string) {
+	t.Helper()
+	// Binaries go elsewhere, so the tree holds only what goahead wrote
+	cmd := exec.Command("go", "build", "-o", t.TempDir()+string(filepath.Separator), "./...")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build in %s failed: %v\n%s", dir, err, out)
+	}
+}
+
+func TestOutTreeLeavesSourcesAlone(t *testing.T) {
+	src := t.TempDir()
+	writeOutSource(t, src)
+	out := filepath.Join(src, "generated-src")
+	before := snapshotTree(t, src, out)
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: src, Out: out}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if after := snapshotTree(t, src, out); !equalTrees(before, after) {
+		t.Errorf("expected the sources to be left alone")
+	}
+	generated := snapshotTree(t, out, "")
+	for rel, want := range map[string]string{
+		"main.go":         `var greeting = "HI"`,
+		"pkg/loud.go":     "func Shout(",
+		"pkg/plain.go":    "const Plain = 1",
+		"data/banner.txt": "banner",
+		"sub/main.go":     "var answer = 42",
+	} {
+		if !strings.Contains(generated[rel], want) {
+			t.Errorf("expected %q in %s of the -out tree:\n%s", want, rel, generated[rel])
+		}
+	}
+	goBuild(t, out)
+	goBuild(t, filepath.Join(out, "sub"))
+
+	// A re-run regenerates the same tree and drops files the sources lost
+	if err := os.Remove(filepath.Join(src, "data", "banner.txt")); err != nil {
+		t.Fatal(err)
+	}
+	delete(generated, "data/banner.txt")
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: src, Out: out}); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	again := snapshotTree(t, out, "")
+	if strings.Contains(again[internal.OutManifestName], "banner.txt") {
+		t.Errorf("expected the manifest to drop the removed file:\n%s", again[internal.OutManifestName])
+	}
+	generated[internal.OutManifestName] = again[internal.OutManifestName]
+	if !equalTrees(generated, again) {
+		t.Errorf("expected the re-run to regenerate the same tree, got %v", again)
+	}
+
+	// An in-place run does not treat the -out tree as sources
+	if err := internal.RunCodegen(src, false); err != nil {
+		t.Fatalf("in-place run failed: %v", err)
+	}
+	if after := snapshotTree(t, out, ""); !equalTrees(again, after) {
+		t.Errorf("expected the in-place run to leave the -out tree alone")
+	}
+}
+
+func equalTrees(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for rel, content := range a {
+		if other, ok := b[rel]; !ok || other != content {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOutTreeLinksUnchangedFiles(t *testing.T) {
+	for _, link := range []string{internal.OutLinkHard, internal.OutLinkSymlink} {
+		t.Run(link, func(t *testing.T) {
+			src, out := t.TempDir(), filepath.Join(t.TempDir(), "out")
+			writeOutSource(t, src)
+			if err := internal.RunCodegenWithConfig(internal.Config{Dir: src, Out: out, OutLink: link}); err != nil {
+				t.Skipf("%s links unavailable: %v", link, err)
+			}
+			srcInfo, err := os.Stat(filepath.Join(src, "pkg", "plain.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			plain, err := os.Stat(filepath.Join(out, "pkg", "plain.go"))
+			if err != nil || !os.SameFile(srcInfo, plain) {
+				t.Errorf("expected the unchanged file to be linked (%v)", err)
+			}
+			if lstat, err := os.Lstat(filepath.Join(out, "main.go")); err != nil || !lstat.Mode().IsRegular() {
+				t.Errorf("expected the rewritten file to be a file of its own (%v)", err)
+			}
+			if content := readProjectFile(t, src, "main.go"); !strings.Contains(content, `var greeting = ""`) {
+				t.Errorf("expected the source to be left alone:\n%s", content)
+			}
+		})
+	}
+}
+
+func TestOutTreeRefusesForeignDirectory(t *testing.T) {
+	src, out := t.TempDir(), t.TempDir()
+	writeOutSource(t, src)
+	writeFile(t, out, "notes.txt", "mine\n")
+
+	err := internal.RunCodegenWithConfig(internal.Config{Dir: src, Out: out})
+	if err == nil || !strings.Contains(err.Error(), "refusing to write") {
+		t.Errorf("expected a refusal, got %v", err)
+	}
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: filepath.Join(src, "pkg"), Out: src}); err == nil || !strings.Contains(err.Error(), "must not contain the source tree") {
+		t.Errorf("expected -out around the sources to be rejected, got %v", err)
+	}
+}
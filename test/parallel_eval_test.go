@@ -0,0 +1,143 @@
+package test
+
+import (
+	"errors"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// sleepingRunner takes delay for every evaluation program, answers with the
+// argument of its last Echo call and fails programs calling Echo("bad")
+type sleepingRunner struct {
+	delay time.Duration
+
+	mu       sync.Mutex
+	programs int
+}
+
+func (r *sleepingRunner) Run(dir string, env []string, args ...string) (string, string, error) {
+	if len(args) > 0 && args[0] == "list" {
+		return "fmt\nstrings\n", "", nil
+	}
+	program, err := os.ReadFile(args[len(args)-1])
+	if err != nil {
+		return "", "", err
+	}
+	r.mu.Lock()
+	r.programs++
+	r.mu.Unlock()
+	time.Sleep(r.delay)
+
+	source := string(program)
+	i := strings.LastIndex(source, "Echo(")
+	if i < 0 {
+		return "", "", errors.New("no Echo call in program")
+	}
+	arg, _, _ := strings.Cut(source[i+len("Echo("):], ")")
+	if arg == `"bad"` {
+		return "", "helper failed\n", errors.New("exit status 1")
+	}
+	value, err := strconv.Unquote(arg)
+	if err != nil {
+		return "", "", err
+	}
+	return evalOutput(value), "", nil
+}
+
+func newEchoExecutor(t testing.TB, runner internal.Runner) (*internal.FunctionExecutor, string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Echo(s string) string { return s }
+`)
+	ctx := &internal.ProcessorContext{
+		FunctionsByDir:   make(map[string]map[string]*internal.UserFunction),
+		FunctionsByDepth: make(map[int]map[string]*internal.UserFunction),
+		RootDir:          dir,
+		FileSet:          token.NewFileSet(),
+		TempDir:          t.TempDir(),
+	}
+	fileProcessor := internal.NewFileProcessor(ctx)
+	if _, err := fileProcessor.CollectAllGoFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileProcessor.LoadUserFunctions(); err != nil {
+		t.Fatal(err)
+	}
+	return internal.NewFunctionExecutorWithRunner(ctx, runner), dir
+}
+
+func TestExecuteAllRunsDistinctCallsConcurrently(t *testing.T) {
+	runner := &sleepingRunner{delay: 200 * time.Millisecond}
+	executor, dir := newEchoExecutor(t, runner)
+
+	calls := []internal.BatchCall{
+		{FuncName: "Echo", ArgsStr: `"a"`},
+		{FuncName: "Echo", ArgsStr: `"b"`},
+		{FuncName: "Echo", ArgsStr: `"c"`},
+		{FuncName: "Echo", ArgsStr: `"d"`},
+	}
+	start := time.Now()
+	results := executor.ExecuteAll(calls, dir, 4)
+	elapsed := time.Since(start)
+
+	for i, want := range []string{`"a"`, `"b"`, `"c"`, `"d"`} {
+		if results[i].Err != nil {
+			t.Fatalf("call %d failed: %v", i, results[i].Err)
+		}
+		if results[i].Result != want {
+			t.Fatalf("call %d: expected %s, got %s", i, want, results[i].Result)
+		}
+	}
+	// Four 200ms programs take ~800ms one after another
+	if elapsed > 600*time.Millisecond {
+		t.Fatalf("expected the calls to run concurrently in ~200ms, took %v", elapsed)
+	}
+}
+
+func TestExecuteAllKeepsErrorsPerCall(t *testing.T) {
+	runner := &sleepingRunner{}
+	executor, dir := newEchoExecutor(t, runner)
+
+	results := executor.ExecuteAll([]internal.BatchCall{
+		{FuncName: "Echo", ArgsStr: `"ok"`},
+		{FuncName: "Echo", ArgsStr: `"bad"`},
+		{FuncName: "Missing", ArgsStr: `"x"`},
+		{FuncName: "Echo", ArgsStr: `"ok"`},
+	}, dir, 2)
+
+	if results[0].Err != nil || results[0].Result != `"ok"` {
+		t.Fatalf("expected first call to succeed, got %q, %v", results[0].Result, results[0].Err)
+	}
+	if results[1].Err == nil {
+		t.Fatal("expected the failing helper to report an error")
+	}
+	if results[2].Err == nil || !strings.Contains(results[2].Err.Error(), "Missing") {
+		t.Fatalf("expected an unknown function error, got %v", results[2].Err)
+	}
+	if results[3].Err != nil || results[3].Result != `"ok"` {
+		t.Fatalf("expected duplicate call to share the result, got %q, %v", results[3].Result, results[3].Err)
+	}
+	if runner.programs != 2 {
+		t.Fatalf("expected 2 evaluation programs for the distinct calls, got %d", runner.programs)
+	}
+}
+
+func TestJobsFlagRejectsNegativeValues(t *testing.T) {
+	config := internal.Config{Dir: ".", Jobs: -1}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "-jobs") {
+		t.Fatalf("expected -jobs validation error, got %v", err)
+	}
+}
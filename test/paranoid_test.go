@@ -0,0 +1,110 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const paranoidMain = `package main
+
+import "fmt"
+
+// greeting is set by goahead
+//:Greeting
+var greeting = ""
+
+var (
+	//:Count
+	count = 0
+	limit = 10 // not a target
+)
+
+//:inject!:Shout
+
+func main() {
+	fmt.Println(greeting, count, limit, Shout("x"))
+}
+`
+
+var paranoidProject = map[string]string{
+	"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Greeting() string { return "hello" }
+
+func Count() int { return 42 }
+
+func Shout(s string) string { return strings.ToUpper(s) }
+`,
+	"main.go": paranoidMain,
+}
+
+func TestParanoidAcceptsRegularRewrite(t *testing.T) {
+	dir, _ := setupTestDir(t, paranoidProject)
+	report, err := runWithReport(t, internal.Config{Dir: dir, Paranoid: true, Format: true, TagReplacements: true})
+	if err != nil || report.Len() != 0 {
+		t.Fatalf("RunCodegen failed: %v\n%s", err, report.Format(dir))
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{`var greeting = "hello"`, "count = 42", "func Shout(s string) string"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestParanoidUndoesRewriteOutsideMarkers(t *testing.T) {
+	dir, _ := setupTestDir(t, paranoidProject)
+	t.Cleanup(func() { internal.AfterRewriteHook = nil })
+	// A rewriting bug that also touches an unrelated line
+	internal.AfterRewriteHook = func(filePath string, content []byte) []byte {
+		return []byte(strings.Replace(string(content), "limit = 10", "limit = 11", 1))
+	}
+
+	// The rewrite is checked before it is written, so main.go is never
+	// replaced, not even to be restored
+	before, statErr := os.Stat(filepath.Join(dir, "main.go"))
+	if statErr != nil {
+		t.Fatal(statErr)
+	}
+
+	diagnostics := filepath.Join(dir, "goahead.sarif")
+	var err error
+	stderr := captureStderr(t, func() {
+		err = internal.RunCodegenWithConfig(internal.Config{Dir: dir, Paranoid: true, Diagnostics: "sarif:" + diagnostics})
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if got := readMain(t, dir); got != paranoidMain {
+		t.Errorf("expected main.go to be left untouched, got:\n%s", got)
+	}
+	if after, err := os.Stat(filepath.Join(dir, "main.go")); err != nil || !os.SameFile(before, after) {
+		t.Errorf("expected main.go not to be rewritten (%v)", err)
+	}
+	for _, want := range []string{"left main.go unchanged", "line 15: BasicLit (line 12 before): 10 became 11"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("expected %q in:\n%s", want, stderr)
+		}
+	}
+	if data, err := os.ReadFile(diagnostics); err != nil || !strings.Contains(string(data), internal.RuleParanoid) {
+		t.Errorf("expected a %s diagnostic, got %v:\n%s", internal.RuleParanoid, err, data)
+	}
+
+	// Without -paranoid the same bug goes through
+	if _, err := runWithReport(t, internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if !strings.Contains(readMain(t, dir), "limit = 11") {
+		t.Errorf("expected the perturbed rewrite to be written without -paranoid")
+	}
+}
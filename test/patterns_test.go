@@ -0,0 +1,107 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// failingRunner simulates a missing go toolchain
+type failingRunner struct{}
+
+func (failingRunner) Run(string, []string, ...string) (string, string, error) {
+	return "", "", errors.New(`exec: "go": executable file not found in $PATH`)
+}
+
+// patternTarget is a file of package pkg with a marker
+func patternTarget(pkg string) string {
+	return "package " + pkg + "\n\n//:Name\nvar name = \"\"\n"
+}
+
+// patternProject is a module with a root helper, nested packages under cmd,
+// an unrelated package and an assets folder without Go files
+var patternProject = map[string]string{
+	"go.mod": "module example.com/app\ngo 1.22\n",
+	"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Name() string { return "app" }
+`,
+	"cmd/app/main.go":               patternTarget("main") + "\nfunc main() { println(name) }\n",
+	"cmd/app/internal/util/util.go": patternTarget("util"),
+	"pkg/other/other.go":            patternTarget("other"),
+	"assets/logo.txt":               "not go\n",
+	"cmd/app/testdata/fixture.go":   patternTarget("fixture"),
+}
+
+func TestExpandPackagePatterns(t *testing.T) {
+	dir, _ := setupTestDir(t, patternProject)
+	for name, runner := range map[string]internal.Runner{"GoList": nil, "Fallback": failingRunner{}} {
+		t.Run(name, func(t *testing.T) {
+			tests := []struct {
+				patterns []string
+				want     []string
+			}{
+				{[]string{"./cmd/..."}, []string{"cmd/app", "cmd/app/internal/util"}},
+				{[]string{"./..."}, []string{"cmd/app", "cmd/app/internal/util", "pkg/other"}},
+				{[]string{"./cmd/app", "example.com/app/pkg/..."}, []string{"cmd/app", "pkg/other"}},
+			}
+			for _, tt := range tests {
+				dirs, err := internal.ExpandPackagePatterns(runner, dir, tt.patterns)
+				if err != nil {
+					t.Fatalf("ExpandPackagePatterns(%v) failed: %v", tt.patterns, err)
+				}
+				var got []string
+				for _, d := range dirs {
+					rel, err := filepath.Rel(dir, d)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got = append(got, filepath.ToSlash(rel))
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("ExpandPackagePatterns(%v) = %v, want %v", tt.patterns, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunCodegenWithPatterns(t *testing.T) {
+	dir, _ := setupTestDir(t, patternProject)
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir, Patterns: []string{"./cmd/..."}}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+
+	for file, wantReplaced := range map[string]bool{
+		"cmd/app/main.go":               true,
+		"cmd/app/internal/util/util.go": true,
+		"pkg/other/other.go":            false,
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := string(data)
+		if replaced := strings.Contains(content, `var name = "app"`); replaced != wantReplaced {
+			t.Errorf("%s replaced = %v, want %v:\n%s", file, replaced, wantReplaced, content)
+		}
+	}
+}
+
+func TestRunCodegenPatternsMatchNothing(t *testing.T) {
+	dir, _ := setupTestDir(t, patternProject)
+
+	_, err := runWithReport(t, internal.Config{Dir: dir, Patterns: []string{"./assets/..."}})
+	if err == nil || !strings.Contains(err.Error(), "matched no packages") {
+		t.Errorf("expected a no packages error, got %v", err)
+	}
+}
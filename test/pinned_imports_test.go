@@ -0,0 +1,109 @@
+package test
+
+import (
+	"archive/zip"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// writeModuleProxy lays out a GOPROXY directory serving example.com/greet at
+// the given versions, each with one greet.go
+func writeModuleProxy(t *testing.T, versions map[string]string) string {
+	t.Helper()
+	proxy := t.TempDir()
+	dir := filepath.Join(proxy, "example.com", "greet", "@v")
+	var list []string
+	for version, source := range versions {
+		list = append(list, version)
+		writeFile(t, dir, version+".mod", "module example.com/greet\n\ngo 1.22\n")
+		writeFile(t, dir, version+".info", `{"Version":"`+version+`","Time":"2024-01-01T00:00:00Z"}`)
+		f, err := os.Create(filepath.Join(dir, version+".zip"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		z := zip.NewWriter(f)
+		for name, content := range map[string]string{"go.mod": "module example.com/greet\n\ngo 1.22\n", "greet.go": source} {
+			w, err := z.Create("example.com/greet@" + version + "/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := z.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, dir, "list", strings.Join(list, "\n")+"\n")
+	return proxy
+}
+
+func TestPinnedImportOfThirdPartyModule(t *testing.T) {
+	proxy := writeModuleProxy(t, map[string]string{
+		"v1.2.0": "package greet\n\nfunc Hello(name string) string { return \"hello \" + name }\n",
+		"v1.3.0": "package greet\n\nfunc Hello(name string) string { return \"hi \" + name }\n",
+	})
+	modCache := t.TempDir()
+	// The module cache is read-only
+	t.Cleanup(func() {
+		_ = filepath.WalkDir(modCache, func(path string, d fs.DirEntry, err error) error {
+			if err == nil {
+				_ = os.Chmod(path, 0o755)
+			}
+			return nil
+		})
+	})
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(proxy))
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOMODCACHE", modCache)
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOAHEAD_CACHE", t.TempDir())
+
+	dir := t.TempDir()
+	goMod := "module testmod\n\ngo 1.22\n"
+	writeFile(t, dir, "go.mod", goMod)
+	writeFile(t, dir, "helpers.go", "//go:build exclude\n//go:ahead functions\n//go:ahead import greet=example.com/greet@v1.2.0\n\npackage main\n")
+	writeFile(t, dir, "main.go", "package main\n\n//:greet.Hello:true\nvar hi = \"\"\n\nfunc main() { println(hi) }\n")
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	// The signature of Hello formats true as a string
+	if content := readMain(t, dir); !strings.Contains(content, `var hi = "hello true"`) {
+		t.Fatalf("expected the pinned package called:\n%s", content)
+	}
+	if content := readProjectFile(t, dir, "go.mod"); content != goMod {
+		t.Errorf("expected go.mod untouched, got:\n%s", content)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "go.sum")); err == nil {
+		t.Error("expected no go.sum written in the module")
+	}
+
+	// Another version is another cache key
+	writeFile(t, dir, "helpers.go", "//go:build exclude\n//go:ahead functions\n//go:ahead import greet=example.com/greet@v1.3.0\n\npackage main\n")
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var hi = "hi true"`) {
+		t.Fatalf("expected the new version called:\n%s", content)
+	}
+
+	// A version the proxy does not have names the directive
+	writeFile(t, dir, "helpers.go", "//go:build exclude\n//go:ahead functions\n//go:ahead import greet=example.com/greet@v9.0.0\n\npackage main\n")
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if skip := singleSkip(t, report); !strings.Contains(skip.Suggestion, "helpers.go:3: //go:ahead import greet=example.com/greet@v9.0.0: go get example.com/greet@v9.0.0 failed") {
+		t.Errorf("expected the directive named, got %q", skip.Suggestion)
+	}
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// TestHelperRunsFromModuleRoot verifies that helpers reading project-relative
+// files work no matter which directory goahead is started from
+func TestHelperRunsFromModuleRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "assets/key.pem", "KEY-MATERIAL\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+func ReadKey() string {
+	data, err := os.ReadFile("assets/key.pem")
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func ProjectRoot() string { return os.Getenv("`+internal.ProjectRootEnv+`") }
+`)
+	writeFile(t, dir, "cmd/app/main.go", `package main
+
+//:ReadKey
+var key = ""
+
+//:ProjectRoot
+var root = ""
+
+func main() {}
+`)
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	defer os.Chdir(origDir)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "cmd", "app", "main.go"))
+	if err != nil {
+		t.Fatalf("read main.go: %v", err)
+	}
+	got := string(content)
+	if !strings.Contains(got, `var key = "KEY-MATERIAL"`) {
+		t.Errorf("helper should read assets relative to the module root, got:\n%s", got)
+	}
+
+	absDir, _ := filepath.EvalSymlinks(dir)
+	if !strings.Contains(got, `var root = "`+dir+`"`) && !strings.Contains(got, `var root = "`+absDir+`"`) {
+		t.Errorf("%s should point at the module root %s, got:\n%s", internal.ProjectRootEnv, dir, got)
+	}
+}
@@ -0,0 +1,173 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// TestRepeatRunIsSilent verifies that a second run over a tree whose values
+// are already correct logs no replacements and does not rewrite any file
+func TestRepeatRunIsSilent(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Name() string { return "gopher" }
+func Answer() int  { return 42 }
+func Ratio() float64 { return 0.5 }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Name
+var name = ""
+
+//:Answer
+var answer = 0
+
+var (
+	//:Ratio
+	ratio = 0.0
+)
+
+type user struct{ Name string }
+
+var owner = user{
+	//:Name
+	Name: "",
+}
+
+func main() {
+	//:Name
+	local := ""
+	_ = local
+	_, _, _, _ = name, answer, ratio, owner
+}
+`)
+
+	config := internal.Config{Dir: dir}
+	first := captureStderr(t, func() {
+		if err := internal.RunCodegenWithConfig(config); err != nil {
+			t.Errorf("first run failed: %v", err)
+		}
+	})
+	if got := strings.Count(first, "[goahead] Replaced"); got != 5 {
+		t.Fatalf("expected 5 replacements on the first run, got %d:\n%s", got, first)
+	}
+
+	mainPath := filepath.Join(dir, "main.go")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(mainPath, past, past); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(mainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := captureStderr(t, func() {
+		if err := internal.RunCodegenWithConfig(config); err != nil {
+			t.Errorf("second run failed: %v", err)
+		}
+	})
+	if strings.Contains(second, "[goahead] Replaced") {
+		t.Errorf("second run should not log replacements, got:\n%s", second)
+	}
+
+	after, err := os.ReadFile(mainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("second run changed main.go:\n%s", after)
+	}
+	info, err := os.Stat(mainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Errorf("second run rewrote main.go: mtime %v, want %v", info.ModTime(), past)
+	}
+	verifyCompiles(t, dir)
+}
+
+// TestValuesUpdateOnHelperChange verifies that values written by an earlier
+// run are overwritten when the helper returns something else
+func TestValuesUpdateOnHelperChange(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	helpers := func(version string, build int, debug bool, names string) {
+		t.Helper()
+		writeFile(t, dir, "helpers.go", fmt.Sprintf(`//go:build exclude
+//go:ahead functions
+
+package main
+
+func Version() string { return %q }
+func Build() int { return %d }
+func Debug() bool { return %t }
+func Names() []string { return []string{%s} }
+`, version, build, debug, names))
+	}
+	writeFile(t, dir, "main.go", `package main
+
+//:Version
+var version = ""
+
+//:Build
+var build = 0 // build number
+
+//:Debug
+var debug = false
+
+//:Names
+var names = []string{}
+
+type config struct{ Version string }
+
+var cfg = config{
+	//:Version
+	Version: "",
+}
+
+func main() {
+	//:Version
+	//:Build
+	label, n := "", 0
+	println(version, build, debug, len(names), cfg.Version, label, n)
+}
+`)
+
+	for _, step := range []struct {
+		version string
+		build   int
+		debug   bool
+		names   string
+		want    []string
+	}{
+		{"1.0.0", 1, true, `"a"`, []string{`var version = "1.0.0"`, "var build = 1 // build number", "var debug = true",
+			`var names = []string{"a"}`, `Version: "1.0.0",`, `label, n := "1.0.0", 1`}},
+		{"1.1.0", -2, false, `"b", "c"`, []string{`var version = "1.1.0"`, "var build = -2 // build number", "var debug = false",
+			`var names = []string{"b", "c"}`, `Version: "1.1.0",`, `label, n := "1.1.0", -2`}},
+	} {
+		helpers(step.version, step.build, step.debug, step.names)
+		if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir}); err != nil {
+			t.Fatalf("RunCodegen failed for %s: %v", step.version, err)
+		}
+		content := readMain(t, dir)
+		for _, want := range step.want {
+			if !strings.Contains(content, want) {
+				t.Errorf("expected %q after the helper returned %s:\n%s", want, step.version, content)
+			}
+		}
+	}
+	verifyCompiles(t, dir)
+}
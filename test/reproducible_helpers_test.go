@@ -0,0 +1,102 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const reproducibleHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+func Stamp() string { return goaheadNow().Format(time.RFC3339) }
+
+func Env(key string) string { return os.Getenv(key) }
+`
+
+func TestFreezeTimeStampsHelpers(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", reproducibleHelpers)
+	main := "package main\n\n//:Stamp\nvar built = \"\"\n\n//:Stamp\nvar again = \"\"\n\nfunc main() {}\n"
+	writeFile(t, dir, "main.go", main)
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, FreezeTime: "2026-01-22T17:49:00Z"}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	if !strings.Contains(content, `var built = "2026-01-22T17:49:00Z"`) || !strings.Contains(content, `var again = "2026-01-22T17:49:00Z"`) {
+		t.Fatalf("expected the frozen timestamp:\n%s", content)
+	}
+
+	// The offset of the frozen time is kept
+	writeFile(t, dir, "main.go", main)
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, FreezeTime: "2026-01-22T19:49:00+02:00"}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var built = "2026-01-22T19:49:00+02:00"`) {
+		t.Errorf("expected the timestamp in its offset:\n%s", content)
+	}
+
+	// Without -freeze-time, goaheadNow is the current time
+	writeFile(t, dir, "main.go", main)
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content := readMain(t, dir); strings.Contains(content, "2026-01-22T17:49:00Z") || strings.Contains(content, `var built = ""`) {
+		t.Errorf("expected the current time:\n%s", content)
+	}
+}
+
+func TestEnvIsolationLimitsHelperEnvironment(t *testing.T) {
+	t.Setenv("GOAHEAD_TEST_LEAK", "leaked")
+	main := "package main\n\n//:Env:\"GOAHEAD_TEST_KEY\"\nvar key = \"\"\n\n//:Env:\"GOAHEAD_TEST_LEAK\"\nvar leak = \"\"\n\n//:Env:\"" + internal.ProjectRootEnv + "\"\nvar root = \"\"\n\n//:Env:\"GOFLAGS\"\nvar flags = \"\"\n\nfunc main() {}\n"
+	run := func(t *testing.T, isolate bool) string {
+		dir := t.TempDir()
+		writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+		writeFile(t, dir, "helpers.go", reproducibleHelpers)
+		writeFile(t, dir, "main.go", main)
+		// GOFLAGS would break the go command if it were set for it too
+		env := []string{"GOAHEAD_TEST_KEY=injected", "GOFLAGS=-not-a-flag"}
+		if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Env: env, EnvIsolate: isolate}); err != nil {
+			t.Fatalf("RunCodegen failed: %v", err)
+		}
+		return readMain(t, dir)
+	}
+
+	content := run(t, true)
+	for _, want := range []string{`var key = "injected"`, `var leak = ""`, `var flags = "-not-a-flag"`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %s under -env-isolate:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, `var root = ""`) {
+		t.Errorf("expected %s to survive -env-isolate:\n%s", internal.ProjectRootEnv, content)
+	}
+
+	if content := run(t, false); !strings.Contains(content, `var key = "injected"`) || !strings.Contains(content, `var leak = "leaked"`) {
+		t.Errorf("expected -env to add to the environment without -env-isolate:\n%s", content)
+	}
+}
+
+func TestReproducibleHelpersRejectInvalidValues(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	for _, cfg := range []internal.Config{
+		{Dir: dir, FreezeTime: "2026-01-22"},
+		{Dir: dir, Env: []string{"NOVALUE"}},
+		{Dir: dir, Env: []string{"=value"}},
+	} {
+		if err := internal.RunCodegenWithConfig(cfg); err == nil || internal.ExitCode(err) != internal.ExitEnvironment {
+			t.Errorf("expected %+v to be rejected as an environment error, got %v", cfg, err)
+		}
+	}
+}
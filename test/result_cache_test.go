@@ -0,0 +1,127 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// The helper reads a file the cache key does not cover, so its result shows
+// whether the helper ran
+const resultCacheHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "os"
+
+func Stamp() string {
+	data, _ := os.ReadFile("stamp.txt")
+	return string(data)
+}
+`
+
+const resultCacheMain = "package main\n\n//:Stamp\nvar stamp = \"\"\n\nfunc main() {}\n"
+
+var resultCacheModule = map[string]string{
+	"helpers.go": resultCacheHelpers,
+	"stamp.txt":  "one",
+	"main.go":    resultCacheMain,
+}
+
+func TestResultCachePersistsAcrossRuns(t *testing.T) {
+	t.Setenv(internal.ResultCacheEnv, filepath.Join(t.TempDir(), "cache"))
+	dir, _ := setupTestDir(t, resultCacheModule)
+	run := func(config internal.Config) *internal.RunStats {
+		t.Helper()
+		writeFile(t, dir, "main.go", resultCacheMain)
+		config.Dir = dir
+		stats, err := internal.RunCodegenWithStats(config)
+		if err != nil {
+			t.Fatalf("RunCodegen failed: %v", err)
+		}
+		return stats
+	}
+	if stats := run(internal.Config{}); stats.ResultCacheHits != 0 || stats.ResultCacheMisses != 1 {
+		t.Errorf("expected a miss on the first run, got %d hit(s) and %d miss(es)", stats.ResultCacheHits, stats.ResultCacheMisses)
+	}
+
+	// The second run is served from the cache without running the helper
+	writeFile(t, dir, "stamp.txt", "two")
+	if stats := run(internal.Config{}); stats.ResultCacheHits != 1 || stats.CacheHits != 1 {
+		t.Errorf("expected a hit on the second run, got %+v", stats)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var stamp = "one"`) {
+		t.Errorf("expected the cached value:\n%s", content)
+	}
+
+	// -no-cache evaluates the marker again and stores nothing
+	if stats := run(internal.Config{NoCache: true}); stats.ResultCacheHits != 0 || stats.ResultCacheMisses != 0 {
+		t.Errorf("expected -no-cache to skip the cache, got %+v", stats)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var stamp = "two"`) {
+		t.Errorf("expected a fresh value with -no-cache:\n%s", content)
+	}
+
+	// Editing a helper file invalidates its entries
+	writeFile(t, dir, "stamp.txt", "three")
+	writeFile(t, dir, "helpers.go", resultCacheHelpers+"\n// edited\n")
+	if stats := run(internal.Config{}); stats.ResultCacheMisses != 1 {
+		t.Errorf("expected a miss after the helper changed, got %+v", stats)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var stamp = "three"`) {
+		t.Errorf("expected the helper to run again:\n%s", content)
+	}
+}
+
+func TestResultCacheSettingsAreKeyed(t *testing.T) {
+	t.Setenv(internal.ResultCacheEnv, filepath.Join(t.TempDir(), "cache"))
+	dir, _ := setupTestDir(t, resultCacheModule)
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	writeFile(t, dir, "main.go", resultCacheMain)
+	stats, err := internal.RunCodegenWithStats(internal.Config{Dir: dir, Env: []string{"MODE=ci"}})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if stats.ResultCacheHits != 0 {
+		t.Errorf("expected -env to select other entries, got %+v", stats)
+	}
+}
+
+func TestCleanCacheSubcommand(t *testing.T) {
+	exe := buildGoahead(t)
+	t.Setenv(internal.ResultCacheEnv, filepath.Join(t.TempDir(), "cache"))
+	dir, _ := setupTestDir(t, resultCacheModule)
+	cacheDir := os.Getenv(internal.ResultCacheEnv)
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command(exe, args...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("goahead %s failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+		return string(output)
+	}
+	run("-dir", dir)
+	writeFile(t, dir, "main.go", resultCacheMain)
+	if output := run("-dir", dir, "-verbose"); !strings.Contains(output, "[goahead] Result cache: 1 hit(s), 0 miss(es)") {
+		t.Errorf("expected the verbose hit count:\n%s", output)
+	}
+
+	if output := run("clean-cache"); !strings.Contains(output, "[goahead] Removed "+cacheDir) {
+		t.Errorf("expected the cache directory to be named:\n%s", output)
+	}
+	if _, err := os.Stat(cacheDir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the cache to be removed, got %v", err)
+	}
+	if output := run("clean-cache"); !strings.Contains(output, "No result cache to remove") {
+		t.Errorf("expected nothing to remove:\n%s", output)
+	}
+}
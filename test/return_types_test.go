@@ -0,0 +1,55 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const returnTypeHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+type Headers struct{ Accept string }
+
+func DefaultHeaders() *Headers { return &Headers{Accept: "json"} }
+
+func Keys() []string { return []string{"a", "b"} }
+
+func Ports() map[string]int { return map[string]int{"http": 80} }
+
+func Config() *Headers { return &Headers{Accept: "xml"} }
+`
+
+func TestPointerReturnIsRejected(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", returnTypeHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+//:DefaultHeaders
+var headers = ""
+
+func main() { println(headers) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir, TraceDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipUnsupportedType || skip.Line != 3 {
+		t.Fatalf("expected an unsupported-type skip at line 3, got %+v", skip)
+	}
+	if want := "helper DefaultHeaders returns *Headers which cannot be inlined; return a string, number or bool"; !strings.Contains(skip.Suggestion, want) {
+		t.Errorf("expected %q in %q", want, skip.Suggestion)
+	}
+	if skip.Trace != "" {
+		t.Errorf("the helper should not have been run, got trace %s", skip.Trace)
+	}
+	if !strings.Contains(readMain(t, dir), `var headers = ""`) {
+		t.Error("target line should be unchanged")
+	}
+}
@@ -0,0 +1,141 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestProjectSettingsFillUnsetOptions(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOAHEAD_CACHE", "")
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", "//go:build exclude\n//go:ahead functions\n\npackage main\n\nfunc Version() string { return \"1.0\" }\n")
+	writeFile(t, dir, internal.ProjectFileName, `[settings]
+strict = true
+exclude = ["gen/**", 'fixtures/'] # generated and test trees
+marker-prefix = "//ga:"
+cache-dir = "cache"
+`)
+	writeFile(t, dir, "main.go", "package main\n\n//ga:Version\nvar version = \"\"\n\n//ga:Missing\nvar missing = \"\"\n\n//:Version\nvar plain = \"\"\n")
+	writeFile(t, dir, "gen/gen.go", "package gen\n\n//ga:Version\nvar version = \"\"\n")
+
+	err := internal.RunCodegenWithConfig(internal.Config{Dir: dir})
+	if !errors.Is(err, internal.ErrUnresolvedMarker) {
+		t.Fatalf("expected strict = true to fail the run on //ga:Missing, got %v", err)
+	}
+	content := readMain(t, dir)
+	if !strings.Contains(content, `var version = "1.0"`) || !strings.Contains(content, `var plain = ""`) {
+		t.Errorf("expected only the //ga: marker applied:\n%s", content)
+	}
+	if content := readProjectFile(t, dir, "gen/gen.go"); strings.Contains(content, `"1.0"`) {
+		t.Errorf("expected gen/ excluded:\n%s", content)
+	}
+	if entries, err := os.ReadDir(filepath.Join(dir, "cache")); err != nil || len(entries) == 0 {
+		t.Errorf("expected the result cache in cache/, got %v, %v", entries, err)
+	}
+
+	// Flags that set a value win over the file
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Exclude: []string{"fixtures/"}, Strict: false}); !errors.Is(err, internal.ErrUnresolvedMarker) {
+		t.Fatalf("expected strict still on, got %v", err)
+	}
+	if content := readProjectFile(t, dir, "gen/gen.go"); !strings.Contains(content, `var version = "1.0"`) {
+		t.Errorf("expected -exclude to replace the exclude setting:\n%s", content)
+	}
+}
+
+func TestProjectSettingsErrorsNameTheLine(t *testing.T) {
+	for _, tc := range []struct {
+		settings string
+		want     string
+	}{
+		{"strict = \"yes\"", ".goahead.toml:3: strict must be a bool"},
+		{"exclude = \"gen/**\"", ".goahead.toml:3: exclude must be an array of strings"},
+		{"exclude = [\"gen/**\"", ".goahead.toml:3: exclude: invalid array"},
+		{"exclude = [1]", ".goahead.toml:3: exclude: invalid array [1] (expected strings, got 1)"},
+		{"jobs = 4", ".goahead.toml:3: unknown setting jobs"},
+		{"cache-dir = \"a\"\ncache_dir = \"b\"", ".goahead.toml:4: setting cache-dir is defined twice"},
+	} {
+		dir := t.TempDir()
+		writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+		writeFile(t, dir, "main.go", "package main\n")
+		writeFile(t, dir, internal.ProjectFileName, "# settings\n[settings]\n"+tc.settings+"\n")
+		err := internal.RunCodegenWithConfig(internal.Config{Dir: dir})
+		if err == nil || !strings.Contains(err.Error(), tc.want) || internal.ExitCode(err) != internal.ExitEnvironment {
+			t.Errorf("%s: expected an environment error with %q, got %v", tc.settings, tc.want, err)
+		}
+	}
+}
+
+func TestProjectSettingsAcceptUnderscoreKeys(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOAHEAD_CACHE", "off")
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "build/goahead/version.go", "//go:build exclude\n\npackage main\n\nfunc Version() string { return \"1.0\" }\n")
+	writeFile(t, dir, internal.ProjectFileName, `[settings]
+marker_prefix = "//ga:"
+helper_dirs = ["build/goahead"]
+`)
+	writeFile(t, dir, "main.go", "package main\n\n//ga:Version\nvar version = \"\"\n\n//:Version\nvar plain = \"\"\n")
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var version = "1.0"`) || !strings.Contains(content, `var plain = ""`) {
+		t.Errorf("expected the //ga: marker applied from the helper directory:\n%s", content)
+	}
+}
+
+func TestProjectFileRejectsUnknownTopLevelKeys(t *testing.T) {
+	for _, tc := range []struct {
+		file string
+		want string
+	}{
+		{"marker_prefix = \"//ga:\"\n", ".goahead.toml:1: marker_prefix is a setting; move it into the [settings] section"},
+		{"syntax = \"2\"\nprofiles = \"dev\"\n", ".goahead.toml:2: unknown key profiles (known: profile, syntax"},
+	} {
+		dir := t.TempDir()
+		writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+		writeFile(t, dir, "main.go", "package main\n")
+		writeFile(t, dir, internal.ProjectFileName, tc.file)
+		err := internal.RunCodegenWithConfig(internal.Config{Dir: dir})
+		if err == nil || !strings.Contains(err.Error(), tc.want) || internal.ExitCode(err) != internal.ExitEnvironment {
+			t.Errorf("%q: expected an environment error with %q, got %v", tc.file, tc.want, err)
+		}
+	}
+}
+
+func TestInitWritesDefaultProjectFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOAHEAD_CACHE", "off")
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", "//go:build exclude\n//go:ahead functions\n\npackage main\n\nfunc Version() string { return \"1.0\" }\n")
+	writeFile(t, dir, "cmd/main.go", "package main\n\n//:Version\nvar version = \"\"\n")
+
+	path, err := internal.InitProjectFile(filepath.Join(dir, "cmd"), false)
+	if err != nil || path != filepath.Join(dir, internal.ProjectFileName) {
+		t.Fatalf("expected the file at the module root, got %q, %v", path, err)
+	}
+	if _, err := internal.InitProjectFile(dir, false); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected an existing file to be kept, got %v", err)
+	}
+	if _, err := internal.InitProjectFile(dir, true); err != nil {
+		t.Errorf("expected -force to overwrite the file, got %v", err)
+	}
+
+	// Every setting is commented out, so the file changes nothing
+	var stats *internal.RunStats
+	stderr := captureStderr(t, func() {
+		stats, err = internal.RunCodegenWithStats(internal.Config{Dir: dir})
+	})
+	if err != nil || stats.Warnings != 0 {
+		t.Fatalf("expected a clean run with the default file, got %+v, %v\n%s", stats, err, stderr)
+	}
+	if content := readProjectFile(t, dir, "cmd/main.go"); !strings.Contains(content, `var version = "1.0"`) {
+		t.Errorf("expected the marker applied:\n%s", content)
+	}
+}
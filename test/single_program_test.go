@@ -0,0 +1,105 @@
+package test
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// countingGoRunner runs the go command and counts the evaluation programs
+type countingGoRunner struct {
+	mu   sync.Mutex
+	runs int
+}
+
+func (r *countingGoRunner) Run(dir string, env []string, args ...string) (string, string, error) {
+	if len(args) > 0 && args[0] == "run" {
+		r.mu.Lock()
+		r.runs++
+		r.mu.Unlock()
+	}
+	cmd := exec.Command("go", args...)
+	cmd.Dir, cmd.Env = dir, env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+const singleProgramHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Upper(s string) string { return strings.ToUpper(s) }
+
+func Count() int { return 3 }
+
+func Boom() string { panic("boom") }
+`
+
+var singleProgramModule = map[string]string{
+	"helpers.go": singleProgramHelpers,
+	"main.go":    "package main\n\n//:Upper:\"main\"\nvar name = \"\"\n\nfunc main() {}\n",
+	"a.go":       "package main\n\n//:Count\nvar count = 0\n\n//:Upper:\"a\"\nvar a = \"\"\n",
+	"b.go":       "package main\n\n//:Boom\nvar broken = \"\"\n\n//:Upper:\"main\"\nvar again = \"\"\n",
+}
+
+func TestSingleProgramEvaluatesEveryFileAtOnce(t *testing.T) {
+	dir, _ := setupTestDir(t, singleProgramModule)
+	runner := &countingGoRunner{}
+	report, err := runWithReport(t, internal.Config{Dir: dir, SingleProgram: true, Runner: runner})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if runner.runs != 1 {
+		t.Errorf("expected one evaluation program for the directory, got %d", runner.runs)
+	}
+	for file, want := range map[string]string{
+		"main.go": `var name = "MAIN"`,
+		"a.go":    `var a = "A"`,
+		"b.go":    `var again = "MAIN"`,
+	} {
+		if content := readProjectFile(t, dir, file); !strings.Contains(content, want) {
+			t.Errorf("expected %s to hold %q:\n%s", file, want, content)
+		}
+	}
+	if content := readProjectFile(t, dir, "a.go"); !strings.Contains(content, "var count = 3") {
+		t.Errorf("expected the int marker to be replaced:\n%s", content)
+	}
+
+	// The panic only skips its own marker, reported with its helper
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipExecFailed || skip.Suggestion != "helper Boom panicked: boom" || skip.Line != 3 {
+		t.Errorf("unexpected skip: %+v", skip)
+	}
+	if content := readProjectFile(t, dir, "b.go"); !strings.Contains(content, `var broken = ""`) {
+		t.Errorf("expected the panicking marker to keep its literal:\n%s", content)
+	}
+}
+
+func TestSingleProgramMatchesFileByFileRun(t *testing.T) {
+	single, _ := setupTestDir(t, singleProgramModule)
+	perFile, _ := setupTestDir(t, singleProgramModule)
+	if _, err := runWithReport(t, internal.Config{Dir: single, SingleProgram: true}); err != nil {
+		t.Fatalf("single program run failed: %v", err)
+	}
+	runner := &countingGoRunner{}
+	if _, err := runWithReport(t, internal.Config{Dir: perFile, Runner: runner}); err != nil {
+		t.Fatalf("file by file run failed: %v", err)
+	}
+	if runner.runs != 3 {
+		t.Errorf("expected one program per file without -single-program, got %d", runner.runs)
+	}
+	for _, file := range []string{"main.go", "a.go"} {
+		if got, want := readProjectFile(t, single, file), readProjectFile(t, perFile, file); got != want {
+			t.Errorf("%s differs:\n%s\nwant:\n%s", file, got, want)
+		}
+	}
+}
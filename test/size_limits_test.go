@@ -0,0 +1,105 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+var largeValueProject = map[string]string{
+	"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Blob() string { return "head:" + strings.Repeat("x", 2<<20) }
+`,
+	"main.go": `package main
+
+//:Blob
+var blob = ""
+
+func main() { println(len(blob)) }
+`,
+}
+
+func TestOversizedValueIsRejected(t *testing.T) {
+	dir, _ := setupTestDir(t, largeValueProject)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipTooLarge {
+		t.Fatalf("expected a too-large skip, got %+v", skip)
+	}
+	for _, want := range []string{"2097159 bytes", "1048576-byte limit", "-max-literal-size", `starts with "head:xxx`} {
+		if !strings.Contains(skip.Suggestion, want) {
+			t.Errorf("expected %q in %q", want, skip.Suggestion)
+		}
+	}
+	if len(skip.Suggestion) > 400 {
+		t.Errorf("message should only show the start of the value, got %d bytes", len(skip.Suggestion))
+	}
+	if !strings.Contains(readMain(t, dir), `var blob = ""`) {
+		t.Error("placeholder should be left untouched")
+	}
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir, Strict: true}); err == nil {
+		t.Error("strict mode should fail the run")
+	}
+}
+
+func TestMaxLiteralSizeOverride(t *testing.T) {
+	dir, _ := setupTestDir(t, largeValueProject)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir, MaxLiteralSize: 4 << 20})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("expected no skipped markers, got:\n%s", report.Format(dir))
+	}
+	if !strings.Contains(readMain(t, dir), `var blob = "head:xxx`) {
+		t.Error("value under the raised limit should be written")
+	}
+}
+
+func TestOversizedInjectionFails(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Decode(s string) string { return s + s + s }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:inject!:Decode
+
+func main() {}
+`)
+
+	_, err := runWithReport(t, internal.Config{Dir: dir, MaxInjectSize: 16})
+	if err == nil || !strings.Contains(err.Error(), "injected code is too large") || !strings.Contains(err.Error(), "-max-inject-size") {
+		t.Fatalf("expected an injected size error, got %v", err)
+	}
+	if strings.Contains(readMain(t, dir), "func Decode") {
+		t.Error("nothing should be injected")
+	}
+}
+
+func TestSizeLimitsRejectNegativeValues(t *testing.T) {
+	if err := (internal.Config{Dir: ".", MaxLiteralSize: -1}).Validate(); err == nil {
+		t.Error("expected -max-literal-size validation error")
+	}
+	if err := (internal.Config{Dir: ".", MaxInjectSize: -1}).Validate(); err == nil {
+		t.Error("expected -max-inject-size validation error")
+	}
+}
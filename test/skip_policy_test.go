@@ -0,0 +1,148 @@
+package test
+
+import (
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// skipPolicyHelpers is a helper file that holds markers of both kinds; it
+// must never be rewritten
+const skipPolicyHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+//:Shout:"default"
+var fallback = ""
+
+// Greeter is implemented by injection in consumers
+//:inject:Shout
+type Greeter interface {
+	Shout(s string) string
+}
+
+//:inject!:Shout
+
+func Shout(s string) string { return strings.ToUpper(s) + fallback }
+`
+
+func TestHelperFilesNeverRewritten(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	helper := writeFile(t, dir, "helpers.go", skipPolicyHelpers)
+	writeFile(t, dir, "main.go", "package main\n\n//:Shout:\"hi\"\nvar greeting = \"\"\n\nfunc main() { println(greeting) }\n")
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var greeting = "HI"`) {
+		t.Errorf("expected the consumer to be processed:\n%s", content)
+	}
+	if content := readProjectFile(t, dir, "helpers.go"); content != skipPolicyHelpers {
+		t.Errorf("expected the helper file to be left alone:\n%s", content)
+	}
+
+	// Each pass applies the policy by itself, whoever calls it
+	ctx := &internal.ProcessorContext{
+		FunctionsByDir:   make(map[string]map[string]*internal.UserFunction),
+		FunctionsByDepth: make(map[int]map[string]*internal.UserFunction),
+		RootDir:          dir,
+		FileSet:          token.NewFileSet(),
+		TempDir:          t.TempDir(),
+	}
+	fileProcessor := internal.NewFileProcessor(ctx)
+	if _, err := fileProcessor.CollectAllGoFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileProcessor.LoadUserFunctions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := internal.NewInjector(ctx).ProcessFileInjections(helper, false); err != nil {
+		t.Fatalf("ProcessFileInjections failed: %v", err)
+	}
+	if err := internal.NewCodeProcessor(ctx, internal.NewFunctionExecutor(ctx)).ProcessFile(helper, false); err != nil {
+		t.Fatalf("ProcessFile failed: %v", err)
+	}
+	if content := readProjectFile(t, dir, "helpers.go"); content != skipPolicyHelpers {
+		t.Errorf("expected the passes to leave the helper file alone:\n%s", content)
+	}
+}
+
+func TestSkipReason(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	helper := writeFile(t, dir, "helpers.go", skipPolicyHelpers)
+	sink := writeFile(t, dir, "gen/values.go", "// Code generated by goahead; DO NOT EDIT.\n\npackage gen\n")
+	skipped := writeFile(t, dir, "skipped.go", "//go:ahead skip\n\npackage main\n")
+	unlisted := writeFile(t, dir, "more_helpers.go", "//go:build exclude\n//go:ahead functions\n\npackage main\n")
+	traceDir := filepath.Join(dir, "traces")
+	tracer, err := internal.NewTracer(traceDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	constSink, err := internal.NewConstSink(dir, "gen/values.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &internal.ProcessorContext{RootDir: dir, DepthRoot: dir, FuncFiles: []string{helper}, ConstSink: constSink, Tracer: tracer}
+
+	tests := map[string]string{
+		helper:   "helper file",
+		unlisted: "helper file",
+		skipped:  "//go:ahead skip directive",
+		sink:     "-const-sink",
+		filepath.Join(dir, ".main.go.goahead-42"):                       "atomic rewrite",
+		filepath.Join(dir, ".goahead-eval-1", "goahead_eval_1.go"):      "evaluation program",
+		filepath.Join(dir, "pkg", ".goahead-eval-2", "goahead_eval.go"): "evaluation program",
+		filepath.Join(traceDir, "0001", "main.go"):                      "-trace-dir",
+		filepath.Join(dir, "main.go"):                                   "",
+		filepath.Join(dir, "pkg", "goahead-eval.go"):                    "",
+	}
+	for path, want := range tests {
+		got := ctx.SkipReason(path)
+		if want == "" && got != "" || !strings.Contains(got, want) {
+			t.Errorf("SkipReason(%s) = %q, want it to mention %q", path, got, want)
+		}
+	}
+}
+
+func TestSkipDirective(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", skipPolicyHelpers)
+	writeFile(t, dir, "main.go", "package main\n\n//:Shout:\"hi\"\nvar greeting = \"\"\n\nfunc main() { println(greeting, kept) }\n")
+	opted := "// Values kept as written\n//go:ahead skip\n\npackage main\n\n//:Shout:\"x\"\nvar kept = \"\"\n\n//:inject!:Shout\n"
+	writeFile(t, dir, "kept.go", opted)
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var greeting = "HI"`) {
+		t.Errorf("expected the other files to be processed:\n%s", content)
+	}
+	if content := readProjectFile(t, dir, "kept.go"); content != opted {
+		t.Errorf("expected the file with the skip directive to be left alone:\n%s", content)
+	}
+}
+
+func TestLeftoverEvaluationDirectoryNotProcessed(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", skipPolicyHelpers)
+	leftover := "package main\n\n//:Shout:\"x\"\nvar v = \"\"\n"
+	path := writeFile(t, dir, ".goahead-eval-123/goahead_eval_1.go", leftover)
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != leftover {
+		t.Errorf("expected the leftover program to be left alone (%v):\n%s", err, content)
+	}
+}
@@ -0,0 +1,204 @@
+package test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func runWithReport(t *testing.T, config internal.Config) (*internal.SkipReport, error) {
+	t.Helper()
+	var (
+		report *internal.SkipReport
+		err    error
+	)
+	captureStderr(t, func() {
+		report, err = internal.RunCodegenWithReport(config)
+	})
+	return report, err
+}
+
+// singleSkip returns the only skipped marker in report
+func singleSkip(t *testing.T, report *internal.SkipReport) internal.SkippedMarker {
+	t.Helper()
+	markers := report.Markers()
+	if len(markers) != 1 {
+		t.Fatalf("expected one skipped marker, got %+v", markers)
+	}
+	return markers[0]
+}
+
+func TestSkippedMarkerUnexportedHelper(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func secret() string { return "s" }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:secret
+var s = ""
+
+func main() {}
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipUnexported || skip.Line != 3 || skip.Marker != "//:secret" {
+		t.Errorf("unexpected skip: %+v", skip)
+	}
+	if !strings.Contains(skip.Suggestion, "exists at helpers.go but is unexported") || !strings.Contains(skip.Suggestion, "'Secret'") {
+		t.Errorf("unexpected suggestion: %s", skip.Suggestion)
+	}
+}
+
+func TestSkippedMarkerParentModuleHelper(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, filepath.Join("crypto", "helpers.go"), `//go:build exclude
+//go:ahead functions
+
+package crypto
+
+func Key() string { return "k" }
+`)
+	writeFile(t, dir, filepath.Join("tool", "go.mod"), "module tool\ngo 1.22\n")
+	writeFile(t, dir, filepath.Join("tool", "main.go"), `package main
+
+//:Key
+var key = ""
+
+func main() {}
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipSubmoduleIsolation {
+		t.Errorf("expected submodule isolation, got %+v", skip)
+	}
+	if !strings.Contains(skip.Suggestion, "helper exists at ../crypto/helpers.go but is blocked by go.mod boundary") {
+		t.Errorf("unexpected suggestion: %s", skip.Suggestion)
+	}
+	if !strings.HasSuffix(filepath.ToSlash(skip.File), "tool/main.go") {
+		t.Errorf("unexpected file: %s", skip.File)
+	}
+}
+
+func TestSkippedMarkerUnresolvedAndNoTarget(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Name() string { return "n" }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Missing
+var m = ""
+
+func main() {}
+
+//:Name`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	markers := report.Markers()
+	if len(markers) != 2 {
+		t.Fatalf("expected two skipped markers, got %+v", markers)
+	}
+	if markers[0].Reason != internal.SkipUnresolved || !strings.Contains(markers[0].Suggestion, "no helper named 'Missing'") {
+		t.Errorf("unexpected unresolved skip: %+v", markers[0])
+	}
+	if markers[1].Reason != internal.SkipNoTarget || markers[1].Line != 8 {
+		t.Errorf("unexpected no-target skip: %+v", markers[1])
+	}
+
+	table := report.Format(dir)
+	if !strings.Contains(table, "main.go:3") || !strings.Contains(table, "REASON") {
+		t.Errorf("table should list locations with headers, got:\n%s", table)
+	}
+}
+
+func TestSkippedMarkersStrictMode(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Name() string { return "n" }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Missing
+var m = ""
+
+func main() {}
+`)
+
+	_, err := runWithReport(t, internal.Config{Dir: dir, Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "1 marker(s) were skipped (strict mode)") {
+		t.Errorf("expected strict mode error, got %v", err)
+	}
+}
+
+func TestSkippedMarkerInvalidExpressionArgument(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Size(data []byte) int { return len(data) }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Size:=[]byte{0x89, 0x50
+var size = 0
+
+func main() {}
+`)
+
+	var (
+		report *internal.SkipReport
+		err    error
+	)
+	stderr := captureStderr(t, func() {
+		report, err = internal.RunCodegenWithReport(internal.Config{Dir: dir})
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipInvalidArgument || skip.Line != 3 || !strings.Contains(skip.Suggestion, "argument 1 (=[]byte{0x89, 0x50)") {
+		t.Errorf("unexpected skip: %+v", skip)
+	}
+	if !strings.Contains(stderr, "main.go:3: invalid arguments for Size: argument 1") {
+		t.Errorf("warning should point at the marker:\n%s", stderr)
+	}
+	if strings.Contains(stderr, "goahead_eval_") {
+		t.Errorf("no evaluation program should be generated:\n%s", stderr)
+	}
+	if !strings.Contains(readMain(t, dir), "var size = 0") {
+		t.Error("target line should be unchanged")
+	}
+}
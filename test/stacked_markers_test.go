@@ -0,0 +1,130 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const stackedHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Name() string { return "svc" }
+
+func Other() string { return "other" }
+
+func Port() int { return 8080 }
+
+func Enabled() bool { return true }
+`
+
+func TestStackedMarkersOfDifferentKinds(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", stackedHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+func main() {
+	//:Name
+	//:Port
+
+	//:Enabled
+	a, b, c := "", 0, false
+	println(a, b, c)
+}
+`)
+
+	for run := 1; run <= 2; run++ {
+		report, err := runWithReport(t, internal.Config{Dir: dir})
+		if err != nil {
+			t.Fatalf("run %d: RunCodegen failed: %v", run, err)
+		}
+		if report.Len() != 0 {
+			t.Fatalf("run %d: expected no skipped markers, got:\n%s", run, report.Format(dir))
+		}
+		content := readMain(t, dir)
+		if !strings.Contains(content, "\t//:Name\n\t//:Port\n\n\t//:Enabled\n\ta, b, c := \"svc\", 8080, true\n") {
+			t.Fatalf("run %d: expected all three literals replaced, markers kept:\n%s", run, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestStackedMarkersOfTheSameKind(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", stackedHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+type Config struct {
+	Name  string
+	Alias string
+	Port  int
+}
+
+func main() {
+	//:Name
+	//:Port
+	//:Other
+	cfg := Config{Name: "", Alias: "", Port: 0}
+	println(cfg.Name, cfg.Alias, cfg.Port)
+}
+`)
+
+	for run := 1; run <= 2; run++ {
+		report, err := runWithReport(t, internal.Config{Dir: dir})
+		if err != nil {
+			t.Fatalf("run %d: RunCodegen failed: %v", run, err)
+		}
+		if report.Len() != 0 {
+			t.Fatalf("run %d: expected no skipped markers, got:\n%s", run, report.Format(dir))
+		}
+		if content := readMain(t, dir); !strings.Contains(content, `cfg := Config{Name: "svc", Alias: "other", Port: 8080}`) {
+			t.Fatalf("run %d: expected each string marker to fill its own literal:\n%s", run, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestStackedMarkersWithoutEnoughLiterals(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", stackedHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+//:Name
+//:Other
+var name = ""
+
+//:Port
+//:Name
+var port = 0
+
+func main() { println(name, port) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skips := report.Markers()
+	if len(skips) != 2 {
+		t.Fatalf("expected two skipped markers, got:\n%s", report.Format(dir))
+	}
+	// The first string literal goes to Name; none is left for the markers below
+	for i, line := range []int{4, 8} {
+		if skips[i].Line != line || skips[i].Reason != internal.SkipNoLiteral {
+			t.Errorf("expected a no-literal skip for the marker at line %d, got %+v", line, skips[i])
+		}
+	}
+
+	content := readMain(t, dir)
+	for _, want := range []string{`var name = "svc"`, "var port = 8080"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const structElementsMain = `package main
+
+type Target struct {
+	Name string
+	Hash string
+}
+
+var targets = []Target{
+	//:MkTarget:"ntdll"
+	{Name: "", Hash: ""},
+	//:MkTarget:"kernel32"
+	{Name: "", Hash: ""}, // loaded first
+}
+
+func main() { println(targets[0].Name, targets[1].Hash) }
+`
+
+func elementHelpers(suffix string) string {
+	return `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func MkTarget(name string) (string, string) { return name + ".dll", strings.ToUpper(name) + "` + suffix + `" }
+`
+}
+
+func TestStructElementsFilledFieldByField(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", elementHelpers(""))
+	writeFile(t, dir, "main.go", structElementsMain)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("unexpected skipped markers:\n%s", report.Format(dir))
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{
+		"\t{Name: \"ntdll.dll\", Hash: \"NTDLL\"},\n",
+		"\t{Name: \"kernel32.dll\", Hash: \"KERNEL32\"}, // loaded first\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+
+	// A changed helper updates the fields filled by the first run
+	writeFile(t, dir, "helpers.go", elementHelpers("#2"))
+	if report, err := runWithReport(t, internal.Config{Dir: dir}); err != nil || report.Len() != 0 {
+		t.Fatalf("second run failed: %v\n%s", err, report.Format(dir))
+	}
+	updated := readMain(t, dir)
+	want := strings.NewReplacer(`"NTDLL"`, `"NTDLL#2"`, `"KERNEL32"`, `"KERNEL32#2"`).Replace(content)
+	if updated != want {
+		t.Errorf("expected only the hashes to change:\n%s", updated)
+	}
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("third run failed: %v", err)
+	}
+	if again := readMain(t, dir); again != updated {
+		t.Errorf("expected an unchanged helper to leave the file alone:\n%s", again)
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestStructElementsFromStructHelper(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+type Export struct {
+	Name    string
+	Ordinal int
+	Hash    uint32
+}
+
+func Lookup(name string) (*Export, error) {
+	return &Export{Name: name, Ordinal: len(name), Hash: 0x1234}, nil
+}
+`)
+	writeFile(t, dir, "main.go", `package main
+
+type entry struct {
+	Hash uint32
+	Name string
+}
+
+type pair struct {
+	name    string
+	ordinal int
+}
+
+var entries = []entry{
+	//:Lookup:"LoadLibraryA"
+	{Hash: 0, Name: ""},
+}
+
+var pairs = [...]pair{
+	//:Lookup:"Sleep"
+	{"", 0},
+}
+
+func main() { println(entries[0].Name, pairs[0].ordinal) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("unexpected skipped markers:\n%s", report.Format(dir))
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{
+		"\t{Hash: 0x1234, Name: \"LoadLibraryA\"},\n",
+		"\t{\"Sleep\", 5},\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestStructElementFieldCountMismatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", elementHelpers(""))
+	writeFile(t, dir, "main.go", `package main
+
+type Target struct{ Name, Hash, Path string }
+
+var targets = []Target{
+	//:MkTarget:"ntdll"
+	{Name: "", Hash: "", Path: ""},
+}
+
+func main() { println(targets[0].Name) }
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skipped := singleSkip(t, report)
+	if skipped.Reason != internal.SkipOutputMismatch || !strings.Contains(skipped.Suggestion, "returns 2 values but the element has 3 fields") {
+		t.Errorf("expected a field count mismatch, got %+v", skipped)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `{Name: "", Hash: "", Path: ""},`) {
+		t.Errorf("expected the element to be left alone:\n%s", content)
+	}
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const structFieldHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+func ServiceName() string { return "svc" }
+
+func ServicePort() int { return 8080 }
+
+func Debug() bool { return true }
+`
+
+// TestKeyedElementsKeepKeysAndCommas verifies that markers above keyed
+// elements of struct and map literals replace the value only, on every run
+func TestKeyedElementsKeepKeysAndCommas(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", structFieldHelpers)
+	writeFile(t, dir, "main.go", `package main
+
+var fallback = "none"
+
+type DB struct {
+	Host string
+	Port int
+}
+
+type Config struct {
+	Name  string
+	Port  int
+	Debug bool
+	DB    DB
+}
+
+var cfg = Config{
+	//:ServiceName
+	Name: "",
+	//:ServicePort
+	Port: 0, // listen port
+	//:Debug
+	Debug: false,
+	DB: DB{
+		//:ServiceName
+		Host: fallback,
+		//:ServicePort
+		Port: 0,
+	},
+}
+
+var labels = map[string]string{
+	//:ServiceName
+	"service": "",
+}
+
+func main() { println(cfg.Name, cfg.DB.Host, labels["service"]) }
+`)
+
+	want := `var cfg = Config{
+	//:ServiceName
+	Name: "svc",
+	//:ServicePort
+	Port: 8080, // listen port
+	//:Debug
+	Debug: true,
+	DB: DB{
+		//:ServiceName
+		Host: "svc",
+		//:ServicePort
+		Port: 8080,
+	},
+}
+
+var labels = map[string]string{
+	//:ServiceName
+	"service": "svc",
+}
+`
+	for run := 1; run <= 2; run++ {
+		report, err := runWithReport(t, internal.Config{Dir: dir})
+		if err != nil {
+			t.Fatalf("run %d: RunCodegen failed: %v", run, err)
+		}
+		if report.Len() != 0 {
+			t.Fatalf("run %d: expected no skipped markers, got:\n%s", run, report.Format(dir))
+		}
+		if content := readMain(t, dir); !strings.Contains(content, want) {
+			t.Fatalf("run %d: expected the values replaced, keys and commas kept:\n%s", run, content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
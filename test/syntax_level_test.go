@@ -0,0 +1,152 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const syntaxLevelHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Flags(mask int) int { return mask }
+
+func Read(name string) string { return " " + name + "-config " }
+
+func Wrap(s, open, close string) string { return open + s + close }
+
+func Shout(s string) string { return strings.ToUpper(s) }
+`
+
+const syntaxLevelMain = `package main
+
+//:Flags:=1|4
+var flags = 0
+
+func main() { println(flags) }
+`
+
+const syntaxPipelineMain = `package main
+
+//:Read:"app" | strings.TrimSpace | Wrap:"[":"]"
+var name = ""
+
+func main() { println(name) }
+`
+
+// runCollectingWarnings runs codegen on dir and returns the rules of its
+// warnings
+func runCollectingWarnings(t *testing.T, dir string) []string {
+	t.Helper()
+	var rules []string
+	config := internal.Config{Dir: dir, Hooks: &internal.Hooks{
+		Warning: func(d internal.Diagnostic) { rules = append(rules, d.Rule+": "+d.Message) },
+	}}
+	if report, err := runWithReport(t, config); err != nil || report.Len() != 0 {
+		t.Fatalf("RunCodegen failed: %v\n%s", err, report.Format(dir))
+	}
+	return rules
+}
+
+func TestSyntaxLevelOneKeepsPipeInArguments(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, ".goahead.toml", "syntax = \"1\"\n")
+	writeFile(t, dir, "helpers.go", syntaxLevelHelpers)
+	writeFile(t, dir, "main.go", syntaxLevelMain)
+
+	warnings := runCollectingWarnings(t, dir)
+	if content := readMain(t, dir); !strings.Contains(content, "var flags = 5") {
+		t.Errorf("expected the | to stay a Go operator:\n%s", content)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], internal.RuleNewerSyntax+": ") ||
+		!strings.Contains(warnings[0], "declared at .goahead.toml:1") || !strings.Contains(warnings[0], `syntax = "2"`) {
+		t.Errorf("expected one newer-syntax warning with migration notes, got %q", warnings)
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestSyntaxLevelTwoRunsPipelines(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", syntaxLevelHelpers)
+	writeFile(t, dir, "main.go", syntaxPipelineMain)
+
+	if warnings := runCollectingWarnings(t, dir); len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %q", warnings)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var name = "[app-config]"`) {
+		t.Errorf("expected each stage to receive the previous result:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestSyntaxLevelTwoKeepsTargetInArguments(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, ".goahead.toml", "syntax = \"2\"\n")
+	writeFile(t, dir, "helpers.go", syntaxLevelHelpers+"\nconst off = 2\n\nfunc Enabled(on bool) bool { return on }\n")
+	writeFile(t, dir, "main.go", "package main\n\n//:Enabled:=4 > off\nvar enabled = false\n\nfunc main() { println(enabled) }\n")
+
+	warnings := runCollectingWarnings(t, dir)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `reads "> name" as part of the call; syntax 3 makes it a named target`) {
+		t.Errorf("expected one newer-syntax warning for the target, got %q", warnings)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, "var enabled = true") {
+		t.Errorf("expected the > to stay a Go operator:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestSyntaxLevelDefaultsToOneForProcessedTrees(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", syntaxLevelHelpers)
+	writeFile(t, dir, "main.go", syntaxLevelMain)
+	// Code injected by an earlier run marks the tree as written for level 1
+	writeFile(t, dir, "shout.go", "package main\n\n//:inject!:Shout\n\nfunc hello() string { return Shout(\"hi\") }\n")
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content := readProjectFile(t, dir, "shout.go"); !strings.Contains(content, "Code generated by goahead") {
+		t.Fatalf("expected injected code:\n%s", content)
+	}
+	writeFile(t, dir, "main.go", syntaxLevelMain)
+
+	warnings := runCollectingWarnings(t, dir)
+	if content := readMain(t, dir); !strings.Contains(content, "var flags = 5") {
+		t.Errorf("expected the processed tree to keep level 1:\n%s", content)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "earlier goahead") {
+		t.Errorf("expected a newer-syntax warning naming the default, got %q", warnings)
+	}
+
+	// Declaring the level in a root helper opts the tree in
+	writeFile(t, dir, "helpers.go", strings.Replace(syntaxLevelHelpers, "//go:ahead functions\n", "//go:ahead functions\n//go:ahead syntax 2\n", 1))
+	writeFile(t, dir, "main.go", syntaxPipelineMain)
+	if warnings := runCollectingWarnings(t, dir); len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %q", warnings)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var name = "[app-config]"`) {
+		t.Errorf("expected the declared level to enable pipelines:\n%s", content)
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestSyntaxLevelConflictingDeclarations(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, ".goahead.toml", "syntax = \"1\"\n")
+	writeFile(t, dir, "helpers.go", strings.Replace(syntaxLevelHelpers, "//go:ahead functions\n", "//go:ahead functions\n//go:ahead syntax 2\n", 1))
+	writeFile(t, dir, "main.go", syntaxLevelMain)
+
+	err := internal.RunCodegen(dir, false)
+	if err == nil || !strings.Contains(err.Error(), "syntax 1 conflicts with syntax 2 declared at helpers.go:3") {
+		t.Errorf("expected a conflict error, got %v", err)
+	}
+}
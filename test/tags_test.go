@@ -0,0 +1,143 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const tagHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Shadow(s string) string { return strings.ToUpper(s) }
+
+func Port(base int) int { return base + 1 }
+`
+
+const tagMain = `package main
+
+//:Shadow:"ntdll"
+var dll = "" // loaded lazily
+
+//:Port:8080
+var port = 0
+
+func main() { println(dll, port) }
+`
+
+var tagProject = map[string]string{
+	"helpers.go": tagHelpers,
+	"main.go":    tagMain,
+}
+
+func runTagged(t *testing.T, cfg internal.Config) string {
+	t.Helper()
+	report, err := runWithReport(t, cfg)
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("expected no skipped markers, got:\n%s", report.Format(cfg.Dir))
+	}
+	return readMain(t, cfg.Dir)
+}
+
+func TestTagReplacementsAreAddedOnce(t *testing.T) {
+	dir, _ := setupTestDir(t, tagProject)
+	wants := []string{
+		`var dll = "NTDLL" // loaded lazily //g:Shadow("ntdll")@` + internal.Version + "\n",
+		`var port = 8081 //g:Port(8080)@` + internal.Version + "\n",
+	}
+	var first string
+	for run := 1; run <= 2; run++ {
+		content := runTagged(t, internal.Config{Dir: dir, TagReplacements: true})
+		for _, want := range wants {
+			if !strings.Contains(content, want) {
+				t.Errorf("run %d: expected %q in:\n%s", run, want, content)
+			}
+		}
+		if run == 1 {
+			first = content
+		} else if content != first {
+			t.Errorf("re-run changed the file:\n%s", content)
+		}
+	}
+	verifyCompiles(t, dir)
+}
+
+func TestTagReplacementsFollowHelperChanges(t *testing.T) {
+	dir, _ := setupTestDir(t, tagProject)
+	runTagged(t, internal.Config{Dir: dir, TagReplacements: true})
+
+	writeFile(t, dir, "helpers.go", strings.Replace(tagHelpers, "strings.ToUpper(s)", `"x" + strings.ToLower(s)`, 1))
+	writeFile(t, dir, "main.go", strings.Replace(readMain(t, dir), `//:Shadow:"ntdll"`, `//:Shadow:"kernel32"`, 1))
+	content := runTagged(t, internal.Config{Dir: dir, TagReplacements: true})
+	for _, want := range []string{
+		`var dll = "xkernel32" // loaded lazily //g:Shadow("kernel32")@` + internal.Version + "\n",
+		`var port = 8081 //g:Port(8080)@` + internal.Version + "\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "ntdll") {
+		t.Errorf("the previous tag must be replaced:\n%s", content)
+	}
+
+	// Turning the flag off removes the tags
+	content = runTagged(t, internal.Config{Dir: dir})
+	if strings.Contains(content, "//g:") || !strings.Contains(content, `var dll = "xkernel32" // loaded lazily`+"\n") {
+		t.Errorf("expected the tags to be removed:\n%s", content)
+	}
+
+	// A custom template is recognized on later runs like the default one
+	for run := 1; run <= 2; run++ {
+		content = runTagged(t, internal.Config{Dir: dir, TagReplacements: true, TagFormat: "//gen:{helper}({args})"})
+		if want := "var port = 8081 //gen:Port(8080)\n"; strings.Count(content, "//gen:") != 2 || !strings.Contains(content, want) {
+			t.Errorf("run %d: expected %q and two tags in:\n%s", run, want, content)
+		}
+	}
+}
+
+func TestTagReplacementsAbsentWithoutFlag(t *testing.T) {
+	dir, _ := setupTestDir(t, tagProject)
+	content := runTagged(t, internal.Config{Dir: dir})
+	if strings.Contains(content, "//g:") {
+		t.Errorf("expected no tags without -tag-replacements:\n%s", content)
+	}
+	if !strings.Contains(content, `var dll = "NTDLL" // loaded lazily`+"\n") {
+		t.Errorf("expected the marker to fire:\n%s", content)
+	}
+}
+
+func TestRedactHidesArgumentsAndValues(t *testing.T) {
+	dir, _ := setupTestDir(t, tagProject)
+	var err error
+	stderr := captureStderr(t, func() {
+		_, err = internal.RunCodegenWithReport(internal.Config{Dir: dir, TagReplacements: true, Redact: true})
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	if want := `var dll = "NTDLL" // loaded lazily //g:Shadow(<redacted>)@` + internal.Version; !strings.Contains(content, want) {
+		t.Errorf("expected %q in:\n%s", want, content)
+	}
+	if !strings.Contains(stderr, "Shadow(<redacted>) -> <redacted>") {
+		t.Errorf("expected a redacted progress line in:\n%s", stderr)
+	}
+	for _, secret := range []string{"ntdll", "NTDLL", "8080", "8081"} {
+		if strings.Contains(stderr, secret) {
+			t.Errorf("stderr must not contain %q:\n%s", secret, stderr)
+		}
+	}
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir, TagReplacements: true, TagFormat: "g:{call}"}); err == nil || !strings.Contains(err.Error(), "invalid -tag-format") {
+		t.Errorf("expected an error for a template that is not a comment, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -10,7 +11,7 @@ import (
 )
 
 // writeFile is a helper function for creating test files
-func writeFile(t *testing.T, dir, rel, content string) string {
+func writeFile(t testing.TB, dir, rel, content string) string {
 	t.Helper()
 	path := filepath.Join(dir, rel)
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
@@ -22,32 +23,36 @@ func writeFile(t *testing.T, dir, rel, content string) string {
 	return path
 }
 
-// setupTestDir creates a temporary directory with the specified files
-// Returns the directory path and a cleanup function
-func setupTestDir(t *testing.T, files map[string]string) (string, func()) {
+// readMain returns the content of main.go in dir
+func readMain(t *testing.T, dir string) string {
 	t.Helper()
-	dir, err := os.MkdirTemp("", "goahead_test_*")
+	content, err := os.ReadFile(filepath.Join(dir, "main.go"))
 	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
+		t.Fatalf("read main.go: %v", err)
+	}
+	return string(content)
+}
+
+// setupTestDir creates a temporary directory with the specified files, which
+// may be in subdirectories and may replace the default go.mod.
+// Returns the directory path and a cleanup function; the directory is
+// removed when the test ends either way.
+func setupTestDir(t *testing.T, files map[string]string) (string, func()) {
+	t.Helper()
+	dir := t.TempDir()
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
 	}
 
 	// Create go.mod
 	modContent := "module testmodule\ngo 1.21\n"
 	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(modContent), 0o644); err != nil {
-		_ = os.RemoveAll(dir)
 		t.Fatalf("Failed to create go.mod: %v", err)
 	}
 
 	// Create test files
 	for name, content := range files {
-		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
-			_ = os.RemoveAll(dir)
-			t.Fatalf("Failed to create %s: %v", name, err)
-		}
-	}
-
-	cleanup := func() {
-		_ = os.RemoveAll(dir)
+		writeFile(t, dir, name, content)
 	}
 
 	return dir, cleanup
@@ -121,3 +126,20 @@ func verifyCompiles(t *testing.T, input string) {
 		t.Fatalf("Generated code does not compile:\n%s\nError: %v", string(output), err)
 	}
 }
+
+// evalOutput is the stdout of an evaluation program returning the strings
+// values, for runners that answer without invoking the go command
+func evalOutput(values ...string) string {
+	type result struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	results := make([]result, len(values))
+	for i, value := range values {
+		results[i] = result{Type: "string", Value: value}
+	}
+	data, _ := json.Marshal(struct {
+		Results []result `json:"results"`
+	}{results})
+	return "\n" + EvalResultPrefix + string(data) + "\n"
+}
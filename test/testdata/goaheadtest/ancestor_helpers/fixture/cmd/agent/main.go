@@ -0,0 +1,9 @@
+package main
+
+//:Greeting
+var greeting = ""
+
+//:Banner
+var banner = ""
+
+func main() { println(greeting, banner) }
@@ -0,0 +1,9 @@
+package main
+
+//:Greeting
+var greeting = "from root"
+
+//:Banner
+var banner = "from cmd"
+
+func main() { println(greeting, banner) }
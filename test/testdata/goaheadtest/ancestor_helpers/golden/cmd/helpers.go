@@ -0,0 +1,6 @@
+//go:build exclude
+//go:ahead functions
+
+package main
+
+func Banner() string { return "from cmd" }
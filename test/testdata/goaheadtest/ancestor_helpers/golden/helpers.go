@@ -0,0 +1,6 @@
+//go:build exclude
+//go:ahead functions
+
+package main
+
+func Greeting() string { return "from root" }
@@ -0,0 +1,15 @@
+package main
+
+//:Keys
+var keys = []string{}
+
+//:Ports
+var ports = map[string]int{}
+
+// A struct result feeding variables by field stays supported
+//:Config -> accept=Accept
+var (
+	accept = ""
+)
+
+func main() { println(keys, ports, accept) }
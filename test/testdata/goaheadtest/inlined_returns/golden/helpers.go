@@ -0,0 +1,12 @@
+//go:build exclude
+//go:ahead functions
+
+package main
+
+type Headers struct{ Accept string }
+
+func Keys() []string { return []string{"a", "b"} }
+
+func Ports() map[string]int { return map[string]int{"http": 80} }
+
+func Config() *Headers { return &Headers{Accept: "xml"} }
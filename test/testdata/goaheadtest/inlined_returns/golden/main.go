@@ -0,0 +1,15 @@
+package main
+
+//:Keys
+var keys = []string{"a", "b"}
+
+//:Ports
+var ports = map[string]int{"http": 80}
+
+// A struct result feeding variables by field stays supported
+//:Config -> accept=Accept
+var (
+	accept = "xml"
+)
+
+func main() { println(keys, ports, accept) }
@@ -0,0 +1,134 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestToolexecCompilesProcessedCopies(t *testing.T) {
+	isolateTrust(t, "1")
+	dir, _ := setupTestDir(t, summaryProject)
+	chdir(t, dir)
+	t.Setenv("GOAHEAD_CACHE", "off")
+	mainBefore, otherBefore := readMain(t, dir), readProjectFile(t, dir, "other.go")
+
+	args := append([]string{"-o", "/work/b001/_pkg_.a", "-trimpath", "/work/b001=>;" + dir + "=>testmod", "-p", "main"}, summaryGoFiles...)
+	rewritten, cleanup, err := internal.NewToolexecManager().ProcessPackageCopy(args)
+	if err != nil {
+		t.Fatalf("ProcessPackageCopy failed: %v", err)
+	}
+	if readMain(t, dir) != mainBefore || readProjectFile(t, dir, "other.go") != otherBefore {
+		t.Fatal("expected the sources unchanged")
+	}
+
+	var copies []string
+	var trimpath string
+	for i, arg := range rewritten {
+		if strings.HasSuffix(arg, ".go") {
+			copies = append(copies, arg)
+		}
+		if arg == "-trimpath" {
+			trimpath = rewritten[i+1]
+		}
+	}
+	if len(copies) != 2 || filepath.Base(copies[0]) != "main.go" || filepath.Base(copies[1]) != "other.go" {
+		t.Fatalf("expected main.go and other.go swapped for copies, got %v", rewritten)
+	}
+	copyDir := filepath.Dir(copies[0])
+	if copyDir == dir {
+		t.Fatalf("expected copies outside the sources, got %v", copies)
+	}
+	if want := copyDir + "=>testmod;/work/b001=>;" + dir + "=>testmod"; trimpath != want {
+		t.Errorf("expected -trimpath %q, got %q", want, trimpath)
+	}
+	mainCopy, err := os.ReadFile(copies[0])
+	if err != nil {
+		t.Fatalf("read copy: %v", err)
+	}
+	otherCopy, err := os.ReadFile(copies[1])
+	if err != nil {
+		t.Fatalf("read copy: %v", err)
+	}
+	if !strings.Contains(string(mainCopy), `var greeting = "hello"`) || !strings.Contains(string(mainCopy), "var answer = 42") {
+		t.Errorf("expected the values in the copy of main.go:\n%s", mainCopy)
+	}
+	if !strings.Contains(string(otherCopy), "func Decode(") {
+		t.Errorf("expected Decode injected into the copy of other.go:\n%s", otherCopy)
+	}
+
+	cleanup()
+	if _, err := os.Stat(copyDir); !os.IsNotExist(err) {
+		t.Errorf("expected the copies removed, got %v", err)
+	}
+}
+
+func TestToolexecBuildLeavesSourcesUntouched(t *testing.T) {
+	exe := buildGoahead(t)
+	isolateTrust(t, "1")
+	dir, _ := setupTestDir(t, summaryProject)
+	t.Setenv("GOAHEAD_CACHE", "off")
+	mainBefore := readMain(t, dir)
+
+	build := func(env ...string) string {
+		t.Helper()
+		app := filepath.Join(t.TempDir(), "app")
+		cmd := exec.Command("go", "build", "-a", "-toolexec", exe, "-o", app, ".")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), env...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go build failed: %v\n%s", err, output)
+		}
+		output, err := exec.Command(app).CombinedOutput()
+		if err != nil {
+			t.Fatalf("app failed: %v\n%s", err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	if got := build(); got != "hello 42 hello x" {
+		t.Errorf("expected the generated values at run time, got %q", got)
+	}
+	if content := readMain(t, dir); content != mainBefore {
+		t.Fatalf("expected main.go unchanged:\n%s", content)
+	}
+
+	if got := build(internal.InPlaceEnv + "=1"); got != "hello 42 hello x" {
+		t.Errorf("expected the generated values at run time, got %q", got)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var greeting = "hello"`) {
+		t.Errorf("expected %s=1 to rewrite main.go:\n%s", internal.InPlaceEnv, content)
+	}
+}
+
+func TestToolexecCompilesSourcesOfUntrustedRootPackage(t *testing.T) {
+	exe := buildGoahead(t)
+	isolateTrust(t, "")
+	dir, _ := setupTestDir(t, trustProject)
+	chdir(t, dir)
+	t.Setenv("GOAHEAD_CACHE", "off")
+
+	args := []string{"-o", "/work/b001/_pkg_.a", "-p", "main", "./main.go"}
+	rewritten, cleanup, err := internal.NewToolexecManager().ProcessPackageCopy(args)
+	if err != nil {
+		t.Fatalf("ProcessPackageCopy failed: %v", err)
+	}
+	cleanup()
+	if strings.Join(rewritten, " ") != strings.Join(args, " ") {
+		t.Fatalf("expected the original sources compiled, got %v", rewritten)
+	}
+
+	app := filepath.Join(t.TempDir(), "app")
+	cmd := exec.Command("go", "build", "-a", "-toolexec", exe, "-o", app, ".")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, output)
+	}
+	if output, err := exec.Command(app).CombinedOutput(); err != nil || strings.TrimSpace(string(output)) != "" {
+		t.Errorf("expected the unprocessed value at run time, got %q (%v)", output, err)
+	}
+}
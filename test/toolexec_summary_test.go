@@ -0,0 +1,112 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+var summaryPattern = regexp.MustCompile(`\[goahead\] pkg=(\S+) files=(\d+) markers=(\d+) replaced=(\d+) injected=(\d+) cache=(\d+)/(\d+) dur=\S+`)
+
+var summaryProject = map[string]string{
+	"go.mod": "module testmod\ngo 1.22\n",
+	"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Greeting() string { return "hello" }
+func Answer() int      { return 42 }
+func Decode(s string) string { return s }
+`,
+	"main.go": `package main
+
+//:Greeting
+var greeting = ""
+
+//:Answer
+var answer = 0
+
+func main() { println(greeting, answer, other, Decode("x")) }
+`,
+	"other.go": `package main
+
+//:Greeting
+var other = ""
+
+//:inject!:Decode
+`,
+}
+
+// summaryGoFiles are the files of summaryProject as the go command passes
+// them to the compiler
+var summaryGoFiles = []string{"./main.go", "./other.go"}
+
+// chdir enters dir like the go command does before running the compiler
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+}
+
+func TestToolexecSummaryLine(t *testing.T) {
+	isolateTrust(t, "1")
+	dir, _ := setupTestDir(t, summaryProject)
+	chdir(t, dir)
+	t.Setenv("GOAHEAD_VERBOSE", "replace")
+
+	output := captureStderr(t, func() {
+		internal.NewToolexecManager().ProcessPackage(summaryGoFiles, "")
+	})
+
+	m := summaryPattern.FindStringSubmatch(output)
+	if m == nil {
+		t.Fatalf("expected a summary line, got:\n%s", output)
+	}
+	if filepath.Clean(m[1]) != filepath.Clean(dir) {
+		t.Errorf("expected pkg=%s, got pkg=%s", dir, m[1])
+	}
+	want := map[string]string{
+		"files":    "2",
+		"markers":  "3",
+		"replaced": "3",
+		"injected": "1",
+		"cache":    "1/3",
+	}
+	got := map[string]string{
+		"files":    m[2],
+		"markers":  m[3],
+		"replaced": m[4],
+		"injected": m[5],
+		"cache":    m[6] + "/" + m[7],
+	}
+	for field, value := range want {
+		if got[field] != value {
+			t.Errorf("expected %s=%s, got %s=%s\n%s", field, value, field, got[field], output)
+		}
+	}
+}
+
+func TestToolexecSummaryQuietWithoutVerbose(t *testing.T) {
+	isolateTrust(t, "1")
+	dir, _ := setupTestDir(t, summaryProject)
+	chdir(t, dir)
+	t.Setenv("GOAHEAD_VERBOSE", "")
+
+	output := captureStderr(t, func() {
+		internal.NewToolexecManager().ProcessPackage(summaryGoFiles, "")
+	})
+	if strings.Contains(output, "pkg=") {
+		t.Errorf("summary line must only be printed in verbose mode, got:\n%s", output)
+	}
+}
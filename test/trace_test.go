@@ -0,0 +1,194 @@
+package test
+
+import (
+	"encoding/json"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// recordingRunner answers every evaluation with one string and remembers
+// the programs it was given
+type recordingRunner struct {
+	mu       sync.Mutex
+	programs []string
+}
+
+func (r *recordingRunner) Run(dir string, env []string, args ...string) (string, string, error) {
+	if len(args) > 0 && args[0] == "list" {
+		return "fmt\nstrings\n", "", nil
+	}
+	program, err := os.ReadFile(args[len(args)-1])
+	if err != nil {
+		return "", "", err
+	}
+	r.mu.Lock()
+	r.programs = append(r.programs, string(program))
+	r.mu.Unlock()
+	return evalOutput("hi"), "note on stderr\n", nil
+}
+
+func TestTraceDirSavesEvaluationPrograms(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Greeting(name string) string { return "hi " + name }
+`)
+	traceDir := filepath.Join(t.TempDir(), "trace")
+	tracer, err := internal.NewTracer(traceDir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &internal.ProcessorContext{
+		FunctionsByDir:   make(map[string]map[string]*internal.UserFunction),
+		FunctionsByDepth: make(map[int]map[string]*internal.UserFunction),
+		RootDir:          dir,
+		FileSet:          token.NewFileSet(),
+		TempDir:          t.TempDir(),
+		Tracer:           tracer,
+	}
+	fileProcessor := internal.NewFileProcessor(ctx)
+	if _, err := fileProcessor.CollectAllGoFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileProcessor.LoadUserFunctions(); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &recordingRunner{}
+	executor := internal.NewFunctionExecutorWithRunner(ctx, runner)
+	results := executor.ExecuteBatch([]internal.BatchCall{
+		{FuncName: "Greeting", ArgsStr: `"gopher"`, Location: "main.go:3"},
+	}, dir)
+	if results[0].Err != nil {
+		t.Fatal(results[0].Err)
+	}
+	if results[0].TraceID != "0001" {
+		t.Fatalf("expected trace ID 0001, got %q", results[0].TraceID)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(traceDir, "0001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	if want := "program.go program.raw.go stderr.txt stdout.txt trace.json"; strings.Join(names, " ") != want {
+		t.Errorf("trace files = %v, want %s", names, want)
+	}
+	if _, err := os.Stat(filepath.Join(traceDir, "go.mod")); err != nil {
+		t.Errorf("trace directory should be its own module: %v", err)
+	}
+
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(traceDir, "0001", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if len(runner.programs) != 1 || read("program.go") != runner.programs[0] {
+		t.Errorf("saved program differs from the program that was run:\n%s", read("program.go"))
+	}
+	if !strings.Contains(read("program.raw.go"), `Greeting("gopher")`) {
+		t.Errorf("unformatted program missing the call:\n%s", read("program.raw.go"))
+	}
+	if read("stdout.txt") != evalOutput("hi") || read("stderr.txt") != "note on stderr\n" {
+		t.Errorf("unexpected captured output: %q / %q", read("stdout.txt"), read("stderr.txt"))
+	}
+
+	var entry internal.TraceEntry
+	if err := json.Unmarshal([]byte(read("trace.json")), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.ID != "0001" || len(entry.Markers) != 1 || entry.Markers[0] != "main.go:3" ||
+		entry.Dir != dir || len(entry.Command) < 2 || entry.Command[0] != "go" || entry.Command[1] != "run" {
+		t.Errorf("unexpected trace.json: %+v", entry)
+	}
+	hasRoot := false
+	for _, kv := range entry.Env {
+		hasRoot = hasRoot || kv == internal.ProjectRootEnv+"="+dir
+	}
+	if !hasRoot {
+		t.Errorf("trace.json env lacks %s", internal.ProjectRootEnv)
+	}
+}
+
+func TestTraceDirLimitAndAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Name() string { return "app" }
+`)
+	target := func(pkg string) string {
+		return "package " + pkg + "\n\n//:Name\nvar name = \"\"\n"
+	}
+	writeFile(t, dir, "a/a.go", target("a"))
+	writeFile(t, dir, "b/b.go", target("b"))
+	traceDir := filepath.Join(dir, "goahead-trace")
+	annotations := filepath.Join(dir, "goahead.map.json")
+
+	var err error
+	stderr := captureStderr(t, func() {
+		_, err = internal.RunCodegenWithReport(internal.Config{Dir: dir, TraceDir: traceDir, TraceLimit: 1, Annotations: annotations})
+	})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if !strings.Contains(stderr, "trace limit reached: 1 programs saved") || strings.Count(stderr, "trace limit reached") != 1 {
+		t.Errorf("expected one trace limit warning:\n%s", stderr)
+	}
+	if _, err := os.Stat(filepath.Join(traceDir, "0002")); !os.IsNotExist(err) {
+		t.Errorf("only one program should be traced: %v", err)
+	}
+
+	data, err := os.ReadFile(annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file internal.AnnotationFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	traced := 0
+	for key, entry := range file.Entries {
+		if entry.Trace != "" {
+			traced++
+			if entry.Trace != "0001" {
+				t.Errorf("%s: unexpected trace ID %q", key, entry.Trace)
+			}
+		}
+	}
+	if len(file.Entries) != 2 || traced != 1 {
+		t.Errorf("expected two annotations, one traced: %+v", file.Entries)
+	}
+
+	// A second run keeps the earlier trace and continues the numbering,
+	// and the saved programs are never processed as sources
+	writeFile(t, dir, "a/a.go", target("a"))
+	if _, err := runWithReport(t, internal.Config{Dir: dir, TraceDir: traceDir, TraceLimit: 1}); err != nil {
+		t.Fatalf("second RunCodegen failed: %v", err)
+	}
+	for _, id := range []string{"0001", "0002"} {
+		if _, err := os.Stat(filepath.Join(traceDir, id, "program.go")); err != nil {
+			t.Errorf("trace %s missing: %v", id, err)
+		}
+	}
+}
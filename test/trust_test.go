@@ -0,0 +1,127 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// isolateTrust points the trust file at an empty temporary config directory
+// and sets TrustAllEnv to trustAll
+func isolateTrust(t *testing.T, trustAll string) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(internal.TrustAllEnv, trustAll)
+}
+
+// trustProject is a module with one helper marker
+var trustProject = map[string]string{
+	"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Greeting() string { return "hello" }
+`,
+	"main.go": `package main
+
+//:Greeting
+var s = ""
+
+func main() { println(s) }
+`,
+}
+
+func runToolexecCodegen(t *testing.T, dir string) string {
+	t.Helper()
+	return captureStderr(t, func() {
+		if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, RequireTrust: true}); err != nil {
+			t.Fatalf("RunCodegen failed: %v", err)
+		}
+	})
+}
+
+func TestUntrustedModuleSkipsHelpers(t *testing.T) {
+	isolateTrust(t, "")
+	dir, _ := setupTestDir(t, trustProject)
+
+	stderr := runToolexecCodegen(t, dir)
+	if !strings.Contains(stderr, "helper execution disabled for untrusted module") ||
+		!strings.Contains(stderr, "goahead trust add "+dir) {
+		t.Errorf("expected untrusted warning, got:\n%s", stderr)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var s = ""`) {
+		t.Errorf("untrusted module must not be processed:\n%s", content)
+	}
+
+	// A second compile in the same go command does not repeat the warning
+	if stderr := runToolexecCodegen(t, dir); strings.Contains(stderr, "untrusted module") {
+		t.Errorf("warning repeated:\n%s", stderr)
+	}
+}
+
+func TestTrustFileAllowsHelpers(t *testing.T) {
+	isolateTrust(t, "")
+	dir, _ := setupTestDir(t, trustProject)
+
+	added, err := internal.AddTrustedDir(dir)
+	if err != nil || !added {
+		t.Fatalf("AddTrustedDir = %v, %v", added, err)
+	}
+	if added, _ := internal.AddTrustedDir(dir); added {
+		t.Error("adding a trusted directory twice should be a no-op")
+	}
+	path, err := internal.TrustFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), dir) {
+		t.Fatalf("trust file %s does not list %s: %q, %v", path, dir, data, err)
+	}
+
+	// Trust covers nested packages of the trusted root
+	if !internal.IsTrusted(filepath.Join(dir, "sub", "pkg")) {
+		t.Error("subdirectory of a trusted root should be trusted")
+	}
+	if internal.IsTrusted(dir + "-other") {
+		t.Error("sibling with a common prefix must not be trusted")
+	}
+
+	runToolexecCodegen(t, dir)
+	if content := readMain(t, dir); !strings.Contains(content, `var s = "hello"`) {
+		t.Errorf("trusted module was not processed:\n%s", content)
+	}
+
+	removed, err := internal.RemoveTrustedDir(dir)
+	if err != nil || !removed || internal.IsTrusted(dir) {
+		t.Errorf("RemoveTrustedDir = %v, %v; still trusted: %v", removed, err, internal.IsTrusted(dir))
+	}
+}
+
+func TestTrustAllEnvOverride(t *testing.T) {
+	isolateTrust(t, "")
+	dir, _ := setupTestDir(t, trustProject)
+	t.Setenv(internal.TrustAllEnv, "1")
+
+	if stderr := runToolexecCodegen(t, dir); strings.Contains(stderr, "untrusted module") {
+		t.Errorf("unexpected warning with %s=1:\n%s", internal.TrustAllEnv, stderr)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var s = "hello"`) {
+		t.Errorf("module was not processed with %s=1:\n%s", internal.TrustAllEnv, content)
+	}
+}
+
+func TestExplicitDirIsImplicitlyTrusted(t *testing.T) {
+	isolateTrust(t, "")
+	dir, _ := setupTestDir(t, trustProject)
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var s = "hello"`) {
+		t.Errorf("standalone run should not require trust:\n%s", content)
+	}
+}
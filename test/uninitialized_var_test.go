@@ -0,0 +1,135 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func writeTimeoutHelpers(t *testing.T, dir, timeout, name, enabled string) {
+	t.Helper()
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+func GetTimeout() int { return `+timeout+` }
+func GetName() string { return "`+name+`" }
+func IsEnabled() bool { return `+enabled+` }
+func GetRetries() int64 { return 3 }
+`)
+}
+
+func TestUninitializedVarDeclarations(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeTimeoutHelpers(t, dir, "30", "svc", "true")
+	writeFile(t, dir, "main.go", `package main
+
+import "fmt"
+
+//:GetTimeout
+var timeout int
+
+//:GetName
+var name string // service name
+
+//:GetRetries
+var retries int64
+
+var (
+	//:GetTimeout
+	blockTimeout int
+	//:GetName
+	blockName    string
+	//:IsEnabled
+	blockEnabled bool
+)
+
+func main() {
+	//:IsEnabled
+	var enabled bool
+	fmt.Println(timeout, name, retries, blockTimeout, blockName, blockEnabled, enabled)
+}
+`)
+
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+	first := readMain(t, dir)
+	for _, want := range []string{
+		"var timeout = 30\n",
+		`var name = "svc" // service name`,
+		"var retries int64 = 3\n",
+		"\tblockTimeout int = 30\n",
+		"\tblockName    string = \"svc\"\n",
+		"\tblockEnabled bool = true\n",
+		"\tvar enabled = true\n",
+	} {
+		if !strings.Contains(first, want) {
+			t.Errorf("first run missing %q\n---- got ----\n%s", want, first)
+		}
+	}
+	verifyCompiles(t, first)
+
+	writeTimeoutHelpers(t, dir, "45", "api", "false")
+	if err := internal.RunCodegen(dir, false); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+	second := readMain(t, dir)
+	for _, want := range []string{
+		"var timeout = 45\n",
+		`var name = "api" // service name`,
+		"\tblockTimeout int = 45\n",
+		"\tblockName    string = \"api\"\n",
+		"\tblockEnabled bool = false\n",
+		"\tvar enabled = false\n",
+	} {
+		if !strings.Contains(second, want) {
+			t.Errorf("second run missing %q\n---- got ----\n%s", want, second)
+		}
+	}
+	verifyCompiles(t, second)
+}
+
+func TestUninitializedDeclarationOfSeveralNames(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeTimeoutHelpers(t, dir, "30", "svc", "true")
+	source := `package main
+
+//:GetName
+var x, y string
+
+var (
+	//:GetName
+	first, last string
+)
+
+func main() { println(x, y, first, last) }
+`
+	writeFile(t, dir, "main.go", source)
+
+	stderr := captureStderr(t, func() {
+		report, err := internal.RunCodegenWithReport(internal.Config{Dir: dir})
+		if err != nil {
+			t.Fatalf("RunCodegen failed: %v", err)
+		}
+		markers := report.Markers()
+		if len(markers) != 2 {
+			t.Fatalf("expected both markers to be skipped, got %+v", markers)
+		}
+		for _, skipped := range markers {
+			if skipped.Reason != internal.SkipNoTarget || !strings.Contains(skipped.Suggestion, "declares 2 variables without a value") {
+				t.Errorf("unexpected skip: %+v", skipped)
+			}
+		}
+	})
+	if !strings.Contains(stderr, "main.go:3: x, y declares 2 variables") {
+		t.Errorf("expected a warning naming the marker line, got:\n%s", stderr)
+	}
+	if content := readMain(t, dir); content != source {
+		t.Errorf("expected the file to be left alone:\n%s", content)
+	}
+}
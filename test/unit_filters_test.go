@@ -1,7 +1,9 @@
 package test
 
 import (
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	internal "github.com/AeonDave/goahead/internal"
@@ -54,3 +56,78 @@ func TestFilterUserFilesVerbose(t *testing.T) {
 		t.Fatalf("expected vendor file to be skipped, got %v", got)
 	}
 }
+
+func TestFilterUserFilesConservativeWithoutGoEnv(t *testing.T) {
+	moduleDir := t.TempDir()
+	writeFile(t, moduleDir, "go.mod", "module testmod\ngo 1.22\n")
+
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	if err := os.Chdir(moduleDir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+
+	// No GOROOT/GOPATH, no home directory and no go binary on PATH
+	t.Setenv("GOAHEAD_VERBOSE", "filter")
+	t.Setenv("GOROOT", "")
+	t.Setenv("GOPATH", "")
+	t.Setenv("HOME", "")
+	t.Setenv("PATH", t.TempDir())
+
+	cacheFile := filepath.Join(filepath.FromSlash("/opt/cache/gomod/github.com/acme/lib@v1.0.0"), "test", "lib_test.go")
+	inside := filepath.Join(moduleDir, "pkg", "handler.go")
+
+	var got []string
+	output := captureStderr(t, func() {
+		got = internal.FilterUserFiles([]string{cacheFile, inside, "main.go"})
+	})
+
+	if len(got) != 2 || got[0] != inside || got[1] != "main.go" {
+		t.Fatalf("expected only module files, got %v", got)
+	}
+	if !strings.Contains(output, "File filter mode: "+internal.FilterModeConservative) {
+		t.Errorf("verbose output should show the conservative mode, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Skipping file outside module root (conservative filter): "+cacheFile) {
+		t.Errorf("module cache file should be reported as skipped, got:\n%s", output)
+	}
+}
+
+func TestFilterUserFilesModulelessStaysInPackageDir(t *testing.T) {
+	base := t.TempDir()
+	pkgDir := filepath.Join(base, "app")
+	writeFile(t, pkgDir, "main.go", "package main\n")
+
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	if err := os.Chdir(pkgDir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+
+	// A relative GOROOT, as seen with -trimpath, defeats the GOROOT prefix
+	// check; its directory also shares a prefix with the package directory
+	t.Setenv("GOAHEAD_VERBOSE", "filter")
+	t.Setenv("GOROOT", filepath.Join("..", "app-go"))
+	t.Setenv("GOPATH", filepath.FromSlash("/tmp/go"))
+
+	gorootFile := filepath.Join(base, "app-go", "src", "fmt", "print.go")
+	gorootTest := filepath.Join("..", "app-go", "src", "fmt", "fmt_test.go")
+	local := filepath.Join(pkgDir, "util", "util.go")
+
+	var got []string
+	output := captureStderr(t, func() {
+		got = internal.FilterUserFiles([]string{gorootFile, gorootTest, "main.go", local})
+	})
+
+	if len(got) != 2 || got[0] != "main.go" || got[1] != local {
+		t.Fatalf("expected only files under the package directory, got %v", got)
+	}
+	if !strings.Contains(output, "File filter mode: "+internal.FilterModeModuleless) {
+		t.Errorf("verbose output should show the module-less mode, got:\n%s", output)
+	}
+	for _, skipped := range []string{gorootFile, gorootTest} {
+		if !strings.Contains(output, "(module-less mode): "+skipped) {
+			t.Errorf("%s should be reported as skipped, got:\n%s", skipped, output)
+		}
+	}
+}
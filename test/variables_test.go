@@ -0,0 +1,153 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+const variableHelpers = `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "fmt"
+
+func Connect(host string, port int) string { return fmt.Sprintf("%s:%d", host, port) }
+
+func Upper(s string) string { return s }
+`
+
+const variableProjectFile = `profile = "dev"
+
+[vars]
+db_port = 5432 # shared by every profile
+
+[profile.dev]
+db_host = "localhost"
+
+[profile.prod]
+db_host = 'db.internal'
+db_port = 6432
+`
+
+// variablesProject is a module with the project file project, if any
+func variablesProject(project string) map[string]string {
+	files := map[string]string{
+		"helpers.go": variableHelpers,
+		"main.go": `package main
+
+//:Connect:${db_host}:${db_port}
+var dsn = ""
+
+//:Upper:"host=${db_host}"
+var label = ""
+
+func main() { println(dsn, label) }
+`,
+	}
+	if project != "" {
+		files[".goahead.toml"] = project
+	}
+	return files
+}
+
+func TestVariablesFromProjectFile(t *testing.T) {
+	for _, tc := range []struct {
+		profile string
+		want    []string
+	}{
+		{"", []string{`var dsn = "localhost:5432"`, `var label = "host=localhost"`}},
+		{"prod", []string{`var dsn = "db.internal:6432"`, `var label = "host=db.internal"`}},
+	} {
+		dir, _ := setupTestDir(t, variablesProject(variableProjectFile))
+		report, err := runWithReport(t, internal.Config{Dir: dir, Profile: tc.profile})
+		if err != nil {
+			t.Fatalf("profile %q: RunCodegen failed: %v", tc.profile, err)
+		}
+		if report.Len() != 0 {
+			t.Fatalf("profile %q: expected no skipped markers, got:\n%s", tc.profile, report.Format(dir))
+		}
+		content := readMain(t, dir)
+		for _, want := range tc.want {
+			if !strings.Contains(content, want) {
+				t.Errorf("profile %q: expected %q in:\n%s", tc.profile, want, content)
+			}
+		}
+		if !strings.Contains(content, "//:Connect:${db_host}:${db_port}") {
+			t.Errorf("the marker must keep its references:\n%s", content)
+		}
+	}
+}
+
+func TestVariablesEnvironmentOverride(t *testing.T) {
+	dir, _ := setupTestDir(t, variablesProject(variableProjectFile))
+	t.Setenv("GOAHEAD_PROFILE", "prod")
+	t.Setenv("GOAHEAD_VAR_db_port", "7000")
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if report.Len() != 0 {
+		t.Fatalf("expected no skipped markers, got:\n%s", report.Format(dir))
+	}
+	if content := readMain(t, dir); !strings.Contains(content, `var dsn = "db.internal:7000"`) {
+		t.Errorf("expected the environment to override db_port:\n%s", content)
+	}
+
+	// Without a project file the environment alone defines variables; the
+	// interpolated arguments are the cache key, so equal markers referencing
+	// different values are evaluated separately
+	dir, _ = setupTestDir(t, variablesProject(""))
+	t.Setenv("GOAHEAD_VAR_primary", "one")
+	t.Setenv("GOAHEAD_VAR_replica", "two")
+	writeFile(t, dir, "main.go", `package main
+
+//:Upper:${primary}
+var primary = ""
+
+//:Upper:${replica}
+var replica = ""
+
+func main() { println(primary, replica) }
+`)
+	if _, err := runWithReport(t, internal.Config{Dir: dir}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{`var primary = "one"`, `var replica = "two"`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+}
+
+func TestUndefinedVariableSkipsMarker(t *testing.T) {
+	dir, _ := setupTestDir(t, variablesProject(variableProjectFile))
+	writeFile(t, dir, "main.go", `package main
+
+//:Connect:${db_user}:${db_port}
+var dsn = ""
+
+func main() { println(dsn) }
+`)
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	skip := singleSkip(t, report)
+	if skip.Reason != internal.SkipUndefinedVariable || skip.Line != 3 {
+		t.Fatalf("expected an undefined-variable skip at line 3, got %+v", skip)
+	}
+	if want := "undefined variable ${db_user} (defined: db_host, db_port)"; skip.Suggestion != want {
+		t.Errorf("expected suggestion %q, got %q", want, skip.Suggestion)
+	}
+	if !strings.Contains(readMain(t, dir), `var dsn = ""`) {
+		t.Error("target line should be unchanged")
+	}
+
+	if _, err := runWithReport(t, internal.Config{Dir: dir, Profile: "staging"}); err == nil || !strings.Contains(err.Error(), `profile "staging" is not defined`) || !strings.Contains(err.Error(), "(profiles: dev, prod)") {
+		t.Errorf("expected an error for an unknown profile, got %v", err)
+	}
+}
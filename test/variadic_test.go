@@ -0,0 +1,77 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+func TestVariadicHelperArguments(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GOAHEAD_CACHE", "off")
+	writeFile(t, dir, "go.mod", "module testmod\ngo 1.22\n")
+	writeFile(t, dir, "helpers.go", `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "strings"
+
+func Sum(values ...int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func Scale(factor float64, values ...int8) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += float64(v)
+	}
+	return total * factor
+}
+
+func Join(sep string, parts ...string) string { return strings.Join(parts, sep) }
+`)
+	writeFile(t, dir, "main.go", `package main
+
+//:Sum:1:2:3
+var sum = 0
+
+//:Sum
+var none = 1
+
+//:Scale:0.5:4:6
+var scaled = 0.0
+
+//:Join:"-"
+var empty = "x"
+
+//:Join:"-":a:b
+var joined = ""
+
+//:Sum:1:two:3
+var bad = 0
+
+func main() {}
+`)
+
+	report, err := runWithReport(t, internal.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	content := readMain(t, dir)
+	for _, want := range []string{`var sum = 6`, `var none = 0`, `var scaled = 5`, `var empty = ""`, `var joined = "a-b"`, `var bad = 0`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+
+	skip := singleSkip(t, report)
+	if skip.Line != 18 || !strings.Contains(skip.Suggestion, "argument 1 for Sum: two is not a number, as int requires") {
+		t.Errorf("expected the non-numeric argument reported, got %+v", skip)
+	}
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// vendoredModule is a module whose helpers import a vendored dependency
+func vendoredModule(helperImport string) map[string]string {
+	return map[string]string{
+		"go.mod":                               "module testmod\n\ngo 1.22\n\nrequire example.com/greet v1.0.0\n",
+		filepath.Join("vendor", "modules.txt"): "# example.com/greet v1.0.0\n## explicit; go 1.22\nexample.com/greet\n",
+		filepath.Join("vendor", "example.com", "greet", "greet.go"): `package greet
+
+func Hello(name string) string { return "hello " + name }
+`,
+		"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+import "` + helperImport + `"
+
+func Greeting() string { return greet.Hello("vendor") }
+`,
+		"main.go": `package main
+
+//:Greeting
+var greeting = ""
+
+func main() {}
+`,
+	}
+}
+
+func TestVendoredHelperEvaluationOffline(t *testing.T) {
+	dir, _ := setupTestDir(t, vendoredModule("example.com/greet"))
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOFLAGS", "-mod=mod") // an explicit -mod on the goahead command line wins
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Offline: true, ModFlag: "vendor"}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if main := readMain(t, dir); !strings.Contains(main, `var greeting = "hello vendor"`) {
+		t.Errorf("vendored helper was not evaluated, got:\n%s", main)
+	}
+}
+
+func TestVendoredHelperDetectsVendorDirectory(t *testing.T) {
+	dir, _ := setupTestDir(t, vendoredModule("example.com/greet"))
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOFLAGS", "")
+
+	if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, Offline: true}); err != nil {
+		t.Fatalf("RunCodegen failed: %v", err)
+	}
+	if main := readMain(t, dir); !strings.Contains(main, `var greeting = "hello vendor"`) {
+		t.Errorf("vendor directory should be used automatically, got:\n%s", main)
+	}
+}
+
+func TestVendoredHelperMissingDependencyExplained(t *testing.T) {
+	dir, _ := setupTestDir(t, vendoredModule("example.com/missing/greet"))
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOFLAGS", "")
+
+	var report *internal.SkipReport
+	output := captureStderr(t, func() {
+		var err error
+		report, err = internal.RunCodegenWithReport(internal.Config{Dir: dir, Offline: true})
+		if err != nil {
+			t.Errorf("RunCodegen failed: %v", err)
+		}
+	})
+	if !strings.Contains(output, "dependency example.com/missing/greet is missing from vendor/") {
+		t.Errorf("failure should name the missing dependency, got:\n%s", output)
+	}
+	if report.Len() != 1 || report.Markers()[0].Reason != internal.SkipExecFailed {
+		t.Errorf("expected one exec-failed marker, got %+v", report.Markers())
+	}
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// captureStderr runs fn with os.Stderr redirected and returns what was written
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	orig := os.Stderr
+	os.Stderr = w
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		_, _ = io.Copy(&buf, r)
+		done <- buf.String()
+	}()
+	defer func() { os.Stderr = orig }()
+
+	fn()
+
+	_ = w.Close()
+	os.Stderr = orig
+	return <-done
+}
+
+var verboseFixture = map[string]string{
+	"helpers.go": `//go:build exclude
+//go:ahead functions
+
+package main
+
+func Name() string { return "same" }
+`,
+	"main.go": `package main
+
+//:Name
+var name = "same"
+
+func main() {}
+`,
+}
+
+func TestVerboseCategoriesReplaceOnly(t *testing.T) {
+	dir, _ := setupTestDir(t, verboseFixture)
+	t.Setenv("GOAHEAD_VERBOSE", "replace")
+
+	output := captureStderr(t, func() {
+		internal.FilterUserFiles([]string{filepath.Join("vendor", "dep.go")})
+		if err := internal.RunCodegenWithConfig(internal.Config{Dir: dir, LogCategories: "replace"}); err != nil {
+			t.Errorf("RunCodegen failed: %v", err)
+		}
+	})
+
+	if !strings.Contains(output, "[goahead] Unchanged in") {
+		t.Errorf("replace category should log unchanged markers, got:\n%s", output)
+	}
+	if strings.Contains(output, "[goahead] Skipping") {
+		t.Errorf("filter logs must be absent when only replace is enabled, got:\n%s", output)
+	}
+}
+
+func TestVerboseCategoriesBareOneEnablesEverything(t *testing.T) {
+	t.Setenv("GOAHEAD_VERBOSE", "1")
+
+	output := captureStderr(t, func() {
+		internal.FilterUserFiles([]string{filepath.Join("vendor", "dep.go")})
+	})
+	if !strings.Contains(output, "[goahead] Skipping") {
+		t.Errorf("GOAHEAD_VERBOSE=1 should keep filter logs, got:\n%s", output)
+	}
+
+	logger := internal.NewLogger("1")
+	for _, cat := range internal.LogCategories {
+		if !logger.Enabled(cat) {
+			t.Errorf("category %s should be enabled by GOAHEAD_VERBOSE=1", cat)
+		}
+	}
+}
+
+func TestVerboseCategoriesParsing(t *testing.T) {
+	logger := internal.NewLogger(" Replace , inject ")
+	if !logger.Enabled(internal.LogReplace) || !logger.Enabled(internal.LogInject) {
+		t.Error("replace and inject should be enabled")
+	}
+	if logger.Enabled(internal.LogFilter) || logger.All() {
+		t.Error("only the listed categories should be enabled")
+	}
+	if internal.NewLogger("0").Any() || internal.NewLogger("").Any() {
+		t.Error("empty and 0 specs should disable logging")
+	}
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AeonDave/goahead/internal"
+)
+
+// The paths below are synthetic Windows long paths and UNC shares; the
+// functions treat them as strings, so the tests run on every OS.
+
+func TestStripLongPathPrefix(t *testing.T) {
+	tests := map[string]string{
+		`\\?\C:\very\long\proj`:         `C:\very\long\proj`,
+		`\\?\UNC\server\share\proj`:     `\\server\share\proj`,
+		`\\?\unc\server\share`:          `\\server\share`,
+		`\\server\share\proj`:           `\\server\share\proj`,
+		`C:\proj`:                       `C:\proj`,
+		"/home/user/proj":               "/home/user/proj",
+		`\\?\C:\proj\with\?\in\name.go`: `C:\proj\with\?\in\name.go`,
+	}
+	for in, want := range tests {
+		if got := internal.StripLongPathPrefix(in); got != want {
+			t.Errorf("StripLongPathPrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestPathWithinLongAndUNCPaths(t *testing.T) {
+	tests := []struct {
+		path, dir string
+		want      bool
+	}{
+		{`\\?\C:\very\long\proj\main.go`, `C:\very\long\proj`, true},
+		{`C:\very\long\proj\main.go`, `\\?\C:\very\long\proj`, true},
+		{`c:\Very\Long\PROJ\main.go`, `C:\very\long\proj`, true},
+		{`C:/very/long/proj/main.go`, `C:\very\long\proj\`, true},
+		{`C:\very\long\proj`, `C:\very\long\proj`, true},
+		{`C:\very\long\project\main.go`, `C:\very\long\proj`, false},
+		{`D:\very\long\proj\main.go`, `C:\very\long\proj`, false},
+		{`\\server\share\proj\a.go`, `\\?\UNC\server\share\proj`, true},
+		{`\\?\UNC\server\share\proj\a.go`, `\\server\share`, true},
+		{`\\server\share\proj2\a.go`, `\\server\share\proj`, false},
+		{`\\server\other\proj\a.go`, `\\server\share`, false},
+		{`\\server\share\proj\..\other\a.go`, `\\server\share\proj`, false},
+		{"/home/user/proj/main.go", "/home/user/proj", true},
+		{"/home/user/proj2/main.go", "/home/user/proj", false},
+		{"/Home/user/proj/main.go", "/home/user/proj", false},
+	}
+	for _, tc := range tests {
+		if got := internal.PathWithin(tc.path, tc.dir); got != tc.want {
+			t.Errorf("PathWithin(%q, %q) = %v, want %v", tc.path, tc.dir, got, tc.want)
+		}
+	}
+}
+
+func TestFileFilterLongAndUNCPaths(t *testing.T) {
+	goroot, gopath := `C:\Program Files\Go`, `C:\Users\dev\go`
+	system := []string{
+		`\\?\C:\Program Files\Go\src\fmt\print.go`,
+		`c:\program files\go\src\strings\builder.go`,
+		`\\?\C:\Users\dev\go\pkg\mod\example.com\lib@v1.0.0\lib.go`,
+	}
+	for _, file := range system {
+		if !internal.IsSystemFile(file, goroot, gopath) {
+			t.Errorf("expected %s to be a system file", file)
+		}
+	}
+	user := []string{
+		`\\?\C:\very\long\proj\main.go`,
+		`\\?\UNC\server\share\proj\cmd\tool.go`,
+		`C:\Program Files\Gopher\main.go`,
+	}
+	for _, file := range user {
+		if internal.IsSystemFile(file, goroot, gopath) {
+			t.Errorf("expected %s not to be a system file", file)
+		}
+	}
+
+	tests := []struct {
+		file, cwd, moduleRoot string
+		want                  bool
+	}{
+		{`\\?\C:\very\long\proj\main.go`, `C:\very\long\proj`, "", true},
+		{`\\?\UNC\server\share\proj\cmd\tool.go`, `\\server\share\proj\cmd`, `\\server\share\proj`, true},
+		{`\\server\share\proj\pkg\lib.go`, `\\server\share\proj\cmd`, `\\?\UNC\server\share\proj`, true},
+		{`\\server\share\projects\lib.go`, `\\server\share\proj`, "", false},
+		{`\\server\other\proj\lib.go`, `\\server\share\proj`, "", false},
+		{`D:\elsewhere\lib.go`, `C:\very\long\proj`, `C:\very\long`, false},
+		{`pkg\lib.go`, `C:\very\long\proj`, "", true},
+	}
+	for _, tc := range tests {
+		if got := internal.IsUserFile(tc.file, tc.cwd, tc.moduleRoot); got != tc.want {
+			t.Errorf("IsUserFile(%q, %q, %q) = %v, want %v", tc.file, tc.cwd, tc.moduleRoot, got, tc.want)
+		}
+	}
+}
+
+func TestFindCommonDirLongAndUNCPaths(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  string
+	}{
+		{[]string{`\\?\C:\very\long\proj\a\x.go`, `C:\very\long\proj\b\y.go`}, `C:\very\long\proj`},
+		{[]string{`\\server\share\proj\a.go`, `\\?\UNC\server\share\proj\sub\b.go`}, `\\server\share\proj`},
+		{[]string{`\\server\share\a\x.go`, `\\server\share\b\y.go`}, `\\server\share\`},
+		{[]string{`C:\proj\a\x.go`, `C:\project\y.go`}, `C:\`},
+		{[]string{"/src/proj/a/x.go", "/src/project/y.go"}, "/src"},
+	}
+	for _, tc := range tests {
+		if got := internal.FindCommonDir(tc.files); got != tc.want {
+			t.Errorf("FindCommonDir(%q) = %q, want %q", tc.files, got, tc.want)
+		}
+	}
+}
+
+func TestFindModuleRootLongAndUNCPaths(t *testing.T) {
+	var probed []string
+	exists := func(modules ...string) func(string) bool {
+		probed = nil
+		return func(path string) bool {
+			probed = append(probed, path)
+			for _, module := range modules {
+				if path == module {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	if got := internal.FindModuleRoot(`\\?\UNC\server\share\proj\cmd\tool`, exists(`\\server\share\proj\go.mod`)); got != `\\server\share\proj` {
+		t.Errorf("expected the UNC module root, got %q after probing %q", got, probed)
+	}
+	if got := internal.FindModuleRoot(`\\?\C:\very\long\proj\pkg`, exists(`C:\very\long\proj\go.mod`)); got != `C:\very\long\proj` {
+		t.Errorf("expected the module root without the prefix, got %q after probing %q", got, probed)
+	}
+
+	// Without a go.mod the walk stops at the root of the share
+	if got := internal.FindModuleRoot(`\\server\share\proj\cmd`, exists()); got != "" {
+		t.Errorf("expected no module root, got %q", got)
+	}
+	want := []string{`\\server\share\proj\cmd\go.mod`, `\\server\share\proj\go.mod`, `\\server\share\go.mod`}
+	if strings.Join(probed, " ") != strings.Join(want, " ") {
+		t.Errorf("expected the walk to stop at the share, probed %q", probed)
+	}
+}